@@ -0,0 +1,197 @@
+package cmds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/manifest"
+)
+
+func GetApplyCommand(root *cli.Root) *cobra.Command {
+	var (
+		files       []string
+		prune       bool
+		dryRun      bool
+		autoApprove bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply roles, service accounts, role assignments and registration tokens from manifest files",
+		Long: "Apply reads HCL (.hcl) or YAML (.yaml, .yml, .json) manifests, prints the changes required to reach\n" +
+			"the declared state and applies them after confirmation. Directories are searched for manifest files.",
+		Example: "idmctl apply -f roles.hcl -f service-accounts.yaml --prune",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := readManifests(files)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+
+			if err := m.Validate(); err != nil {
+				logrus.Fatal(err)
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := manifest.ApplyRequest{
+				Manifest: *m,
+				Prune:    prune,
+				DryRun:   true,
+			}
+
+			var plan manifest.ApplyResponse
+			if err := client.Call(root.Context(), manifest.ApplyProcedure, &req, &plan); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printPlan(plan.Changes)
+
+			if dryRun || countChanges(plan.Changes) == 0 {
+				return
+			}
+
+			if !autoApprove {
+				fmt.Print("Apply these changes? [y/N]: ")
+
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil {
+					logrus.Fatal(err)
+				}
+
+				if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+					logrus.Info("aborted")
+					return
+				}
+			}
+
+			req.DryRun = false
+
+			var res manifest.ApplyResponse
+			if err := client.Call(root.Context(), manifest.ApplyProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			logrus.Infof("applied %d change(s)", countChanges(res.Changes))
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringArrayVarP(&files, "file", "f", nil, "Manifest file or directory to apply, may be repeated. Use - to read YAML from stdin")
+		flags.BoolVar(&prune, "prune", false, "Delete roles and service accounts that are not part of the manifests and remove undeclared role assignments of declared users")
+		flags.BoolVar(&dryRun, "dry-run", false, "Only print the plan")
+		flags.BoolVarP(&autoApprove, "yes", "y", false, "Apply the changes without asking for confirmation")
+	}
+
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func readManifests(paths []string) (*manifest.Manifest, error) {
+	var manifests []*manifest.Manifest
+
+	for _, path := range paths {
+		if path == "-" {
+			content, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, err
+			}
+
+			m, err := manifest.Parse("stdin.yaml", content)
+			if err != nil {
+				return nil, err
+			}
+
+			manifests = append(manifests, m)
+			continue
+		}
+
+		files := []string{path}
+
+		if stat, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if stat.IsDir() {
+			files = nil
+
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				switch strings.ToLower(filepath.Ext(e.Name())) {
+				case ".hcl", ".yaml", ".yml", ".json":
+					if !e.IsDir() {
+						files = append(files, filepath.Join(path, e.Name()))
+					}
+				}
+			}
+		}
+
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			m, err := manifest.Parse(file, content)
+			if err != nil {
+				return nil, err
+			}
+
+			manifests = append(manifests, m)
+		}
+	}
+
+	return manifest.Merge(manifests...), nil
+}
+
+func countChanges(changes []manifest.Change) int {
+	count := 0
+	for _, c := range changes {
+		if c.Action != manifest.ActionSkip {
+			count++
+		}
+	}
+
+	return count
+}
+
+func printPlan(changes []manifest.Change) {
+	if len(changes) == 0 {
+		fmt.Println("No changes. The instance matches the manifests.")
+		return
+	}
+
+	for _, c := range changes {
+		symbol := map[string]string{
+			manifest.ActionCreate: "+",
+			manifest.ActionUpdate: "~",
+			manifest.ActionDelete: "-",
+			manifest.ActionSkip:   "!",
+		}[c.Action]
+
+		line := fmt.Sprintf("%s %s %s %q", symbol, c.Action, c.Kind, c.Name)
+		if c.Origin != "" {
+			line += fmt.Sprintf(" (origin: %s)", c.Origin)
+		}
+
+		fmt.Println(line)
+
+		for _, d := range c.Details {
+			fmt.Printf("    %s\n", d)
+		}
+	}
+
+	fmt.Printf("\nPlan: %d change(s)\n", countChanges(changes))
+}
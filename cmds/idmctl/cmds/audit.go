@@ -0,0 +1,161 @@
+package cmds
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+)
+
+type auditFilter struct {
+	actor      string
+	action     string
+	targetType string
+	target     string
+	since      string
+	until      string
+}
+
+func (f *auditFilter) register(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&f.actor, "actor", "", "Only include events performed by this actor (user ID or client IP for the admin listener)")
+		flags.StringVar(&f.action, "action", "", "Only include events for this action (for example tkd.idm.v1.RoleService/AssignRoleToUser)")
+		flags.StringVar(&f.targetType, "target-type", "", "Only include events for this target type (user, role, ...)")
+		flags.StringVar(&f.target, "target", "", "Only include events for this target ID")
+		flags.StringVar(&f.since, "since", "", "Only include events at or after this RFC3339 timestamp")
+		flags.StringVar(&f.until, "until", "", "Only include events before this RFC3339 timestamp")
+	}
+}
+
+func (f *auditFilter) request() *audit.ListEventsRequest {
+	req := &audit.ListEventsRequest{
+		ActorID:    f.actor,
+		Action:     f.action,
+		TargetType: f.targetType,
+		TargetID:   f.target,
+	}
+
+	if f.since != "" {
+		t, err := time.Parse(time.RFC3339, f.since)
+		if err != nil {
+			logrus.Fatalf("invalid value for --since: %s", err)
+		}
+		req.From = &t
+	}
+
+	if f.until != "" {
+		t, err := time.Parse(time.RFC3339, f.until)
+		if err != nil {
+			logrus.Fatalf("invalid value for --until: %s", err)
+		}
+		req.To = &t
+	}
+
+	return req
+}
+
+func GetAuditCommand(root *cli.Root) *cobra.Command {
+	var (
+		filter    auditFilter
+		limit     int
+		pageToken string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query the administrative audit log",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := filter.request()
+			req.PageSize = limit
+			req.PageToken = pageToken
+
+			var res audit.ListEventsResponse
+			if err := client.Call(root.Context(), audit.ListEventsProcedure, req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	filter.register(cmd)
+	cmd.Flags().IntVar(&limit, "limit", 50, "The maximum number of events to return")
+	cmd.Flags().StringVar(&pageToken, "page-token", "", "Continue listing at the given page token")
+
+	cmd.AddCommand(
+		GetAuditExportCommand(root),
+	)
+
+	return cmd
+}
+
+func GetAuditExportCommand(root *cli.Root) *cobra.Command {
+	var (
+		filter auditFilter
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export audit log events as JSON lines",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					logrus.Fatal(err)
+				}
+				defer f.Close()
+
+				w = f
+			}
+
+			enc := json.NewEncoder(w)
+
+			req := filter.request()
+			req.PageSize = 1000
+
+			count := 0
+			for {
+				var res audit.ListEventsResponse
+				if err := client.Call(root.Context(), audit.ListEventsProcedure, req, &res); err != nil {
+					logrus.Fatal(err)
+				}
+
+				for _, e := range res.Events {
+					if err := enc.Encode(e); err != nil {
+						logrus.Fatal(err)
+					}
+				}
+
+				count += len(res.Events)
+
+				if res.NextPageToken == "" {
+					break
+				}
+
+				req.PageToken = res.NextPageToken
+			}
+
+			logrus.Infof("exported %d audit log events", count)
+		},
+	}
+
+	filter.register(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write events to this file instead of stdout")
+
+	return cmd
+}
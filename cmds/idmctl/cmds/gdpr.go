@@ -0,0 +1,227 @@
+package cmds
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/gdpr"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func GetExportDataCommand(root *cli.Root) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "export-data",
+		Short: "Download an archive of all personal data stored about you",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.ExportMyDataResponse
+			if err := client.Call(root.Context(), gdpr.ExportMyDataProcedure, &gdpr.ExportMyDataRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			if output == "" {
+				output = res.FileName
+			}
+
+			if err := os.WriteFile(output, res.Data, 0o600); err != nil {
+				logrus.Fatal(err)
+			}
+
+			logrus.Infof("data export written to %s", output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path of the archive, defaults to the file name suggested by the server")
+
+	return cmd
+}
+
+func GetRequestErasureCommand(root *cli.Root) *cobra.Command {
+	req := gdpr.RequestErasureRequest{}
+
+	cmd := &cobra.Command{
+		Use:   "request-erasure",
+		Short: "Request the erasure of your account",
+		Long:  "Request the erasure of your account. Depending on the server configuration the account is erased immediately or after an administrator approved the request.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if req.Confirmation == "" {
+				fmt.Print("This cannot be undone. Please enter your username to confirm: ")
+
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil {
+					logrus.Fatal(err)
+				}
+
+				req.Confirmation = strings.TrimSpace(line)
+			}
+
+			if req.Password == "" {
+				fmt.Print("Please enter your password (leave empty if none is set): ")
+				pwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Println()
+				if err != nil {
+					logrus.Fatal(err)
+				}
+
+				req.Password = string(pwd)
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.RequestErasureResponse
+			if err := client.Call(root.Context(), gdpr.RequestErasureProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.Confirmation, "confirm", "", "Your username to confirm the erasure")
+		flags.StringVarP(&req.Password, "password", "p", "", "Your current password")
+		flags.StringVar(&req.Reason, "reason", "", "An optional message for the administrators")
+	}
+
+	return cmd
+}
+
+func GetErasureStatusCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "erasure-status",
+		Short: "Show your pending erasure request",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.GetMyErasureRequestResponse
+			if err := client.Call(root.Context(), gdpr.GetMyErasureRequestProcedure, &gdpr.GetMyErasureRequestRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			if res.Request == nil {
+				logrus.Info("no pending erasure request")
+
+				return
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	return cmd
+}
+
+func GetCancelErasureCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel-erasure",
+		Short: "Cancel your pending erasure request",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.CancelErasureResponse
+			if err := client.Call(root.Context(), gdpr.CancelErasureProcedure, &gdpr.CancelErasureRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	return cmd
+}
+
+func GetErasureRequestsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "erasure-requests",
+		Aliases: []string{"erasure-request"},
+		Short:   "Manage account erasure requests",
+	}
+
+	cmd.AddCommand(
+		GetListErasureRequestsCommand(root),
+		GetApproveErasureCommand(root),
+		GetRejectErasureCommand(root),
+	)
+
+	return cmd
+}
+
+func GetListErasureRequestsCommand(root *cli.Root) *cobra.Command {
+	req := gdpr.ListErasureRequestsRequest{}
+
+	cmd := &cobra.Command{
+		Use:  "list",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.ListErasureRequestsResponse
+			if err := client.Call(root.Context(), gdpr.ListErasureRequestsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	cmd.Flags().StringVar(&req.Status, "status", "", "Only list requests with the given status (pending, completed, rejected or cancelled)")
+
+	return cmd
+}
+
+func GetApproveErasureCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve [request-id]",
+		Short: "Approve a pending erasure request and erase the account",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.ApproveErasureResponse
+			if err := client.Call(root.Context(), gdpr.ApproveErasureProcedure, &gdpr.ApproveErasureRequest{ID: args[0]}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	return cmd
+}
+
+func GetRejectErasureCommand(root *cli.Root) *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:  "reject [request-id]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res gdpr.RejectErasureResponse
+			if err := client.Call(root.Context(), gdpr.RejectErasureProcedure, &gdpr.RejectErasureRequest{ID: args[0], Reason: reason}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "The reason for rejecting the request")
+
+	return cmd
+}
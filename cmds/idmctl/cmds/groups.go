@@ -0,0 +1,303 @@
+package cmds
+
+import (
+	"encoding/json"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/groups"
+)
+
+func GetGroupsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "groups",
+		Aliases: []string{"group"},
+		Short:   "Manage groups, their members and roles",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			if len(args) == 0 {
+				var res groups.ListGroupsResponse
+				if err := client.Call(root.Context(), groups.ListGroupsProcedure, &groups.ListGroupsRequest{}, &res); err != nil {
+					logrus.Fatal(err)
+				}
+
+				root.Print(res.Groups)
+
+				return
+			}
+
+			root.Print(getGroup(root, client, args[0]))
+		},
+	}
+
+	cmd.AddCommand(
+		GetCreateGroupCommand(root),
+		GetUpdateGroupCommand(root),
+		GetDeleteGroupCommand(root),
+		GetAddGroupMembersCommand(root),
+		GetRemoveGroupMembersCommand(root),
+		GetGroupRoleCommand(root, "assign-role", groups.AssignRoleToGroupProcedure),
+		GetGroupRoleCommand(root, "unassign-role", groups.UnassignRoleFromGroupProcedure),
+		GetSubgroupCommand(root, "add-subgroup", groups.AddSubgroupProcedure),
+		GetSubgroupCommand(root, "remove-subgroup", groups.RemoveSubgroupProcedure),
+		GetUserGroupsCommand(root),
+	)
+
+	return cmd
+}
+
+// getGroup returns the group identified by the given ID or name.
+func getGroup(root *cli.Root, client *httpapi.Client, idOrName string) *groups.GetGroupResponse {
+	var res groups.GetGroupResponse
+
+	err := client.Call(root.Context(), groups.GetGroupProcedure, &groups.GetGroupRequest{ID: idOrName}, &res)
+	if connect.CodeOf(err) == connect.CodeNotFound {
+		err = client.Call(root.Context(), groups.GetGroupProcedure, &groups.GetGroupRequest{Name: idOrName}, &res)
+	}
+
+	if err != nil {
+		logrus.Fatalf("failed to resolve group %q: %s", idOrName, err)
+	}
+
+	return &res
+}
+
+func GetCreateGroupCommand(root *cli.Root) *cobra.Command {
+	var (
+		req      groups.CreateGroupRequest
+		metadata string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "create",
+		Aliases: []string{"new"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			if metadata != "" {
+				req.Metadata = json.RawMessage(metadata)
+			}
+
+			var res groups.CreateGroupResponse
+			if err := client.Call(root.Context(), groups.CreateGroupProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Group)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.ID, "id", "", "The ID for the new group. If unset, a random UUID will be generated")
+		flags.StringVar(&req.Name, "name", "", "The name for the new group")
+		flags.StringVar(&req.Description, "description", "", "The description for the new group")
+		flags.StringVar(&metadata, "metadata", "", "Additional metadata for the group as a JSON object")
+	}
+
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+func GetUpdateGroupCommand(root *cli.Root) *cobra.Command {
+	var (
+		req      groups.UpdateGroupRequest
+		metadata string
+	)
+
+	cmd := &cobra.Command{
+		Use:  "update [group-id/name]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req.ID = getGroup(root, client, args[0]).Group.ID
+
+			flags := cmd.Flags()
+			if flags.Changed("name") {
+				req.FieldMask = append(req.FieldMask, "name")
+			}
+
+			if flags.Changed("description") {
+				req.FieldMask = append(req.FieldMask, "description")
+			}
+
+			if flags.Changed("metadata") {
+				req.FieldMask = append(req.FieldMask, "metadata")
+				req.Metadata = json.RawMessage(metadata)
+			}
+
+			if len(req.FieldMask) == 0 {
+				logrus.Fatal("nothing to update")
+			}
+
+			var res groups.UpdateGroupResponse
+			if err := client.Call(root.Context(), groups.UpdateGroupProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Group)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.Name, "name", "", "The new name of the group")
+		flags.StringVar(&req.Description, "description", "", "The new description of the group")
+		flags.StringVar(&metadata, "metadata", "", "The new metadata of the group as a JSON object")
+	}
+
+	return cmd
+}
+
+func GetDeleteGroupCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "delete [group-id/name]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			group := getGroup(root, client, args[0])
+
+			if err := client.Call(root.Context(), groups.DeleteGroupProcedure, &groups.DeleteGroupRequest{ID: group.Group.ID}, nil); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetAddGroupMembersCommand(root *cli.Root) *cobra.Command {
+	var owner bool
+
+	cmd := &cobra.Command{
+		Use:   "add-members [group-id/name] [user...]",
+		Short: "Add users to a group",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			group := getGroup(root, client, args[0])
+
+			if err := client.Call(root.Context(), groups.AddGroupMembersProcedure, &groups.AddGroupMembersRequest{
+				GroupID: group.Group.ID,
+				UserIDs: root.MustResolveUserIds(args[1:]),
+				Owner:   owner,
+			}, nil); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&owner, "owner", false, "Add the users as owners of the group")
+
+	return cmd
+}
+
+func GetRemoveGroupMembersCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove-members [group-id/name] [user...]",
+		Short: "Remove users from a group",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			group := getGroup(root, client, args[0])
+
+			if err := client.Call(root.Context(), groups.RemoveGroupMembersProcedure, &groups.RemoveGroupMembersRequest{
+				GroupID: group.Group.ID,
+				UserIDs: root.MustResolveUserIds(args[1:]),
+			}, nil); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetGroupRoleCommand(root *cli.Root, use string, procedure string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  use + " [group-id/name] [role-id/name...]",
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			group := getGroup(root, client, args[0])
+
+			for _, arg := range args[1:] {
+				role, err := root.ResolveRole(arg)
+				if err != nil {
+					logrus.Fatalf("failed to resolve role: %s", err)
+				}
+
+				if err := client.Call(root.Context(), procedure, &groups.GroupRoleRequest{
+					GroupID: group.Group.ID,
+					RoleID:  role.Id,
+				}, nil); err != nil {
+					logrus.Fatal(err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetSubgroupCommand(root *cli.Root, use string, procedure string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  use + " [group-id/name] [subgroup-id/name...]",
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			group := getGroup(root, client, args[0])
+
+			for _, arg := range args[1:] {
+				subgroup := getGroup(root, client, arg)
+
+				if err := client.Call(root.Context(), procedure, &groups.SubgroupRequest{
+					GroupID:    group.Group.ID,
+					SubgroupID: subgroup.Group.ID,
+				}, nil); err != nil {
+					logrus.Fatal(err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetUserGroupsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "of [user]",
+		Short: "List all groups a user is a member of, defaults to the current user",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var req groups.ListUserGroupsRequest
+			if len(args) == 1 {
+				req.UserID = root.MustResolveUserIds(args)[0]
+			}
+
+			var res groups.ListUserGroupsResponse
+			if err := client.Call(root.Context(), groups.ListUserGroupsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Groups)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,63 @@
+package cmds
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/maintenance"
+)
+
+func GetMaintenanceCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Inspect and run background maintenance jobs",
+	}
+
+	cmd.AddCommand(
+		GetListMaintenanceJobsCommand(root),
+		GetRunMaintenanceJobCommand(root),
+	)
+
+	return cmd
+}
+
+func GetListMaintenanceJobsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all maintenance jobs and their last run",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res maintenance.ListJobsResponse
+			if err := client.Call(root.Context(), maintenance.ListJobsProcedure, &maintenance.ListJobsRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
+
+func GetRunMaintenanceJobCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run [job]",
+		Short: "Run a maintenance job immediately",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res maintenance.RunJobResponse
+			if err := client.Call(root.Context(), maintenance.RunJobProcedure, &maintenance.RunJobRequest{Name: args[0]}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
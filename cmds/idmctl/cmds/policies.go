@@ -0,0 +1,43 @@
+package cmds
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+)
+
+func GetPoliciesCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "policies",
+		Aliases: []string{"policy"},
+		Short:   "Inspect the loaded rego policies",
+	}
+
+	cmd.AddCommand(
+		GetPolicyRevisionCommand(root),
+	)
+
+	return cmd
+}
+
+func GetPolicyRevisionCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revision",
+		Short: "Show the active policy revision and the result of the last reload",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res policy.GetRevisionResponse
+			if err := client.Call(root.Context(), policy.GetRevisionProcedure, &policy.GetRevisionRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
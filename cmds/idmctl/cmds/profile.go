@@ -68,6 +68,10 @@ func GetProfileCommand(root *cli.Root) *cobra.Command {
 		GetGenerateRecoveryCodesCommand(root),
 		GetSetAvatarCommand(root),
 		GetAPITokenCommand(root),
+		GetExportDataCommand(root),
+		GetRequestErasureCommand(root),
+		GetErasureStatusCommand(root),
+		GetCancelErasureCommand(root),
 	)
 
 	return cmd
@@ -0,0 +1,240 @@
+package cmds
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/relations"
+)
+
+func GetRelationsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "relations",
+		Aliases: []string{"relation", "rel"},
+		Short:   "Manage and check resource-scoped relations",
+	}
+
+	cmd.AddCommand(
+		GetWriteRelationsCommand(root),
+		GetDeleteRelationsCommand(root),
+		GetListRelationsCommand(root),
+		GetCheckRelationCommand(root),
+		GetListRelationObjectsCommand(root),
+		GetListRelationSubjectsCommand(root),
+	)
+
+	return cmd
+}
+
+// resolveRelationSubject resolves the user name of "user:<name>" subjects
+// to the user ID. All other subjects are returned as is.
+func resolveRelationSubject(root *cli.Root, subject string) string {
+	if name, ok := strings.CutPrefix(subject, "user:"); ok {
+		return "user:" + root.MustResolveUserToId(name)
+	}
+
+	return subject
+}
+
+func relationTuples(root *cli.Root, args []string) []relations.RelationTuple {
+	tuples := make([]relations.RelationTuple, 0, len(args)-2)
+
+	for _, subject := range args[2:] {
+		tuples = append(tuples, relations.RelationTuple{
+			Object:   args[0],
+			Relation: args[1],
+			Subject:  resolveRelationSubject(root, subject),
+		})
+	}
+
+	return tuples
+}
+
+func GetWriteRelationsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "write [object] [relation] [subject...]",
+		Aliases: []string{"add"},
+		Example: "idmctl relations write document:1 editor user:alice team:vets#member",
+		Args:    cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := relations.WriteTuplesRequest{
+				Tuples: relationTuples(root, args),
+			}
+
+			var res relations.WriteTuplesResponse
+			if err := client.Call(root.Context(), relations.WriteTuplesProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetDeleteRelationsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete [object] [relation] [subject...]",
+		Aliases: []string{"remove", "rm"},
+		Args:    cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := relations.DeleteTuplesRequest{
+				Tuples: relationTuples(root, args),
+			}
+
+			var res relations.DeleteTuplesResponse
+			if err := client.Call(root.Context(), relations.DeleteTuplesProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
+
+func GetListRelationsCommand(root *cli.Root) *cobra.Command {
+	var (
+		req     relations.ReadTuplesRequest
+		subject string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			if subject != "" {
+				s, err := relations.ParseSubject(resolveRelationSubject(root, subject))
+				if err != nil {
+					logrus.Fatal(err)
+				}
+
+				req.SubjectType = s.Type
+				req.SubjectID = s.ID
+			}
+
+			var res relations.ReadTuplesResponse
+			if err := client.Call(root.Context(), relations.ReadTuplesProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Tuples)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.ObjectType, "type", "", "Only show tuples for objects of this type")
+		flags.StringVar(&req.ObjectID, "id", "", "Only show tuples for objects with this ID")
+		flags.StringVar(&req.Relation, "relation", "", "Only show tuples with this relation")
+		flags.StringVar(&subject, "subject", "", "Only show tuples for this subject, like user:alice")
+	}
+
+	return cmd
+}
+
+func GetCheckRelationCommand(root *cli.Root) *cobra.Command {
+	var subject string
+
+	cmd := &cobra.Command{
+		Use:     "check [object] [relation]",
+		Example: "idmctl relations check document:1 editor --subject user:alice",
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := relations.CheckRequest{
+				Object:   args[0],
+				Relation: args[1],
+			}
+
+			if subject != "" {
+				req.Subject = resolveRelationSubject(root, subject)
+			}
+
+			var res relations.CheckResponse
+			if err := client.Call(root.Context(), relations.CheckProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	cmd.Flags().StringVar(&subject, "subject", "", "The subject to check. Defaults to the current user")
+
+	return cmd
+}
+
+func GetListRelationObjectsCommand(root *cli.Root) *cobra.Command {
+	var subject string
+
+	cmd := &cobra.Command{
+		Use:     "objects [type] [relation]",
+		Example: "idmctl relations objects document editor --subject user:alice",
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := relations.ListObjectsRequest{
+				ObjectType: args[0],
+				Relation:   args[1],
+			}
+
+			if subject != "" {
+				req.Subject = resolveRelationSubject(root, subject)
+			}
+
+			var res relations.ListObjectsResponse
+			if err := client.Call(root.Context(), relations.ListObjectsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Objects)
+		},
+	}
+
+	cmd.Flags().StringVar(&subject, "subject", "", "The subject to list objects for. Defaults to the current user")
+
+	return cmd
+}
+
+func GetListRelationSubjectsCommand(root *cli.Root) *cobra.Command {
+	var subjectType string
+
+	cmd := &cobra.Command{
+		Use:     "subjects [object] [relation]",
+		Example: "idmctl relations subjects document:1 viewer --type user",
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req := relations.ListSubjectsRequest{
+				Object:      args[0],
+				Relation:    args[1],
+				SubjectType: subjectType,
+			}
+
+			var res relations.ListSubjectsResponse
+			if err := client.Call(root.Context(), relations.ListSubjectsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Subjects)
+		},
+	}
+
+	cmd.Flags().StringVar(&subjectType, "type", "", "Only show subjects of this type")
+
+	return cmd
+}
@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/roles"
 	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
@@ -64,7 +67,17 @@ func GetRoleCommand(root *cli.Root) *cobra.Command {
 		GetDeleteRoleCommand(root),
 		GetAssignRoleCommand(root),
 		GetUnassignRoleCommand(root),
+		GetRoleAssignmentsCommand(root),
 		GetResolveRolePermissions(root),
+		GetRoleInclusionsCommand(root),
+		GetIncludeRoleCommand(root),
+		GetExcludeRoleCommand(root),
+		GetRequestRoleCommand(root),
+		GetRoleRequestsCommand(root),
+		GetApproveRoleRequestCommand(root),
+		GetDenyRoleRequestCommand(root),
+		GetCancelRoleRequestCommand(root),
+		GetConstraintViolationsCommand(root),
 	)
 
 	return cmd
@@ -284,7 +297,10 @@ func GetDeleteRoleCommand(root *cli.Root) *cobra.Command {
 
 func GetAssignRoleCommand(root *cli.Root) *cobra.Command {
 	var (
-		users []string
+		users      []string
+		validFrom  string
+		validUntil string
+		validFor   time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -299,23 +315,119 @@ func GetAssignRoleCommand(root *cli.Root) *cobra.Command {
 
 			users = root.MustResolveUserIds(users)
 
-			_, err = root.Roles().AssignRoleToUser(context.Background(), connect.NewRequest(&idmv1.AssignRoleToUserRequest{
-				RoleId: role.Id,
-				UserId: users,
-			}))
-			if err != nil {
+			if validFrom == "" && validUntil == "" && validFor == 0 {
+				_, err = root.Roles().AssignRoleToUser(context.Background(), connect.NewRequest(&idmv1.AssignRoleToUserRequest{
+					RoleId: role.Id,
+					UserId: users,
+				}))
+				if err != nil {
+					logrus.Fatal(err)
+				}
+
+				return
+			}
+
+			req := roles.AssignRoleToUserWithValidityRequest{
+				RoleID:  role.Id,
+				UserIDs: users,
+			}
+
+			if validFrom != "" {
+				t, err := time.Parse(time.RFC3339, validFrom)
+				if err != nil {
+					logrus.Fatalf("invalid value for --valid-from: %s", err)
+				}
+
+				req.ValidFrom = &t
+			}
+
+			switch {
+			case validUntil != "" && validFor != 0:
+				logrus.Fatal("--valid-until and --for are mutually exclusive")
+
+			case validUntil != "":
+				t, err := time.Parse(time.RFC3339, validUntil)
+				if err != nil {
+					logrus.Fatalf("invalid value for --valid-until: %s", err)
+				}
+
+				req.ValidUntil = &t
+
+			case validFor != 0:
+				start := time.Now()
+				if req.ValidFrom != nil {
+					start = *req.ValidFrom
+				}
+
+				t := start.Add(validFor)
+				req.ValidUntil = &t
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.AssignRoleToUserWithValidityProcedure, &req, nil); err != nil {
 				logrus.Fatal(err)
 			}
 		},
 	}
 
-	cmd.Flags().StringSliceVar(&users, "to", nil, "A list of users ids to assign the role to")
+	flags := cmd.Flags()
+	{
+		flags.StringSliceVar(&users, "to", nil, "A list of users ids to assign the role to")
+		flags.StringVar(&validFrom, "valid-from", "", "A timestamp in RFC3339 at which the assignment becomes active")
+		flags.StringVar(&validUntil, "valid-until", "", "A timestamp in RFC3339 at which the assignment expires")
+		flags.DurationVar(&validFor, "for", 0, "Limit the assignment to the given duration, starting at --valid-from or now")
+	}
 
 	cmd.MarkFlagRequired("user")
 
 	return cmd
 }
 
+func GetRoleAssignmentsCommand(root *cli.Root) *cobra.Command {
+	var user string
+
+	cmd := &cobra.Command{
+		Use:   "assignments [role-id/name]",
+		Short: "List the direct assignments of a role or user including their validity period",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var req roles.ListRoleAssignmentsRequest
+
+			switch {
+			case len(args) == 1 && user != "":
+				logrus.Fatal("either specify a role or --user")
+
+			case len(args) == 1:
+				role, err := root.ResolveRole(args[0])
+				if err != nil {
+					logrus.Fatalf("failed to resolve role: %s", err)
+				}
+
+				req.RoleID = role.Id
+
+			case user != "":
+				req.UserID = root.MustResolveUserIds([]string{user})[0]
+
+			default:
+				logrus.Fatal("either specify a role or --user")
+			}
+
+			var res roles.ListRoleAssignmentsResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.ListRoleAssignmentsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Assignments)
+		},
+	}
+
+	cmd.Flags().StringVar(&user, "user", "", "List the role assignments of this user instead")
+
+	return cmd
+}
+
 func GetUnassignRoleCommand(root *cli.Root) *cobra.Command {
 	var (
 		users []string
@@ -349,3 +461,348 @@ func GetUnassignRoleCommand(root *cli.Root) *cobra.Command {
 
 	return cmd
 }
+
+func GetRoleInclusionsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inclusions [role-id/name]",
+		Short: "Show the roles included by a role",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			role, err := root.ResolveRole(args[0])
+			if err != nil {
+				logrus.Fatalf("failed to resolve role: %s", err)
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res roles.ListRoleInclusionsResponse
+			if err := client.Call(root.Context(), roles.ListRoleInclusionsProcedure, &roles.ListRoleInclusionsRequest{
+				RoleID: role.Id,
+			}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
+
+func GetIncludeRoleCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "include [role-id/name] [included-role-id/name...]",
+		Short: "Let a role include other roles",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			role, err := root.ResolveRole(args[0])
+			if err != nil {
+				logrus.Fatalf("failed to resolve role: %s", err)
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			for _, arg := range args[1:] {
+				included, err := root.ResolveRole(arg)
+				if err != nil {
+					logrus.Fatalf("failed to resolve role: %s", err)
+				}
+
+				if err := client.Call(root.Context(), roles.AddRoleInclusionProcedure, &roles.AddRoleInclusionRequest{
+					RoleID:         role.Id,
+					IncludedRoleID: included.Id,
+				}, new(roles.AddRoleInclusionResponse)); err != nil {
+					logrus.Fatal(err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetExcludeRoleCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exclude [role-id/name] [included-role-id/name...]",
+		Short: "Remove roles from the roles included by a role",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			role, err := root.ResolveRole(args[0])
+			if err != nil {
+				logrus.Fatalf("failed to resolve role: %s", err)
+			}
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			for _, arg := range args[1:] {
+				included, err := root.ResolveRole(arg)
+				if err != nil {
+					logrus.Fatalf("failed to resolve role: %s", err)
+				}
+
+				if err := client.Call(root.Context(), roles.RemoveRoleInclusionProcedure, &roles.RemoveRoleInclusionRequest{
+					RoleID:         role.Id,
+					IncludedRoleID: included.Id,
+				}, new(roles.RemoveRoleInclusionResponse)); err != nil {
+					logrus.Fatal(err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetRequestRoleCommand(root *cli.Root) *cobra.Command {
+	var (
+		justification string
+		validUntil    string
+		validFor      time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "request [role-id/name]",
+		Short: "Request a role for the current user",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			role, err := root.ResolveRole(args[0])
+			if err != nil {
+				logrus.Fatalf("failed to resolve role: %s", err)
+			}
+
+			req := roles.RequestRoleRequest{
+				RoleID:        role.Id,
+				Justification: justification,
+			}
+
+			switch {
+			case validUntil != "" && validFor != 0:
+				logrus.Fatal("--valid-until and --for are mutually exclusive")
+
+			case validUntil != "":
+				t, err := time.Parse(time.RFC3339, validUntil)
+				if err != nil {
+					logrus.Fatalf("invalid value for --valid-until: %s", err)
+				}
+
+				req.ValidUntil = &t
+
+			case validFor != 0:
+				t := time.Now().Add(validFor)
+				req.ValidUntil = &t
+			}
+
+			var res roles.RequestRoleResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.RequestRoleProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&justification, "justification", "", "Why the role is required")
+		flags.StringVar(&validUntil, "valid-until", "", "Request the role until the given timestamp in RFC3339")
+		flags.DurationVar(&validFor, "for", 0, "Request the role for the given duration")
+	}
+
+	return cmd
+}
+
+func GetRoleRequestsCommand(root *cli.Root) *cobra.Command {
+	var (
+		status string
+		role   string
+		user   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "requests",
+		Short: "List role requests of the current user and requests the user may decide",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			req := roles.ListRoleRequestsRequest{
+				Status: status,
+			}
+
+			if role != "" {
+				r, err := root.ResolveRole(role)
+				if err != nil {
+					logrus.Fatalf("failed to resolve role: %s", err)
+				}
+
+				req.RoleID = r.Id
+			}
+
+			if user != "" {
+				req.UserID = root.MustResolveUserIds([]string{user})[0]
+			}
+
+			var res roles.ListRoleRequestsResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.ListRoleRequestsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Requests)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&status, "status", roles.RoleRequestPending, "Only list requests with this status. Use an empty value to list all requests")
+		flags.StringVar(&role, "role", "", "Only list requests for this role")
+		flags.StringVar(&user, "user", "", "Only list requests of this user")
+	}
+
+	return cmd
+}
+
+func GetApproveRoleRequestCommand(root *cli.Root) *cobra.Command {
+	var (
+		comment    string
+		validFrom  string
+		validUntil string
+		validFor   time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "approve [request-id]",
+		Short: "Approve a role request",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := roles.DecideRoleRequestRequest{
+				ID:      args[0],
+				Comment: comment,
+			}
+
+			if validFrom != "" {
+				t, err := time.Parse(time.RFC3339, validFrom)
+				if err != nil {
+					logrus.Fatalf("invalid value for --valid-from: %s", err)
+				}
+
+				req.ValidFrom = &t
+			}
+
+			switch {
+			case validUntil != "" && validFor != 0:
+				logrus.Fatal("--valid-until and --for are mutually exclusive")
+
+			case validUntil != "":
+				t, err := time.Parse(time.RFC3339, validUntil)
+				if err != nil {
+					logrus.Fatalf("invalid value for --valid-until: %s", err)
+				}
+
+				req.ValidUntil = &t
+
+			case validFor != 0:
+				start := time.Now()
+				if req.ValidFrom != nil {
+					start = *req.ValidFrom
+				}
+
+				t := start.Add(validFor)
+				req.ValidUntil = &t
+			}
+
+			var res roles.DecideRoleRequestResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.ApproveRoleRequestProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&comment, "comment", "", "A comment for the requesting user")
+		flags.StringVar(&validFrom, "valid-from", "", "A timestamp in RFC3339 at which the assignment becomes active")
+		flags.StringVar(&validUntil, "valid-until", "", "A timestamp in RFC3339 at which the assignment expires. Defaults to the requested period")
+		flags.DurationVar(&validFor, "for", 0, "Limit the assignment to the given duration, starting at --valid-from or now")
+	}
+
+	return cmd
+}
+
+func GetDenyRoleRequestCommand(root *cli.Root) *cobra.Command {
+	var comment string
+
+	cmd := &cobra.Command{
+		Use:   "deny [request-id]",
+		Short: "Deny a role request",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := roles.DecideRoleRequestRequest{
+				ID:      args[0],
+				Comment: comment,
+			}
+
+			var res roles.DecideRoleRequestResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.DenyRoleRequestProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	cmd.Flags().StringVar(&comment, "comment", "", "A comment for the requesting user")
+
+	return cmd
+}
+
+func GetCancelRoleRequestCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel-request [request-id]",
+		Short: "Cancel a pending role request of the current user",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := roles.DecideRoleRequestRequest{
+				ID: args[0],
+			}
+
+			var res roles.DecideRoleRequestResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.CancelRoleRequestProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Request)
+		},
+	}
+
+	return cmd
+}
+
+func GetConstraintViolationsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "violations",
+		Short: "List existing violations of separation-of-duties constraints",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var res roles.ListConstraintViolationsResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), roles.ListConstraintViolationsProcedure, &roles.ListConstraintViolationsRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Violations)
+		},
+	}
+
+	return cmd
+}
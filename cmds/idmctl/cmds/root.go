@@ -19,7 +19,17 @@ func PrepareRootCommand(root *cli.Root) {
 		GetUsersCommand(root),
 		GetRegisterUserCommand(root),
 		GetRoleCommand(root),
+		GetGroupsCommand(root),
 		GetSendNotificationCommand(root),
+		GetAuditCommand(root),
+		GetWebhooksCommand(root),
+		GetRelationsCommand(root),
+		GetPoliciesCommand(root),
+		GetApplyCommand(root),
+		GetSCIMTargetsCommand(root),
+		GetErasureRequestsCommand(root),
+		GetMaintenanceCommand(root),
+		GetWatchCommand(root),
 		GenerateVAPIDKeys(),
 	)
 }
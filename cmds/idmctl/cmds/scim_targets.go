@@ -0,0 +1,90 @@
+package cmds
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/provisioning"
+)
+
+func GetSCIMTargetsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "scim-targets",
+		Aliases: []string{"scim-target"},
+		Short:   "Inspect and trigger provisioning to SCIM targets",
+	}
+
+	cmd.AddCommand(
+		GetSCIMTargetStatusCommand(root),
+		GetSCIMTargetUsersCommand(root),
+		GetSCIMTargetSyncCommand(root),
+	)
+
+	return cmd
+}
+
+func GetSCIMTargetStatusCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"list"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res provisioning.ListTargetsResponse
+			if err := client.Call(root.Context(), provisioning.ListTargetsProcedure, &provisioning.ListTargetsRequest{}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
+
+func GetSCIMTargetUsersCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "users [target]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res provisioning.ListProvisionedUsersResponse
+			if err := client.Call(root.Context(), provisioning.ListProvisionedUsersProcedure, &provisioning.ListProvisionedUsersRequest{Target: args[0]}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	return cmd
+}
+
+func GetSCIMTargetSyncCommand(root *cli.Root) *cobra.Command {
+	var full bool
+
+	cmd := &cobra.Command{
+		Use:   "sync [target...]",
+		Short: "Trigger a sync of the given targets or all targets if none is specified",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			if len(args) == 0 {
+				args = []string{""}
+			}
+
+			for _, name := range args {
+				if err := client.Call(root.Context(), provisioning.TriggerSyncProcedure, &provisioning.TriggerSyncRequest{Target: name, Full: full}, nil); err != nil {
+					logrus.Fatalf("%s: %s", name, err)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&full, "full", false, "Perform a full sync instead of an incremental one")
+
+	return cmd
+}
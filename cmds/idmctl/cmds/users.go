@@ -14,6 +14,8 @@ import (
 	"github.com/spf13/cobra"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/users"
 	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/crypto/ssh/terminal"
 	"google.golang.org/protobuf/types/known/durationpb"
@@ -94,6 +96,9 @@ func GetUsersCommand(root *cli.Root) *cobra.Command {
 		GetImpersonateCommand(root),
 		GetSetUserPasswordCommand(root),
 		GetResolveUserPermissions(root),
+		GetCheckPermissionCommand(root),
+		GetSearchUsersCommand(root),
+		GetFindUsersCommand(root),
 	)
 
 	return cmd
@@ -123,6 +128,96 @@ func GetResolveUserPermissions(root *cli.Root) *cobra.Command {
 	return cmd
 }
 
+func GetCheckPermissionCommand(root *cli.Root) *cobra.Command {
+	var (
+		user    string
+		token   string
+		explain bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check-permission [permission...]",
+		Short: "Check whether a user or API token has one or more permissions",
+		Long: `Check whether a user or API token has one or more permissions.
+
+Without --user or --token the permissions of the current user are checked. Use
+--explain to print which roles allowed or denied each permission and how the
+subject obtained those roles.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := users.BatchCheckPermissionsRequest{
+				TokenID:     token,
+				Permissions: args,
+			}
+
+			if user != "" {
+				req.UserID = root.MustResolveUserToId(user)
+			}
+
+			var res users.BatchCheckPermissionsResponse
+
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+			if err := client.Call(root.Context(), users.BatchCheckPermissionsProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			if !explain {
+				root.Print(res.Results)
+				return
+			}
+
+			for _, r := range res.Results {
+				decision := "DENIED"
+				if r.Allowed {
+					decision = "ALLOWED"
+				}
+
+				fmt.Printf("%s: %s (%s)\n", r.Permission, decision, r.Reason)
+
+				for _, m := range r.Matches {
+					fmt.Printf("  %s %q of role %q\n", m.Effect, m.Permission, m.RoleName)
+
+					for _, src := range m.Sources {
+						fmt.Printf("    %s\n", describeRoleSource(src))
+					}
+				}
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&user, "user", "", "Check the permissions of this user")
+		flags.StringVar(&token, "token", "", "Check the permissions of the API token with this ID")
+		flags.BoolVar(&explain, "explain", false, "Print a human readable explanation")
+	}
+
+	return cmd
+}
+
+func describeRoleSource(src users.RoleSource) string {
+	var s string
+
+	switch src.Kind {
+	case users.RoleSourceGroup:
+		s = fmt.Sprintf("assigned to group %q", src.GroupName)
+	case users.RoleSourceToken:
+		s = "assigned to the api token"
+	default:
+		s = "assigned to the user"
+	}
+
+	if src.ViaRoleID != "" {
+		s = fmt.Sprintf("included by role %q, %s", src.ViaRoleName, s)
+	}
+
+	if src.ValidUntil != nil {
+		s += fmt.Sprintf(" until %s", src.ValidUntil.Local().Format(time.RFC3339))
+	}
+
+	return s
+}
+
 func GetSetUserPasswordCommand(root *cli.Root) *cobra.Command {
 	return &cobra.Command{
 		Use:  "set-password [user]",
@@ -573,3 +668,101 @@ func GetSendAccountCreationNoticeCommand(root *cli.Root) *cobra.Command {
 
 	return cmd
 }
+
+func GetSearchUsersCommand(root *cli.Root) *cobra.Command {
+	var (
+		req   users.ListUsersRequest
+		extra []string
+		all   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search",
+		Short: "Search users using server-side filters, sorting and pagination",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			for _, kv := range extra {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok {
+					logrus.Fatalf("invalid extra filter %q, expected key=value", kv)
+				}
+
+				if req.Extra == nil {
+					req.Extra = make(map[string]string)
+				}
+				req.Extra[key] = value
+			}
+
+			var result users.ListUsersResponse
+			for {
+				var res users.ListUsersResponse
+				if err := client.Call(root.Context(), users.ListUsersProcedure, &req, &res); err != nil {
+					logrus.Fatal(err)
+				}
+
+				result.Users = append(result.Users, res.Users...)
+				result.NextPageToken = res.NextPageToken
+
+				if !all || res.NextPageToken == "" {
+					break
+				}
+
+				req.PageToken = res.NextPageToken
+			}
+
+			root.Print(result)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.Username, "username", "", "Only include users whose username contains the value")
+		flags.StringVar(&req.DisplayName, "display-name", "", "Only include users whose display name contains the value")
+		flags.StringVar(&req.Email, "email", "", "Only include users with an e-mail address containing the value")
+		flags.StringSliceVar(&req.Roles, "role", nil, "Only include users with one of the roles (ID or name)")
+		flags.StringVar(&req.Deleted, "deleted", "", "Whether to include deleted users (include, exclude or only)")
+		flags.StringSliceVar(&extra, "extra", nil, "Filter by extra data fields using path=value")
+		flags.StringVar(&req.SortBy, "sort", "", "Sort by username, display_name, first_name or last_name")
+		flags.BoolVar(&req.Descending, "desc", false, "Sort in descending order")
+		flags.StringSliceVar(&req.FieldMask, "fields", nil, "A list of profile fields to include")
+		flags.BoolVar(&req.ExcludeFields, "exclude-fields", false, "Use --fields as an exclude list rather than an include list")
+		flags.IntVar(&req.PageSize, "page-size", 0, "The maximum number of users per page")
+		flags.StringVar(&req.PageToken, "page-token", "", "The page token returned by a previous search")
+		flags.BoolVar(&all, "all", false, "Fetch all pages")
+	}
+
+	return cmd
+}
+
+func GetFindUsersCommand(root *cli.Root) *cobra.Command {
+	var req users.SearchUsersRequest
+
+	cmd := &cobra.Command{
+		Use:   "find [query]",
+		Short: "Find users using the full-text user directory search",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			req.Query = strings.Join(args, " ")
+
+			var res users.SearchUsersResponse
+			if err := client.Call(root.Context(), users.SearchUsersProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.IntVar(&req.PageSize, "limit", 0, "The maximum number of users to return")
+		flags.StringSliceVar(&req.FieldMask, "fields", nil, "A list of profile fields to include")
+		flags.BoolVar(&req.ExcludeFields, "exclude-fields", false, "Use --fields as an exclude list rather than an include list")
+	}
+
+	return cmd
+}
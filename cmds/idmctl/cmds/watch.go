@@ -0,0 +1,91 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+)
+
+func GetWatchCommand(root *cli.Root) *cobra.Command {
+	var (
+		req        changes.WatchChangesRequest
+		types      []string
+		cursorFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Stream changes to users, roles and profiles",
+		Long: "Stream changes to users, roles and profiles as JSON lines.\n\n" +
+			"Use --cursor-file to persist the position in the change feed so watching\n" +
+			"can be resumed without missing events.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, t := range types {
+				req.Types = append(req.Types, changes.Type(t))
+			}
+
+			if cursorFile != "" && req.Cursor == "" {
+				blob, err := os.ReadFile(cursorFile)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					logrus.Fatal(err)
+				}
+
+				req.Cursor = strings.TrimSpace(string(blob))
+			}
+
+			client := httpapi.NewServerStreamClient[changes.WatchChangesRequest, changes.Event](
+				root.HttpClient,
+				root.Config().BaseURLS.Idm,
+				changes.WatchChangesProcedure,
+			)
+
+			stream, err := client.CallServerStream(root.Context(), connect.NewRequest(&req))
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			defer stream.Close()
+
+			enc := json.NewEncoder(os.Stdout)
+
+			for stream.Receive() {
+				event := stream.Msg()
+
+				if event.Type != changes.Heartbeat {
+					if err := enc.Encode(event); err != nil {
+						logrus.Fatal(err)
+					}
+				}
+
+				if cursorFile != "" {
+					if err := os.WriteFile(cursorFile, []byte(event.Cursor), 0o600); err != nil {
+						logrus.Fatal(err)
+					}
+				}
+			}
+
+			if err := stream.Err(); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.Cursor, "cursor", "", "Resume after the given cursor. Use 0 to replay all retained events")
+		flags.StringVar(&cursorFile, "cursor-file", "", "Read the initial cursor from and persist the latest cursor to this file")
+		flags.StringSliceVar(&types, "type", nil, "Only stream events of the given types")
+		flags.StringVar(&req.UserID, "user", "", "Only stream events for the given user ID")
+		flags.StringVar(&req.RoleID, "role", "", "Only stream events for the given role ID")
+	}
+
+	return cmd
+}
@@ -0,0 +1,93 @@
+package cmds
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+func GetWebhooksCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "webhooks",
+		Aliases: []string{"webhook"},
+		Short:   "Inspect and retry webhook deliveries",
+	}
+
+	cmd.AddCommand(
+		GetListWebhookDeliveriesCommand(root),
+		GetWebhookDeliveryCommand(root),
+		GetRetryWebhookDeliveryCommand(root),
+	)
+
+	return cmd
+}
+
+func GetListWebhookDeliveriesCommand(root *cli.Root) *cobra.Command {
+	var req webhook.ListDeliveriesRequest
+
+	cmd := &cobra.Command{
+		Use:     "deliveries",
+		Aliases: []string{"list"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res webhook.ListDeliveriesResponse
+			if err := client.Call(root.Context(), webhook.ListDeliveriesProcedure, &req, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res)
+		},
+	}
+
+	flags := cmd.Flags()
+	{
+		flags.StringVar(&req.Webhook, "webhook", "", "Only show deliveries for this webhook")
+		flags.StringVar(&req.Status, "status", "", "Only show deliveries with this status (pending, delivering, delivered or failed)")
+		flags.StringVar(&req.EventType, "event", "", "Only show deliveries for this event type")
+		flags.IntVar(&req.PageSize, "limit", 50, "The maximum number of deliveries to return")
+		flags.StringVar(&req.PageToken, "page-token", "", "Continue listing at the given page token")
+	}
+
+	return cmd
+}
+
+func GetWebhookDeliveryCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "get [delivery-id]",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			var res webhook.GetDeliveryResponse
+			if err := client.Call(root.Context(), webhook.GetDeliveryProcedure, &webhook.GetDeliveryRequest{ID: args[0]}, &res); err != nil {
+				logrus.Fatal(err)
+			}
+
+			root.Print(res.Delivery)
+		},
+	}
+
+	return cmd
+}
+
+func GetRetryWebhookDeliveryCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "retry [delivery-id...]",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := httpapi.NewClient(root.HttpClient, root.Config().BaseURLS.Idm)
+
+			for _, id := range args {
+				if err := client.Call(root.Context(), webhook.RetryDeliveryProcedure, &webhook.RetryDeliveryRequest{ID: id}, nil); err != nil {
+					logrus.Fatalf("%s: %s", id, err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/backup"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// runBackup creates a consistent snapshot of the database. It is safe to
+// run while userd is serving requests.
+func runBackup(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+
+	output := flags.String("o", "", "Path of the backup file or - for stdout. Defaults to a new file in the configured backup directory")
+	compress := flags.Bool("compress", cfg.Backup.Compress, "Compress the backup using gzip")
+	noEncrypt := flags.Bool("no-encrypt", false, "Do not encrypt the backup even if an encryption key is configured")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := backup.Options{
+		Compress: *compress,
+		Key:      cfg.Backup.Key(),
+	}
+
+	if *noEncrypt {
+		opts.Key = nil
+	}
+
+	path := *output
+	if path == "" {
+		if cfg.Backup.Directory == "" {
+			return fmt.Errorf("either -o or backup.directory must be set")
+		}
+
+		if err := os.MkdirAll(cfg.Backup.Directory, 0o700); err != nil {
+			return err
+		}
+
+		path = filepath.Join(cfg.Backup.Directory, backup.FileName(time.Now(), opts))
+	}
+
+	db, err := repo.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if err := backup.Snapshot(ctx, db, w, opts); err != nil {
+		if path != "-" {
+			os.Remove(path)
+		}
+
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	if path != "-" {
+		logrus.Infof("successfully created backup at %s", path)
+	}
+
+	return nil
+}
+
+// runRestore replaces the database with a backup. userd must not be running
+// while a backup is restored.
+func runRestore(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: userd restore [-force] <path-to-backup>\n\n")
+		fmt.Fprintf(flags.Output(), "Replaces all data in the configured database with a backup. Stop userd first.\n\n")
+		flags.PrintDefaults()
+	}
+
+	force := flags.Bool("force", false, "Overwrite the database even if it already contains users")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		return fmt.Errorf("expected exactly one argument")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := repo.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if !*force {
+		// the database might not have been created yet.
+		users, err := repo.New(db).GetAllUsers(ctx)
+		if err == nil && len(users) > 0 {
+			return fmt.Errorf("database contains %d users, use -force to overwrite it", len(users))
+		}
+	}
+
+	if err := backup.Restore(ctx, f, db, cfg.Backup.Key()); err != nil {
+		if errors.Is(err, repo.ErrUnknownMigration) {
+			return fmt.Errorf("backup has been created by a newer version of cisidm: %w", err)
+		}
+
+		return err
+	}
+
+	// bring the restored schema up to date.
+	if _, err := repo.Migrate(ctx, db); err != nil {
+		return fmt.Errorf("failed to migrate restored database: %w", err)
+	}
+
+	logrus.Infof("successfully restored backup from %s", flags.Arg(0))
+
+	return nil
+}
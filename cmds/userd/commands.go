@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+)
+
+// commands holds one-off maintenance commands that can be run instead of
+// starting the server, for example "userd backup".
+var commands = map[string]func(ctx context.Context, cfg config.Config, args []string) error{
+	"migrate-from-sqlite": runMigrateFromSQLite,
+	"backup":              runBackup,
+	"restore":             runRestore,
+	"export":              runExport,
+	"import":              runImport,
+}
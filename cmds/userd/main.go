@@ -2,26 +2,35 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"os"
 
 	"github.com/bufbuild/protovalidate-go"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery/consuldiscover"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery/wellknown"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/authcache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/backup"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/bootstrap"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/cache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/mailer"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/maintenance"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/provisioning"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/relations"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/search"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/sms"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/tmpl"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 )
 
 func main() {
@@ -52,6 +61,20 @@ func main() {
 		logrus.SetLevel(lvl)
 	}
 
+	// run one-off maintenance commands instead of starting the server.
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if !ok {
+			logrus.Fatalf("unknown command %q", os.Args[1])
+		}
+
+		if err := cmd(ctx, *cfg, os.Args[2:]); err != nil {
+			logrus.Fatal(err.Error())
+		}
+
+		return
+	}
+
 	// prepare all application providers.
 	providers, err := setupAppProviders(ctx, *cfg)
 	if err != nil {
@@ -80,6 +103,30 @@ func main() {
 		logrus.Errorf("failed to register service at catalog: %s", err)
 	}
 
+	// start delivering webhook events in the background
+	go providers.Webhooks.Run(ctx)
+
+	// prune expired events from the change feed
+	go providers.Changes.Run(ctx)
+
+	// provision users to SCIM targets
+	go providers.Provisioning.Run(ctx)
+
+	// create scheduled backups
+	go providers.Backups.Run(ctx)
+
+	// remove expired tokens and purge deleted users
+	go providers.Maintenance.Run(ctx)
+
+	// keep the user search index up to date
+	go providers.Search.Run(ctx)
+
+	// invalidate cached forward-auth subjects on changes
+	go providers.AuthCache.Run(ctx)
+
+	// reload policies when policy files or bundles change
+	go providers.PolicyEngine.Run(ctx)
+
 	// finally, start of the HTTP/2 servers...
 	if err := startServer(providers); err != nil {
 		logrus.Fatalf("failed to start server: %s", err)
@@ -87,7 +134,7 @@ func main() {
 }
 
 func setupAppProviders(ctx context.Context, cfg config.Config) (*app.Providers, error) {
-	db, err := sql.Open("sqlite3_extended", cfg.DatabaseURL)
+	db, err := repo.Open(cfg.DatabaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database at %q: %q", cfg.DatabaseURL, err)
 	}
@@ -156,11 +203,20 @@ func setupAppProviders(ctx context.Context, cfg config.Config) (*app.Providers,
 		mailSender = new(mailer.NoOpMailer)
 	}
 
-	cache := cache.NewInMemoryCache()
+	cache, err := setupCache(ctx, cfg, datastore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup cache: %w", err)
+	}
+
 	commonService := common.New(datastore, cfg, cache)
 
+	// prepare the relationship store which is also exposed to policies
+	relationChecker := relations.NewChecker(datastore, relations.NewSchema(cfg.Relations))
+
 	// prepare engine options
-	options := []policy.EngineOption{}
+	options := []policy.EngineOption{
+		policy.WithRelations(relationChecker),
+	}
 	for _, p := range cfg.PolicyConfig.Policies {
 		options = append(options, policy.WithRawPolicy(p.Name, p.Content))
 	}
@@ -169,12 +225,63 @@ func setupAppProviders(ctx context.Context, cfg config.Config) (*app.Providers,
 		options = append(options, policy.WithDebug())
 	}
 
+	if cfg.PolicyConfig.Watch {
+		options = append(options, policy.WithWatch(cfg.PolicyConfig.WatchDuration()))
+	}
+
+	for _, b := range cfg.PolicyConfig.Bundles {
+		options = append(options, policy.WithBundle(policy.BundleConfig{
+			Name:            b.Name,
+			Path:            b.Path,
+			URL:             b.URL,
+			Headers:         b.Headers,
+			PollingInterval: b.PollingDuration(),
+		}))
+	}
+
 	// prepare rego policy engine
 	engine, err := policy.NewEngine(ctx, cfg.PolicyConfig.Directories, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare policy engine: %w", err)
 	}
 
+	// prepare the webhook dispatcher
+	webhooks := webhook.NewDispatcher(datastore, cfg.Webhooks)
+
+	// prepare the change feed and SCIM provisioning which is driven by it
+	feed := changes.NewFeed(datastore, cfg.ChangeFeedTTL())
+	syncer := provisioning.NewSyncer(datastore, feed, cfg.SCIMTargets)
+
+	// prepare the scheduler for maintenance jobs
+	maintenanceOpts := []maintenance.Option{
+		maintenance.WithChangeFeed(feed),
+		maintenance.WithWebhooks(webhooks),
+	}
+
+	if cfg.MailConfig != nil && cfg.MailConfig.Host != "" {
+		maintenanceOpts = append(maintenanceOpts, maintenance.WithRoleExpiryNotifier(&maintenance.MailNotifier{
+			Config:       cfg,
+			Templates:    tmplEngine,
+			Mailer:       mailSender,
+			Datastore:    datastore,
+			NotifyAdmins: cfg.Maintenance.RoleExpiryNotifyAdmins,
+		}))
+	}
+
+	scheduler, err := maintenance.NewScheduler(datastore, cfg.Maintenance, maintenanceOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare the full-text index for the user directory search
+	indexer, err := search.New(ctx, db, datastore, feed, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare user search index: %w", err)
+	}
+
+	// prepare the cache for forward-auth subjects and rejected tokens
+	authCache := authcache.New(datastore, feed, cfg.PermissionTree(), cfg.ForwardAuth.CacheTTL())
+
 	providers := &app.Providers{
 		TemplateEngine: tmplEngine,
 		SMSSender:      smsProvider,
@@ -186,7 +293,44 @@ func setupAppProviders(ctx context.Context, cfg config.Config) (*app.Providers,
 		Validator:      validator,
 		Cache:          cache,
 		PolicyEngine:   engine,
+		Webhooks:       webhooks,
+		Changes:        feed,
+		Provisioning:   syncer,
+		Backups:        backup.NewScheduler(db, cfg.Backup),
+		Maintenance:    scheduler,
+		Search:         indexer,
+		AuthCache:      authCache,
+		Relations:      relationChecker,
+		Constraints:    constraints.NewChecker(cfg.SeparationOfDuties),
 	}
 
 	return providers, nil
 }
+
+func setupCache(ctx context.Context, cfg config.Config, datastore *repo.Queries) (cache.Cache, error) {
+	switch cfg.Cache.Type {
+	case config.CacheTypeRedis:
+		opts, err := redis.ParseURL(cfg.Cache.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+
+		client := redis.NewClient(opts)
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+
+		return cache.NewRedisCache(client, cfg.Cache.KeyPrefix), nil
+
+	case config.CacheTypeSQL:
+		c := cache.NewSQLCache(datastore, cfg.Cache.SweepDuration())
+
+		// remove expired entries in the background
+		go c.Run(ctx)
+
+		return c, nil
+
+	default:
+		return cache.NewInMemoryCache(), nil
+	}
+}
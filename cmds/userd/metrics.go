@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// metricsHandler serves all metrics registered at the default prometheus
+// registry using the text exposition format.
+func metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			log.L(r.Context()).Error("failed to gather metrics", "error", err)
+		}
+
+		format := expfmt.NewFormat(expfmt.TypeTextPlain)
+		w.Header().Set("Content-Type", string(format))
+
+		enc := expfmt.NewEncoder(w, format)
+		for _, mf := range families {
+			if err := enc.Encode(mf); err != nil {
+				log.L(r.Context()).Error("failed to encode metrics", "error", err)
+
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// runMigrateFromSQLite copies all data from an existing SQLite database file
+// to the database configured in database_url. It is used when switching an
+// existing installation to PostgreSQL.
+func runMigrateFromSQLite(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate-from-sqlite", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: userd migrate-from-sqlite <path-to-sqlite-file>\n\n")
+		fmt.Fprintf(flags.Output(), "Copies all data from a SQLite database to the database configured in database_url.\n")
+		fmt.Fprintf(flags.Output(), "The destination database must not contain any users or roles.\n")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		return fmt.Errorf("expected exactly one argument")
+	}
+
+	if repo.DialectFromURL(cfg.DatabaseURL) == repo.DialectSQLite {
+		return fmt.Errorf("database_url must point to a PostgreSQL database")
+	}
+
+	src, err := repo.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database at %q: %w", flags.Arg(0), err)
+	}
+	defer src.Close()
+
+	dst, err := repo.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer dst.Close()
+
+	if err := repo.CopyData(ctx, src, dst); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+
+	logrus.Infof("successfully migrated data from SQLite")
+
+	return nil
+}
@@ -21,15 +21,27 @@ import (
 	"github.com/tierklinik-dobersberg/apis/pkg/spa"
 	"github.com/tierklinik-dobersberg/apis/pkg/validator"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/gdpr"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/maintenance"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/manifest"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/provisioning"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/relations"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/scim"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/services/auth"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/groups"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/services/notify"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/services/roles"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/services/selfservice"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/services/users"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/webauthn"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
@@ -112,7 +124,12 @@ func getExtraFilesHandler(path string) (http.Handler, error) {
 func setupPublicServer(providers *app.Providers) (*http.Server, error) {
 	// prepare middlewares and interceptors
 	loggingInterceptor := log.NewLoggingInterceptor()
-	authInterceptor := middleware.NewAuthInterceptor(providers.ProtoRegistry)
+	var authorizer middleware.Authorizer
+	if query := providers.Config.PolicyConfig.APIQuery; query != "" {
+		authorizer = policy.NewAPIAuthorizer(providers.PolicyEngine, query, providers.AuthCache)
+	}
+
+	authInterceptor := middleware.NewAuthInterceptor(providers.ProtoRegistry, authorizer)
 	validatorInterceptor := validator.NewInterceptor(providers.Validator)
 
 	privacyInterceptor := privacy.NewFilterInterceptor(privacy.SubjectResolverFunc(func(ctx context.Context, ar connect.AnyRequest) (string, []string, error) {
@@ -126,8 +143,11 @@ func setupPublicServer(providers *app.Providers) (*http.Server, error) {
 
 	errorInterceptor := middleware.NewErrorInterceptor()
 
+	auditInterceptor := audit.NewInterceptor(audit.NewRecorder(providers.Datastore))
+
 	interceptors := connect.WithInterceptors(
 		loggingInterceptor,
+		auditInterceptor,
 		authInterceptor,
 		validatorInterceptor,
 		privacyInterceptor,
@@ -164,6 +184,10 @@ func setupPublicServer(providers *app.Providers) (*http.Server, error) {
 		interceptors,
 	)
 	serveMux.Handle(path, handler)
+	serveMux.Handle(users.ListUsersProcedure, httpapi.Unary(userService.ListUsersPage, httpapi.RequireAuth()))
+	serveMux.Handle(users.SearchUsersProcedure, httpapi.Unary(userService.SearchUsers, httpapi.RequireAuth()))
+	serveMux.Handle(users.CheckPermissionProcedure, httpapi.Unary(userService.CheckPermission, httpapi.RequireAuth()))
+	serveMux.Handle(users.BatchCheckPermissionsProcedure, httpapi.Unary(userService.BatchCheckPermissions, httpapi.RequireAuth()))
 
 	roleService := roles.NewService(providers)
 	path, handler = idmv1connect.NewRoleServiceHandler(
@@ -171,15 +195,101 @@ func setupPublicServer(providers *app.Providers) (*http.Server, error) {
 		interceptors,
 	)
 	serveMux.Handle(path, handler)
+	serveMux.Handle(roles.ListRoleInclusionsProcedure, httpapi.Unary(roleService.ListRoleInclusions, httpapi.RequireAuth()))
+	serveMux.Handle(roles.AddRoleInclusionProcedure, httpapi.Unary(roleService.AddRoleInclusion, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.RemoveRoleInclusionProcedure, httpapi.Unary(roleService.RemoveRoleInclusion, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.AssignRoleToUserWithValidityProcedure, httpapi.Unary(roleService.AssignRoleToUserWithValidity, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListRoleAssignmentsProcedure, httpapi.Unary(roleService.ListRoleAssignments, httpapi.RequireAuth()))
+	serveMux.Handle(roles.RequestRoleProcedure, httpapi.Unary(roleService.RequestRole, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListRoleRequestsProcedure, httpapi.Unary(roleService.ListRoleRequests, httpapi.RequireAuth()))
+	serveMux.Handle(roles.ApproveRoleRequestProcedure, httpapi.Unary(roleService.ApproveRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.DenyRoleRequestProcedure, httpapi.Unary(roleService.DenyRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.CancelRoleRequestProcedure, httpapi.Unary(roleService.CancelRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListConstraintViolationsProcedure, httpapi.Unary(roleService.ListConstraintViolations, httpapi.RequireRoles("idm_superuser")))
+
+	// Group service
+	groupService := groups.NewService(providers)
+	groupAudit := httpapi.Audit(audit.NewRecorder(providers.Datastore))
+	serveMux.Handle(groups.ListGroupsProcedure, httpapi.Unary(groupService.ListGroups, httpapi.RequireAuth()))
+	serveMux.Handle(groups.GetGroupProcedure, httpapi.Unary(groupService.GetGroup, httpapi.RequireAuth()))
+	serveMux.Handle(groups.ListUserGroupsProcedure, httpapi.Unary(groupService.ListUserGroups, httpapi.RequireAuth()))
+	serveMux.Handle(groups.CreateGroupProcedure, httpapi.Unary(groupService.CreateGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.UpdateGroupProcedure, httpapi.Unary(groupService.UpdateGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.DeleteGroupProcedure, httpapi.Unary(groupService.DeleteGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.AddGroupMembersProcedure, httpapi.Unary(groupService.AddGroupMembers, httpapi.RequireAuth(), groupAudit))
+	serveMux.Handle(groups.RemoveGroupMembersProcedure, httpapi.Unary(groupService.RemoveGroupMembers, httpapi.RequireAuth(), groupAudit))
+	serveMux.Handle(groups.AssignRoleToGroupProcedure, httpapi.Unary(groupService.AssignRoleToGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.UnassignRoleFromGroupProcedure, httpapi.Unary(groupService.UnassignRoleFromGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.AddSubgroupProcedure, httpapi.Unary(groupService.AddSubgroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.RemoveSubgroupProcedure, httpapi.Unary(groupService.RemoveSubgroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
 
 	// Notify service
 	notifyService := notify.New(providers)
+	roleService.Notifier = notifyService
 	path, handler = idmv1connect.NewNotifyServiceHandler(
 		notifyService,
 		interceptors,
 	)
 	serveMux.Handle(path, handler)
 
+	// Audit log
+	auditService := audit.NewService(providers.Datastore)
+	serveMux.Handle(audit.ListEventsProcedure, httpapi.Unary(auditService.ListEvents, httpapi.RequireRoles("idm_superuser")))
+
+	// Webhook delivery status
+	webhookService := webhook.NewService(providers.Webhooks)
+	serveMux.Handle(webhook.ListDeliveriesProcedure, httpapi.Unary(webhookService.ListDeliveries, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(webhook.GetDeliveryProcedure, httpapi.Unary(webhookService.GetDelivery, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(webhook.RetryDeliveryProcedure, httpapi.Unary(webhookService.RetryDelivery, httpapi.RequireRoles("idm_superuser")))
+
+	// Declarative configuration using idmctl apply
+	manifestService := manifest.NewService(providers)
+	serveMux.Handle(manifest.ApplyProcedure, httpapi.Unary(manifestService.Apply, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+
+	// Relationship-based authorization
+	relationService := relations.NewService(providers.Datastore, providers.Relations)
+	serveMux.Handle(relations.WriteTuplesProcedure, httpapi.Unary(relationService.WriteTuples, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(relations.DeleteTuplesProcedure, httpapi.Unary(relationService.DeleteTuples, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(relations.ReadTuplesProcedure, httpapi.Unary(relationService.ReadTuples, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(relations.ListSubjectsProcedure, httpapi.Unary(relationService.ListSubjects, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(relations.CheckProcedure, httpapi.Unary(relationService.Check, httpapi.RequireAuth()))
+	serveMux.Handle(relations.ListObjectsProcedure, httpapi.Unary(relationService.ListObjects, httpapi.RequireAuth()))
+
+	// Policy engine
+	policyService := policy.NewService(providers.PolicyEngine)
+	serveMux.Handle(policy.GetRevisionProcedure, httpapi.Unary(policyService.GetRevision, httpapi.RequireRoles("idm_superuser")))
+
+	// Change feed
+	changeService := changes.NewService(providers.Changes)
+	serveMux.Handle(changes.WatchChangesProcedure, httpapi.ServerStream(changes.WatchChangesProcedure, changeService.WatchChanges, httpapi.RequireAuth()))
+
+	// SCIM provisioning
+	if providers.Config.SCIM != nil {
+		serveMux.Handle(scim.Prefix+"/", http.StripPrefix(scim.Prefix, scim.NewHandler(providers)))
+	}
+
+	// SCIM target sync status
+	provisioningService := provisioning.NewService(providers.Provisioning)
+	serveMux.Handle(provisioning.ListTargetsProcedure, httpapi.Unary(provisioningService.ListTargets, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(provisioning.ListProvisionedUsersProcedure, httpapi.Unary(provisioningService.ListProvisionedUsers, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(provisioning.TriggerSyncProcedure, httpapi.Unary(provisioningService.TriggerSync, httpapi.RequireRoles("idm_superuser")))
+
+	// GDPR data export and account erasure
+	gdprService := gdpr.NewService(providers)
+	gdprAudit := httpapi.Audit(audit.NewRecorder(providers.Datastore))
+	serveMux.Handle(gdpr.ExportMyDataProcedure, httpapi.Unary(gdprService.ExportMyData, httpapi.RequireAuth()))
+	serveMux.Handle(gdpr.RequestErasureProcedure, httpapi.Unary(gdprService.RequestErasure, httpapi.RequireAuth(), gdprAudit))
+	serveMux.Handle(gdpr.GetMyErasureRequestProcedure, httpapi.Unary(gdprService.GetMyErasureRequest, httpapi.RequireAuth()))
+	serveMux.Handle(gdpr.CancelErasureProcedure, httpapi.Unary(gdprService.CancelErasure, httpapi.RequireAuth(), gdprAudit))
+	serveMux.Handle(gdpr.ListErasureRequestsProcedure, httpapi.Unary(gdprService.ListErasureRequests, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(gdpr.ApproveErasureProcedure, httpapi.Unary(gdprService.ApproveErasure, httpapi.RequireRoles("idm_superuser"), gdprAudit))
+	serveMux.Handle(gdpr.RejectErasureProcedure, httpapi.Unary(gdprService.RejectErasure, httpapi.RequireRoles("idm_superuser"), gdprAudit))
+
+	// Maintenance jobs
+	maintenanceService := maintenance.NewService(providers.Maintenance)
+	serveMux.Handle(maintenance.ListJobsProcedure, httpapi.Unary(maintenanceService.ListJobs, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(maintenance.RunJobProcedure, httpapi.Unary(maintenanceService.RunJob, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+
 	// Serve basic configuration for the UI on /config.json
 	serveMux.Handle("/config.json", config.NewConfigHandler(providers.Config))
 
@@ -246,7 +356,7 @@ func setupPublicServer(providers *app.Providers) (*http.Server, error) {
 
 	mux.Handle("/", cors.Wrap(
 		corsOpts,
-		serveMux,
+		middleware.NewAuthorizerMiddleware(authorizer, serveMux),
 	))
 
 	// finally, return a http.Server that uses h2c for HTTP/2 support and
@@ -284,8 +394,11 @@ func setupAdminServer(providers *app.Providers) (*http.Server, error) {
 
 	errorInterceptor := middleware.NewErrorInterceptor()
 
+	auditInterceptor := audit.NewInterceptor(audit.NewRecorder(providers.Datastore))
+
 	interceptors := connect.WithInterceptors(
 		loggingInterceptor,
+		auditInterceptor,
 		validatorInterceptor,
 		privacyInterceptor,
 		errorInterceptor,
@@ -303,6 +416,10 @@ func setupAdminServer(providers *app.Providers) (*http.Server, error) {
 		interceptors,
 	)
 	serveMux.Handle(path, handler)
+	serveMux.Handle(users.ListUsersProcedure, httpapi.Unary(userService.ListUsersPage, httpapi.RequireAuth()))
+	serveMux.Handle(users.SearchUsersProcedure, httpapi.Unary(userService.SearchUsers, httpapi.RequireAuth()))
+	serveMux.Handle(users.CheckPermissionProcedure, httpapi.Unary(userService.CheckPermission, httpapi.RequireAuth()))
+	serveMux.Handle(users.BatchCheckPermissionsProcedure, httpapi.Unary(userService.BatchCheckPermissions, httpapi.RequireAuth()))
 
 	// Role service
 	roleService := roles.NewService(providers)
@@ -311,9 +428,37 @@ func setupAdminServer(providers *app.Providers) (*http.Server, error) {
 		interceptors,
 	)
 	serveMux.Handle(path, handler)
+	serveMux.Handle(roles.ListRoleInclusionsProcedure, httpapi.Unary(roleService.ListRoleInclusions, httpapi.RequireAuth()))
+	serveMux.Handle(roles.AddRoleInclusionProcedure, httpapi.Unary(roleService.AddRoleInclusion, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.RemoveRoleInclusionProcedure, httpapi.Unary(roleService.RemoveRoleInclusion, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.AssignRoleToUserWithValidityProcedure, httpapi.Unary(roleService.AssignRoleToUserWithValidity, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListRoleAssignmentsProcedure, httpapi.Unary(roleService.ListRoleAssignments, httpapi.RequireAuth()))
+	serveMux.Handle(roles.RequestRoleProcedure, httpapi.Unary(roleService.RequestRole, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListRoleRequestsProcedure, httpapi.Unary(roleService.ListRoleRequests, httpapi.RequireAuth()))
+	serveMux.Handle(roles.ApproveRoleRequestProcedure, httpapi.Unary(roleService.ApproveRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.DenyRoleRequestProcedure, httpapi.Unary(roleService.DenyRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.CancelRoleRequestProcedure, httpapi.Unary(roleService.CancelRoleRequest, httpapi.RequireAuth(), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(roles.ListConstraintViolationsProcedure, httpapi.Unary(roleService.ListConstraintViolations, httpapi.RequireRoles("idm_superuser")))
+
+	// Group service
+	groupService := groups.NewService(providers)
+	groupAudit := httpapi.Audit(audit.NewRecorder(providers.Datastore))
+	serveMux.Handle(groups.ListGroupsProcedure, httpapi.Unary(groupService.ListGroups, httpapi.RequireAuth()))
+	serveMux.Handle(groups.GetGroupProcedure, httpapi.Unary(groupService.GetGroup, httpapi.RequireAuth()))
+	serveMux.Handle(groups.ListUserGroupsProcedure, httpapi.Unary(groupService.ListUserGroups, httpapi.RequireAuth()))
+	serveMux.Handle(groups.CreateGroupProcedure, httpapi.Unary(groupService.CreateGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.UpdateGroupProcedure, httpapi.Unary(groupService.UpdateGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.DeleteGroupProcedure, httpapi.Unary(groupService.DeleteGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.AddGroupMembersProcedure, httpapi.Unary(groupService.AddGroupMembers, httpapi.RequireAuth(), groupAudit))
+	serveMux.Handle(groups.RemoveGroupMembersProcedure, httpapi.Unary(groupService.RemoveGroupMembers, httpapi.RequireAuth(), groupAudit))
+	serveMux.Handle(groups.AssignRoleToGroupProcedure, httpapi.Unary(groupService.AssignRoleToGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.UnassignRoleFromGroupProcedure, httpapi.Unary(groupService.UnassignRoleFromGroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.AddSubgroupProcedure, httpapi.Unary(groupService.AddSubgroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
+	serveMux.Handle(groups.RemoveSubgroupProcedure, httpapi.Unary(groupService.RemoveSubgroup, httpapi.RequireRoles("idm_superuser"), groupAudit))
 
 	// Notify service
 	notifyService := notify.New(providers)
+	roleService.Notifier = notifyService
 	path, handler = idmv1connect.NewNotifyServiceHandler(
 		notifyService,
 		interceptors,
@@ -328,8 +473,69 @@ func setupAdminServer(providers *app.Providers) (*http.Server, error) {
 	)
 	serveMux.Handle(path, handler)
 
+	// Audit log
+	auditService := audit.NewService(providers.Datastore)
+	serveMux.Handle(audit.ListEventsProcedure, httpapi.Unary(auditService.ListEvents, httpapi.RequireRoles("idm_superuser")))
+
+	// Webhook delivery status
+	webhookService := webhook.NewService(providers.Webhooks)
+	serveMux.Handle(webhook.ListDeliveriesProcedure, httpapi.Unary(webhookService.ListDeliveries, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(webhook.GetDeliveryProcedure, httpapi.Unary(webhookService.GetDelivery, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(webhook.RetryDeliveryProcedure, httpapi.Unary(webhookService.RetryDelivery, httpapi.RequireRoles("idm_superuser")))
+
+	// Declarative configuration using idmctl apply
+	manifestService := manifest.NewService(providers)
+	serveMux.Handle(manifest.ApplyProcedure, httpapi.Unary(manifestService.Apply, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+
+	// Relationship-based authorization
+	relationService := relations.NewService(providers.Datastore, providers.Relations)
+	serveMux.Handle(relations.WriteTuplesProcedure, httpapi.Unary(relationService.WriteTuples, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(relations.DeleteTuplesProcedure, httpapi.Unary(relationService.DeleteTuples, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+	serveMux.Handle(relations.ReadTuplesProcedure, httpapi.Unary(relationService.ReadTuples, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(relations.ListSubjectsProcedure, httpapi.Unary(relationService.ListSubjects, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(relations.CheckProcedure, httpapi.Unary(relationService.Check, httpapi.RequireAuth()))
+	serveMux.Handle(relations.ListObjectsProcedure, httpapi.Unary(relationService.ListObjects, httpapi.RequireAuth()))
+
+	// Policy engine
+	policyService := policy.NewService(providers.PolicyEngine)
+	serveMux.Handle(policy.GetRevisionProcedure, httpapi.Unary(policyService.GetRevision, httpapi.RequireRoles("idm_superuser")))
+
+	// Change feed
+	changeService := changes.NewService(providers.Changes)
+	serveMux.Handle(changes.WatchChangesProcedure, httpapi.ServerStream(changes.WatchChangesProcedure, changeService.WatchChanges, httpapi.RequireAuth()))
+
+	// SCIM provisioning
+	if providers.Config.SCIM != nil {
+		serveMux.Handle(scim.Prefix+"/", http.StripPrefix(scim.Prefix, scim.NewHandler(providers)))
+	}
+
+	// SCIM target sync status
+	provisioningService := provisioning.NewService(providers.Provisioning)
+	serveMux.Handle(provisioning.ListTargetsProcedure, httpapi.Unary(provisioningService.ListTargets, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(provisioning.ListProvisionedUsersProcedure, httpapi.Unary(provisioningService.ListProvisionedUsers, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(provisioning.TriggerSyncProcedure, httpapi.Unary(provisioningService.TriggerSync, httpapi.RequireRoles("idm_superuser")))
+
+	// GDPR data export and account erasure
+	gdprService := gdpr.NewService(providers)
+	gdprAudit := httpapi.Audit(audit.NewRecorder(providers.Datastore))
+	serveMux.Handle(gdpr.ExportMyDataProcedure, httpapi.Unary(gdprService.ExportMyData, httpapi.RequireAuth()))
+	serveMux.Handle(gdpr.RequestErasureProcedure, httpapi.Unary(gdprService.RequestErasure, httpapi.RequireAuth(), gdprAudit))
+	serveMux.Handle(gdpr.GetMyErasureRequestProcedure, httpapi.Unary(gdprService.GetMyErasureRequest, httpapi.RequireAuth()))
+	serveMux.Handle(gdpr.CancelErasureProcedure, httpapi.Unary(gdprService.CancelErasure, httpapi.RequireAuth(), gdprAudit))
+	serveMux.Handle(gdpr.ListErasureRequestsProcedure, httpapi.Unary(gdprService.ListErasureRequests, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(gdpr.ApproveErasureProcedure, httpapi.Unary(gdprService.ApproveErasure, httpapi.RequireRoles("idm_superuser"), gdprAudit))
+	serveMux.Handle(gdpr.RejectErasureProcedure, httpapi.Unary(gdprService.RejectErasure, httpapi.RequireRoles("idm_superuser"), gdprAudit))
+
+	// Maintenance jobs
+	maintenanceService := maintenance.NewService(providers.Maintenance)
+	serveMux.Handle(maintenance.ListJobsProcedure, httpapi.Unary(maintenanceService.ListJobs, httpapi.RequireRoles("idm_superuser")))
+	serveMux.Handle(maintenance.RunJobProcedure, httpapi.Unary(maintenanceService.RunJob, httpapi.RequireRoles("idm_superuser"), httpapi.Audit(audit.NewRecorder(providers.Datastore))))
+
 	serveMux.Handle("/validate", auth.NewForwardAuthHandler(providers))
 
+	// Prometheus metrics are only exposed on the admin listener
+	serveMux.Handle("/metrics", metricsHandler())
+
 	return server.CreateWithOptions(
 		providers.Config.Server.AdminListenAddr,
 		middleware.NewJWTMiddleware(
@@ -355,6 +561,7 @@ func setupAdminServer(providers *app.Providers) (*http.Server, error) {
 							Authorization: &jwt.Authorization{
 								Roles: []string{"idm_superuser"},
 							},
+							LoginKind: jwt.LoginKindAdmin,
 						},
 					}
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/transfer"
+)
+
+// runExport writes all users and roles to a portable NDJSON file that can
+// be imported into another instance using "userd import".
+func runExport(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+
+	output := flags.String("o", "-", "Path of the export file or - for stdout")
+	exclude := flags.String("exclude", "", "Comma separated list of secrets to exclude: "+strings.Join(transfer.SecretCategories, ", ")+" or secrets for all of them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var opts transfer.ExportOptions
+	for _, category := range strings.Split(*exclude, ",") {
+		switch strings.TrimSpace(category) {
+		case "":
+		case "secrets":
+			opts = transfer.ExportOptions{
+				ExcludePasswords: true,
+				ExcludeTOTP:      true,
+				ExcludeWebAuthn:  true,
+				ExcludeAPITokens: true,
+			}
+		case transfer.ExcludePasswords:
+			opts.ExcludePasswords = true
+		case transfer.ExcludeTOTP:
+			opts.ExcludeTOTP = true
+		case transfer.ExcludeWebAuthn:
+			opts.ExcludeWebAuthn = true
+		case transfer.ExcludeAPITokens:
+			opts.ExcludeAPITokens = true
+		default:
+			return fmt.Errorf("unsupported value for -exclude: %q", category)
+		}
+	}
+
+	db, err := repo.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if err := transfer.Export(ctx, repo.New(db), w, opts); err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+
+		return fmt.Errorf("failed to export: %w", err)
+	}
+
+	if *output != "-" {
+		logrus.Infof("successfully exported users and roles to %s", *output)
+	}
+
+	return nil
+}
+
+// runImport imports an export created by "userd export". It can be run
+// while userd is serving requests.
+func runImport(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: userd import [-strategy skip|overwrite|merge] [-dry-run] <path-to-export|->\n\n")
+		fmt.Fprintf(flags.Output(), "Imports users and roles from an export created by \"userd export\".\n\n")
+		flags.PrintDefaults()
+	}
+
+	strategy := flags.String("strategy", string(transfer.StrategySkip), "How to handle users and roles that already exist: skip, overwrite or merge")
+	dryRun := flags.Bool("dry-run", false, "Only report what would be changed")
+	jsonReport := flags.Bool("json", false, "Print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		return fmt.Errorf("expected exactly one argument")
+	}
+
+	st, err := transfer.ParseStrategy(*strategy)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	db, err := repo.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := repo.Migrate(ctx, db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	datastore := repo.New(db)
+
+	report, err := transfer.Import(ctx, datastore, r, transfer.ImportOptions{
+		Strategy: st,
+		DryRun:   *dryRun,
+		// notify running instances so webhooks and provisioning pick up
+		// the imported users.
+		Feed:        changes.NewFeed(datastore, cfg.ChangeFeedTTL()),
+		Constraints: constraints.NewChecker(cfg.SeparationOfDuties),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import: %w", err)
+	}
+
+	if *jsonReport {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(report)
+	}
+
+	printReport(os.Stdout, report)
+
+	return nil
+}
+
+func printReport(w io.Writer, report *transfer.Report) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "KIND\tNAME\tID\tRESULT\tDETAILS")
+	for _, a := range report.Actions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a.Kind, a.Name, a.ID, a.Result, strings.Join(a.Details, ", "))
+	}
+
+	tw.Flush()
+
+	fmt.Fprintln(w)
+
+	for _, kind := range []string{transfer.RecordRole, transfer.RecordUser} {
+		var parts []string
+		for _, result := range []transfer.Result{transfer.ResultCreated, transfer.ResultUpdated, transfer.ResultUnchanged, transfer.ResultSkipped} {
+			parts = append(parts, fmt.Sprintf("%d %s", report.Count(kind, result), result))
+		}
+
+		fmt.Fprintf(w, "%ss: %s\n", kind, strings.Join(parts, ", "))
+	}
+
+	if len(report.Warnings) > 0 {
+		fmt.Fprintln(w)
+
+		for _, warning := range slices.Compact(report.Warnings) {
+			fmt.Fprintf(w, "WARNING: %s\n", warning)
+		}
+	}
+
+	if report.DryRun {
+		fmt.Fprintln(w, "\nDry-run: no changes have been made.")
+	}
+}
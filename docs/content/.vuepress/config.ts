@@ -36,6 +36,26 @@ export default defineUserConfig({
               text: "Policies",
               link: "/guides/policies.md"
             },
+            {
+              text: "Configuration as Code",
+              link: "/guides/config-as-code.md"
+            },
+            {
+              text: "Backup and Restore",
+              link: "/guides/backup-restore.md"
+            },
+            {
+              text: "Export and Import",
+              link: "/guides/export-import.md"
+            },
+            {
+              text: "Data Export and Erasure",
+              link: "/guides/privacy.md"
+            },
+            {
+              text: "Maintenance Jobs",
+              link: "/guides/maintenance.md"
+            },
             {
               text: "CLI Reference",
               link: "/guides/cli-reference.md",
@@ -70,6 +90,14 @@ export default defineUserConfig({
               text: "OpenID Connect (OIDC)",
               link: "/guides/setup-oidc.md"
             },
+            {
+              text: "SCIM Provisioning",
+              link: "/guides/setup-scim.md"
+            },
+            {
+              text: "PostgreSQL",
+              link: "/guides/setup-postgres.md"
+            },
           ],
         },
         {
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -49,7 +51,9 @@ func (p *Providers) AddRefreshToken(user repo.User, roles []repo.Role, kind jwt.
 	return signedToken, tokenID, nil
 }
 
-func (p *Providers) AddAccessToken(user repo.User, roles []repo.Role, ttl time.Duration, parentTokenID string, kind jwt.LoginKind, headers http.Header) (string, string, error) {
+// AddAccessToken creates a new access token for user. The groups of the user
+// are added to the token claims as well.
+func (p *Providers) AddAccessToken(ctx context.Context, user repo.User, roles []repo.Role, ttl time.Duration, parentTokenID string, kind jwt.LoginKind, headers http.Header) (string, string, error) {
 	defaultTTL := p.Config.AccessTTL()
 
 	for _, overwrite := range p.Config.Overwrites {
@@ -79,7 +83,12 @@ func (p *Providers) AddAccessToken(user repo.User, roles []repo.Role, ttl time.D
 		ttl = defaultTTL
 	}
 
-	signedToken, tokenID, err := p.CreateSignedJWT(user, roles, parentTokenID, ttl, kind, jwt.ScopeAccess)
+	groups, err := p.Datastore.GetEffectiveGroupsForUser(ctx, user.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get user groups: %w", err)
+	}
+
+	signedToken, tokenID, err := p.createSignedJWT(user, roles, groups, parentTokenID, ttl, kind, jwt.ScopeAccess)
 	if err != nil {
 		return "", "", err
 	}
@@ -93,11 +102,19 @@ func (p *Providers) AddAccessToken(user repo.User, roles []repo.Role, ttl time.D
 }
 
 func (p *Providers) CreateSignedJWT(user repo.User, roles []repo.Role, parentTokenID string, ttl time.Duration, kind jwt.LoginKind, scopes ...jwt.Scope) (string, string, error) {
+	return p.createSignedJWT(user, roles, nil, parentTokenID, ttl, kind, scopes...)
+}
+
+func (p *Providers) createSignedJWT(user repo.User, roles []repo.Role, groups []repo.UserGroup, parentTokenID string, ttl time.Duration, kind jwt.LoginKind, scopes ...jwt.Scope) (string, string, error) {
 	auth := &jwt.Authorization{}
 	for _, g := range roles {
 		auth.Roles = append(auth.Roles, g.ID)
 	}
 
+	for _, g := range groups {
+		auth.Groups = append(auth.Groups, g.ID)
+	}
+
 	tokenID, err := uuid.NewV4()
 	if err != nil {
 		return "", "", err
@@ -6,23 +6,33 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/protovalidate-go"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/authcache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/backup"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/bootstrap"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/cache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/mailer"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/maintenance"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/provisioning"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/relations"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/search"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/sms"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/tmpl"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 	"golang.org/x/exp/slices"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/structpb"
@@ -39,6 +49,15 @@ type Providers struct {
 	Validator      protovalidate.Validator
 	Cache          cache.Cache
 	PolicyEngine   *policy.Engine
+	Webhooks       *webhook.Dispatcher
+	Changes        *changes.Feed
+	Provisioning   *provisioning.Syncer
+	Backups        *backup.Scheduler
+	Maintenance    *maintenance.Scheduler
+	Search         *search.Indexer
+	AuthCache      *authcache.Cache
+	Relations      *relations.Checker
+	Constraints    *constraints.Checker
 }
 
 func (p *Providers) SendMailVerification(ctx context.Context, user repo.User, mail repo.UserEmail) error {
@@ -120,6 +139,10 @@ func (p *Providers) GenerateRegistrationToken(ctx context.Context, creator repo.
 			initialRoleIDs = append(initialRoleIDs, roleModel.ID)
 		}
 
+		if err := p.Constraints.CheckRoles(ctx, p.Datastore, initialRoleIDs); err != nil {
+			return "", err
+		}
+
 		roleBlob, err := json.Marshal(initialRoleIDs)
 		if err != nil {
 			return "", err
@@ -149,10 +172,115 @@ func getCurrentFieldVisiblity(ctx context.Context, id string) string {
 	return config.FieldVisibilityPublic
 }
 
+// profileReaderRoles may read all fields of other users' profiles. They
+// match the allowed_roles of the (tkd.common.v1.readable) option of
+// tkd.idm.v1.Profile.
+var profileReaderRoles = []string{"idm_superuser", "idm_user_manager"}
+
+// CanReadProfiles reports whether the current caller may read all fields of
+// other users' profiles. Everyone else only sees the public fields.
+func CanReadProfiles(ctx context.Context) bool {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil || claims.AppMetadata == nil || claims.AppMetadata.Authorization == nil {
+		return false
+	}
+
+	for _, role := range profileReaderRoles {
+		if slices.Contains(claims.AppMetadata.Authorization.Roles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SearchUsers returns the IDs of at most limit active users matching query,
+// best matches first. Profile and extra data fields are only searched if they
+// are visible to the current caller for all users.
+func (p *Providers) SearchUsers(ctx context.Context, query string, limit int) ([]string, error) {
+	includePrivate := getCurrentFieldVisiblity(ctx, "") == config.FieldVisibilityPrivate
+
+	return p.Search.Search(ctx, query, CanReadProfiles(ctx), includePrivate, limit)
+}
+
+// CanFilterByExtraField reports whether the current caller may filter users
+// by the extra data field at the dot-separated path. Only scalar fields that
+// are visible to the caller for all users can be used as a filter.
+func (p *Providers) CanFilterByExtraField(ctx context.Context, path string) bool {
+	// filtering matches other users so fields with "self" visibility must not
+	// be used.
+	visibility := getCurrentFieldVisiblity(ctx, "")
+
+	var field *config.FieldConfig
+	fields := p.Config.ExtraDataConfig
+
+	for _, name := range strings.Split(path, ".") {
+		field = nil
+		for _, fc := range fields {
+			if fc.Name == name {
+				field = fc
+				break
+			}
+		}
+
+		if field == nil || !field.VisibleTo(visibility) {
+			return false
+		}
+
+		fields = field.Properties
+	}
+
+	switch field.Type {
+	case config.FieldTypeString, config.FieldTypeNumber, config.FieldTypeBool, config.FieldTypeDate, config.FieldTypeTime:
+		return true
+	}
+
+	return false
+}
+
+// EmitUserEvent emits a user lifecycle event for usr including the
+// user profile.
+func (p *Providers) EmitUserEvent(ctx context.Context, eventType webhook.EventType, usr repo.User) {
+	if !p.Webhooks.HasSubscribers(eventType) {
+		return
+	}
+
+	var profile *idmv1.Profile
+	if eventType != webhook.UserDeleted {
+		var err error
+		profile, err = p.GetUserProfileProto(ctx, usr)
+		if err != nil {
+			log.L(ctx).Error("failed to get user profile for webhook event", "event", eventType, "error", err)
+		}
+	}
+
+	p.Webhooks.Emit(ctx, eventType, webhook.NewUserData(usr.ID, profile))
+}
+
+// PublishUserCreated publishes a user.created change for usr followed by a
+// role.assigned change for each role that has been assigned during creation.
+func (p *Providers) PublishUserCreated(ctx context.Context, usr repo.User) {
+	p.Changes.Publish(ctx, changes.UserCreated, usr.ID, "", changes.UserData{Username: usr.Username})
+
+	roles, err := p.Datastore.GetRolesForUser(ctx, usr.ID)
+	if err != nil {
+		log.L(ctx).Error("failed to get user roles for change feed", "error", err)
+		return
+	}
+
+	for _, role := range roles {
+		p.Changes.Publish(ctx, changes.RoleAssigned, usr.ID, role.ID, changes.RoleData{Name: role.Name})
+	}
+}
+
 func (p *Providers) GetUserProfileProto(ctx context.Context, usr repo.User) (*idmv1.Profile, error) {
 	return GetUserProfileProto(ctx, p.Datastore, p.Config, usr)
 }
 
+func (p *Providers) GetUserProfileProtos(ctx context.Context, users []repo.User) ([]*idmv1.Profile, error) {
+	return GetUserProfileProtos(ctx, p.Datastore, p.Config, users)
+}
+
 func GetUserProfileProto(ctx context.Context, tx *repo.Queries, cfg config.Config, usr repo.User) (*idmv1.Profile, error) {
 	addresses, err := tx.GetUserAddresses(ctx, usr.ID)
 	if err != nil {
@@ -179,6 +307,73 @@ func GetUserProfileProto(ctx context.Context, tx *repo.Queries, cfg config.Confi
 		return nil, fmt.Errorf("failed to check for existing recovery codes: %w", err)
 	}
 
+	return newProfileProto(ctx, cfg, usr, addresses, phones, roles, emails, hasBackupCodes), nil
+}
+
+// GetUserProfileProtos returns the profiles of all users. In contrast to
+// GetUserProfileProto, addresses, phone numbers, roles and e-mail addresses
+// are loaded for all users at once.
+func GetUserProfileProtos(ctx context.Context, tx *repo.Queries, cfg config.Config, users []repo.User) ([]*idmv1.Profile, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(users))
+	for idx, usr := range users {
+		ids[idx] = usr.ID
+	}
+
+	addresses, err := tx.GetAddressesForUsers(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load addresses: %w", err)
+	}
+
+	phones, err := tx.GetPhoneNumbersForUsers(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load phone numbers: %w", err)
+	}
+
+	roles, err := tx.GetRolesForUsers(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	emails, err := tx.GetEmailsForUsers(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails: %w", err)
+	}
+
+	addressesByUser := make(map[string][]repo.UserAddress)
+	for _, a := range addresses {
+		addressesByUser[a.UserID] = append(addressesByUser[a.UserID], a)
+	}
+
+	phonesByUser := make(map[string][]repo.UserPhoneNumber)
+	for _, p := range phones {
+		phonesByUser[p.UserID] = append(phonesByUser[p.UserID], p)
+	}
+
+	rolesByUser := make(map[string][]repo.Role)
+	for _, r := range roles {
+		rolesByUser[r.UserID] = append(rolesByUser[r.UserID], r.Role)
+	}
+
+	emailsByUser := make(map[string][]repo.UserEmail)
+	for _, e := range emails {
+		emailsByUser[e.UserID] = append(emailsByUser[e.UserID], e)
+	}
+
+	profiles := make([]*idmv1.Profile, len(users))
+	for idx, usr := range users {
+		// users have just been loaded so there's no need to query the TOTP
+		// enrollment again.
+		profiles[idx] = newProfileProto(ctx, cfg, usr, addressesByUser[usr.ID], phonesByUser[usr.ID], rolesByUser[usr.ID], emailsByUser[usr.ID], usr.TotpSecret.Valid)
+	}
+
+	return profiles, nil
+}
+
+func newProfileProto(ctx context.Context, cfg config.Config, usr repo.User, addresses []repo.UserAddress, phones []repo.UserPhoneNumber, roles []repo.Role, emails []repo.UserEmail, hasBackupCodes bool) *idmv1.Profile {
 	var primaryMail *repo.UserEmail
 	for _, mail := range emails {
 		if mail.IsPrimary {
@@ -229,7 +424,7 @@ func GetUserProfileProto(ctx context.Context, tx *repo.Queries, cfg config.Confi
 		}
 	}
 
-	return profile, nil
+	return profile
 }
 
 func (p *Providers) ValidateUserExtraData(pb *structpb.Struct) error {
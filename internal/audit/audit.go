@@ -0,0 +1,131 @@
+// Package audit implements the administrative audit log of cisidm.
+//
+// Every mutating RPC is recorded by the interceptor returned from
+// NewInterceptor. Service implementations may enrich the recorded entry using
+// SetTarget and RecordChange so the audit log contains the affected resource
+// as well as a before/after diff of the change.
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// Actor kinds that are recorded in the audit log.
+const (
+	ActorKindAnonymous = "anonymous"
+	ActorKindUser      = "user"
+	ActorKindAPIToken  = "api"
+	ActorKindAdmin     = "admin"
+)
+
+// Target types used by the services when calling SetTarget.
+const (
+	TargetUser              = "user"
+	TargetRole              = "role"
+	TargetGroup             = "group"
+	TargetRoleRequest       = "role-request"
+	TargetAPIToken          = "api-token"
+	TargetRegistrationToken = "registration-token"
+)
+
+// Entry holds information about a single, in-flight audit log entry.
+// It is created by the audit interceptor and attached to the request
+// context.
+type Entry struct {
+	l sync.Mutex
+
+	targetType string
+	targetID   string
+
+	before    any
+	after     any
+	hasChange bool
+
+	redactActor bool
+}
+
+type entryContextKey struct{}
+
+// WithEntry returns a new context that has e attached.
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryContextKey{}, e)
+}
+
+// EntryFromContext returns the audit log entry associated with ctx or nil
+// if the current operation is not audited.
+func EntryFromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(entryContextKey{}).(*Entry)
+	return e
+}
+
+// SetTarget records the resource that is affected by the current operation.
+// It is a no-op if ctx does not carry an audit log entry.
+func SetTarget(ctx context.Context, targetType, targetID string) {
+	e := EntryFromContext(ctx)
+	if e == nil {
+		return
+	}
+
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.targetType = targetType
+	e.targetID = targetID
+}
+
+// RecordChange records the state of the target resource before and after the
+// current operation. Either before or after may be nil if the resource has
+// been created or deleted. Protobuf messages are serialized using protojson,
+// everything else using encoding/json.
+// It is a no-op if ctx does not carry an audit log entry.
+func RecordChange(ctx context.Context, before, after any) {
+	e := EntryFromContext(ctx)
+	if e == nil {
+		return
+	}
+
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.before = before
+	e.after = after
+	e.hasChange = true
+}
+
+// RedactActor omits the name, client IP and user agent of the actor from the
+// recorded entry. It is used if the data of the actor has been erased by the
+// current operation.
+// It is a no-op if ctx does not carry an audit log entry.
+func RedactActor(ctx context.Context) {
+	e := EntryFromContext(ctx)
+	if e == nil {
+		return
+	}
+
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.redactActor = true
+}
+
+func (e *Entry) target() (string, string) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	return e.targetType, e.targetID
+}
+
+func (e *Entry) change() (any, any, bool) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	return e.before, e.after, e.hasChange
+}
+
+func (e *Entry) actorRedacted() bool {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	return e.redactActor
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// redactedValue replaces the value of sensitive fields.
+const redactedValue = "[redacted]"
+
+// sensitiveKeys holds the names of fields that are never written to the
+// audit log in clear text. Keys are compared case-insensitive and with
+// underscores removed so they match protojson and encoding/json output.
+var sensitiveKeys = map[string]struct{}{
+	"password":      {},
+	"oldpassword":   {},
+	"newpassword":   {},
+	"secret":        {},
+	"totpsecret":    {},
+	"token":         {},
+	"accesstoken":   {},
+	"refreshtoken":  {},
+	"recoverycodes": {},
+	"code":          {},
+	"cred":          {},
+}
+
+// FieldChange describes the change of a single field.
+type FieldChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// Normalize converts v into a generic JSON value (maps, slices and scalars)
+// with all sensitive fields redacted.
+func Normalize(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+
+	var (
+		blob []byte
+		err  error
+	)
+
+	if msg, ok := v.(proto.Message); ok {
+		blob, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	} else {
+		blob, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %T: %w", v, err)
+	}
+
+	var result any
+	if err := json.Unmarshal(blob, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %T: %w", v, err)
+	}
+
+	return redact(result), nil
+}
+
+func isSensitive(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "_", "")
+
+	_, ok := sensitiveKeys[key]
+
+	return ok
+}
+
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for key, value := range t {
+			if isSensitive(key) {
+				if value != nil && value != "" {
+					t[key] = redactedValue
+				}
+
+				continue
+			}
+
+			t[key] = redact(value)
+		}
+
+	case []any:
+		for idx := range t {
+			t[idx] = redact(t[idx])
+		}
+	}
+
+	return v
+}
+
+// Diff returns all fields that differ between before and after. Both values
+// must already be normalized using Normalize. Nested objects are compared
+// recursively and reported using dotted field paths.
+func Diff(before, after any) map[string]FieldChange {
+	result := make(map[string]FieldChange)
+
+	diff("", before, after, result)
+
+	return result
+}
+
+func diff(prefix string, before, after any, result map[string]FieldChange) {
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+
+	if !bok || !aok {
+		if !reflect.DeepEqual(before, after) {
+			key := prefix
+			if key == "" {
+				key = "."
+			}
+
+			result[key] = FieldChange{Old: before, New: after}
+		}
+
+		return
+	}
+
+	keys := make(map[string]struct{}, len(bm)+len(am))
+	for k := range bm {
+		keys[k] = struct{}{}
+	}
+	for k := range am {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		diff(path, bm[k], am[k], result)
+	}
+}
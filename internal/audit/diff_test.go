@@ -0,0 +1,52 @@
+package audit_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_NormalizeRedactsSecrets(t *testing.T) {
+	v, err := audit.Normalize(repo.User{
+		ID:         "1",
+		Username:   "alice",
+		Password:   "$2a$10$hash",
+		TotpSecret: sql.NullString{String: "secret", Valid: true},
+	})
+	require.NoError(t, err)
+
+	m := v.(map[string]any)
+	assert.Equal(t, "alice", m["Username"])
+	assert.Equal(t, "[redacted]", m["Password"])
+	assert.Equal(t, "[redacted]", m["TotpSecret"])
+}
+
+func Test_Diff(t *testing.T) {
+	before, err := audit.Normalize(map[string]any{
+		"name":  "old",
+		"same":  1,
+		"extra": map[string]any{"a": "b", "c": "d"},
+	})
+	require.NoError(t, err)
+
+	after, err := audit.Normalize(map[string]any{
+		"name":  "new",
+		"same":  1,
+		"extra": map[string]any{"a": "b", "e": "f"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]audit.FieldChange{
+		"name":    {Old: "old", New: "new"},
+		"extra.c": {Old: "d"},
+		"extra.e": {New: "f"},
+	}, audit.Diff(before, after))
+
+	assert.Equal(t, map[string]audit.FieldChange{
+		".": {New: after},
+	}, audit.Diff(nil, after))
+}
@@ -0,0 +1,246 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/apis/pkg/server"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// auditedProcedures holds all mutating RPCs that are recorded in the audit
+// log.
+var auditedProcedures = map[string]struct{}{
+	// AuthService
+	idmv1connect.AuthServiceLoginProcedure:                     {},
+	idmv1connect.AuthServiceLogoutProcedure:                    {},
+	idmv1connect.AuthServiceRequestPasswordResetProcedure:      {},
+	idmv1connect.AuthServiceGenerateRegistrationTokenProcedure: {},
+	idmv1connect.AuthServiceRegisterUserProcedure:              {},
+
+	// SelfServiceService
+	idmv1connect.SelfServiceServiceChangePasswordProcedure:           {},
+	idmv1connect.SelfServiceServiceUpdateProfileProcedure:            {},
+	idmv1connect.SelfServiceServiceAddEmailAddressProcedure:          {},
+	idmv1connect.SelfServiceServiceDeleteEmailAddressProcedure:       {},
+	idmv1connect.SelfServiceServiceMarkEmailAsPrimaryProcedure:       {},
+	idmv1connect.SelfServiceServiceValidateEmailProcedure:            {},
+	idmv1connect.SelfServiceServiceAddAddressProcedure:               {},
+	idmv1connect.SelfServiceServiceDeleteAddressProcedure:            {},
+	idmv1connect.SelfServiceServiceUpdateAddressProcedure:            {},
+	idmv1connect.SelfServiceServiceAddPhoneNumberProcedure:           {},
+	idmv1connect.SelfServiceServiceDeletePhoneNumberProcedure:        {},
+	idmv1connect.SelfServiceServiceMarkPhoneNumberAsPrimaryProcedure: {},
+	idmv1connect.SelfServiceServiceValidatePhoneNumberProcedure:      {},
+	idmv1connect.SelfServiceServiceRemovePasskeyProcedure:            {},
+	idmv1connect.SelfServiceServiceEnroll2FAProcedure:                {},
+	idmv1connect.SelfServiceServiceRemove2FAProcedure:                {},
+	idmv1connect.SelfServiceServiceGenerateRecoveryCodesProcedure:    {},
+	idmv1connect.SelfServiceServiceGenerateAPITokenProcedure:         {},
+	idmv1connect.SelfServiceServiceRemoveAPITokenProcedure:           {},
+
+	// UserService
+	idmv1connect.UserServiceImpersonateProcedure:               {},
+	idmv1connect.UserServiceInviteUserProcedure:                {},
+	idmv1connect.UserServiceCreateUserProcedure:                {},
+	idmv1connect.UserServiceUpdateUserProcedure:                {},
+	idmv1connect.UserServiceDeleteUserProcedure:                {},
+	idmv1connect.UserServiceSetUserExtraKeyProcedure:           {},
+	idmv1connect.UserServiceDeleteUserExtraKeyProcedure:        {},
+	idmv1connect.UserServiceSendAccountCreationNoticeProcedure: {},
+	idmv1connect.UserServiceSetUserPasswordProcedure:           {},
+
+	// RoleService
+	idmv1connect.RoleServiceCreateRoleProcedure:                  {},
+	idmv1connect.RoleServiceUpdateRoleProcedure:                  {},
+	idmv1connect.RoleServiceDeleteRoleProcedure:                  {},
+	idmv1connect.RoleServiceAssignRoleToUserProcedure:            {},
+	idmv1connect.RoleServiceUnassignRoleFromUserProcedure:        {},
+	idmv1connect.RoleServiceAssignPermissionsToRoleProcedure:     {},
+	idmv1connect.RoleServiceUnassignPermissionsFromRoleProcedure: {},
+}
+
+// IsAudited returns true if procedure is recorded in the audit log.
+func IsAudited(procedure string) bool {
+	_, ok := auditedProcedures[procedure]
+	return ok
+}
+
+// Recorder persists audit log entries.
+type Recorder struct {
+	datastore *repo.Queries
+}
+
+// NewRecorder returns a new audit log recorder that stores entries in ds.
+func NewRecorder(ds *repo.Queries) *Recorder {
+	return &Recorder{
+		datastore: ds,
+	}
+}
+
+// Record writes a new audit log record for action. Errors are logged but not
+// returned since a failure to write the audit log should not change the
+// outcome of the already executed operation.
+func (r *Recorder) Record(ctx context.Context, action string, e *Entry, callErr error, clientIP, userAgent string) {
+	// make sure the audit record is written even if the request context has
+	// been cancelled in the meantime.
+	ctx = context.WithoutCancel(ctx)
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.L(ctx).Error("failed to generate audit log id", "error", err)
+		return
+	}
+
+	params := repo.CreateAuditEventParams{
+		ID:        id.String(),
+		CreatedAt: time.Now().UTC(),
+		Action:    action,
+		ClientIp:  clientIP,
+		UserAgent: userAgent,
+		Success:   callErr == nil,
+	}
+
+	if callErr != nil {
+		params.Error = callErr.Error()
+	}
+
+	params.ActorID, params.ActorName, params.ActorKind = actorFromContext(ctx)
+	if e.actorRedacted() {
+		params.ActorName, params.ClientIp, params.UserAgent = "", "", ""
+	}
+	params.TargetType, params.TargetID = e.target()
+
+	if before, after, ok := e.change(); ok {
+		b, err := Normalize(before)
+		if err != nil {
+			log.L(ctx).Error("failed to normalize audit state", "action", action, "error", err)
+		}
+
+		a, err := Normalize(after)
+		if err != nil {
+			log.L(ctx).Error("failed to normalize audit state", "action", action, "error", err)
+		}
+
+		params.Before = marshal(ctx, b)
+		params.After = marshal(ctx, a)
+		params.Diff = marshal(ctx, Diff(b, a))
+	}
+
+	if err := r.datastore.CreateAuditEvent(ctx, params); err != nil {
+		log.L(ctx).Error("failed to write audit log entry", "action", action, "target", params.TargetID, "error", err)
+	}
+}
+
+func marshal(ctx context.Context, v any) string {
+	if v == nil {
+		return ""
+	}
+
+	blob, err := json.Marshal(v)
+	if err != nil {
+		log.L(ctx).Error("failed to marshal audit value", "error", err)
+
+		return ""
+	}
+
+	return string(blob)
+}
+
+func actorFromContext(ctx context.Context) (id, name, kind string) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return "", "", ActorKindAnonymous
+	}
+
+	kind = ActorKindUser
+	if claims.AppMetadata != nil {
+		switch claims.AppMetadata.LoginKind {
+		case jwt.LoginKindAPI:
+			kind = ActorKindAPIToken
+		case jwt.LoginKindAdmin:
+			kind = ActorKindAdmin
+		}
+	}
+
+	return claims.Subject, claims.Name, kind
+}
+
+// NewInterceptor returns a connect interceptor that records all audited
+// procedures using r.
+func NewInterceptor(r *Recorder) connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			procedure := req.Spec().Procedure
+
+			if !IsAudited(procedure) {
+				return next(ctx, req)
+			}
+
+			entry := new(Entry)
+			ctx = WithEntry(ctx, entry)
+
+			res, err := next(ctx, req)
+
+			if t, _ := entry.target(); t == "" {
+				if msg, ok := req.Any().(proto.Message); ok {
+					targetType, targetID := targetFromRequest(msg)
+					SetTarget(ctx, targetType, targetID)
+				}
+			}
+
+			// self-service operations always target the authenticated user
+			if t, _ := entry.target(); t == "" && strings.HasPrefix(procedure, "/"+idmv1connect.SelfServiceServiceName+"/") {
+				if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+					SetTarget(ctx, TargetUser, claims.Subject)
+				}
+			}
+
+			var clientIP string
+			if ip := server.RealIPFromContext(ctx); ip != nil {
+				clientIP = ip.String()
+			} else {
+				clientIP = req.Peer().Addr
+			}
+
+			r.Record(ctx, strings.TrimPrefix(procedure, "/"), entry, err, clientIP, req.Header().Get("User-Agent"))
+
+			return res, err
+		}
+	}
+}
+
+// targetFromRequest tries to determine the target of an operation from
+// well-known request fields.
+func targetFromRequest(msg proto.Message) (string, string) {
+	fields := msg.ProtoReflect().Descriptor().Fields()
+
+	for _, candidate := range []struct {
+		field      protoreflect.Name
+		targetType string
+	}{
+		{"user_id", TargetUser},
+		{"role_id", TargetRole},
+	} {
+		fd := fields.ByName(candidate.field)
+		if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+			continue
+		}
+
+		if value := msg.ProtoReflect().Get(fd).String(); value != "" {
+			return candidate.targetType, value
+		}
+	}
+
+	return "", ""
+}
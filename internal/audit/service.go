@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// ServiceName is the name of the audit log service.
+	ServiceName = "cisidm.v1.AuditService"
+
+	// ListEventsProcedure is the HTTP path of the ListEvents endpoint.
+	ListEventsProcedure = "/" + ServiceName + "/ListEvents"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Actor describes the subject that performed an audited operation.
+type Actor struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Kind string `json:"kind"`
+}
+
+// Target describes the resource affected by an audited operation.
+type Target struct {
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+// Event is the API representation of a single audit log record.
+type Event struct {
+	ID         string          `json:"id"`
+	CreateTime time.Time       `json:"createTime"`
+	Actor      Actor           `json:"actor"`
+	Action     string          `json:"action"`
+	Target     *Target         `json:"target,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+	ClientIP   string          `json:"clientIp,omitempty"`
+	UserAgent  string          `json:"userAgent,omitempty"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// ListEventsRequest is the request message for ListEvents. All filters are
+// optional.
+type ListEventsRequest struct {
+	ActorID    string     `json:"actorId,omitempty"`
+	Action     string     `json:"action,omitempty"`
+	TargetType string     `json:"targetType,omitempty"`
+	TargetID   string     `json:"targetId,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	PageSize   int        `json:"pageSize,omitempty"`
+	PageToken  string     `json:"pageToken,omitempty"`
+}
+
+// ListEventsResponse is the response message for ListEvents. Events are
+// sorted newest first. If NextPageToken is set, more events are available.
+type ListEventsResponse struct {
+	Events        []Event `json:"events"`
+	NextPageToken string  `json:"nextPageToken,omitempty"`
+}
+
+// Service provides read access to the audit log.
+type Service struct {
+	datastore *repo.Queries
+}
+
+// NewService returns a new audit log service.
+func NewService(ds *repo.Queries) *Service {
+	return &Service{
+		datastore: ds,
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil || t.IsZero() {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// ListEvents returns audit log events matching the filters in req.
+func (svc *Service) ListEvents(ctx context.Context, req *ListEventsRequest) (*ListEventsResponse, error) {
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	params := repo.ListAuditEventsParams{
+		ActorID:    nullString(req.ActorID),
+		Action:     nullString(req.Action),
+		TargetType: nullString(req.TargetType),
+		TargetID:   nullString(req.TargetID),
+		FromTime:   nullTime(req.From),
+		ToTime:     nullTime(req.To),
+		// fetch one additional record to figure out if there's a next page.
+		Limit: int64(pageSize) + 1,
+	}
+
+	if req.PageToken != "" {
+		seq, err := strconv.ParseInt(req.PageToken, 10, 64)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token"))
+		}
+
+		params.BeforeSeq = sql.NullInt64{Int64: seq, Valid: true}
+	}
+
+	records, err := svc.datastore.ListAuditEvents(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+
+	res := &ListEventsResponse{
+		Events: make([]Event, 0, len(records)),
+	}
+
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		res.NextPageToken = strconv.FormatInt(records[len(records)-1].Seq, 10)
+	}
+
+	for _, r := range records {
+		res.Events = append(res.Events, EventFromModel(r))
+	}
+
+	return res, nil
+}
+
+// EventFromModel converts a database record to it's API representation.
+func EventFromModel(r repo.AuditLog) Event {
+	e := Event{
+		ID:         r.ID,
+		CreateTime: r.CreatedAt,
+		Actor: Actor{
+			ID:   r.ActorID,
+			Name: r.ActorName,
+			Kind: r.ActorKind,
+		},
+		Action:    r.Action,
+		ClientIP:  r.ClientIp,
+		UserAgent: r.UserAgent,
+		Success:   r.Success,
+		Error:     r.Error,
+	}
+
+	if r.TargetType != "" || r.TargetID != "" {
+		e.Target = &Target{
+			Type: r.TargetType,
+			ID:   r.TargetID,
+		}
+	}
+
+	if r.Before != "" {
+		e.Before = json.RawMessage(r.Before)
+	}
+
+	if r.After != "" {
+		e.After = json.RawMessage(r.After)
+	}
+
+	if r.Diff != "" {
+		e.Diff = json.RawMessage(r.Diff)
+	}
+
+	return e
+}
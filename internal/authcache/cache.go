@@ -0,0 +1,324 @@
+// Package authcache caches the results of authenticating requests so
+// forward-auth requests for static assets and similar do not hit the
+// database every time.
+//
+// Subjects resolved for an access token are cached for a short TTL and
+// dropped as soon as the change feed reports a change to the user, to any
+// role or to any group. Whether a token has been rejected is cached as well:
+// rejections are permanent and remembered until the entry is pruned, tokens
+// that have not been rejected are re-checked once the TTL has passed.
+package authcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// pollInterval defines how often the change feed is checked for events
+	// published by other replicas.
+	pollInterval = 30 * time.Second
+	batchSize    = 500
+
+	// rejectedTTL defines how long rejected tokens are remembered. It
+	// outlives the lifetime of access tokens.
+	rejectedTTL = 24 * time.Hour
+)
+
+// Store is the subset of the datastore used by the cache.
+type Store interface {
+	policy.Store
+
+	IsTokenRejected(context.Context, string) (bool, error)
+	GetChangeEventSeqRange(context.Context) (repo.GetChangeEventSeqRangeRow, error)
+	ListChangeEventsAfter(context.Context, repo.ListChangeEventsAfterParams) ([]repo.ChangeEvent, error)
+}
+
+type subjectKey struct {
+	userID  string
+	kind    jwt.LoginKind
+	tokenID string
+}
+
+type subjectEntry struct {
+	subject *policy.SubjectInput
+	expires time.Time
+}
+
+type tokenEntry struct {
+	rejected bool
+	expires  time.Time
+}
+
+// Cache caches resolved subjects and token rejections. A cache with a zero
+// TTL does not cache anything.
+type Cache struct {
+	datastore Store
+	feed      *changes.Feed
+	resolver  permission.Resolver
+	ttl       time.Duration
+
+	l        sync.Mutex
+	subjects map[subjectKey]subjectEntry
+	tokens   map[string]tokenEntry
+
+	// generation is incremented whenever the cache is invalidated so
+	// results loaded concurrently with the invalidation are not stored.
+	generation uint64
+}
+
+// New returns a new cache. Permissions of subjects are resolved using
+// resolver.
+func New(ds Store, feed *changes.Feed, resolver permission.Resolver, ttl time.Duration) *Cache {
+	return &Cache{
+		datastore: ds,
+		feed:      feed,
+		resolver:  resolver,
+		ttl:       ttl,
+		subjects:  make(map[subjectKey]subjectEntry),
+		tokens:    make(map[string]tokenEntry),
+	}
+}
+
+func (c *Cache) enabled() bool {
+	return c.ttl > 0
+}
+
+// Subject returns the subject input for userID like policy.NewSubjectInput.
+// The returned subject is shared and must not be modified.
+func (c *Cache) Subject(ctx context.Context, userID string, kind jwt.LoginKind, tokenID string) (*policy.SubjectInput, error) {
+	if !c.enabled() {
+		return policy.NewSubjectInput(ctx, c.datastore, c.resolver, userID, kind, tokenID)
+	}
+
+	key := subjectKey{userID: userID, kind: kind, tokenID: tokenID}
+	now := time.Now()
+
+	c.l.Lock()
+	entry, ok := c.subjects[key]
+	generation := c.generation
+	c.l.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.subject, nil
+	}
+
+	subject, err := policy.NewSubjectInput(ctx, c.datastore, c.resolver, userID, kind, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.generation == generation {
+		c.subjects[key] = subjectEntry{
+			subject: subject,
+			expires: now.Add(c.ttl),
+		}
+	}
+
+	return subject, nil
+}
+
+// IsTokenRejected reports whether the token with tokenID has been rejected.
+func (c *Cache) IsTokenRejected(ctx context.Context, tokenID string) (bool, error) {
+	if !c.enabled() {
+		return c.datastore.IsTokenRejected(ctx, tokenID)
+	}
+
+	now := time.Now()
+
+	c.l.Lock()
+	entry, ok := c.tokens[tokenID]
+	c.l.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.rejected, nil
+	}
+
+	rejected, err := c.datastore.IsTokenRejected(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	// a concurrent call to RejectToken must not be overwritten.
+	if current, ok := c.tokens[tokenID]; !ok || !current.rejected {
+		ttl := c.ttl
+		if rejected {
+			ttl = rejectedTTL
+		}
+
+		c.tokens[tokenID] = tokenEntry{
+			rejected: rejected,
+			expires:  now.Add(ttl),
+		}
+	}
+
+	return rejected, nil
+}
+
+// RejectToken marks the token with tokenID as rejected. It must be called
+// after the rejection has been stored in the database.
+func (c *Cache) RejectToken(tokenID string) {
+	if !c.enabled() {
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.tokens[tokenID] = tokenEntry{
+		rejected: true,
+		expires:  time.Now().Add(rejectedTTL),
+	}
+}
+
+// InvalidateUser drops all cached subjects of the user with userID.
+func (c *Cache) InvalidateUser(userID string) {
+	if !c.enabled() {
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.generation++
+	for key := range c.subjects {
+		if key.userID == userID {
+			delete(c.subjects, key)
+		}
+	}
+}
+
+// InvalidateAll drops all cached subjects.
+func (c *Cache) InvalidateAll() {
+	if !c.enabled() {
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.generation++
+	c.subjects = make(map[subjectKey]subjectEntry)
+}
+
+// prune removes all expired entries.
+func (c *Cache) prune() {
+	now := time.Now()
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	for key, entry := range c.subjects {
+		if !now.Before(entry.expires) {
+			delete(c.subjects, key)
+		}
+	}
+
+	for key, entry := range c.tokens {
+		if !now.Before(entry.expires) {
+			delete(c.tokens, key)
+		}
+	}
+}
+
+// Run invalidates cached subjects based on the change feed and prunes
+// expired entries until ctx is cancelled.
+func (c *Cache) Run(ctx context.Context) {
+	if !c.enabled() {
+		return
+	}
+
+	notify, unsubscribe := c.feed.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	seqRange, err := c.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		log.L(ctx).Error("failed to query change feed", "error", err)
+	}
+
+	cursor := seqRange.MaxSeq
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.prune()
+		case <-notify:
+		}
+
+		cursor, err = c.sync(ctx, cursor)
+		if err != nil {
+			log.L(ctx).Error("failed to invalidate subject cache", "error", err)
+		}
+	}
+}
+
+// sync invalidates the subjects of all users affected by changes after
+// cursor. If the cursor has expired, all subjects are invalidated.
+func (c *Cache) sync(ctx context.Context, cursor int64) (int64, error) {
+	seqRange, err := c.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		// we don't know what changed so drop everything.
+		c.InvalidateAll()
+
+		return cursor, err
+	}
+
+	if seqRange.MinSeq > 0 && cursor < seqRange.MinSeq-1 {
+		c.InvalidateAll()
+
+		return seqRange.MaxSeq, nil
+	}
+
+	for {
+		events, err := c.datastore.ListChangeEventsAfter(ctx, repo.ListChangeEventsAfterParams{
+			Seq:   cursor,
+			Limit: batchSize,
+		})
+		if err != nil {
+			c.InvalidateAll()
+
+			return cursor, err
+		}
+
+		for _, e := range events {
+			cursor = e.Seq
+
+			switch changes.Type(e.Type) {
+			case changes.RoleUpdated, changes.RoleDeleted, changes.GroupUpdated, changes.GroupDeleted:
+				// permissions of the role or the roles of all group
+				// members might have changed.
+				c.InvalidateAll()
+
+			case changes.RoleCreated, changes.GroupCreated, changes.Heartbeat:
+
+			default:
+				if e.UserID != "" {
+					c.InvalidateUser(e.UserID)
+				}
+			}
+		}
+
+		if len(events) < batchSize {
+			return cursor, nil
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package authcache_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/authcache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// countingStore counts the number of users loaded and token rejection
+// checks.
+type countingStore struct {
+	*repo.Queries
+
+	users    atomic.Int64
+	rejected atomic.Int64
+}
+
+func (s *countingStore) GetUserByID(ctx context.Context, id string) (repo.User, error) {
+	s.users.Add(1)
+
+	return s.Queries.GetUserByID(ctx, id)
+}
+
+func (s *countingStore) IsTokenRejected(ctx context.Context, id string) (bool, error) {
+	s.rejected.Add(1)
+
+	return s.Queries.IsTokenRejected(ctx, id)
+}
+
+func setup(t testing.TB) (*countingStore, *changes.Feed) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "1", Username: "alice", DisplayName: "Alice"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "r1", Name: "vets"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "1", RoleID: "r1"}))
+
+	_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "m1", UserID: "1", Address: "alice@example.com", IsPrimary: true})
+	require.NoError(t, err)
+
+	return &countingStore{Queries: ds}, changes.NewFeed(ds, time.Hour)
+}
+
+func Test_Subject(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store, feed := setup(t)
+	cache := authcache.New(store, feed, permission.NoTree{}, time.Minute)
+
+	go cache.Run(ctx)
+
+	sub, err := cache.Subject(ctx, "1", jwt.LoginKindPassword, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", sub.Username)
+	assert.Equal(t, "alice@example.com", sub.Email)
+
+	_, err = cache.Subject(ctx, "1", jwt.LoginKindPassword, "token")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), store.users.Load())
+
+	// a different token resolves the subject again
+	_, err = cache.Subject(ctx, "1", jwt.LoginKindPassword, "other-token")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), store.users.Load())
+
+	// changes to the user are picked up from the change feed
+	_, err = store.UpdateUser(ctx, repo.UpdateUserParams{ID: "1", Username: "alice", DisplayName: "Alice Smith"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		// Run might not have subscribed to the feed yet.
+		feed.Publish(ctx, changes.UserUpdated, "1", "", nil)
+
+		sub, err := cache.Subject(ctx, "1", jwt.LoginKindPassword, "token")
+		require.NoError(t, err)
+
+		return sub.DisplayName == "Alice Smith"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// deleted users are not cached
+	_, err = store.DeleteUser(ctx, "1")
+	require.NoError(t, err)
+	cache.InvalidateUser("1")
+
+	_, err = cache.Subject(ctx, "1", jwt.LoginKindPassword, "token")
+	assert.Error(t, err)
+}
+
+func Test_Subject_Disabled(t *testing.T) {
+	ctx := context.Background()
+
+	store, feed := setup(t)
+	cache := authcache.New(store, feed, permission.NoTree{}, 0)
+
+	for range 3 {
+		_, err := cache.Subject(ctx, "1", jwt.LoginKindPassword, "token")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(3), store.users.Load())
+}
+
+func Test_IsTokenRejected(t *testing.T) {
+	ctx := context.Background()
+
+	store, feed := setup(t)
+	cache := authcache.New(store, feed, permission.NoTree{}, time.Minute)
+
+	for range 2 {
+		rejected, err := cache.IsTokenRejected(ctx, "token")
+		require.NoError(t, err)
+		assert.False(t, rejected)
+	}
+	assert.Equal(t, int64(1), store.rejected.Load())
+
+	require.NoError(t, store.CreateRejectedToken(ctx, repo.CreateRejectedTokenParams{
+		TokenID:   "token",
+		UserID:    "1",
+		IssuedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	cache.RejectToken("token")
+
+	rejected, err := cache.IsTokenRejected(ctx, "token")
+	require.NoError(t, err)
+	assert.True(t, rejected)
+	assert.Equal(t, int64(1), store.rejected.Load())
+}
+
+func Benchmark_Subject(b *testing.B) {
+	ctx := context.Background()
+
+	for _, bc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"uncached", 0},
+		{"cached", time.Minute},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			store, feed := setup(b)
+			cache := authcache.New(store, feed, permission.NoTree{}, bc.ttl)
+
+			b.ResetTimer()
+
+			for range b.N {
+				if _, err := cache.IsTokenRejected(ctx, "token"); err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err := cache.Subject(ctx, "1", jwt.LoginKindPassword, "token"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+// Package backup creates consistent snapshots of the SQLite database while
+// userd is running and restores them.
+//
+// Snapshots are taken using the SQLite online backup API. A backup file
+// starts with a short header that records whether the snapshot is
+// compressed and/or encrypted so restoring does not depend on file names.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// magic identifies backup files and their format version.
+var magic = []byte("CISIDMB1")
+
+const (
+	flagCompressed byte = 1 << iota
+	flagEncrypted
+)
+
+var (
+	// ErrInvalidBackup is returned if a file is not a backup created by
+	// cisidm.
+	ErrInvalidBackup = errors.New("invalid backup file")
+
+	// ErrKeyRequired is returned when restoring an encrypted backup without
+	// a key.
+	ErrKeyRequired = errors.New("backup is encrypted but no key is configured")
+
+	// ErrUnsupportedDialect is returned for databases other than SQLite.
+	// Use the tools of the database server, like pg_dump, instead.
+	ErrUnsupportedDialect = errors.New("backups are only supported for SQLite databases")
+)
+
+// Options configures how a backup is encoded.
+type Options struct {
+	// Compress enables gzip compression.
+	Compress bool
+
+	// Key enables AES-256-GCM encryption if set. It must be 32 bytes long.
+	Key []byte
+}
+
+// Snapshot writes a consistent snapshot of db to w. It is safe to call
+// while other connections are writing to the database.
+func Snapshot(ctx context.Context, db *sql.DB, w io.Writer, opts Options) error {
+	if repo.DialectOf(db) != repo.DialectSQLite {
+		return ErrUnsupportedDialect
+	}
+
+	dir, err := os.MkdirTemp("", "cisidm-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "idm.db")
+
+	dest, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Raw(func(driverConn any) error {
+		src, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return ErrUnsupportedDialect
+		}
+
+		return copyDatabase(dest, src)
+	}); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	if err := dest.Close(); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return Encode(w, data, opts)
+}
+
+// Restore reads a backup from r and replaces all data in db with it. The
+// backup must contain a schema that can be migrated by this version of
+// cisidm. key is required for encrypted backups.
+func Restore(ctx context.Context, r io.Reader, db *sql.DB, key []byte) error {
+	if repo.DialectOf(db) != repo.DialectSQLite {
+		return ErrUnsupportedDialect
+	}
+
+	data, err := Decode(r, key)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "cisidm-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "idm.db")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+
+	if err := Verify(ctx, path); err != nil {
+		return err
+	}
+
+	src, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Raw(func(driverConn any) error {
+		dest, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return ErrUnsupportedDialect
+		}
+
+		return copyDatabase(dest, src)
+	}); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	return nil
+}
+
+// Verify checks the integrity of the SQLite database at path and ensures
+// its schema can be migrated by this version of cisidm.
+func Verify(ctx context.Context, path string) error {
+	db, err := repo.Open("file:" + path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+	}
+
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check failed: %s", ErrInvalidBackup, result)
+	}
+
+	if _, err := repo.CheckSchema(db); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+	}
+
+	return nil
+}
+
+// Encode writes data to w using the backup file format.
+func Encode(w io.Writer, data []byte, opts Options) error {
+	header := append([]byte{}, magic...)
+
+	var flags byte
+	if opts.Compress {
+		flags |= flagCompressed
+	}
+
+	if len(opts.Key) > 0 {
+		flags |= flagEncrypted
+	}
+
+	header = append(header, flags)
+
+	payload := data
+	if opts.Compress {
+		var buf bytes.Buffer
+
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return err
+		}
+
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		payload = buf.Bytes()
+	}
+
+	if len(opts.Key) > 0 {
+		gcm, err := newGCM(opts.Key)
+		if err != nil {
+			return err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+
+		// the header is authenticated so flags cannot be tampered with.
+		payload = append(nonce, gcm.Seal(nil, nonce, payload, header)...)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+
+	return err
+}
+
+// Decode reads a backup from r and returns the raw SQLite database.
+func Decode(r io.Reader, key []byte) ([]byte, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < len(magic)+1 || !bytes.Equal(content[:len(magic)], magic) {
+		return nil, ErrInvalidBackup
+	}
+
+	header := content[:len(magic)+1]
+	flags := header[len(magic)]
+	payload := content[len(header):]
+
+	if flags&flagEncrypted != 0 {
+		if len(key) == 0 {
+			return nil, ErrKeyRequired
+		}
+
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(payload) < gcm.NonceSize() {
+			return nil, ErrInvalidBackup
+		}
+
+		nonce, ciphertext := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+
+		payload, err = gcm.Open(nil, nonce, ciphertext, header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+		}
+	}
+
+	if flags&flagCompressed != 0 {
+		gz, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+		}
+		defer gz.Close()
+
+		payload, err = io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func openFile(path string) (*sqlite3.SQLiteConn, error) {
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*sqlite3.SQLiteConn), nil
+}
+
+func copyDatabase(dest, src *sqlite3.SQLiteConn) error {
+	b, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+
+	// copy all pages in a single step so the snapshot is consistent even if
+	// the source is modified concurrently.
+	if _, err := b.Step(-1); err != nil {
+		b.Finish()
+
+		return err
+	}
+
+	return b.Finish()
+}
@@ -0,0 +1,124 @@
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/backup"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+var key = bytes.Repeat([]byte{0x42}, 32)
+
+func Test_EncodeDecode(t *testing.T) {
+	data := bytes.Repeat([]byte("SQLite format 3"), 100)
+
+	for _, opts := range []backup.Options{
+		{},
+		{Compress: true},
+		{Key: key},
+		{Compress: true, Key: key},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, backup.Encode(&buf, data, opts))
+
+		decoded, err := backup.Decode(bytes.NewReader(buf.Bytes()), key)
+		require.NoError(t, err)
+		assert.Equal(t, data, decoded)
+
+		if len(opts.Key) > 0 {
+			_, err := backup.Decode(bytes.NewReader(buf.Bytes()), nil)
+			assert.ErrorIs(t, err, backup.ErrKeyRequired)
+
+			_, err = backup.Decode(bytes.NewReader(buf.Bytes()), bytes.Repeat([]byte{0x01}, 32))
+			assert.Error(t, err)
+		}
+	}
+
+	_, err := backup.Decode(bytes.NewReader(data), nil)
+	assert.ErrorIs(t, err, backup.ErrInvalidBackup)
+}
+
+func Test_SnapshotAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	src, err := repo.Open("file:" + filepath.Join(dir, "src.db"))
+	require.NoError(t, err)
+	defer src.Close()
+
+	_, err = repo.Migrate(ctx, src)
+	require.NoError(t, err)
+
+	_, err = repo.New(src).CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	opts := backup.Options{Compress: true, Key: key}
+
+	var buf bytes.Buffer
+	require.NoError(t, backup.Snapshot(ctx, src, &buf, opts))
+
+	dst, err := repo.Open("file:" + filepath.Join(dir, "dst.db"))
+	require.NoError(t, err)
+	defer dst.Close()
+
+	require.NoError(t, backup.Restore(ctx, bytes.NewReader(buf.Bytes()), dst, key))
+
+	usr, err := repo.New(dst).GetUserByID(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", usr.Username)
+
+	// databases without cisidm migrations are rejected
+	empty, err := repo.Open("file:" + filepath.Join(dir, "empty.db"))
+	require.NoError(t, err)
+	defer empty.Close()
+
+	_, err = empty.Exec("CREATE TABLE foo (id TEXT)")
+	require.NoError(t, err)
+
+	buf.Reset()
+	require.NoError(t, backup.Snapshot(ctx, empty, &buf, backup.Options{}))
+	assert.ErrorIs(t, backup.Restore(ctx, &buf, dst, nil), backup.ErrInvalidBackup)
+}
+
+func Test_SchedulerRetention(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, err := repo.Open("file:" + filepath.Join(dir, "idm.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	cfg := &config.Backup{
+		Directory: filepath.Join(dir, "backups"),
+		Retention: 2,
+		Compress:  true,
+	}
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	s := backup.NewScheduler(db, cfg)
+
+	var paths []string
+	for range 3 {
+		path, err := s.Backup(ctx)
+		require.NoError(t, err)
+
+		paths = append(paths, path)
+	}
+
+	entries, err := os.ReadDir(cfg.Directory)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, filepath.Base(paths[1]), entries[0].Name())
+	assert.Equal(t, filepath.Base(paths[2]), entries[1].Name())
+}
@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	filePrefix   = "idm-"
+	timeFormat   = "20060102T150405.000Z"
+	fileSuffixDB = ".db"
+)
+
+// FileName returns the file name for a backup created at t. File names sort
+// in chronological order.
+func FileName(t time.Time, opts Options) string {
+	name := filePrefix + t.UTC().Format(timeFormat) + fileSuffixDB
+
+	if opts.Compress {
+		name += ".gz"
+	}
+
+	if len(opts.Key) > 0 {
+		name += ".enc"
+	}
+
+	return name
+}
+
+// Scheduler periodically creates backups in the configured directory and
+// removes old ones.
+type Scheduler struct {
+	db  *sql.DB
+	cfg *config.Backup
+}
+
+// NewScheduler returns a new backup scheduler.
+func NewScheduler(db *sql.DB, cfg *config.Backup) *Scheduler {
+	return &Scheduler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// Options returns the encoding options configured for backups.
+func (s *Scheduler) Options() Options {
+	return Options{
+		Compress: s.cfg.Compress,
+		Key:      s.cfg.Key(),
+	}
+}
+
+// Run creates backups until ctx is cancelled. It returns immediately if
+// scheduled backups are disabled.
+func (s *Scheduler) Run(ctx context.Context) {
+	if s == nil || s.cfg.ScheduleInterval() == 0 {
+		return
+	}
+
+	if repo.DialectOf(s.db) != repo.DialectSQLite {
+		log.L(ctx).Warn("scheduled backups are only supported for SQLite databases")
+
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.ScheduleInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		path, err := s.Backup(ctx)
+		if err != nil {
+			log.L(ctx).Error("failed to create scheduled backup", "error", err)
+
+			continue
+		}
+
+		log.L(ctx).Info("created scheduled backup", "path", path)
+	}
+}
+
+// Backup creates a new backup in the configured directory and removes
+// backups exceeding the retention. It returns the path of the new backup.
+func (s *Scheduler) Backup(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(s.cfg.Directory, 0o700); err != nil {
+		return "", err
+	}
+
+	opts := s.Options()
+	path := filepath.Join(s.cfg.Directory, FileName(time.Now(), opts))
+
+	// write to a temporary file first so incomplete backups are never
+	// picked up by restore or retention.
+	f, err := os.CreateTemp(s.cfg.Directory, ".tmp-"+filePrefix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if err := Snapshot(ctx, s.db, f, opts); err != nil {
+		f.Close()
+
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+
+	if err := s.prune(); err != nil {
+		return path, fmt.Errorf("failed to remove old backups: %w", err)
+	}
+
+	return path, nil
+}
+
+func (s *Scheduler) prune() error {
+	entries, err := os.ReadDir(s.cfg.Directory)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), filePrefix) || !strings.Contains(e.Name(), fileSuffixDB) {
+			continue
+		}
+
+		backups = append(backups, e.Name())
+	}
+
+	if len(backups) <= s.cfg.Retention {
+		return nil
+	}
+
+	slices.Sort(backups)
+
+	for _, name := range backups[:len(backups)-s.cfg.Retention] {
+		if err := os.Remove(filepath.Join(s.cfg.Directory, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
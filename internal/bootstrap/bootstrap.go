@@ -57,6 +57,13 @@ func Bootstrap(ctx context.Context, cfg config.Config, store *repo.Queries) erro
 		delete(roleIndex, role.ID)
 	}
 
+	// re-create role inclusions once all system roles exist
+	for _, role := range cfg.Roles {
+		if err := bootstrapInclusions(ctx, store, role); err != nil {
+			return fmt.Errorf("role %q: %w", role.ID, err)
+		}
+	}
+
 	// delete all system roles that were not processed above
 	for id := range roleIndex {
 		if _, err := store.DeleteRole(ctx, id); err != nil {
@@ -102,6 +109,20 @@ func bootstrapRole(ctx context.Context, ds *repo.Queries, role config.Role) erro
 	return nil
 }
 
+func bootstrapInclusions(ctx context.Context, ds *repo.Queries, role config.Role) error {
+	if err := ds.DeleteAllRoleInclusions(ctx, role.ID); err != nil {
+		return fmt.Errorf("failed to delete existing role inclusions: %w", err)
+	}
+
+	for _, included := range role.Includes {
+		if err := ds.IncludeRole(ctx, role.ID, included); err != nil {
+			return fmt.Errorf("failed to include role %q: %w", included, err)
+		}
+	}
+
+	return nil
+}
+
 // GenerateSecret returns a random secret of the given size encoded as hex.
 func GenerateSecret(size int) (string, error) {
 	nonce := make([]byte, size)
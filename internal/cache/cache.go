@@ -8,8 +8,6 @@ import (
 	"time"
 )
 
-// TODO(ppacher): add a redis implementation for the cache.
-
 var (
 	ErrKeyNotFound = errors.New("key not found")
 	ErrKeyExpired  = errors.New("key expired")
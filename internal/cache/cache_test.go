@@ -0,0 +1,147 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/cache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+type backend struct {
+	cache cache.Cache
+
+	// expire lets at least d pass for the cache.
+	expire func(d time.Duration)
+}
+
+func sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func backends(t *testing.T) map[string]backend {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	db, err := repo.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(context.Background(), db)
+	require.NoError(t, err)
+
+	return map[string]backend{
+		"memory": {cache.NewInMemoryCache(), sleep},
+		"redis":  {cache.NewRedisCache(client, "test:"), server.FastForward},
+		"sql":    {cache.NewSQLCache(repo.New(db), time.Minute), sleep},
+	}
+}
+
+func Test_Cache(t *testing.T) {
+	ctx := context.Background()
+
+	for name, b := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			c := b.cache
+
+			var value string
+			assert.ErrorIs(t, c.GetKey(ctx, "missing", &value), cache.ErrKeyNotFound)
+
+			require.NoError(t, c.PutKey(ctx, "key", "value"))
+			require.NoError(t, c.GetKey(ctx, "key", &value))
+			assert.Equal(t, "value", value)
+
+			// values are replaced
+			require.NoError(t, c.PutKey(ctx, "key", "other"))
+			require.NoError(t, c.GetAndDeleteKey(ctx, "key", &value))
+			assert.Equal(t, "other", value)
+			assert.ErrorIs(t, c.GetKey(ctx, "key", nil), cache.ErrKeyNotFound)
+
+			// structs are encoded as JSON
+			type session struct{ UserID string }
+			require.NoError(t, c.PutKey(ctx, "session", session{UserID: "alice"}))
+
+			var s session
+			require.NoError(t, c.GetKey(ctx, "session", &s))
+			assert.Equal(t, "alice", s.UserID)
+
+			require.NoError(t, c.DeleteKey(ctx, "session"))
+			assert.ErrorIs(t, c.GetKey(ctx, "session", nil), cache.ErrKeyNotFound)
+
+			// keys expire after their TTL
+			require.NoError(t, c.PutKeyTTL(ctx, "ttl", "value", 50*time.Millisecond))
+			require.NoError(t, c.GetKey(ctx, "ttl", nil))
+
+			b.expire(100 * time.Millisecond)
+
+			err := c.GetKey(ctx, "ttl", nil)
+			assert.True(t, err == cache.ErrKeyNotFound || err == cache.ErrKeyExpired, "unexpected error: %v", err)
+		})
+	}
+}
+
+func Test_GetAndDeleteKeyIsAtomic(t *testing.T) {
+	ctx := context.Background()
+
+	for name, b := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, b.cache.PutKey(ctx, "code", "123456"))
+
+			var (
+				wg      sync.WaitGroup
+				success atomic.Int32
+			)
+
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					var value string
+					if err := b.cache.GetAndDeleteKey(ctx, "code", &value); err == nil {
+						success.Add(1)
+					}
+				}()
+			}
+
+			wg.Wait()
+			assert.Equal(t, int32(1), success.Load())
+		})
+	}
+}
+
+func Test_SQLCacheSweep(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+	c := cache.NewSQLCache(ds, time.Minute)
+
+	require.NoError(t, c.PutKey(ctx, "forever", "value"))
+	require.NoError(t, c.PutKeyTTL(ctx, "short", "value", time.Millisecond))
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, c.Sweep(ctx))
+
+	_, err = ds.GetCacheEntry(ctx, "short")
+	assert.Error(t, err)
+
+	_, err = ds.GetCacheEntry(ctx, "forever")
+	assert.NoError(t, err)
+}
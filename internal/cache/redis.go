@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache returns a cache that stores keys in redis or any
+// redis-compatible server. All keys are prefixed with prefix so the server
+// may be shared with other applications.
+//
+// Redis removes expired keys on its own so GetKey and GetAndDeleteKey
+// return ErrKeyNotFound instead of ErrKeyExpired.
+func NewRedisCache(client redis.UniversalClient, prefix string) Cache {
+	return &redisCache{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (c *redisCache) PutKey(ctx context.Context, key string, value any) error {
+	return c.PutKeyTTL(ctx, key, value, 0)
+}
+
+func (c *redisCache) PutKeyTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	blob, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// a TTL of zero disables expiration.
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return c.client.Set(ctx, c.prefix+key, blob, ttl).Err()
+}
+
+func (c *redisCache) GetKey(ctx context.Context, key string, receiver any) error {
+	blob, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		return c.convertError(err)
+	}
+
+	if receiver == nil {
+		return nil
+	}
+
+	return json.Unmarshal(blob, receiver)
+}
+
+func (c *redisCache) GetAndDeleteKey(ctx context.Context, key string, receiver any) error {
+	var get *redis.StringCmd
+
+	// GET and DEL are executed in a MULTI/EXEC transaction so only one
+	// caller can ever receive the value. This is used instead of GETDEL to
+	// support older and redis-compatible servers.
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, c.prefix+key)
+		pipe.Del(ctx, c.prefix+key)
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	blob, err := get.Bytes()
+	if err != nil {
+		return c.convertError(err)
+	}
+
+	if receiver == nil {
+		return nil
+	}
+
+	return json.Unmarshal(blob, receiver)
+}
+
+func (c *redisCache) DeleteKey(ctx context.Context, key string) error {
+	n, err := c.client.Del(ctx, c.prefix+key).Result()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
+
+func (c *redisCache) convertError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return ErrKeyNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// SQLCache stores keys in the cache_entries table of the database. Expired
+// entries are removed periodically by Run.
+type SQLCache struct {
+	datastore     *repo.Queries
+	sweepInterval time.Duration
+}
+
+// NewSQLCache returns a new cache that stores keys in the database.
+func NewSQLCache(ds *repo.Queries, sweepInterval time.Duration) *SQLCache {
+	return &SQLCache{
+		datastore:     ds,
+		sweepInterval: sweepInterval,
+	}
+}
+
+func (c *SQLCache) PutKey(ctx context.Context, key string, value any) error {
+	return c.PutKeyTTL(ctx, key, value, 0)
+}
+
+func (c *SQLCache) PutKeyTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	blob, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	var expires sql.NullTime
+	if ttl > 0 {
+		expires = sql.NullTime{
+			Time:  time.Now().Add(ttl).UTC(),
+			Valid: true,
+		}
+	}
+
+	return c.datastore.PutCacheEntry(ctx, repo.PutCacheEntryParams{
+		Key:       key,
+		Value:     string(blob),
+		ExpiresAt: expires,
+	})
+}
+
+func (c *SQLCache) GetKey(ctx context.Context, key string, receiver any) error {
+	entry, err := c.datastore.GetCacheEntry(ctx, key)
+	if err != nil {
+		return convertSQLError(err)
+	}
+
+	return decodeEntry(entry, receiver)
+}
+
+func (c *SQLCache) GetAndDeleteKey(ctx context.Context, key string, receiver any) error {
+	// DELETE ... RETURNING is atomic so only one caller can ever receive
+	// the value.
+	entry, err := c.datastore.TakeCacheEntry(ctx, key)
+	if err != nil {
+		return convertSQLError(err)
+	}
+
+	return decodeEntry(entry, receiver)
+}
+
+func (c *SQLCache) DeleteKey(ctx context.Context, key string) error {
+	return c.GetAndDeleteKey(ctx, key, nil)
+}
+
+// Run removes expired entries until ctx is cancelled.
+func (c *SQLCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Sweep(ctx); err != nil {
+			log.L(ctx).Error("failed to remove expired cache entries", "error", err)
+		}
+	}
+}
+
+// Sweep removes all expired entries.
+func (c *SQLCache) Sweep(ctx context.Context) error {
+	_, err := c.datastore.DeleteExpiredCacheEntries(ctx, sql.NullTime{
+		Time:  time.Now().UTC(),
+		Valid: true,
+	})
+
+	return err
+}
+
+func decodeEntry(entry repo.CacheEntry, receiver any) error {
+	if entry.ExpiresAt.Valid && time.Now().After(entry.ExpiresAt.Time) {
+		return ErrKeyExpired
+	}
+
+	if receiver == nil {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(entry.Value), receiver)
+}
+
+func convertSQLError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrKeyNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,106 @@
+// Package changes implements a persisted, resumable change feed for users,
+// roles, role assignments, groups and user profiles.
+//
+// Each change is appended to the change_events table and identified by a
+// monotonically increasing sequence number that is exposed to clients as an
+// opaque cursor. Since the feed is stored in the database, clients can resume
+// watching from their last cursor after a restart of either side or when
+// connecting to a different replica.
+package changes
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Type is the type of a change event.
+type Type string
+
+// All change types published on the feed.
+const (
+	UserCreated    Type = "user.created"
+	UserUpdated    Type = "user.updated"
+	UserDeleted    Type = "user.deleted"
+	RoleCreated    Type = "role.created"
+	RoleUpdated    Type = "role.updated"
+	RoleDeleted    Type = "role.deleted"
+	RoleAssigned   Type = "role.assigned"
+	RoleUnassigned Type = "role.unassigned"
+	ProfileChanged Type = "profile.changed"
+
+	GroupCreated       Type = "group.created"
+	GroupUpdated       Type = "group.updated"
+	GroupDeleted       Type = "group.deleted"
+	GroupMemberAdded   Type = "group.member_added"
+	GroupMemberRemoved Type = "group.member_removed"
+
+	// Heartbeat is not persisted but sent to watchers once the backlog has
+	// been replayed and periodically afterwards. It carries the current
+	// cursor so idle clients can still checkpoint their position.
+	Heartbeat Type = "heartbeat"
+)
+
+// Types holds all change types that are persisted in the feed.
+var Types = []Type{
+	UserCreated,
+	UserUpdated,
+	UserDeleted,
+	RoleCreated,
+	RoleUpdated,
+	RoleDeleted,
+	RoleAssigned,
+	RoleUnassigned,
+	ProfileChanged,
+	GroupCreated,
+	GroupUpdated,
+	GroupDeleted,
+	GroupMemberAdded,
+	GroupMemberRemoved,
+}
+
+// Profile sections reported in ProfileData.
+const (
+	SectionProfile      = "profile"
+	SectionEmails       = "emails"
+	SectionPhoneNumbers = "phone_numbers"
+	SectionAddresses    = "addresses"
+)
+
+// Event is a single change on the feed.
+type Event struct {
+	// Cursor identifies the position of the event in the feed. Pass it as
+	// WatchChangesRequest.Cursor to resume after this event.
+	Cursor string          `json:"cursor"`
+	ID     string          `json:"id,omitempty"`
+	Type   Type            `json:"type"`
+	Time   time.Time       `json:"time"`
+	UserID string          `json:"userId,omitempty"`
+	RoleID string          `json:"roleId,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// UserData is the event data for user.* events.
+type UserData struct {
+	Username string `json:"username"`
+}
+
+// RoleData is the event data for role.* events. For role.assigned and
+// role.unassigned events the affected user is set in Event.UserID.
+type RoleData struct {
+	Name string `json:"name"`
+}
+
+// GroupData is the event data for group.* events. For group.member_added and
+// group.member_removed events the affected user is set in Event.UserID.
+// group.updated is also published if the roles or subgroups of a group
+// have changed.
+type GroupData struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ProfileData is the event data for profile.changed events.
+type ProfileData struct {
+	// Sections lists which parts of the user profile have changed.
+	Sections []string `json:"sections"`
+}
@@ -0,0 +1,133 @@
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const pruneInterval = time.Hour
+
+// Feed appends change events to the database and notifies watchers about
+// new events.
+type Feed struct {
+	datastore *repo.Queries
+	retention time.Duration
+
+	l        sync.Mutex
+	watchers map[chan struct{}]struct{}
+}
+
+// NewFeed returns a new change feed. Events older than retention are pruned
+// by Run.
+func NewFeed(ds *repo.Queries, retention time.Duration) *Feed {
+	return &Feed{
+		datastore: ds,
+		retention: retention,
+		watchers:  make(map[chan struct{}]struct{}),
+	}
+}
+
+// Publish appends a new change event to the feed. Errors are logged but not
+// returned as the operation that caused the change has already been
+// committed.
+//
+// Watchers use the sequence number as a cursor so events must become visible
+// in the order of their sequence numbers. On PostgreSQL, sequence values are
+// allocated before the transaction commits, so the insert holds an advisory
+// lock until it commits and concurrent publishers are serialized.
+func (f *Feed) Publish(ctx context.Context, eventType Type, userID, roleID string, data any) {
+	if f == nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	l := log.L(ctx).With("change", eventType)
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		l.Error("failed to generate change event id", "error", err)
+		return
+	}
+
+	payload := []byte("null")
+	if data != nil {
+		payload, err = json.Marshal(data)
+		if err != nil {
+			l.Error("failed to marshal change event data", "error", err)
+			return
+		}
+	}
+
+	if err := f.datastore.CreateChangeEvent(ctx, repo.CreateChangeEventParams{
+		ID:        id.String(),
+		Type:      string(eventType),
+		UserID:    userID,
+		RoleID:    roleID,
+		Payload:   string(payload),
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		l.Error("failed to store change event", "error", err)
+		return
+	}
+
+	f.notify()
+}
+
+func (f *Feed) notify() {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	for ch := range f.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives a value whenever a new event is
+// published by this instance. Events published by other replicas are only
+// picked up by polling. The returned function must be called to
+// unsubscribe.
+func (f *Feed) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	f.l.Lock()
+	f.watchers[ch] = struct{}{}
+	f.l.Unlock()
+
+	return ch, func() {
+		f.l.Lock()
+		delete(f.watchers, ch)
+		f.l.Unlock()
+	}
+}
+
+// Run prunes events that are older than the configured retention until ctx
+// is cancelled.
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := f.datastore.DeleteChangeEventsBefore(ctx, time.Now().UTC().Add(-f.retention))
+		if err != nil {
+			log.L(ctx).Error("failed to prune change events", "error", err)
+		} else if count > 0 {
+			log.L(ctx).Info("pruned change events", "count", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
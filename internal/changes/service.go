@@ -0,0 +1,200 @@
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// ServiceName is the name of the change feed service.
+	ServiceName = "cisidm.v1.ChangeService"
+
+	// WatchChangesProcedure is the HTTP path of the WatchChanges endpoint.
+	WatchChangesProcedure = "/" + ServiceName + "/WatchChanges"
+)
+
+const (
+	// pollInterval defines how often the database is checked for events
+	// published by other replicas.
+	pollInterval      = 5 * time.Second
+	heartbeatInterval = 30 * time.Second
+	replayBatchSize   = 500
+)
+
+// WatchChangesRequest is the request message for WatchChanges. All filters
+// are optional.
+type WatchChangesRequest struct {
+	// Cursor is the cursor of the last event received by the client. If
+	// empty, only events published after the call are streamed. Use "0" to
+	// replay all retained events.
+	Cursor string `json:"cursor,omitempty"`
+
+	// Types limits the stream to the given event types.
+	Types []Type `json:"types,omitempty"`
+
+	// UserID limits the stream to events for the given user.
+	UserID string `json:"userId,omitempty"`
+
+	// RoleID limits the stream to events for the given role.
+	RoleID string `json:"roleId,omitempty"`
+}
+
+// Service streams events from the change feed.
+type Service struct {
+	feed *Feed
+}
+
+// NewService returns a new change feed service.
+func NewService(f *Feed) *Service {
+	return &Service{
+		feed: f,
+	}
+}
+
+// WatchChanges replays all events after the requested cursor and then
+// streams new events as they are published until the client disconnects.
+//
+// Users that are not idm_superuser only receive events that are about
+// themselves.
+func (svc *Service) WatchChanges(ctx context.Context, req *connect.Request[WatchChangesRequest], stream *connect.ServerStream[Event]) error {
+	msg := req.Msg
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	isSuperuser := claims.AppMetadata != nil &&
+		claims.AppMetadata.Authorization != nil &&
+		slices.Contains(claims.AppMetadata.Authorization.Roles, "idm_superuser")
+
+	userID := msg.UserID
+	if !isSuperuser {
+		if userID != "" && userID != claims.Subject {
+			return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you are only allowed to watch your own changes"))
+		}
+
+		userID = claims.Subject
+	}
+
+	seqRange, err := svc.feed.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query change feed: %w", err)
+	}
+
+	var cursor int64
+	if msg.Cursor == "" {
+		cursor = seqRange.MaxSeq
+	} else {
+		cursor, err = strconv.ParseInt(msg.Cursor, 10, 64)
+		if err != nil || cursor < 0 {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid cursor"))
+		}
+
+		// if events after the cursor have already been pruned the client
+		// would silently miss changes.
+		if seqRange.MinSeq > 0 && cursor < seqRange.MinSeq-1 {
+			return connect.NewError(connect.CodeOutOfRange, fmt.Errorf("cursor has expired, a full re-sync is required"))
+		}
+	}
+
+	matches := func(r repo.ChangeEvent) bool {
+		if len(msg.Types) > 0 && !slices.Contains(msg.Types, Type(r.Type)) {
+			return false
+		}
+
+		if userID != "" && r.UserID != userID {
+			return false
+		}
+
+		if msg.RoleID != "" && r.RoleID != msg.RoleID {
+			return false
+		}
+
+		return true
+	}
+
+	notify, unsubscribe := svc.feed.Subscribe()
+	defer unsubscribe()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	sendHeartbeat := true
+
+	for {
+		records, err := svc.feed.datastore.ListChangeEventsAfter(ctx, repo.ListChangeEventsAfterParams{
+			Seq:   cursor,
+			Limit: replayBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to query change feed: %w", err)
+		}
+
+		for _, r := range records {
+			cursor = r.Seq
+
+			if !matches(r) {
+				continue
+			}
+
+			if err := stream.Send(eventFromModel(r)); err != nil {
+				return err
+			}
+		}
+
+		// continue replaying if there might be more events
+		if len(records) == replayBatchSize {
+			continue
+		}
+
+		if sendHeartbeat {
+			sendHeartbeat = false
+
+			if err := stream.Send(&Event{
+				Cursor: strconv.FormatInt(cursor, 10),
+				Type:   Heartbeat,
+				Time:   time.Now().UTC(),
+			}); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notify:
+		case <-poll.C:
+		case <-heartbeat.C:
+			sendHeartbeat = true
+		}
+	}
+}
+
+func eventFromModel(r repo.ChangeEvent) *Event {
+	e := &Event{
+		Cursor: strconv.FormatInt(r.Seq, 10),
+		ID:     r.ID,
+		Type:   Type(r.Type),
+		Time:   r.CreatedAt,
+		UserID: r.UserID,
+		RoleID: r.RoleID,
+	}
+
+	if r.Payload != "" && r.Payload != "null" {
+		e.Data = json.RawMessage(r.Payload)
+	}
+
+	return e
+}
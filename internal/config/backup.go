@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// Backup configures database backups. Backups can be created manually using
+// "userd backup" or periodically if an interval is configured.
+type Backup struct {
+	// Directory is the directory where scheduled backups are stored.
+	Directory string `json:"directory" hcl:"directory,optional"`
+
+	// Interval enables scheduled backups. If empty, backups are only
+	// created manually.
+	Interval string `json:"interval" hcl:"interval,optional"`
+
+	// Retention is the number of scheduled backups to keep. Older backups
+	// are deleted after a new backup has been created. Defaults to 7.
+	Retention int `json:"retention" hcl:"retention,optional"`
+
+	// Compress enables gzip compression of backups.
+	Compress bool `json:"compress" hcl:"compress,optional"`
+
+	// EncryptionKey is a base64 encoded 32 byte key. If set, backups are
+	// encrypted using AES-256-GCM. The same key is required to restore a
+	// backup.
+	EncryptionKey string `json:"encryption_key" hcl:"encryption_key,optional"`
+
+	interval time.Duration
+	key      []byte
+}
+
+func (b *Backup) ApplyDefaultsAndValidate() error {
+	if b.Retention == 0 {
+		b.Retention = 7
+	}
+
+	if b.Retention < 0 {
+		return fmt.Errorf("retention: must be positive")
+	}
+
+	if b.Interval != "" {
+		d, err := time.ParseDuration(b.Interval)
+		if err != nil {
+			return fmt.Errorf("interval: %w", err)
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("interval: must be positive")
+		}
+
+		if b.Directory == "" {
+			return fmt.Errorf("directory is required for scheduled backups")
+		}
+
+		b.interval = d
+	}
+
+	if b.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(b.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("encryption_key: %w", err)
+		}
+
+		if len(key) != 32 {
+			return fmt.Errorf("encryption_key: expected 32 bytes but got %d", len(key))
+		}
+
+		b.key = key
+	}
+
+	return nil
+}
+
+// ScheduleInterval returns the interval of scheduled backups or zero if
+// scheduled backups are disabled.
+func (b *Backup) ScheduleInterval() time.Duration {
+	return b.interval
+}
+
+// Key returns the decoded encryption key or nil if backups are not
+// encrypted.
+func (b *Backup) Key() []byte {
+	return b.key
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Supported cache backends.
+const (
+	CacheTypeMemory = "memory"
+	CacheTypeRedis  = "redis"
+	CacheTypeSQL    = "sql"
+)
+
+// Cache configures where short-lived data like password-reset links,
+// verification codes and WebAuthn sessions are stored. Deployments with
+// more than one replica must use a shared backend.
+type Cache struct {
+	// Type selects the cache backend. Either "memory" (default), "redis"
+	// or "sql". The sql backend stores entries in the configured database.
+	Type string `json:"type" hcl:"type,optional"`
+
+	// URL is the URL of the redis server, for example
+	// redis://:password@localhost:6379/0. Only used by the redis backend.
+	URL string `json:"url" hcl:"url,optional"`
+
+	// KeyPrefix is prepended to all keys stored in redis. Defaults to
+	// "cisidm:".
+	KeyPrefix string `json:"key_prefix" hcl:"key_prefix,optional"`
+
+	// SweepInterval defines how often expired entries are removed by the
+	// sql backend. Defaults to 5m.
+	SweepInterval string `json:"sweep_interval" hcl:"sweep_interval,optional"`
+
+	sweepInterval time.Duration
+}
+
+func (c *Cache) ApplyDefaultsAndValidate() error {
+	if c.Type == "" {
+		c.Type = CacheTypeMemory
+	}
+
+	switch c.Type {
+	case CacheTypeMemory, CacheTypeSQL:
+	case CacheTypeRedis:
+		if c.URL == "" {
+			return fmt.Errorf("url is required for the redis backend")
+		}
+	default:
+		return fmt.Errorf("unsupported cache type %q", c.Type)
+	}
+
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = "cisidm:"
+	}
+
+	c.sweepInterval = 5 * time.Minute
+	if c.SweepInterval != "" {
+		d, err := time.ParseDuration(c.SweepInterval)
+		if err != nil {
+			return fmt.Errorf("sweep_interval: %w", err)
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("sweep_interval: must be positive")
+		}
+
+		c.sweepInterval = d
+	}
+
+	return nil
+}
+
+// SweepDuration returns the parsed sweep interval.
+func (c *Cache) SweepDuration() time.Duration {
+	return c.sweepInterval
+}
@@ -84,6 +84,7 @@ type Role struct {
 	Name        string   `json:"name" hcl:"name"`
 	Description string   `json:"description" hcl:"description,optional"`
 	Permissions []string `json:"permissions" hcl:"permissions,optional"`
+	Includes    []string `json:"includes" hcl:"includes,optional"`
 }
 
 type RegistrationMode string
@@ -103,7 +104,30 @@ type PolicyConfig struct {
 	Directories []string `json:"directories" hcl:"directories,optional"`
 	Debug       bool     `json:"debug" hcl:"debug,optional"`
 
+	// APIQuery is the rego query evaluated for each call of a protobuf
+	// service method, like "data.cisidm.api". If empty, only the roles
+	// required by the method are checked.
+	APIQuery string `json:"api_query" hcl:"api_query,optional"`
+
+	// Watch enables reloading of policies when files in Directories or
+	// local bundles change.
+	Watch bool `json:"watch" hcl:"watch,optional"`
+
+	// WatchInterval defines how often files are checked for changes.
+	// Defaults to 5s.
+	WatchInterval string `json:"watch_interval" hcl:"watch_interval,optional"`
+
 	Policies []Policy `json:"policy" hcl:"policy,block"`
+
+	// Bundles holds OPA compatible policy bundles.
+	Bundles []*PolicyBundle `json:"bundle" hcl:"bundle,block"`
+
+	watchInterval time.Duration
+}
+
+// WatchDuration returns the parsed value of WatchInterval.
+func (cfg *PolicyConfig) WatchDuration() time.Duration {
+	return cfg.watchInterval
 }
 
 type ForwardAuthConfig struct {
@@ -130,9 +154,23 @@ type ForwardAuthConfig struct {
 	UsernameHeader           *string `json:"username_header" hcl:"username_header,optional"`
 	MailHeader               *string `json:"mail_header" hcl:"mail_header,optional"`
 	RoleHeader               *string `json:"role_header" hcl:"role_header,optional"`
+	GroupHeader              *string `json:"group_header" hcl:"group_header,optional"`
 	AvatarURLHeader          *string `json:"avatar_url_header" hcl:"avatar_url_header,optional"`
 	DisplayNameHeader        *string `json:"display_name_header" hcl:"display_name_header,optional"`
 	ResolvedPermissionHeader *string `json:"permission_header" hcl:"permission_header,optional"`
+
+	// SubjectCacheTTL defines how long the subject resolved for an access
+	// token is cached. Cached subjects are dropped as soon as the user or
+	// one of the roles changes. Set to "0s" to disable caching.
+	// Defaults to 10s.
+	SubjectCacheTTL string `json:"subject_cache_ttl" hcl:"subject_cache_ttl,optional"`
+
+	subjectCacheTTL time.Duration
+}
+
+// CacheTTL returns the parsed value of SubjectCacheTTL.
+func (cfg *ForwardAuthConfig) CacheTTL() time.Duration {
+	return cfg.subjectCacheTTL
 }
 
 var (
@@ -140,6 +178,7 @@ var (
 	defaultUsernameHeader    = "X-Remote-User"
 	defaultMailHeader        = "X-Remote-Mail"
 	defaultRoleHeader        = "X-Remote-Role"
+	defaultGroupHeader       = "X-Remote-Group"
 	defaultDisplayNameHeader = "X-Remote-User-Display-Name"
 	defaultAvatarURLHeader   = "X-Remote-Avatar-URL"
 	defaultPermissionHeader  = "X-Remote-Permission"
@@ -150,6 +189,33 @@ func (cfg *PolicyConfig) ApplyDefaultsAndValidate() error {
 		return nil
 	}
 
+	if cfg.WatchInterval == "" {
+		cfg.WatchInterval = "5s"
+	}
+
+	d, err := time.ParseDuration(cfg.WatchInterval)
+	if err != nil {
+		return fmt.Errorf("watch_interval: %w", err)
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("watch_interval: must be positive")
+	}
+
+	cfg.watchInterval = d
+
+	names := make(map[string]struct{}, len(cfg.Bundles))
+	for idx, b := range cfg.Bundles {
+		if _, ok := names[b.Name]; ok {
+			return fmt.Errorf("bundle[%d]: duplicate name %q", idx, b.Name)
+		}
+		names[b.Name] = struct{}{}
+
+		if err := b.ApplyDefaultsAndValidate(); err != nil {
+			return fmt.Errorf("bundle %q: %w", b.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -191,6 +257,10 @@ func (cfg *ForwardAuthConfig) ApplyDefaultsAndValidate() error {
 		cfg.RoleHeader = &defaultRoleHeader
 	}
 
+	if cfg.GroupHeader == nil {
+		cfg.GroupHeader = &defaultGroupHeader
+	}
+
 	if cfg.AvatarURLHeader == nil {
 		cfg.AvatarURLHeader = &defaultAvatarURLHeader
 	}
@@ -203,6 +273,17 @@ func (cfg *ForwardAuthConfig) ApplyDefaultsAndValidate() error {
 		cfg.ResolvedPermissionHeader = &defaultPermissionHeader
 	}
 
+	if cfg.SubjectCacheTTL == "" {
+		cfg.subjectCacheTTL = 10 * time.Second
+	} else {
+		ttl, err := time.ParseDuration(cfg.SubjectCacheTTL)
+		if err != nil {
+			return fmt.Errorf("subject_cache_ttl: %w", err)
+		}
+
+		cfg.subjectCacheTTL = ttl
+	}
+
 	return nil
 }
 
@@ -231,6 +312,9 @@ type Config struct {
 	// notification targets.
 	DryRun *DryRun `json:"dry_run" hcl:"dry_run,block"`
 
+	// DatabaseURL is the URL of the database. postgres:// and postgresql://
+	// URLs select the PostgreSQL backend, everything else is opened as a
+	// SQLite3 database.
 	DatabaseURL string `json:"database_url" hcl:"database_url"`
 
 	// Roles holds a list of role name that should be automatically
@@ -289,7 +373,44 @@ type Config struct {
 	// WebPush holds VAPID keys for web-push integration.
 	WebPush *WebPush `json:"webpush" hcl:"webpush,block"`
 
-	permissionTree permission.Resolver
+	// Webhooks defines HTTP endpoints that receive identity lifecycle events.
+	Webhooks []*Webhook `json:"webhook" hcl:"webhook,block"`
+
+	// SCIM enables the SCIM 2.0 provisioning endpoint at /scim/v2.
+	SCIM *SCIM `json:"scim" hcl:"scim,block"`
+
+	// SCIMTargets defines external SCIM 2.0 service providers that users are
+	// provisioned to.
+	SCIMTargets []*SCIMTarget `json:"scim_target" hcl:"scim_target,block"`
+
+	// Relations defines the schema of resource-scoped relationships between
+	// users and objects of other services.
+	Relations *Relations `json:"relations" hcl:"relations,block"`
+
+	// SeparationOfDuties defines mutually exclusive roles and limits the
+	// number of role holders.
+	SeparationOfDuties *SeparationOfDuties `json:"separation_of_duties" hcl:"separation_of_duties,block"`
+
+	// Cache configures the backend for short-lived data like verification
+	// codes and WebAuthn sessions. Defaults to an in-memory cache.
+	Cache *Cache `json:"cache" hcl:"cache,block"`
+
+	// Backup configures database backups.
+	Backup *Backup `json:"backup" hcl:"backup,block"`
+
+	// Privacy configures the GDPR data export and account erasure.
+	Privacy *Privacy `json:"privacy" hcl:"privacy,block"`
+
+	// Maintenance configures the background jobs that remove expired data.
+	Maintenance *Maintenance `json:"maintenance" hcl:"maintenance,block"`
+
+	// ChangeFeedRetention defines how long events of the change feed are
+	// kept. Clients that resume watching with a cursor older than the
+	// retention period must re-sync. Defaults to 168h (7 days).
+	ChangeFeedRetention string `json:"change_feed_retention" hcl:"change_feed_retention,optional"`
+
+	permissionTree      permission.Resolver
+	changeFeedRetention time.Duration
 }
 
 func (cfg *Config) AccessTTL() time.Duration {
@@ -347,7 +468,15 @@ func LoadFile(path string) (*Config, error) {
 	return &f, nil
 }
 
+func (file *Config) ChangeFeedTTL() time.Duration {
+	return file.changeFeedRetention
+}
+
 func (file *Config) PermissionTree() permission.Resolver {
+	if file.permissionTree == nil {
+		return permission.NoTree{}
+	}
+
 	return file.permissionTree
 }
 
@@ -399,6 +528,93 @@ func (file *Config) applyDefaults() error {
 		}
 	}
 
+	names := make(map[string]struct{}, len(file.Webhooks))
+	for idx, wh := range file.Webhooks {
+		if err := wh.ApplyDefaultsAndValidate(); err != nil {
+			return fmt.Errorf("webhook[%d]: %w", idx, err)
+		}
+
+		if _, ok := names[wh.Name]; ok {
+			return fmt.Errorf("webhook[%d]: duplicate name %q", idx, wh.Name)
+		}
+		names[wh.Name] = struct{}{}
+	}
+
+	if file.SCIM != nil {
+		if err := file.SCIM.ApplyDefaultsAndValidate(); err != nil {
+			return fmt.Errorf("scim: %w", err)
+		}
+	}
+
+	targets := make(map[string]struct{}, len(file.SCIMTargets))
+	for idx, t := range file.SCIMTargets {
+		if err := t.ApplyDefaultsAndValidate(); err != nil {
+			return fmt.Errorf("scim_target[%d]: %w", idx, err)
+		}
+
+		if _, ok := targets[t.Name]; ok {
+			return fmt.Errorf("scim_target[%d]: duplicate name %q", idx, t.Name)
+		}
+		targets[t.Name] = struct{}{}
+	}
+
+	if file.Relations == nil {
+		file.Relations = new(Relations)
+	}
+
+	if err := file.Relations.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("relations: %w", err)
+	}
+
+	if file.SeparationOfDuties == nil {
+		file.SeparationOfDuties = new(SeparationOfDuties)
+	}
+
+	if err := file.SeparationOfDuties.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("separation_of_duties: %w", err)
+	}
+
+	if file.Cache == nil {
+		file.Cache = new(Cache)
+	}
+
+	if err := file.Cache.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+
+	if file.Backup == nil {
+		file.Backup = new(Backup)
+	}
+
+	if err := file.Backup.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	if file.Privacy == nil {
+		file.Privacy = new(Privacy)
+	}
+
+	if err := file.Privacy.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("privacy: %w", err)
+	}
+
+	if file.Maintenance == nil {
+		file.Maintenance = new(Maintenance)
+	}
+
+	if err := file.Maintenance.ApplyDefaultsAndValidate(); err != nil {
+		return fmt.Errorf("maintenance: %w", err)
+	}
+
+	if file.ChangeFeedRetention == "" {
+		file.changeFeedRetention = 7 * 24 * time.Hour
+	} else {
+		file.changeFeedRetention, err = time.ParseDuration(file.ChangeFeedRetention)
+		if err != nil {
+			return fmt.Errorf("change_feed_retention: %w", err)
+		}
+	}
+
 	for idx, ov := range file.Overwrites {
 		if err := ov.Validate(file.JWT.accessTokenTTL, file.JWT.refreshTokenTTL); err != nil {
 			return fmt.Errorf("overwrite[%d]: %w", idx, err)
@@ -36,6 +36,7 @@ type FieldConfig struct {
 	Name           string          `json:"name" hcl:"name,label"`
 	Visibility     string          `json:"visibility" hcl:"visibility,optional"`
 	Writeable      *bool           `json:"writeable" hcl:"writeable,optional"`
+	Searchable     bool            `json:"searchable" hcl:"searchable,optional"`
 	Description    string          `json:"description" hcl:"description,optional"`
 	DisplayName    string          `json:"display_name" hcl:"display_name,optional"`
 	Properties     []*FieldConfig  `json:"property" hcl:"property,block"`
@@ -127,6 +128,12 @@ func (fc FieldConfig) Validate(data *structpb.Value) error {
 	return nil
 }
 
+// VisibleTo reports whether the field is visible to a caller with the
+// visibility level current.
+func (fc *FieldConfig) VisibleTo(current string) bool {
+	return getEffectiveVisibility(current, fc.Visibility) == current
+}
+
 func (fc *FieldConfig) ApplyVisibility(current string, value *structpb.Value) *structpb.Value {
 	effectiveVisibility := getEffectiveVisibility(current, fc.Visibility)
 
@@ -185,6 +192,15 @@ func (fc *FieldConfig) ValidateConfig(fieldVisibility string, writeable bool) er
 		return fmt.Errorf("parent object has stronger visibility %q, %q does not take effect", fieldVisibility, fc.Visibility)
 	}
 
+	// Only values that can be represented as text can be searched.
+	if fc.Searchable {
+		switch fc.Type {
+		case FieldTypeString, FieldTypeNumber, FieldTypeDate, FieldTypeTime, FieldTypeList:
+		default:
+			return fmt.Errorf("fields of type %q cannot be searchable", fc.Type)
+		}
+	}
+
 	// Possible values are only supported for strings
 	if len(fc.PossibleValues) > 0 && fc.Type != FieldTypeString {
 		return fmt.Errorf("value blocks are only supported for 'string' types")
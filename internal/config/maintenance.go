@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Maintenance configures the background jobs that remove expired data.
+type Maintenance struct {
+	// LeaseDuration is the maximum duration a replica holds the lease of a
+	// job. If a replica crashes while running a job, other replicas may run
+	// it again after the lease expired. Defaults to 10m.
+	LeaseDuration string `json:"lease_duration" hcl:"lease_duration,optional"`
+
+	// DeletedUserRetention enables purging soft-deleted users and all of
+	// their data once they have been deleted for longer than this duration.
+	// If empty, deleted users are kept forever.
+	DeletedUserRetention string `json:"deleted_user_retention" hcl:"deleted_user_retention,optional"`
+
+	// RoleExpiryNotice enables notifying users by mail about role
+	// assignments that expire within this duration. If empty, no
+	// notifications are sent.
+	RoleExpiryNotice string `json:"role_expiry_notice" hcl:"role_expiry_notice,optional"`
+
+	// RoleExpiryNotifyAdmins sends a copy of each role expiry notice to all
+	// users with the idm_superuser role.
+	RoleExpiryNotifyAdmins bool `json:"role_expiry_notify_admins" hcl:"role_expiry_notify_admins,optional"`
+
+	// Jobs overwrites the schedule of individual jobs.
+	Jobs []*MaintenanceJob `json:"job" hcl:"job,block"`
+
+	leaseDuration        time.Duration
+	deletedUserRetention time.Duration
+	roleExpiryNotice     time.Duration
+}
+
+// MaintenanceJob configures a single maintenance job.
+type MaintenanceJob struct {
+	Name string `json:"name" hcl:"name,label"`
+
+	// Interval overwrites the default interval of the job.
+	Interval string `json:"interval" hcl:"interval,optional"`
+
+	// Disabled disables scheduled runs of the job. It can still be
+	// triggered manually.
+	Disabled bool `json:"disabled" hcl:"disabled,optional"`
+
+	interval time.Duration
+}
+
+func (m *Maintenance) ApplyDefaultsAndValidate() error {
+	m.leaseDuration = 10 * time.Minute
+	if m.LeaseDuration != "" {
+		d, err := time.ParseDuration(m.LeaseDuration)
+		if err != nil {
+			return fmt.Errorf("lease_duration: %w", err)
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("lease_duration: must be positive")
+		}
+
+		m.leaseDuration = d
+	}
+
+	if m.DeletedUserRetention != "" {
+		d, err := time.ParseDuration(m.DeletedUserRetention)
+		if err != nil {
+			return fmt.Errorf("deleted_user_retention: %w", err)
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("deleted_user_retention: must be positive")
+		}
+
+		m.deletedUserRetention = d
+	}
+
+	if m.RoleExpiryNotice != "" {
+		d, err := time.ParseDuration(m.RoleExpiryNotice)
+		if err != nil {
+			return fmt.Errorf("role_expiry_notice: %w", err)
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("role_expiry_notice: must be positive")
+		}
+
+		m.roleExpiryNotice = d
+	}
+
+	seen := make(map[string]struct{}, len(m.Jobs))
+	for _, job := range m.Jobs {
+		if _, ok := seen[job.Name]; ok {
+			return fmt.Errorf("job %q: configured more than once", job.Name)
+		}
+		seen[job.Name] = struct{}{}
+
+		if job.Interval != "" {
+			d, err := time.ParseDuration(job.Interval)
+			if err != nil {
+				return fmt.Errorf("job %q: interval: %w", job.Name, err)
+			}
+
+			if d <= 0 {
+				return fmt.Errorf("job %q: interval: must be positive", job.Name)
+			}
+
+			job.interval = d
+		}
+	}
+
+	return nil
+}
+
+// LeaseTTL returns the duration of job leases.
+func (m *Maintenance) LeaseTTL() time.Duration {
+	return m.leaseDuration
+}
+
+// UserRetention returns the duration after which deleted users are purged or
+// zero if they should be kept forever.
+func (m *Maintenance) UserRetention() time.Duration {
+	return m.deletedUserRetention
+}
+
+// RoleExpiryNoticePeriod returns how long before their expiry users are
+// notified about expiring role assignments or zero if notifications are
+// disabled.
+func (m *Maintenance) RoleExpiryNoticePeriod() time.Duration {
+	return m.roleExpiryNotice
+}
+
+// Job returns the configuration of the job with the given name or nil if
+// the job is not configured.
+func (m *Maintenance) Job(name string) *MaintenanceJob {
+	for _, job := range m.Jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// ScheduleInterval returns the configured interval of the job or zero if
+// the default interval should be used.
+func (j *MaintenanceJob) ScheduleInterval() time.Duration {
+	return j.interval
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// PolicyBundle configures an OPA compatible policy bundle that is loaded
+// either from a local directory or tarball, or downloaded from a HTTP
+// server.
+type PolicyBundle struct {
+	Name string `json:"name" hcl:"name,label"`
+
+	// Path is the path to a bundle directory or a .tar.gz bundle file.
+	Path string `json:"path" hcl:"path,optional"`
+
+	// URL is the HTTP(S) URL of a .tar.gz bundle. The bundle is downloaded
+	// again whenever its ETag changes.
+	URL string `json:"url" hcl:"url,optional"`
+
+	// Headers holds additional HTTP headers sent when downloading the
+	// bundle, like an Authorization header.
+	Headers map[string]string `json:"headers" hcl:"headers,optional"`
+
+	// PollingInterval defines how often the URL is checked for a new
+	// revision of the bundle. Defaults to 1m.
+	PollingInterval string `json:"polling_interval" hcl:"polling_interval,optional"`
+
+	pollingInterval time.Duration
+}
+
+func (b *PolicyBundle) ApplyDefaultsAndValidate() error {
+	if (b.Path == "") == (b.URL == "") {
+		return fmt.Errorf("exactly one of path or url must be set")
+	}
+
+	if b.URL != "" {
+		u, err := url.Parse(b.URL)
+		if err != nil {
+			return fmt.Errorf("url: %w", err)
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("url: unsupported scheme %q", u.Scheme)
+		}
+	}
+
+	if b.PollingInterval == "" {
+		b.PollingInterval = "1m"
+	}
+
+	d, err := time.ParseDuration(b.PollingInterval)
+	if err != nil {
+		return fmt.Errorf("polling_interval: %w", err)
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("polling_interval: must be positive")
+	}
+
+	b.pollingInterval = d
+
+	return nil
+}
+
+// PollingDuration returns the parsed value of PollingInterval.
+func (b *PolicyBundle) PollingDuration() time.Duration {
+	return b.pollingInterval
+}
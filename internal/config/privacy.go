@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+// Erasure modes.
+const (
+	ErasureModeAnonymize = "anonymize"
+	ErasureModeDelete    = "delete"
+)
+
+// Privacy configures the GDPR self-service data export and account erasure.
+type Privacy struct {
+	// ErasureMode defines what happens to an account when its erasure is
+	// executed. "anonymize" (default) keeps an anonymous, deleted user so
+	// references in the audit log stay valid while "delete" removes the
+	// user entirely.
+	ErasureMode string `json:"erasure_mode" hcl:"erasure_mode,optional"`
+
+	// RequireErasureApproval requires an administrator to approve erasure
+	// requests before they are executed.
+	RequireErasureApproval bool `json:"require_erasure_approval" hcl:"require_erasure_approval,optional"`
+
+	// LoginHistoryLimit is the maximum number of login attempts included
+	// in a data export. Defaults to 1000.
+	LoginHistoryLimit int `json:"login_history_limit" hcl:"login_history_limit,optional"`
+}
+
+func (p *Privacy) ApplyDefaultsAndValidate() error {
+	switch p.ErasureMode {
+	case "":
+		p.ErasureMode = ErasureModeAnonymize
+	case ErasureModeAnonymize, ErasureModeDelete:
+	default:
+		return fmt.Errorf("erasure_mode: unsupported value %q", p.ErasureMode)
+	}
+
+	if p.LoginHistoryLimit == 0 {
+		p.LoginHistoryLimit = 1000
+	}
+
+	if p.LoginHistoryLimit < 0 {
+		return fmt.Errorf("login_history_limit: must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RelationSubjectUser is the object type of cisidm users in relation tuples.
+// It is always available and must not be defined in the schema.
+const RelationSubjectUser = "user"
+
+// Relations defines the schema of the relationship store.
+type Relations struct {
+	// Types defines the object types that relation tuples may refer to.
+	Types []*RelationType `json:"type" hcl:"type,block"`
+}
+
+// RelationType is an object type of the relationship schema.
+type RelationType struct {
+	Name string `json:"name" hcl:"name,label"`
+
+	// Relations defines the relations of objects of this type.
+	Relations []*RelationDefinition `json:"relation" hcl:"relation,block"`
+}
+
+// RelationDefinition defines a relation of an object type. Subjects may
+// always be related to an object directly using relation tuples.
+type RelationDefinition struct {
+	Name string `json:"name" hcl:"name,label"`
+
+	// Union lists computed usersets whose subjects have this relation as
+	// well. An entry is either the name of another relation of the same
+	// object, like "owner", or "<relation>-><target>" to include all
+	// subjects that have the target relation on the objects related by
+	// relation, like "parent->viewer".
+	Union []string `json:"union" hcl:"union,optional"`
+}
+
+func (r *Relations) ApplyDefaultsAndValidate() error {
+	types := make(map[string]*RelationType, len(r.Types))
+
+	for idx, t := range r.Types {
+		if err := validateRelationName(t.Name); err != nil {
+			return fmt.Errorf("type[%d]: %w", idx, err)
+		}
+
+		if t.Name == RelationSubjectUser {
+			return fmt.Errorf("type[%d]: %q is reserved for cisidm users", idx, t.Name)
+		}
+
+		if _, ok := types[t.Name]; ok {
+			return fmt.Errorf("type[%d]: duplicate name %q", idx, t.Name)
+		}
+
+		types[t.Name] = t
+	}
+
+	for _, t := range r.Types {
+		relations := make(map[string]struct{}, len(t.Relations))
+		for idx, rel := range t.Relations {
+			if err := validateRelationName(rel.Name); err != nil {
+				return fmt.Errorf("type %q: relation[%d]: %w", t.Name, idx, err)
+			}
+
+			if _, ok := relations[rel.Name]; ok {
+				return fmt.Errorf("type %q: relation[%d]: duplicate name %q", t.Name, idx, rel.Name)
+			}
+
+			relations[rel.Name] = struct{}{}
+		}
+
+		for _, rel := range t.Relations {
+			for _, u := range rel.Union {
+				tupleset, target, isTupleset := strings.Cut(u, "->")
+
+				if _, ok := relations[tupleset]; !ok {
+					return fmt.Errorf("type %q: relation %q: union %q: unknown relation %q", t.Name, rel.Name, u, tupleset)
+				}
+
+				if isTupleset {
+					if err := validateRelationName(target); err != nil {
+						return fmt.Errorf("type %q: relation %q: union %q: %w", t.Name, rel.Name, u, err)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateRelationName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+
+	if strings.ContainsAny(name, ":# ") || strings.Contains(name, "->") {
+		return fmt.Errorf("invalid name %q", name)
+	}
+
+	return nil
+}
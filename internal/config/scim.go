@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+type SCIM struct {
+	// AllowedRoles is a list of role IDs or names. Only users (and API
+	// tokens of users) that are assigned to at least one of those roles may
+	// use the SCIM endpoint. Defaults to idm_superuser.
+	AllowedRoles []string `json:"allowed_roles" hcl:"allowed_roles,optional"`
+
+	// MaxResults is the maximum number of resources returned by a single
+	// list or search request. Defaults to 200.
+	MaxResults int `json:"max_results" hcl:"max_results,optional"`
+
+	// MaxBulkOperations is the maximum number of operations allowed in a
+	// single bulk request. Defaults to 100.
+	MaxBulkOperations int `json:"max_bulk_operations" hcl:"max_bulk_operations,optional"`
+
+	// MaxBulkPayloadSize is the maximum size of a bulk request in bytes.
+	// Defaults to 1MB.
+	MaxBulkPayloadSize int `json:"max_bulk_payload_size" hcl:"max_bulk_payload_size,optional"`
+}
+
+func (s *SCIM) ApplyDefaultsAndValidate() error {
+	if len(s.AllowedRoles) == 0 {
+		s.AllowedRoles = []string{"idm_superuser"}
+	}
+
+	if s.MaxResults < 0 || s.MaxBulkOperations < 0 || s.MaxBulkPayloadSize < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	if s.MaxResults == 0 {
+		s.MaxResults = 200
+	}
+
+	if s.MaxBulkOperations == 0 {
+		s.MaxBulkOperations = 100
+	}
+
+	if s.MaxBulkPayloadSize == 0 {
+		s.MaxBulkPayloadSize = 1 << 20
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Deprovisioning modes for SCIM targets.
+const (
+	DeprovisionDeactivate = "deactivate"
+	DeprovisionDelete     = "delete"
+)
+
+// SCIMUserFields lists the user fields that can be mapped to SCIM attributes.
+// Additionally, user extra data can be mapped using extra.<path>.
+var SCIMUserFields = []string{
+	"id",
+	"username",
+	"display_name",
+	"first_name",
+	"last_name",
+	"email",
+	"phone",
+}
+
+// DefaultSCIMAttributes is used if a SCIM target does not configure an
+// attribute mapping.
+var DefaultSCIMAttributes = map[string]string{
+	"userName":        "username",
+	"externalId":      "id",
+	"displayName":     "display_name",
+	"name.givenName":  "first_name",
+	"name.familyName": "last_name",
+	"emails":          "email",
+	"phoneNumbers":    "phone",
+}
+
+type SCIMTarget struct {
+	// Name is a unique name for the target.
+	Name string `json:"name" hcl:"name,label"`
+
+	// URL is the base URL of the SCIM 2.0 API of the target, for example
+	// https://wiki.example.com/scim/v2.
+	URL string `json:"url" hcl:"url"`
+
+	// Token is sent as a bearer token in the Authorization header.
+	Token string `json:"token" hcl:"token,optional"`
+
+	// Roles is a list of role IDs or names. If set, only users that are
+	// assigned to at least one of those roles are provisioned.
+	Roles []string `json:"roles" hcl:"roles,optional"`
+
+	// Attributes maps SCIM attribute paths to user fields. Supported fields
+	// are id, username, display_name, first_name, last_name, email, phone
+	// and extra.<path>. Defaults to DefaultSCIMAttributes.
+	Attributes map[string]string `json:"attributes" hcl:"attributes,optional"`
+
+	// Deprovision defines what happens to users that are deleted or no
+	// longer in scope. Either "deactivate" (default) or "delete".
+	Deprovision string `json:"deprovision" hcl:"deprovision,optional"`
+
+	// SyncInterval defines how often a full sync is performed. Changes are
+	// pushed incrementally in between. Defaults to 24h.
+	SyncInterval string `json:"sync_interval" hcl:"sync_interval,optional"`
+
+	// Timeout is the request timeout for a single SCIM request. Defaults
+	// to 30s.
+	Timeout string `json:"timeout" hcl:"timeout,optional"`
+
+	syncInterval time.Duration
+	timeout      time.Duration
+}
+
+func (t *SCIMTarget) ApplyDefaultsAndValidate() error {
+	if t.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: unsupported scheme %q", u.Scheme)
+	}
+
+	if len(t.Attributes) == 0 {
+		t.Attributes = DefaultSCIMAttributes
+	}
+
+	if _, ok := t.Attributes["userName"]; !ok {
+		return fmt.Errorf("attributes: missing mapping for userName")
+	}
+
+	for attr, field := range t.Attributes {
+		if !slices.Contains(SCIMUserFields, field) && !strings.HasPrefix(field, "extra.") {
+			return fmt.Errorf("attributes: %s: unsupported user field %q", attr, field)
+		}
+	}
+
+	switch t.Deprovision {
+	case "":
+		t.Deprovision = DeprovisionDeactivate
+	case DeprovisionDeactivate, DeprovisionDelete:
+	default:
+		return fmt.Errorf("deprovision: unsupported value %q", t.Deprovision)
+	}
+
+	if t.SyncInterval == "" {
+		t.syncInterval = 24 * time.Hour
+	} else {
+		t.syncInterval, err = time.ParseDuration(t.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("sync_interval: %w", err)
+		}
+	}
+
+	if t.Timeout == "" {
+		t.timeout = 30 * time.Second
+	} else {
+		t.timeout, err = time.ParseDuration(t.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *SCIMTarget) FullSyncInterval() time.Duration { return t.syncInterval }
+
+func (t *SCIMTarget) RequestTimeout() time.Duration { return t.timeout }
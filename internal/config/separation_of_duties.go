@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// SeparationOfDuties defines constraints on which roles may be held
+// together and by how many users.
+type SeparationOfDuties struct {
+	// Exclusive defines sets of roles that must never be held by the same
+	// user.
+	Exclusive []*ExclusiveRoles `json:"exclusive" hcl:"exclusive,block"`
+
+	// MaxHolders limits the number of users that may hold a role. Keys are
+	// role IDs or names.
+	MaxHolders map[string]int `json:"max_holders" hcl:"max_holders,optional"`
+}
+
+// ExclusiveRoles is a set of mutually exclusive roles. A user may hold at
+// most one of them, either directly, through a group or through role
+// inclusion.
+type ExclusiveRoles struct {
+	Name        string `json:"name" hcl:"name,label"`
+	Description string `json:"description" hcl:"description,optional"`
+
+	// Roles holds the IDs or names of the mutually exclusive roles.
+	Roles []string `json:"roles" hcl:"roles"`
+}
+
+func (sod *SeparationOfDuties) ApplyDefaultsAndValidate() error {
+	names := make(map[string]struct{}, len(sod.Exclusive))
+
+	for idx, set := range sod.Exclusive {
+		if set.Name == "" {
+			return fmt.Errorf("exclusive[%d]: name must not be empty", idx)
+		}
+
+		if _, ok := names[set.Name]; ok {
+			return fmt.Errorf("exclusive[%d]: duplicate name %q", idx, set.Name)
+		}
+
+		if len(set.Roles) < 2 {
+			return fmt.Errorf("exclusive %q: at least two roles are required", set.Name)
+		}
+
+		names[set.Name] = struct{}{}
+	}
+
+	for role, max := range sod.MaxHolders {
+		if max < 1 {
+			return fmt.Errorf("max_holders: %q: limit must be at least 1", role)
+		}
+	}
+
+	return nil
+}
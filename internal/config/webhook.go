@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type Webhook struct {
+	// Name is a unique name for the webhook and is used to identify
+	// deliveries.
+	Name string `json:"name" hcl:"name,label"`
+
+	// URL is the HTTP(s) endpoint that receives event deliveries using
+	// HTTP POST requests.
+	URL string `json:"url" hcl:"url"`
+
+	// Secret is used to sign each delivery using HMAC-SHA256. The signature
+	// is sent in the X-Cisidm-Signature header.
+	Secret string `json:"secret" hcl:"secret"`
+
+	// Events is a list of event types that should be delivered to this
+	// webhook. If empty, all events are delivered.
+	Events []string `json:"events" hcl:"events,optional"`
+
+	// MaxAttempts is the maximum number of delivery attempts before a
+	// delivery is marked as failed. Defaults to 10.
+	MaxAttempts int `json:"max_attempts" hcl:"max_attempts,optional"`
+
+	// Timeout is the request timeout for a single delivery attempt.
+	// Defaults to 10s.
+	Timeout string `json:"timeout" hcl:"timeout,optional"`
+
+	timeout time.Duration
+}
+
+func (wh *Webhook) ApplyDefaultsAndValidate() error {
+	if wh.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	u, err := url.Parse(wh.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: unsupported scheme %q", u.Scheme)
+	}
+
+	if wh.Secret == "" {
+		return fmt.Errorf("missing secret")
+	}
+
+	if wh.MaxAttempts <= 0 {
+		wh.MaxAttempts = 10
+	}
+
+	if wh.Timeout == "" {
+		wh.timeout = 10 * time.Second
+	} else {
+		wh.timeout, err = time.ParseDuration(wh.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (wh *Webhook) RequestTimeout() time.Duration { return wh.timeout }
@@ -0,0 +1,340 @@
+// Package constraints enforces separation-of-duties constraints between
+// roles.
+//
+// Constraints are declared in the separation_of_duties block of the
+// configuration file. Roles are evaluated the same way as for access
+// tokens, so a role counts as held if it is assigned directly, through a
+// group or through role inclusion.
+package constraints
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// KindExclusive is the kind of violations of mutually exclusive roles.
+	KindExclusive = "exclusive"
+
+	// KindMaxHolders is the kind of violations of holder limits.
+	KindMaxHolders = "max_holders"
+)
+
+// ErrViolation is returned if a change violates a constraint.
+var ErrViolation = errors.New("separation of duties violated")
+
+// Violation describes a violated constraint.
+type Violation struct {
+	Kind string `json:"kind"`
+
+	// Constraint is the name of the exclusive role set or the role
+	// reference of a holder limit as written in the configuration.
+	Constraint string `json:"constraint"`
+
+	RoleIDs []string `json:"roleIds"`
+	UserIDs []string `json:"userIds"`
+
+	// Limit is the maximum number of holders for KindMaxHolders.
+	Limit int `json:"limit,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// key identifies a violation across evaluations.
+func (v Violation) key() string {
+	if v.Kind == KindExclusive {
+		return v.Kind + "/" + v.Constraint + "/" + strings.Join(v.UserIDs, ",")
+	}
+
+	return v.Kind + "/" + v.Constraint
+}
+
+// Checker evaluates separation-of-duties constraints. A nil Checker does
+// not have any constraints.
+type Checker struct {
+	cfg *config.SeparationOfDuties
+}
+
+// NewChecker returns a new checker for the constraints in cfg.
+func NewChecker(cfg *config.SeparationOfDuties) *Checker {
+	return &Checker{cfg: cfg}
+}
+
+// Config returns the configured constraints.
+func (c *Checker) Config() *config.SeparationOfDuties {
+	if c == nil || c.cfg == nil {
+		return new(config.SeparationOfDuties)
+	}
+
+	return c.cfg
+}
+
+func (c *Checker) enabled() bool {
+	return c != nil && c.cfg != nil && (len(c.cfg.Exclusive) > 0 || len(c.cfg.MaxHolders) > 0)
+}
+
+// evaluation caches role and holder lookups during a single evaluation.
+type evaluation struct {
+	ctx     context.Context
+	q       *repo.Queries
+	roles   map[string]*repo.Role
+	holders map[string][]string
+}
+
+func newEvaluation(ctx context.Context, q *repo.Queries) *evaluation {
+	return &evaluation{
+		ctx:     ctx,
+		q:       q,
+		roles:   make(map[string]*repo.Role),
+		holders: make(map[string][]string),
+	}
+}
+
+// role resolves a role by ID or name. It returns nil if the role does not
+// exist.
+func (e *evaluation) role(ref string) (*repo.Role, error) {
+	if r, ok := e.roles[ref]; ok {
+		return r, nil
+	}
+
+	role, err := e.q.GetRoleByID(e.ctx, ref)
+	if errors.Is(err, sql.ErrNoRows) {
+		role, err = e.q.GetRoleByName(e.ctx, ref)
+	}
+
+	var result *repo.Role
+
+	switch {
+	case err == nil:
+		result = &role
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("failed to get role %q: %w", ref, err)
+	}
+
+	e.roles[ref] = result
+
+	return result, nil
+}
+
+func (e *evaluation) holdersOf(roleID string) ([]string, error) {
+	if h, ok := e.holders[roleID]; ok {
+		return h, nil
+	}
+
+	holders, err := e.q.GetUsersWithEffectiveRole(e.ctx, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holders of role %q: %w", roleID, err)
+	}
+
+	e.holders[roleID] = holders
+
+	return holders, nil
+}
+
+// Violations returns all existing constraint violations.
+func (c *Checker) Violations(ctx context.Context, q *repo.Queries) ([]Violation, error) {
+	if !c.enabled() {
+		return nil, nil
+	}
+
+	e := newEvaluation(ctx, q)
+
+	var result []Violation
+
+	for _, set := range c.cfg.Exclusive {
+		var (
+			held  = make(map[string][]*repo.Role)
+			users []string
+		)
+
+		for _, ref := range set.Roles {
+			role, err := e.role(ref)
+			if err != nil {
+				return nil, err
+			}
+
+			if role == nil {
+				continue
+			}
+
+			holders, err := e.holdersOf(role.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, userID := range holders {
+				if _, ok := held[userID]; !ok {
+					users = append(users, userID)
+				}
+
+				held[userID] = append(held[userID], role)
+			}
+		}
+
+		slices.Sort(users)
+
+		for _, userID := range users {
+			roles := held[userID]
+			if len(roles) < 2 {
+				continue
+			}
+
+			v := Violation{
+				Kind:       KindExclusive,
+				Constraint: set.Name,
+				UserIDs:    []string{userID},
+			}
+
+			names := make([]string, len(roles))
+			for idx, r := range roles {
+				v.RoleIDs = append(v.RoleIDs, r.ID)
+				names[idx] = r.Name
+			}
+
+			v.Message = fmt.Sprintf("user %s holds the mutually exclusive roles %s (%s)", userID, strings.Join(names, ", "), set.Name)
+
+			result = append(result, v)
+		}
+	}
+
+	refs := make([]string, 0, len(c.cfg.MaxHolders))
+	for ref := range c.cfg.MaxHolders {
+		refs = append(refs, ref)
+	}
+	slices.Sort(refs)
+
+	for _, ref := range refs {
+		limit := c.cfg.MaxHolders[ref]
+
+		role, err := e.role(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if role == nil {
+			continue
+		}
+
+		holders, err := e.holdersOf(role.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(holders) <= limit {
+			continue
+		}
+
+		result = append(result, Violation{
+			Kind:       KindMaxHolders,
+			Constraint: ref,
+			RoleIDs:    []string{role.ID},
+			UserIDs:    holders,
+			Limit:      limit,
+			Message:    fmt.Sprintf("role %s is held by %d users but at most %d are allowed", role.Name, len(holders), limit),
+		})
+	}
+
+	return result, nil
+}
+
+// Enforce calls fn and rejects the changes made by fn if they introduce
+// new constraint violations. Violations that existed before are ignored
+// unless fn adds further holders to an exceeded role. fn must use the
+// transaction tx so the changes are rolled back once Enforce returns an
+// error.
+func (c *Checker) Enforce(ctx context.Context, tx *repo.Queries, fn func() error) error {
+	if !c.enabled() {
+		return fn()
+	}
+
+	before, err := c.Violations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	after, err := c.Violations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]Violation, len(before))
+	for _, v := range before {
+		existing[v.key()] = v
+	}
+
+	var messages []string
+	for _, v := range after {
+		if old, ok := existing[v.key()]; ok && len(v.UserIDs) <= len(old.UserIDs) {
+			continue
+		}
+
+		messages = append(messages, v.Message)
+	}
+
+	if len(messages) > 0 {
+		return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("%w: %s", ErrViolation, strings.Join(messages, "; ")))
+	}
+
+	return nil
+}
+
+// CheckRoles returns an error if roleIDs, including all roles they
+// include, contain more than one role of a mutually exclusive set. It is
+// used to validate the initial roles of registration tokens, holder limits
+// are enforced once the token is used.
+func (c *Checker) CheckRoles(ctx context.Context, q *repo.Queries, roleIDs []string) error {
+	if !c.enabled() {
+		return nil
+	}
+
+	e := newEvaluation(ctx, q)
+
+	effective := make(map[string]struct{})
+	for _, id := range roleIDs {
+		roles, err := q.GetEffectiveRolesForRole(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get effective roles of %q: %w", id, err)
+		}
+
+		for _, r := range roles {
+			effective[r.ID] = struct{}{}
+		}
+	}
+
+	for _, set := range c.cfg.Exclusive {
+		var names []string
+
+		for _, ref := range set.Roles {
+			role, err := e.role(ref)
+			if err != nil {
+				return err
+			}
+
+			if role == nil {
+				continue
+			}
+
+			if _, ok := effective[role.ID]; ok {
+				names = append(names, role.Name)
+			}
+		}
+
+		if len(names) > 1 {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("%w: the roles %s are mutually exclusive (%s)", ErrViolation, strings.Join(names, ", "), set.Name))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package constraints_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_Checker(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, id := range []string{"approver", "clerk", "auditor", "finance"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: id, Name: id})
+		require.NoError(t, err)
+	}
+
+	// finance includes clerk
+	require.NoError(t, ds.IncludeRole(ctx, "finance", "clerk"))
+
+	for _, id := range []string{"alice", "bob", "carol"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: id, Username: id})
+		require.NoError(t, err)
+	}
+
+	cfg := &config.SeparationOfDuties{
+		Exclusive: []*config.ExclusiveRoles{
+			{Name: "billing", Roles: []string{"approver", "clerk"}},
+		},
+		MaxHolders: map[string]int{
+			"auditor": 1,
+		},
+	}
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	checker := constraints.NewChecker(cfg)
+
+	assign := func(userID, roleID string) error {
+		_, err := repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (any, error) {
+			return nil, checker.Enforce(ctx, tx, func() error {
+				return tx.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: userID, RoleID: roleID})
+			})
+		})
+
+		return err
+	}
+
+	t.Run("exclusive roles", func(t *testing.T) {
+		require.NoError(t, assign("alice", "approver"))
+
+		err := assign("alice", "finance")
+		require.ErrorIs(t, err, constraints.ErrViolation)
+		assert.Contains(t, err.Error(), "mutually exclusive")
+
+		// the assignment has been rolled back
+		roles, err := ds.GetEffectiveRolesForUser(ctx, "alice")
+		require.NoError(t, err)
+		require.Len(t, roles, 1)
+
+		require.NoError(t, assign("bob", "finance"))
+	})
+
+	t.Run("exclusive roles through groups", func(t *testing.T) {
+		_, err := ds.CreateGroup(ctx, repo.CreateGroupParams{ID: "accounting", Name: "accounting"})
+		require.NoError(t, err)
+		require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "accounting", RoleID: "approver"}))
+
+		_, err = repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (any, error) {
+			return nil, checker.Enforce(ctx, tx, func() error {
+				return tx.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: "accounting", UserID: "bob"})
+			})
+		})
+		require.ErrorIs(t, err, constraints.ErrViolation)
+	})
+
+	t.Run("max holders", func(t *testing.T) {
+		require.NoError(t, assign("alice", "auditor"))
+		require.ErrorIs(t, assign("bob", "auditor"), constraints.ErrViolation)
+	})
+
+	t.Run("existing violations", func(t *testing.T) {
+		// violations created without enforcement, i.e. before the
+		// constraints have been configured.
+		require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "bob", RoleID: "auditor"}))
+		require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "bob", RoleID: "approver"}))
+
+		violations, err := checker.Violations(ctx, ds)
+		require.NoError(t, err)
+		require.Len(t, violations, 2)
+
+		assert.Equal(t, constraints.KindExclusive, violations[0].Kind)
+		assert.Equal(t, []string{"bob"}, violations[0].UserIDs)
+		assert.ElementsMatch(t, []string{"approver", "clerk"}, violations[0].RoleIDs)
+
+		assert.Equal(t, constraints.KindMaxHolders, violations[1].Kind)
+		assert.ElementsMatch(t, []string{"alice", "bob"}, violations[1].UserIDs)
+
+		// unrelated changes are still possible ...
+		require.NoError(t, assign("carol", "approver"))
+
+		// ... but existing violations must not get worse.
+		require.ErrorIs(t, assign("carol", "auditor"), constraints.ErrViolation)
+	})
+
+	t.Run("registration token roles", func(t *testing.T) {
+		assert.NoError(t, checker.CheckRoles(ctx, ds, []string{"approver", "auditor"}))
+		assert.ErrorIs(t, checker.CheckRoles(ctx, ds, []string{"approver", "finance"}), constraints.ErrViolation)
+	})
+}
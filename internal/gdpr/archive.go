@@ -0,0 +1,415 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// loginAction is the audit log action of login attempts.
+const loginAction = "tkd.idm.v1.AuthService/Login"
+
+// Profile is the profile part of a data export. Secrets like the password
+// hash or the TOTP secret are never exported.
+type Profile struct {
+	ID           string          `json:"id"`
+	Username     string          `json:"username"`
+	DisplayName  string          `json:"displayName,omitempty"`
+	FirstName    string          `json:"firstName,omitempty"`
+	LastName     string          `json:"lastName,omitempty"`
+	Birthday     string          `json:"birthday,omitempty"`
+	Avatar       string          `json:"avatar,omitempty"`
+	Extra        json.RawMessage `json:"extra,omitempty"`
+	HasPassword  bool            `json:"hasPassword"`
+	TOTPEnrolled bool            `json:"totpEnrolled"`
+}
+
+type Email struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Verified bool   `json:"verified"`
+	Primary  bool   `json:"primary"`
+}
+
+type PhoneNumber struct {
+	ID       string `json:"id"`
+	Number   string `json:"number"`
+	Verified bool   `json:"verified"`
+	Primary  bool   `json:"primary"`
+}
+
+type Address struct {
+	ID       string `json:"id"`
+	CityCode string `json:"cityCode,omitempty"`
+	CityName string `json:"cityName,omitempty"`
+	Street   string `json:"street,omitempty"`
+	Extra    string `json:"extra,omitempty"`
+}
+
+type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// RoleRequest is a role access request filed by the user.
+type RoleRequest struct {
+	ID            string     `json:"id"`
+	Role          string     `json:"role"`
+	Justification string     `json:"justification,omitempty"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DecidedAt     *time.Time `json:"decidedAt,omitempty"`
+	Comment       string     `json:"comment,omitempty"`
+}
+
+type Group struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Passkey holds the metadata of a registered passkey. The credential itself
+// is not exported.
+type Passkey struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	ClientName   string `json:"clientName,omitempty"`
+	ClientOS     string `json:"clientOs,omitempty"`
+	ClientDevice string `json:"clientDevice,omitempty"`
+}
+
+// APIToken holds the metadata of an API token. The token value is not
+// exported.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	CreateTime time.Time  `json:"createTime"`
+	ExpireTime *time.Time `json:"expireTime,omitempty"`
+	Roles      []string   `json:"roles,omitempty"`
+}
+
+// Login is a single login attempt recorded in the audit log.
+type Login struct {
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"clientIp,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// NotificationSubscription is a web-push subscription of the user.
+type NotificationSubscription struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// Export returns a ZIP archive holding one JSON file for each category of
+// personal data stored about userID. At most loginLimit login attempts are
+// included. The data is read from a single read-only transaction.
+func Export(ctx context.Context, ds *repo.Queries, userID string, loginLimit int) ([]byte, error) {
+	return repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) ([]byte, error) {
+		var (
+			buf bytes.Buffer
+			zw  = zip.NewWriter(&buf)
+		)
+
+		user, err := tx.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		files := []struct {
+			name string
+			load func() (any, error)
+		}{
+			{"profile.json", func() (any, error) { return profileFromModel(user), nil }},
+			{"emails.json", func() (any, error) { return exportEmails(ctx, tx, userID) }},
+			{"phone_numbers.json", func() (any, error) { return exportPhoneNumbers(ctx, tx, userID) }},
+			{"addresses.json", func() (any, error) { return exportAddresses(ctx, tx, userID) }},
+			{"roles.json", func() (any, error) { return exportRoles(ctx, tx, userID) }},
+			{"role_requests.json", func() (any, error) { return exportRoleRequests(ctx, tx, userID) }},
+			{"groups.json", func() (any, error) { return exportGroups(ctx, tx, userID) }},
+			{"passkeys.json", func() (any, error) { return exportPasskeys(ctx, tx, userID) }},
+			{"api_tokens.json", func() (any, error) { return exportAPITokens(ctx, tx, userID) }},
+			{"login_history.json", func() (any, error) { return exportLogins(ctx, tx, userID, loginLimit) }},
+			{"notification_subscriptions.json", func() (any, error) { return exportSubscriptions(ctx, tx, userID) }},
+		}
+
+		for _, f := range files {
+			value, err := f.load()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+
+			w, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     f.name,
+				Method:   zip.Deflate,
+				Modified: time.Now(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+
+			if err := enc.Encode(value); err != nil {
+				return nil, fmt.Errorf("%s: failed to encode: %w", f.name, err)
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}, repo.ReadOnly())
+}
+
+func profileFromModel(user repo.User) Profile {
+	p := Profile{
+		ID:           user.ID,
+		Username:     user.Username,
+		DisplayName:  user.DisplayName,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Birthday:     user.Birthday,
+		Avatar:       user.Avatar,
+		HasPassword:  user.Password != "",
+		TOTPEnrolled: user.TotpSecret.Valid && user.TotpSecret.String != "",
+	}
+
+	if user.Extra != "" && json.Valid([]byte(user.Extra)) {
+		p.Extra = json.RawMessage(user.Extra)
+	}
+
+	return p
+}
+
+func exportEmails(ctx context.Context, tx *repo.Queries, userID string) ([]Email, error) {
+	emails, err := tx.GetEmailsForUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Email, 0, len(emails))
+	for _, e := range emails {
+		res = append(res, Email{
+			ID:       e.ID,
+			Address:  e.Address,
+			Verified: e.Verified,
+			Primary:  e.IsPrimary,
+		})
+	}
+
+	return res, nil
+}
+
+func exportPhoneNumbers(ctx context.Context, tx *repo.Queries, userID string) ([]PhoneNumber, error) {
+	phones, err := tx.GetPhoneNumbersByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]PhoneNumber, 0, len(phones))
+	for _, p := range phones {
+		res = append(res, PhoneNumber{
+			ID:       p.ID,
+			Number:   p.PhoneNumber,
+			Verified: p.Verified,
+			Primary:  p.IsPrimary,
+		})
+	}
+
+	return res, nil
+}
+
+func exportAddresses(ctx context.Context, tx *repo.Queries, userID string) ([]Address, error) {
+	addresses, err := tx.GetUserAddresses(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Address, 0, len(addresses))
+	for _, a := range addresses {
+		res = append(res, Address{
+			ID:       a.ID,
+			CityCode: a.CityCode,
+			CityName: a.CityName,
+			Street:   a.Street,
+			Extra:    a.Extra,
+		})
+	}
+
+	return res, nil
+}
+
+func exportRoles(ctx context.Context, tx *repo.Queries, userID string) ([]Role, error) {
+	roles, err := tx.GetRolesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Role, 0, len(roles))
+	for _, r := range roles {
+		res = append(res, Role{
+			ID:          r.ID,
+			Name:        r.Name,
+			Description: r.Description,
+		})
+	}
+
+	return res, nil
+}
+
+func exportRoleRequests(ctx context.Context, tx *repo.Queries, userID string) ([]RoleRequest, error) {
+	requests, err := tx.ListRoleRequests(ctx, repo.ListRoleRequestsParams{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]RoleRequest, 0, len(requests))
+	for _, r := range requests {
+		req := RoleRequest{
+			ID:            r.ID,
+			Role:          r.RoleID,
+			Justification: r.Justification,
+			Status:        r.Status,
+			CreatedAt:     r.CreatedAt,
+			Comment:       r.DecisionComment,
+		}
+
+		if role, err := tx.GetRoleByID(ctx, r.RoleID); err == nil {
+			req.Role = role.Name
+		}
+
+		if r.DecidedAt.Valid {
+			req.DecidedAt = &r.DecidedAt.Time
+		}
+
+		res = append(res, req)
+	}
+
+	return res, nil
+}
+
+func exportGroups(ctx context.Context, tx *repo.Queries, userID string) ([]Group, error) {
+	groups, err := tx.GetEffectiveGroupsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, Group{
+			ID:          g.ID,
+			Name:        g.Name,
+			Description: g.Description,
+		})
+	}
+
+	return res, nil
+}
+
+func exportPasskeys(ctx context.Context, tx *repo.Queries, userID string) ([]Passkey, error) {
+	creds, err := tx.GetWebauthnCreds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Passkey, 0, len(creds))
+	for _, c := range creds {
+		res = append(res, Passkey{
+			ID:           c.ID,
+			Type:         c.CredType,
+			ClientName:   c.ClientName,
+			ClientOS:     c.ClientOs,
+			ClientDevice: c.ClientDevice,
+		})
+	}
+
+	return res, nil
+}
+
+func exportAPITokens(ctx context.Context, tx *repo.Queries, userID string) ([]APIToken, error) {
+	tokens, err := tx.GetAPITokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]APIToken, 0, len(tokens))
+	for _, t := range tokens {
+		token := APIToken{
+			ID:         t.ID,
+			Name:       t.Name,
+			CreateTime: t.CreatedAt,
+		}
+
+		if t.ExpiresAt.Valid {
+			token.ExpireTime = &t.ExpiresAt.Time
+		}
+
+		roles, err := tx.GetRolesForToken(ctx, t.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range roles {
+			token.Roles = append(token.Roles, r.Name)
+		}
+
+		res = append(res, token)
+	}
+
+	return res, nil
+}
+
+func exportLogins(ctx context.Context, tx *repo.Queries, userID string, limit int) ([]Login, error) {
+	events, err := tx.ListAuditEvents(ctx, repo.ListAuditEventsParams{
+		Action:     sql.NullString{String: loginAction, Valid: true},
+		TargetType: sql.NullString{String: audit.TargetUser, Valid: true},
+		TargetID:   sql.NullString{String: userID, Valid: true},
+		Limit:      int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Login, 0, len(events))
+	for _, e := range events {
+		res = append(res, Login{
+			Time:      e.CreatedAt,
+			ClientIP:  e.ClientIp,
+			UserAgent: e.UserAgent,
+			Success:   e.Success,
+			Error:     e.Error,
+		})
+	}
+
+	return res, nil
+}
+
+func exportSubscriptions(ctx context.Context, tx *repo.Queries, userID string) ([]NotificationSubscription, error) {
+	subscriptions, err := tx.GetWebPushSubscriptionsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]NotificationSubscription, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		res = append(res, NotificationSubscription{
+			ID:        s.ID,
+			UserAgent: s.UserAgent,
+		})
+	}
+
+	return res, nil
+}
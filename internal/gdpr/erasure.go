@@ -0,0 +1,73 @@
+package gdpr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// Erase executes the pending erasure request r and marks it as completed.
+// All personal data of the user is removed in a single transaction. Depending
+// on the mode of r the user record itself is either anonymized or deleted.
+// Erase returns the user as it was before the erasure.
+func Erase(ctx context.Context, ds *repo.Queries, r repo.ErasureRequest, decidedBy string) (repo.User, error) {
+	return repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (repo.User, error) {
+		user, err := tx.GetUserByID(ctx, r.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return user, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
+			}
+
+			return user, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		if err := tx.EraseUserData(ctx, user.ID); err != nil {
+			return user, err
+		}
+
+		var rows int64
+		switch r.Mode {
+		case config.ErasureModeDelete:
+			rows, err = tx.HardDeleteUser(ctx, user.ID)
+		case config.ErasureModeAnonymize:
+			rows, err = tx.AnonymizeUser(ctx, repo.AnonymizeUserParams{
+				Username: "erased-" + user.ID,
+				ID:       user.ID,
+			})
+		default:
+			return user, fmt.Errorf("unsupported erasure mode %q", r.Mode)
+		}
+
+		if err != nil {
+			return user, fmt.Errorf("failed to erase user: %w", err)
+		}
+
+		if rows == 0 {
+			return user, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
+		}
+
+		now := sql.NullTime{Time: time.Now().UTC(), Valid: true}
+
+		rows, err = tx.CompleteErasureRequest(ctx, repo.CompleteErasureRequestParams{
+			DecidedBy:   decidedBy,
+			DecidedAt:   now,
+			CompletedAt: now,
+			ID:          r.ID,
+		})
+		if err != nil {
+			return user, fmt.Errorf("failed to complete erasure request: %w", err)
+		}
+
+		if rows == 0 {
+			return user, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("erasure request is not pending anymore"))
+		}
+
+		return user, nil
+	})
+}
@@ -0,0 +1,285 @@
+package gdpr_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/gdpr"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func setup(t *testing.T) *repo.Queries {
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "role-admin", Name: "admin"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice", DisplayName: "Alice", Password: "hash"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "mail-1", UserID: "alice", Address: "alice@example.com", IsPrimary: true})
+	require.NoError(t, err)
+
+	_, err = ds.CreateUserPhoneNumber(ctx, repo.CreateUserPhoneNumberParams{ID: "phone-1", UserID: "alice", PhoneNumber: "+431234"})
+	require.NoError(t, err)
+
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "role-admin"}))
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "role-vet", Name: "vet"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateGroup(ctx, repo.CreateGroupParams{ID: "group-vets", Name: "vets", Metadata: "{}"})
+	require.NoError(t, err)
+
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "group-vets", RoleID: "role-vet"}))
+	require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: "group-vets", UserID: "alice", Owner: true}))
+
+	_, err = ds.CreateRoleRequest(ctx, repo.CreateRoleRequestParams{
+		ID:            "role-request-1",
+		UserID:        "alice",
+		RoleID:        "role-vet",
+		Justification: "covering the night shift for Dr. Smith",
+		CreatedAt:     time.Now(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, ds.CreateAPIToken(ctx, repo.CreateAPITokenParams{ID: "token-1", Token: "secret", Name: "ci", UserID: "alice"}))
+
+	for id, payload := range map[string]string{
+		"delivery-alice": `{"id":"e1","type":"user.updated","data":{"userId":"alice","profile":{"user":{"username":"alice"}}}}`,
+		"delivery-bob":   `{"id":"e2","type":"user.updated","data":{"userId":"bob"}}`,
+	} {
+		require.NoError(t, ds.CreateWebhookDelivery(ctx, repo.CreateWebhookDeliveryParams{
+			ID:            id,
+			Webhook:       "hook",
+			EventID:       id,
+			EventType:     "user.updated",
+			Payload:       payload,
+			CreatedAt:     time.Now(),
+			NextAttemptAt: time.Now(),
+		}))
+	}
+
+	for _, e := range []repo.CreateAuditEventParams{
+		{ID: "audit-alice", ActorID: "alice", ActorName: "alice", Action: "UpdateProfile", TargetType: "user", TargetID: "alice", Before: `{"user":{"display_name":"Ali"}}`, After: `{"user":{"display_name":"Alice"}}`, Diff: `{"user.display_name":{"old":"Ali","new":"Alice"}}`, ClientIp: "10.0.0.1", UserAgent: "firefox"},
+		{ID: "audit-role", ActorID: "alice", ActorName: "alice", Action: "UpdateRole", TargetType: "role", TargetID: "role-vet", Before: `{"name":"vets"}`, After: `{"name":"vet"}`, Diff: `{"name":{"old":"vets","new":"vet"}}`, ClientIp: "10.0.0.1", UserAgent: "firefox"},
+		{ID: "audit-bob", ActorID: "bob", ActorName: "bob", Action: "UpdateProfile", TargetType: "user", TargetID: "bob", Before: `{}`, After: `{"user":{"display_name":"Bob"}}`, Diff: `{"user.display_name":{"new":"Bob"}}`},
+	} {
+		e.CreatedAt = time.Now()
+		e.Success = true
+		require.NoError(t, ds.CreateAuditEvent(ctx, e))
+	}
+
+	for id, userID := range map[string]string{"change-alice": "alice", "change-bob": "bob"} {
+		require.NoError(t, ds.CreateChangeEvent(ctx, repo.CreateChangeEventParams{
+			ID:        id,
+			Type:      "user.updated",
+			UserID:    userID,
+			Payload:   `{"username":"` + userID + `"}`,
+			CreatedAt: time.Now(),
+		}))
+	}
+
+	return ds
+}
+
+func auditEvents(t *testing.T, ds *repo.Queries) map[string]repo.AuditLog {
+	t.Helper()
+
+	records, err := ds.ListAuditEvents(context.Background(), repo.ListAuditEventsParams{Limit: 100})
+	require.NoError(t, err)
+
+	result := make(map[string]repo.AuditLog, len(records))
+	for _, r := range records {
+		result[r.ID] = r
+	}
+
+	return result
+}
+
+func createRequest(t *testing.T, ds *repo.Queries, mode string) repo.ErasureRequest {
+	t.Helper()
+
+	r, err := ds.CreateErasureRequest(context.Background(), repo.CreateErasureRequestParams{
+		ID:        "req-1",
+		UserID:    "alice",
+		Username:  "alice",
+		Mode:      mode,
+		Status:    gdpr.StatusPending,
+		CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+func Test_Export(t *testing.T) {
+	ds := setup(t)
+
+	data, err := gdpr.Export(context.Background(), ds, "alice", 100)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(rc)
+		require.NoError(t, err)
+		rc.Close()
+
+		files[f.Name] = buf.Bytes()
+	}
+
+	assert.Contains(t, files, "login_history.json")
+	assert.Contains(t, files, "notification_subscriptions.json")
+
+	var profile gdpr.Profile
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "alice", profile.Username)
+	assert.True(t, profile.HasPassword)
+	assert.NotContains(t, string(files["profile.json"]), "hash")
+
+	var tokens []gdpr.APIToken
+	require.NoError(t, json.Unmarshal(files["api_tokens.json"], &tokens))
+	require.Len(t, tokens, 1)
+	assert.NotContains(t, string(files["api_tokens.json"]), "secret", "token values must not be exported")
+}
+
+func Test_EraseAnonymize(t *testing.T) {
+	ctx := context.Background()
+	ds := setup(t)
+
+	before, err := gdpr.Erase(ctx, ds, createRequest(t, ds, config.ErasureModeAnonymize), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", before.Username)
+
+	user, err := ds.GetUserByID(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, user.Deleted)
+	assert.Equal(t, "erased-alice", user.Username)
+	assert.Empty(t, user.DisplayName)
+	assert.Empty(t, user.Password)
+
+	emails, err := ds.GetEmailsForUserByID(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, emails)
+
+	phones, err := ds.GetPhoneNumbersByUserID(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, phones)
+
+	roles, err := ds.GetRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+
+	// group memberships, including ownership, are removed so the user does
+	// not keep the roles granted by the group.
+	groups, err := ds.GetEffectiveGroupsForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	members, err := ds.GetGroupMembers(ctx, "group-vets")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	roles, err = ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+
+	requests, err := ds.ListRoleRequests(ctx, repo.ListRoleRequestsParams{UserID: "alice"})
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+
+	tokens, err := ds.GetAPITokensForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	_, err = ds.GetWebhookDelivery(ctx, "delivery-alice")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = ds.GetWebhookDelivery(ctx, "delivery-bob")
+	assert.NoError(t, err)
+
+	// audit records are kept but the snapshots of the user and the
+	// identifying data of the actor are removed.
+	records := auditEvents(t, ds)
+
+	rec := records["audit-alice"]
+	assert.Equal(t, "UpdateProfile", rec.Action)
+	assert.Equal(t, "alice", rec.TargetID)
+	assert.Empty(t, rec.Before)
+	assert.Empty(t, rec.After)
+	assert.JSONEq(t, `{"user.display_name":{}}`, rec.Diff)
+	assert.Empty(t, rec.ActorName)
+	assert.Empty(t, rec.ClientIp)
+	assert.Empty(t, rec.UserAgent)
+
+	rec = records["audit-role"]
+	assert.Equal(t, "alice", rec.ActorID)
+	assert.Empty(t, rec.ActorName)
+	assert.Empty(t, rec.ClientIp)
+	assert.Equal(t, `{"name":"vet"}`, rec.After)
+
+	rec = records["audit-bob"]
+	assert.Equal(t, "bob", rec.ActorName)
+	assert.Equal(t, `{"user":{"display_name":"Bob"}}`, rec.After)
+
+	events, err := ds.ListChangeEventsAfter(ctx, repo.ListChangeEventsAfterParams{Seq: 0, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for _, e := range events {
+		if e.UserID == "alice" {
+			assert.Equal(t, "null", e.Payload)
+		} else {
+			assert.Equal(t, `{"username":"bob"}`, e.Payload)
+		}
+	}
+
+	r, err := ds.GetErasureRequest(ctx, "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, gdpr.StatusCompleted, r.Status)
+	assert.Empty(t, r.Username)
+	assert.True(t, r.CompletedAt.Valid)
+}
+
+func Test_EraseDelete(t *testing.T) {
+	ctx := context.Background()
+	ds := setup(t)
+
+	r := createRequest(t, ds, config.ErasureModeDelete)
+
+	_, err := gdpr.Erase(ctx, ds, r, "admin")
+	require.NoError(t, err)
+
+	_, err = ds.GetUserByID(ctx, "alice")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// a completed request cannot be executed again.
+	_, err = gdpr.Erase(ctx, ds, r, "admin")
+	assert.Error(t, err)
+}
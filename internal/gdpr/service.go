@@ -0,0 +1,482 @@
+// Package gdpr implements the GDPR self-service data export and the
+// account erasure flow.
+//
+// Users can download an archive of all personal data stored about them and
+// request the erasure of their account. Depending on the privacy
+// configuration the erasure is executed immediately or after an
+// administrator approved the request. Erased accounts are either anonymized
+// or deleted entirely.
+package gdpr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// ServiceName is the name of the privacy service.
+	ServiceName = "cisidm.v1.PrivacyService"
+
+	// ExportMyDataProcedure is the HTTP path of the ExportMyData endpoint.
+	ExportMyDataProcedure = "/" + ServiceName + "/ExportMyData"
+
+	// RequestErasureProcedure is the HTTP path of the RequestErasure
+	// endpoint.
+	RequestErasureProcedure = "/" + ServiceName + "/RequestErasure"
+
+	// GetMyErasureRequestProcedure is the HTTP path of the
+	// GetMyErasureRequest endpoint.
+	GetMyErasureRequestProcedure = "/" + ServiceName + "/GetMyErasureRequest"
+
+	// CancelErasureProcedure is the HTTP path of the CancelErasure endpoint.
+	CancelErasureProcedure = "/" + ServiceName + "/CancelErasure"
+
+	// ListErasureRequestsProcedure is the HTTP path of the
+	// ListErasureRequests endpoint.
+	ListErasureRequestsProcedure = "/" + ServiceName + "/ListErasureRequests"
+
+	// ApproveErasureProcedure is the HTTP path of the ApproveErasure
+	// endpoint.
+	ApproveErasureProcedure = "/" + ServiceName + "/ApproveErasure"
+
+	// RejectErasureProcedure is the HTTP path of the RejectErasure endpoint.
+	RejectErasureProcedure = "/" + ServiceName + "/RejectErasure"
+)
+
+// Erasure request states.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+)
+
+// ErasureRequest is the API representation of an erasure request.
+type ErasureRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+
+	// Username is cleared once the erasure has been completed.
+	Username string `json:"username,omitempty"`
+
+	Mode        string     `json:"mode"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	CreateTime  time.Time  `json:"createTime"`
+	DecidedBy   string     `json:"decidedBy,omitempty"`
+	DecideTime  *time.Time `json:"decideTime,omitempty"`
+	CompletedAt *time.Time `json:"completeTime,omitempty"`
+}
+
+type ExportMyDataRequest struct{}
+
+// ExportMyDataResponse holds a ZIP archive with all personal data stored
+// about the authenticated user.
+type ExportMyDataResponse struct {
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+}
+
+// RequestErasureRequest is the request message for RequestErasure.
+type RequestErasureRequest struct {
+	// Confirmation must be set to the username of the authenticated user.
+	Confirmation string `json:"confirmation"`
+
+	// Password is required if the account has a password set.
+	Password string `json:"password,omitempty"`
+
+	// Reason is an optional message for the administrators.
+	Reason string `json:"reason,omitempty"`
+}
+
+type RequestErasureResponse struct {
+	Request ErasureRequest `json:"request"`
+}
+
+type GetMyErasureRequestRequest struct{}
+
+// GetMyErasureRequestResponse holds the pending erasure request of the
+// authenticated user, if any.
+type GetMyErasureRequestResponse struct {
+	Request *ErasureRequest `json:"request,omitempty"`
+}
+
+type CancelErasureRequest struct{}
+
+type CancelErasureResponse struct {
+	Request ErasureRequest `json:"request"`
+}
+
+// ListErasureRequestsRequest is the request message for
+// ListErasureRequests. Status is optional.
+type ListErasureRequestsRequest struct {
+	Status string `json:"status,omitempty"`
+}
+
+type ListErasureRequestsResponse struct {
+	Requests []ErasureRequest `json:"requests"`
+}
+
+type ApproveErasureRequest struct {
+	ID string `json:"id"`
+}
+
+type ApproveErasureResponse struct {
+	Request ErasureRequest `json:"request"`
+}
+
+type RejectErasureRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type RejectErasureResponse struct {
+	Request ErasureRequest `json:"request"`
+}
+
+// Service implements the privacy service.
+type Service struct {
+	*app.Providers
+}
+
+// NewService returns a new privacy service.
+func NewService(providers *app.Providers) *Service {
+	return &Service{
+		Providers: providers,
+	}
+}
+
+// ExportMyData returns a ZIP archive of all personal data stored about the
+// authenticated user.
+func (svc *Service) ExportMyData(ctx context.Context, req *ExportMyDataRequest) (*ExportMyDataResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	audit.SetTarget(ctx, audit.TargetUser, claims.Subject)
+
+	data, err := Export(ctx, svc.Datastore, claims.Subject, svc.Config.Privacy.LoginHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExportMyDataResponse{
+		FileName:    fmt.Sprintf("%s-%s.zip", claims.Name, time.Now().Format("2006-01-02")),
+		ContentType: "application/zip",
+		Data:        data,
+	}, nil
+}
+
+// RequestErasure requests the erasure of the authenticated user. The
+// erasure is executed immediately unless administrator approval is
+// required.
+func (svc *Service) RequestErasure(ctx context.Context, req *RequestErasureRequest) (*RequestErasureResponse, error) {
+	claims, err := interactiveClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.SetTarget(ctx, audit.TargetUser, claims.Subject)
+
+	user, err := svc.Datastore.GetUserByID(ctx, claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if req.Confirmation != user.Username {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("confirmation must be set to your username"))
+	}
+
+	// only verify the password if one is actually set.
+	if len(user.Password) > 0 {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("incorrect password"))
+		}
+	}
+
+	if _, err := svc.Datastore.GetPendingErasureRequestForUser(ctx, user.ID); err == nil {
+		return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("an erasure request is already pending"))
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get pending erasure request: %w", err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	r, err := svc.Datastore.CreateErasureRequest(ctx, repo.CreateErasureRequestParams{
+		ID:        id.String(),
+		UserID:    user.ID,
+		Username:  user.Username,
+		Mode:      svc.Config.Privacy.ErasureMode,
+		Status:    StatusPending,
+		Reason:    req.Reason,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erasure request: %w", err)
+	}
+
+	if !svc.Config.Privacy.RequireErasureApproval {
+		r, err = svc.execute(ctx, r, user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &RequestErasureResponse{
+		Request: requestFromModel(r),
+	}, nil
+}
+
+// GetMyErasureRequest returns the pending erasure request of the
+// authenticated user.
+func (svc *Service) GetMyErasureRequest(ctx context.Context, req *GetMyErasureRequestRequest) (*GetMyErasureRequestResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	r, err := svc.Datastore.GetPendingErasureRequestForUser(ctx, claims.Subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &GetMyErasureRequestResponse{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get pending erasure request: %w", err)
+	}
+
+	pb := requestFromModel(r)
+
+	return &GetMyErasureRequestResponse{
+		Request: &pb,
+	}, nil
+}
+
+// CancelErasure cancels the pending erasure request of the authenticated
+// user.
+func (svc *Service) CancelErasure(ctx context.Context, req *CancelErasureRequest) (*CancelErasureResponse, error) {
+	claims, err := interactiveClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.SetTarget(ctx, audit.TargetUser, claims.Subject)
+
+	r, err := svc.Datastore.GetPendingErasureRequestForUser(ctx, claims.Subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("no pending erasure request"))
+		}
+
+		return nil, fmt.Errorf("failed to get pending erasure request: %w", err)
+	}
+
+	r, err = svc.decide(ctx, r.ID, StatusCancelled, "", claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CancelErasureResponse{
+		Request: requestFromModel(r),
+	}, nil
+}
+
+// ListErasureRequests returns all erasure requests, newest first.
+func (svc *Service) ListErasureRequests(ctx context.Context, req *ListErasureRequestsRequest) (*ListErasureRequestsResponse, error) {
+	switch req.Status {
+	case "", StatusPending, StatusCompleted, StatusRejected, StatusCancelled:
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid status %q", req.Status))
+	}
+
+	records, err := svc.Datastore.ListErasureRequests(ctx, req.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list erasure requests: %w", err)
+	}
+
+	res := &ListErasureRequestsResponse{
+		Requests: make([]ErasureRequest, 0, len(records)),
+	}
+
+	for _, r := range records {
+		res.Requests = append(res.Requests, requestFromModel(r))
+	}
+
+	return res, nil
+}
+
+// ApproveErasure approves a pending erasure request and erases the
+// account.
+func (svc *Service) ApproveErasure(ctx context.Context, req *ApproveErasureRequest) (*ApproveErasureResponse, error) {
+	r, err := svc.getPending(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	if claims.Subject == r.UserID {
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("approving the erasure of your own account is not allowed"))
+	}
+
+	r, err = svc.execute(ctx, r, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ApproveErasureResponse{
+		Request: requestFromModel(r),
+	}, nil
+}
+
+// RejectErasure rejects a pending erasure request.
+func (svc *Service) RejectErasure(ctx context.Context, req *RejectErasureRequest) (*RejectErasureResponse, error) {
+	r, err := svc.getPending(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	r, err = svc.decide(ctx, r.ID, StatusRejected, req.Reason, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RejectErasureResponse{
+		Request: requestFromModel(r),
+	}, nil
+}
+
+func (svc *Service) getPending(ctx context.Context, id string) (repo.ErasureRequest, error) {
+	r, err := svc.Datastore.GetErasureRequest(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return r, connect.NewError(connect.CodeNotFound, fmt.Errorf("erasure request not found"))
+		}
+
+		return r, fmt.Errorf("failed to get erasure request: %w", err)
+	}
+
+	audit.SetTarget(ctx, audit.TargetUser, r.UserID)
+
+	if r.Status != StatusPending {
+		return r, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("erasure request is %s", r.Status))
+	}
+
+	return r, nil
+}
+
+func (svc *Service) decide(ctx context.Context, id, status, reason, decidedBy string) (repo.ErasureRequest, error) {
+	rows, err := svc.Datastore.DecideErasureRequest(ctx, repo.DecideErasureRequestParams{
+		Status:    status,
+		Reason:    reason,
+		DecidedBy: decidedBy,
+		DecidedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:        id,
+	})
+	if err != nil {
+		return repo.ErasureRequest{}, fmt.Errorf("failed to update erasure request: %w", err)
+	}
+
+	if rows == 0 {
+		return repo.ErasureRequest{}, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("erasure request is not pending anymore"))
+	}
+
+	r, err := svc.Datastore.GetErasureRequest(ctx, id)
+	if err != nil {
+		return r, fmt.Errorf("failed to get erasure request: %w", err)
+	}
+
+	return r, nil
+}
+
+// execute erases the account referenced by r and publishes the deletion.
+func (svc *Service) execute(ctx context.Context, r repo.ErasureRequest, decidedBy string) (repo.ErasureRequest, error) {
+	user, err := Erase(ctx, svc.Datastore, r, decidedBy)
+	if err != nil {
+		return r, err
+	}
+
+	// the user erased their own account so the audit record must not keep
+	// their name and client details.
+	if decidedBy == user.ID {
+		audit.RedactActor(ctx)
+	}
+
+	svc.EmitUserEvent(ctx, webhook.UserDeleted, user)
+	svc.Changes.Publish(ctx, changes.UserDeleted, user.ID, "", nil)
+
+	r, err = svc.Datastore.GetErasureRequest(ctx, r.ID)
+	if err != nil {
+		return r, fmt.Errorf("failed to get erasure request: %w", err)
+	}
+
+	return r, nil
+}
+
+// interactiveClaims returns the claims of ctx and makes sure the request
+// has been authenticated by the user itself rather than using an API token
+// or the admin listener.
+func interactiveClaims(ctx context.Context) (*jwt.Claims, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	if claims.AppMetadata != nil {
+		switch claims.AppMetadata.LoginKind {
+		case jwt.LoginKindAPI, jwt.LoginKindAdmin:
+			return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("account erasure requires an interactive login"))
+		}
+	}
+
+	return claims, nil
+}
+
+func requestFromModel(r repo.ErasureRequest) ErasureRequest {
+	res := ErasureRequest{
+		ID:         r.ID,
+		UserID:     r.UserID,
+		Username:   r.Username,
+		Mode:       r.Mode,
+		Status:     r.Status,
+		Reason:     r.Reason,
+		CreateTime: r.CreatedAt,
+		DecidedBy:  r.DecidedBy,
+	}
+
+	if r.DecidedAt.Valid {
+		res.DecideTime = &r.DecidedAt.Time
+	}
+
+	if r.CompletedAt.Valid {
+		res.CompletedAt = &r.CompletedAt.Time
+	}
+
+	return res
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+)
+
+// Client calls handlers created by Unary.
+type Client struct {
+	HTTPClient connect.HTTPClient
+	BaseURL    string
+}
+
+// NewClient returns a new client for the cisidm instance at baseURL.
+func NewClient(httpClient connect.HTTPClient, baseURL string) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Call sends req to procedure and decodes the response into res.
+// Errors returned by the server are converted to *connect.Error.
+func (cli *Client) Call(ctx context.Context, procedure string, req any, res any) error {
+	blob, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, cli.BaseURL+procedure, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := cli.HTTPClient.Do(httpReq)
+	if err != nil {
+		return connect.NewError(connect.CodeUnavailable, err)
+	}
+	defer httpRes.Body.Close()
+
+	body, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if httpRes.StatusCode != http.StatusOK {
+		var e errorBody
+		if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+			return connect.NewError(connect.CodeUnknown, fmt.Errorf("unexpected response status %s", httpRes.Status))
+		}
+
+		var code connect.Code
+		if err := code.UnmarshalText([]byte(e.Code)); err != nil {
+			code = connect.CodeUnknown
+		}
+
+		return connect.NewError(code, errors.New(e.Message))
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, res); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+// Package httpapi implements a small JSON-over-HTTP transport for cisidm APIs
+// that are not part of the tkd.idm.v1 protobuf definitions.
+//
+// Requests are sent as HTTP POST with a JSON body to /<service>/<method> and
+// errors are encoded like the Connect unary JSON protocol ({"code": "...",
+// "message": "..."}) so clients can handle them the same way as errors returned
+// by the connect-go services.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/apis/pkg/server"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"golang.org/x/exp/slices"
+)
+
+// maxRequestSize is the maximum size of a request body accepted by the
+// handlers returned from Unary.
+const maxRequestSize = 8 << 20
+
+// UnaryFunc handles a single request message and returns the response message.
+type UnaryFunc[Req, Res any] func(ctx context.Context, req *Req) (*Res, error)
+
+type handlerOptions struct {
+	requireAuth  bool
+	allowedRoles []string
+	recorder     *audit.Recorder
+}
+
+// HandlerOption configures a handler returned by Unary.
+type HandlerOption func(*handlerOptions)
+
+// RequireAuth requires the request to be authenticated.
+func RequireAuth() HandlerOption {
+	return func(ho *handlerOptions) {
+		ho.requireAuth = true
+	}
+}
+
+// RequireRoles requires the request to be authenticated and that the access
+// token has at least one of roles assigned. This is the equivalent of the
+// AllowedRoles option for protobuf service methods.
+func RequireRoles(roles ...string) HandlerOption {
+	return func(ho *handlerOptions) {
+		ho.requireAuth = true
+		ho.allowedRoles = append(ho.allowedRoles, roles...)
+	}
+}
+
+// Audit records each call of the handler in the audit log using r. The
+// action is the request path without the leading slash, like it is for
+// protobuf service methods.
+func Audit(r *audit.Recorder) HandlerOption {
+	return func(ho *handlerOptions) {
+		ho.recorder = r
+	}
+}
+
+// Unary returns a http.Handler that decodes a JSON request message, calls fn
+// and encodes the response as JSON.
+func Unary[Req, Res any](fn UnaryFunc[Req, Res], opts ...HandlerOption) http.Handler {
+	var options handlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteError(w, connect.NewError(connect.CodeUnimplemented, fmt.Errorf("method %s not allowed", r.Method)))
+
+			return
+		}
+
+		if err := checkAuth(ctx, options); err != nil {
+			WriteError(w, err)
+
+			return
+		}
+
+		req := new(Req)
+
+		blob, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			WriteError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to read request: %w", err)))
+
+			return
+		}
+
+		if len(blob) > 0 {
+			if err := json.Unmarshal(blob, req); err != nil {
+				WriteError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to decode request: %w", err)))
+
+				return
+			}
+		}
+
+		if err := authorize(ctx, r.URL.Path, req, options); err != nil {
+			WriteError(w, err)
+
+			return
+		}
+
+		if options.recorder != nil {
+			entry := new(audit.Entry)
+			ctx = audit.WithEntry(ctx, entry)
+
+			defer func() {
+				var clientIP string
+				if ip := server.RealIPFromContext(ctx); ip != nil {
+					clientIP = ip.String()
+				} else {
+					clientIP = r.RemoteAddr
+				}
+
+				options.recorder.Record(ctx, strings.TrimPrefix(r.URL.Path, "/"), entry, err, clientIP, r.UserAgent())
+			}()
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			log.L(ctx).Error("failed to handle request", "path", r.URL.Path, "error", err)
+
+			WriteError(w, err)
+
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, res)
+	})
+}
+
+// checkAuth ensures the request is authenticated if required.
+func checkAuth(ctx context.Context, options handlerOptions) error {
+	if options.requireAuth && middleware.ClaimsFromContext(ctx) == nil {
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("no access token provided"))
+	}
+
+	return nil
+}
+
+// authorize asks the authorizer attached to ctx to decide the call of
+// procedure and falls back to the required roles if it does not make a
+// decision.
+func authorize(ctx context.Context, procedure string, req any, options handlerOptions) error {
+	allowed, err := middleware.Authorize(ctx, middleware.AuthorizerFromContext(ctx), &middleware.AuthorizationRequest{
+		Procedure:    procedure,
+		Message:      req,
+		AllowedRoles: options.allowedRoles,
+	})
+	if err != nil || allowed {
+		return err
+	}
+
+	if len(options.allowedRoles) == 0 {
+		return nil
+	}
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims != nil && claims.AppMetadata != nil && claims.AppMetadata.Authorization != nil {
+		for _, role := range options.allowedRoles {
+			if slices.Contains(claims.AppMetadata.Authorization.Roles, role) {
+				return nil
+			}
+		}
+	}
+
+	return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("access token does not include one of the required roles"))
+}
+
+// WriteJSON writes body as JSON using the given HTTP status code.
+func WriteJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.L(context.Background()).Error("failed to encode response", "error", err)
+	}
+}
+
+// errorBody is the JSON representation of an error.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriteError writes err to w. If err is a *connect.Error the error code is
+// preserved, otherwise CodeUnknown is used.
+func WriteError(w http.ResponseWriter, err error) {
+	code := connect.CodeOf(err)
+
+	var (
+		cerr *connect.Error
+		msg  = err.Error()
+	)
+	if errors.As(err, &cerr) {
+		msg = cerr.Message()
+	}
+
+	WriteJSON(w, HTTPStatus(code), errorBody{
+		Code:    code.String(),
+		Message: msg,
+	})
+}
+
+// HTTPStatus returns the HTTP status code for a connect error code as defined
+// by the Connect protocol.
+func HTTPStatus(code connect.Code) int {
+	switch code {
+	case connect.CodeCanceled:
+		return 408
+	case connect.CodeUnknown:
+		return http.StatusInternalServerError
+	case connect.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case connect.CodeDeadlineExceeded:
+		return http.StatusRequestTimeout
+	case connect.CodeNotFound:
+		return http.StatusNotFound
+	case connect.CodeAlreadyExists:
+		return http.StatusConflict
+	case connect.CodePermissionDenied:
+		return http.StatusForbidden
+	case connect.CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case connect.CodeFailedPrecondition:
+		return http.StatusPreconditionFailed
+	case connect.CodeAborted:
+		return http.StatusConflict
+	case connect.CodeOutOfRange:
+		return http.StatusBadRequest
+	case connect.CodeUnimplemented:
+		return http.StatusNotFound
+	case connect.CodeInternal:
+		return http.StatusInternalServerError
+	case connect.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case connect.CodeDataLoss:
+		return http.StatusInternalServerError
+	case connect.CodeUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+)
+
+// jsonCodec is a connect.Codec that uses encoding/json for plain Go structs.
+// It replaces the default protojson codec for handlers and clients created by
+// this package so server-streaming endpoints can be built without protobuf
+// message definitions.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(msg any) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(blob []byte, msg any) error {
+	if len(blob) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(blob, msg)
+}
+
+// ServerStreamFunc handles a server-streaming request.
+type ServerStreamFunc[Req, Res any] func(ctx context.Context, req *connect.Request[Req], stream *connect.ServerStream[Res]) error
+
+// ServerStream returns a http.Handler that serves procedure as a Connect
+// server-streaming endpoint using JSON encoded messages. Clients must use the
+// "json" codec, see NewServerStreamClient.
+func ServerStream[Req, Res any](procedure string, fn ServerStreamFunc[Req, Res], opts ...HandlerOption) http.Handler {
+	var options handlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return connect.NewServerStreamHandler(
+		procedure,
+		func(ctx context.Context, req *connect.Request[Req], stream *connect.ServerStream[Res]) error {
+			if err := checkAuth(ctx, options); err != nil {
+				return err
+			}
+
+			if err := authorize(ctx, procedure, req.Msg, options); err != nil {
+				return err
+			}
+
+			return fn(ctx, req, stream)
+		},
+		connect.WithCodec(jsonCodec{}),
+	)
+}
+
+// NewServerStreamClient returns a connect client for a server-streaming
+// endpoint created by ServerStream.
+func NewServerStreamClient[Req, Res any](httpClient connect.HTTPClient, baseURL string, procedure string) *connect.Client[Req, Res] {
+	return connect.NewClient[Req, Res](
+		httpClient,
+		strings.TrimSuffix(baseURL, "/")+procedure,
+		connect.WithCodec(jsonCodec{}),
+	)
+}
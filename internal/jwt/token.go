@@ -35,7 +35,8 @@ var supportedMethods = map[string]struct{}{
 // Authorization contains app related authorization and permission
 // settings.
 type Authorization struct {
-	Roles []string `json:"roles,omitempty" xml:"roles" yaml:"roles,omitempty"`
+	Roles  []string `json:"roles,omitempty" xml:"roles" yaml:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty" xml:"groups" yaml:"groups,omitempty"`
 }
 
 type LoginKind string
@@ -46,6 +47,10 @@ const (
 	LoginKindMFA      LoginKind = "mfa"
 	LoginKindWebauthn LoginKind = "webauthn"
 	LoginKindAPI      LoginKind = "api"
+
+	// LoginKindAdmin is used for requests received on the admin listener
+	// which do not carry an access token.
+	LoginKindAdmin LoginKind = "admin"
 )
 
 // AppMetadata defines app specific metadata attached to
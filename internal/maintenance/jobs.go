@@ -0,0 +1,122 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// Names of the built-in maintenance jobs.
+const (
+	JobTokenInvalidations = "token-invalidations"
+	JobRegistrationTokens = "registration-tokens"
+	JobAPITokens          = "api-tokens"
+	JobDeletedUsers       = "deleted-users"
+	JobRoleAssignments    = "role-assignments"
+)
+
+// RunFunc executes a job and returns the number of removed records.
+type RunFunc func(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error)
+
+// Job is a maintenance job.
+type Job struct {
+	Name        string
+	Description string
+
+	// Interval is the default interval between two runs of the job.
+	Interval time.Duration
+
+	Run RunFunc
+}
+
+// builtinJobs returns all built-in jobs. userRetention is the duration
+// after which deleted users are purged, zero disables the job.
+func builtinJobs(userRetention time.Duration, roleAssignments *roleAssignmentJob) []Job {
+	return []Job{
+		{
+			Name:        JobTokenInvalidations,
+			Description: "Remove revoked access and refresh tokens that have expired",
+			Interval:    time.Hour,
+			Run: func(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error) {
+				return ds.DeleteExpiredTokens(ctx, now)
+			},
+		},
+		{
+			Name:        JobRegistrationTokens,
+			Description: "Remove expired registration tokens",
+			Interval:    time.Hour,
+			Run: func(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error) {
+				return ds.DeleteExpiredRegistrationTokens(ctx, nullTime(now))
+			},
+		},
+		{
+			Name:        JobAPITokens,
+			Description: "Remove expired API tokens",
+			Interval:    time.Hour,
+			Run:         purgeAPITokens,
+		},
+		{
+			Name:        JobDeletedUsers,
+			Description: "Purge users that have been deleted for longer than the configured retention",
+			Interval:    24 * time.Hour,
+			Run: func(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error) {
+				if userRetention == 0 {
+					return 0, fmt.Errorf("deleted_user_retention is not configured")
+				}
+
+				return purgeDeletedUsers(ctx, ds, now.Add(-userRetention))
+			},
+		},
+		{
+			Name:        JobRoleAssignments,
+			Description: "Remove expired role assignments and notify users before their assignments expire",
+			Interval:    15 * time.Minute,
+			Run:         roleAssignments.run,
+		},
+	}
+}
+
+func purgeAPITokens(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error) {
+	return repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (int64, error) {
+		if err := tx.DeleteExpiredAPITokenRoles(ctx, nullTime(now)); err != nil {
+			return 0, fmt.Errorf("failed to delete roles of expired tokens: %w", err)
+		}
+
+		return tx.DeleteExpiredAPITokens(ctx, nullTime(now))
+	})
+}
+
+// purgeDeletedUsers removes all users that have been deleted before
+// deletedBefore. Each user is removed in its own transaction so the database
+// is not locked for too long.
+func purgeDeletedUsers(ctx context.Context, ds *repo.Queries, deletedBefore time.Time) (int64, error) {
+	ids, err := ds.GetPurgeableUsers(ctx, nullTime(deletedBefore))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+
+	var count int64
+	for _, id := range ids {
+		_, err := repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (any, error) {
+			if err := tx.EraseUserData(ctx, id); err != nil {
+				return nil, err
+			}
+
+			return tx.HardDeleteUser(ctx, id)
+		})
+		if err != nil {
+			return count, fmt.Errorf("user %q: %w", id, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,236 @@
+package maintenance_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/maintenance"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func setup(t *testing.T) (*sql.DB, *repo.Queries) {
+	t.Helper()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(context.Background(), db)
+	require.NoError(t, err)
+
+	return db, repo.New(db)
+}
+
+func newScheduler(t *testing.T, ds *repo.Queries, cfg *config.Maintenance) *maintenance.Scheduler {
+	t.Helper()
+
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	s, err := maintenance.NewScheduler(ds, cfg)
+	require.NoError(t, err)
+
+	return s
+}
+
+func Test_NewScheduler_UnknownJob(t *testing.T) {
+	_, ds := setup(t)
+
+	cfg := &config.Maintenance{
+		Jobs: []*config.MaintenanceJob{{Name: "does-not-exist"}},
+	}
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	_, err := maintenance.NewScheduler(ds, cfg)
+	assert.ErrorIs(t, err, maintenance.ErrUnknownJob)
+}
+
+func Test_Trigger_ExpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	_, ds := setup(t)
+
+	past := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	future := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+	require.NoError(t, ds.CreateRegistrationToken(ctx, repo.CreateRegistrationTokenParams{Token: "expired", Expires: past, CreatedAt: time.Now()}))
+	require.NoError(t, ds.CreateRegistrationToken(ctx, repo.CreateRegistrationTokenParams{Token: "valid", Expires: future, CreatedAt: time.Now()}))
+	require.NoError(t, ds.CreateRegistrationToken(ctx, repo.CreateRegistrationTokenParams{Token: "forever", CreatedAt: time.Now()}))
+
+	_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	require.NoError(t, ds.CreateAPIToken(ctx, repo.CreateAPITokenParams{ID: "t1", Token: "t1", Name: "expired", UserID: "alice", ExpiresAt: past}))
+	require.NoError(t, ds.CreateAPIToken(ctx, repo.CreateAPITokenParams{ID: "t2", Token: "t2", Name: "valid", UserID: "alice", ExpiresAt: future}))
+
+	s := newScheduler(t, ds, &config.Maintenance{})
+
+	res, err := s.Trigger(ctx, maintenance.JobRegistrationTokens)
+	require.NoError(t, err)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, int64(1), res.Affected)
+
+	res, err = s.Trigger(ctx, maintenance.JobAPITokens)
+	require.NoError(t, err)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, int64(1), res.Affected)
+
+	tokens, err := ds.GetAPITokensForUser(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "t2", tokens[0].ID)
+
+	_, err = s.Trigger(ctx, "does-not-exist")
+	assert.ErrorIs(t, err, maintenance.ErrUnknownJob)
+}
+
+func Test_Trigger_DeletedUsers(t *testing.T) {
+	ctx := context.Background()
+	db, ds := setup(t)
+
+	for _, id := range []string{"alice", "bob", "carol"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: id, Username: id})
+		require.NoError(t, err)
+
+		_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "mail-" + id, UserID: id, Address: id + "@example.com"})
+		require.NoError(t, err)
+	}
+
+	// alice has been deleted long ago, bob just now and carol is still
+	// active.
+	_, err := ds.DeleteUser(ctx, "alice")
+	require.NoError(t, err)
+	_, err = ds.DeleteUser(ctx, "bob")
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "UPDATE users SET deleted_at = datetime('now', '-2 days') WHERE id = 'alice'")
+	require.NoError(t, err)
+
+	// without a retention the job fails
+	s := newScheduler(t, ds, &config.Maintenance{})
+	res, err := s.Trigger(ctx, maintenance.JobDeletedUsers)
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.Error)
+
+	s = newScheduler(t, ds, &config.Maintenance{DeletedUserRetention: "24h"})
+	res, err = s.Trigger(ctx, maintenance.JobDeletedUsers)
+	require.NoError(t, err)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, int64(1), res.Affected)
+
+	_, err = ds.GetUserByID(ctx, "alice")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = ds.GetUserByID(ctx, "bob")
+	assert.NoError(t, err)
+
+	_, err = ds.GetUserByID(ctx, "carol")
+	assert.NoError(t, err)
+}
+
+func Test_Trigger_LeaseHeld(t *testing.T) {
+	ctx := context.Background()
+	_, ds := setup(t)
+
+	now := time.Now().UTC()
+
+	// another replica is currently running the job
+	rows, err := ds.AcquireMaintenanceLease(ctx, repo.AcquireMaintenanceLeaseParams{
+		Name:           maintenance.JobTokenInvalidations,
+		LeaseHolder:    "other-replica",
+		LeaseExpiresAt: sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+		Now:            sql.NullTime{Time: now, Valid: true},
+		LastRunBefore:  sql.NullTime{Time: now, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rows)
+
+	s := newScheduler(t, ds, &config.Maintenance{})
+
+	_, err = s.Trigger(ctx, maintenance.JobTokenInvalidations)
+	assert.ErrorIs(t, err, maintenance.ErrLeaseHeld)
+
+	// once the other replica finished the job can be triggered again
+	_, err = ds.FinishMaintenanceRun(ctx, repo.FinishMaintenanceRunParams{
+		LastRunAt:   sql.NullTime{Time: now, Valid: true},
+		Name:        maintenance.JobTokenInvalidations,
+		LeaseHolder: "other-replica",
+	})
+	require.NoError(t, err)
+
+	_, err = s.Trigger(ctx, maintenance.JobTokenInvalidations)
+	assert.NoError(t, err)
+
+	// the other replica must not run it again within its interval
+	rows, err = ds.AcquireMaintenanceLease(ctx, repo.AcquireMaintenanceLeaseParams{
+		Name:           maintenance.JobTokenInvalidations,
+		LeaseHolder:    "other-replica",
+		LeaseExpiresAt: sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+		Now:            sql.NullTime{Time: now, Valid: true},
+		LastRunBefore:  sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rows)
+}
+
+type notifierFunc func(ctx context.Context, assignment repo.RoleAssignment) error
+
+func (fn notifierFunc) NotifyRoleExpiry(ctx context.Context, assignment repo.RoleAssignment) error {
+	return fn(ctx, assignment)
+}
+
+func Test_Trigger_RoleAssignments(t *testing.T) {
+	ctx := context.Background()
+	_, ds := setup(t)
+
+	_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	for _, id := range []string{"employee", "expired", "expiring", "later"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: id, Name: id})
+		require.NoError(t, err)
+	}
+
+	now := time.Now().UTC()
+	for _, p := range []repo.UpsertRoleAssignmentParams{
+		{UserID: "alice", RoleID: "employee"},
+		{UserID: "alice", RoleID: "expired", ValidUntil: sql.NullTime{Time: now.Add(-time.Minute), Valid: true}},
+		{UserID: "alice", RoleID: "expiring", ValidUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+		{UserID: "alice", RoleID: "later", ValidUntil: sql.NullTime{Time: now.Add(30 * 24 * time.Hour), Valid: true}},
+	} {
+		require.NoError(t, ds.UpsertRoleAssignment(ctx, p))
+	}
+
+	var notified []string
+	notifier := notifierFunc(func(ctx context.Context, assignment repo.RoleAssignment) error {
+		notified = append(notified, assignment.RoleID)
+		return nil
+	})
+
+	cfg := &config.Maintenance{RoleExpiryNotice: "24h"}
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	s, err := maintenance.NewScheduler(ds, cfg, maintenance.WithRoleExpiryNotifier(notifier))
+	require.NoError(t, err)
+
+	res, err := s.Trigger(ctx, maintenance.JobRoleAssignments)
+	require.NoError(t, err)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, int64(1), res.Affected)
+	assert.Equal(t, []string{"expiring"}, notified)
+
+	assignments, err := ds.GetRoleAssignmentsForUser(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, assignments, 3)
+
+	// users are only notified once
+	res, err = s.Trigger(ctx, maintenance.JobRoleAssignments)
+	require.NoError(t, err)
+	assert.Empty(t, res.Error)
+	assert.Equal(t, int64(0), res.Affected)
+	assert.Equal(t, []string{"expiring"}, notified)
+}
@@ -0,0 +1,51 @@
+package maintenance
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cisidm",
+		Subsystem: "maintenance",
+		Name:      "job_runs_total",
+		Help:      "Number of maintenance job runs on this replica by result.",
+	}, []string{"job", "result"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cisidm",
+		Subsystem: "maintenance",
+		Name:      "job_duration_seconds",
+		Help:      "Duration of maintenance job runs on this replica.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"job"})
+
+	jobAffected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cisidm",
+		Subsystem: "maintenance",
+		Name:      "job_affected_records_total",
+		Help:      "Number of records removed by maintenance jobs on this replica.",
+	}, []string{"job"})
+
+	jobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cisidm",
+		Subsystem: "maintenance",
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful run of a maintenance job on this replica.",
+	}, []string{"job"})
+)
+
+func init() {
+	prometheus.MustRegister(jobRuns, jobDuration, jobAffected, jobLastSuccess)
+}
+
+func observe(res Result) {
+	result := "success"
+	if res.Error != "" {
+		result = "failure"
+	} else {
+		jobLastSuccess.WithLabelValues(res.Job).SetToCurrentTime()
+	}
+
+	jobRuns.WithLabelValues(res.Job, result).Inc()
+	jobDuration.WithLabelValues(res.Job).Observe(res.Duration.Seconds())
+	jobAffected.WithLabelValues(res.Job).Add(float64(res.Affected))
+}
@@ -0,0 +1,163 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/mailer"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/tmpl"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+// RoleExpiryNotifier informs users about role assignments that are about to
+// expire.
+type RoleExpiryNotifier interface {
+	NotifyRoleExpiry(ctx context.Context, assignment repo.RoleAssignment) error
+}
+
+// roleAssignmentJob removes expired role assignments and notifies users
+// before their assignments expire.
+type roleAssignmentJob struct {
+	changes  *changes.Feed
+	webhooks *webhook.Dispatcher
+	notifier RoleExpiryNotifier
+	notice   time.Duration
+}
+
+func (j *roleAssignmentJob) run(ctx context.Context, ds *repo.Queries, now time.Time) (int64, error) {
+	merr := new(multierror.Error)
+
+	if j.notifier != nil && j.notice > 0 {
+		if err := j.notifyExpiring(ctx, ds, now); err != nil {
+			merr.Errors = append(merr.Errors, err)
+		}
+	}
+
+	removed, err := ds.DeleteExpiredRoleAssignments(ctx, nullTime(now))
+	if err != nil {
+		merr.Errors = append(merr.Errors, fmt.Errorf("failed to delete expired role assignments: %w", err))
+
+		return 0, merr.ErrorOrNil()
+	}
+
+	for _, assignment := range removed {
+		// the role name is only informational, the role is always
+		// present as assignments are deleted together with their role.
+		role, _ := ds.GetRoleByID(ctx, assignment.RoleID)
+
+		j.webhooks.Emit(ctx, webhook.RoleUnassigned, webhook.RoleAssignmentData{
+			RoleID:   assignment.RoleID,
+			RoleName: role.Name,
+			UserIDs:  []string{assignment.UserID},
+		})
+
+		j.changes.Publish(ctx, changes.RoleUnassigned, assignment.UserID, assignment.RoleID, changes.RoleData{Name: role.Name})
+	}
+
+	return int64(len(removed)), merr.ErrorOrNil()
+}
+
+// notifyExpiring notifies users about assignments that expire within the
+// notice period. Each assignment is only notified once unless it is
+// re-assigned.
+func (j *roleAssignmentJob) notifyExpiring(ctx context.Context, ds *repo.Queries, now time.Time) error {
+	expiring, err := ds.GetExpiringRoleAssignments(ctx, repo.GetExpiringRoleAssignmentsParams{
+		Now:          nullTime(now),
+		NoticeBefore: nullTime(now.Add(j.notice)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get expiring role assignments: %w", err)
+	}
+
+	merr := new(multierror.Error)
+	for _, assignment := range expiring {
+		if err := j.notifier.NotifyRoleExpiry(ctx, assignment); err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("user %q, role %q: %w", assignment.UserID, assignment.RoleID, err))
+			continue
+		}
+
+		if err := ds.MarkRoleAssignmentExpiryNotified(ctx, repo.MarkRoleAssignmentExpiryNotifiedParams{
+			UserID: assignment.UserID,
+			RoleID: assignment.RoleID,
+		}); err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("user %q, role %q: %w", assignment.UserID, assignment.RoleID, err))
+		}
+	}
+
+	return merr.ErrorOrNil()
+}
+
+// MailNotifier sends role expiry notices to the primary mail address of the
+// affected user.
+type MailNotifier struct {
+	Config    config.Config
+	Templates *tmpl.Engine
+	Mailer    mailer.Mailer
+	Datastore *repo.Queries
+
+	// NotifyAdmins sends a blind copy of each notice to all users with the
+	// idm_superuser role.
+	NotifyAdmins bool
+}
+
+// NotifyRoleExpiry implements RoleExpiryNotifier.
+func (n *MailNotifier) NotifyRoleExpiry(ctx context.Context, assignment repo.RoleAssignment) error {
+	user, err := n.Datastore.GetUserByID(ctx, assignment.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	role, err := n.Datastore.GetRoleByID(ctx, assignment.RoleID)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	msg := mailer.Message{
+		From: n.Config.MailConfig.From,
+	}
+
+	mail, err := n.Datastore.GetPrimaryEmailForUserByID(ctx, user.ID)
+	switch {
+	case err == nil:
+		msg.To = []string{mail.Address}
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to get primary mail address: %w", err)
+	}
+
+	if n.NotifyAdmins {
+		admins, err := n.Datastore.GetUsersByRole(ctx, "idm_superuser")
+		if err != nil {
+			return fmt.Errorf("failed to get administrators: %w", err)
+		}
+
+		for _, admin := range admins {
+			mail, err := n.Datastore.GetPrimaryEmailForUserByID(ctx, admin.ID)
+			if err != nil {
+				continue
+			}
+
+			msg.Bcc = append(msg.Bcc, mail.Address)
+		}
+	}
+
+	// nobody to notify
+	if len(msg.To) == 0 && len(msg.Bcc) == 0 {
+		return nil
+	}
+
+	common.EnsureDisplayName(&user)
+
+	return mailer.SendTemplate(ctx, n.Config, n.Templates, n.Mailer, msg, tmpl.RoleExpiryNotice, &tmpl.RoleExpiryNoticeCtx{
+		User:       user,
+		Role:       role,
+		ValidUntil: assignment.ValidUntil.Time.UTC(),
+	})
+}
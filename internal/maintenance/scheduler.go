@@ -0,0 +1,262 @@
+// Package maintenance runs background jobs that remove expired data like
+// revoked tokens, expired registration and API tokens, expired role
+// assignments and users that have been deleted for longer than the
+// configured retention.
+//
+// Jobs take a lease in the database before they are executed so only one
+// replica runs a job at a time even if multiple replicas share the same
+// database. The lease also records the last run so a job runs at most once
+// per interval across all replicas.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+// checkInterval defines how often the scheduler checks for due jobs.
+const checkInterval = time.Minute
+
+var (
+	// ErrUnknownJob is returned by Trigger if the job does not exist.
+	ErrUnknownJob = errors.New("unknown maintenance job")
+
+	// ErrLeaseHeld is returned by Trigger if the job is currently running
+	// on this or another replica.
+	ErrLeaseHeld = errors.New("maintenance job is already running")
+)
+
+type scheduledJob struct {
+	Job
+
+	interval time.Duration
+	disabled bool
+}
+
+// Result describes a single run of a job.
+type Result struct {
+	Job      string
+	Affected int64
+	Duration time.Duration
+
+	// Error is set if the job failed.
+	Error string
+}
+
+// Scheduler runs maintenance jobs.
+type Scheduler struct {
+	datastore *repo.Queries
+	leaseTTL  time.Duration
+	holder    string
+	jobs      []scheduledJob
+
+	roleAssignments roleAssignmentJob
+}
+
+// Option configures optional dependencies of a Scheduler.
+type Option func(s *Scheduler)
+
+// WithChangeFeed publishes role.unassigned events for role assignments that
+// have been removed because they expired.
+func WithChangeFeed(feed *changes.Feed) Option {
+	return func(s *Scheduler) {
+		s.roleAssignments.changes = feed
+	}
+}
+
+// WithWebhooks emits role-unassigned webhook events for role assignments
+// that have been removed because they expired.
+func WithWebhooks(webhooks *webhook.Dispatcher) Option {
+	return func(s *Scheduler) {
+		s.roleAssignments.webhooks = webhooks
+	}
+}
+
+// WithRoleExpiryNotifier configures the notifier used to inform users about
+// expiring role assignments. Notifications are only sent if a notice period
+// is configured.
+func WithRoleExpiryNotifier(notifier RoleExpiryNotifier) Option {
+	return func(s *Scheduler) {
+		s.roleAssignments.notifier = notifier
+	}
+}
+
+// NewScheduler returns a new scheduler for all built-in jobs configured by
+// cfg.
+func NewScheduler(ds *repo.Queries, cfg *config.Maintenance, opts ...Option) (*Scheduler, error) {
+	holder, err := leaseHolder()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		datastore: ds,
+		leaseTTL:  cfg.LeaseTTL(),
+		holder:    holder,
+		roleAssignments: roleAssignmentJob{
+			notice: cfg.RoleExpiryNoticePeriod(),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	known := make(map[string]struct{})
+	for _, job := range builtinJobs(cfg.UserRetention(), &s.roleAssignments) {
+		known[job.Name] = struct{}{}
+
+		sj := scheduledJob{
+			Job:      job,
+			interval: job.Interval,
+		}
+
+		// purging deleted users must be enabled explicitly.
+		if job.Name == JobDeletedUsers && cfg.UserRetention() == 0 {
+			sj.disabled = true
+		}
+
+		if jc := cfg.Job(job.Name); jc != nil {
+			if d := jc.ScheduleInterval(); d > 0 {
+				sj.interval = d
+			}
+
+			if jc.Disabled {
+				sj.disabled = true
+			}
+		}
+
+		s.jobs = append(s.jobs, sj)
+	}
+
+	for _, jc := range cfg.Jobs {
+		if _, ok := known[jc.Name]; !ok {
+			return nil, fmt.Errorf("maintenance: job %q: %w", jc.Name, ErrUnknownJob)
+		}
+	}
+
+	return s, nil
+}
+
+// leaseHolder returns a unique identifier of this replica.
+func leaseHolder() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate lease holder id: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		return id.String(), nil
+	}
+
+	return hostname + "/" + id.String(), nil
+}
+
+// Run executes due jobs until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, job := range s.jobs {
+			if job.disabled {
+				continue
+			}
+
+			res, err := s.run(ctx, job, time.Now().Add(-job.interval))
+			switch {
+			case errors.Is(err, ErrLeaseHeld):
+				// not due or running on another replica.
+			case err != nil:
+				log.L(ctx).Error("failed to run maintenance job", "job", job.Name, "error", err)
+			case res.Error != "":
+				log.L(ctx).Error("maintenance job failed", "job", job.Name, "error", res.Error)
+			default:
+				log.L(ctx).Info("maintenance job finished", "job", job.Name, "affected", res.Affected, "duration", res.Duration)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Trigger runs the job name immediately unless it is currently running on
+// this or another replica.
+func (s *Scheduler) Trigger(ctx context.Context, name string) (Result, error) {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return s.run(ctx, job, time.Now().Add(time.Second))
+		}
+	}
+
+	return Result{}, ErrUnknownJob
+}
+
+// run executes job if the lease can be acquired and the job did not run
+// since lastRunBefore. Errors of the job itself are reported in the result.
+func (s *Scheduler) run(ctx context.Context, job scheduledJob, lastRunBefore time.Time) (Result, error) {
+	start := time.Now().UTC()
+
+	rows, err := s.datastore.AcquireMaintenanceLease(ctx, repo.AcquireMaintenanceLeaseParams{
+		Name:           job.Name,
+		LeaseHolder:    s.holder,
+		LeaseExpiresAt: nullTime(start.Add(s.leaseTTL)),
+		Now:            nullTime(start),
+		LastRunBefore:  nullTime(lastRunBefore),
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	if rows == 0 {
+		return Result{}, ErrLeaseHeld
+	}
+
+	affected, jobErr := job.Run(ctx, s.datastore, start)
+
+	res := Result{
+		Job:      job.Name,
+		Affected: affected,
+		Duration: time.Since(start),
+	}
+
+	if jobErr != nil {
+		res.Error = jobErr.Error()
+	}
+
+	observe(res)
+
+	// always release the lease, even if ctx has been cancelled in the
+	// meantime.
+	if _, err := s.datastore.FinishMaintenanceRun(context.WithoutCancel(ctx), repo.FinishMaintenanceRunParams{
+		LastRunAt:      nullTime(start),
+		LastDurationMs: res.Duration.Milliseconds(),
+		LastAffected:   res.Affected,
+		LastError:      res.Error,
+		Name:           job.Name,
+		LeaseHolder:    s.holder,
+	}); err != nil {
+		return res, fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,136 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+)
+
+const (
+	// ServiceName is the name of the maintenance service.
+	ServiceName = "cisidm.v1.MaintenanceService"
+
+	// ListJobsProcedure is the HTTP path of the ListJobs endpoint.
+	ListJobsProcedure = "/" + ServiceName + "/ListJobs"
+
+	// RunJobProcedure is the HTTP path of the RunJob endpoint.
+	RunJobProcedure = "/" + ServiceName + "/RunJob"
+)
+
+// JobStatus is the API representation of a maintenance job and its last
+// run.
+type JobStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Interval    string `json:"interval"`
+	Disabled    bool   `json:"disabled"`
+
+	// LeaseHolder is the replica that holds or held the lease of the job
+	// and LeaseExpireTime is set while the job is running.
+	LeaseHolder     string     `json:"leaseHolder,omitempty"`
+	LeaseExpireTime *time.Time `json:"leaseExpireTime,omitempty"`
+
+	LastRunTime    *time.Time `json:"lastRunTime,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastAffected   int64      `json:"lastAffected"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+type ListJobsRequest struct{}
+
+type ListJobsResponse struct {
+	Jobs []JobStatus `json:"jobs"`
+}
+
+type RunJobRequest struct {
+	Name string `json:"name"`
+}
+
+// RunJobResponse reports the result of a manually triggered job. If the
+// job failed, Error is set.
+type RunJobResponse struct {
+	Affected   int64  `json:"affected"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Service provides access to the maintenance scheduler.
+type Service struct {
+	scheduler *Scheduler
+}
+
+// NewService returns a new maintenance service.
+func NewService(s *Scheduler) *Service {
+	return &Service{
+		scheduler: s,
+	}
+}
+
+// ListJobs returns all maintenance jobs and the result of their last run.
+func (svc *Service) ListJobs(ctx context.Context, req *ListJobsRequest) (*ListJobsResponse, error) {
+	records, err := svc.scheduler.datastore.GetMaintenanceJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance jobs: %w", err)
+	}
+
+	res := &ListJobsResponse{
+		Jobs: make([]JobStatus, 0, len(svc.scheduler.jobs)),
+	}
+
+	for _, job := range svc.scheduler.jobs {
+		status := JobStatus{
+			Name:        job.Name,
+			Description: job.Description,
+			Interval:    job.interval.String(),
+			Disabled:    job.disabled,
+		}
+
+		for _, r := range records {
+			if r.Name != job.Name {
+				continue
+			}
+
+			status.LeaseHolder = r.LeaseHolder
+			status.LastDurationMs = r.LastDurationMs
+			status.LastAffected = r.LastAffected
+			status.LastError = r.LastError
+
+			if r.LeaseExpiresAt.Valid && r.LeaseExpiresAt.Time.After(time.Now()) {
+				status.LeaseExpireTime = &r.LeaseExpiresAt.Time
+			}
+
+			if r.LastRunAt.Valid {
+				status.LastRunTime = &r.LastRunAt.Time
+			}
+		}
+
+		res.Jobs = append(res.Jobs, status)
+	}
+
+	return res, nil
+}
+
+// RunJob runs a maintenance job immediately. Disabled jobs can be run as
+// well.
+func (svc *Service) RunJob(ctx context.Context, req *RunJobRequest) (*RunJobResponse, error) {
+	res, err := svc.scheduler.Trigger(ctx, req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownJob):
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("%w: %q", err, req.Name))
+		case errors.Is(err, ErrLeaseHeld):
+			return nil, connect.NewError(connect.CodeAborted, err)
+		default:
+			return nil, err
+		}
+	}
+
+	return &RunJobResponse{
+		Affected:   res.Affected,
+		DurationMs: res.Duration.Milliseconds(),
+		Error:      res.Error,
+	}, nil
+}
@@ -0,0 +1,188 @@
+// Package manifest implements declarative configuration of roles, service
+// accounts, role assignments and registration tokens.
+//
+// A manifest describes the desired state of those objects. Apply compares
+// it against the database, returns the required changes as a plan and
+// applies them in a single transaction. Applying the same manifest twice
+// results in an empty plan. Manifests are written in HCL or YAML and may be
+// split across multiple files.
+package manifest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Manifest describes the desired state of an instance.
+type Manifest struct {
+	Roles              []*Role              `json:"roles,omitempty" hcl:"role,block"`
+	ServiceAccounts    []*ServiceAccount    `json:"serviceAccounts,omitempty" hcl:"service_account,block"`
+	Users              []*User              `json:"users,omitempty" hcl:"user,block"`
+	RegistrationTokens []*RegistrationToken `json:"registrationTokens,omitempty" hcl:"registration_token,block"`
+}
+
+// Role describes a role together with its permissions and included roles.
+type Role struct {
+	ID              string   `json:"id" hcl:"id,label"`
+	Name            string   `json:"name" hcl:"name"`
+	Description     string   `json:"description,omitempty" hcl:"description,optional"`
+	DeleteProtected bool     `json:"deleteProtected,omitempty" hcl:"delete_protected,optional"`
+	Permissions     []string `json:"permissions,omitempty" hcl:"permissions,optional"`
+
+	// Includes holds the IDs of roles included by this role.
+	Includes []string `json:"includes,omitempty" hcl:"includes,optional"`
+}
+
+// ServiceAccount describes a non-human user account. Service accounts
+// cannot log in using a password, they authenticate using API tokens.
+type ServiceAccount struct {
+	Username    string `json:"username" hcl:"username,label"`
+	DisplayName string `json:"displayName,omitempty" hcl:"display_name,optional"`
+	Description string `json:"description,omitempty" hcl:"description,optional"`
+
+	// Roles holds the IDs of all roles directly assigned to the account.
+	Roles []string `json:"roles,omitempty" hcl:"roles,optional"`
+}
+
+// User describes the role assignments of an existing user.
+type User struct {
+	Username string `json:"username" hcl:"username,label"`
+
+	// Roles holds the IDs of all roles directly assigned to the user.
+	Roles []string `json:"roles,omitempty" hcl:"roles,optional"`
+}
+
+// RegistrationToken describes a token that allows users to sign up if
+// registration is set to "token".
+type RegistrationToken struct {
+	Token string `json:"token" hcl:"token,label"`
+
+	// AllowedUsage is the number of registrations allowed when the token
+	// is created. The remaining usage of existing tokens is not changed.
+	AllowedUsage int64 `json:"allowedUsage" hcl:"allowed_usage"`
+
+	// Expires is an optional RFC3339 timestamp.
+	Expires string `json:"expires,omitempty" hcl:"expires,optional"`
+
+	// InitialRoles holds the IDs of roles assigned to users that sign up
+	// using the token.
+	InitialRoles []string `json:"initialRoles,omitempty" hcl:"initial_roles,optional"`
+}
+
+func (t *RegistrationToken) expires() (time.Time, error) {
+	if t.Expires == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, t.Expires)
+}
+
+// Parse parses a manifest file. Files ending in .hcl are parsed as HCL,
+// everything else as YAML (which includes JSON).
+func Parse(filename string, content []byte) (*Manifest, error) {
+	m := new(Manifest)
+
+	if strings.EqualFold(filepath.Ext(filename), ".hcl") {
+		file, diags := hclparse.NewParser().ParseHCL(content, filename)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		if diags := gohcl.DecodeBody(file.Body, nil, m); diags.HasErrors() {
+			return nil, diags
+		}
+
+		return m, nil
+	}
+
+	if err := yaml.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return m, nil
+}
+
+// Merge combines multiple manifests into one.
+func Merge(manifests ...*Manifest) *Manifest {
+	result := new(Manifest)
+
+	for _, m := range manifests {
+		result.Roles = append(result.Roles, m.Roles...)
+		result.ServiceAccounts = append(result.ServiceAccounts, m.ServiceAccounts...)
+		result.Users = append(result.Users, m.Users...)
+		result.RegistrationTokens = append(result.RegistrationTokens, m.RegistrationTokens...)
+	}
+
+	return result
+}
+
+// Validate ensures that all objects are named and declared only once.
+// References to roles are checked when the manifest is applied.
+func (m *Manifest) Validate() error {
+	roles := make(map[string]struct{}, len(m.Roles))
+	for _, r := range m.Roles {
+		if r.ID == "" || r.Name == "" {
+			return fmt.Errorf("roles must have an id and a name")
+		}
+
+		if _, ok := roles[r.ID]; ok {
+			return fmt.Errorf("role %q declared multiple times", r.ID)
+		}
+
+		roles[r.ID] = struct{}{}
+	}
+
+	users := make(map[string]struct{}, len(m.ServiceAccounts)+len(m.Users))
+	for _, sa := range m.ServiceAccounts {
+		if sa.Username == "" {
+			return fmt.Errorf("service accounts must have a username")
+		}
+
+		if _, ok := users[sa.Username]; ok {
+			return fmt.Errorf("user %q declared multiple times", sa.Username)
+		}
+
+		users[sa.Username] = struct{}{}
+	}
+
+	for _, u := range m.Users {
+		if u.Username == "" {
+			return fmt.Errorf("users must have a username")
+		}
+
+		if _, ok := users[u.Username]; ok {
+			return fmt.Errorf("user %q declared multiple times", u.Username)
+		}
+
+		users[u.Username] = struct{}{}
+	}
+
+	tokens := make(map[string]struct{}, len(m.RegistrationTokens))
+	for _, t := range m.RegistrationTokens {
+		if t.Token == "" {
+			return fmt.Errorf("registration tokens must not be empty")
+		}
+
+		if _, ok := tokens[t.Token]; ok {
+			return fmt.Errorf("registration token declared multiple times")
+		}
+
+		if t.AllowedUsage < 1 {
+			return fmt.Errorf("registration token: allowed_usage must be at least 1")
+		}
+
+		if _, err := t.expires(); err != nil {
+			return fmt.Errorf("registration token: invalid expires: %w", err)
+		}
+
+		tokens[t.Token] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,839 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+// Change actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	// ActionSkip is used for objects that differ from the manifest but
+	// cannot be changed, like roles owned by the configuration file.
+	ActionSkip = "skip"
+)
+
+// Kinds of objects managed by a manifest.
+const (
+	KindRole              = "role"
+	KindServiceAccount    = "service_account"
+	KindRoleAssignment    = "role_assignment"
+	KindRegistrationToken = "registration_token"
+)
+
+// originSystem is the origin of roles that are defined in the configuration
+// file.
+const originSystem = "system"
+
+// Change describes a single change of a plan.
+type Change struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+
+	// Origin is set for roles and tells where the role is defined: "system"
+	// for roles of the configuration file and "api" for all others.
+	Origin  string   `json:"origin,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Options configures how a plan is built.
+type Options struct {
+	// Prune deletes roles, service accounts and direct role assignments of
+	// declared users that are not part of the manifest.
+	Prune bool
+
+	// DynamicRoles must be set if roles may be changed.
+	DynamicRoles bool
+
+	// Actor is the ID of the user that applies the manifest. It is recorded
+	// as the creator of registration tokens.
+	Actor string
+}
+
+// Plan holds the changes required to reach the state of a manifest.
+type Plan struct {
+	Changes []Change
+
+	steps  []func(ctx context.Context, tx *repo.Queries) error
+	events []func(ctx context.Context, p *app.Providers)
+}
+
+type planner struct {
+	ctx  context.Context
+	tx   *repo.Queries
+	m    *Manifest
+	opts Options
+	now  time.Time
+
+	// roles holds all live roles by ID.
+	roles map[string]repo.Role
+
+	// declared holds the IDs of all roles declared by the manifest.
+	declared map[string]*Role
+
+	plan *Plan
+}
+
+// NewPlan compares m against the database and returns the changes required
+// to reach the state described by m.
+func NewPlan(ctx context.Context, tx *repo.Queries, m *Manifest, opts Options) (*Plan, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &planner{
+		ctx:      ctx,
+		tx:       tx,
+		m:        m,
+		opts:     opts,
+		now:      time.Now().UTC(),
+		roles:    make(map[string]repo.Role),
+		declared: make(map[string]*Role, len(m.Roles)),
+		plan:     new(Plan),
+	}
+
+	roles, err := tx.GetRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	for _, r := range roles {
+		p.roles[r.ID] = r
+	}
+
+	for _, r := range m.Roles {
+		p.declared[r.ID] = r
+	}
+
+	for _, fn := range []func() error{
+		p.planRoles,
+		p.planServiceAccounts,
+		p.planUsers,
+		p.planRegistrationTokens,
+		p.pruneRoles,
+	} {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.plan, nil
+}
+
+// Apply applies all changes of the plan within tx.
+func (plan *Plan) Apply(ctx context.Context, tx *repo.Queries) error {
+	for _, step := range plan.steps {
+		if err := step(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Publish emits change feed and webhook events for all applied changes. It
+// must only be called after the transaction has been committed.
+func (plan *Plan) Publish(ctx context.Context, providers *app.Providers) {
+	for _, fn := range plan.events {
+		fn(ctx, providers)
+	}
+}
+
+func (p *planner) add(c Change, step func(ctx context.Context, tx *repo.Queries) error, event func(ctx context.Context, providers *app.Providers)) {
+	p.plan.Changes = append(p.plan.Changes, c)
+
+	if step != nil {
+		p.plan.steps = append(p.plan.steps, step)
+	}
+
+	if event != nil {
+		p.plan.events = append(p.plan.events, event)
+	}
+}
+
+// checkRoles ensures that all role IDs exist or are created by the
+// manifest.
+func (p *planner) checkRoles(what string, ids []string) error {
+	for _, id := range ids {
+		if _, ok := p.roles[id]; ok {
+			continue
+		}
+
+		if _, ok := p.declared[id]; ok {
+			continue
+		}
+
+		return fmt.Errorf("%s: unknown role %q", what, id)
+	}
+
+	return nil
+}
+
+func (p *planner) checkDynamicRoles() error {
+	if !p.opts.DynamicRoles {
+		return fmt.Errorf("dynamic role configuration is not enabled")
+	}
+
+	return nil
+}
+
+func (p *planner) planRoles() error {
+	var inclusions []func(ctx context.Context, tx *repo.Queries) error
+
+	for _, r := range p.m.Roles {
+		if err := p.checkRoles(fmt.Sprintf("role %q: includes", r.ID), r.Includes); err != nil {
+			return err
+		}
+
+		live, exists := p.roles[r.ID]
+		if !exists {
+			if err := p.checkDynamicRoles(); err != nil {
+				return err
+			}
+
+			p.planCreateRole(r, &inclusions)
+			continue
+		}
+
+		permissions, err := p.tx.GetRolePermissions(p.ctx, live.ID)
+		if err != nil {
+			return fmt.Errorf("role %q: failed to get permissions: %w", r.ID, err)
+		}
+
+		included, err := p.tx.GetIncludedRoles(p.ctx, live.ID)
+		if err != nil {
+			return fmt.Errorf("role %q: failed to get included roles: %w", r.ID, err)
+		}
+
+		includedIDs := make([]string, len(included))
+		for idx, i := range included {
+			includedIDs[idx] = i.ID
+		}
+
+		var details []string
+		if live.Name != r.Name {
+			details = append(details, fmt.Sprintf("name: %q -> %q", live.Name, r.Name))
+		}
+		if live.Description != r.Description {
+			details = append(details, fmt.Sprintf("description: %q -> %q", live.Description, r.Description))
+		}
+		if live.DeleteProtected != r.DeleteProtected {
+			details = append(details, fmt.Sprintf("delete_protected: %t -> %t", live.DeleteProtected, r.DeleteProtected))
+		}
+
+		addedPerms, removedPerms := diff(permissions, r.Permissions)
+		details = append(details, describe("permission", addedPerms, removedPerms)...)
+
+		addedIncludes, removedIncludes := diff(includedIDs, r.Includes)
+		details = append(details, describe("includes", addedIncludes, removedIncludes)...)
+
+		if len(details) == 0 {
+			continue
+		}
+
+		change := Change{
+			Action:  ActionUpdate,
+			Kind:    KindRole,
+			Name:    r.ID,
+			Origin:  live.Origin,
+			Details: details,
+		}
+
+		if live.Origin == originSystem {
+			change.Action = ActionSkip
+			change.Details = append(change.Details, "role is owned by the configuration file")
+			p.add(change, nil, nil)
+
+			continue
+		}
+
+		if err := p.checkDynamicRoles(); err != nil {
+			return err
+		}
+
+		p.add(change, func(ctx context.Context, tx *repo.Queries) error {
+			if _, err := tx.UpdateRole(ctx, repo.UpdateRoleParams{
+				ID:              r.ID,
+				Name:            r.Name,
+				Description:     r.Description,
+				DeleteProtected: r.DeleteProtected,
+			}); err != nil {
+				return fmt.Errorf("role %q: failed to update: %w", r.ID, err)
+			}
+
+			for _, perm := range removedPerms {
+				if _, err := tx.UnassignPermissionFromRole(ctx, repo.UnassignPermissionFromRoleParams{RoleID: r.ID, Permission: perm}); err != nil {
+					return fmt.Errorf("role %q: failed to remove permission %q: %w", r.ID, perm, err)
+				}
+			}
+
+			return assignPermissions(ctx, tx, r.ID, addedPerms)
+		}, func(ctx context.Context, providers *app.Providers) {
+			providers.Changes.Publish(ctx, changes.RoleUpdated, "", r.ID, changes.RoleData{Name: r.Name})
+		})
+
+		if len(addedIncludes) > 0 || len(removedIncludes) > 0 {
+			inclusions = append(inclusions, func(ctx context.Context, tx *repo.Queries) error {
+				for _, id := range removedIncludes {
+					if _, err := tx.RemoveRoleInclusion(ctx, repo.RemoveRoleInclusionParams{RoleID: r.ID, IncludedRoleID: id}); err != nil {
+						return fmt.Errorf("role %q: failed to remove included role %q: %w", r.ID, id, err)
+					}
+				}
+
+				return includeRoles(ctx, tx, r.ID, addedIncludes)
+			})
+		}
+	}
+
+	// inclusions are applied once all roles exist.
+	p.plan.steps = append(p.plan.steps, inclusions...)
+
+	return nil
+}
+
+func (p *planner) planCreateRole(r *Role, inclusions *[]func(ctx context.Context, tx *repo.Queries) error) {
+	details := describe("permission", r.Permissions, nil)
+	details = append(details, describe("includes", r.Includes, nil)...)
+
+	p.add(Change{
+		Action:  ActionCreate,
+		Kind:    KindRole,
+		Name:    r.ID,
+		Origin:  "api",
+		Details: details,
+	}, func(ctx context.Context, tx *repo.Queries) error {
+		if _, err := tx.CreateRole(ctx, repo.CreateRoleParams{
+			ID:              r.ID,
+			Name:            r.Name,
+			Description:     r.Description,
+			DeleteProtected: r.DeleteProtected,
+		}); err != nil {
+			return fmt.Errorf("role %q: failed to create: %w", r.ID, err)
+		}
+
+		return assignPermissions(ctx, tx, r.ID, r.Permissions)
+	}, func(ctx context.Context, providers *app.Providers) {
+		providers.Changes.Publish(ctx, changes.RoleCreated, "", r.ID, changes.RoleData{Name: r.Name})
+	})
+
+	if len(r.Includes) > 0 {
+		*inclusions = append(*inclusions, func(ctx context.Context, tx *repo.Queries) error {
+			return includeRoles(ctx, tx, r.ID, r.Includes)
+		})
+	}
+}
+
+func (p *planner) planServiceAccounts() error {
+	accounts, err := p.tx.GetServiceAccounts(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get service accounts: %w", err)
+	}
+
+	live := make(map[string]repo.GetServiceAccountsRow, len(accounts))
+	for _, sa := range accounts {
+		live[sa.Username] = sa
+	}
+
+	for _, sa := range p.m.ServiceAccounts {
+		if err := p.checkRoles(fmt.Sprintf("service account %q", sa.Username), sa.Roles); err != nil {
+			return err
+		}
+
+		existing, ok := live[sa.Username]
+		if !ok {
+			if err := p.planCreateServiceAccount(sa); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		var details []string
+		if existing.DisplayName != sa.DisplayName {
+			details = append(details, fmt.Sprintf("display_name: %q -> %q", existing.DisplayName, sa.DisplayName))
+		}
+		if existing.Description != sa.Description {
+			details = append(details, fmt.Sprintf("description: %q -> %q", existing.Description, sa.Description))
+		}
+
+		if len(details) > 0 {
+			var updated repo.User
+
+			p.add(Change{
+				Action:  ActionUpdate,
+				Kind:    KindServiceAccount,
+				Name:    sa.Username,
+				Details: details,
+			}, func(ctx context.Context, tx *repo.Queries) error {
+				user, err := tx.GetUserByID(ctx, existing.ID)
+				if err != nil {
+					return fmt.Errorf("service account %q: %w", sa.Username, err)
+				}
+
+				updated, err = tx.UpdateUser(ctx, repo.UpdateUserParams{
+					ID:          user.ID,
+					Username:    user.Username,
+					DisplayName: sa.DisplayName,
+					FirstName:   user.FirstName,
+					LastName:    user.LastName,
+					Extra:       user.Extra,
+					Avatar:      user.Avatar,
+					Birthday:    user.Birthday,
+				})
+				if err != nil {
+					return fmt.Errorf("service account %q: failed to update user: %w", sa.Username, err)
+				}
+
+				if _, err := tx.UpdateServiceAccount(ctx, repo.UpdateServiceAccountParams{
+					UserID:      user.ID,
+					Description: sa.Description,
+				}); err != nil {
+					return fmt.Errorf("service account %q: failed to update: %w", sa.Username, err)
+				}
+
+				return nil
+			}, func(ctx context.Context, providers *app.Providers) {
+				providers.EmitUserEvent(ctx, webhook.UserUpdated, updated)
+				providers.Changes.Publish(ctx, changes.UserUpdated, updated.ID, "", changes.UserData{Username: updated.Username})
+			})
+		}
+
+		if err := p.planAssignments(existing.ID, sa.Username, sa.Roles); err != nil {
+			return err
+		}
+	}
+
+	if !p.opts.Prune {
+		return nil
+	}
+
+	for _, existing := range accounts {
+		if slices.ContainsFunc(p.m.ServiceAccounts, func(sa *ServiceAccount) bool { return sa.Username == existing.Username }) {
+			continue
+		}
+
+		var deleted repo.User
+
+		p.add(Change{
+			Action: ActionDelete,
+			Kind:   KindServiceAccount,
+			Name:   existing.Username,
+		}, func(ctx context.Context, tx *repo.Queries) error {
+			var err error
+
+			deleted, err = tx.GetUserByID(ctx, existing.ID)
+			if err != nil {
+				return fmt.Errorf("service account %q: %w", existing.Username, err)
+			}
+
+			if _, err := tx.DeleteServiceAccount(ctx, existing.ID); err != nil {
+				return fmt.Errorf("service account %q: failed to delete: %w", existing.Username, err)
+			}
+
+			if _, err := tx.DeleteUser(ctx, existing.ID); err != nil {
+				return fmt.Errorf("service account %q: failed to delete user: %w", existing.Username, err)
+			}
+
+			return nil
+		}, func(ctx context.Context, providers *app.Providers) {
+			providers.EmitUserEvent(ctx, webhook.UserDeleted, deleted)
+			providers.Changes.Publish(ctx, changes.UserDeleted, deleted.ID, "", changes.UserData{Username: deleted.Username})
+		})
+	}
+
+	return nil
+}
+
+func (p *planner) planCreateServiceAccount(sa *ServiceAccount) error {
+	if _, err := p.tx.GetUserByName(p.ctx, sa.Username); err == nil {
+		return fmt.Errorf("service account %q: a user with this name already exists", sa.Username)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("service account %q: %w", sa.Username, err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	var created repo.User
+
+	p.add(Change{
+		Action: ActionCreate,
+		Kind:   KindServiceAccount,
+		Name:   sa.Username,
+	}, func(ctx context.Context, tx *repo.Queries) error {
+		var err error
+
+		// service accounts do not have a password and can only
+		// authenticate using API tokens.
+		created, err = tx.CreateUser(ctx, repo.CreateUserParams{
+			ID:          id.String(),
+			Username:    sa.Username,
+			DisplayName: sa.DisplayName,
+		})
+		if err != nil {
+			return fmt.Errorf("service account %q: failed to create user: %w", sa.Username, err)
+		}
+
+		if err := tx.CreateServiceAccount(ctx, repo.CreateServiceAccountParams{
+			UserID:      created.ID,
+			Description: sa.Description,
+			CreatedAt:   p.now,
+		}); err != nil {
+			return fmt.Errorf("service account %q: failed to create: %w", sa.Username, err)
+		}
+
+		return nil
+	}, func(ctx context.Context, providers *app.Providers) {
+		providers.EmitUserEvent(ctx, webhook.UserCreated, created)
+		providers.Changes.Publish(ctx, changes.UserCreated, created.ID, "", changes.UserData{Username: created.Username})
+	})
+
+	added, _ := diff(nil, sa.Roles)
+	p.addAssignments(id.String(), sa.Username, added, nil)
+
+	return nil
+}
+
+func (p *planner) planUsers() error {
+	for _, u := range p.m.Users {
+		if err := p.checkRoles(fmt.Sprintf("user %q", u.Username), u.Roles); err != nil {
+			return err
+		}
+
+		user, err := p.tx.GetUserByName(p.ctx, u.Username)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("user %q not found", u.Username)
+			}
+
+			return fmt.Errorf("user %q: %w", u.Username, err)
+		}
+
+		if err := p.planAssignments(user.ID, user.Username, u.Roles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planAssignments assigns all roles to the user that are not yet assigned.
+// When pruning, all other direct role assignments are removed.
+func (p *planner) planAssignments(userID, username string, roles []string) error {
+	assignments, err := p.tx.GetRoleAssignmentsForUser(p.ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user %q: failed to get role assignments: %w", username, err)
+	}
+
+	current := make([]string, len(assignments))
+	for idx, a := range assignments {
+		current[idx] = a.RoleID
+	}
+
+	added, removed := diff(current, roles)
+	if !p.opts.Prune {
+		removed = nil
+	}
+
+	p.addAssignments(userID, username, added, removed)
+
+	return nil
+}
+
+func (p *planner) addAssignments(userID, username string, added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	p.add(Change{
+		Action:  ActionUpdate,
+		Kind:    KindRoleAssignment,
+		Name:    username,
+		Details: describe("role", added, removed),
+	}, func(ctx context.Context, tx *repo.Queries) error {
+		for _, roleID := range added {
+			if err := tx.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: userID, RoleID: roleID}); err != nil {
+				return fmt.Errorf("user %q: failed to assign role %q: %w", username, roleID, err)
+			}
+		}
+
+		for _, roleID := range removed {
+			if _, err := tx.UnassignRoleFromUser(ctx, repo.UnassignRoleFromUserParams{UserID: userID, RoleID: roleID}); err != nil {
+				return fmt.Errorf("user %q: failed to unassign role %q: %w", username, roleID, err)
+			}
+		}
+
+		return nil
+	}, func(ctx context.Context, providers *app.Providers) {
+		for _, list := range []struct {
+			roles    []string
+			event    webhook.EventType
+			feedType changes.Type
+		}{
+			{added, webhook.RoleAssigned, changes.RoleAssigned},
+			{removed, webhook.RoleUnassigned, changes.RoleUnassigned},
+		} {
+			for _, roleID := range list.roles {
+				name := p.roleName(roleID)
+
+				providers.Webhooks.Emit(ctx, list.event, webhook.RoleAssignmentData{
+					RoleID:   roleID,
+					RoleName: name,
+					UserIDs:  []string{userID},
+				})
+				providers.Changes.Publish(ctx, list.feedType, userID, roleID, changes.RoleData{Name: name})
+			}
+		}
+	})
+}
+
+func (p *planner) roleName(id string) string {
+	if r, ok := p.declared[id]; ok {
+		return r.Name
+	}
+
+	return p.roles[id].Name
+}
+
+func (p *planner) planRegistrationTokens() error {
+	tokens, err := p.tx.GetRegistrationTokens(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get registration tokens: %w", err)
+	}
+
+	live := make(map[string]repo.RegistrationToken, len(tokens))
+	for _, t := range tokens {
+		live[t.Token] = t
+	}
+
+	for _, t := range p.m.RegistrationTokens {
+		name := maskToken(t.Token)
+
+		if err := p.checkRoles(fmt.Sprintf("registration token %q", name), t.InitialRoles); err != nil {
+			return err
+		}
+
+		// Validate already ensured that expires is valid.
+		expiresAt, _ := t.expires()
+
+		var expires sql.NullTime
+		if !expiresAt.IsZero() {
+			expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+		}
+
+		var initialRoles string
+		if len(t.InitialRoles) > 0 {
+			blob, err := json.Marshal(t.InitialRoles)
+			if err != nil {
+				return err
+			}
+
+			initialRoles = string(blob)
+		}
+
+		existing, ok := live[t.Token]
+		if !ok {
+			p.add(Change{
+				Action:  ActionCreate,
+				Kind:    KindRegistrationToken,
+				Name:    name,
+				Details: describe("initial role", t.InitialRoles, nil),
+			}, func(ctx context.Context, tx *repo.Queries) error {
+				if err := tx.CreateRegistrationToken(ctx, repo.CreateRegistrationTokenParams{
+					Token:        t.Token,
+					Expires:      expires,
+					AllowedUsage: sql.NullInt64{Int64: t.AllowedUsage, Valid: true},
+					InitialRoles: initialRoles,
+					CreatedBy:    p.opts.Actor,
+					CreatedAt:    p.now,
+				}); err != nil {
+					return fmt.Errorf("registration token %q: failed to create: %w", name, err)
+				}
+
+				return nil
+			}, nil)
+
+			continue
+		}
+
+		var current []string
+		if existing.InitialRoles != "" {
+			if err := json.Unmarshal([]byte(existing.InitialRoles), &current); err != nil {
+				return fmt.Errorf("registration token %q: invalid initial roles: %w", name, err)
+			}
+		}
+
+		var details []string
+		if existing.Expires.Valid != expires.Valid || (expires.Valid && !existing.Expires.Time.Equal(expires.Time)) {
+			details = append(details, fmt.Sprintf("expires: %s -> %s", formatExpires(existing.Expires), formatExpires(expires)))
+		}
+
+		added, removed := diff(current, t.InitialRoles)
+		details = append(details, describe("initial role", added, removed)...)
+
+		if len(details) == 0 {
+			continue
+		}
+
+		p.add(Change{
+			Action:  ActionUpdate,
+			Kind:    KindRegistrationToken,
+			Name:    name,
+			Details: details,
+		}, func(ctx context.Context, tx *repo.Queries) error {
+			if _, err := tx.UpdateRegistrationToken(ctx, repo.UpdateRegistrationTokenParams{
+				Token:        t.Token,
+				Expires:      expires,
+				InitialRoles: initialRoles,
+			}); err != nil {
+				return fmt.Errorf("registration token %q: failed to update: %w", name, err)
+			}
+
+			return nil
+		}, nil)
+	}
+
+	return nil
+}
+
+// pruneRoles deletes all roles that are not declared by the manifest.
+// Roles of the configuration file are never deleted.
+func (p *planner) pruneRoles() error {
+	if !p.opts.Prune {
+		return nil
+	}
+
+	ids := make([]string, 0, len(p.roles))
+	for id := range p.roles {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		role := p.roles[id]
+
+		if _, ok := p.declared[id]; ok || role.Origin == originSystem {
+			continue
+		}
+
+		change := Change{
+			Action: ActionDelete,
+			Kind:   KindRole,
+			Name:   role.ID,
+			Origin: role.Origin,
+		}
+
+		if role.DeleteProtected {
+			change.Action = ActionSkip
+			change.Details = []string{"role is delete protected"}
+			p.add(change, nil, nil)
+
+			continue
+		}
+
+		if err := p.checkDynamicRoles(); err != nil {
+			return err
+		}
+
+		p.add(change, func(ctx context.Context, tx *repo.Queries) error {
+			if _, err := tx.DeleteRole(ctx, role.ID); err != nil {
+				return fmt.Errorf("role %q: failed to delete: %w", role.ID, err)
+			}
+
+			return nil
+		}, func(ctx context.Context, providers *app.Providers) {
+			providers.Changes.Publish(ctx, changes.RoleDeleted, "", role.ID, changes.RoleData{Name: role.Name})
+		})
+	}
+
+	return nil
+}
+
+func assignPermissions(ctx context.Context, tx *repo.Queries, roleID string, permissions []string) error {
+	for _, perm := range permissions {
+		if err := tx.AssignPermissionToRole(ctx, repo.AssignPermissionToRoleParams{RoleID: roleID, Permission: perm}); err != nil {
+			return fmt.Errorf("role %q: failed to assign permission %q: %w", roleID, perm, err)
+		}
+	}
+
+	return nil
+}
+
+func includeRoles(ctx context.Context, tx *repo.Queries, roleID string, included []string) error {
+	for _, id := range included {
+		if err := tx.IncludeRole(ctx, roleID, id); err != nil {
+			return fmt.Errorf("role %q: failed to include role %q: %w", roleID, id, err)
+		}
+	}
+
+	return nil
+}
+
+// diff returns the values of desired missing in current and the values of
+// current missing in desired, both sorted and without duplicates.
+func diff(current, desired []string) (added, removed []string) {
+	for _, v := range desired {
+		if !slices.Contains(current, v) && !slices.Contains(added, v) {
+			added = append(added, v)
+		}
+	}
+
+	for _, v := range current {
+		if !slices.Contains(desired, v) && !slices.Contains(removed, v) {
+			removed = append(removed, v)
+		}
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+
+	return added, removed
+}
+
+func describe(what string, added, removed []string) []string {
+	details := make([]string, 0, len(added)+len(removed))
+
+	for _, v := range added {
+		details = append(details, fmt.Sprintf("+ %s %s", what, v))
+	}
+
+	for _, v := range removed {
+		details = append(details, fmt.Sprintf("- %s %s", what, v))
+	}
+
+	return details
+}
+
+// maskToken hides all but the first characters of a registration token.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+
+	return token[:4] + "****"
+}
+
+func formatExpires(t sql.NullTime) string {
+	if !t.Valid {
+		return "never"
+	}
+
+	return t.Time.UTC().Format(time.RFC3339)
+}
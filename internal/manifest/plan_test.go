@@ -0,0 +1,172 @@
+package manifest_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/manifest"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const testManifest = `
+role "vets" {
+	name        = "Vets"
+	permissions = ["calendar:read", "roster:read"]
+	includes    = ["staff"]
+}
+
+role "staff" {
+	name = "Staff"
+}
+
+role "idm_superuser" {
+	name = "Superuser"
+}
+
+service_account "scim-provisioner" {
+	display_name = "SCIM"
+	roles        = ["idm_superuser"]
+}
+
+user "alice" {
+	roles = ["vets"]
+}
+
+registration_token "welcome-2026" {
+	allowed_usage = 10
+	expires       = "2026-12-31T00:00:00Z"
+	initial_roles = ["staff"]
+}
+`
+
+func plan(t *testing.T, ds *repo.Queries, m *manifest.Manifest, prune bool) *manifest.Plan {
+	t.Helper()
+
+	p, err := manifest.NewPlan(context.Background(), ds, m, manifest.Options{Prune: prune, DynamicRoles: true})
+	require.NoError(t, err)
+
+	return p
+}
+
+func Test_Plan(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	_, err = ds.CreateSystemRole(ctx, repo.CreateSystemRoleParams{ID: "idm_superuser", Name: "idm_superuser"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "legacy", Name: "Legacy"})
+	require.NoError(t, err)
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "legacy"}))
+
+	m, err := manifest.Parse("test.hcl", []byte(testManifest))
+	require.NoError(t, err)
+
+	p := plan(t, ds, m, false)
+
+	var summary []string
+	for _, c := range p.Changes {
+		summary = append(summary, c.Action+" "+c.Kind+" "+c.Name)
+	}
+
+	assert.Equal(t, []string{
+		"create role vets",
+		"create role staff",
+		"skip role idm_superuser",
+		"create service_account scim-provisioner",
+		"update role_assignment scim-provisioner",
+		"update role_assignment alice",
+		"create registration_token welc****",
+	}, summary)
+	assert.Equal(t, "system", p.Changes[2].Origin)
+
+	require.NoError(t, p.Apply(ctx, ds))
+
+	// applying the same manifest again must not result in any changes
+	// except for the protected system role.
+	p = plan(t, ds, m, false)
+	require.Len(t, p.Changes, 1)
+	assert.Equal(t, manifest.ActionSkip, p.Changes[0].Action)
+
+	perms, err := ds.GetRolePermissions(ctx, "vets")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"calendar:read", "roster:read"}, perms)
+
+	effective, err := ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+
+	var roleIDs []string
+	for _, r := range effective {
+		roleIDs = append(roleIDs, r.ID)
+	}
+	assert.ElementsMatch(t, []string{"legacy", "vets", "staff"}, roleIDs)
+
+	// pruning removes the legacy role and its assignment but keeps the
+	// system role.
+	p = plan(t, ds, m, true)
+
+	summary = nil
+	for _, c := range p.Changes {
+		summary = append(summary, c.Action+" "+c.Kind+" "+c.Name)
+	}
+
+	assert.Equal(t, []string{
+		"skip role idm_superuser",
+		"update role_assignment alice",
+		"delete role legacy",
+	}, summary)
+
+	require.NoError(t, p.Apply(ctx, ds))
+
+	_, err = ds.GetRoleByID(ctx, "legacy")
+	assert.Error(t, err)
+
+	_, err = ds.GetRoleByID(ctx, "idm_superuser")
+	assert.NoError(t, err)
+
+	// removing the service account from the manifest deletes it when
+	// pruning.
+	m.ServiceAccounts = nil
+	p = plan(t, ds, m, true)
+	require.Len(t, p.Changes, 2)
+	assert.Equal(t, "delete service_account scim-provisioner", p.Changes[1].Action+" "+p.Changes[1].Kind+" "+p.Changes[1].Name)
+	require.NoError(t, p.Apply(ctx, ds))
+
+	accounts, err := ds.GetServiceAccounts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+}
+
+func Test_Parse_YAML(t *testing.T) {
+	m, err := manifest.Parse("roles.yaml", []byte(`
+roles:
+  - id: vets
+    name: Vets
+    permissions: ["calendar:read"]
+users:
+  - username: alice
+    roles: [vets]
+`))
+	require.NoError(t, err)
+	require.NoError(t, m.Validate())
+
+	require.Len(t, m.Roles, 1)
+	assert.Equal(t, []string{"calendar:read"}, m.Roles[0].Permissions)
+	assert.Equal(t, []string{"vets"}, m.Users[0].Roles)
+
+	assert.Error(t, manifest.Merge(m, m).Validate())
+}
@@ -0,0 +1,107 @@
+package manifest
+
+import (
+	"context"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// ServiceName is the name of the manifest service.
+	ServiceName = "cisidm.v1.ManifestService"
+
+	// ApplyProcedure is the HTTP path of the Apply endpoint.
+	ApplyProcedure = "/" + ServiceName + "/Apply"
+)
+
+// ApplyRequest is the request message for the Apply endpoint.
+type ApplyRequest struct {
+	Manifest Manifest `json:"manifest"`
+
+	// Prune deletes roles and service accounts that are not part of the
+	// manifest as well as undeclared role assignments of declared users.
+	Prune bool `json:"prune,omitempty"`
+
+	// DryRun only returns the plan without applying it.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ApplyResponse is the response message for the Apply endpoint.
+type ApplyResponse struct {
+	Changes []Change `json:"changes"`
+
+	// Applied is true if the changes have been applied.
+	Applied bool `json:"applied"`
+}
+
+type Service struct {
+	*app.Providers
+}
+
+func NewService(p *app.Providers) *Service {
+	return &Service{
+		Providers: p,
+	}
+}
+
+// Apply compares the manifest against the database and applies all
+// required changes in a single transaction unless DryRun is set.
+func (svc *Service) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	if err := req.Manifest.Validate(); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	opts := Options{
+		Prune:        req.Prune,
+		DynamicRoles: svc.Config.DynamicRolesEnabled(),
+	}
+
+	if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+		opts.Actor = claims.Subject
+	}
+
+	plan, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*Plan, error) {
+		plan, err := NewPlan(ctx, tx, &req.Manifest, opts)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+		}
+
+		if req.DryRun {
+			return plan, nil
+		}
+
+		if err := svc.Constraints.Enforce(ctx, tx, func() error {
+			return plan.Apply(ctx, tx)
+		}); err != nil {
+			return nil, err
+		}
+
+		if len(plan.Changes) > 0 {
+			audit.RecordChange(ctx, nil, plan.Changes)
+		}
+
+		return plan, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ApplyResponse{
+		Changes: plan.Changes,
+		Applied: !req.DryRun,
+	}
+
+	if res.Changes == nil {
+		res.Changes = []Change{}
+	}
+
+	if !req.DryRun {
+		plan.Publish(ctx, svc.Providers)
+	}
+
+	return res, nil
+}
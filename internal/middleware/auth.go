@@ -43,7 +43,101 @@ func TokenFromContext(ctx context.Context) string {
 	return token
 }
 
-func NewAuthInterceptor(registry *protoregistry.Files) connect.UnaryInterceptorFunc {
+// AuthorizationRequest describes the call of a service method that must be
+// authorized.
+type AuthorizationRequest struct {
+	// Procedure is the full procedure name like
+	// "/tkd.idm.v1.UserService/UpdateUser".
+	Procedure string
+
+	// Message is the request message.
+	Message any
+
+	// AllowedRoles holds the roles required by the method annotation.
+	AllowedRoles []string
+}
+
+// AuthorizationDecision is the result of an Authorizer.
+type AuthorizationDecision struct {
+	Allow bool
+
+	// Reason is returned to the caller if the request is denied.
+	Reason string
+}
+
+// Authorizer decides whether the caller may invoke a service method.
+type Authorizer interface {
+	// Authorize returns nil if it does not make a decision, in which case
+	// the roles required by the method annotation are checked instead.
+	// Authorize is called for authenticated and unauthenticated requests.
+	Authorize(ctx context.Context, req *AuthorizationRequest) (*AuthorizationDecision, error)
+}
+
+var authorizerContextKey = struct{ s string }{s: "authorizer-context-key"}
+
+// ContextWithAuthorizer returns a new context.Context with authorizer
+// attached. Handlers that are not protobuf service methods use
+// AuthorizerFromContext to apply the same authorization as the
+// interceptor returned by NewAuthInterceptor.
+func ContextWithAuthorizer(ctx context.Context, authorizer Authorizer) context.Context {
+	return context.WithValue(ctx, authorizerContextKey, authorizer)
+}
+
+// AuthorizerFromContext returns the Authorizer associated with ctx.
+func AuthorizerFromContext(ctx context.Context) Authorizer {
+	authorizer, _ := ctx.Value(authorizerContextKey).(Authorizer)
+	return authorizer
+}
+
+// NewAuthorizerMiddleware attaches authorizer to the context of all
+// requests served by next. If authorizer is nil, next is returned as is.
+func NewAuthorizerMiddleware(authorizer Authorizer, next http.Handler) http.Handler {
+	if authorizer == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(ContextWithAuthorizer(r.Context(), authorizer)))
+	})
+}
+
+// Authorize asks authorizer to decide req. It reports whether the request
+// has been allowed and returns a PermissionDenied error if it has been
+// denied. If authorizer is nil or does not make a decision, false and a nil
+// error are returned and the caller must check the required roles itself.
+func Authorize(ctx context.Context, authorizer Authorizer, req *AuthorizationRequest) (bool, error) {
+	if authorizer == nil {
+		return false, nil
+	}
+
+	decision, err := authorizer.Authorize(ctx, req)
+	if err != nil {
+		log.L(ctx).Error("failed to evaluate authorization policy, request will be denied", "procedure", req.Procedure, "error", err)
+
+		return false, connect.NewError(connect.CodePermissionDenied, errors.New("failed to evaluate authorization policy"))
+	}
+
+	if decision == nil {
+		return false, nil
+	}
+
+	if !decision.Allow {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "request denied by policy"
+		}
+
+		return false, connect.NewError(connect.CodePermissionDenied, errors.New(reason))
+	}
+
+	return true, nil
+}
+
+// NewAuthInterceptor returns an interceptor that enforces the authentication
+// requirements of service methods. If authorizer is not nil, it is asked to
+// decide every call and the AllowedRoles of the method annotation are only
+// used if the authorizer does not make a decision.
+func NewAuthInterceptor(registry *protoregistry.Files, authorizer Authorizer) connect.UnaryInterceptorFunc {
 	interceptor := func(next connect.UnaryFunc) connect.UnaryFunc {
 		return connect.UnaryFunc(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
 			parts := strings.Split(req.Spec().Procedure, "/")
@@ -54,18 +148,37 @@ func NewAuthInterceptor(registry *protoregistry.Files) connect.UnaryInterceptorF
 			}
 
 			l := log.L(ctx).With("method", methodDesc.FullName())
+			ctx = log.WithLogger(ctx, l)
 
 			claims := ClaimsFromContext(ctx)
 
-			opts, ok := proto.GetExtension(methodDesc.Options(), commonv1.E_Auth).(*commonv1.AuthDecorator)
+			opts, _ := proto.GetExtension(methodDesc.Options(), commonv1.E_Auth).(*commonv1.AuthDecorator)
 
-			if ok && opts != nil {
+			// authentication is always required, even if the authorizer
+			// would allow the request.
+			if opts.GetRequire() == commonv1.AuthRequirement_AUTH_REQ_REQUIRED && claims == nil {
+				return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("no access token provided"))
+			}
+
+			allowed, err := Authorize(ctx, authorizer, &AuthorizationRequest{
+				Procedure:    req.Spec().Procedure,
+				Message:      req.Any(),
+				AllowedRoles: opts.GetAllowedRoles(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if allowed {
+				l.Debug("request allowed by policy")
+
+				return next(ctx, req)
+			}
+
+			if opts != nil {
 				switch opts.Require {
 				case commonv1.AuthRequirement_AUTH_REQ_REQUIRED:
 					l.Debug("service method requires authentication")
-					if claims == nil {
-						return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("no access token provided"))
-					}
 
 					// make sure the user has at least one of the required roles assigned
 					if len(opts.AllowedRoles) > 0 {
@@ -92,8 +205,6 @@ func NewAuthInterceptor(registry *protoregistry.Files) connect.UnaryInterceptorF
 				l.Debug("no authentication requirement specified for service method")
 			}
 
-			ctx = log.WithLogger(ctx, l)
-
 			return next(ctx, req)
 		})
 	}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -25,7 +26,13 @@ var (
 
 const APITokenPrefix = "it."
 
-func AuthenticateRequest(cfg config.Config, ds *repo.Queries, req *http.Request) (*jwt.Claims, error) {
+// RejectionChecker reports whether a token has been rejected, for example
+// because the user logged out.
+type RejectionChecker interface {
+	IsTokenRejected(ctx context.Context, tokenID string) (bool, error)
+}
+
+func AuthenticateRequest(cfg config.Config, ds *repo.Queries, rejections RejectionChecker, req *http.Request) (*jwt.Claims, error) {
 	ctx := req.Context()
 
 	token := TokenFromContext(ctx)
@@ -50,7 +57,7 @@ func AuthenticateRequest(cfg config.Config, ds *repo.Queries, req *http.Request)
 			return nil, ErrTokenExpired
 		}
 
-		userRoles, err := ds.GetRolesForUser(ctx, res.User.ID)
+		userRoles, err := ds.GetEffectiveRolesForUser(ctx, res.User.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to query user roles: %w", err)
 		}
@@ -60,6 +67,16 @@ func AuthenticateRequest(cfg config.Config, ds *repo.Queries, req *http.Request)
 			roleIds[rIdx] = r.ID
 		}
 
+		userGroups, err := ds.GetEffectiveGroupsForUser(ctx, res.User.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user groups: %w", err)
+		}
+
+		groupIds := make([]string, len(userGroups))
+		for gIdx, g := range userGroups {
+			groupIds[gIdx] = g.ID
+		}
+
 		// construct claims for the user
 		claims := jwt.Claims{
 			ID:          res.UserApiToken.ID,
@@ -74,7 +91,8 @@ func AuthenticateRequest(cfg config.Config, ds *repo.Queries, req *http.Request)
 			AppMetadata: &jwt.AppMetadata{
 				TokenVersion: "1",
 				Authorization: &jwt.Authorization{
-					Roles: roleIds,
+					Roles:  roleIds,
+					Groups: groupIds,
 				},
 				LoginKind: jwt.LoginKindAPI,
 			},
@@ -105,14 +123,14 @@ func AuthenticateRequest(cfg config.Config, ds *repo.Queries, req *http.Request)
 		return nil, tokenErr
 	}
 
-	isRejected, err := ds.IsTokenRejected(ctx, claims.ID)
+	isRejected, err := rejections.IsTokenRejected(ctx, claims.ID)
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil, fmt.Errorf("failed to check if token has been rejected: %w", err)
 	}
 
 	if !isRejected && claims.AppMetadata != nil && claims.AppMetadata.ParentTokenID != "" {
-		isRejected, err = ds.IsTokenRejected(ctx, claims.AppMetadata.ParentTokenID)
+		isRejected, err = rejections.IsTokenRejected(ctx, claims.AppMetadata.ParentTokenID)
 
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("failed to check if parent token has been rejected: %w", err)
@@ -190,7 +208,7 @@ func NewJWTMiddleware(cfg config.Config, repo *repo.Queries, next http.Handler,
 		}
 
 		// try to authenticate the request
-		claims, err := AuthenticateRequest(cfg, repo, r)
+		claims, err := AuthenticateRequest(cfg, repo, repo, r)
 
 		if err != nil {
 			l.Error("failed to authenticate request", "error", err)
@@ -0,0 +1,142 @@
+package permission
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	// Separator separates the segments of a permission.
+	Separator = ":"
+
+	// Wildcard matches exactly one arbitrary permission segment.
+	Wildcard = "*"
+
+	// DenyPrefix marks a permission as denied. Denied permissions take
+	// precedence over any granted permission they match.
+	DenyPrefix = "!"
+)
+
+// IsDeny returns true if perm is a deny rule.
+func IsDeny(perm string) bool {
+	return strings.HasPrefix(perm, DenyPrefix)
+}
+
+// Matches reports whether the set of granted permissions, usually the
+// result of Resolver.Resolve, allows the required permission.
+//
+// A permission matches required if each of its segments is either equal
+// to the segment of required at the same position or the wildcard "*". A
+// permission also matches everything below it, so "idm:users" and
+// "idm:*" match "idm:users:read". If any deny rule (a permission prefixed
+// with "!") matches required, Matches returns false no matter what has been
+// granted.
+func Matches(granted []string, required string) bool {
+	if required == "" {
+		return false
+	}
+
+	req := strings.Split(required, Separator)
+
+	allowed := false
+	for _, g := range granted {
+		if g == "" {
+			continue
+		}
+
+		if IsDeny(g) {
+			if matchSegments(strings.Split(strings.TrimPrefix(g, DenyPrefix), Separator), req) {
+				return false
+			}
+
+			continue
+		}
+
+		if !allowed && matchSegments(strings.Split(g, Separator), req) {
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+// matchSegments reports whether pattern matches perm or one of its parents.
+func matchSegments(pattern, perm []string) bool {
+	if len(pattern) > len(perm) {
+		return false
+	}
+
+	for idx, p := range pattern {
+		if p != Wildcard && p != perm[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canonicalize returns a sorted set of grants and deny rules. Grants that
+// are denied or implied by another grant are removed, as are deny rules
+// implied by other deny rules.
+func canonicalize(grants, denies []string) []string {
+	grants = minimize(grants)
+	denies = minimize(denies)
+
+	split := make([][]string, len(denies))
+	for idx, d := range denies {
+		split[idx] = strings.Split(d, Separator)
+	}
+
+	result := make([]string, 0, len(grants)+len(denies))
+	for _, g := range grants {
+		segments := strings.Split(g, Separator)
+
+		denied := false
+		for _, d := range split {
+			if matchSegments(d, segments) {
+				denied = true
+				break
+			}
+		}
+
+		if !denied {
+			result = append(result, g)
+		}
+	}
+
+	for _, d := range denies {
+		result = append(result, DenyPrefix+d)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+// minimize removes duplicates and all permissions that are implied by
+// another permission of perms.
+func minimize(perms []string) []string {
+	perms = unique(perms)
+
+	split := make([][]string, len(perms))
+	for idx, p := range perms {
+		split[idx] = strings.Split(p, Separator)
+	}
+
+	result := make([]string, 0, len(perms))
+	for idx, p := range perms {
+		implied := false
+		for other := range perms {
+			if other != idx && matchSegments(split[other], split[idx]) {
+				implied = true
+				break
+			}
+		}
+
+		if !implied {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
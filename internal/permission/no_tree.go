@@ -1,15 +1,11 @@
 package permission
 
-import "slices"
-
+// NoTree resolves permissions without a permission tree. Wildcards are
+// kept as they are and only evaluated by Matches.
 type NoTree struct{}
 
-func (NoTree) Resolve(perms []string) ([]string, error) { 
-	set := make([]string, 0, len(perms))
-	copy(set, perms)
-
-	slices.Sort(set)
-	set = slices.Compact(set)
+func (NoTree) Resolve(perms []string) ([]string, error) {
+	grants, denies := split(perms)
 
-	return set, nil
+	return canonicalize(grants, denies), nil
 }
@@ -1,6 +1,14 @@
 package permission
 
+import (
+	"slices"
+	"strings"
+)
 
+// Resolver resolves the permissions assigned to a subject into a canonical
+// set that can be passed to Matches. Permissions prefixed with "!" are deny
+// rules and are kept in the result so they still apply to permissions that
+// are not known to the resolver.
 type Resolver interface {
 	Resolve([]string) ([]string, error)
 }
@@ -9,4 +17,33 @@ type Resolver interface {
 var (
 	_ Resolver = (*NoTree)(nil)
 	_ Resolver = (*Tree)(nil)
-)
\ No newline at end of file
+)
+
+// split separates perms into grants and deny rules. The deny prefix is
+// removed and empty permissions are ignored.
+func split(perms []string) (grants []string, denies []string) {
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+
+		if IsDeny(p) {
+			if d := strings.TrimPrefix(p, DenyPrefix); d != "" {
+				denies = append(denies, d)
+			}
+
+			continue
+		}
+
+		if p != "" {
+			grants = append(grants, p)
+		}
+	}
+
+	return grants, denies
+}
+
+func unique(perms []string) []string {
+	set := slices.Clone(perms)
+	slices.Sort(set)
+
+	return slices.Compact(set)
+}
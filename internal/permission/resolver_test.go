@@ -0,0 +1,106 @@
+package permission_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+)
+
+func Test_NoTree_Resolve(t *testing.T) {
+	cases := []struct {
+		name     string
+		perms    []string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			perms:    nil,
+			expected: []string{},
+		},
+		{
+			name:     "duplicates",
+			perms:    []string{"idm:users:read", "idm:roles:read", "idm:users:read", ""},
+			expected: []string{"idm:roles:read", "idm:users:read"},
+		},
+		{
+			name:     "redundant children",
+			perms:    []string{"idm:users", "idm:users:read", "idm:*:write", "idm:roles:write"},
+			expected: []string{"idm:*:write", "idm:users"},
+		},
+		{
+			name:     "denied",
+			perms:    []string{"idm:users:delete", "idm:users:read", "!idm:users:delete"},
+			expected: []string{"!idm:users:delete", "idm:users:read"},
+		},
+		{
+			name:     "partially denied",
+			perms:    []string{"idm:users", "!idm:users:delete"},
+			expected: []string{"!idm:users:delete", "idm:users"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			set, err := permission.NoTree{}.Resolve(c.perms)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, set)
+		})
+	}
+}
+
+func Test_Matches(t *testing.T) {
+	granted := []string{
+		"calendar:*:read",
+		"idm:users",
+		"!idm:users:delete",
+		"!*:admin",
+	}
+
+	cases := map[string]bool{
+		"idm:users":             true,
+		"idm:users:read":        true,
+		"idm:users:write:owner": true,
+		"idm:users:delete":      false,
+		"idm:users:delete:self": false,
+		"idm:roles:read":        false,
+		"idm":                   false,
+		"calendar:events:read":  true,
+		"calendar:events:write": false,
+		"calendar:admin":        false,
+		"idm:admin":             false,
+		"":                      false,
+	}
+
+	for required, expected := range cases {
+		assert.Equal(t, expected, permission.Matches(granted, required), required)
+	}
+
+	assert.False(t, permission.Matches(nil, "idm:users:read"))
+	assert.True(t, permission.Matches([]string{"*"}, "idm:users:read"))
+}
+
+func Test_Resolve_Matches(t *testing.T) {
+	perms := []string{"idm:users", "calendar:*", "!idm:users:delete"}
+
+	tree := permission.Tree{}
+	for _, p := range []string{"idm:users:read", "idm:users:write", "idm:users:delete"} {
+		tree.Insert(p)
+	}
+
+	for name, resolver := range map[string]permission.Resolver{
+		"tree":    tree,
+		"no-tree": permission.NoTree{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			set, err := resolver.Resolve(perms)
+			require.NoError(t, err)
+
+			assert.True(t, permission.Matches(set, "idm:users:read"))
+			assert.True(t, permission.Matches(set, "calendar:events"))
+			assert.False(t, permission.Matches(set, "idm:users:delete"))
+			assert.False(t, permission.Matches(set, "idm:roles:read"))
+		})
+	}
+}
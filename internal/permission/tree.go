@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"slices"
 	"strings"
 )
 
@@ -95,35 +94,42 @@ func (t Tree) insert(path []string) {
 	}
 }
 
+// Resolve expands perms using the tree. Permissions that point to a node
+// of the tree are replaced by all leaves below that node and wildcard
+// segments are replaced by all children at their level. Permissions that
+// are not part of the tree are returned as they are. Deny rules are removed
+// from the expanded grants and kept in the result.
 func (t Tree) Resolve(perms []string) ([]string, error) {
-	var set = make([]string, 0, len(perms))
+	grants, denies := split(perms)
 
-	for _, p := range perms {
-		split := strings.Split(p, ":")
-		res := t.collect("", split)
-		set = append(set, res...)
+	expanded := make([]string, 0, len(grants))
+	for _, p := range grants {
+		expanded = append(expanded, t.collect("", strings.Split(p, Separator))...)
 	}
 
-	// FIXME(ppacher): remove any prefixes if the full sub-set is already included.
-	// 				   i.e. remove "idm:users" from ["idm:users", "idm:users:read", "idm:users:write"]
-	slices.Sort(set)
-	set = slices.Compact(set)
-
-	return set, nil
+	return canonicalize(expanded, denies), nil
 }
 
 func (t Tree) collect(prefix string, p []string) []string {
 	if len(p) == 0 {
+		if t.IsFinalLeave() {
+			return []string{strings.TrimPrefix(prefix, Separator)}
+		}
+
 		result := make([]string, 0, len(t))
 
 		for k, child := range t {
-			next_prefix := prefix + ":" + k
+			result = append(result, child.collect(prefix+Separator+k, nil)...)
+		}
+
+		return result
+	}
 
-			if child.IsFinalLeave() {
-				result = append(result, strings.TrimPrefix(next_prefix, ":"))
-			} else {
-				result = append(result, child.collect(next_prefix, nil)...)
-			}
+	if p[0] == Wildcard && !t.IsFinalLeave() {
+		result := make([]string, 0, len(t))
+
+		for k, child := range t {
+			result = append(result, child.collect(prefix+Separator+k, p[1:])...)
 		}
 
 		return result
@@ -131,10 +137,10 @@ func (t Tree) collect(prefix string, p []string) []string {
 
 	children, ok := t[p[0]]
 	if !ok {
-		return []string{strings.TrimPrefix(prefix+":"+strings.Join(p, ":"), ":")}
+		return []string{strings.TrimPrefix(prefix+Separator+strings.Join(p, Separator), Separator)}
 	}
 
-	return children.collect(prefix+":"+p[0], p[1:])
+	return children.collect(prefix+Separator+p[0], p[1:])
 }
 
 // UnmarshalJSON implements the encoding/json.Unmarshaler interface and adds support
@@ -133,6 +133,72 @@ func Test_Resolve(t *testing.T) {
 	assert.Equal(t, expectedResult, set)
 }
 
+func Test_Resolve_WildcardsAndDenies(t *testing.T) {
+	tree := permission.Tree{
+		"idm": {
+			"users": {
+				"read":   {},
+				"write":  {},
+				"delete": {},
+			},
+			"roles": {
+				"read":  {},
+				"write": {},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		perms    []string
+		expected []string
+	}{
+		{
+			name:     "leaf",
+			perms:    []string{"idm:users:read"},
+			expected: []string{"idm:users:read"},
+		},
+		{
+			name:     "wildcard",
+			perms:    []string{"idm:*:read"},
+			expected: []string{"idm:roles:read", "idm:users:read"},
+		},
+		{
+			name:     "trailing wildcard",
+			perms:    []string{"idm:users:*"},
+			expected: []string{"idm:users:delete", "idm:users:read", "idm:users:write"},
+		},
+		{
+			name:     "unknown wildcard",
+			perms:    []string{"calendar:*:read", "calendar:events:read"},
+			expected: []string{"calendar:*:read"},
+		},
+		{
+			name:     "deny",
+			perms:    []string{"idm:users", "!idm:users:delete"},
+			expected: []string{"!idm:users:delete", "idm:users:read", "idm:users:write"},
+		},
+		{
+			name:     "deny wildcard",
+			perms:    []string{"idm", "!idm:*:write"},
+			expected: []string{"!idm:*:write", "idm:roles:read", "idm:users:delete", "idm:users:read"},
+		},
+		{
+			name:     "redundant denies",
+			perms:    []string{"idm:users:read", "!idm:users", "!idm:users:read", "!"},
+			expected: []string{"!idm:users"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			set, err := tree.Resolve(c.perms)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, set)
+		})
+	}
+}
+
 func getTree(t *testing.T, perm string) permission.Tree {
 	t.Helper()
 
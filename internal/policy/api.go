@@ -0,0 +1,279 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// PackageAPI is the package name for policies that authorize calls to the
+// cisidm API.
+const PackageAPI = "cisidm.api"
+
+// userServiceName is the service whose methods use the top-level "id" field
+// to reference a user.
+const userServiceName = "tkd.idm.v1.UserService"
+
+// APIInput defines the input for rego policies that authorize calls to
+// protobuf service methods and the JSON endpoints of the cisidm.v1
+// services.
+type APIInput struct {
+	// Procedure is the full procedure name like
+	// "/tkd.idm.v1.UserService/UpdateUser".
+	Procedure string `json:"procedure"`
+
+	// Service is the fully qualified service name like
+	// "tkd.idm.v1.UserService".
+	Service string `json:"service"`
+
+	// Method is the name of the method like "UpdateUser".
+	Method string `json:"method"`
+
+	// Request holds the request message encoded as JSON. Protobuf messages
+	// use the field names of the protobuf definition. Secrets like
+	// passwords are redacted.
+	Request any `json:"request"`
+
+	// Subject is the user performing the request. It is nil if the request
+	// is not authenticated.
+	Subject *SubjectInput `json:"subject"`
+
+	// Resources holds the IDs referenced by the request, keyed by the name
+	// of the top-level field (e.g. "user_id" or "role_ids").
+	Resources map[string][]string `json:"resources"`
+
+	// TargetUsers holds the users referenced by the request.
+	TargetUsers []*SubjectInput `json:"target_users"`
+
+	// AllowedRoles holds the roles required by the method annotation or the
+	// JSON endpoint.
+	AllowedRoles []string `json:"allowed_roles"`
+}
+
+// APIPolicyResult is the result expected from API authorization policies.
+type APIPolicyResult struct {
+	// Allow reports whether the request is permitted. If not set, the roles
+	// required by the method annotation are checked instead.
+	Allow *bool `mapstructure:"allow"`
+
+	// Deny rejects the request, even if Allow is set.
+	Deny bool `mapstructure:"deny"`
+
+	// Reason is returned to the caller if the request is denied.
+	Reason string `mapstructure:"reason"`
+}
+
+// SubjectResolver returns the policy input for a user.
+type SubjectResolver interface {
+	Subject(ctx context.Context, userID string, kind jwt.LoginKind, tokenID string) (*SubjectInput, error)
+}
+
+// APIAuthorizer implements middleware.Authorizer by evaluating a rego
+// query.
+type APIAuthorizer struct {
+	engine   *Engine
+	query    string
+	subjects SubjectResolver
+}
+
+var _ middleware.Authorizer = (*APIAuthorizer)(nil)
+
+// NewAPIAuthorizer returns an authorizer that evaluates query for each
+// request.
+func NewAPIAuthorizer(engine *Engine, query string, subjects SubjectResolver) *APIAuthorizer {
+	return &APIAuthorizer{
+		engine:   engine,
+		query:    query,
+		subjects: subjects,
+	}
+}
+
+// Authorize implements middleware.Authorizer.
+func (a *APIAuthorizer) Authorize(ctx context.Context, req *middleware.AuthorizationRequest) (*middleware.AuthorizationDecision, error) {
+	// the subject is only set for authenticated requests.
+	var subject *SubjectInput
+
+	if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+		var kind jwt.LoginKind
+		if claims.AppMetadata != nil {
+			kind = claims.AppMetadata.LoginKind
+		}
+
+		var err error
+		subject, err = a.subjects.Subject(ctx, claims.Subject, kind, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subject: %w", err)
+		}
+	}
+
+	input, err := NewAPIInput(ctx, req, subject, a.subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	var result APIPolicyResult
+	if err := a.engine.QueryOne(ctx, a.query, input, &result); err != nil {
+		if errors.Is(err, ErrNoResults) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	switch {
+	case result.Deny:
+		return &middleware.AuthorizationDecision{Allow: false, Reason: result.Reason}, nil
+	case result.Allow != nil:
+		return &middleware.AuthorizationDecision{Allow: *result.Allow, Reason: result.Reason}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// NewAPIInput prepares the policy input for req. Users referenced by the
+// request are resolved using subjects, users that cannot be resolved are
+// omitted from TargetUsers.
+func NewAPIInput(ctx context.Context, req *middleware.AuthorizationRequest, subject *SubjectInput, subjects SubjectResolver) (*APIInput, error) {
+	input := &APIInput{
+		Procedure:    req.Procedure,
+		Subject:      subject,
+		Resources:    make(map[string][]string),
+		TargetUsers:  []*SubjectInput{},
+		AllowedRoles: req.AllowedRoles,
+	}
+
+	if parts := strings.Split(strings.TrimPrefix(req.Procedure, "/"), "/"); len(parts) == 2 {
+		input.Service = parts[0]
+		input.Method = parts[1]
+	}
+
+	request, err := audit.Normalize(req.Message)
+	if err != nil {
+		return nil, err
+	}
+	input.Request = request
+
+	if msg, ok := req.Message.(proto.Message); ok {
+		collectProtoResources(msg, input.Resources)
+	} else if err := collectJSONResources(req.Message, input.Resources); err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	for _, key := range []string{"user_id", "user_ids", "userId", "userIds"} {
+		userIDs = append(userIDs, input.Resources[key]...)
+	}
+	if input.Service == userServiceName {
+		userIDs = append(userIDs, input.Resources["id"]...)
+	}
+
+	seen := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		target, err := subjects.Subject(ctx, id, jwt.LoginKindPassword, "")
+		if err != nil {
+			log.L(ctx).Debug("failed to resolve target user for policy input", "id", id, "error", err)
+			continue
+		}
+
+		input.TargetUsers = append(input.TargetUsers, target)
+	}
+
+	return input, nil
+}
+
+// isResourceField reports whether the field name references a resource by
+// ID.
+func isResourceField(name string) bool {
+	if name == "id" {
+		return true
+	}
+
+	for _, suffix := range []string{"_id", "_ids", "Id", "Ids"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectProtoResources adds the IDs referenced by top-level fields of msg
+// to resources.
+func collectProtoResources(msg proto.Message, resources map[string][]string) {
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return
+	}
+
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if fd.Kind() != protoreflect.StringKind || fd.IsMap() || !isResourceField(name) {
+			return true
+		}
+
+		if fd.IsList() {
+			list := v.List()
+			for idx := 0; idx < list.Len(); idx++ {
+				resources[name] = append(resources[name], list.Get(idx).String())
+			}
+		} else if v.String() != "" {
+			resources[name] = append(resources[name], v.String())
+		}
+
+		return true
+	})
+}
+
+// collectJSONResources adds the IDs referenced by top-level fields of the
+// JSON encoding of msg to resources. It is used for the request messages of
+// endpoints that are not protobuf service methods.
+func collectJSONResources(msg any, resources map[string][]string) error {
+	if msg == nil {
+		return nil
+	}
+
+	blob, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T: %w", msg, err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		// not a JSON object, there's nothing to collect.
+		return nil
+	}
+
+	for name, value := range fields {
+		if !isResourceField(name) {
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				resources[name] = append(resources[name], v)
+			}
+		case []any:
+			for _, elem := range v {
+				if id, ok := elem.(string); ok {
+					resources[name] = append(resources[name], id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package policy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/httpapi"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+type fakeSubjects map[string]*policy.SubjectInput
+
+func (f fakeSubjects) Subject(_ context.Context, userID string, _ jwt.LoginKind, _ string) (*policy.SubjectInput, error) {
+	if s, ok := f[userID]; ok {
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("user %q not found", userID)
+}
+
+const apiPolicy = `package cisidm.api
+
+import rego.v1
+
+is_superuser(user) if {
+	some role in user.roles
+	role.ID == "idm_superuser"
+}
+
+updates_user if input.procedure == "/tkd.idm.v1.UserService/UpdateUser"
+
+allow if {
+	updates_user
+	cisidm.permission_matches(input.subject.permissions, "idm:users:write")
+}
+
+deny if {
+	updates_user
+	not is_superuser(input.subject)
+
+	some target in input.target_users
+	is_superuser(target)
+}
+
+reason := "superusers may only be updated by superusers" if deny
+`
+
+func Test_APIAuthorizer(t *testing.T) {
+	engine, err := policy.NewEngine(context.TODO(), nil, policy.WithRawPolicy("api.rego", apiPolicy))
+	require.NoError(t, err)
+
+	subjects := fakeSubjects{
+		"editor": {ID: "editor", Permissions: []string{"idm:users:write"}},
+		"viewer": {ID: "viewer", Permissions: []string{"idm:users:read"}},
+		"admin":  {ID: "admin", Roles: []repo.Role{{ID: "idm_superuser"}}},
+		"alice":  {ID: "alice"},
+	}
+
+	authorizer := policy.NewAPIAuthorizer(engine, "data.cisidm.api", subjects)
+
+	authorize := func(subject string, req *middleware.AuthorizationRequest) *middleware.AuthorizationDecision {
+		ctx := middleware.ContextWithClaims(context.TODO(), &jwt.Claims{
+			Subject:     subject,
+			AppMetadata: &jwt.AppMetadata{LoginKind: jwt.LoginKindPassword},
+		})
+
+		decision, err := authorizer.Authorize(ctx, req)
+		require.NoError(t, err)
+
+		return decision
+	}
+
+	update := func(id string) *middleware.AuthorizationRequest {
+		return &middleware.AuthorizationRequest{
+			Procedure:    "/tkd.idm.v1.UserService/UpdateUser",
+			Message:      &idmv1.UpdateUserRequest{Id: id, DisplayName: "Alice"},
+			AllowedRoles: []string{"idm_superuser"},
+		}
+	}
+
+	assert.Equal(t, &middleware.AuthorizationDecision{Allow: true}, authorize("editor", update("alice")))
+	assert.Equal(t, &middleware.AuthorizationDecision{
+		Allow:  false,
+		Reason: "superusers may only be updated by superusers",
+	}, authorize("editor", update("admin")))
+
+	// no decision, the roles of the method annotation are checked instead.
+	assert.Nil(t, authorize("viewer", update("alice")))
+	assert.Nil(t, authorize("editor", &middleware.AuthorizationRequest{
+		Procedure: "/tkd.idm.v1.UserService/DeleteUser",
+		Message:   &idmv1.DeleteUserRequest{Id: "alice"},
+	}))
+}
+
+func Test_NewAPIInput(t *testing.T) {
+	subjects := fakeSubjects{
+		"alice": {ID: "alice"},
+	}
+
+	input, err := policy.NewAPIInput(context.TODO(), &middleware.AuthorizationRequest{
+		Procedure: "/tkd.idm.v1.UserService/SetUserPassword",
+		Message:   &idmv1.SetUserPasswordRequest{UserId: "alice", Password: "secret"},
+	}, nil, subjects)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tkd.idm.v1.UserService", input.Service)
+	assert.Equal(t, "SetUserPassword", input.Method)
+	assert.Equal(t, map[string][]string{"user_id": {"alice"}}, input.Resources)
+	assert.Equal(t, []*policy.SubjectInput{{ID: "alice"}}, input.TargetUsers)
+	assert.NotContains(t, fmt.Sprint(input.Request), "secret")
+}
+
+const denyPolicy = `package cisidm.api
+
+import rego.v1
+
+deny if input.method == "ValidateRegistrationToken"
+
+deny if {
+	input.procedure == "/cisidm.v1.TestService/Delete"
+	"protected" in input.resources.userId
+}
+
+reason := "denied by test policy" if deny
+`
+
+type deleteRequest struct {
+	UserID string `json:"userId"`
+}
+
+type deleteResponse struct{}
+
+func Test_APIAuthorizer_Handlers(t *testing.T) {
+	engine, err := policy.NewEngine(context.TODO(), nil, policy.WithRawPolicy("api.rego", denyPolicy))
+	require.NoError(t, err)
+
+	authorizer := policy.NewAPIAuthorizer(engine, "data.cisidm.api", fakeSubjects{
+		"alice": {ID: "alice"},
+	})
+
+	reg := new(protoregistry.Files)
+	require.NoError(t, reg.RegisterFile(idmv1.File_tkd_idm_v1_auth_service_proto))
+
+	mux := http.NewServeMux()
+	mux.Handle(idmv1connect.NewAuthServiceHandler(
+		idmv1connect.UnimplementedAuthServiceHandler{},
+		connect.WithInterceptors(middleware.NewAuthInterceptor(reg, authorizer)),
+	))
+	mux.Handle("/cisidm.v1.TestService/Delete", httpapi.Unary(func(ctx context.Context, req *deleteRequest) (*deleteResponse, error) {
+		return &deleteResponse{}, nil
+	}, httpapi.RequireAuth()))
+
+	srv := httptest.NewServer(middleware.NewAuthorizerMiddleware(authorizer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := middleware.ContextWithClaims(r.Context(), &jwt.Claims{Subject: "alice"})
+
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	})))
+	defer srv.Close()
+
+	t.Run("unannotated method", func(t *testing.T) {
+		client := idmv1connect.NewAuthServiceClient(srv.Client(), srv.URL)
+
+		_, err := client.ValidateRegistrationToken(context.TODO(), connect.NewRequest(&idmv1.ValidateRegistrationTokenRequest{}))
+		assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+		assert.Contains(t, err.Error(), "denied by test policy")
+
+		// without a decision the method is called
+		_, err = client.Login(context.TODO(), connect.NewRequest(&idmv1.LoginRequest{}))
+		assert.Equal(t, connect.CodeUnimplemented, connect.CodeOf(err))
+	})
+
+	t.Run("json endpoint", func(t *testing.T) {
+		client := httpapi.NewClient(srv.Client(), srv.URL)
+
+		err := client.Call(context.TODO(), "/cisidm.v1.TestService/Delete", &deleteRequest{UserID: "protected"}, &deleteResponse{})
+		assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+		err = client.Call(context.TODO(), "/cisidm.v1.TestService/Delete", &deleteRequest{UserID: "alice"}, &deleteResponse{})
+		assert.NoError(t, err)
+	})
+}
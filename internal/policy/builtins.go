@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+)
+
+// BuiltinPermissionMatches is the name of the rego builtin that exposes
+// permission.Matches to policies:
+//
+//	cisidm.permission_matches(input.subject.permissions, "idm:users:read")
+const BuiltinPermissionMatches = "cisidm.permission_matches"
+
+func init() {
+	rego.RegisterBuiltin2(
+		&rego.Function{
+			Name:    BuiltinPermissionMatches,
+			Decl:    types.NewFunction(types.Args(types.NewArray(nil, types.S), types.S), types.B),
+			Memoize: true,
+		},
+		permissionMatches,
+	)
+}
+
+func permissionMatches(_ rego.BuiltinContext, granted, required *ast.Term) (*ast.Term, error) {
+	var (
+		perms []string
+		req   string
+	)
+
+	if err := ast.As(granted.Value, &perms); err != nil {
+		return nil, fmt.Errorf("%s: invalid permissions: %w", BuiltinPermissionMatches, err)
+	}
+
+	if err := ast.As(required.Value, &req); err != nil {
+		return nil, fmt.Errorf("%s: invalid required permission: %w", BuiltinPermissionMatches, err)
+	}
+
+	return ast.BooleanTerm(permission.Matches(perms, req)), nil
+}
+
+// BuiltinCheckRelation is the name of the rego builtin that checks a
+// relation using the relationship store:
+//
+//	cisidm.check_relation("document:1", "editor", concat(":", ["user", input.subject.id]))
+const BuiltinCheckRelation = "cisidm.check_relation"
+
+// RelationChecker checks relations between objects and subjects. It is
+// implemented by relations.Checker.
+type RelationChecker interface {
+	CheckRelation(ctx context.Context, object, relation, subject string) (bool, error)
+}
+
+// WithRelations configures the relation checker used by the
+// cisidm.check_relation builtin.
+func WithRelations(checker RelationChecker) EngineOption {
+	return func(o *option) {
+		o.relations = checker
+	}
+}
+
+var checkRelationDecl = &rego.Function{
+	Name:             BuiltinCheckRelation,
+	Decl:             types.NewFunction(types.Args(types.S, types.S, types.S), types.B),
+	Memoize:          true,
+	Nondeterministic: true,
+}
+
+// checkRelation evaluates cisidm.check_relation. Without a relation
+// checker all checks are denied.
+func (engine *Engine) checkRelation(bctx rego.BuiltinContext, object, relation, subject *ast.Term) (*ast.Term, error) {
+	var args [3]string
+
+	for idx, term := range []*ast.Term{object, relation, subject} {
+		if err := ast.As(term.Value, &args[idx]); err != nil {
+			return nil, fmt.Errorf("%s: invalid argument %d: %w", BuiltinCheckRelation, idx+1, err)
+		}
+	}
+
+	if engine.relations == nil {
+		return ast.BooleanTerm(false), nil
+	}
+
+	ok, err := engine.relations.CheckRelation(bctx.Context, args[0], args[1], args[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", BuiltinCheckRelation, err)
+	}
+
+	return ast.BooleanTerm(ok), nil
+}
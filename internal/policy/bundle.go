@@ -0,0 +1,186 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/loader"
+)
+
+// BundleConfig configures an OPA compatible bundle. Exactly one of Path and
+// URL must be set.
+type BundleConfig struct {
+	Name string
+
+	// Path is the path to a bundle directory or a .tar.gz bundle file.
+	Path string
+
+	// URL is the HTTP(S) URL of a .tar.gz bundle.
+	URL string
+
+	// Headers are sent when downloading the bundle.
+	Headers map[string]string
+
+	// PollingInterval defines how often the URL is checked for a new
+	// revision. Defaults to one minute.
+	PollingInterval time.Duration
+}
+
+// WithBundle loads the bundle described by cfg.
+func WithBundle(cfg BundleConfig) EngineOption {
+	return func(o *option) {
+		if cfg.PollingInterval <= 0 {
+			cfg.PollingInterval = time.Minute
+		}
+
+		o.bundles = append(o.bundles, cfg)
+	}
+}
+
+var bundleClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+type bundleSource struct {
+	BundleConfig
+
+	// lock protects the downloaded bundles.
+	lock sync.Mutex
+
+	// downloaded holds the latest download which is used by the next
+	// compilation.
+	downloaded downloadedBundle
+
+	// applied holds the download that is part of the active revision. Its
+	// ETag is sent when checking for a new bundle so a bundle that failed
+	// to compile is downloaded and compiled again.
+	applied downloadedBundle
+}
+
+type downloadedBundle struct {
+	bundle   *bundle.Bundle
+	etag     string
+	loadedAt time.Time
+}
+
+func newBundleSource(cfg BundleConfig) *bundleSource {
+	return &bundleSource{
+		BundleConfig: cfg,
+	}
+}
+
+func (b *bundleSource) source() string {
+	if b.URL != "" {
+		return b.URL
+	}
+
+	return b.Path
+}
+
+// load returns the bundle and its revision. Local bundles are read again,
+// downloaded bundles are returned from memory and are nil if the download
+// has not succeeded yet. The download is returned as well so it can be
+// applied once the compilation succeeded.
+func (b *bundleSource) load() (*bundle.Bundle, BundleRevision, downloadedBundle, error) {
+	rev := BundleRevision{
+		Name:   b.Name,
+		Source: b.source(),
+	}
+
+	if b.URL == "" {
+		bdl, err := loader.NewFileLoader().AsBundle(b.Path)
+		if err != nil {
+			return nil, rev, downloadedBundle{}, err
+		}
+
+		rev.Revision = bdl.Manifest.Revision
+		rev.LoadedAt = time.Now()
+
+		return bdl, rev, downloadedBundle{}, nil
+	}
+
+	b.lock.Lock()
+	download := b.downloaded
+	b.lock.Unlock()
+
+	if download.bundle == nil {
+		return nil, rev, download, nil
+	}
+
+	rev.Revision = download.bundle.Manifest.Revision
+	rev.ETag = download.etag
+	rev.LoadedAt = download.loadedAt
+
+	return download.bundle, rev, download, nil
+}
+
+// fetch downloads the bundle if it changed since the last download and
+// reports whether a new bundle has been downloaded.
+func (b *bundleSource) fetch(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.URL, nil)
+	if err != nil {
+		return false, err
+	}
+
+	for key, value := range b.Headers {
+		req.Header.Set(key, value)
+	}
+
+	b.lock.Lock()
+	etag := b.applied.etag
+	b.lock.Unlock()
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := bundleClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	bdl, err := bundle.NewReader(res.Body).Read()
+	if err != nil {
+		return false, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.downloaded = downloadedBundle{
+		bundle:   &bdl,
+		etag:     res.Header.Get("ETag"),
+		loadedAt: time.Now(),
+	}
+
+	return true, nil
+}
+
+// apply marks download as part of the active revision.
+func (b *bundleSource) apply(download downloadedBundle) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.applied = download
+}
+
+// rollback discards downloads that have not been applied.
+func (b *bundleSource) rollback() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.downloaded = b.applied
+}
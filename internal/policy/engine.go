@@ -5,11 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 )
@@ -28,14 +33,44 @@ var (
 )
 
 type Engine struct {
-	compiler *ast.Compiler
+	paths   []string
+	bundles []*bundleSource
+
+	// reloadLock serializes reloads and protects the fields below.
+	reloadLock  sync.Mutex
+	fingerprint string
+	lastError   string
+	lastErrorAt time.Time
+
+	// current holds the compiled policies. It is replaced atomically on
+	// each successful reload.
+	current atomic.Pointer[compiled]
 
 	option
 }
 
+// compiled holds a compiled set of policies and bundle data.
+type compiled struct {
+	compiler *ast.Compiler
+	store    storage.Store
+	revision Revision
+
+	// downloads holds the downloaded bundles used by the compilation.
+	downloads map[*bundleSource]downloadedBundle
+
+	// prepared holds prepared queries by query string. Prepared queries
+	// can be evaluated concurrently and avoid re-compiling the query for
+	// each request.
+	preparedLock sync.Mutex
+	prepared     map[string]*rego.PreparedEvalQuery
+}
+
 type option struct {
-	extraModules map[string]string
-	debug        bool
+	extraModules  map[string]string
+	debug         bool
+	relations     RelationChecker
+	bundles       []BundleConfig
+	watchInterval time.Duration
 }
 
 type EngineOption func(*option)
@@ -56,6 +91,14 @@ func WithRawPolicy(path, content string) EngineOption {
 	}
 }
 
+// WithWatch configures Run to check the policy directories and local
+// bundles for changes every interval.
+func WithWatch(interval time.Duration) EngineOption {
+	return func(o *option) {
+		o.watchInterval = interval
+	}
+}
+
 func NewEngine(ctx context.Context, paths []string, opts ...EngineOption) (*Engine, error) {
 	var options option
 
@@ -63,14 +106,91 @@ func NewEngine(ctx context.Context, paths []string, opts ...EngineOption) (*Engi
 		fn(&options)
 	}
 
-	modules, err := loader.AllRegos(paths)
+	e := &Engine{
+		paths:  paths,
+		option: options,
+	}
+
+	for _, cfg := range options.bundles {
+		b := newBundleSource(cfg)
+
+		// a bundle server that is not reachable should not prevent
+		// cisidm from starting, the download is retried by Run.
+		if b.URL != "" {
+			if _, err := b.fetch(ctx); err != nil {
+				log.L(ctx).Error("failed to download policy bundle", "bundle", b.Name, "error", err)
+			}
+		}
+
+		e.bundles = append(e.bundles, b)
+	}
+
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Reload loads and compiles all policies and bundles again. If compilation
+// fails, the previously loaded policies stay active, downloaded bundles that
+// have not been applied yet are discarded and an error is returned.
+func (engine *Engine) Reload(ctx context.Context) error {
+	engine.reloadLock.Lock()
+	defer engine.reloadLock.Unlock()
+
+	// the fingerprint is taken before loading the files so changes made
+	// while compiling are picked up by the next check.
+	fingerprint, err := engine.fileFingerprint()
+	if err != nil {
+		log.L(ctx).Error("failed to check policy files for changes", "error", err)
+	} else {
+		engine.fingerprint = fingerprint
+	}
+
+	c, err := engine.compile()
+	if err != nil {
+		engine.lastError = err.Error()
+		engine.lastErrorAt = time.Now()
+
+		for _, b := range engine.bundles {
+			b.rollback()
+		}
+
+		return err
+	}
+
+	engine.lastError = ""
+	engine.lastErrorAt = time.Time{}
+
+	for b, download := range c.downloads {
+		b.apply(download)
+	}
+
+	if prev := engine.current.Load(); prev != nil && prev.revision.Revision == c.revision.Revision {
+		// nothing changed, keep the prepared queries.
+		return nil
+	}
+
+	engine.current.Store(c)
+
+	log.L(ctx).
+		With("modules", len(c.compiler.Modules), "revision", c.revision.Revision).
+		Info("policy engine prepared")
+
+	return nil
+}
+
+// compile loads all policy sources and compiles them.
+func (engine *Engine) compile() (*compiled, error) {
+	modules, err := loader.AllRegos(engine.paths)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load rego files: %w", err)
 	}
 
 	moduleMap := modules.ParsedModules()
 
-	for name, content := range options.extraModules {
+	for name, content := range engine.extraModules {
 		parsed, err := ast.ParseModule(name, content)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse extra module %s: %w", name, err)
@@ -79,23 +199,64 @@ func NewEngine(ctx context.Context, paths []string, opts ...EngineOption) (*Engi
 		moduleMap[name] = parsed
 	}
 
-	compiler := ast.NewCompiler()
+	var (
+		data      = make(map[string]any)
+		bundles   []BundleRevision
+		downloads = make(map[*bundleSource]downloadedBundle)
+	)
+
+	for _, b := range engine.bundles {
+		bdl, rev, download, err := b.load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load bundle %s: %w", b.Name, err)
+		}
+
+		if b.URL != "" {
+			downloads[b] = download
+		}
+
+		if bdl == nil {
+			continue
+		}
+
+		for _, m := range bdl.Modules {
+			moduleMap[b.Name+":"+m.Path] = m.Parsed
+		}
+
+		if err := mergeData(data, bdl.Data, ""); err != nil {
+			return nil, fmt.Errorf("failed to load bundle %s: %w", b.Name, err)
+		}
+
+		bundles = append(bundles, rev)
+	}
+
+	// builtins that need access to the engine are not registered globally
+	// so they must be declared on the compiler.
+	compiler := ast.NewCompiler().WithBuiltins(map[string]*ast.Builtin{
+		checkRelationDecl.Name: {
+			Name:             checkRelationDecl.Name,
+			Decl:             checkRelationDecl.Decl,
+			Nondeterministic: checkRelationDecl.Nondeterministic,
+		},
+	})
 
 	compiler.Compile(moduleMap)
 	if compiler.Failed() {
 		return nil, fmt.Errorf("failed to compile rego policies: %w", compiler.Errors)
 	}
 
-	log.L(ctx).
-		With("modules", len(compiler.Modules)).
-		Info("policy engine prepared")
-
-	e := &Engine{
-		compiler: compiler,
-		option:   options,
+	revision, err := newRevision(compiler.Modules, data, bundles)
+	if err != nil {
+		return nil, err
 	}
 
-	return e, nil
+	return &compiled{
+		compiler:  compiler,
+		store:     inmem.NewFromObject(data),
+		revision:  revision,
+		downloads: downloads,
+		prepared:  make(map[string]*rego.PreparedEvalQuery),
+	}, nil
 }
 
 func (engine *Engine) Query(
@@ -103,43 +264,92 @@ func (engine *Engine) Query(
 	query string,
 	input any,
 ) (rego.ResultSet, error) {
-	options := []func(*rego.Rego){
+	if engine.option.debug {
+		return engine.queryDebug(ctx, query, input)
+	}
+
+	prepared, err := engine.prepare(ctx, engine.current.Load(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := prepared.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate rego query: %w", err)
+	}
+
+	return result, nil
+}
+
+// prepare returns the prepared query for query and prepares it on first use.
+func (engine *Engine) prepare(ctx context.Context, c *compiled, query string) (*rego.PreparedEvalQuery, error) {
+	c.preparedLock.Lock()
+	defer c.preparedLock.Unlock()
+
+	if prepared, ok := c.prepared[query]; ok {
+		return prepared, nil
+	}
+
+	prepared, err := rego.New(engine.optionsFor(c, query)...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare rego query: %w", err)
+	}
+
+	c.prepared[query] = &prepared
+
+	return &prepared, nil
+}
+
+// options returns the rego options to evaluate query using the currently
+// loaded policies.
+func (engine *Engine) options(query string) []func(*rego.Rego) {
+	return engine.optionsFor(engine.current.Load(), query)
+}
+
+func (engine *Engine) optionsFor(c *compiled, query string) []func(*rego.Rego) {
+	return []func(*rego.Rego){
 		rego.Imports([]string{"rego.v1"}),
 		rego.Query(query),
-		rego.Input(input),
-		rego.Compiler(engine.compiler),
+		rego.Compiler(c.compiler),
+		rego.Store(c.store),
+		rego.Function3(checkRelationDecl, engine.checkRelation),
 
 		// we always add a print hook so users can debug their policies
 		// without enabling the whole tracing and dumping thing...
 		rego.PrintHook(topdown.NewPrintHook(os.Stderr)),
 	}
+}
 
-	if engine.option.debug {
-		log.L(ctx).Info("rego-tracer: preparing to query in debug mode", "query", query)
-
-		tracer := new(topdown.BufferTracer)
+// queryDebug evaluates query without preparing it so the evaluation can be
+// traced.
+func (engine *Engine) queryDebug(
+	ctx context.Context,
+	query string,
+	input any,
+) (rego.ResultSet, error) {
+	log.L(ctx).Info("rego-tracer: preparing to query in debug mode", "query", query)
 
-		options = append(options, rego.Trace(true))
-		options = append(options, rego.QueryTracer(tracer))
-		options = append(options, rego.Dump(os.Stderr))
+	tracer := new(topdown.BufferTracer)
 
-		defer func() {
-			for _, evt := range *tracer {
-				log.L(ctx).Info("rego-tracer", "message", evt.String())
-			}
-		}()
-	}
-
-	eval := rego.New(options...)
+	options := append(engine.options(query),
+		rego.Input(input),
+		rego.Trace(true),
+		rego.QueryTracer(tracer),
+		rego.Dump(os.Stderr),
+	)
+
+	defer func() {
+		for _, evt := range *tracer {
+			log.L(ctx).Info("rego-tracer", "message", evt.String())
+		}
+	}()
 
-	result, err := eval.Eval(ctx)
+	result, err := rego.New(options...).Eval(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate rego query: %w", err)
 	}
 
-	if engine.option.debug {
-		log.L(ctx).With("result", result).Info("rego-tracer: policy result")
-	}
+	log.L(ctx).With("result", result).Info("rego-tracer: policy result")
 
 	return result, nil
 }
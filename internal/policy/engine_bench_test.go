@@ -0,0 +1,45 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+func Benchmark_Engine_Query(b *testing.B) {
+	ctx := context.Background()
+
+	engine, err := NewEngine(ctx, []string{"./testdata"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	input := map[string]any{
+		"subject": map[string]any{
+			"username": "test",
+			"roles":    []string{"idm_superuser"},
+		},
+		"path": "/test",
+	}
+
+	// unprepared evaluates the query like the engine did before prepared
+	// queries have been cached.
+	b.Run("unprepared", func(b *testing.B) {
+		for range b.N {
+			options := append(engine.options("data."+PackageForwardAuth), rego.Input(input))
+
+			if _, err := rego.New(options...).Eval(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("prepared", func(b *testing.B) {
+		for range b.N {
+			if _, err := engine.Query(ctx, "data."+PackageForwardAuth, input); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
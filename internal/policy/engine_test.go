@@ -40,3 +40,63 @@ func Test_Engine_QueryOne(t *testing.T) {
 
 	assert.Equal(t, expected, result)
 }
+
+func Test_Engine_PermissionMatches(t *testing.T) {
+	engine, err := policy.NewEngine(context.TODO(), nil, policy.WithRawPolicy("permissions.rego", `package cisidm.test
+
+import rego.v1
+
+result := {
+	"read": cisidm.permission_matches(input.permissions, "idm:users:read"),
+	"delete": cisidm.permission_matches(input.permissions, "idm:users:delete"),
+}
+`))
+	require.NoError(t, err)
+
+	var result struct {
+		Read   bool `mapstructure:"read"`
+		Delete bool `mapstructure:"delete"`
+	}
+
+	input := map[string]any{
+		"permissions": []string{"idm:*", "!idm:users:delete"},
+	}
+
+	require.NoError(t, engine.QueryOne(context.TODO(), "data.cisidm.test.result", input, &result))
+	assert.True(t, result.Read)
+	assert.False(t, result.Delete)
+}
+
+type fakeRelations map[string]bool
+
+func (f fakeRelations) CheckRelation(_ context.Context, object, relation, subject string) (bool, error) {
+	return f[object+"#"+relation+"@"+subject], nil
+}
+
+func Test_Engine_CheckRelation(t *testing.T) {
+	engine, err := policy.NewEngine(context.TODO(), nil,
+		policy.WithRelations(fakeRelations{"document:1#editor@user:alice": true}),
+		policy.WithRawPolicy("relations.rego", `package cisidm.test
+
+import rego.v1
+
+result := {
+	"edit": cisidm.check_relation("document:1", "editor", concat(":", ["user", input.user])),
+	"read": cisidm.permission_matches(input.permissions, "idm:users:read"),
+}
+`))
+	require.NoError(t, err)
+
+	var result struct {
+		Edit bool `mapstructure:"edit"`
+		Read bool `mapstructure:"read"`
+	}
+
+	require.NoError(t, engine.QueryOne(context.TODO(), "data.cisidm.test.result", map[string]any{"user": "alice", "permissions": []string{"idm"}}, &result))
+	assert.True(t, result.Edit)
+	assert.True(t, result.Read)
+
+	require.NoError(t, engine.QueryOne(context.TODO(), "data.cisidm.test.result", map[string]any{"user": "bob", "permissions": []string{}}, &result))
+	assert.False(t, result.Edit)
+	assert.False(t, result.Read)
+}
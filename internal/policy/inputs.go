@@ -33,6 +33,10 @@ type SubjectInput struct {
 	// assigned roles.
 	Permissions []string `mapstructure:"permissions" json:"permissions"`
 
+	// Groups is a list of groups the user is a member of, either directly or
+	// through a subgroup.
+	Groups []repo.UserGroup `mapstructure:"groups" json:"groups"`
+
 	// Fields hold the additional user fields as specified in the configuration.
 	Fields map[string]any `mapstructure:"fields" json:"fields"`
 
@@ -49,8 +53,9 @@ type SubjectInput struct {
 
 type Store interface {
 	GetUserByID(context.Context, string) (repo.User, error)
-	GetRolesForUser(context.Context, string) ([]repo.Role, error)
-	GetRolesForToken(context.Context, string) ([]repo.Role, error)
+	GetEffectiveRolesForUser(context.Context, string) ([]repo.Role, error)
+	GetEffectiveRolesForToken(context.Context, string) ([]repo.Role, error)
+	GetEffectiveGroupsForUser(context.Context, string) ([]repo.UserGroup, error)
 	GetRolePermissions(context.Context, string) ([]string, error)
 	GetPrimaryEmailForUserByID(context.Context, string) (repo.UserEmail, error)
 }
@@ -65,17 +70,23 @@ func NewSubjectInput(ctx context.Context, ds Store, permissionResolver permissio
 		return nil, fmt.Errorf("user profile has been deleted")
 	}
 
+	// roles include all roles that are included by assigned roles.
 	var roles []repo.Role
 	if tokenKind == jwt.LoginKindAPI {
-		roles, err = ds.GetRolesForToken(ctx, tokenID)
+		roles, err = ds.GetEffectiveRolesForToken(ctx, tokenID)
 	} else {
-		roles, err = ds.GetRolesForUser(ctx, userID)
+		roles, err = ds.GetEffectiveRolesForUser(ctx, userID)
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user or token roles: %w", err)
 	}
 
+	groups, err := ds.GetEffectiveGroupsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user groups: %w", err)
+	}
+
 	permissionSet := make([]string, 0, len(roles))
 	for _, role := range roles {
 		rolePermissions, err := ds.GetRolePermissions(ctx, role.ID)
@@ -107,6 +118,7 @@ func NewSubjectInput(ctx context.Context, ds Store, permissionResolver permissio
 		Email:       mail,
 		Roles:       roles,
 		Permissions: resolvedPermissions,
+		Groups:      groups,
 		TokenKind:   tokenKind,
 		Fields:      make(map[string]any),
 	}
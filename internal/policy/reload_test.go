@@ -0,0 +1,212 @@
+package policy_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
+)
+
+type valueResult struct {
+	Value int `mapstructure:"value"`
+}
+
+func queryValue(t *testing.T, engine *policy.Engine) int {
+	t.Helper()
+
+	var result valueResult
+	require.NoError(t, engine.QueryOne(context.TODO(), "data.cisidm.test", nil, &result))
+
+	return result.Value
+}
+
+func writePolicy(t *testing.T, path string, content string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func Test_Engine_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.rego")
+
+	writePolicy(t, path, "package cisidm.test\n\nvalue := 1\n")
+
+	engine, err := policy.NewEngine(context.TODO(), []string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, 1, queryValue(t, engine))
+
+	first := engine.Status()
+
+	writePolicy(t, path, "package cisidm.test\n\nvalue := 2\n")
+	require.NoError(t, engine.Reload(context.TODO()))
+	assert.Equal(t, 2, queryValue(t, engine))
+
+	second := engine.Status()
+	assert.NotEqual(t, first.Revision.Revision, second.Revision.Revision)
+	assert.Empty(t, second.LastError)
+
+	// a policy that does not compile keeps the previous revision active
+	writePolicy(t, path, "package cisidm.test\n\nvalue := \n")
+	require.Error(t, engine.Reload(context.TODO()))
+	assert.Equal(t, 2, queryValue(t, engine))
+
+	failed := engine.Status()
+	assert.Equal(t, second.Revision.Revision, failed.Revision.Revision)
+	assert.NotEmpty(t, failed.LastError)
+	assert.NotNil(t, failed.LastErrorAt)
+}
+
+func Test_Engine_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.rego")
+
+	writePolicy(t, path, "package cisidm.test\n\nvalue := 1\n")
+
+	engine, err := policy.NewEngine(context.TODO(), []string{dir}, policy.WithWatch(10*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		engine.Run(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	writePolicy(t, path, "package cisidm.test\n\nvalue := 42\n")
+
+	assert.Eventually(t, func() bool {
+		return queryValue(t, engine) == 42
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func writeBundle(t *testing.T, revision string, module string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, bundle.NewWriter(&buf).Write(bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: revision},
+		Data: map[string]any{
+			"limits": map[string]any{"max": 3},
+		},
+		Modules: []bundle.ModuleFile{
+			{
+				URL:  "/test.rego",
+				Path: "/test.rego",
+				Raw:  []byte(module),
+			},
+		},
+	}))
+
+	return buf.Bytes()
+}
+
+func Test_Engine_HTTPBundle(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		etag     = `"v1"`
+		content  = writeBundle(t, "v1", "package cisidm.test\n\nvalue := data.limits.max\n")
+		retried  int
+		serveNew = func(newETag string, newContent []byte) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			etag, content, retried = newETag, newContent, 0
+		}
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			retried++
+		}
+
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	engine, err := policy.NewEngine(context.TODO(), nil, policy.WithBundle(policy.BundleConfig{
+		Name:            "main",
+		URL:             srv.URL,
+		Headers:         map[string]string{"Authorization": "Bearer secret"},
+		PollingInterval: 10 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 3, queryValue(t, engine))
+
+	status := engine.Status()
+	require.Len(t, status.Bundles, 1)
+	assert.Equal(t, "main", status.Bundles[0].Name)
+	assert.Equal(t, "v1", status.Bundles[0].Revision)
+	assert.Equal(t, `"v1"`, status.Bundles[0].ETag)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		engine.Run(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a bundle that does not compile is rejected and downloaded again
+	// using the ETag of the applied bundle.
+	serveNew(`"v2"`, writeBundle(t, "v2", "package cisidm.test\n\nvalue := undefined_function(1)\n"))
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return retried >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status = engine.Status()
+	assert.NotEmpty(t, status.LastError)
+	assert.Equal(t, `"v1"`, status.Bundles[0].ETag)
+	assert.Equal(t, 3, queryValue(t, engine))
+
+	// once the bundle is fixed it is applied.
+	serveNew(`"v3"`, writeBundle(t, "v3", "package cisidm.test\n\nvalue := data.limits.max + 2\n"))
+
+	assert.Eventually(t, func() bool {
+		return queryValue(t, engine) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status = engine.Status()
+	assert.Empty(t, status.LastError)
+	assert.Equal(t, "v3", status.Bundles[0].Revision)
+	assert.Equal(t, `"v3"`, status.Bundles[0].ETag)
+}
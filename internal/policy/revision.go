@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// Revision describes a loaded set of policies.
+type Revision struct {
+	// Revision is a hash over all loaded modules and bundle data.
+	Revision string `json:"revision"`
+
+	// LoadedAt is the time the policies have been compiled.
+	LoadedAt time.Time `json:"loadedAt"`
+
+	// Modules holds the names of all loaded modules.
+	Modules []string `json:"modules"`
+
+	// Bundles describes the loaded bundles.
+	Bundles []BundleRevision `json:"bundles,omitempty"`
+}
+
+// BundleRevision describes a loaded bundle.
+type BundleRevision struct {
+	Name string `json:"name"`
+
+	// Source is the path or URL the bundle has been loaded from.
+	Source string `json:"source"`
+
+	// Revision is the revision from the bundle manifest, if any.
+	Revision string `json:"revision,omitempty"`
+
+	// ETag is the ETag of the downloaded bundle, if any.
+	ETag string `json:"etag,omitempty"`
+
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// Status reports the active revision and the result of the last reload.
+type Status struct {
+	Revision
+
+	// LastError holds the error of the last reload if it failed. The
+	// previous revision stays active in this case.
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Status returns the active revision and the result of the last reload.
+func (engine *Engine) Status() Status {
+	engine.reloadLock.Lock()
+	defer engine.reloadLock.Unlock()
+
+	status := Status{
+		Revision:  engine.current.Load().revision,
+		LastError: engine.lastError,
+	}
+
+	if !engine.lastErrorAt.IsZero() {
+		at := engine.lastErrorAt
+		status.LastErrorAt = &at
+	}
+
+	return status
+}
+
+func newRevision(modules map[string]*ast.Module, data map[string]any, bundles []BundleRevision) (Revision, error) {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s\n%s\n", name, modules[name].String())
+	}
+
+	blob, err := json.Marshal(data)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode bundle data: %w", err)
+	}
+	hash.Write(blob)
+
+	for _, b := range bundles {
+		fmt.Fprintf(hash, "%s\n%s\n", b.Name, b.Revision)
+	}
+
+	return Revision{
+		Revision: hex.EncodeToString(hash.Sum(nil))[:16],
+		LoadedAt: time.Now(),
+		Modules:  names,
+		Bundles:  bundles,
+	}, nil
+}
+
+// mergeData merges the bundle data src into dst. Bundles must not define
+// the same values.
+func mergeData(dst, src map[string]any, path string) error {
+	for key, value := range src {
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			continue
+		}
+
+		a, aok := existing.(map[string]any)
+		b, bok := value.(map[string]any)
+		if !aok || !bok {
+			return fmt.Errorf("conflicting data at %s/%s", path, key)
+		}
+
+		if err := mergeData(a, b, path+"/"+key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package policy
+
+import "context"
+
+const (
+	// ServiceName is the name of the policy service.
+	ServiceName = "cisidm.v1.PolicyService"
+
+	// GetRevisionProcedure is the HTTP path of the GetRevision endpoint.
+	GetRevisionProcedure = "/" + ServiceName + "/GetRevision"
+)
+
+type GetRevisionRequest struct{}
+
+type GetRevisionResponse struct {
+	Status
+}
+
+// Service reports the state of the policy engine.
+type Service struct {
+	engine *Engine
+}
+
+// NewService returns a new policy service.
+func NewService(engine *Engine) *Service {
+	return &Service{
+		engine: engine,
+	}
+}
+
+// GetRevision returns the active policy revision and the result of the last
+// reload.
+func (svc *Service) GetRevision(ctx context.Context, req *GetRevisionRequest) (*GetRevisionResponse, error) {
+	return &GetRevisionResponse{
+		Status: svc.engine.Status(),
+	}, nil
+}
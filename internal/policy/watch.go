@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// Run reloads the policies whenever policy files or bundles change until
+// ctx is cancelled. Files are only checked if the engine has been created
+// using WithWatch, bundles with a URL are always polled.
+func (engine *Engine) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, b := range engine.bundles {
+		if b.URL == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine.pollBundle(ctx, b)
+		}()
+	}
+
+	if engine.watchInterval > 0 {
+		engine.watchFiles(ctx)
+	}
+
+	wg.Wait()
+}
+
+func (engine *Engine) watchFiles(ctx context.Context) {
+	ticker := time.NewTicker(engine.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fingerprint, err := engine.fileFingerprint()
+		if err != nil {
+			log.L(ctx).Error("failed to check policy files for changes", "error", err)
+			continue
+		}
+
+		engine.reloadLock.Lock()
+		changed := fingerprint != engine.fingerprint
+		engine.reloadLock.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		log.L(ctx).Info("policy files changed, reloading policies")
+
+		if err := engine.Reload(ctx); err != nil {
+			log.L(ctx).Error("failed to reload policies, keeping previous revision", "error", err)
+		}
+	}
+}
+
+func (engine *Engine) pollBundle(ctx context.Context, b *bundleSource) {
+	ticker := time.NewTicker(b.PollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := b.fetch(ctx)
+		if err != nil {
+			log.L(ctx).Error("failed to download policy bundle", "bundle", b.Name, "error", err)
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		log.L(ctx).Info("policy bundle changed, reloading policies", "bundle", b.Name)
+
+		// a bundle that fails to compile is discarded by Reload and
+		// downloaded again by the next poll.
+		if err := engine.Reload(ctx); err != nil {
+			log.L(ctx).Error("failed to reload policies, keeping previous revision", "bundle", b.Name, "error", err)
+		}
+	}
+}
+
+// fileFingerprint returns a hash over the names, sizes and modification
+// times of all files in the policy directories and local bundles.
+func (engine *Engine) fileFingerprint() (string, error) {
+	paths := append([]string{}, engine.paths...)
+	for _, b := range engine.bundles {
+		if b.Path != "" {
+			paths = append(paths, b.Path)
+		}
+	}
+
+	hash := sha256.New()
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					fmt.Fprintf(hash, "%s\n", path)
+					return nil
+				}
+
+				return err
+			}
+
+			if d.IsDir() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(hash, "%s\n%d\n%d\n", path, info.Size(), info.ModTime().UnixNano())
+
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to walk %s: %w", root, err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
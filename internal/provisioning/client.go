@@ -0,0 +1,215 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+)
+
+// SCIM URNs used by the client.
+const (
+	schemaUser     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	messagePatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+const contentType = "application/scim+json"
+
+// maxResponseSize limits the size of responses read from SCIM targets.
+const maxResponseSize = 1 << 20
+
+// Error is returned by the Client if the SCIM target responds with a
+// non-2xx status code.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("scim: %d %s", e.Status, http.StatusText(e.Status))
+
+	if e.ScimType != "" {
+		msg += " (" + e.ScimType + ")"
+	}
+
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+// IsNotFound returns true if err is a SCIM error with status 404.
+func IsNotFound(err error) bool {
+	var serr *Error
+	return errors.As(err, &serr) && serr.Status == http.StatusNotFound
+}
+
+// Client is a minimal SCIM 2.0 client for provisioning users to a single
+// target.
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewClient returns a new SCIM client for target.
+func NewClient(target *config.SCIMTarget) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(target.URL, "/"),
+		token:   target.Token,
+		client: &http.Client{
+			Timeout: target.RequestTimeout(),
+		},
+	}
+}
+
+// FindUser searches for a user by userName and returns its ID. If no user
+// exists an empty string is returned.
+func (c *Client) FindUser(ctx context.Context, userName string) (string, error) {
+	// SCIM filters use JSON string literals.
+	value, err := json.Marshal(userName)
+	if err != nil {
+		return "", err
+	}
+
+	filter := "userName eq " + string(value)
+
+	var res struct {
+		Resources []struct {
+			ID       string `json:"id"`
+			UserName string `json:"userName"`
+		} `json:"Resources"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/Users?filter="+url.QueryEscape(filter), nil, &res); err != nil {
+		return "", err
+	}
+
+	for _, r := range res.Resources {
+		// userName is case-insensitive as defined in RFC 7643.
+		if strings.EqualFold(r.UserName, userName) {
+			return r.ID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// CreateUser creates a new user and returns the ID assigned by the target.
+func (c *Client) CreateUser(ctx context.Context, resource map[string]any) (string, error) {
+	var res struct {
+		ID string `json:"id"`
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/Users", resource, &res); err != nil {
+		return "", err
+	}
+
+	if res.ID == "" {
+		return "", fmt.Errorf("scim: target did not return a user id")
+	}
+
+	return res.ID, nil
+}
+
+// ReplaceUser replaces the user with id.
+func (c *Client) ReplaceUser(ctx context.Context, id string, resource map[string]any) error {
+	return c.do(ctx, http.MethodPut, "/Users/"+url.PathEscape(id), resource, nil)
+}
+
+// SetUserActive updates the active attribute of the user with id.
+func (c *Client) SetUserActive(ctx context.Context, id string, active bool) error {
+	body := map[string]any{
+		"schemas": []string{messagePatchOp},
+		"Operations": []map[string]any{
+			{
+				"op":    "replace",
+				"path":  "active",
+				"value": active,
+			},
+		},
+	}
+
+	return c.do(ctx, http.MethodPatch, "/Users/"+url.PathEscape(id), body, nil)
+}
+
+// DeleteUser deletes the user with id.
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/Users/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		blob, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reader = bytes.NewReader(blob)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	blob, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		serr := &Error{
+			Status: res.StatusCode,
+		}
+
+		// the status of SCIM errors is a string which is not handled
+		// consistently by all implementations so we only decode the details
+		// and use the HTTP status code instead.
+		var details struct {
+			ScimType string `json:"scimType"`
+			Detail   string `json:"detail"`
+		}
+		if json.Unmarshal(blob, &details) == nil {
+			serr.ScimType = details.ScimType
+			serr.Detail = details.Detail
+		}
+
+		return serr
+	}
+
+	if result == nil || len(blob) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(blob, result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package provisioning
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// multiValuedAttributes are core attributes that are sent as a list with a
+// single primary value if a plain value is mapped to them.
+var multiValuedAttributes = []string{"emails", "phoneNumbers"}
+
+// UserFields holds all values of a user that can be mapped to SCIM
+// attributes.
+type UserFields struct {
+	User  repo.User
+	Email string
+	Phone string
+}
+
+// value returns the value of the user field. The second return value is
+// false if the field is not set.
+func (u UserFields) value(field string) (any, bool) {
+	var v string
+
+	switch field {
+	case "id":
+		v = u.User.ID
+	case "username":
+		v = u.User.Username
+	case "display_name":
+		v = u.User.DisplayName
+	case "first_name":
+		v = u.User.FirstName
+	case "last_name":
+		v = u.User.LastName
+	case "email":
+		v = u.Email
+	case "phone":
+		v = u.Phone
+	default:
+		path, ok := strings.CutPrefix(field, "extra.")
+		if !ok || u.User.Extra == "" {
+			return nil, false
+		}
+
+		var extra any
+		if err := json.Unmarshal([]byte(u.User.Extra), &extra); err != nil {
+			return nil, false
+		}
+
+		for _, key := range strings.Split(path, ".") {
+			m, ok := extra.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+
+			extra, ok = m[key]
+			if !ok {
+				return nil, false
+			}
+		}
+
+		return extra, extra != nil
+	}
+
+	return v, v != ""
+}
+
+// splitAttrPath splits a SCIM attribute path into the schema URN and the
+// attribute path. The schema is empty for core attributes.
+func splitAttrPath(path string) (string, string) {
+	if !strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return "", path
+	}
+
+	idx := strings.LastIndex(path, ":")
+
+	return path[:idx], path[idx+1:]
+}
+
+// BuildResource builds the SCIM user resource for u using the attribute
+// mapping. Users are always sent with active set to true, de-provisioned
+// users are deactivated using a separate PATCH request.
+func BuildResource(attributes map[string]string, u UserFields) (map[string]any, error) {
+	res := map[string]any{
+		"active": true,
+	}
+
+	schemas := []string{schemaUser}
+
+	for path, field := range attributes {
+		value, ok := u.value(field)
+		if !ok {
+			continue
+		}
+
+		schema, attr := splitAttrPath(path)
+		if attr == "" {
+			return nil, fmt.Errorf("invalid attribute path %q", path)
+		}
+
+		target := res
+		if schema != "" && !strings.EqualFold(schema, schemaUser) {
+			ext, _ := res[schema].(map[string]any)
+			if ext == nil {
+				ext = make(map[string]any)
+				res[schema] = ext
+
+				schemas = append(schemas, schema)
+			}
+
+			target = ext
+		}
+
+		parts := strings.Split(attr, ".")
+		for _, key := range parts[:len(parts)-1] {
+			next, ok := target[key].(map[string]any)
+			if !ok {
+				if _, exists := target[key]; exists {
+					return nil, fmt.Errorf("attribute %q conflicts with another mapping", path)
+				}
+
+				next = make(map[string]any)
+				target[key] = next
+			}
+
+			target = next
+		}
+
+		key := parts[len(parts)-1]
+		if _, ok := target[key]; ok {
+			return nil, fmt.Errorf("attribute %q conflicts with another mapping", path)
+		}
+
+		if s, ok := value.(string); ok && schema == "" && len(parts) == 1 && slices.Contains(multiValuedAttributes, key) {
+			value = []any{
+				map[string]any{
+					"value":   s,
+					"primary": true,
+				},
+			}
+		}
+
+		target[key] = value
+	}
+
+	// keep the order of schemas stable so the resource hash does not change
+	// between syncs.
+	slices.Sort(schemas[1:])
+	res["schemas"] = schemas
+
+	return res, nil
+}
+
+// Hash returns a hash of the resource that is used to detect changes.
+func Hash(resource map[string]any) (string, error) {
+	// encoding/json sorts map keys so the output is stable.
+	blob, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(blob)
+
+	return hex.EncodeToString(sum[:]), nil
+}
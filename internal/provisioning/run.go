@@ -0,0 +1,386 @@
+package provisioning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// run holds the state of a single sync run for a target.
+type run struct {
+	datastore *repo.Queries
+	target    *target
+
+	// roles holds the IDs of all roles in scope. It is only used if
+	// scoped is true.
+	roles  map[string]struct{}
+	scoped bool
+
+	synced  int
+	failed  int
+	lastErr error
+}
+
+func (s *Syncer) newRun(ctx context.Context, t *target) (*run, error) {
+	r := &run{
+		datastore: s.datastore,
+		target:    t,
+		roles:     make(map[string]struct{}),
+		scoped:    len(t.cfg.Roles) > 0,
+	}
+
+	// roles may be specified by ID or name.
+	for _, idOrName := range t.cfg.Roles {
+		role, err := s.datastore.GetRoleByID(ctx, idOrName)
+		if errors.Is(err, sql.ErrNoRows) {
+			role, err = s.datastore.GetRoleByName(ctx, idOrName)
+		}
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				log.L(ctx).Warn("role configured for SCIM target does not exist", "scim_target", t.cfg.Name, "role", idOrName)
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to get role %q: %w", idOrName, err)
+		}
+
+		r.roles[role.ID] = struct{}{}
+	}
+
+	return r, nil
+}
+
+// fullSync syncs all users and de-provisions users that no longer exist. If
+// force is set, all users are pushed even if they did not change locally to
+// repair changes made at the target. It returns the change feed cursor that
+// incremental syncs should continue at.
+func (r *run) fullSync(ctx context.Context, force bool) (int64, error) {
+	// changes that happen while the full sync is running are replayed by
+	// the next incremental sync.
+	seqRange, err := r.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query change feed: %w", err)
+	}
+
+	users, err := r.datastore.GetAllUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	provisioned, err := r.datastore.GetSCIMProvisionedUsers(ctx, r.target.cfg.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get provisioned users: %w", err)
+	}
+
+	exists := make(map[string]struct{}, len(users))
+	for _, usr := range users {
+		exists[usr.ID] = struct{}{}
+
+		r.record(ctx, usr.ID, r.syncUser(ctx, usr, force))
+	}
+
+	for _, p := range provisioned {
+		if _, ok := exists[p.UserID]; ok {
+			continue
+		}
+
+		r.record(ctx, p.UserID, r.deprovision(ctx, p))
+	}
+
+	return seqRange.MaxSeq, nil
+}
+
+// incrementalSync syncs all users affected by changes after cursor. If the
+// cursor has expired or a change may affect the scope of multiple users, a
+// full sync is performed instead. The second return value reports whether a
+// full sync has been performed.
+func (r *run) incrementalSync(ctx context.Context, cursor int64) (int64, bool, error) {
+	seqRange, err := r.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		return cursor, false, fmt.Errorf("failed to query change feed: %w", err)
+	}
+
+	if seqRange.MinSeq > 0 && cursor < seqRange.MinSeq-1 {
+		log.L(ctx).Warn("change feed cursor expired, performing a full sync", "scim_target", r.target.cfg.Name)
+
+		cursor, err := r.fullSync(ctx, false)
+
+		return cursor, true, err
+	}
+
+	var (
+		userIDs []string
+		seen    = make(map[string]struct{})
+	)
+
+	for {
+		events, err := r.datastore.ListChangeEventsAfter(ctx, repo.ListChangeEventsAfterParams{
+			Seq:   cursor,
+			Limit: batchSize,
+		})
+		if err != nil {
+			return cursor, false, fmt.Errorf("failed to query change feed: %w", err)
+		}
+
+		for _, e := range events {
+			cursor = e.Seq
+
+			switch changes.Type(e.Type) {
+			case changes.RoleUpdated, changes.RoleDeleted, changes.GroupUpdated, changes.GroupDeleted:
+				// roles and groups might be renamed, deleted or change
+				// the roles they grant without publishing events for
+				// affected users.
+				if r.scoped {
+					cursor, err := r.fullSync(ctx, false)
+
+					return cursor, true, err
+				}
+
+			default:
+				if e.UserID == "" {
+					continue
+				}
+
+				if _, ok := seen[e.UserID]; !ok {
+					seen[e.UserID] = struct{}{}
+					userIDs = append(userIDs, e.UserID)
+				}
+			}
+		}
+
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	for _, id := range userIDs {
+		usr, err := r.datastore.GetUserByID(ctx, id)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				r.record(ctx, id, fmt.Errorf("failed to get user: %w", err))
+				continue
+			}
+
+			p, err := r.provisioned(ctx, id)
+			if err == nil && p != nil {
+				err = r.deprovision(ctx, *p)
+			}
+
+			r.record(ctx, id, err)
+			continue
+		}
+
+		r.record(ctx, id, r.syncUser(ctx, usr, false))
+	}
+
+	return cursor, false, nil
+}
+
+func (r *run) record(ctx context.Context, userID string, err error) {
+	if errors.Is(err, errSkipped) {
+		return
+	}
+
+	if err != nil {
+		log.L(ctx).Error("failed to sync user to SCIM target", "scim_target", r.target.cfg.Name, "user_id", userID, "error", err)
+
+		r.failed++
+		r.lastErr = fmt.Errorf("user %s: %w", userID, err)
+
+		return
+	}
+
+	r.synced++
+}
+
+// errSkipped is returned by syncUser and deprovision if nothing had to be
+// done.
+var errSkipped = errors.New("skipped")
+
+// inScope returns true if usr should be provisioned to the target.
+func (r *run) inScope(ctx context.Context, usr repo.User) (bool, error) {
+	if usr.Deleted {
+		return false, nil
+	}
+
+	if !r.scoped {
+		return true, nil
+	}
+
+	// the user is in scope if the role is held through role inclusion or
+	// a group as well.
+	roles, err := r.datastore.GetEffectiveRolesForUser(ctx, usr.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	for _, role := range roles {
+		if _, ok := r.roles[role.ID]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *run) provisioned(ctx context.Context, userID string) (*repo.ScimProvisionedUser, error) {
+	p, err := r.datastore.GetSCIMProvisionedUser(ctx, repo.GetSCIMProvisionedUserParams{
+		Target: r.target.cfg.Name,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get provisioning state: %w", err)
+	}
+
+	return &p, nil
+}
+
+// syncUser creates, updates or de-provisions usr at the target. Unless force
+// is set, users are only pushed if the mapped attributes changed since the
+// last sync.
+func (r *run) syncUser(ctx context.Context, usr repo.User, force bool) error {
+	p, err := r.provisioned(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := r.inScope(ctx, usr)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if p == nil {
+			return errSkipped
+		}
+
+		return r.deprovision(ctx, *p)
+	}
+
+	fields := UserFields{
+		User: usr,
+	}
+
+	if email, err := r.datastore.GetPrimaryEmailForUserByID(ctx, usr.ID); err == nil {
+		fields.Email = email.Address
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get primary email: %w", err)
+	}
+
+	if phone, err := r.datastore.GetUserPrimaryPhoneNumber(ctx, usr.ID); err == nil {
+		fields.Phone = phone.PhoneNumber
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get primary phone number: %w", err)
+	}
+
+	resource, err := BuildResource(r.target.cfg.Attributes, fields)
+	if err != nil {
+		return err
+	}
+
+	hash, err := Hash(resource)
+	if err != nil {
+		return err
+	}
+
+	if p != nil && p.Active && p.Hash == hash && !force {
+		return errSkipped
+	}
+
+	client := r.target.client
+
+	var remoteID string
+	if p != nil {
+		remoteID = p.RemoteID
+	} else {
+		// the user might already exist at the target, for example if it
+		// has been created manually before provisioning was enabled.
+		userName, _ := resource["userName"].(string)
+
+		remoteID, err = client.FindUser(ctx, userName)
+		if err != nil {
+			return fmt.Errorf("failed to search user: %w", err)
+		}
+	}
+
+	if remoteID != "" {
+		err := client.ReplaceUser(ctx, remoteID, resource)
+		switch {
+		case IsNotFound(err):
+			// the user has been deleted at the target, create it again.
+			remoteID = ""
+		case err != nil:
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	if remoteID == "" {
+		remoteID, err = client.CreateUser(ctx, resource)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	return r.datastore.UpsertSCIMProvisionedUser(ctx, repo.UpsertSCIMProvisionedUserParams{
+		Target:   r.target.cfg.Name,
+		UserID:   usr.ID,
+		RemoteID: remoteID,
+		Hash:     hash,
+		Active:   true,
+		SyncedAt: time.Now().UTC(),
+	})
+}
+
+// deprovision deactivates or deletes a provisioned user at the target
+// depending on the configured de-provisioning mode.
+func (r *run) deprovision(ctx context.Context, p repo.ScimProvisionedUser) error {
+	client := r.target.client
+
+	remove := func() error {
+		return r.datastore.DeleteSCIMProvisionedUser(ctx, repo.DeleteSCIMProvisionedUserParams{
+			Target: p.Target,
+			UserID: p.UserID,
+		})
+	}
+
+	if r.target.cfg.Deprovision == config.DeprovisionDelete {
+		if err := client.DeleteUser(ctx, p.RemoteID); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return remove()
+	}
+
+	if !p.Active {
+		return errSkipped
+	}
+
+	if err := client.SetUserActive(ctx, p.RemoteID, false); err != nil {
+		if IsNotFound(err) {
+			return remove()
+		}
+
+		return fmt.Errorf("failed to deactivate user: %w", err)
+	}
+
+	return r.datastore.UpsertSCIMProvisionedUser(ctx, repo.UpsertSCIMProvisionedUserParams{
+		Target:   p.Target,
+		UserID:   p.UserID,
+		RemoteID: p.RemoteID,
+		Hash:     p.Hash,
+		Active:   false,
+		SyncedAt: time.Now().UTC(),
+	})
+}
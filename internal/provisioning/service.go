@@ -0,0 +1,195 @@
+package provisioning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+)
+
+const (
+	// ServiceName is the name of the SCIM provisioning service.
+	ServiceName = "cisidm.v1.ProvisioningService"
+
+	// ListTargetsProcedure is the HTTP path of the ListTargets endpoint.
+	ListTargetsProcedure = "/" + ServiceName + "/ListTargets"
+
+	// ListProvisionedUsersProcedure is the HTTP path of the
+	// ListProvisionedUsers endpoint.
+	ListProvisionedUsersProcedure = "/" + ServiceName + "/ListProvisionedUsers"
+
+	// TriggerSyncProcedure is the HTTP path of the TriggerSync endpoint.
+	TriggerSyncProcedure = "/" + ServiceName + "/TriggerSync"
+)
+
+// Target is the API representation of a SCIM target and its sync status.
+type Target struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Roles       []string `json:"roles,omitempty"`
+	Deprovision string   `json:"deprovision"`
+
+	// Cursor is the position in the change feed up to which changes have
+	// been synced.
+	Cursor           string     `json:"cursor"`
+	LastSyncTime     *time.Time `json:"lastSyncTime,omitempty"`
+	LastFullSyncTime *time.Time `json:"lastFullSyncTime,omitempty"`
+	NextFullSyncTime *time.Time `json:"nextFullSyncTime,omitempty"`
+
+	// LastError and FailedUsers report failures of the last sync run.
+	LastError   string `json:"lastError,omitempty"`
+	FailedUsers int64  `json:"failedUsers"`
+
+	ProvisionedUsers   int `json:"provisionedUsers"`
+	DeprovisionedUsers int `json:"deprovisionedUsers"`
+}
+
+// ProvisionedUser is a user that has been provisioned to a target.
+type ProvisionedUser struct {
+	UserID   string    `json:"userId"`
+	RemoteID string    `json:"remoteId"`
+	Active   bool      `json:"active"`
+	SyncTime time.Time `json:"syncTime"`
+}
+
+type ListTargetsRequest struct{}
+
+type ListTargetsResponse struct {
+	Targets []Target `json:"targets"`
+}
+
+type ListProvisionedUsersRequest struct {
+	Target string `json:"target"`
+}
+
+type ListProvisionedUsersResponse struct {
+	Users []ProvisionedUser `json:"users"`
+}
+
+type TriggerSyncRequest struct {
+	// Target is the name of the target to sync. If empty, all targets are
+	// synced.
+	Target string `json:"target,omitempty"`
+
+	// Full requests a full sync instead of an incremental one.
+	Full bool `json:"full,omitempty"`
+}
+
+type TriggerSyncResponse struct{}
+
+// Service provides access to the sync status of SCIM targets.
+type Service struct {
+	syncer *Syncer
+}
+
+// NewService returns a new provisioning service.
+func NewService(s *Syncer) *Service {
+	return &Service{
+		syncer: s,
+	}
+}
+
+// ListTargets returns all configured targets and their sync status.
+func (svc *Service) ListTargets(ctx context.Context, req *ListTargetsRequest) (*ListTargetsResponse, error) {
+	res := &ListTargetsResponse{
+		Targets: make([]Target, 0, len(svc.syncer.targets)),
+	}
+
+	for _, t := range svc.syncer.targets {
+		target := Target{
+			Name:        t.cfg.Name,
+			URL:         t.cfg.URL,
+			Roles:       t.cfg.Roles,
+			Deprovision: t.cfg.Deprovision,
+			Cursor:      "0",
+		}
+
+		// the state does not exist before the first sync
+		state, err := svc.syncer.datastore.GetSCIMTarget(ctx, t.cfg.Name)
+		switch {
+		case err == nil:
+			target.Cursor = strconv.FormatInt(state.Cursor, 10)
+			target.LastError = state.LastError
+			target.FailedUsers = state.FailedUsers
+
+			if state.LastSyncAt.Valid {
+				last := state.LastSyncAt.Time
+				target.LastSyncTime = &last
+			}
+
+			if state.LastFullSyncAt.Valid {
+				last := state.LastFullSyncAt.Time
+				next := last.Add(t.cfg.FullSyncInterval())
+
+				target.LastFullSyncTime = &last
+				target.NextFullSyncTime = &next
+			}
+
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, fmt.Errorf("failed to get sync state: %w", err)
+		}
+
+		users, err := svc.syncer.datastore.GetSCIMProvisionedUsers(ctx, t.cfg.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get provisioned users: %w", err)
+		}
+
+		for _, u := range users {
+			if u.Active {
+				target.ProvisionedUsers++
+			} else {
+				target.DeprovisionedUsers++
+			}
+		}
+
+		res.Targets = append(res.Targets, target)
+	}
+
+	return res, nil
+}
+
+// ListProvisionedUsers returns all users that have been provisioned to a
+// target, including deactivated ones.
+func (svc *Service) ListProvisionedUsers(ctx context.Context, req *ListProvisionedUsersRequest) (*ListProvisionedUsersResponse, error) {
+	if _, ok := svc.syncer.target(req.Target); !ok {
+		return nil, connect.NewError(connect.CodeNotFound, ErrUnknownTarget)
+	}
+
+	users, err := svc.syncer.datastore.GetSCIMProvisionedUsers(ctx, req.Target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioned users: %w", err)
+	}
+
+	res := &ListProvisionedUsersResponse{
+		Users: make([]ProvisionedUser, 0, len(users)),
+	}
+
+	for _, u := range users {
+		res.Users = append(res.Users, ProvisionedUser{
+			UserID:   u.UserID,
+			RemoteID: u.RemoteID,
+			Active:   u.Active,
+			SyncTime: u.SyncedAt,
+		})
+	}
+
+	return res, nil
+}
+
+// TriggerSync requests an immediate sync. The sync is performed in the
+// background, use ListTargets to check the result.
+func (svc *Service) TriggerSync(ctx context.Context, req *TriggerSyncRequest) (*TriggerSyncResponse, error) {
+	if err := svc.syncer.Trigger(req.Target, req.Full); err != nil {
+		if errors.Is(err, ErrUnknownTarget) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, err
+	}
+
+	return &TriggerSyncResponse{}, nil
+}
@@ -0,0 +1,238 @@
+// Package provisioning pushes users to external applications that implement
+// a SCIM 2.0 service provider, like wikis or ticket systems.
+//
+// Each configured target is synced by a dedicated worker. A full sync
+// reconciles all users with the target and is performed periodically.
+// In between, changes are picked up from the change feed and pushed
+// incrementally. The mapping between local users and the resources created
+// at the target is stored in the database so syncs resume after a restart.
+package provisioning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// pollInterval defines how often the change feed is checked for events
+	// published by other replicas.
+	pollInterval = 30 * time.Second
+	batchSize    = 500
+)
+
+// ErrUnknownTarget is returned if a target is not configured.
+var ErrUnknownTarget = errors.New("unknown SCIM target")
+
+// Syncer provisions users to all configured SCIM targets.
+type Syncer struct {
+	datastore *repo.Queries
+	feed      *changes.Feed
+	targets   []*target
+}
+
+type target struct {
+	cfg    *config.SCIMTarget
+	client *Client
+
+	// trigger requests an immediate sync. The value is true if a full sync
+	// is requested.
+	trigger chan bool
+}
+
+// NewSyncer returns a new syncer for targets.
+func NewSyncer(ds *repo.Queries, feed *changes.Feed, targets []*config.SCIMTarget) *Syncer {
+	s := &Syncer{
+		datastore: ds,
+		feed:      feed,
+	}
+
+	for _, cfg := range targets {
+		s.targets = append(s.targets, &target{
+			cfg:     cfg,
+			client:  NewClient(cfg),
+			trigger: make(chan bool, 1),
+		})
+	}
+
+	return s
+}
+
+func (s *Syncer) target(name string) (*target, bool) {
+	for _, t := range s.targets {
+		if t.cfg.Name == name {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
+// Trigger requests an immediate sync of the target with name. If name is
+// empty, all targets are synced.
+func (s *Syncer) Trigger(name string, full bool) error {
+	if s == nil {
+		return ErrUnknownTarget
+	}
+
+	targets := s.targets
+	if name != "" {
+		t, ok := s.target(name)
+		if !ok {
+			return ErrUnknownTarget
+		}
+
+		targets = []*target{t}
+	}
+
+	for _, t := range targets {
+		// a pending full sync must not be replaced by an incremental one.
+		select {
+		case pending := <-t.trigger:
+			full = full || pending
+		default:
+		}
+
+		select {
+		case t.trigger <- full:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Run syncs all targets until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	if s == nil || len(s.targets) == 0 {
+		return
+	}
+
+	done := make(chan struct{}, len(s.targets))
+	for _, t := range s.targets {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			s.runTarget(ctx, t)
+		}()
+	}
+
+	for range s.targets {
+		<-done
+	}
+}
+
+func (s *Syncer) runTarget(ctx context.Context, t *target) {
+	l := log.L(ctx).With("scim_target", t.cfg.Name)
+
+	if err := s.datastore.EnsureSCIMTarget(ctx, t.cfg.Name); err != nil {
+		l.Error("failed to create sync state", "error", err)
+		return
+	}
+
+	notify, unsubscribe := s.feed.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var forceFull bool
+	for {
+		if err := s.Sync(ctx, t.cfg.Name, forceFull); err != nil {
+			l.Error("failed to sync SCIM target", "error", err)
+		}
+
+		forceFull = false
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notify:
+		case forceFull = <-t.trigger:
+		}
+	}
+}
+
+// Sync performs a single sync run for the target with name. A full sync is
+// performed if full is true, the full sync interval has passed or the
+// target's cursor has expired. Otherwise only users affected by changes
+// since the last run are synced.
+//
+// Errors syncing single users are recorded in the target status but are not
+// returned. Sync must not be called concurrently for the same target.
+func (s *Syncer) Sync(ctx context.Context, name string, full bool) error {
+	t, ok := s.target(name)
+	if !ok {
+		return ErrUnknownTarget
+	}
+
+	if err := s.datastore.EnsureSCIMTarget(ctx, name); err != nil {
+		return fmt.Errorf("failed to create sync state: %w", err)
+	}
+
+	state, err := s.datastore.GetSCIMTarget(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get sync state: %w", err)
+	}
+
+	if !state.LastFullSyncAt.Valid || time.Since(state.LastFullSyncAt.Time) >= t.cfg.FullSyncInterval() {
+		full = true
+	}
+
+	r, err := s.newRun(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	cursor := state.Cursor
+	if full {
+		cursor, err = r.fullSync(ctx, true)
+	} else {
+		cursor, full, err = r.incrementalSync(ctx, state.Cursor)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	params := repo.UpdateSCIMTargetRunParams{
+		Name:        name,
+		Cursor:      cursor,
+		LastSyncAt:  sql.NullTime{Time: now, Valid: true},
+		FailedUsers: int64(r.failed),
+	}
+
+	if full {
+		params.LastFullSyncAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	switch {
+	case r.lastErr != nil:
+		params.LastError = r.lastErr.Error()
+	case !full && r.synced == 0:
+		// keep the result of the last run that actually synced users,
+		// otherwise failures would be hidden by the next idle run.
+		params.LastError = state.LastError
+		params.FailedUsers = state.FailedUsers
+	}
+
+	if err := s.datastore.UpdateSCIMTargetRun(ctx, params); err != nil {
+		return fmt.Errorf("failed to update sync state: %w", err)
+	}
+
+	if r.synced > 0 || r.failed > 0 {
+		log.L(ctx).Info("synced SCIM target", "scim_target", name, "full", full, "synced", r.synced, "failed", r.failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package provisioning_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/provisioning"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// standIn is a minimal in-memory SCIM service provider.
+type standIn struct {
+	l     sync.Mutex
+	users map[string]map[string]any
+	next  int
+}
+
+func newStandIn() *standIn {
+	return &standIn{
+		users: make(map[string]map[string]any),
+	}
+}
+
+func (s *standIn) add(user map[string]any) string {
+	s.next++
+	id := strconv.Itoa(s.next)
+
+	user["id"] = id
+	s.users[id] = user
+
+	return id
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/Users/")
+
+	var body map[string]any
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	if id != r.URL.Path && s.users[id] == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/Users":
+		userName := strings.Trim(strings.TrimPrefix(r.URL.Query().Get("filter"), "userName eq "), `"`)
+
+		resources := []any{}
+		for _, u := range s.users {
+			if u["userName"] == userName {
+				resources = append(resources, u)
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"Resources": resources})
+
+	case r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": s.add(body)})
+
+	case r.Method == http.MethodPut:
+		body["id"] = id
+		s.users[id] = body
+
+	case r.Method == http.MethodPatch:
+		op := body["Operations"].([]any)[0].(map[string]any)
+		s.users[id][op["path"].(string)] = op["value"]
+
+	case r.Method == http.MethodDelete:
+		delete(s.users, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *standIn) byUserName(userName string) map[string]any {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, u := range s.users {
+		if u["userName"] == userName {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func Test_Syncer(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite3_extended", "file::memory:?cache=shared")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+	feed := changes.NewFeed(ds, time.Hour)
+
+	role, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: "role-wiki", Name: "wiki"})
+	require.NoError(t, err)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{
+			ID:          name,
+			Username:    name,
+			DisplayName: strings.ToUpper(name),
+		})
+		require.NoError(t, err)
+
+		if name != "bob" {
+			require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: name, RoleID: role.ID}))
+		}
+	}
+
+	_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "mail", UserID: "alice", Address: "alice@example.com", IsPrimary: true})
+	require.NoError(t, err)
+
+	server := newStandIn()
+	carolID := server.add(map[string]any{"userName": "carol"})
+
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	target := &config.SCIMTarget{
+		Name:  "wiki",
+		URL:   srv.URL,
+		Token: "secret",
+		Roles: []string{"wiki"},
+	}
+	require.NoError(t, target.ApplyDefaultsAndValidate())
+
+	syncer := provisioning.NewSyncer(ds, feed, []*config.SCIMTarget{target})
+
+	// the first sync is always a full sync
+	require.NoError(t, syncer.Sync(ctx, "wiki", false))
+
+	alice := server.byUserName("alice")
+	require.NotNil(t, alice)
+	assert.Equal(t, "ALICE", alice["displayName"])
+	assert.Equal(t, "alice", alice["externalId"])
+	assert.Equal(t, true, alice["active"])
+	assert.Equal(t, []any{map[string]any{"value": "alice@example.com", "primary": true}}, alice["emails"])
+
+	// existing users are adopted instead of created
+	carol := server.byUserName("carol")
+	require.NotNil(t, carol)
+	assert.Equal(t, carolID, carol["id"])
+	assert.Equal(t, "CAROL", carol["displayName"])
+
+	// bob is not in scope
+	assert.Nil(t, server.byUserName("bob"))
+
+	// incremental sync after bob has been assigned to the role
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "bob", RoleID: role.ID}))
+	feed.Publish(ctx, changes.RoleAssigned, "bob", role.ID, nil)
+
+	require.NoError(t, syncer.Sync(ctx, "wiki", false))
+	assert.NotNil(t, server.byUserName("bob"))
+
+	// users holding the role through a group are in scope as well
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "dave", Username: "dave", DisplayName: "DAVE"})
+	require.NoError(t, err)
+
+	group, err := ds.CreateGroup(ctx, repo.CreateGroupParams{ID: "group-vets", Name: "vets"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: group.ID, RoleID: role.ID}))
+	require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: group.ID, UserID: "dave"}))
+	feed.Publish(ctx, changes.GroupMemberAdded, "dave", "", changes.GroupData{ID: group.ID, Name: group.Name})
+
+	require.NoError(t, syncer.Sync(ctx, "wiki", false))
+	assert.NotNil(t, server.byUserName("dave"))
+
+	// soft-deleted users are deactivated
+	_, err = ds.DeleteUser(ctx, "alice")
+	require.NoError(t, err)
+	feed.Publish(ctx, changes.UserDeleted, "alice", "", nil)
+
+	require.NoError(t, syncer.Sync(ctx, "wiki", false))
+	assert.Equal(t, false, server.byUserName("alice")["active"])
+
+	svc := provisioning.NewService(syncer)
+
+	res, err := svc.ListTargets(ctx, &provisioning.ListTargetsRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.Targets, 1)
+	assert.Equal(t, 3, res.Targets[0].ProvisionedUsers)
+	assert.Equal(t, 1, res.Targets[0].DeprovisionedUsers)
+	assert.Empty(t, res.Targets[0].LastError)
+
+	// users deleted at the target are re-created by a full sync
+	server.l.Lock()
+	delete(server.users, carolID)
+	server.l.Unlock()
+
+	require.NoError(t, syncer.Sync(ctx, "wiki", true))
+	assert.NotNil(t, server.byUserName("carol"))
+	assert.Equal(t, false, server.byUserName("alice")["active"])
+}
+
+func Test_BuildResource(t *testing.T) {
+	res, err := provisioning.BuildResource(map[string]string{
+		"userName":       "username",
+		"name.givenName": "first_name",
+		"phoneNumbers":   "phone",
+		"title":          "last_name",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department": "extra.department.name",
+	}, provisioning.UserFields{
+		User: repo.User{
+			Username:  "alice",
+			FirstName: "Alice",
+			Extra:     `{"department":{"name":"vet"}}`,
+		},
+		Phone: "+43123",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"},
+		"active":   true,
+		"userName": "alice",
+		"name": map[string]any{
+			"givenName": "Alice",
+		},
+		"phoneNumbers": []any{
+			map[string]any{"value": "+43123", "primary": true},
+		},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]any{
+			"department": "vet",
+		},
+	}, res)
+
+	_, err = provisioning.BuildResource(map[string]string{
+		"name":           "username",
+		"name.givenName": "first_name",
+	}, provisioning.UserFields{User: repo.User{Username: "alice", FirstName: "Alice"}})
+	assert.Error(t, err)
+}
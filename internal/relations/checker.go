@@ -0,0 +1,284 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// maxDepth limits the number of nested usersets that are evaluated when
+// checking or expanding a relation.
+const maxDepth = 32
+
+var (
+	// ErrUnknownType is returned if an object type is not defined by the
+	// schema.
+	ErrUnknownType = errors.New("unknown object type")
+
+	// ErrUnknownRelation is returned if a relation is not defined for an
+	// object type.
+	ErrUnknownRelation = errors.New("unknown relation")
+
+	// ErrMaxDepth is returned if evaluating a relation exceeds the maximum
+	// nesting depth.
+	ErrMaxDepth = errors.New("maximum relation depth exceeded")
+)
+
+// Checker evaluates relations between objects and subjects using the
+// relation tuples stored in the database and the computed usersets of the
+// schema.
+type Checker struct {
+	ds     *repo.Queries
+	schema *Schema
+}
+
+// NewChecker returns a new checker for the tuples stored in ds.
+func NewChecker(ds *repo.Queries, schema *Schema) *Checker {
+	return &Checker{
+		ds:     ds,
+		schema: schema,
+	}
+}
+
+// Schema returns the schema used by the checker.
+func (c *Checker) Schema() *Schema {
+	return c.schema
+}
+
+// Check returns true if subject has relation on object, either through a
+// relation tuple or a computed userset.
+func (c *Checker) Check(ctx context.Context, object Object, relation string, subject Subject) (bool, error) {
+	return c.check(ctx, object, relation, subject, make(map[string]bool), 0)
+}
+
+// CheckRelation is like Check but parses object and subject first. It is
+// used by the cisidm.check_relation rego builtin.
+func (c *Checker) CheckRelation(ctx context.Context, object, relation, subject string) (bool, error) {
+	o, err := ParseObject(object)
+	if err != nil {
+		return false, err
+	}
+
+	s, err := ParseSubject(subject)
+	if err != nil {
+		return false, err
+	}
+
+	return c.Check(ctx, o, relation, s)
+}
+
+func (c *Checker) check(ctx context.Context, object Object, relation string, subject Subject, visited map[string]bool, depth int) (bool, error) {
+	rel, err := c.schema.relation(object.Type, relation)
+	if err != nil {
+		return false, err
+	}
+
+	if depth > maxDepth {
+		return false, ErrMaxDepth
+	}
+
+	// a userset always contains itself.
+	if subject.Relation == relation && subject.Object() == object {
+		return true, nil
+	}
+
+	key := object.String() + "#" + relation
+	if visited[key] {
+		return false, nil
+	}
+
+	visited[key] = true
+	defer delete(visited, key)
+
+	tuples, err := c.tuples(ctx, object, relation)
+	if err != nil {
+		return false, err
+	}
+
+	for _, t := range tuples {
+		if t.Subject == subject {
+			return true, nil
+		}
+
+		if t.Subject.Relation == "" {
+			continue
+		}
+
+		ok, err := c.check(ctx, t.Subject.Object(), t.Subject.Relation, subject, visited, depth+1)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, computed := range rel.computed {
+		ok, err := c.check(ctx, object, computed, subject, visited, depth+1)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, ttu := range rel.tuplesets {
+		related, err := c.tuples(ctx, object, ttu.tupleset)
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range related {
+			if !c.hasRelation(t.Subject, ttu.relation) {
+				continue
+			}
+
+			ok, err := c.check(ctx, t.Subject.Object(), ttu.relation, subject, visited, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// ListObjects returns the IDs of all objects of type objectType on which
+// subject has relation.
+func (c *Checker) ListObjects(ctx context.Context, objectType, relation string, subject Subject) ([]string, error) {
+	if _, err := c.schema.relation(objectType, relation); err != nil {
+		return nil, err
+	}
+
+	candidates, err := c.ds.GetRelationObjectIDs(ctx, objectType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get objects: %w", err)
+	}
+
+	result := make([]string, 0, len(candidates))
+	for _, id := range candidates {
+		ok, err := c.Check(ctx, Object{Type: objectType, ID: id}, relation, subject)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// ListSubjects returns all concrete subjects that have relation on object.
+// If subjectType is set, only subjects of that type are returned.
+func (c *Checker) ListSubjects(ctx context.Context, object Object, relation string, subjectType string) ([]Subject, error) {
+	found := make(map[Subject]struct{})
+
+	if err := c.expand(ctx, object, relation, found, make(map[string]bool), 0); err != nil {
+		return nil, err
+	}
+
+	result := make([]Subject, 0, len(found))
+	for s := range found {
+		if subjectType == "" || s.Type == subjectType {
+			result = append(result, s)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Subject) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	return result, nil
+}
+
+func (c *Checker) expand(ctx context.Context, object Object, relation string, found map[Subject]struct{}, visited map[string]bool, depth int) error {
+	rel, err := c.schema.relation(object.Type, relation)
+	if err != nil {
+		return err
+	}
+
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+
+	key := object.String() + "#" + relation
+	if visited[key] {
+		return nil
+	}
+
+	// usersets are only expanded once, even if they are reachable through
+	// multiple paths.
+	visited[key] = true
+
+	tuples, err := c.tuples(ctx, object, relation)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tuples {
+		if t.Subject.Relation == "" {
+			found[t.Subject] = struct{}{}
+			continue
+		}
+
+		if err := c.expand(ctx, t.Subject.Object(), t.Subject.Relation, found, visited, depth+1); err != nil {
+			return err
+		}
+	}
+
+	for _, computed := range rel.computed {
+		if err := c.expand(ctx, object, computed, found, visited, depth+1); err != nil {
+			return err
+		}
+	}
+
+	for _, ttu := range rel.tuplesets {
+		related, err := c.tuples(ctx, object, ttu.tupleset)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range related {
+			if !c.hasRelation(t.Subject, ttu.relation) {
+				continue
+			}
+
+			if err := c.expand(ctx, t.Subject.Object(), ttu.relation, found, visited, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasRelation returns true if s is a concrete object whose type defines
+// relation. Tuple-to-userset rewrites silently skip all other subjects.
+func (c *Checker) hasRelation(s Subject, relation string) bool {
+	if s.Relation != "" {
+		return false
+	}
+
+	_, err := c.schema.relation(s.Type, relation)
+
+	return err == nil
+}
+
+func (c *Checker) tuples(ctx context.Context, object Object, relation string) ([]Tuple, error) {
+	rows, err := c.ds.GetRelationTuples(ctx, repo.GetRelationTuplesParams{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Relation:   relation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relation tuples for %s#%s: %w", object, relation, err)
+	}
+
+	tuples := make([]Tuple, len(rows))
+	for idx, r := range rows {
+		tuples[idx] = tupleFromModel(r)
+	}
+
+	return tuples, nil
+}
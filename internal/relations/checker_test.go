@@ -0,0 +1,129 @@
+package relations_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/relations"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_Checker(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	cfg := &config.Relations{
+		Types: []*config.RelationType{
+			{
+				Name: "team",
+				Relations: []*config.RelationDefinition{
+					{Name: "manager"},
+					{Name: "member", Union: []string{"manager"}},
+				},
+			},
+			{
+				Name: "folder",
+				Relations: []*config.RelationDefinition{
+					{Name: "viewer"},
+				},
+			},
+			{
+				Name: "document",
+				Relations: []*config.RelationDefinition{
+					{Name: "parent"},
+					{Name: "owner"},
+					{Name: "editor", Union: []string{"owner"}},
+					{Name: "viewer", Union: []string{"editor", "parent->viewer"}},
+				},
+			},
+		},
+	}
+	require.NoError(t, cfg.ApplyDefaultsAndValidate())
+
+	checker := relations.NewChecker(ds, relations.NewSchema(cfg))
+
+	for _, tuple := range []string{
+		"team:vets#manager@user:alice",
+		"team:vets#member@user:bob",
+		"document:1#owner@user:carol",
+		"document:1#editor@team:vets#member",
+		"document:1#parent@folder:shared",
+		"folder:shared#viewer@user:dave",
+		"document:2#editor@user:bob",
+		// cycles must not cause endless recursion
+		"team:vets#member@team:vets#member",
+	} {
+		object, rest, _ := strings.Cut(tuple, "#")
+		relation, subject, _ := strings.Cut(rest, "@")
+
+		parsed, err := relations.ParseTuple(object, relation, subject)
+		require.NoError(t, err)
+		require.NoError(t, checker.Schema().Validate(parsed))
+
+		require.NoError(t, ds.WriteRelationTuple(ctx, repo.WriteRelationTupleParams{
+			ObjectType:      parsed.Object.Type,
+			ObjectID:        parsed.Object.ID,
+			Relation:        parsed.Relation,
+			SubjectType:     parsed.Subject.Type,
+			SubjectID:       parsed.Subject.ID,
+			SubjectRelation: parsed.Subject.Relation,
+			CreatedAt:       time.Now(),
+		}))
+	}
+
+	cases := []struct {
+		object, relation, subject string
+		expected                  bool
+	}{
+		{"document:1", "owner", "user:carol", true},
+		{"document:1", "editor", "user:carol", true},
+		{"document:1", "viewer", "user:carol", true},
+		{"document:1", "editor", "user:alice", true},
+		{"document:1", "editor", "user:bob", true},
+		{"document:1", "owner", "user:bob", false},
+		{"document:1", "viewer", "user:dave", true},
+		{"document:1", "editor", "user:dave", false},
+		{"document:1", "editor", "team:vets#member", true},
+		{"document:2", "viewer", "user:alice", false},
+	}
+
+	for _, c := range cases {
+		allowed, err := checker.CheckRelation(ctx, c.object, c.relation, c.subject)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, allowed, "%s#%s@%s", c.object, c.relation, c.subject)
+	}
+
+	_, err = checker.CheckRelation(ctx, "document:1", "admin", "user:alice")
+	assert.ErrorIs(t, err, relations.ErrUnknownRelation)
+
+	objects, err := checker.ListObjects(ctx, "document", "viewer", relations.Subject{Type: "user", ID: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, objects)
+
+	objects, err = checker.ListObjects(ctx, "document", "viewer", relations.Subject{Type: "user", ID: "dave"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, objects)
+
+	subjects, err := checker.ListSubjects(ctx, relations.Object{Type: "document", ID: "1"}, "viewer", "user")
+	require.NoError(t, err)
+
+	names := make([]string, len(subjects))
+	for idx, s := range subjects {
+		names[idx] = s.String()
+	}
+	assert.Equal(t, []string{"user:alice", "user:bob", "user:carol", "user:dave"}, names)
+}
@@ -0,0 +1,113 @@
+package relations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+)
+
+// Schema holds the object types and relations that are known to the
+// relationship store.
+type Schema struct {
+	types map[string]map[string]*relation
+}
+
+type relation struct {
+	// computed lists relations of the same object whose subjects have
+	// this relation as well.
+	computed []string
+
+	// tuplesets lists relations of other objects whose subjects have this
+	// relation as well.
+	tuplesets []tupleToUserset
+}
+
+// tupleToUserset includes all subjects that have relation on the objects
+// related by tupleset.
+type tupleToUserset struct {
+	tupleset string
+	relation string
+}
+
+// NewSchema returns the schema defined by cfg. cfg must have been
+// validated already. A nil cfg results in an empty schema.
+func NewSchema(cfg *config.Relations) *Schema {
+	s := &Schema{
+		types: make(map[string]map[string]*relation),
+	}
+
+	if cfg == nil {
+		return s
+	}
+
+	for _, t := range cfg.Types {
+		relations := make(map[string]*relation, len(t.Relations))
+
+		for _, def := range t.Relations {
+			rel := new(relation)
+
+			for _, u := range def.Union {
+				if tupleset, target, ok := strings.Cut(u, "->"); ok {
+					rel.tuplesets = append(rel.tuplesets, tupleToUserset{tupleset: tupleset, relation: target})
+				} else {
+					rel.computed = append(rel.computed, u)
+				}
+			}
+
+			relations[def.Name] = rel
+		}
+
+		s.types[t.Name] = relations
+	}
+
+	return s
+}
+
+// HasType returns true if typ is defined by the schema.
+func (s *Schema) HasType(typ string) bool {
+	_, ok := s.types[typ]
+	return ok
+}
+
+func (s *Schema) relation(typ, name string) (*relation, error) {
+	relations, ok := s.types[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, typ)
+	}
+
+	rel, ok := relations[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q on type %q", ErrUnknownRelation, name, typ)
+	}
+
+	return rel, nil
+}
+
+// Validate ensures that t only refers to types and relations defined by the
+// schema.
+func (s *Schema) Validate(t Tuple) error {
+	if _, err := s.relation(t.Object.Type, t.Relation); err != nil {
+		return err
+	}
+
+	if t.Subject.Type == config.RelationSubjectUser {
+		if t.Subject.Relation != "" {
+			return fmt.Errorf("%w: users do not have relations", ErrUnknownRelation)
+		}
+
+		return nil
+	}
+
+	if t.Subject.Relation == "" {
+		if !s.HasType(t.Subject.Type) {
+			return fmt.Errorf("%w: %q", ErrUnknownType, t.Subject.Type)
+		}
+
+		return nil
+	}
+
+	_, err := s.relation(t.Subject.Type, t.Subject.Relation)
+
+	return err
+}
@@ -0,0 +1,365 @@
+package relations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// ServiceName is the name of the relationship service.
+	ServiceName = "cisidm.v1.RelationService"
+
+	// WriteTuplesProcedure is the HTTP path of the WriteTuples endpoint.
+	WriteTuplesProcedure = "/" + ServiceName + "/WriteTuples"
+
+	// DeleteTuplesProcedure is the HTTP path of the DeleteTuples endpoint.
+	DeleteTuplesProcedure = "/" + ServiceName + "/DeleteTuples"
+
+	// ReadTuplesProcedure is the HTTP path of the ReadTuples endpoint.
+	ReadTuplesProcedure = "/" + ServiceName + "/ReadTuples"
+
+	// CheckProcedure is the HTTP path of the Check endpoint.
+	CheckProcedure = "/" + ServiceName + "/Check"
+
+	// ListObjectsProcedure is the HTTP path of the ListObjects endpoint.
+	ListObjectsProcedure = "/" + ServiceName + "/ListObjects"
+
+	// ListSubjectsProcedure is the HTTP path of the ListSubjects endpoint.
+	ListSubjectsProcedure = "/" + ServiceName + "/ListSubjects"
+)
+
+// RelationTuple is the API representation of a relation tuple.
+type RelationTuple struct {
+	// Object is in the form "<type>:<id>".
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+
+	// Subject is in the form "<type>:<id>" or "<type>:<id>#<relation>".
+	Subject string `json:"subject"`
+}
+
+type WriteTuplesRequest struct {
+	Tuples []RelationTuple `json:"tuples"`
+}
+
+type WriteTuplesResponse struct{}
+
+type DeleteTuplesRequest struct {
+	Tuples []RelationTuple `json:"tuples"`
+}
+
+type DeleteTuplesResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// ReadTuplesRequest is the request message for the ReadTuples endpoint.
+// All filters are optional.
+type ReadTuplesRequest struct {
+	ObjectType  string `json:"objectType,omitempty"`
+	ObjectID    string `json:"objectId,omitempty"`
+	Relation    string `json:"relation,omitempty"`
+	SubjectType string `json:"subjectType,omitempty"`
+	SubjectID   string `json:"subjectId,omitempty"`
+}
+
+type ReadTuplesResponse struct {
+	Tuples []RelationTuple `json:"tuples"`
+}
+
+// CheckRequest is the request message for the Check endpoint. Subject
+// defaults to the calling user.
+type CheckRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject,omitempty"`
+}
+
+type CheckResponse struct {
+	Allowed bool `json:"allowed"`
+}
+
+// ListObjectsRequest is the request message for the ListObjects endpoint.
+// Subject defaults to the calling user.
+type ListObjectsRequest struct {
+	ObjectType string `json:"objectType"`
+	Relation   string `json:"relation"`
+	Subject    string `json:"subject,omitempty"`
+}
+
+type ListObjectsResponse struct {
+	// Objects holds the IDs of all matching objects.
+	Objects []string `json:"objects"`
+}
+
+// ListSubjectsRequest is the request message for the ListSubjects endpoint.
+// If SubjectType is set, only subjects of that type are returned.
+type ListSubjectsRequest struct {
+	Object      string `json:"object"`
+	Relation    string `json:"relation"`
+	SubjectType string `json:"subjectType,omitempty"`
+}
+
+type ListSubjectsResponse struct {
+	Subjects []string `json:"subjects"`
+}
+
+// Service provides access to the relationship store.
+type Service struct {
+	datastore *repo.Queries
+	checker   *Checker
+}
+
+// NewService returns a new relationship service.
+func NewService(ds *repo.Queries, checker *Checker) *Service {
+	return &Service{
+		datastore: ds,
+		checker:   checker,
+	}
+}
+
+func isSuperuser(ctx context.Context) bool {
+	claims := middleware.ClaimsFromContext(ctx)
+
+	return claims != nil &&
+		claims.AppMetadata != nil &&
+		claims.AppMetadata.Authorization != nil &&
+		slices.Contains(claims.AppMetadata.Authorization.Roles, "idm_superuser")
+}
+
+// toConnectError converts schema errors to invalid argument errors.
+func toConnectError(err error) error {
+	if errors.Is(err, ErrUnknownType) || errors.Is(err, ErrUnknownRelation) {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	return err
+}
+
+// callerSubject parses subject and defaults to the calling user. Only
+// superusers may specify other subjects.
+func callerSubject(ctx context.Context, subject string) (Subject, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return Subject{}, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	self := Subject{Type: config.RelationSubjectUser, ID: claims.Subject}
+	if subject == "" {
+		return self, nil
+	}
+
+	s, err := ParseSubject(subject)
+	if err != nil {
+		return Subject{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if s != self && !isSuperuser(ctx) {
+		return Subject{}, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you may only check your own relations"))
+	}
+
+	return s, nil
+}
+
+func (svc *Service) parseTuples(tuples []RelationTuple) ([]Tuple, error) {
+	if len(tuples) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("no tuples specified"))
+	}
+
+	result := make([]Tuple, 0, len(tuples))
+	for idx, t := range tuples {
+		parsed, err := ParseTuple(t.Object, t.Relation, t.Subject)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("tuple[%d]: %w", idx, err))
+		}
+
+		if err := svc.checker.Schema().Validate(parsed); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("tuple[%d]: %w", idx, err))
+		}
+
+		result = append(result, parsed)
+	}
+
+	return result, nil
+}
+
+// WriteTuples stores relation tuples. Tuples that already exist are
+// ignored.
+func (svc *Service) WriteTuples(ctx context.Context, req *WriteTuplesRequest) (*WriteTuplesResponse, error) {
+	tuples, err := svc.parseTuples(req.Tuples)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	return repo.RunInTransaction(ctx, svc.datastore, func(tx *repo.Queries) (*WriteTuplesResponse, error) {
+		for _, t := range tuples {
+			if t.Subject.Type == config.RelationSubjectUser {
+				if _, err := tx.GetUserByID(ctx, t.Subject.ID); err != nil {
+					if errors.Is(err, sql.ErrNoRows) {
+						return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user %q not found", t.Subject.ID))
+					}
+
+					return nil, err
+				}
+			}
+
+			if err := tx.WriteRelationTuple(ctx, repo.WriteRelationTupleParams{
+				ObjectType:      t.Object.Type,
+				ObjectID:        t.Object.ID,
+				Relation:        t.Relation,
+				SubjectType:     t.Subject.Type,
+				SubjectID:       t.Subject.ID,
+				SubjectRelation: t.Subject.Relation,
+				CreatedAt:       now,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to write tuple %s: %w", t, err)
+			}
+		}
+
+		return &WriteTuplesResponse{}, nil
+	})
+}
+
+// DeleteTuples removes relation tuples.
+func (svc *Service) DeleteTuples(ctx context.Context, req *DeleteTuplesRequest) (*DeleteTuplesResponse, error) {
+	if len(req.Tuples) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("no tuples specified"))
+	}
+
+	// tuples are not validated against the schema so tuples of removed
+	// types or relations can still be deleted.
+	tuples := make([]Tuple, 0, len(req.Tuples))
+	for idx, t := range req.Tuples {
+		parsed, err := ParseTuple(t.Object, t.Relation, t.Subject)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("tuple[%d]: %w", idx, err))
+		}
+
+		tuples = append(tuples, parsed)
+	}
+
+	return repo.RunInTransaction(ctx, svc.datastore, func(tx *repo.Queries) (*DeleteTuplesResponse, error) {
+		res := new(DeleteTuplesResponse)
+
+		for _, t := range tuples {
+			count, err := tx.DeleteRelationTuple(ctx, repo.DeleteRelationTupleParams{
+				ObjectType:      t.Object.Type,
+				ObjectID:        t.Object.ID,
+				Relation:        t.Relation,
+				SubjectType:     t.Subject.Type,
+				SubjectID:       t.Subject.ID,
+				SubjectRelation: t.Subject.Relation,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete tuple %s: %w", t, err)
+			}
+
+			res.Deleted += count
+		}
+
+		return res, nil
+	})
+}
+
+// ReadTuples returns all stored relation tuples matching the request.
+func (svc *Service) ReadTuples(ctx context.Context, req *ReadTuplesRequest) (*ReadTuplesResponse, error) {
+	rows, err := svc.datastore.GetRelationTuples(ctx, repo.GetRelationTuplesParams{
+		ObjectType:  req.ObjectType,
+		ObjectID:    req.ObjectID,
+		Relation:    req.Relation,
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tuples: %w", err)
+	}
+
+	res := &ReadTuplesResponse{
+		Tuples: make([]RelationTuple, 0, len(rows)),
+	}
+
+	for _, r := range rows {
+		t := tupleFromModel(r)
+
+		res.Tuples = append(res.Tuples, RelationTuple{
+			Object:   t.Object.String(),
+			Relation: t.Relation,
+			Subject:  t.Subject.String(),
+		})
+	}
+
+	return res, nil
+}
+
+// Check checks whether a subject has a relation on an object. Users may
+// only check their own relations, other subjects require the idm_superuser
+// role.
+func (svc *Service) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	subject, err := callerSubject(ctx, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := ParseObject(req.Object)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	allowed, err := svc.checker.Check(ctx, object, req.Relation, subject)
+	if err != nil {
+		return nil, toConnectError(err)
+	}
+
+	return &CheckResponse{Allowed: allowed}, nil
+}
+
+// ListObjects returns all objects of a type on which a subject has a
+// relation. Users may only list their own objects, other subjects require
+// the idm_superuser role.
+func (svc *Service) ListObjects(ctx context.Context, req *ListObjectsRequest) (*ListObjectsResponse, error) {
+	subject, err := callerSubject(ctx, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := svc.checker.ListObjects(ctx, req.ObjectType, req.Relation, subject)
+	if err != nil {
+		return nil, toConnectError(err)
+	}
+
+	return &ListObjectsResponse{Objects: objects}, nil
+}
+
+// ListSubjects returns all concrete subjects that have a relation on an
+// object.
+func (svc *Service) ListSubjects(ctx context.Context, req *ListSubjectsRequest) (*ListSubjectsResponse, error) {
+	object, err := ParseObject(req.Object)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	subjects, err := svc.checker.ListSubjects(ctx, object, req.Relation, req.SubjectType)
+	if err != nil {
+		return nil, toConnectError(err)
+	}
+
+	res := &ListSubjectsResponse{
+		Subjects: make([]string, len(subjects)),
+	}
+
+	for idx, s := range subjects {
+		res.Subjects[idx] = s.String()
+	}
+
+	return res, nil
+}
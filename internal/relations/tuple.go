@@ -0,0 +1,101 @@
+package relations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// Object identifies an object by type and ID, like "document:1".
+type Object struct {
+	Type string
+	ID   string
+}
+
+// ParseObject parses an object in the form "<type>:<id>".
+func ParseObject(s string) (Object, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || typ == "" || id == "" || strings.Contains(id, "#") {
+		return Object{}, fmt.Errorf("invalid object %q, expected <type>:<id>", s)
+	}
+
+	return Object{Type: typ, ID: id}, nil
+}
+
+func (o Object) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// Subject is either a concrete object like "user:alice" or, if Relation is
+// set, the set of all subjects that have Relation on the object, like
+// "team:vets#member".
+type Subject struct {
+	Type     string
+	ID       string
+	Relation string
+}
+
+// ParseSubject parses a subject in the form "<type>:<id>" or
+// "<type>:<id>#<relation>".
+func ParseSubject(s string) (Subject, error) {
+	obj, rel, hasRel := strings.Cut(s, "#")
+
+	o, err := ParseObject(obj)
+	if err != nil || (hasRel && rel == "") {
+		return Subject{}, fmt.Errorf("invalid subject %q, expected <type>:<id> or <type>:<id>#<relation>", s)
+	}
+
+	return Subject{Type: o.Type, ID: o.ID, Relation: rel}, nil
+}
+
+// Object returns the object of the subject.
+func (s Subject) Object() Object {
+	return Object{Type: s.Type, ID: s.ID}
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Type + ":" + s.ID
+	}
+
+	return s.Type + ":" + s.ID + "#" + s.Relation
+}
+
+// Tuple relates a subject to an object.
+type Tuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+// ParseTuple parses the object, relation and subject of a tuple.
+func ParseTuple(object, relation, subject string) (Tuple, error) {
+	o, err := ParseObject(object)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	if relation == "" {
+		return Tuple{}, fmt.Errorf("relation must not be empty")
+	}
+
+	s, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	return Tuple{Object: o, Relation: relation, Subject: s}, nil
+}
+
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+func tupleFromModel(m repo.RelationTuple) Tuple {
+	return Tuple{
+		Object:   Object{Type: m.ObjectType, ID: m.ObjectID},
+		Relation: m.Relation,
+		Subject:  Subject{Type: m.SubjectType, ID: m.SubjectID, Relation: m.SubjectRelation},
+	}
+}
@@ -7,6 +7,7 @@ package repo
 
 import (
 	"context"
+	"strings"
 )
 
 const createUserAddress = `-- name: CreateUserAddress :one
@@ -75,6 +76,55 @@ func (q *Queries) DeleteUserAddress(ctx context.Context, arg DeleteUserAddressPa
 	return result.RowsAffected()
 }
 
+const getAddressesForUsers = `-- name: GetAddressesForUsers :many
+SELECT
+    id, user_id, city_code, city_name, street, extra
+FROM
+    user_addresses
+WHERE
+    user_id IN (/*SLICE:user_ids*/?)
+`
+
+func (q *Queries) GetAddressesForUsers(ctx context.Context, userIds []string) ([]UserAddress, error) {
+	query := getAddressesForUsers
+	var queryParams []interface{}
+	if len(userIds) > 0 {
+		for _, v := range userIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", strings.Repeat(",?", len(userIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAddress
+	for rows.Next() {
+		var i UserAddress
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CityCode,
+			&i.CityName,
+			&i.Street,
+			&i.Extra,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserAddress = `-- name: GetUserAddress :one
 SELECT
     id, user_id, city_code, city_name, street, extra
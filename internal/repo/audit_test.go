@@ -0,0 +1,67 @@
+package repo_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_AuditLogAppendOnly(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	require.NoError(t, ds.CreateAuditEvent(ctx, repo.CreateAuditEventParams{
+		ID:         "a1",
+		CreatedAt:  time.Now(),
+		ActorID:    "alice",
+		ActorName:  "alice",
+		Action:     "UpdateProfile",
+		TargetType: "user",
+		TargetID:   "alice",
+		Before:     `{"display_name":"Ali"}`,
+		After:      `{"display_name":"Alice"}`,
+		Diff:       `{"display_name":{"old":"Ali","new":"Alice"}}`,
+		ClientIp:   "10.0.0.1",
+		Success:    true,
+	}))
+
+	for _, stmt := range []string{
+		`UPDATE audit_log SET action = 'Login' WHERE id = 'a1'`,
+		`UPDATE audit_log SET target_id = 'bob' WHERE id = 'a1'`,
+		`UPDATE audit_log SET after = '{}' WHERE id = 'a1'`,
+		`UPDATE audit_log SET diff = '{}' WHERE id = 'a1'`,
+		`UPDATE audit_log SET actor_name = 'bob' WHERE id = 'a1'`,
+		`DELETE FROM audit_log WHERE id = 'a1'`,
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		assert.Error(t, err, stmt)
+	}
+
+	// redacting the snapshots and the actor is allowed
+	require.NoError(t, ds.RedactAuditEventSnapshot(ctx, repo.RedactAuditEventSnapshotParams{ID: "a1", Diff: `{"display_name":{}}`}))
+	require.NoError(t, ds.RedactUserAuditActor(ctx, "alice"))
+
+	records, err := ds.ListAuditEvents(ctx, repo.ListAuditEventsParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	assert.Equal(t, "UpdateProfile", records[0].Action)
+	assert.Equal(t, "alice", records[0].ActorID)
+	assert.Empty(t, records[0].ActorName)
+	assert.Empty(t, records[0].ClientIp)
+	assert.Empty(t, records[0].Before)
+	assert.Equal(t, `{"display_name":{}}`, records[0].Diff)
+}
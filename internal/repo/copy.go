@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// ErrDatabaseNotEmpty is returned by CopyData if the destination database
+// already contains users or roles.
+var ErrDatabaseNotEmpty = errors.New("destination database is not empty")
+
+// copyTables lists all tables in the order they must be copied to satisfy
+// foreign key constraints. Short-lived cache entries, maintenance job leases
+// and search documents, which are rebuilt on startup, are not copied.
+var copyTables = []string{
+	"users",
+	"user_addresses",
+	"user_emails",
+	"user_phone_numbers",
+	"mfa_backup_codes",
+	"webauthn_creds",
+	"webpush_subscriptions",
+	"token_invalidation",
+	"roles",
+	"role_assignments",
+	"role_inclusions",
+	"role_permissions",
+	"user_groups",
+	"user_group_members",
+	"user_group_roles",
+	"user_group_subgroups",
+	"role_requests",
+	"registration_tokens",
+	"user_api_tokens",
+	"user_api_token_roles",
+	"audit_log",
+	"webhook_deliveries",
+	"change_events",
+	"scim_external_ids",
+	"scim_targets",
+	"scim_provisioned_users",
+	"erasure_requests",
+	"relation_tuples",
+	"service_accounts",
+}
+
+// serialTables lists all tables with a BIGSERIAL seq column whose sequence
+// must be updated after rows have been copied to PostgreSQL.
+var serialTables = []string{
+	"audit_log",
+	"webhook_deliveries",
+	"change_events",
+}
+
+// CopyData copies all data from src to dst. Both databases are migrated to
+// the latest schema first and dst must not contain any users or roles. All
+// rows are copied in a single transaction so a failed copy can simply be
+// retried.
+func CopyData(ctx context.Context, src, dst *sql.DB) error {
+	if _, err := Migrate(ctx, src); err != nil {
+		return fmt.Errorf("failed to migrate source database: %w", err)
+	}
+
+	if _, err := Migrate(ctx, dst); err != nil {
+		return fmt.Errorf("failed to migrate destination database: %w", err)
+	}
+
+	for _, table := range []string{"users", "roles"} {
+		var count int64
+		if err := dst.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count %s: %w", table, err)
+		}
+
+		if count > 0 {
+			return fmt.Errorf("%w: table %s contains %d rows", ErrDatabaseNotEmpty, table, count)
+		}
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to prepare transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.L(ctx).Error("failed to rollback transaction", "error", err)
+		}
+	}()
+
+	for _, table := range copyTables {
+		n, err := copyTable(ctx, src, tx, table)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+
+		log.L(ctx).Info("copied table", "table", table, "rows", n)
+	}
+
+	if DialectOf(dst) == DialectPostgres {
+		for _, table := range serialTables {
+			query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'seq'), COALESCE(MAX(seq), 0) + 1, false) FROM %s", table, table)
+
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to update sequence for %s: %w", table, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func copyTable(ctx context.Context, src *sql.DB, dst *sql.Tx, table string) (int, error) {
+	rows, err := src.QueryContext(ctx, "SELECT * FROM "+table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for idx, col := range columns {
+		quoted[idx] = `"` + col + `"`
+		placeholders[idx] = "?"
+	}
+
+	stmt, err := dst.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(quoted, ", "),
+		strings.Join(placeholders, ", "),
+	))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var count int
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for idx := range values {
+			ptrs[idx] = &values[idx]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return count, err
+		}
+
+		// SQLite may return TEXT values as []byte which would otherwise be
+		// sent as binary data.
+		for idx, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[idx] = string(b)
+			}
+		}
+
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, rows.Err()
+}
@@ -7,6 +7,7 @@ package repo
 
 import (
 	"context"
+	"strings"
 )
 
 const createEMail = `-- name: CreateEMail :one
@@ -130,6 +131,54 @@ func (q *Queries) GetEmailsForUserByID(ctx context.Context, userID string) ([]Us
 	return items, nil
 }
 
+const getEmailsForUsers = `-- name: GetEmailsForUsers :many
+SELECT
+	id, user_id, address, verified, is_primary
+FROM
+	user_emails
+WHERE
+	user_id IN (/*SLICE:user_ids*/?)
+`
+
+func (q *Queries) GetEmailsForUsers(ctx context.Context, userIds []string) ([]UserEmail, error) {
+	query := getEmailsForUsers
+	var queryParams []interface{}
+	if len(userIds) > 0 {
+		for _, v := range userIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", strings.Repeat(",?", len(userIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserEmail
+	for rows.Next() {
+		var i UserEmail
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Address,
+			&i.Verified,
+			&i.IsPrimary,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPrimaryEmailForUserByID = `-- name: GetPrimaryEmailForUserByID :one
 SELECT
 	id, user_id, address, verified, is_primary
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// EraseUserData deletes all rows that belong to the user with the given ID,
+// except for the user record itself. Foreign keys are not enforced by all
+// backends so rows are deleted explicitly. Webhook deliveries that carry data
+// of the user are deleted as well, whether they have been sent or not.
+//
+// Audit log records and change events are kept but redacted: snapshots of the
+// user are removed, diffs keep only the names of the changed fields and the
+// username is removed from change events. It should be called within a
+// transaction.
+func (q *Queries) EraseUserData(ctx context.Context, userID string) error {
+	for _, step := range []struct {
+		what string
+		fn   func(context.Context, string) error
+	}{
+		{"emails", q.EraseUserEmails},
+		{"phone numbers", q.EraseUserPhoneNumbers},
+		{"addresses", q.EraseUserAddresses},
+		{"passkeys", q.EraseUserWebauthnCreds},
+		{"notification subscriptions", q.EraseUserWebPushSubscriptions},
+		{"api token roles", q.EraseUserAPITokenRoles},
+		{"api tokens", q.EraseUserAPITokens},
+		{"role assignments", q.EraseUserRoleAssignments},
+		{"group memberships", q.EraseUserGroupMemberships},
+		{"role requests", q.EraseUserRoleRequests},
+		{"relation tuples", q.EraseUserRelationTuples},
+		{"recovery codes", q.RemoveAllRecoveryCodes},
+		{"scim external ids", q.EraseUserSCIMExternalIDs},
+		{"webhook deliveries", q.EraseUserWebhookDeliveries},
+		{"search document", q.DeleteUserSearchDocument},
+		{"change events", q.EraseUserChangeEvents},
+		{"audit log actor", q.RedactUserAuditActor},
+		{"audit log snapshots", q.redactUserAuditSnapshots},
+	} {
+		if err := step.fn(ctx, userID); err != nil {
+			return fmt.Errorf("failed to erase %s: %w", step.what, err)
+		}
+	}
+
+	return nil
+}
+
+// redactUserAuditSnapshots clears the before and after snapshots of all audit
+// log records that target the user and replaces their diffs with the names of
+// the changed fields.
+func (q *Queries) redactUserAuditSnapshots(ctx context.Context, userID string) error {
+	records, err := q.ListUserAuditSnapshots(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		diff, err := redactDiff(r.Diff)
+		if err != nil {
+			return fmt.Errorf("record %s: %w", r.ID, err)
+		}
+
+		if err := q.RedactAuditEventSnapshot(ctx, RedactAuditEventSnapshotParams{
+			Diff: diff,
+			ID:   r.ID,
+		}); err != nil {
+			return fmt.Errorf("record %s: %w", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// redactDiff removes the old and new values from an audit log diff and keeps
+// only the names of the changed fields.
+func redactDiff(diff string) (string, error) {
+	if diff == "" {
+		return "", nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(diff), &fields); err != nil {
+		return "", fmt.Errorf("failed to decode diff: %w", err)
+	}
+
+	redacted := make(map[string]struct{}, len(fields))
+	for name := range fields {
+		redacted[name] = struct{}{}
+	}
+
+	blob, err := json.Marshal(redacted)
+	if err != nil {
+		return "", err
+	}
+
+	return string(blob), nil
+}
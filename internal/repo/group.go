@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrGroupNestingCycle is returned by NestGroup if nesting the group would
+// create a cycle.
+var ErrGroupNestingCycle = errors.New("group nesting would create a cycle")
+
+// NestGroup makes the group with subgroupID a subgroup of the group with
+// groupID. It returns ErrGroupNestingCycle if groupID is already a subgroup
+// of subgroupID, directly or transitively. NestGroup should be called
+// within a transaction.
+func (q *Queries) NestGroup(ctx context.Context, groupID, subgroupID string) error {
+	if groupID == subgroupID {
+		return ErrGroupNestingCycle
+	}
+
+	subgroups, err := q.GetEffectiveSubgroups(ctx, subgroupID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve subgroups: %w", err)
+	}
+
+	for _, g := range subgroups {
+		if g.ID == groupID {
+			return ErrGroupNestingCycle
+		}
+	}
+
+	return q.AddSubgroup(ctx, AddSubgroupParams{
+		GroupID:    groupID,
+		SubgroupID: subgroupID,
+	})
+}
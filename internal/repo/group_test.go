@@ -0,0 +1,106 @@
+package repo_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func groupNames(groups []repo.UserGroup) []string {
+	names := make([]string, len(groups))
+	for idx, g := range groups {
+		names[idx] = g.Name
+	}
+
+	return names
+}
+
+func Test_Groups(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, name := range []string{"clinic", "surgery", "vets"} {
+		_, err := ds.CreateGroup(ctx, repo.CreateGroupParams{ID: name, Name: name, Metadata: "{}"})
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{"employee", "surgeon", "vet"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: name, Name: name})
+		require.NoError(t, err)
+	}
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	// surgery -> vets -> clinic
+	require.NoError(t, ds.NestGroup(ctx, "vets", "surgery"))
+	require.NoError(t, ds.NestGroup(ctx, "clinic", "vets"))
+
+	require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: "surgery", UserID: "alice"}))
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "clinic", RoleID: "employee"}))
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "surgery", RoleID: "surgeon"}))
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "vet"}))
+
+	groups, err := ds.GetEffectiveGroupsForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"clinic", "surgery", "vets"}, groupNames(groups))
+
+	roles, err := ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "surgeon", "vet"}, roleNames(roles))
+
+	// members of surgery receive the roles of all parent groups
+	roles, err = ds.GetEffectiveGroupRoles(ctx, "surgery")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "surgeon"}, roleNames(roles))
+
+	roles, err = ds.GetEffectiveGroupRoles(ctx, "vets")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee"}, roleNames(roles))
+
+	// adding an existing member updates the owner flag
+	require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: "surgery", UserID: "alice", Owner: true}))
+
+	member, err := ds.GetGroupMember(ctx, repo.GetGroupMemberParams{GroupID: "surgery", UserID: "alice"})
+	require.NoError(t, err)
+	assert.True(t, member.Owner)
+
+	t.Run("cycles", func(t *testing.T) {
+		assert.ErrorIs(t, ds.NestGroup(ctx, "vets", "vets"), repo.ErrGroupNestingCycle)
+		assert.ErrorIs(t, ds.NestGroup(ctx, "surgery", "clinic"), repo.ErrGroupNestingCycle)
+	})
+
+	// removing the nesting drops the memberships and roles of the parent
+	// groups.
+	count, err := ds.RemoveSubgroup(ctx, repo.RemoveSubgroupParams{GroupID: "vets", SubgroupID: "surgery"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	groups, err = ds.GetEffectiveGroupsForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"surgery"}, groupNames(groups))
+
+	roles, err = ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"surgeon", "vet"}, roleNames(roles))
+
+	// deleting a group removes all memberships
+	_, err = ds.DeleteGroup(ctx, "surgery")
+	require.NoError(t, err)
+
+	groups, err = ds.GetEffectiveGroupsForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
@@ -4,29 +4,113 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"strings"
 
 	migrate "github.com/rubenv/sql-migrate"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 )
 
-//go:embed sql/migrations/*
+//go:embed sql/migrations/* sql/postgres/migrations/*
 var dbMigrations embed.FS
 
-const sqlDialect = "sqlite3"
+// Dialect is the SQL dialect of a database.
+type Dialect string
 
-func Migrate(ctx context.Context, db *sql.DB) (int, error) {
-	migrations := migrate.EmbedFileSystemMigrationSource{
+const (
+	DialectSQLite   Dialect = "sqlite3"
+	DialectPostgres Dialect = "postgres"
+)
+
+// DialectFromURL returns the dialect for a database URL. postgres:// and
+// postgresql:// URLs select PostgreSQL, everything else is treated as a
+// SQLite file.
+func DialectFromURL(databaseURL string) Dialect {
+	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
+		return DialectPostgres
+	}
+
+	return DialectSQLite
+}
+
+// DialectOf returns the dialect of a database opened using Open.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*postgresDriver); ok {
+		return DialectPostgres
+	}
+
+	return DialectSQLite
+}
+
+// Open opens the database at databaseURL using the driver for its dialect.
+func Open(databaseURL string) (*sql.DB, error) {
+	driverName := "sqlite3_extended"
+	if DialectFromURL(databaseURL) == DialectPostgres {
+		driverName = "postgres_extended"
+	}
+
+	return sql.Open(driverName, databaseURL)
+}
+
+// ErrUnknownMigration is returned by CheckSchema if a database has been
+// migrated by a newer version of cisidm.
+var ErrUnknownMigration = errors.New("database contains unknown migrations")
+
+func migrationSource(dialect Dialect) migrate.EmbedFileSystemMigrationSource {
+	root := "sql/migrations"
+	if dialect == DialectPostgres {
+		root = "sql/postgres/migrations"
+	}
+
+	return migrate.EmbedFileSystemMigrationSource{
 		FileSystem: dbMigrations,
-		Root:       "sql/migrations",
+		Root:       root,
 	}
+}
+
+// CheckSchema verifies that db contains a schema created by cisidm that can
+// be migrated by this version. It returns the number of applied migrations.
+func CheckSchema(db *sql.DB) (int, error) {
+	dialect := DialectOf(db)
+
+	known, err := migrationSource(dialect).FindMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make(map[string]struct{}, len(known))
+	for _, m := range known {
+		ids[m.Id] = struct{}{}
+	}
+
+	records, err := migrate.GetMigrationRecords(db, string(dialect))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get migration records: %w", err)
+	}
+
+	if len(records) == 0 {
+		return 0, fmt.Errorf("no migrations have been applied")
+	}
+
+	for _, r := range records {
+		if _, ok := ids[r.Id]; !ok {
+			return len(records), fmt.Errorf("%w: %s", ErrUnknownMigration, r.Id)
+		}
+	}
+
+	return len(records), nil
+}
+
+func Migrate(ctx context.Context, db *sql.DB) (int, error) {
+	dialect := DialectOf(db)
 
-	n, err := migrate.Exec(db, sqlDialect, migrations, migrate.Up)
+	n, err := migrate.Exec(db, string(dialect), migrationSource(dialect), migrate.Up)
 	if err != nil {
 		return n, err
 	}
 
-	records, err := migrate.GetMigrationRecords(db, sqlDialect)
+	records, err := migrate.GetMigrationRecords(db, string(dialect))
 	if err != nil {
 		log.L(ctx).Error("failed to get migration records", "error", err)
 
@@ -9,6 +9,71 @@ import (
 	"time"
 )
 
+type ActiveRoleAssignment struct {
+	UserID     string
+	RoleID     string
+	ValidFrom  sql.NullTime
+	ValidUntil sql.NullTime
+}
+
+type AuditLog struct {
+	Seq        int64
+	ID         string
+	CreatedAt  time.Time
+	ActorID    string
+	ActorName  string
+	ActorKind  string
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     string
+	After      string
+	Diff       string
+	ClientIp   string
+	UserAgent  string
+	Success    bool
+	Error      string
+}
+
+type CacheEntry struct {
+	Key       string
+	Value     string
+	ExpiresAt sql.NullTime
+}
+
+type ChangeEvent struct {
+	Seq       int64
+	ID        string
+	Type      string
+	UserID    string
+	RoleID    string
+	Payload   string
+	CreatedAt time.Time
+}
+
+type ErasureRequest struct {
+	ID          string
+	UserID      string
+	Username    string
+	Mode        string
+	Status      string
+	Reason      string
+	CreatedAt   time.Time
+	DecidedBy   string
+	DecidedAt   sql.NullTime
+	CompletedAt sql.NullTime
+}
+
+type MaintenanceJob struct {
+	Name           string
+	LeaseHolder    string
+	LeaseExpiresAt sql.NullTime
+	LastRunAt      sql.NullTime
+	LastDurationMs int64
+	LastAffected   int64
+	LastError      string
+}
+
 type MfaBackupCode struct {
 	Code   string
 	UserID string
@@ -23,6 +88,16 @@ type RegistrationToken struct {
 	CreatedAt    time.Time
 }
 
+type RelationTuple struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+	CreatedAt       time.Time
+}
+
 type Role struct {
 	ID              string
 	Name            string
@@ -32,8 +107,16 @@ type Role struct {
 }
 
 type RoleAssignment struct {
-	UserID string
-	RoleID string
+	UserID         string
+	RoleID         string
+	ValidFrom      sql.NullTime
+	ValidUntil     sql.NullTime
+	ExpiryNotified bool
+}
+
+type RoleInclusion struct {
+	RoleID         string
+	IncludedRoleID string
 }
 
 type RolePermission struct {
@@ -41,6 +124,51 @@ type RolePermission struct {
 	RoleID     string
 }
 
+type RoleRequest struct {
+	ID                  string
+	UserID              string
+	RoleID              string
+	Justification       string
+	RequestedValidUntil sql.NullTime
+	Status              string
+	CreatedAt           time.Time
+	DecidedBy           sql.NullString
+	DecidedAt           sql.NullTime
+	DecisionComment     string
+	ValidFrom           sql.NullTime
+	ValidUntil          sql.NullTime
+}
+
+type ScimExternalID struct {
+	ResourceType string
+	ResourceID   string
+	ExternalID   string
+}
+
+type ScimProvisionedUser struct {
+	Target   string
+	UserID   string
+	RemoteID string
+	Hash     string
+	Active   bool
+	SyncedAt time.Time
+}
+
+type ScimTarget struct {
+	Name           string
+	Cursor         int64
+	LastSyncAt     sql.NullTime
+	LastFullSyncAt sql.NullTime
+	LastError      string
+	FailedUsers    int64
+}
+
+type ServiceAccount struct {
+	UserID      string
+	Description string
+	CreatedAt   time.Time
+}
+
 type TokenInvalidation struct {
 	TokenID   string
 	UserID    string
@@ -60,6 +188,7 @@ type User struct {
 	Password    string
 	TotpSecret  sql.NullString
 	Deleted     bool
+	DeletedAt   sql.NullTime
 }
 
 type UserAddress struct {
@@ -93,6 +222,29 @@ type UserEmail struct {
 	IsPrimary bool
 }
 
+type UserGroup struct {
+	ID          string
+	Name        string
+	Description string
+	Metadata    string
+}
+
+type UserGroupMember struct {
+	GroupID string
+	UserID  string
+	Owner   bool
+}
+
+type UserGroupRole struct {
+	GroupID string
+	RoleID  string
+}
+
+type UserGroupSubgroup struct {
+	GroupID    string
+	SubgroupID string
+}
+
 type UserPhoneNumber struct {
 	ID          string
 	UserID      string
@@ -101,6 +253,18 @@ type UserPhoneNumber struct {
 	Verified    bool
 }
 
+type UserSearchDocument struct {
+	UserID             string
+	Username           string
+	Names              string
+	Emails             string
+	Phones             string
+	ExtraPublic        string
+	ExtraAuthenticated string
+	ExtraPrivate       string
+	Restricted         string
+}
+
 type WebauthnCred struct {
 	ID           string
 	UserID       string
@@ -111,6 +275,23 @@ type WebauthnCred struct {
 	ClientDevice string
 }
 
+type WebhookDelivery struct {
+	Seq            int64
+	ID             string
+	Webhook        string
+	EventID        string
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int64
+	CreatedAt      time.Time
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	LastStatusCode int64
+	LastError      string
+	LeaseUntil     sql.NullTime
+}
+
 type WebpushSubscription struct {
 	ID        string
 	UserID    string
@@ -7,6 +7,7 @@ package repo
 
 import (
 	"context"
+	"strings"
 )
 
 const createUserPhoneNumber = `-- name: CreateUserPhoneNumber :one
@@ -131,6 +132,54 @@ func (q *Queries) GetPhoneNumbersByUserID(ctx context.Context, userID string) ([
 	return items, nil
 }
 
+const getPhoneNumbersForUsers = `-- name: GetPhoneNumbersForUsers :many
+SELECT
+	id, user_id, phone_number, is_primary, verified
+FROM
+	user_phone_numbers
+WHERE
+	user_id IN (/*SLICE:user_ids*/?)
+`
+
+func (q *Queries) GetPhoneNumbersForUsers(ctx context.Context, userIds []string) ([]UserPhoneNumber, error) {
+	query := getPhoneNumbersForUsers
+	var queryParams []interface{}
+	if len(userIds) > 0 {
+		for _, v := range userIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", strings.Repeat(",?", len(userIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserPhoneNumber
+	for rows.Next() {
+		var i UserPhoneNumber
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.PhoneNumber,
+			&i.IsPrimary,
+			&i.Verified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserPrimaryPhoneNumber = `-- name: GetUserPrimaryPhoneNumber :one
 SELECT
 	id, user_id, phone_number, is_primary, verified
@@ -0,0 +1,258 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+//go:embed sql/postgres/queries/*
+var postgresQueryFiles embed.FS
+
+// postgresQueries holds PostgreSQL specific replacements for sqlc queries
+// indexed by query name. Queries that are not listed here are shared between
+// both dialects and only need their placeholders rewritten.
+var postgresQueries = mustLoadPostgresQueries()
+
+// translatedQueries caches the PostgreSQL version of the queries generated by
+// sqlc indexed by query name so the cache cannot grow beyond the number of
+// queries. Queries built at runtime, like the ones of ListUsersPage, are not
+// cached since each combination of filters results in a different query.
+var translatedQueries sync.Map
+
+// translatedQuery is a cache entry of translatedQueries.
+type translatedQuery struct {
+	query      string
+	translated string
+}
+
+func init() {
+	sql.Register("postgres_extended", &postgresDriver{})
+}
+
+// postgresDriver wraps lib/pq and translates the SQLite queries generated by
+// sqlc to PostgreSQL. Since the translation happens at the driver level,
+// Queries works the same for both *sql.DB and *sql.Tx.
+type postgresDriver struct {
+	pq.Driver
+}
+
+func (d *postgresDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, ok := conn.(postgresInnerConn)
+	if !ok {
+		conn.Close()
+
+		return nil, fmt.Errorf("unsupported postgres connection type %T", conn)
+	}
+
+	return &postgresConn{postgresInnerConn: inner}, nil
+}
+
+// postgresInnerConn lists the driver interfaces implemented by lib/pq that
+// are used by database/sql.
+type postgresInnerConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type postgresConn struct {
+	postgresInnerConn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.postgresInnerConn.Prepare(translateQuery(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.postgresInnerConn.PrepareContext(ctx, translateQuery(query))
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.postgresInnerConn.QueryContext(ctx, translateQuery(query), args)
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.postgresInnerConn.ExecContext(ctx, translateQuery(query), args)
+}
+
+// translateQuery returns the PostgreSQL version of query. Queries generated
+// by sqlc start with a "-- name: " comment which is used to lookup a dialect
+// specific replacement. All other queries have their placeholders rewritten.
+func translateQuery(query string) string {
+	name, ok := queryName(query)
+	if !ok {
+		return Rebind(query)
+	}
+
+	if translated, ok := postgresQueries[name]; ok {
+		return translated
+	}
+
+	// queries using sqlc.slice are expanded depending on the number of
+	// values so only the first variant is cached.
+	if cached, ok := translatedQueries.Load(name); ok && cached.(translatedQuery).query == query {
+		return cached.(translatedQuery).translated
+	}
+
+	translated := Rebind(query)
+	translatedQueries.LoadOrStore(name, translatedQuery{query: query, translated: translated})
+
+	return translated
+}
+
+// queryName returns the name of a query generated by sqlc.
+func queryName(query string) (string, bool) {
+	header, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(header, " ")
+
+	return name, name != ""
+}
+
+// Rebind rewrites SQLite style placeholders (? and ?NNN) to PostgreSQL style
+// placeholders ($1, $NNN). Question marks in string literals, quoted
+// identifiers and comments are left untouched.
+func Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b      strings.Builder
+		n      int
+		quote  byte
+		inLine bool
+		inBlk  bool
+	)
+
+	b.Grow(len(query) + 8)
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case inLine:
+			if c == '\n' {
+				inLine = false
+			}
+
+		case inBlk:
+			if c == '*' && i+1 < len(query) && query[i+1] == '/' {
+				inBlk = false
+				b.WriteByte(c)
+				i++
+				c = query[i]
+			}
+
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"':
+			quote = c
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			inLine = true
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			inBlk = true
+
+		case c == '?':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+
+			b.WriteByte('$')
+			if j > i+1 {
+				b.WriteString(query[i+1 : j])
+			} else {
+				n++
+				fmt.Fprintf(&b, "%d", n)
+			}
+
+			i = j - 1
+
+			continue
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// mustLoadPostgresQueries parses all query files in sql/postgres/queries.
+// The files use the same "-- name: " annotations as the sqlc query files.
+func mustLoadPostgresQueries() map[string]string {
+	queries := make(map[string]string)
+
+	err := fs.WalkDir(postgresQueryFiles, "sql/postgres/queries", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := postgresQueryFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var (
+			name    string
+			current strings.Builder
+		)
+
+		flush := func() {
+			if name != "" {
+				queries[name] = strings.TrimSpace(current.String()) + "\n"
+			}
+
+			current.Reset()
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if n, ok := queryName(line); ok {
+				flush()
+				name = n
+			}
+
+			current.WriteString(line)
+			current.WriteString("\n")
+		}
+
+		flush()
+
+		return scanner.Err()
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to load postgres queries: %s", err))
+	}
+
+	return queries
+}
@@ -0,0 +1,68 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_Rebind(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"SELECT * FROM users", "SELECT * FROM users"},
+		{"SELECT * FROM users WHERE id = ? AND deleted = ?", "SELECT * FROM users WHERE id = $1 AND deleted = $2"},
+		{"UPDATE t SET a = ?2 WHERE b = ?1 OR ?1 IS NULL", "UPDATE t SET a = $2 WHERE b = $1 OR $1 IS NULL"},
+		{"SELECT '?', \"a?\" FROM t WHERE x = ?", "SELECT '?', \"a?\" FROM t WHERE x = $1"},
+		{"SELECT 'it''s ?' FROM t WHERE x = ?", "SELECT 'it''s ?' FROM t WHERE x = $1"},
+		{"-- why?\nSELECT /* or? */ ? FROM t", "-- why?\nSELECT /* or? */ $1 FROM t"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.out, repo.Rebind(c.in), c.in)
+	}
+}
+
+func Test_CopyData(t *testing.T) {
+	ctx := context.Background()
+
+	open := func(name string) *sql.DB {
+		db, err := repo.Open("file:" + name + "?mode=memory&cache=shared")
+		require.NoError(t, err)
+		db.SetMaxOpenConns(1)
+
+		t.Cleanup(func() { db.Close() })
+
+		return db
+	}
+
+	src := open("copy-src")
+	dst := open("copy-dst")
+
+	_, err := repo.Migrate(ctx, src)
+	require.NoError(t, err)
+
+	ds := repo.New(src)
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	role, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: "admin", Name: "admin"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: role.ID}))
+
+	require.NoError(t, repo.CopyData(ctx, src, dst))
+
+	roles, err := repo.New(dst).GetRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, "admin", roles[0].Name)
+
+	// copying into a database that already contains data is rejected
+	assert.ErrorIs(t, repo.CopyData(ctx, src, dst), repo.ErrDatabaseNotEmpty)
+}
@@ -0,0 +1,79 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_RoleAssignmentValidity(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, name := range []string{"employee", "expired", "intern", "scheduled"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: name, Name: name})
+		require.NoError(t, err)
+	}
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+
+	past := sql.NullTime{Time: time.Now().Add(-time.Hour).UTC(), Valid: true}
+	future := sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true}
+
+	for _, p := range []repo.UpsertRoleAssignmentParams{
+		{UserID: "alice", RoleID: "employee"},
+		{UserID: "alice", RoleID: "expired", ValidUntil: past},
+		{UserID: "alice", RoleID: "intern", ValidFrom: past, ValidUntil: future},
+		{UserID: "alice", RoleID: "scheduled", ValidFrom: future},
+	} {
+		require.NoError(t, ds.UpsertRoleAssignment(ctx, p))
+	}
+
+	roles, err := ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "intern"}, roleNames(roles))
+
+	roles, err = ds.GetRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"employee", "intern"}, roleNames(roles))
+
+	users, err := ds.GetUsersByRole(ctx, "expired")
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	// API tokens only keep the roles their owner still holds
+	require.NoError(t, ds.CreateAPIToken(ctx, repo.CreateAPITokenParams{ID: "t1", Token: "t1", Name: "token", UserID: "alice"}))
+	for _, role := range []string{"employee", "expired"} {
+		require.NoError(t, ds.AddRoleToToken(ctx, repo.AddRoleToTokenParams{TokenID: "t1", RoleID: role}))
+	}
+
+	roles, err = ds.GetEffectiveRolesForToken(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee"}, roleNames(roles))
+
+	// assigning the role again replaces the validity period
+	require.NoError(t, ds.UpsertRoleAssignment(ctx, repo.UpsertRoleAssignmentParams{UserID: "alice", RoleID: "expired"}))
+
+	roles, err = ds.GetEffectiveRolesForToken(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "expired"}, roleNames(roles))
+
+	removed, err := ds.DeleteExpiredRoleAssignments(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
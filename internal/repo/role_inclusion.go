@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRoleInclusionCycle is returned by IncludeRole if the inclusion would
+// create a cycle.
+var ErrRoleInclusionCycle = errors.New("role inclusion would create a cycle")
+
+// IncludeRole lets the role with roleID include the role with includedID.
+// It returns ErrRoleInclusionCycle if roleID is already included by
+// includedID, directly or transitively. IncludeRole should be called within
+// a transaction.
+func (q *Queries) IncludeRole(ctx context.Context, roleID, includedID string) error {
+	if roleID == includedID {
+		return ErrRoleInclusionCycle
+	}
+
+	effective, err := q.GetEffectiveRolesForRole(ctx, includedID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve included roles: %w", err)
+	}
+
+	for _, r := range effective {
+		if r.ID == roleID {
+			return ErrRoleInclusionCycle
+		}
+	}
+
+	return q.AddRoleInclusion(ctx, AddRoleInclusionParams{
+		RoleID:         roleID,
+		IncludedRoleID: includedID,
+	})
+}
@@ -0,0 +1,87 @@
+package repo_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func roleNames(roles []repo.Role) []string {
+	names := make([]string, len(roles))
+	for idx, r := range roles {
+		names[idx] = r.Name
+	}
+
+	return names
+}
+
+func Test_RoleInclusions(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, name := range []string{"admin", "employee", "guest", "vet"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: name, Name: name})
+		require.NoError(t, err)
+	}
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "vet"}))
+
+	// vet -> employee -> guest, admin -> employee
+	require.NoError(t, ds.IncludeRole(ctx, "vet", "employee"))
+	require.NoError(t, ds.IncludeRole(ctx, "employee", "guest"))
+	require.NoError(t, ds.IncludeRole(ctx, "admin", "employee"))
+
+	// including a role twice is a no-op
+	require.NoError(t, ds.IncludeRole(ctx, "vet", "employee"))
+
+	included, err := ds.GetIncludedRoles(ctx, "vet")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee"}, roleNames(included))
+
+	effective, err := ds.GetEffectiveRolesForRole(ctx, "vet")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "guest", "vet"}, roleNames(effective))
+
+	effective, err = ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"employee", "guest", "vet"}, roleNames(effective))
+
+	t.Run("cycles", func(t *testing.T) {
+		assert.ErrorIs(t, ds.IncludeRole(ctx, "guest", "guest"), repo.ErrRoleInclusionCycle)
+		assert.ErrorIs(t, ds.IncludeRole(ctx, "guest", "vet"), repo.ErrRoleInclusionCycle)
+		assert.ErrorIs(t, ds.IncludeRole(ctx, "employee", "admin"), repo.ErrRoleInclusionCycle)
+
+		// diamonds are not cycles
+		require.NoError(t, ds.IncludeRole(ctx, "vet", "guest"))
+	})
+
+	count, err := ds.RemoveRoleInclusion(ctx, repo.RemoveRoleInclusionParams{RoleID: "vet", IncludedRoleID: "employee"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	effective, err = ds.GetEffectiveRolesForUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"guest", "vet"}, roleNames(effective))
+
+	// deleting a role removes all inclusions
+	_, err = ds.DeleteRole(ctx, "guest")
+	require.NoError(t, err)
+
+	effective, err = ds.GetEffectiveRolesForRole(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "employee"}, roleNames(effective))
+}
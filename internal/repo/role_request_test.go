@@ -0,0 +1,101 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_RoleRequests(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, name := range []string{"approver", "intern", "lead"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: name, Name: name})
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: name, Username: name})
+		require.NoError(t, err)
+	}
+
+	// bob holds approver through lead, carol through a group
+	require.NoError(t, ds.IncludeRole(ctx, "lead", "approver"))
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "bob", RoleID: "lead"}))
+
+	_, err = ds.CreateGroup(ctx, repo.CreateGroupParams{ID: "team", Name: "team", Metadata: "{}"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: "team", UserID: "carol"}))
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "team", RoleID: "approver"}))
+
+	users, err := ds.GetUsersWithEffectiveRole(ctx, "approver")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "carol"}, users)
+
+	until := sql.NullTime{Time: time.Now().Add(24 * time.Hour).UTC(), Valid: true}
+
+	req, err := ds.CreateRoleRequest(ctx, repo.CreateRoleRequestParams{
+		ID:                  "r1",
+		UserID:              "alice",
+		RoleID:              "intern",
+		Justification:       "summer internship",
+		RequestedValidUntil: until,
+		CreatedAt:           time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pending", req.Status)
+
+	// only one pending request per user and role
+	_, err = ds.CreateRoleRequest(ctx, repo.CreateRoleRequestParams{
+		ID:        "r2",
+		UserID:    "alice",
+		RoleID:    "intern",
+		CreatedAt: time.Now().UTC(),
+	})
+	assert.Error(t, err)
+
+	pending, err := ds.ListRoleRequests(ctx, repo.ListRoleRequestsParams{Status: "pending", RoleID: "intern"})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "r1", pending[0].ID)
+
+	decided, err := ds.DecideRoleRequest(ctx, repo.DecideRoleRequestParams{
+		Status:          "approved",
+		DecidedBy:       sql.NullString{String: "bob", Valid: true},
+		DecidedAt:       sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		DecisionComment: "welcome",
+		ValidUntil:      until,
+		ID:              "r1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "approved", decided.Status)
+	assert.Equal(t, "bob", decided.DecidedBy.String)
+	assert.True(t, decided.ValidUntil.Valid)
+
+	// decided requests cannot be decided again
+	_, err = ds.DecideRoleRequest(ctx, repo.DecideRoleRequestParams{Status: "denied", ID: "r1"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	pending, err = ds.ListRoleRequests(ctx, repo.ListRoleRequestsParams{Status: "pending"})
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	all, err := ds.ListRoleRequests(ctx, repo.ListRoleRequestsParams{UserID: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
@@ -8,6 +8,7 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"strings"
 )
 
 const assignRoleToUser = `-- name: AssignRoleToUser :exec
@@ -95,6 +96,43 @@ func (q *Queries) CreateSystemRole(ctx context.Context, arg CreateSystemRolePara
 	return i, err
 }
 
+const deleteExpiredRoleAssignments = `-- name: DeleteExpiredRoleAssignments :many
+DELETE FROM
+	role_assignments
+WHERE
+	valid_until <= ?
+RETURNING user_id, role_id, valid_from, valid_until, expiry_notified
+`
+
+func (q *Queries) DeleteExpiredRoleAssignments(ctx context.Context, validUntil sql.NullTime) ([]RoleAssignment, error) {
+	rows, err := q.db.QueryContext(ctx, deleteExpiredRoleAssignments, validUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoleAssignment
+	for rows.Next() {
+		var i RoleAssignment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.RoleID,
+			&i.ValidFrom,
+			&i.ValidUntil,
+			&i.ExpiryNotified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteRole = `-- name: DeleteRole :execrows
 DELETE FROM
 	roles
@@ -110,6 +148,133 @@ func (q *Queries) DeleteRole(ctx context.Context, id string) (int64, error) {
 	return result.RowsAffected()
 }
 
+const getExpiringRoleAssignments = `-- name: GetExpiringRoleAssignments :many
+SELECT
+	user_id, role_id, valid_from, valid_until, expiry_notified
+FROM
+	role_assignments
+WHERE
+	NOT expiry_notified
+	AND valid_until > ?
+	AND valid_until <= ?
+ORDER BY
+	valid_until
+`
+
+type GetExpiringRoleAssignmentsParams struct {
+	Now          sql.NullTime
+	NoticeBefore sql.NullTime
+}
+
+func (q *Queries) GetExpiringRoleAssignments(ctx context.Context, arg GetExpiringRoleAssignmentsParams) ([]RoleAssignment, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiringRoleAssignments, arg.Now, arg.NoticeBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoleAssignment
+	for rows.Next() {
+		var i RoleAssignment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.RoleID,
+			&i.ValidFrom,
+			&i.ValidUntil,
+			&i.ExpiryNotified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoleAssignmentsForRole = `-- name: GetRoleAssignmentsForRole :many
+SELECT
+	user_id, role_id, valid_from, valid_until, expiry_notified
+FROM
+	role_assignments
+WHERE
+	role_id = ?
+ORDER BY
+	user_id
+`
+
+func (q *Queries) GetRoleAssignmentsForRole(ctx context.Context, roleID string) ([]RoleAssignment, error) {
+	rows, err := q.db.QueryContext(ctx, getRoleAssignmentsForRole, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoleAssignment
+	for rows.Next() {
+		var i RoleAssignment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.RoleID,
+			&i.ValidFrom,
+			&i.ValidUntil,
+			&i.ExpiryNotified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoleAssignmentsForUser = `-- name: GetRoleAssignmentsForUser :many
+SELECT
+	user_id, role_id, valid_from, valid_until, expiry_notified
+FROM
+	role_assignments
+WHERE
+	user_id = ?
+ORDER BY
+	role_id
+`
+
+func (q *Queries) GetRoleAssignmentsForUser(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	rows, err := q.db.QueryContext(ctx, getRoleAssignmentsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoleAssignment
+	for rows.Next() {
+		var i RoleAssignment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.RoleID,
+			&i.ValidFrom,
+			&i.ValidUntil,
+			&i.ExpiryNotified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRoleByID = `-- name: GetRoleByID :one
 SELECT
 	id, name, description, delete_protected, origin
@@ -194,7 +359,7 @@ const getRolesForUser = `-- name: GetRolesForUser :many
 SELECT
 	roles.id, roles.name, roles.description, roles.delete_protected, roles.origin
 FROM
-	role_assignments
+	active_role_assignments
 	JOIN roles ON roles.id = role_id
 WHERE
 	user_id = ?
@@ -229,6 +394,61 @@ func (q *Queries) GetRolesForUser(ctx context.Context, userID string) ([]Role, e
 	return items, nil
 }
 
+const getRolesForUsers = `-- name: GetRolesForUsers :many
+SELECT
+	active_role_assignments.user_id, roles.id, roles.name, roles.description, roles.delete_protected, roles.origin
+FROM
+	active_role_assignments
+	JOIN roles ON roles.id = role_id
+WHERE
+	user_id IN (/*SLICE:user_ids*/?)
+`
+
+type GetRolesForUsersRow struct {
+	UserID string
+	Role   Role
+}
+
+func (q *Queries) GetRolesForUsers(ctx context.Context, userIds []string) ([]GetRolesForUsersRow, error) {
+	query := getRolesForUsers
+	var queryParams []interface{}
+	if len(userIds) > 0 {
+		for _, v := range userIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", strings.Repeat(",?", len(userIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:user_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRolesForUsersRow
+	for rows.Next() {
+		var i GetRolesForUsersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Role.ID,
+			&i.Role.Name,
+			&i.Role.Description,
+			&i.Role.DeleteProtected,
+			&i.Role.Origin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSystemRoles = `-- name: GetSystemRoles :many
 SELECT
 	id, name, description, delete_protected, origin
@@ -268,9 +488,9 @@ func (q *Queries) GetSystemRoles(ctx context.Context) ([]Role, error) {
 
 const getUsersByRole = `-- name: GetUsersByRole :many
 SELECT
-	user_id, role_id, id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+	user_id, role_id, valid_from, valid_until, id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 FROM
-	role_assignments
+	active_role_assignments
 	JOIN users ON users.id = user_id
 WHERE
 	role_id = ?
@@ -279,6 +499,8 @@ WHERE
 type GetUsersByRoleRow struct {
 	UserID      string
 	RoleID      string
+	ValidFrom   sql.NullTime
+	ValidUntil  sql.NullTime
 	ID          string
 	Username    string
 	DisplayName string
@@ -290,6 +512,7 @@ type GetUsersByRoleRow struct {
 	Password    string
 	TotpSecret  sql.NullString
 	Deleted     bool
+	DeletedAt   sql.NullTime
 }
 
 func (q *Queries) GetUsersByRole(ctx context.Context, roleID string) ([]GetUsersByRoleRow, error) {
@@ -304,6 +527,8 @@ func (q *Queries) GetUsersByRole(ctx context.Context, roleID string) ([]GetUsers
 		if err := rows.Scan(
 			&i.UserID,
 			&i.RoleID,
+			&i.ValidFrom,
+			&i.ValidUntil,
 			&i.ID,
 			&i.Username,
 			&i.DisplayName,
@@ -315,6 +540,7 @@ func (q *Queries) GetUsersByRole(ctx context.Context, roleID string) ([]GetUsers
 			&i.Password,
 			&i.TotpSecret,
 			&i.Deleted,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -329,6 +555,26 @@ func (q *Queries) GetUsersByRole(ctx context.Context, roleID string) ([]GetUsers
 	return items, nil
 }
 
+const markRoleAssignmentExpiryNotified = `-- name: MarkRoleAssignmentExpiryNotified :exec
+UPDATE
+	role_assignments
+SET
+	expiry_notified = TRUE
+WHERE
+	user_id = ?
+	AND role_id = ?
+`
+
+type MarkRoleAssignmentExpiryNotifiedParams struct {
+	UserID string
+	RoleID string
+}
+
+func (q *Queries) MarkRoleAssignmentExpiryNotified(ctx context.Context, arg MarkRoleAssignmentExpiryNotifiedParams) error {
+	_, err := q.db.ExecContext(ctx, markRoleAssignmentExpiryNotified, arg.UserID, arg.RoleID)
+	return err
+}
+
 const unassignRoleFromUser = `-- name: UnassignRoleFromUser :execrows
 DELETE FROM
 	role_assignments
@@ -386,3 +632,32 @@ func (q *Queries) UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, e
 	)
 	return i, err
 }
+
+const upsertRoleAssignment = `-- name: UpsertRoleAssignment :exec
+INSERT INTO
+	role_assignments (user_id, role_id, valid_from, valid_until)
+VALUES
+	(?, ?, ?, ?) ON CONFLICT(user_id, role_id) DO
+UPDATE
+SET
+	valid_from = excluded.valid_from,
+	valid_until = excluded.valid_until,
+	expiry_notified = FALSE
+`
+
+type UpsertRoleAssignmentParams struct {
+	UserID     string
+	RoleID     string
+	ValidFrom  sql.NullTime
+	ValidUntil sql.NullTime
+}
+
+func (q *Queries) UpsertRoleAssignment(ctx context.Context, arg UpsertRoleAssignmentParams) error {
+	_, err := q.db.ExecContext(ctx, upsertRoleAssignment,
+		arg.UserID,
+		arg.RoleID,
+		arg.ValidFrom,
+		arg.ValidUntil,
+	)
+	return err
+}
@@ -0,0 +1,232 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqliteSearchSchema creates the FTS5 index for user_search_documents and the
+// triggers that keep it in sync. It is only used if SQLite has been built
+// with FTS5 support (go build -tags sqlite_fts5).
+var sqliteSearchSchema = []string{
+	// the index is rebuilt anyway so it is recreated to pick up changed
+	// columns.
+	`DROP TRIGGER IF EXISTS user_search_documents_ai`,
+	`DROP TRIGGER IF EXISTS user_search_documents_ad`,
+	`DROP TRIGGER IF EXISTS user_search_documents_au`,
+	`DROP TABLE IF EXISTS user_search_fts`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS user_search_fts USING fts5(
+		username,
+		names,
+		emails,
+		phones,
+		restricted,
+		extra_public,
+		extra_authenticated,
+		extra_private,
+		content='user_search_documents',
+		tokenize='unicode61 remove_diacritics 2',
+		prefix='2 3'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS user_search_documents_ai AFTER INSERT ON user_search_documents BEGIN
+		INSERT INTO user_search_fts(rowid, username, names, emails, phones, restricted, extra_public, extra_authenticated, extra_private)
+		VALUES (new.rowid, new.username, new.names, new.emails, new.phones, new.restricted, new.extra_public, new.extra_authenticated, new.extra_private);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS user_search_documents_ad AFTER DELETE ON user_search_documents BEGIN
+		INSERT INTO user_search_fts(user_search_fts, rowid, username, names, emails, phones, restricted, extra_public, extra_authenticated, extra_private)
+		VALUES ('delete', old.rowid, old.username, old.names, old.emails, old.phones, old.restricted, old.extra_public, old.extra_authenticated, old.extra_private);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS user_search_documents_au AFTER UPDATE ON user_search_documents BEGIN
+		INSERT INTO user_search_fts(user_search_fts, rowid, username, names, emails, phones, restricted, extra_public, extra_authenticated, extra_private)
+		VALUES ('delete', old.rowid, old.username, old.names, old.emails, old.phones, old.restricted, old.extra_public, old.extra_authenticated, old.extra_private);
+		INSERT INTO user_search_fts(rowid, username, names, emails, phones, restricted, extra_public, extra_authenticated, extra_private)
+		VALUES (new.rowid, new.username, new.names, new.emails, new.phones, new.restricted, new.extra_public, new.extra_authenticated, new.extra_private);
+	END`,
+	// the index might be outdated if the database has been used by a build
+	// without FTS5 support in the meantime.
+	`INSERT INTO user_search_fts(user_search_fts) VALUES ('rebuild')`,
+}
+
+// sqliteSearchTriggers lists the triggers created by sqliteSearchSchema.
+var sqliteSearchTriggers = []string{
+	"user_search_documents_ai",
+	"user_search_documents_ad",
+	"user_search_documents_au",
+}
+
+// SearchIndex searches users using the documents stored in
+// user_search_documents.
+//
+// PostgreSQL uses the tsvector columns created by the migrations. SQLite
+// uses an FTS5 index if available and falls back to pattern matching
+// otherwise.
+type SearchIndex struct {
+	db       *sql.DB
+	dialect  Dialect
+	fullText bool
+}
+
+// OpenSearchIndex prepares the full-text index of db. It must be called after
+// the database has been migrated.
+func OpenSearchIndex(ctx context.Context, db *sql.DB) (*SearchIndex, error) {
+	idx := &SearchIndex{
+		db:      db,
+		dialect: DialectOf(db),
+	}
+
+	if idx.dialect == DialectPostgres {
+		idx.fullText = true
+
+		return idx, nil
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&idx.fullText); err != nil {
+		return nil, fmt.Errorf("failed to check for FTS5 support: %w", err)
+	}
+
+	if !idx.fullText {
+		// the triggers would fail if the database has been used by a build
+		// with FTS5 support before.
+		for _, name := range sqliteSearchTriggers {
+			if _, err := db.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+				return nil, fmt.Errorf("failed to drop trigger %s: %w", name, err)
+			}
+		}
+
+		return idx, nil
+	}
+
+	for _, stmt := range sqliteSearchSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to prepare FTS5 index: %w", err)
+		}
+	}
+
+	return idx, nil
+}
+
+// FullText reports whether a full-text index is used. If false, users are
+// searched using pattern matching which is slower and ranks results only
+// roughly.
+func (idx *SearchIndex) FullText() bool {
+	return idx.fullText
+}
+
+// SearchUsersParams holds the parameters for SearchUsers.
+type SearchUsersParams struct {
+	// Terms must all match the start of a word in the document. Terms must
+	// only consist of lower-case letters and digits.
+	Terms []string
+
+	// IncludeRestricted includes the first and last names as well as
+	// e-mail addresses and phone numbers other than the primary ones.
+	IncludeRestricted bool
+
+	// IncludePrivate includes extra data fields with "self" and "private"
+	// visibility. It implies IncludeRestricted.
+	IncludePrivate bool
+
+	Limit int64
+}
+
+// SearchUsers returns the IDs of all active users that match arg, best
+// matches first.
+func (idx *SearchIndex) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]string, error) {
+	if len(arg.Terms) == 0 {
+		return nil, nil
+	}
+
+	var (
+		query string
+		args  []any
+	)
+
+	switch {
+	case idx.dialect == DialectPostgres:
+		column := "search_authenticated"
+		switch {
+		case arg.IncludePrivate:
+			column = "search_private"
+		case arg.IncludeRestricted:
+			column = "search_restricted"
+		}
+
+		tsquery := strings.Join(arg.Terms, ":* & ") + ":*"
+
+		query = fmt.Sprintf(`SELECT d.user_id FROM user_search_documents d JOIN users ON users.id = d.user_id
+			WHERE users.deleted = false AND d.%[1]s @@ to_tsquery('simple', ?)
+			ORDER BY ts_rank(d.%[1]s, to_tsquery('simple', ?)) DESC, d.username
+			LIMIT ?`, column)
+		args = []any{tsquery, tsquery, arg.Limit}
+
+	case idx.fullText:
+		columns := "username names emails phones extra_public extra_authenticated"
+		if arg.IncludePrivate || arg.IncludeRestricted {
+			columns += " restricted"
+		}
+		if arg.IncludePrivate {
+			columns += " extra_private"
+		}
+
+		match := fmt.Sprintf(`{%s} : ("%s"*)`, columns, strings.Join(arg.Terms, `"* AND "`))
+
+		query = `SELECT d.user_id FROM user_search_fts
+			JOIN user_search_documents d ON d.rowid = user_search_fts.rowid
+			JOIN users ON users.id = d.user_id
+			WHERE user_search_fts MATCH ? AND users.deleted = false
+			ORDER BY bm25(user_search_fts, 10.0, 5.0, 3.0, 2.0, 2.0, 1.0, 1.0, 1.0), d.username
+			LIMIT ?`
+		args = []any{match, arg.Limit}
+
+	default:
+		document := "d.username || ' ' || d.names || ' ' || d.emails || ' ' || d.phones || ' ' || d.extra_public || ' ' || d.extra_authenticated"
+		if arg.IncludePrivate || arg.IncludeRestricted {
+			document += " || ' ' || d.restricted"
+		}
+		if arg.IncludePrivate {
+			document += " || ' ' || d.extra_private"
+		}
+
+		var where []string
+		for _, term := range arg.Terms {
+			where = append(where, "(' ' || LOWER("+document+")) LIKE ?")
+			args = append(args, "% "+term+"%")
+		}
+
+		// rank users whose username or name starts with the first term
+		// first.
+		query = `SELECT d.user_id FROM user_search_documents d JOIN users ON users.id = d.user_id
+			WHERE users.deleted = false AND ` + strings.Join(where, " AND ") + `
+			ORDER BY CASE
+				WHEN LOWER(d.username) LIKE ? THEN 0
+				WHEN (' ' || LOWER(d.names)) LIKE ? THEN 1
+				ELSE 2
+			END, d.username
+			LIMIT ?`
+		args = append(args, arg.Terms[0]+"%", "% "+arg.Terms[0]+"%", arg.Limit)
+	}
+
+	rows, err := idx.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
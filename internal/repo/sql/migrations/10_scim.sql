@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS scim_external_ids (
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    PRIMARY KEY (resource_type, resource_id),
+    UNIQUE (resource_type, external_id)
+);
+
+-- +migrate Down
+DROP TABLE scim_external_ids;
@@ -0,0 +1,23 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS scim_targets (
+    name TEXT NOT NULL PRIMARY KEY,
+    cursor INTEGER NOT NULL DEFAULT 0,
+    last_sync_at TIMESTAMP,
+    last_full_sync_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    failed_users INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS scim_provisioned_users (
+    target TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    remote_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    synced_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (target, user_id)
+);
+
+-- +migrate Down
+DROP TABLE scim_provisioned_users;
+DROP TABLE scim_targets;
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE INDEX IF NOT EXISTS idx_users_display_name ON users(display_name, id);
+CREATE INDEX IF NOT EXISTS idx_users_first_name ON users(first_name, id);
+CREATE INDEX IF NOT EXISTS idx_users_last_name ON users(last_name, id);
+CREATE INDEX IF NOT EXISTS idx_user_emails_user_id ON user_emails(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_phone_numbers_user_id ON user_phone_numbers(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_addresses_user_id ON user_addresses(user_id);
+CREATE INDEX IF NOT EXISTS idx_role_assignments_role_id ON role_assignments(role_id);
+
+-- +migrate Down
+DROP INDEX idx_users_display_name;
+DROP INDEX idx_users_first_name;
+DROP INDEX idx_users_last_name;
+DROP INDEX idx_user_emails_user_id;
+DROP INDEX idx_user_phone_numbers_user_id;
+DROP INDEX idx_user_addresses_user_id;
+DROP INDEX idx_role_assignments_role_id;
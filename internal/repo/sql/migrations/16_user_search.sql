@@ -0,0 +1,23 @@
+-- +migrate Up
+-- user_search_documents holds the searchable text of each active user. It is
+-- maintained by the search indexer and can be rebuilt at any time. If
+-- cisidm is built with FTS5 support, an external content FTS5 table and the
+-- triggers that keep it in sync are created on startup.
+CREATE TABLE IF NOT EXISTS user_search_documents (
+    user_id TEXT NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    names TEXT NOT NULL DEFAULT '',
+    emails TEXT NOT NULL DEFAULT '',
+    phones TEXT NOT NULL DEFAULT '',
+    extra_public TEXT NOT NULL DEFAULT '',
+    extra_authenticated TEXT NOT NULL DEFAULT '',
+    extra_private TEXT NOT NULL DEFAULT '',
+    CONSTRAINT fk_user_search_document_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS user_search_documents_ai;
+DROP TRIGGER IF EXISTS user_search_documents_ad;
+DROP TRIGGER IF EXISTS user_search_documents_au;
+DROP TABLE IF EXISTS user_search_fts;
+DROP TABLE user_search_documents;
@@ -0,0 +1,49 @@
+-- +migrate Up
+-- user_groups are used to organize users in teams or departments. Groups may
+-- be assigned roles which are then granted to all members.
+CREATE TABLE IF NOT EXISTS user_groups (
+    id TEXT NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    metadata TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS user_group_members (
+    group_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    owner BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT fk_user_group_member_group FOREIGN KEY(group_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_group_member_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY(group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_members_user ON user_group_members(user_id);
+
+CREATE TABLE IF NOT EXISTS user_group_roles (
+    group_id TEXT NOT NULL,
+    role_id TEXT NOT NULL,
+    CONSTRAINT fk_user_group_role_group FOREIGN KEY(group_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_group_role_role FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY(group_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_roles_role ON user_group_roles(role_id);
+
+-- user_group_subgroups nests groups: members of a subgroup are members of
+-- all parent groups as well. Nesting is resolved transitively and must not
+-- form a cycle.
+CREATE TABLE IF NOT EXISTS user_group_subgroups (
+    group_id TEXT NOT NULL,
+    subgroup_id TEXT NOT NULL,
+    CONSTRAINT fk_user_group_subgroup_group FOREIGN KEY(group_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_group_subgroup_subgroup FOREIGN KEY(subgroup_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+    PRIMARY KEY(group_id, subgroup_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_subgroups_subgroup ON user_group_subgroups(subgroup_id);
+
+-- +migrate Down
+DROP TABLE user_group_subgroups;
+DROP TABLE user_group_roles;
+DROP TABLE user_group_members;
+DROP TABLE user_groups;
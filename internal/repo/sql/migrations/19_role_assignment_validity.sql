@@ -0,0 +1,28 @@
+-- +migrate Up
+-- role assignments may be limited to a period of time. Assignments outside
+-- of their validity period are ignored when resolving the roles of a user
+-- and are removed by the role-assignments maintenance job once they expired.
+ALTER TABLE role_assignments ADD valid_from TIMESTAMP;
+ALTER TABLE role_assignments ADD valid_until TIMESTAMP;
+ALTER TABLE role_assignments ADD expiry_notified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_role_assignments_valid_until ON role_assignments(valid_until);
+
+CREATE VIEW active_role_assignments AS
+SELECT
+    user_id,
+    role_id,
+    valid_from,
+    valid_until
+FROM
+    role_assignments
+WHERE
+    (valid_from IS NULL OR valid_from <= CURRENT_TIMESTAMP)
+    AND (valid_until IS NULL OR valid_until > CURRENT_TIMESTAMP);
+
+-- +migrate Down
+DROP VIEW active_role_assignments;
+DROP INDEX idx_role_assignments_valid_until;
+ALTER TABLE role_assignments DROP expiry_notified;
+ALTER TABLE role_assignments DROP valid_until;
+ALTER TABLE role_assignments DROP valid_from;
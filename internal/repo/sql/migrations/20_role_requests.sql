@@ -0,0 +1,29 @@
+-- +migrate Up
+-- role_requests holds requests of users for a role together with the
+-- decision of an approver. Decided requests are kept for later review.
+CREATE TABLE IF NOT EXISTS role_requests (
+    id TEXT NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    role_id TEXT NOT NULL,
+    justification TEXT NOT NULL DEFAULT '',
+    requested_valid_until TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP NOT NULL,
+    decided_by TEXT,
+    decided_at TIMESTAMP,
+    decision_comment TEXT NOT NULL DEFAULT '',
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    CONSTRAINT fk_role_request_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_role_request_role FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    CONSTRAINT fk_role_request_decided_by FOREIGN KEY(decided_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_requests_user ON role_requests(user_id);
+CREATE INDEX IF NOT EXISTS idx_role_requests_role ON role_requests(role_id);
+
+-- a user may only have one pending request per role.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_requests_pending ON role_requests(user_id, role_id) WHERE status = 'pending';
+
+-- +migrate Down
+DROP TABLE role_requests;
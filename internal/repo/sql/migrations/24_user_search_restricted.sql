@@ -0,0 +1,12 @@
+-- +migrate Up
+-- restricted holds the searchable text that only the user itself and user
+-- managers may read: the first and last name as well as e-mail addresses and
+-- phone numbers other than the primary ones. The documents are rebuilt on
+-- startup.
+ALTER TABLE user_search_documents ADD COLUMN restricted TEXT NOT NULL DEFAULT '';
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS user_search_documents_ai;
+DROP TRIGGER IF EXISTS user_search_documents_ad;
+DROP TRIGGER IF EXISTS user_search_documents_au;
+ALTER TABLE user_search_documents DROP COLUMN restricted;
@@ -0,0 +1,47 @@
+-- +migrate Up
+-- The audit log stays append-only, but the snapshots of a record may be
+-- redacted when the data of a user is erased. A redaction may clear before
+-- and after, replace the diff once both are cleared and clear the actor name,
+-- client IP and user agent. Everything else must stay untouched.
+DROP TRIGGER IF EXISTS audit_log_no_update;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+BEFORE
+UPDATE
+    ON audit_log
+    WHEN NOT (
+        new.seq = old.seq
+        AND new.id = old.id
+        AND new.created_at = old.created_at
+        AND new.actor_id = old.actor_id
+        AND new.actor_kind = old.actor_kind
+        AND new.action = old.action
+        AND new.target_type = old.target_type
+        AND new.target_id = old.target_id
+        AND new.success = old.success
+        AND new.error = old.error
+        AND new.before IN (old.before, '')
+        AND new.after IN (old.after, '')
+        AND (new.diff = old.diff OR (new.before = '' AND new.after = ''))
+        AND new.actor_name IN (old.actor_name, '')
+        AND new.client_ip IN (old.client_ip, '')
+        AND new.user_agent IN (old.user_agent, '')
+    ) BEGIN
+SELECT
+    RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS audit_log_no_update;
+
+-- +migrate StatementBegin
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+BEFORE
+UPDATE
+    ON audit_log BEGIN
+SELECT
+    RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +migrate StatementEnd
@@ -0,0 +1,20 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- users that have been deleted before are purged after the retention
+-- period counted from now on.
+UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE deleted;
+
+CREATE TABLE IF NOT EXISTS maintenance_jobs (
+    name TEXT NOT NULL PRIMARY KEY,
+    lease_holder TEXT NOT NULL DEFAULT '',
+    lease_expires_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_duration_ms BIGINT NOT NULL DEFAULT 0,
+    last_affected BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT ''
+);
+
+-- +migrate Down
+DROP TABLE maintenance_jobs;
+ALTER TABLE users DROP COLUMN deleted_at;
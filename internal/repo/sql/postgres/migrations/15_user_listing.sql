@@ -0,0 +1,38 @@
+-- +migrate Up
+CREATE INDEX IF NOT EXISTS idx_users_display_name ON users(display_name, id);
+CREATE INDEX IF NOT EXISTS idx_users_first_name ON users(first_name, id);
+CREATE INDEX IF NOT EXISTS idx_users_last_name ON users(last_name, id);
+CREATE INDEX IF NOT EXISTS idx_user_emails_user_id ON user_emails(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_phone_numbers_user_id ON user_phone_numbers(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_addresses_user_id ON user_addresses(user_id);
+CREATE INDEX IF NOT EXISTS idx_role_assignments_role_id ON role_assignments(role_id);
+
+-- json_extract and json_type mirror the SQLite JSON functions for the
+-- "$.a.b" paths used to filter users by their extra data.
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION json_extract(doc TEXT, path TEXT) RETURNS TEXT AS $$
+    SELECT doc::jsonb #>> string_to_array(substr(path, 3), '.')
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION json_type(doc TEXT, path TEXT) RETURNS TEXT AS $$
+    SELECT CASE jsonb_typeof(value)
+        WHEN 'boolean' THEN value::text
+        WHEN 'string' THEN 'text'
+        ELSE jsonb_typeof(value)
+    END
+    FROM (SELECT doc::jsonb #> string_to_array(substr(path, 3), '.') AS value) AS v
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP FUNCTION json_type(TEXT, TEXT);
+DROP FUNCTION json_extract(TEXT, TEXT);
+DROP INDEX idx_users_display_name;
+DROP INDEX idx_users_first_name;
+DROP INDEX idx_users_last_name;
+DROP INDEX idx_user_emails_user_id;
+DROP INDEX idx_user_phone_numbers_user_id;
+DROP INDEX idx_user_addresses_user_id;
+DROP INDEX idx_role_assignments_role_id;
@@ -0,0 +1,36 @@
+-- +migrate Up
+-- user_search_documents holds the searchable text of each active user. It is
+-- maintained by the search indexer and can be rebuilt at any time.
+CREATE TABLE IF NOT EXISTS user_search_documents (
+    user_id TEXT NOT NULL PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    names TEXT NOT NULL DEFAULT '',
+    emails TEXT NOT NULL DEFAULT '',
+    phones TEXT NOT NULL DEFAULT '',
+    extra_public TEXT NOT NULL DEFAULT '',
+    extra_authenticated TEXT NOT NULL DEFAULT '',
+    extra_private TEXT NOT NULL DEFAULT '',
+
+    -- search vectors for callers that may see authenticated and private
+    -- extra data fields, weighted like the columns of the SQLite FTS5 index.
+    search_authenticated TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', username), 'A') ||
+        setweight(to_tsvector('simple', names), 'B') ||
+        setweight(to_tsvector('simple', emails || ' ' || phones), 'C') ||
+        setweight(to_tsvector('simple', extra_public || ' ' || extra_authenticated), 'D')
+    ) STORED,
+    search_private TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', username), 'A') ||
+        setweight(to_tsvector('simple', names), 'B') ||
+        setweight(to_tsvector('simple', emails || ' ' || phones), 'C') ||
+        setweight(to_tsvector('simple', extra_public || ' ' || extra_authenticated || ' ' || extra_private), 'D')
+    ) STORED,
+
+    CONSTRAINT fk_user_search_document_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_search_documents_authenticated ON user_search_documents USING GIN (search_authenticated);
+CREATE INDEX IF NOT EXISTS idx_user_search_documents_private ON user_search_documents USING GIN (search_private);
+
+-- +migrate Down
+DROP TABLE user_search_documents;
@@ -0,0 +1,16 @@
+-- +migrate Up
+-- role_inclusions lets a role include all roles (and thus permissions) of
+-- other roles. Inclusions are resolved transitively and must not form a
+-- cycle.
+CREATE TABLE IF NOT EXISTS role_inclusions (
+    role_id TEXT NOT NULL,
+    included_role_id TEXT NOT NULL,
+    CONSTRAINT fk_role_inclusion_role FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    CONSTRAINT fk_role_inclusion_included FOREIGN KEY(included_role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY(role_id, included_role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_inclusions_included ON role_inclusions(included_role_id);
+
+-- +migrate Down
+DROP TABLE role_inclusions;
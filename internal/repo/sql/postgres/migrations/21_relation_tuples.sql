@@ -0,0 +1,19 @@
+-- +migrate Up
+-- relation_tuples holds relationships between objects and subjects. A
+-- subject is either a concrete object like user:<id> or, if subject_relation
+-- is set, all subjects having that relation on the subject object.
+CREATE TABLE IF NOT EXISTS relation_tuples (
+    object_type TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    subject_relation TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (object_type, object_id, relation, subject_type, subject_id, subject_relation)
+);
+
+CREATE INDEX IF NOT EXISTS idx_relation_tuples_subject ON relation_tuples(subject_type, subject_id, subject_relation);
+
+-- +migrate Down
+DROP TABLE relation_tuples;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- service_accounts marks users that are managed as non-human accounts for
+-- other services, for example by `idmctl apply`.
+CREATE TABLE IF NOT EXISTS service_accounts (
+    user_id TEXT NOT NULL PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_service_account_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE service_accounts;
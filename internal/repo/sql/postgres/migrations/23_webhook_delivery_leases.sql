@@ -0,0 +1,7 @@
+-- +migrate Up
+-- lease_until is set while a replica is sending a delivery so other replicas
+-- do not pick it up at the same time.
+ALTER TABLE webhook_deliveries ADD COLUMN lease_until TIMESTAMPTZ;
+
+-- +migrate Down
+ALTER TABLE webhook_deliveries DROP COLUMN lease_until;
@@ -0,0 +1,42 @@
+-- +migrate Up
+-- restricted holds the searchable text that only the user itself and user
+-- managers may read: the first and last name as well as e-mail addresses and
+-- phone numbers other than the primary ones. The documents are rebuilt on
+-- startup.
+ALTER TABLE user_search_documents ADD COLUMN restricted TEXT NOT NULL DEFAULT '';
+
+-- search_private is recreated since callers that may see private extra data
+-- fields may see the restricted text as well.
+ALTER TABLE user_search_documents DROP COLUMN search_private;
+
+ALTER TABLE user_search_documents
+    ADD COLUMN search_restricted TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', username), 'A') ||
+        setweight(to_tsvector('simple', names), 'B') ||
+        setweight(to_tsvector('simple', emails || ' ' || phones || ' ' || restricted), 'C') ||
+        setweight(to_tsvector('simple', extra_public || ' ' || extra_authenticated), 'D')
+    ) STORED,
+    ADD COLUMN search_private TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', username), 'A') ||
+        setweight(to_tsvector('simple', names), 'B') ||
+        setweight(to_tsvector('simple', emails || ' ' || phones || ' ' || restricted), 'C') ||
+        setweight(to_tsvector('simple', extra_public || ' ' || extra_authenticated || ' ' || extra_private), 'D')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_user_search_documents_restricted ON user_search_documents USING GIN (search_restricted);
+CREATE INDEX IF NOT EXISTS idx_user_search_documents_private ON user_search_documents USING GIN (search_private);
+
+-- +migrate Down
+ALTER TABLE user_search_documents DROP COLUMN search_restricted;
+ALTER TABLE user_search_documents DROP COLUMN search_private;
+ALTER TABLE user_search_documents DROP COLUMN restricted;
+
+ALTER TABLE user_search_documents
+    ADD COLUMN search_private TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', username), 'A') ||
+        setweight(to_tsvector('simple', names), 'B') ||
+        setweight(to_tsvector('simple', emails || ' ' || phones), 'C') ||
+        setweight(to_tsvector('simple', extra_public || ' ' || extra_authenticated || ' ' || extra_private), 'D')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_user_search_documents_private ON user_search_documents USING GIN (search_private);
@@ -0,0 +1,43 @@
+-- +migrate Up
+-- The audit log stays append-only, but the snapshots of a record may be
+-- redacted when the data of a user is erased. A redaction may clear before
+-- and after, replace the diff once both are cleared and clear the actor name,
+-- client IP and user agent. Everything else must stay untouched.
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.seq = OLD.seq
+        AND NEW.id = OLD.id
+        AND NEW.created_at = OLD.created_at
+        AND NEW.actor_id = OLD.actor_id
+        AND NEW.actor_kind = OLD.actor_kind
+        AND NEW.action = OLD.action
+        AND NEW.target_type = OLD.target_type
+        AND NEW.target_id = OLD.target_id
+        AND NEW.success = OLD.success
+        AND NEW.error = OLD.error
+        AND NEW.before IN (OLD.before, '')
+        AND NEW.after IN (OLD.after, '')
+        AND (NEW.diff = OLD.diff OR (NEW.before = '' AND NEW.after = ''))
+        AND NEW.actor_name IN (OLD.actor_name, '')
+        AND NEW.client_ip IN (OLD.client_ip, '')
+        AND NEW.user_agent IN (OLD.user_agent, '')
+    THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
@@ -0,0 +1,33 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS registration_tokens (
+    token TEXT NOT NULL PRIMARY KEY,
+    expires TIMESTAMPTZ,
+    allowed_usage INTEGER,
+    initial_roles TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION registration_token_cleanup() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM
+        registration_tokens
+    WHERE
+        allowed_usage IS NOT NULL
+        AND allowed_usage = 0;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER registration_token_cleanup
+AFTER
+UPDATE
+    ON registration_tokens FOR EACH STATEMENT EXECUTE FUNCTION registration_token_cleanup();
+
+-- +migrate Down
+DROP TRIGGER registration_token_cleanup ON registration_tokens;
+DROP FUNCTION registration_token_cleanup();
+DROP TABLE registration_tokens;
@@ -0,0 +1,38 @@
+-- name: ListAuditEvents :many
+SELECT
+	seq, id, created_at, actor_id, actor_name, actor_kind, action, target_type, target_id, before, after, diff, client_ip, user_agent, success, error
+FROM
+	audit_log
+WHERE
+	(
+		$1::TEXT IS NULL
+		OR actor_id = $1
+	)
+	AND (
+		$2::TEXT IS NULL
+		OR action = $2
+	)
+	AND (
+		$3::TEXT IS NULL
+		OR target_type = $3
+	)
+	AND (
+		$4::TEXT IS NULL
+		OR target_id = $4
+	)
+	AND (
+		$5::TIMESTAMPTZ IS NULL
+		OR created_at >= $5
+	)
+	AND (
+		$6::TIMESTAMPTZ IS NULL
+		OR created_at < $6
+	)
+	AND (
+		$7::BIGINT IS NULL
+		OR seq < $7
+	)
+ORDER BY
+	seq DESC
+LIMIT
+	$8;
@@ -0,0 +1,19 @@
+-- name: CreateChangeEvent :exec
+WITH
+	seq_lock AS (
+		SELECT
+			pg_advisory_xact_lock(hashtext('change_events'))
+	)
+INSERT INTO
+	change_events (id, type, user_id, role_id, payload, created_at)
+SELECT
+	$1::TEXT, $2::TEXT, $3::TEXT, $4::TEXT, $5::TEXT, $6::TIMESTAMPTZ
+FROM
+	seq_lock;
+
+-- name: GetChangeEventSeqRange :one
+SELECT
+	CAST(COALESCE(MIN(seq), 0) AS BIGINT) AS min_seq,
+	CAST(COALESCE(MAX(seq), 0) AS BIGINT) AS max_seq
+FROM
+	change_events;
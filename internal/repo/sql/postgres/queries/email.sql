@@ -0,0 +1,7 @@
+-- name: MarkEmailAsPrimary :execrows
+UPDATE
+	user_emails
+SET
+	is_primary = (id = $1)
+WHERE
+	user_id = $2;
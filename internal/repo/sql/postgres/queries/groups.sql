@@ -0,0 +1,11 @@
+-- name: AssignRoleToGroup :exec
+INSERT INTO
+	user_group_roles (group_id, role_id)
+VALUES
+	($1, $2) ON CONFLICT DO NOTHING;
+
+-- name: AddSubgroup :exec
+INSERT INTO
+	user_group_subgroups (group_id, subgroup_id)
+VALUES
+	($1, $2) ON CONFLICT DO NOTHING;
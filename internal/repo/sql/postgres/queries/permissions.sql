@@ -0,0 +1,4 @@
+-- name: AssignPermissionToRole :exec
+INSERT INTO
+    role_permissions (permission, role_id)
+VALUES ($1, $2) ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+-- name: MarkPhoneNumberAsPrimary :execrows
+UPDATE
+	user_phone_numbers
+SET
+	is_primary = (id = $1)
+WHERE
+	user_id = $2;
@@ -0,0 +1,5 @@
+-- name: AddRoleInclusion :exec
+INSERT INTO
+	role_inclusions (role_id, included_role_id)
+VALUES
+	($1, $2) ON CONFLICT DO NOTHING;
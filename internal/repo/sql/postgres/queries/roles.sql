@@ -0,0 +1,5 @@
+-- name: AssignRoleToUser :exec
+INSERT INTO
+	role_assignments (user_id, role_id)
+VALUES
+	($1, $2) ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- name: EnsureSCIMTarget :exec
+INSERT INTO
+	scim_targets (name)
+VALUES
+	($1) ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+-- name: ListWebhookDeliveries :many
+SELECT
+	seq, id, webhook, event_id, event_type, payload, status, attempts, created_at, next_attempt_at, last_attempt_at, last_status_code, last_error, lease_until
+FROM
+	webhook_deliveries
+WHERE
+	(
+		$1::TEXT IS NULL
+		OR webhook = $1
+	)
+	AND (
+		$2::TEXT IS NULL
+		OR status = $2
+	)
+	AND (
+		$3::TEXT IS NULL
+		OR event_type = $3
+	)
+	AND (
+		$4::BIGINT IS NULL
+		OR seq < $4
+	)
+ORDER BY
+	seq DESC
+LIMIT
+	$5;
@@ -0,0 +1,21 @@
+-- name: CreateWebPushSubscriptionForUser :exec
+INSERT INTO
+	webpush_subscriptions (
+		id,
+		user_id,
+		user_agent,
+		endpoint,
+		auth,
+		key,
+		token_id
+	)
+VALUES
+	($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (endpoint) DO
+UPDATE
+SET
+	id = excluded.id,
+	user_id = excluded.user_id,
+	user_agent = excluded.user_agent,
+	auth = excluded.auth,
+	key = excluded.key,
+	token_id = excluded.token_id;
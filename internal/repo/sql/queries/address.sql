@@ -47,4 +47,12 @@ DELETE FROM
     user_addresses
 WHERE
     id = ?
-    AND user_id = ?;
\ No newline at end of file
+    AND user_id = ?;
+
+-- name: GetAddressesForUsers :many
+SELECT
+    *
+FROM
+    user_addresses
+WHERE
+    user_id IN (sqlc.slice('user_ids'));
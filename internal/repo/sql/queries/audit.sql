@@ -0,0 +1,60 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO
+	audit_log (
+		id,
+		created_at,
+		actor_id,
+		actor_name,
+		actor_kind,
+		action,
+		target_type,
+		target_id,
+		before,
+		after,
+		diff,
+		client_ip,
+		user_agent,
+		success,
+		error
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListAuditEvents :many
+SELECT
+	*
+FROM
+	audit_log
+WHERE
+	(
+		sqlc.narg('actor_id') IS NULL
+		OR actor_id = sqlc.narg('actor_id')
+	)
+	AND (
+		sqlc.narg('action') IS NULL
+		OR action = sqlc.narg('action')
+	)
+	AND (
+		sqlc.narg('target_type') IS NULL
+		OR target_type = sqlc.narg('target_type')
+	)
+	AND (
+		sqlc.narg('target_id') IS NULL
+		OR target_id = sqlc.narg('target_id')
+	)
+	AND (
+		sqlc.narg('from_time') IS NULL
+		OR created_at >= sqlc.narg('from_time')
+	)
+	AND (
+		sqlc.narg('to_time') IS NULL
+		OR created_at < sqlc.narg('to_time')
+	)
+	AND (
+		sqlc.narg('before_seq') IS NULL
+		OR seq < sqlc.narg('before_seq')
+	)
+ORDER BY
+	seq DESC
+LIMIT
+	sqlc.arg('limit');
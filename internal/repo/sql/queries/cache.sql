@@ -0,0 +1,30 @@
+-- name: PutCacheEntry :exec
+INSERT INTO
+	cache_entries (key, value, expires_at)
+VALUES
+	(?, ?, ?) ON CONFLICT (key) DO
+UPDATE
+SET
+	value = excluded.value,
+	expires_at = excluded.expires_at;
+
+-- name: GetCacheEntry :one
+SELECT
+	*
+FROM
+	cache_entries
+WHERE
+	key = ?;
+
+-- name: TakeCacheEntry :one
+DELETE FROM
+	cache_entries
+WHERE
+	key = ? RETURNING *;
+
+-- name: DeleteExpiredCacheEntries :execrows
+DELETE FROM
+	cache_entries
+WHERE
+	expires_at IS NOT NULL
+	AND expires_at < ?;
@@ -0,0 +1,30 @@
+-- name: CreateChangeEvent :exec
+INSERT INTO
+	change_events (id, type, user_id, role_id, payload, created_at)
+VALUES
+	(?, ?, ?, ?, ?, ?);
+
+-- name: ListChangeEventsAfter :many
+SELECT
+	*
+FROM
+	change_events
+WHERE
+	seq > ?
+ORDER BY
+	seq ASC
+LIMIT
+	?;
+
+-- name: GetChangeEventSeqRange :one
+SELECT
+	CAST(COALESCE(MIN(seq), 0) AS INTEGER) AS min_seq,
+	CAST(COALESCE(MAX(seq), 0) AS INTEGER) AS max_seq
+FROM
+	change_events;
+
+-- name: DeleteChangeEventsBefore :execrows
+DELETE FROM
+	change_events
+WHERE
+	created_at < ?;
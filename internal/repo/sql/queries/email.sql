@@ -63,4 +63,12 @@ SET
 	verified = true
 WHERE
 	user_id = ?
-	AND id = ?;
\ No newline at end of file
+	AND id = ?;
+
+-- name: GetEmailsForUsers :many
+SELECT
+	*
+FROM
+	user_emails
+WHERE
+	user_id IN (sqlc.slice('user_ids'));
@@ -0,0 +1,193 @@
+-- name: CreateGroup :one
+INSERT INTO
+	user_groups (id, name, description, metadata)
+VALUES
+	(?, ?, ?, ?)
+RETURNING *;
+
+-- name: UpdateGroup :one
+UPDATE
+	user_groups
+SET
+	name = ?,
+	description = ?,
+	metadata = ?
+WHERE
+	id = ?
+RETURNING *;
+
+-- name: DeleteGroup :execrows
+DELETE FROM
+	user_groups
+WHERE
+	id = ?;
+
+-- name: GetGroupByID :one
+SELECT
+	*
+FROM
+	user_groups
+WHERE
+	id = ?;
+
+-- name: GetGroupByName :one
+SELECT
+	*
+FROM
+	user_groups
+WHERE
+	name = ?;
+
+-- name: GetGroups :many
+SELECT
+	*
+FROM
+	user_groups
+ORDER BY
+	name;
+
+-- name: AddGroupMember :exec
+INSERT INTO
+	user_group_members (group_id, user_id, owner)
+VALUES
+	(?, ?, ?)
+ON CONFLICT(group_id, user_id) DO
+	UPDATE
+	SET
+		owner = excluded.owner;
+
+-- name: RemoveGroupMember :execrows
+DELETE FROM
+	user_group_members
+WHERE
+	group_id = ?
+	AND user_id = ?;
+
+-- name: GetGroupMember :one
+SELECT
+	*
+FROM
+	user_group_members
+WHERE
+	group_id = ?
+	AND user_id = ?;
+
+-- name: GetGroupMembers :many
+SELECT
+	*
+FROM
+	user_group_members
+WHERE
+	group_id = ?
+ORDER BY
+	user_id;
+
+-- name: AssignRoleToGroup :exec
+INSERT OR IGNORE INTO
+	user_group_roles (group_id, role_id)
+VALUES
+	(?, ?);
+
+-- name: UnassignRoleFromGroup :execrows
+DELETE FROM
+	user_group_roles
+WHERE
+	group_id = ?
+	AND role_id = ?;
+
+-- name: GetGroupRoles :many
+SELECT
+	roles.*
+FROM
+	user_group_roles
+	JOIN roles ON roles.id = user_group_roles.role_id
+WHERE
+	user_group_roles.group_id = ?
+ORDER BY
+	roles.name;
+
+-- name: GetEffectiveGroupRoles :many
+WITH RECURSIVE effective_groups(id) AS (
+	SELECT
+		CAST(sqlc.arg(group_id) AS TEXT)
+	UNION
+	SELECT
+		user_group_subgroups.group_id
+	FROM
+		user_group_subgroups
+		JOIN effective_groups ON effective_groups.id = user_group_subgroups.subgroup_id
+)
+SELECT DISTINCT
+	roles.*
+FROM
+	effective_groups
+	JOIN user_group_roles ON user_group_roles.group_id = effective_groups.id
+	JOIN roles ON roles.id = user_group_roles.role_id
+ORDER BY
+	roles.name;
+
+-- name: AddSubgroup :exec
+INSERT OR IGNORE INTO
+	user_group_subgroups (group_id, subgroup_id)
+VALUES
+	(?, ?);
+
+-- name: RemoveSubgroup :execrows
+DELETE FROM
+	user_group_subgroups
+WHERE
+	group_id = ?
+	AND subgroup_id = ?;
+
+-- name: GetSubgroups :many
+SELECT
+	user_groups.*
+FROM
+	user_group_subgroups
+	JOIN user_groups ON user_groups.id = user_group_subgroups.subgroup_id
+WHERE
+	user_group_subgroups.group_id = ?
+ORDER BY
+	user_groups.name;
+
+-- name: GetEffectiveSubgroups :many
+WITH RECURSIVE effective_groups(id) AS (
+	SELECT
+		CAST(sqlc.arg(group_id) AS TEXT)
+	UNION
+	SELECT
+		user_group_subgroups.subgroup_id
+	FROM
+		user_group_subgroups
+		JOIN effective_groups ON effective_groups.id = user_group_subgroups.group_id
+)
+SELECT
+	user_groups.*
+FROM
+	effective_groups
+	JOIN user_groups ON user_groups.id = effective_groups.id
+ORDER BY
+	user_groups.name;
+
+-- name: GetEffectiveGroupsForUser :many
+WITH RECURSIVE effective_groups(id) AS (
+	SELECT
+		user_group_members.group_id
+	FROM
+		user_group_members
+	WHERE
+		user_group_members.user_id = ?
+	UNION
+	SELECT
+		user_group_subgroups.group_id
+	FROM
+		user_group_subgroups
+		JOIN effective_groups ON effective_groups.id = user_group_subgroups.subgroup_id
+)
+SELECT
+	user_groups.*
+FROM
+	effective_groups
+	JOIN user_groups ON user_groups.id = effective_groups.id
+ORDER BY
+	user_groups.name;
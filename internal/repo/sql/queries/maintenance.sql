@@ -0,0 +1,76 @@
+-- name: AcquireMaintenanceLease :execrows
+INSERT INTO
+	maintenance_jobs (name, lease_holder, lease_expires_at)
+VALUES
+	(sqlc.arg('name'), sqlc.arg('lease_holder'), sqlc.arg('lease_expires_at'))
+ON CONFLICT (name) DO UPDATE
+SET
+	lease_holder = excluded.lease_holder,
+	lease_expires_at = excluded.lease_expires_at
+WHERE
+	(
+		maintenance_jobs.lease_expires_at IS NULL
+		OR maintenance_jobs.lease_expires_at < sqlc.arg('now')
+	)
+	AND (
+		maintenance_jobs.last_run_at IS NULL
+		OR maintenance_jobs.last_run_at < sqlc.arg('last_run_before')
+	);
+
+-- name: FinishMaintenanceRun :execrows
+UPDATE
+	maintenance_jobs
+SET
+	lease_expires_at = NULL,
+	last_run_at = ?,
+	last_duration_ms = ?,
+	last_affected = ?,
+	last_error = ?
+WHERE
+	name = ?
+	AND lease_holder = ?;
+
+-- name: GetMaintenanceJobs :many
+SELECT
+	*
+FROM
+	maintenance_jobs
+ORDER BY
+	name;
+
+-- name: DeleteExpiredRegistrationTokens :execrows
+DELETE FROM
+	registration_tokens
+WHERE
+	expires IS NOT NULL
+	AND expires < ?;
+
+-- name: DeleteExpiredAPITokenRoles :exec
+DELETE FROM
+	user_api_token_roles
+WHERE
+	token_id IN (
+		SELECT
+			id
+		FROM
+			user_api_tokens
+		WHERE
+			expires_at IS NOT NULL
+			AND expires_at < ?
+	);
+
+-- name: DeleteExpiredAPITokens :execrows
+DELETE FROM
+	user_api_tokens
+WHERE
+	expires_at IS NOT NULL
+	AND expires_at < ?;
+
+-- name: GetPurgeableUsers :many
+SELECT
+	id
+FROM
+	users
+WHERE
+	deleted = true
+	AND deleted_at < ?;
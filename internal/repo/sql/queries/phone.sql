@@ -62,4 +62,12 @@ SET
 	verified = TRUE
 WHERE
 	user_id = ?
-	AND id = ?;
\ No newline at end of file
+	AND id = ?;
+
+-- name: GetPhoneNumbersForUsers :many
+SELECT
+	*
+FROM
+	user_phone_numbers
+WHERE
+	user_id IN (sqlc.slice('user_ids'));
@@ -0,0 +1,219 @@
+-- name: CreateErasureRequest :one
+INSERT INTO
+	erasure_requests (
+		id,
+		user_id,
+		username,
+		mode,
+		status,
+		reason,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: GetErasureRequest :one
+SELECT
+	*
+FROM
+	erasure_requests
+WHERE
+	id = ?;
+
+-- name: GetPendingErasureRequestForUser :one
+SELECT
+	*
+FROM
+	erasure_requests
+WHERE
+	user_id = ?
+	AND status = 'pending';
+
+-- name: ListErasureRequests :many
+SELECT
+	*
+FROM
+	erasure_requests
+WHERE
+	status = sqlc.arg('status')
+	OR sqlc.arg('status') = ''
+ORDER BY
+	created_at DESC;
+
+-- name: DecideErasureRequest :execrows
+UPDATE
+	erasure_requests
+SET
+	status = ?,
+	reason = ?,
+	decided_by = ?,
+	decided_at = ?
+WHERE
+	id = ?
+	AND status = 'pending';
+
+-- name: CompleteErasureRequest :execrows
+UPDATE
+	erasure_requests
+SET
+	status = 'completed',
+	username = '',
+	decided_by = ?,
+	decided_at = ?,
+	completed_at = ?
+WHERE
+	id = ?
+	AND status = 'pending';
+
+-- name: AnonymizeUser :execrows
+UPDATE
+	users
+SET
+	username = ?,
+	display_name = '',
+	first_name = '',
+	last_name = '',
+	extra = '',
+	avatar = '',
+	birthday = '',
+	password = '',
+	totp_secret = NULL,
+	deleted = true,
+	deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
+WHERE
+	id = ?;
+
+-- name: HardDeleteUser :execrows
+DELETE FROM
+	users
+WHERE
+	id = ?;
+
+-- name: EraseUserEmails :exec
+DELETE FROM
+	user_emails
+WHERE
+	user_id = ?;
+
+-- name: EraseUserPhoneNumbers :exec
+DELETE FROM
+	user_phone_numbers
+WHERE
+	user_id = ?;
+
+-- name: EraseUserAddresses :exec
+DELETE FROM
+	user_addresses
+WHERE
+	user_id = ?;
+
+-- name: EraseUserWebauthnCreds :exec
+DELETE FROM
+	webauthn_creds
+WHERE
+	user_id = ?;
+
+-- name: EraseUserWebPushSubscriptions :exec
+DELETE FROM
+	webpush_subscriptions
+WHERE
+	user_id = ?;
+
+-- name: EraseUserAPITokenRoles :exec
+DELETE FROM
+	user_api_token_roles
+WHERE
+	token_id IN (
+		SELECT
+			id
+		FROM
+			user_api_tokens
+		WHERE
+			user_id = ?
+	);
+
+-- name: EraseUserAPITokens :exec
+DELETE FROM
+	user_api_tokens
+WHERE
+	user_id = ?;
+
+-- name: EraseUserRelationTuples :exec
+DELETE FROM
+	relation_tuples
+WHERE
+	subject_type = 'user'
+	AND subject_id = ?;
+
+-- name: EraseUserGroupMemberships :exec
+DELETE FROM
+	user_group_members
+WHERE
+	user_id = ?;
+
+-- name: EraseUserRoleAssignments :exec
+DELETE FROM
+	role_assignments
+WHERE
+	user_id = ?;
+
+-- name: EraseUserRoleRequests :exec
+DELETE FROM
+	role_requests
+WHERE
+	user_id = ?;
+
+-- name: EraseUserSCIMExternalIDs :exec
+DELETE FROM
+	scim_external_ids
+WHERE
+	resource_type = 'User'
+	AND resource_id = ?;
+
+-- name: EraseUserWebhookDeliveries :exec
+DELETE FROM
+	webhook_deliveries
+WHERE
+	payload LIKE '%"userId":"' || sqlc.arg('user_id') || '"%';
+
+-- name: EraseUserChangeEvents :exec
+UPDATE
+	change_events
+SET
+	payload = 'null'
+WHERE
+	user_id = ?;
+
+-- name: ListUserAuditSnapshots :many
+SELECT
+	id,
+	diff
+FROM
+	audit_log
+WHERE
+	target_type = 'user'
+	AND target_id = ?
+	AND (
+		before <> ''
+		OR after <> ''
+	);
+
+-- name: RedactAuditEventSnapshot :exec
+UPDATE
+	audit_log
+SET
+	before = '',
+	after = '',
+	diff = ?
+WHERE
+	id = ?;
+
+-- name: RedactUserAuditActor :exec
+UPDATE
+	audit_log
+SET
+	actor_name = '',
+	client_ip = '',
+	user_agent = ''
+WHERE
+	actor_id = ?;
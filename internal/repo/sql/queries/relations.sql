@@ -0,0 +1,54 @@
+-- name: WriteRelationTuple :exec
+INSERT INTO
+	relation_tuples (
+		object_type,
+		object_id,
+		relation,
+		subject_type,
+		subject_id,
+		subject_relation,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteRelationTuple :execrows
+DELETE FROM
+	relation_tuples
+WHERE
+	object_type = ?
+	AND object_id = ?
+	AND relation = ?
+	AND subject_type = ?
+	AND subject_id = ?
+	AND subject_relation = ?;
+
+-- name: GetRelationTuples :many
+SELECT
+	*
+FROM
+	relation_tuples
+WHERE
+	(sqlc.arg(object_type) = '' OR object_type = sqlc.arg(object_type))
+	AND (sqlc.arg(object_id) = '' OR object_id = sqlc.arg(object_id))
+	AND (sqlc.arg(relation) = '' OR relation = sqlc.arg(relation))
+	AND (sqlc.arg(subject_type) = '' OR subject_type = sqlc.arg(subject_type))
+	AND (sqlc.arg(subject_id) = '' OR subject_id = sqlc.arg(subject_id))
+ORDER BY
+	object_type,
+	object_id,
+	relation,
+	subject_type,
+	subject_id,
+	subject_relation;
+
+-- name: GetRelationObjectIDs :many
+SELECT DISTINCT
+	object_id
+FROM
+	relation_tuples
+WHERE
+	object_type = ?
+ORDER BY
+	object_id;
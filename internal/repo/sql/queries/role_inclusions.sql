@@ -0,0 +1,204 @@
+-- name: AddRoleInclusion :exec
+INSERT OR IGNORE INTO
+	role_inclusions (role_id, included_role_id)
+VALUES
+	(?, ?);
+
+-- name: RemoveRoleInclusion :execrows
+DELETE FROM
+	role_inclusions
+WHERE
+	role_id = ?
+	AND included_role_id = ?;
+
+-- name: DeleteAllRoleInclusions :exec
+DELETE FROM
+	role_inclusions
+WHERE
+	role_id = ?;
+
+-- name: GetIncludedRoles :many
+SELECT
+	roles.*
+FROM
+	role_inclusions
+	JOIN roles ON roles.id = role_inclusions.included_role_id
+WHERE
+	role_inclusions.role_id = ?
+ORDER BY
+	roles.name;
+
+-- name: GetEffectiveRolesForRole :many
+WITH RECURSIVE effective_roles(id) AS (
+	SELECT
+		CAST(sqlc.arg(role_id) AS TEXT)
+	UNION
+	SELECT
+		role_inclusions.included_role_id
+	FROM
+		role_inclusions
+		JOIN effective_roles ON effective_roles.id = role_inclusions.role_id
+)
+SELECT
+	roles.*
+FROM
+	effective_roles
+	JOIN roles ON roles.id = effective_roles.id
+ORDER BY
+	roles.name;
+
+-- name: GetEffectiveRolesForUser :many
+WITH RECURSIVE effective_groups(id) AS (
+	SELECT
+		user_group_members.group_id
+	FROM
+		user_group_members
+	WHERE
+		user_group_members.user_id = sqlc.arg(user_id)
+	UNION
+	SELECT
+		user_group_subgroups.group_id
+	FROM
+		user_group_subgroups
+		JOIN effective_groups ON effective_groups.id = user_group_subgroups.subgroup_id
+),
+effective_roles(id) AS (
+	SELECT
+		active_role_assignments.role_id
+	FROM
+		active_role_assignments
+	WHERE
+		active_role_assignments.user_id = sqlc.arg(user_id)
+	UNION
+	SELECT
+		user_group_roles.role_id
+	FROM
+		user_group_roles
+		JOIN effective_groups ON effective_groups.id = user_group_roles.group_id
+	UNION
+	SELECT
+		role_inclusions.included_role_id
+	FROM
+		role_inclusions
+		JOIN effective_roles ON effective_roles.id = role_inclusions.role_id
+)
+SELECT
+	roles.*
+FROM
+	effective_roles
+	JOIN roles ON roles.id = effective_roles.id
+ORDER BY
+	roles.name;
+
+-- name: GetEffectiveRolesForToken :many
+WITH RECURSIVE token_owner(user_id) AS (
+	SELECT
+		user_api_tokens.user_id
+	FROM
+		user_api_tokens
+	WHERE
+		user_api_tokens.id = sqlc.arg(token_id)
+),
+effective_groups(id) AS (
+	SELECT
+		user_group_members.group_id
+	FROM
+		user_group_members
+		JOIN token_owner ON token_owner.user_id = user_group_members.user_id
+	UNION
+	SELECT
+		user_group_subgroups.group_id
+	FROM
+		user_group_subgroups
+		JOIN effective_groups ON effective_groups.id = user_group_subgroups.subgroup_id
+),
+owner_roles(id) AS (
+	SELECT
+		active_role_assignments.role_id
+	FROM
+		active_role_assignments
+		JOIN token_owner ON token_owner.user_id = active_role_assignments.user_id
+	UNION
+	SELECT
+		user_group_roles.role_id
+	FROM
+		user_group_roles
+		JOIN effective_groups ON effective_groups.id = user_group_roles.group_id
+	UNION
+	SELECT
+		role_inclusions.included_role_id
+	FROM
+		role_inclusions
+		JOIN owner_roles ON owner_roles.id = role_inclusions.role_id
+),
+effective_roles(id) AS (
+	SELECT
+		user_api_token_roles.role_id
+	FROM
+		user_api_token_roles
+		JOIN owner_roles ON owner_roles.id = user_api_token_roles.role_id
+	WHERE
+		user_api_token_roles.token_id = sqlc.arg(token_id)
+	UNION
+	SELECT
+		role_inclusions.included_role_id
+	FROM
+		role_inclusions
+		JOIN effective_roles ON effective_roles.id = role_inclusions.role_id
+)
+SELECT
+	roles.*
+FROM
+	effective_roles
+	JOIN roles ON roles.id = effective_roles.id
+ORDER BY
+	roles.name;
+
+-- name: GetUsersWithEffectiveRole :many
+WITH RECURSIVE granting_roles(id) AS (
+	SELECT
+		CAST(sqlc.arg(role_id) AS TEXT)
+	UNION
+	SELECT
+		role_inclusions.role_id
+	FROM
+		role_inclusions
+		JOIN granting_roles ON granting_roles.id = role_inclusions.included_role_id
+),
+granting_groups(id) AS (
+	SELECT
+		user_group_roles.group_id
+	FROM
+		user_group_roles
+		JOIN granting_roles ON granting_roles.id = user_group_roles.role_id
+	UNION
+	SELECT
+		user_group_subgroups.subgroup_id
+	FROM
+		user_group_subgroups
+		JOIN granting_groups ON granting_groups.id = user_group_subgroups.group_id
+)
+SELECT
+	users.id
+FROM
+	users
+WHERE
+	NOT users.deleted
+	AND (
+		users.id IN (
+			SELECT
+				active_role_assignments.user_id
+			FROM
+				active_role_assignments
+				JOIN granting_roles ON granting_roles.id = active_role_assignments.role_id
+		)
+		OR users.id IN (
+			SELECT
+				user_group_members.user_id
+			FROM
+				user_group_members
+				JOIN granting_groups ON granting_groups.id = user_group_members.group_id
+		)
+	)
+ORDER BY
+	users.username;
@@ -0,0 +1,48 @@
+-- name: CreateRoleRequest :one
+INSERT INTO
+	role_requests (
+		id,
+		user_id,
+		role_id,
+		justification,
+		requested_valid_until,
+		created_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetRoleRequest :one
+SELECT
+	*
+FROM
+	role_requests
+WHERE
+	id = ?;
+
+-- name: ListRoleRequests :many
+SELECT
+	*
+FROM
+	role_requests
+WHERE
+	(sqlc.arg(status) = '' OR status = sqlc.arg(status))
+	AND (sqlc.arg(user_id) = '' OR user_id = sqlc.arg(user_id))
+	AND (sqlc.arg(role_id) = '' OR role_id = sqlc.arg(role_id))
+ORDER BY
+	created_at DESC;
+
+-- name: DecideRoleRequest :one
+UPDATE
+	role_requests
+SET
+	status = ?,
+	decided_by = ?,
+	decided_at = ?,
+	decision_comment = ?,
+	valid_from = ?,
+	valid_until = ?
+WHERE
+	id = ?
+	AND status = 'pending'
+RETURNING *;
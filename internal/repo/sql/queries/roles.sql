@@ -74,11 +74,42 @@ WHERE
 	user_id = ?
 	AND role_id = ?;
 
+-- name: UpsertRoleAssignment :exec
+INSERT INTO
+	role_assignments (user_id, role_id, valid_from, valid_until)
+VALUES
+	(?, ?, ?, ?) ON CONFLICT(user_id, role_id) DO
+UPDATE
+SET
+	valid_from = excluded.valid_from,
+	valid_until = excluded.valid_until,
+	expiry_notified = FALSE;
+
+-- name: GetRoleAssignmentsForRole :many
+SELECT
+	*
+FROM
+	role_assignments
+WHERE
+	role_id = ?
+ORDER BY
+	user_id;
+
+-- name: GetRoleAssignmentsForUser :many
+SELECT
+	*
+FROM
+	role_assignments
+WHERE
+	user_id = ?
+ORDER BY
+	role_id;
+
 -- name: GetRolesForUser :many
 SELECT
 	roles.*
 FROM
-	role_assignments
+	active_role_assignments
 	JOIN roles ON roles.id = role_id
 WHERE
 	user_id = ?;
@@ -87,7 +118,7 @@ WHERE
 SELECT
 	*
 FROM
-	role_assignments
+	active_role_assignments
 	JOIN users ON users.id = user_id
 WHERE
 	role_id = ?;
@@ -96,4 +127,42 @@ WHERE
 DELETE FROM
 	roles
 WHERE
-	id = ?;
\ No newline at end of file
+	id = ?;
+
+-- name: GetRolesForUsers :many
+SELECT
+	active_role_assignments.user_id,
+	sqlc.embed(roles)
+FROM
+	active_role_assignments
+	JOIN roles ON roles.id = role_id
+WHERE
+	user_id IN (sqlc.slice('user_ids'));
+
+-- name: GetExpiringRoleAssignments :many
+SELECT
+	*
+FROM
+	role_assignments
+WHERE
+	NOT expiry_notified
+	AND valid_until > sqlc.arg(now)
+	AND valid_until <= sqlc.arg(notice_before)
+ORDER BY
+	valid_until;
+
+-- name: MarkRoleAssignmentExpiryNotified :exec
+UPDATE
+	role_assignments
+SET
+	expiry_notified = TRUE
+WHERE
+	user_id = ?
+	AND role_id = ?;
+
+-- name: DeleteExpiredRoleAssignments :many
+DELETE FROM
+	role_assignments
+WHERE
+	valid_until <= ?
+RETURNING *;
@@ -0,0 +1,32 @@
+-- name: GetSCIMExternalIDs :many
+SELECT
+	*
+FROM
+	scim_external_ids
+WHERE
+	resource_type = ?;
+
+-- name: GetSCIMExternalID :one
+SELECT
+	external_id
+FROM
+	scim_external_ids
+WHERE
+	resource_type = ?
+	AND resource_id = ?;
+
+-- name: SetSCIMExternalID :exec
+INSERT INTO
+	scim_external_ids (resource_type, resource_id, external_id)
+VALUES
+	(?, ?, ?) ON CONFLICT(resource_type, resource_id) DO
+UPDATE
+SET
+	external_id = excluded.external_id;
+
+-- name: DeleteSCIMExternalID :exec
+DELETE FROM
+	scim_external_ids
+WHERE
+	resource_type = ?
+	AND resource_id = ?;
@@ -0,0 +1,73 @@
+-- name: EnsureSCIMTarget :exec
+INSERT
+	OR IGNORE INTO scim_targets (name)
+VALUES
+	(?);
+
+-- name: GetSCIMTarget :one
+SELECT
+	*
+FROM
+	scim_targets
+WHERE
+	name = ?;
+
+-- name: UpdateSCIMTargetRun :exec
+UPDATE
+	scim_targets
+SET
+	cursor = sqlc.arg('cursor'),
+	last_sync_at = sqlc.arg('last_sync_at'),
+	last_full_sync_at = COALESCE(
+		sqlc.narg('last_full_sync_at'),
+		last_full_sync_at
+	),
+	last_error = sqlc.arg('last_error'),
+	failed_users = sqlc.arg('failed_users')
+WHERE
+	name = sqlc.arg('name');
+
+-- name: GetSCIMProvisionedUser :one
+SELECT
+	*
+FROM
+	scim_provisioned_users
+WHERE
+	target = ?
+	AND user_id = ?;
+
+-- name: GetSCIMProvisionedUsers :many
+SELECT
+	*
+FROM
+	scim_provisioned_users
+WHERE
+	target = ?
+ORDER BY
+	user_id ASC;
+
+-- name: UpsertSCIMProvisionedUser :exec
+INSERT INTO
+	scim_provisioned_users (
+		target,
+		user_id,
+		remote_id,
+		hash,
+		active,
+		synced_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?) ON CONFLICT(target, user_id) DO
+UPDATE
+SET
+	remote_id = excluded.remote_id,
+	hash = excluded.hash,
+	active = excluded.active,
+	synced_at = excluded.synced_at;
+
+-- name: DeleteSCIMProvisionedUser :exec
+DELETE FROM
+	scim_provisioned_users
+WHERE
+	target = ?
+	AND user_id = ?;
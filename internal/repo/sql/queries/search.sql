@@ -0,0 +1,44 @@
+-- name: UpsertUserSearchDocument :exec
+INSERT INTO
+	user_search_documents (
+		user_id,
+		username,
+		names,
+		emails,
+		phones,
+		restricted,
+		extra_public,
+		extra_authenticated,
+		extra_private
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE
+SET
+	username = excluded.username,
+	names = excluded.names,
+	emails = excluded.emails,
+	phones = excluded.phones,
+	restricted = excluded.restricted,
+	extra_public = excluded.extra_public,
+	extra_authenticated = excluded.extra_authenticated,
+	extra_private = excluded.extra_private;
+
+-- name: DeleteUserSearchDocument :exec
+DELETE FROM
+	user_search_documents
+WHERE
+	user_id = ?;
+
+-- name: DeleteStaleUserSearchDocuments :execrows
+DELETE FROM
+	user_search_documents
+WHERE
+	user_id NOT IN (
+		SELECT
+			id
+		FROM
+			users
+		WHERE
+			deleted = false
+	);
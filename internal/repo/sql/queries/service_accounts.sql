@@ -0,0 +1,33 @@
+-- name: CreateServiceAccount :exec
+INSERT INTO
+	service_accounts (user_id, description, created_at)
+VALUES
+	(?, ?, ?);
+
+-- name: UpdateServiceAccount :execrows
+UPDATE
+	service_accounts
+SET
+	description = ?
+WHERE
+	user_id = ?;
+
+-- name: DeleteServiceAccount :execrows
+DELETE FROM
+	service_accounts
+WHERE
+	user_id = ?;
+
+-- name: GetServiceAccounts :many
+SELECT
+	users.id,
+	users.username,
+	users.display_name,
+	service_accounts.description
+FROM
+	service_accounts
+	JOIN users ON users.id = service_accounts.user_id
+WHERE
+	users.deleted = false
+ORDER BY
+	users.username;
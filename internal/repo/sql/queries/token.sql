@@ -52,6 +52,23 @@ WHERE
 		OR expires > ?
 	);
 
+-- name: GetRegistrationTokens :many
+SELECT
+	*
+FROM
+	registration_tokens
+ORDER BY
+	token;
+
+-- name: UpdateRegistrationToken :execrows
+UPDATE
+	registration_tokens
+SET
+	expires = ?,
+	initial_roles = ?
+WHERE
+	token = ?;
+
 -- name: MarkRegistrationTokenUsed :one
 UPDATE
 	registration_tokens
@@ -103,6 +120,9 @@ INSERT INTO user_api_tokens (id, token, name, user_id, expires_at) VALUES (?, ?,
 -- name: GetAPITokensForUser :many
 SELECT * FROM user_api_tokens WHERE user_id = ?;
 
+-- name: GetAPITokenByID :one
+SELECT * FROM user_api_tokens WHERE id = ?;
+
 -- name: RevokeUserAPIToken :execrows
 DELETE FROM user_api_tokens WHERE id = ? AND user_id = ?;
 
@@ -43,7 +43,16 @@ FROM
 UPDATE
     users
 SET
-    deleted = true
+    deleted = true,
+    deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
+WHERE id = ?;
+
+-- name: RestoreUser :execrows
+UPDATE
+    users
+SET
+    deleted = false,
+    deleted_at = NULL
 WHERE id = ?;
 
 -- name: CreateUser :one
@@ -74,3 +83,11 @@ UPDATE users SET
 			birthday = ?
 		WHERE id = ?
         RETURNING *;
+
+-- name: GetUsersByIDs :many
+SELECT
+    *
+FROM
+    users
+WHERE
+    id IN (sqlc.slice('ids'));
@@ -0,0 +1,110 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO
+	webhook_deliveries (
+		id,
+		webhook,
+		event_id,
+		event_type,
+		payload,
+		created_at,
+		next_attempt_at
+	)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetDueWebhookDeliveries :many
+SELECT
+	*
+FROM
+	webhook_deliveries
+WHERE
+	(
+		status = 'pending'
+		AND next_attempt_at <= ?1
+	)
+	OR (
+		status = 'delivering'
+		AND lease_until <= ?1
+	)
+ORDER BY
+	next_attempt_at ASC
+LIMIT
+	?2;
+
+-- name: ClaimWebhookDelivery :execrows
+UPDATE
+	webhook_deliveries
+SET
+	status = 'delivering',
+	lease_until = ?1
+WHERE
+	id = ?2
+	AND (
+		(
+			status = 'pending'
+			AND next_attempt_at <= ?3
+		)
+		OR (
+			status = 'delivering'
+			AND lease_until <= ?3
+		)
+	);
+
+-- name: UpdateWebhookDeliveryAttempt :exec
+UPDATE
+	webhook_deliveries
+SET
+	status = ?,
+	attempts = attempts + 1,
+	next_attempt_at = ?,
+	last_attempt_at = ?,
+	last_status_code = ?,
+	last_error = ?,
+	lease_until = NULL
+WHERE
+	id = ?;
+
+-- name: GetWebhookDelivery :one
+SELECT
+	*
+FROM
+	webhook_deliveries
+WHERE
+	id = ?;
+
+-- name: RetryWebhookDelivery :execrows
+UPDATE
+	webhook_deliveries
+SET
+	status = 'pending',
+	next_attempt_at = ?
+WHERE
+	id = ?
+	AND status NOT IN ('pending', 'delivering');
+
+-- name: ListWebhookDeliveries :many
+SELECT
+	*
+FROM
+	webhook_deliveries
+WHERE
+	(
+		sqlc.narg('webhook') IS NULL
+		OR webhook = sqlc.narg('webhook')
+	)
+	AND (
+		sqlc.narg('status') IS NULL
+		OR status = sqlc.narg('status')
+	)
+	AND (
+		sqlc.narg('event_type') IS NULL
+		OR event_type = sqlc.narg('event_type')
+	)
+	AND (
+		sqlc.narg('before_seq') IS NULL
+		OR seq < sqlc.narg('before_seq')
+	)
+ORDER BY
+	seq DESC
+LIMIT
+	sqlc.arg('limit');
@@ -143,6 +143,24 @@ func (q *Queries) DeleteExpiredTokens(ctx context.Context, expiresAt time.Time)
 	return result.RowsAffected()
 }
 
+const getAPITokenByID = `-- name: GetAPITokenByID :one
+SELECT id, token, name, user_id, expires_at, created_at FROM user_api_tokens WHERE id = ?
+`
+
+func (q *Queries) GetAPITokenByID(ctx context.Context, id string) (UserApiToken, error) {
+	row := q.db.QueryRowContext(ctx, getAPITokenByID, id)
+	var i UserApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.Token,
+		&i.Name,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getAPITokensForUser = `-- name: GetAPITokensForUser :many
 SELECT id, token, name, user_id, expires_at, created_at FROM user_api_tokens WHERE user_id = ?
 `
@@ -210,6 +228,45 @@ func (q *Queries) GetRegistrationToken(ctx context.Context, arg GetRegistrationT
 	return i, err
 }
 
+const getRegistrationTokens = `-- name: GetRegistrationTokens :many
+SELECT
+	token, expires, allowed_usage, initial_roles, created_by, created_at
+FROM
+	registration_tokens
+ORDER BY
+	token
+`
+
+func (q *Queries) GetRegistrationTokens(ctx context.Context) ([]RegistrationToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRegistrationTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RegistrationToken
+	for rows.Next() {
+		var i RegistrationToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.Expires,
+			&i.AllowedUsage,
+			&i.InitialRoles,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRolesForToken = `-- name: GetRolesForToken :many
 SELECT roles.id, roles.name, roles.description, roles.delete_protected, roles.origin
 FROM user_api_tokens
@@ -249,7 +306,7 @@ func (q *Queries) GetRolesForToken(ctx context.Context, id string) ([]Role, erro
 
 const getUserForAPIToken = `-- name: GetUserForAPIToken :one
 SELECT 
-    users.id, users.username, users.display_name, users.first_name, users.last_name, users.extra, users.avatar, users.birthday, users.password, users.totp_secret, users.deleted,
+    users.id, users.username, users.display_name, users.first_name, users.last_name, users.extra, users.avatar, users.birthday, users.password, users.totp_secret, users.deleted, users.deleted_at,
     user_api_tokens.id, user_api_tokens.token, user_api_tokens.name, user_api_tokens.user_id, user_api_tokens.expires_at, user_api_tokens.created_at
 FROM user_api_tokens
 JOIN users ON user_api_tokens.user_id = users.id
@@ -276,6 +333,7 @@ func (q *Queries) GetUserForAPIToken(ctx context.Context, token string) (GetUser
 		&i.User.Password,
 		&i.User.TotpSecret,
 		&i.User.Deleted,
+		&i.User.DeletedAt,
 		&i.UserApiToken.ID,
 		&i.UserApiToken.Token,
 		&i.UserApiToken.Name,
@@ -418,6 +476,30 @@ func (q *Queries) RevokeUserAPIToken(ctx context.Context, arg RevokeUserAPIToken
 	return result.RowsAffected()
 }
 
+const updateRegistrationToken = `-- name: UpdateRegistrationToken :execrows
+UPDATE
+	registration_tokens
+SET
+	expires = ?,
+	initial_roles = ?
+WHERE
+	token = ?
+`
+
+type UpdateRegistrationTokenParams struct {
+	Expires      sql.NullTime
+	InitialRoles string
+	Token        string
+}
+
+func (q *Queries) UpdateRegistrationToken(ctx context.Context, arg UpdateRegistrationTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRegistrationToken, arg.Expires, arg.InitialRoles, arg.Token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const validateRegistrationToken = `-- name: ValidateRegistrationToken :one
 SELECT
 	COUNT(*) > 0
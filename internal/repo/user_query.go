@@ -0,0 +1,298 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Columns that ListUsersPage can sort by.
+const (
+	UserSortUsername    = "username"
+	UserSortDisplayName = "display_name"
+	UserSortFirstName   = "first_name"
+	UserSortLastName    = "last_name"
+)
+
+// IsUserSortField reports whether users can be sorted by field.
+func IsUserSortField(field string) bool {
+	switch field {
+	case UserSortUsername, UserSortDisplayName, UserSortFirstName, UserSortLastName:
+		return true
+	}
+
+	return false
+}
+
+// MatchMode defines how the Username, DisplayName and Email filters of
+// ListUsersPageParams are compared. Values are always compared ignoring case.
+type MatchMode int
+
+// Supported match modes.
+const (
+	MatchContains MatchMode = iota
+	MatchEquals
+	MatchPrefix
+	MatchSuffix
+)
+
+// ListUsersPageParams holds the filters, sort order and cursor for
+// ListUsersPage. Empty filters match all users.
+type ListUsersPageParams struct {
+	// Username, DisplayName and Email match users where the respective
+	// field contains the value, ignoring case. The *Match fields select a
+	// different comparison.
+	Username         string
+	UsernameMatch    MatchMode
+	DisplayName      string
+	DisplayNameMatch MatchMode
+	Email            string
+	EmailMatch       MatchMode
+
+	// EmailPrimaryOnly restricts the Email filter to primary e-mail
+	// addresses.
+	EmailPrimaryOnly bool
+
+	// ExternalID matches users with the given SCIM external ID.
+	ExternalID string
+
+	// RoleIDs matches users that have at least one of the roles assigned.
+	RoleIDs []string
+
+	// Deleted matches only deleted (true) or only active (false) users if
+	// valid.
+	Deleted sql.NullBool
+
+	// Extra matches users whose extra data contains the value at the
+	// dot-separated path. Values are compared as text, booleans as "true" and
+	// "false".
+	Extra map[string]string
+
+	// SortBy is one of the UserSort* columns and defaults to username. Ties
+	// are broken by the user ID.
+	SortBy     string
+	Descending bool
+
+	// AfterValue and AfterID hold the sort value and ID of the last user of
+	// the previous page. If AfterID is empty, the first page is returned.
+	AfterValue string
+	AfterID    string
+
+	// Limit is the maximum number of users returned. Zero means no limit.
+	Limit int64
+
+	// Offset skips the given number of users. It is only applied if Limit
+	// is set.
+	Offset int64
+}
+
+// filters returns the WHERE conditions and their arguments for the filters
+// of arg. The sort order, cursor and limits are not included.
+func (arg ListUsersPageParams) filters() ([]string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+
+	for _, f := range []struct {
+		column string
+		value  string
+		mode   MatchMode
+	}{
+		{"users.username", arg.Username, arg.UsernameMatch},
+		{"users.display_name", arg.DisplayName, arg.DisplayNameMatch},
+	} {
+		if f.value == "" {
+			continue
+		}
+
+		where = append(where, "LOWER("+f.column+") LIKE ? ESCAPE '\\'")
+		args = append(args, matchPattern(f.value, f.mode))
+	}
+
+	if arg.Email != "" {
+		cond := "user_emails.user_id = users.id AND LOWER(user_emails.address) LIKE ? ESCAPE '\\'"
+		if arg.EmailPrimaryOnly {
+			cond += " AND user_emails.is_primary = ?"
+		}
+
+		where = append(where, "EXISTS (SELECT 1 FROM user_emails WHERE "+cond+")")
+		args = append(args, matchPattern(arg.Email, arg.EmailMatch))
+
+		if arg.EmailPrimaryOnly {
+			args = append(args, true)
+		}
+	}
+
+	if arg.ExternalID != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM scim_external_ids WHERE scim_external_ids.resource_type = 'User' AND scim_external_ids.resource_id = users.id AND scim_external_ids.external_id = ?)")
+		args = append(args, arg.ExternalID)
+	}
+
+	if len(arg.RoleIDs) > 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM active_role_assignments WHERE active_role_assignments.user_id = users.id AND active_role_assignments.role_id IN ("+placeholders(len(arg.RoleIDs))+"))")
+		for _, id := range arg.RoleIDs {
+			args = append(args, id)
+		}
+	}
+
+	if arg.Deleted.Valid {
+		where = append(where, "users.deleted = ?")
+		args = append(args, arg.Deleted.Bool)
+	}
+
+	// sort the paths so the same filters always result in the same query.
+	paths := make([]string, 0, len(arg.Extra))
+	for path := range arg.Extra {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		jsonPath := "$." + path
+
+		where = append(where, "(CASE json_type(NULLIF(users.extra, ''), ?) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(NULLIF(users.extra, ''), ?) AS TEXT) END) = ?")
+		args = append(args, jsonPath, jsonPath, arg.Extra[path])
+	}
+
+	return where, args
+}
+
+// CountUsersMatching returns the number of users matching the filters of arg. The
+// sort order, cursor and limits of arg are ignored.
+func (q *Queries) CountUsersMatching(ctx context.Context, arg ListUsersPageParams) (int64, error) {
+	where, args := arg.filters()
+
+	query := "SELECT COUNT(*) FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var count int64
+	if err := q.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ListUsersPage returns users matching arg. Since filters and the sort order
+// are dynamic, the query is built at runtime and uses only SQL that is
+// supported by all dialects.
+func (q *Queries) ListUsersPage(ctx context.Context, arg ListUsersPageParams) ([]User, error) {
+	sortBy := arg.SortBy
+	if sortBy == "" {
+		sortBy = UserSortUsername
+	}
+
+	if !IsUserSortField(sortBy) {
+		return nil, fmt.Errorf("unsupported sort field %q", sortBy)
+	}
+
+	where, args := arg.filters()
+
+	op, order := ">", "ASC"
+	if arg.Descending {
+		op, order = "<", "DESC"
+	}
+
+	if arg.AfterID != "" {
+		where = append(where, fmt.Sprintf("(users.%[1]s %[2]s ? OR (users.%[1]s = ? AND users.id %[2]s ?))", sortBy, op))
+		args = append(args, arg.AfterValue, arg.AfterValue, arg.AfterID)
+	}
+
+	var query strings.Builder
+
+	query.WriteString("SELECT " + userColumns + " FROM users")
+	if len(where) > 0 {
+		query.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	fmt.Fprintf(&query, " ORDER BY users.%s %s, users.id %s", sortBy, order, order)
+
+	if arg.Limit > 0 {
+		query.WriteString(" LIMIT ?")
+		args = append(args, arg.Limit)
+
+		if arg.Offset > 0 {
+			query.WriteString(" OFFSET ?")
+			args = append(args, arg.Offset)
+		}
+	}
+
+	rows, err := q.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.FirstName,
+			&i.LastName,
+			&i.Extra,
+			&i.Avatar,
+			&i.Birthday,
+			&i.Password,
+			&i.TotpSecret,
+			&i.Deleted,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const userColumns = "users.id, users.username, users.display_name, users.first_name, users.last_name, users.extra, users.avatar, users.birthday, users.password, users.totp_secret, users.deleted, users.deleted_at"
+
+// SortValue returns the value of the column field of u.
+func (u User) SortValue(field string) string {
+	switch field {
+	case UserSortDisplayName:
+		return u.DisplayName
+	case UserSortFirstName:
+		return u.FirstName
+	case UserSortLastName:
+		return u.LastName
+	default:
+		return u.Username
+	}
+}
+
+// matchPattern returns a LIKE pattern that matches values according to
+// mode, ignoring case.
+func matchPattern(s string, mode MatchMode) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(s))
+
+	switch mode {
+	case MatchEquals:
+		return s
+	case MatchPrefix:
+		return s + "%"
+	case MatchSuffix:
+		return "%" + s
+	default:
+		return "%" + s + "%"
+	}
+}
+
+func placeholders(n int) string {
+	return strings.Repeat(",?", n)[1:]
+}
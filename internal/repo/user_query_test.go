@@ -0,0 +1,110 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func userIDs(users []repo.User) []string {
+	ids := make([]string, len(users))
+	for idx, u := range users {
+		ids[idx] = u.ID
+	}
+
+	return ids
+}
+
+func Test_ListUsersPage(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, u := range []repo.CreateUserParams{
+		{ID: "1", Username: "alice", DisplayName: "Alice Smith", Extra: `{"team":"vets","remote":true,"nested":{"level":2}}`},
+		{ID: "2", Username: "bob", DisplayName: "Bob", Extra: `{"team":"office","remote":false}`},
+		{ID: "3", Username: "carol", DisplayName: "Carol Smith"},
+		{ID: "4", Username: "dave_100%", DisplayName: "Bob"},
+	} {
+		_, err := ds.CreateUser(ctx, u)
+		require.NoError(t, err)
+	}
+
+	for _, m := range []repo.CreateEMailParams{
+		{ID: "m1", UserID: "3", Address: "Carol@Example.com"},
+		{ID: "m2", UserID: "1", Address: "alice@work.org", IsPrimary: true},
+		{ID: "m3", UserID: "1", Address: "alice@private.org"},
+	} {
+		_, err = ds.CreateEMail(ctx, m)
+		require.NoError(t, err)
+	}
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "r1", Name: "admins"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "2", RoleID: "r1"}))
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "3", RoleID: "r1"}))
+
+	_, err = ds.DeleteUser(ctx, "2")
+	require.NoError(t, err)
+
+	require.NoError(t, ds.SetSCIMExternalID(ctx, repo.SetSCIMExternalIDParams{ResourceType: "User", ResourceID: "3", ExternalID: "ext-carol"}))
+
+	cases := []struct {
+		name   string
+		params repo.ListUsersPageParams
+		ids    []string
+	}{
+		{"all", repo.ListUsersPageParams{}, []string{"1", "2", "3", "4"}},
+		{"username", repo.ListUsersPageParams{Username: "A"}, []string{"1", "3", "4"}},
+		{"escaped", repo.ListUsersPageParams{Username: "_1"}, []string{"4"}},
+		{"percent", repo.ListUsersPageParams{Username: "%"}, []string{"4"}},
+		{"display name", repo.ListUsersPageParams{DisplayName: "smith"}, []string{"1", "3"}},
+		{"username equals", repo.ListUsersPageParams{Username: "ALICE", UsernameMatch: repo.MatchEquals}, []string{"1"}},
+		{"username prefix", repo.ListUsersPageParams{Username: "ca", UsernameMatch: repo.MatchPrefix}, []string{"3"}},
+		{"display name suffix", repo.ListUsersPageParams{DisplayName: "smith", DisplayNameMatch: repo.MatchSuffix}, []string{"1", "3"}},
+		{"email", repo.ListUsersPageParams{Email: "example"}, []string{"3"}},
+		{"email equals", repo.ListUsersPageParams{Email: "carol@example.com", EmailMatch: repo.MatchEquals}, []string{"3"}},
+		{"primary email", repo.ListUsersPageParams{Email: "alice@", EmailPrimaryOnly: true}, []string{"1"}},
+		{"primary email only", repo.ListUsersPageParams{Email: "private", EmailPrimaryOnly: true}, []string{}},
+		{"external id", repo.ListUsersPageParams{ExternalID: "ext-carol"}, []string{"3"}},
+		{"roles", repo.ListUsersPageParams{RoleIDs: []string{"r1", "unknown"}}, []string{"2", "3"}},
+		{"active", repo.ListUsersPageParams{Deleted: sql.NullBool{Valid: true}}, []string{"1", "3", "4"}},
+		{"deleted", repo.ListUsersPageParams{Deleted: sql.NullBool{Bool: true, Valid: true}}, []string{"2"}},
+		{"extra string", repo.ListUsersPageParams{Extra: map[string]string{"team": "vets"}}, []string{"1"}},
+		{"extra bool", repo.ListUsersPageParams{Extra: map[string]string{"remote": "false"}}, []string{"2"}},
+		{"extra nested", repo.ListUsersPageParams{Extra: map[string]string{"nested.level": "2"}}, []string{"1"}},
+		{"sort desc", repo.ListUsersPageParams{SortBy: repo.UserSortDisplayName, Descending: true}, []string{"3", "4", "2", "1"}},
+		{"limit", repo.ListUsersPageParams{Limit: 2}, []string{"1", "2"}},
+		{"offset", repo.ListUsersPageParams{Limit: 2, Offset: 1}, []string{"2", "3"}},
+		{"after", repo.ListUsersPageParams{SortBy: repo.UserSortDisplayName, AfterValue: "Bob", AfterID: "2"}, []string{"4", "3"}},
+		{"after desc", repo.ListUsersPageParams{SortBy: repo.UserSortDisplayName, Descending: true, AfterValue: "Bob", AfterID: "4"}, []string{"2", "1"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			users, err := ds.ListUsersPage(ctx, c.params)
+			require.NoError(t, err)
+			assert.Equal(t, c.ids, userIDs(users))
+		})
+	}
+
+	_, err = ds.ListUsersPage(ctx, repo.ListUsersPageParams{SortBy: "password"})
+	assert.Error(t, err)
+
+	// the count ignores the sort order, cursor and limits
+	count, err := ds.CountUsersMatching(ctx, repo.ListUsersPageParams{DisplayName: "smith", Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -7,6 +7,7 @@ package repo
 
 import (
 	"context"
+	"strings"
 )
 
 const countUsers = `-- name: CountUsers :one
@@ -36,7 +37,7 @@ INSERT INTO
     )
 VALUES
     (?, ?, ?, ?, ?, ?, ?, ?, ?)
-RETURNING id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+RETURNING id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 `
 
 type CreateUserParams struct {
@@ -76,6 +77,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Password,
 		&i.TotpSecret,
 		&i.Deleted,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -84,7 +86,8 @@ const deleteUser = `-- name: DeleteUser :execrows
 UPDATE
     users
 SET
-    deleted = true
+    deleted = true,
+    deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
 WHERE id = ?
 `
 
@@ -98,7 +101,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id string) (int64, error) {
 
 const getAllUsers = `-- name: GetAllUsers :many
 SELECT
-    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 FROM
     users
 `
@@ -124,6 +127,7 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.Password,
 			&i.TotpSecret,
 			&i.Deleted,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -140,7 +144,7 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 
 const getUserByEMail = `-- name: GetUserByEMail :one
 SELECT
-    users.id, users.username, users.display_name, users.first_name, users.last_name, users.extra, users.avatar, users.birthday, users.password, users.totp_secret, users.deleted,
+    users.id, users.username, users.display_name, users.first_name, users.last_name, users.extra, users.avatar, users.birthday, users.password, users.totp_secret, users.deleted, users.deleted_at,
     user_emails.verified
 FROM
     users
@@ -169,6 +173,7 @@ func (q *Queries) GetUserByEMail(ctx context.Context, address string) (GetUserBy
 		&i.User.Password,
 		&i.User.TotpSecret,
 		&i.User.Deleted,
+		&i.User.DeletedAt,
 		&i.Verified,
 	)
 	return i, err
@@ -176,7 +181,7 @@ func (q *Queries) GetUserByEMail(ctx context.Context, address string) (GetUserBy
 
 const getUserByID = `-- name: GetUserByID :one
 SELECT
-    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 FROM
     users
 WHERE
@@ -198,13 +203,14 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 		&i.Password,
 		&i.TotpSecret,
 		&i.Deleted,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserByName = `-- name: GetUserByName :one
 SELECT
-    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 FROM
     users
 WHERE
@@ -226,10 +232,83 @@ func (q *Queries) GetUserByName(ctx context.Context, username string) (User, err
 		&i.Password,
 		&i.TotpSecret,
 		&i.Deleted,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getUsersByIDs = `-- name: GetUsersByIDs :many
+SELECT
+    id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
+FROM
+    users
+WHERE
+    id IN (/*SLICE:ids*/?)
+`
+
+func (q *Queries) GetUsersByIDs(ctx context.Context, ids []string) ([]User, error) {
+	query := getUsersByIDs
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.FirstName,
+			&i.LastName,
+			&i.Extra,
+			&i.Avatar,
+			&i.Birthday,
+			&i.Password,
+			&i.TotpSecret,
+			&i.Deleted,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreUser = `-- name: RestoreUser :execrows
+UPDATE
+    users
+SET
+    deleted = false,
+    deleted_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const setUserExtraData = `-- name: SetUserExtraData :execrows
 UPDATE users
 SET extra = ?
@@ -259,7 +338,7 @@ UPDATE users SET
 			avatar = ?,
 			birthday = ?
 		WHERE id = ?
-        RETURNING id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted
+        RETURNING id, username, display_name, first_name, last_name, extra, avatar, birthday, password, totp_secret, deleted, deleted_at
 `
 
 type UpdateUserParams struct {
@@ -297,6 +376,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Password,
 		&i.TotpSecret,
 		&i.Deleted,
+		&i.DeletedAt,
 	)
 	return i, err
 }
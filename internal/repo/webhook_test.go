@@ -0,0 +1,79 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_ClaimWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	now := time.Now().UTC()
+	require.NoError(t, ds.CreateWebhookDelivery(ctx, repo.CreateWebhookDeliveryParams{
+		ID:            "d1",
+		Webhook:       "hook",
+		EventID:       "e1",
+		EventType:     "user.created",
+		Payload:       "{}",
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}))
+
+	claim := func(at time.Time) int64 {
+		rows, err := ds.ClaimWebhookDelivery(ctx, repo.ClaimWebhookDeliveryParams{
+			LeaseUntil: sql.NullTime{Time: at.Add(time.Minute), Valid: true},
+			ID:         "d1",
+			Now:        at,
+		})
+		require.NoError(t, err)
+
+		return rows
+	}
+
+	// only one replica can claim the delivery
+	assert.Equal(t, int64(1), claim(now))
+	assert.Equal(t, int64(0), claim(now))
+
+	due, err := ds.GetDueWebhookDeliveries(ctx, repo.GetDueWebhookDeliveriesParams{NextAttemptAt: now, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	// once the lease expired the delivery is due again
+	later := now.Add(2 * time.Minute)
+
+	due, err = ds.GetDueWebhookDeliveries(ctx, repo.GetDueWebhookDeliveriesParams{NextAttemptAt: later, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "delivering", due[0].Status)
+
+	assert.Equal(t, int64(1), claim(later))
+
+	// finishing the attempt releases the lease
+	require.NoError(t, ds.UpdateWebhookDeliveryAttempt(ctx, repo.UpdateWebhookDeliveryAttemptParams{
+		ID:            "d1",
+		Status:        "delivered",
+		NextAttemptAt: later,
+		LastAttemptAt: sql.NullTime{Time: later, Valid: true},
+	}))
+
+	delivery, err := ds.GetWebhookDelivery(ctx, "d1")
+	require.NoError(t, err)
+	assert.Equal(t, "delivered", delivery.Status)
+	assert.False(t, delivery.LeaseUntil.Valid)
+}
@@ -0,0 +1,179 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BulkRequest is the body of a bulk request as defined in RFC 7644, Section
+// 3.7.
+type BulkRequest struct {
+	Schemas      []string        `json:"schemas"`
+	FailOnErrors int             `json:"failOnErrors,omitempty"`
+	Operations   []BulkOperation `json:"Operations"`
+}
+
+// BulkOperation is a single operation of a bulk request.
+type BulkOperation struct {
+	Method string          `json:"method"`
+	BulkID string          `json:"bulkId,omitempty"`
+	Path   string          `json:"path"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// BulkResponse is the response message of a bulk request.
+type BulkResponse struct {
+	Schemas    []string                `json:"schemas"`
+	Operations []BulkOperationResponse `json:"Operations"`
+}
+
+// BulkOperationResponse holds the result of a single bulk operation.
+type BulkOperationResponse struct {
+	Method   string `json:"method"`
+	BulkID   string `json:"bulkId,omitempty"`
+	Location string `json:"location,omitempty"`
+	Status   string `json:"status"`
+	Response any    `json:"response,omitempty"`
+}
+
+// bulk executes all operations of a bulk request in order. Each operation
+// is committed on its own so a failed operation does not roll back earlier
+// ones. Resources created within the same request may be referenced using
+// "bulkId:<id>" once they have been created.
+func (h *Handler) bulk(ctx context.Context, req *request, _ string) (*response, error) {
+	var bulk BulkRequest
+	if err := decode(req.body, &bulk); err != nil {
+		return nil, err
+	}
+
+	if len(bulk.Schemas) > 0 && !isSchema(MessageBulkRequest, bulk.Schemas) {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidSyntax, fmt.Sprintf("expected schema %q", MessageBulkRequest))
+	}
+
+	if limit := h.Config.SCIM.MaxBulkOperations; len(bulk.Operations) > limit {
+		return nil, newError(http.StatusRequestEntityTooLarge, "", fmt.Sprintf("the request exceeds the maximum number of %d operations", limit))
+	}
+
+	var (
+		result = &BulkResponse{
+			Schemas:    []string{MessageBulkResponse},
+			Operations: make([]BulkOperationResponse, 0, len(bulk.Operations)),
+		}
+		bulkIDs = make(map[string]string)
+		failed  int
+	)
+
+	for _, op := range bulk.Operations {
+		if bulk.FailOnErrors > 0 && failed >= bulk.FailOnErrors {
+			break
+		}
+
+		opResult := BulkOperationResponse{
+			Method: op.Method,
+			BulkID: op.BulkID,
+		}
+
+		res, err := h.bulkOperation(ctx, req, op, bulkIDs)
+		if err != nil {
+			serr := asError(err)
+
+			failed++
+			opResult.Status = strconv.Itoa(serr.Status)
+			opResult.Response = serr
+		} else {
+			opResult.Status = strconv.Itoa(res.status)
+			opResult.Location = res.location
+
+			if op.BulkID != "" && res.id != "" {
+				bulkIDs[op.BulkID] = res.id
+			}
+		}
+
+		result.Operations = append(result.Operations, opResult)
+	}
+
+	return &response{status: http.StatusOK, body: result}, nil
+}
+
+func (h *Handler) bulkOperation(ctx context.Context, req *request, op BulkOperation, bulkIDs map[string]string) (*response, error) {
+	method := strings.ToUpper(op.Method)
+
+	if method == http.MethodPost && op.BulkID == "" {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidSyntax, "bulkId is required for POST operations")
+	}
+
+	path, err := resolveBulkIDs(op.Path, bulkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := resolveBulkIDs(string(op.Data), bulkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidPath, fmt.Sprintf("invalid path %q", op.Path))
+	}
+
+	rt, err := h.route(method, parsed.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if rt.action == "" || rt.action == actionBulk {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidSyntax, fmt.Sprintf("%s %s is not supported in bulk requests", method, op.Path))
+	}
+
+	res, err := h.call(ctx, rt, &request{
+		query:     parsed.Query(),
+		body:      []byte(data),
+		clientIP:  req.clientIP,
+		userAgent: req.userAgent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.location == "" && method != http.MethodDelete {
+		res.location = h.baseURL() + "/" + strings.Trim(parsed.Path, "/")
+	}
+
+	return res, nil
+}
+
+// bulkIDRef matches references to resources created by other operations of
+// the same bulk request.
+var bulkIDRef = regexp.MustCompile(`bulkId:([^"/?,\s]+)`)
+
+// resolveBulkIDs replaces all bulkId references in s with the ID of the
+// resource created by the referenced operation.
+func resolveBulkIDs(s string, bulkIDs map[string]string) (string, error) {
+	var unresolved string
+
+	s = bulkIDRef.ReplaceAllStringFunc(s, func(ref string) string {
+		bulkID := strings.TrimPrefix(ref, "bulkId:")
+
+		id, ok := bulkIDs[bulkID]
+		if !ok {
+			unresolved = bulkID
+
+			return ref
+		}
+
+		return id
+	})
+
+	if unresolved != "" {
+		return "", newError(http.StatusConflict, ScimTypeInvalidValue, fmt.Sprintf("unresolved reference to bulkId %q", unresolved))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,642 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a parsed SCIM filter expression as defined in RFC 7644,
+// Section 3.4.2.2.
+type Filter interface {
+	// Matches reports whether the resource matches the filter.
+	Matches(resource map[string]any) bool
+}
+
+// AttrPath references an attribute of a resource. Schema is empty for
+// attributes of the core schema of a resource and holds the schema URN for
+// extension attributes.
+type AttrPath struct {
+	Schema string
+	Attr   string
+	Sub    string
+}
+
+func (p AttrPath) String() string {
+	s := p.Attr
+	if p.Schema != "" {
+		s = p.Schema + ":" + s
+	}
+
+	if p.Sub != "" {
+		s += "." + p.Sub
+	}
+
+	return s
+}
+
+// ParseAttrPath parses an attribute path. schemas holds the URNs of all
+// schemas known for the resource, the first one being the core schema.
+func ParseAttrPath(s string, schemas []string) (AttrPath, error) {
+	var p AttrPath
+
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		var found bool
+
+		for idx, schema := range schemas {
+			if len(s) > len(schema) && strings.EqualFold(s[:len(schema)+1], schema+":") {
+				if idx > 0 {
+					p.Schema = schema
+				}
+
+				s = s[len(schema)+1:]
+				found = true
+
+				break
+			}
+
+			if strings.EqualFold(s, schema) && idx > 0 {
+				// the extension object itself
+				return AttrPath{Attr: schema}, nil
+			}
+		}
+
+		if !found {
+			return p, fmt.Errorf("unknown schema in attribute path %q", s)
+		}
+	}
+
+	attr, sub, _ := strings.Cut(s, ".")
+	if attr == "" || strings.Contains(sub, ".") {
+		return p, fmt.Errorf("invalid attribute path %q", s)
+	}
+
+	p.Attr = attr
+	p.Sub = sub
+
+	return p, nil
+}
+
+// ParseFilter parses a SCIM filter expression.
+func ParseFilter(s string, schemas []string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{
+		tokens:  tokens,
+		schemas: schemas,
+	}
+
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q", p.tokens[p.pos].value)
+	}
+
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case '[':
+			tokens = append(tokens, token{tokenLBracket, "["})
+			i++
+		case ']':
+			tokens = append(tokens, token{tokenRBracket, "]"})
+			i++
+		case '"':
+			end := i + 1
+			for ; end < len(s); end++ {
+				if s[end] == '\\' {
+					end++
+					continue
+				}
+
+				if s[end] == '"' {
+					break
+				}
+			}
+
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", i, err)
+			}
+
+			tokens = append(tokens, token{tokenString, value})
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(s); end++ {
+				if strings.IndexByte(" \t\n\r()[]\"", s[end]) >= 0 {
+					break
+				}
+			}
+
+			tokens = append(tokens, token{tokenWord, s[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens  []token
+	pos     int
+	schemas []string
+
+	// inValuePath is set while parsing the filter of a value path, in
+	// which case attribute paths are relative to the elements of the
+	// multi-valued attribute.
+	inValuePath bool
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) peekKeyword(kw string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.value, kw)
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("or") {
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orFilter{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("and") {
+		p.pos++
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andFilter{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+
+	if p.peekKeyword("not") {
+		p.pos++
+
+		inner, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+
+		return notFilter{inner}, nil
+	}
+
+	if t.kind == tokenLParen {
+		return p.parseGroup()
+	}
+
+	return p.parseAttrExpr()
+}
+
+func (p *filterParser) parseGroup() (Filter, error) {
+	if t := p.peek(); t == nil || t.kind != tokenLParen {
+		return nil, fmt.Errorf("expected \"(\"")
+	}
+	p.pos++
+
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t == nil || t.kind != tokenRParen {
+		return nil, fmt.Errorf("expected \")\"")
+	}
+	p.pos++
+
+	return inner, nil
+}
+
+func (p *filterParser) parseAttrExpr() (Filter, error) {
+	t := p.peek()
+	if t.kind != tokenWord {
+		return nil, fmt.Errorf("expected attribute path but got %q", t.value)
+	}
+	p.pos++
+
+	var (
+		path AttrPath
+		err  error
+	)
+	if p.inValuePath {
+		// attributes inside a value path filter are sub-attributes of the
+		// multi-valued attribute.
+		path = AttrPath{Attr: t.value}
+	} else {
+		path, err = ParseAttrPath(t.value, p.schemas)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if next := p.peek(); next != nil && next.kind == tokenLBracket {
+		if p.inValuePath {
+			return nil, fmt.Errorf("nested value paths are not supported")
+		}
+
+		if path.Sub != "" {
+			return nil, fmt.Errorf("invalid value path %q", t.value)
+		}
+
+		p.pos++
+		p.inValuePath = true
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		p.inValuePath = false
+
+		if t := p.peek(); t == nil || t.kind != tokenRBracket {
+			return nil, fmt.Errorf("expected \"]\"")
+		}
+		p.pos++
+
+		return valuePathFilter{path: path, filter: inner}, nil
+	}
+
+	opToken := p.peek()
+	if opToken == nil || opToken.kind != tokenWord {
+		return nil, fmt.Errorf("expected operator after %q", t.value)
+	}
+	p.pos++
+
+	op := strings.ToLower(opToken.value)
+	switch op {
+	case "pr":
+		return compareFilter{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", opToken.value)
+	}
+
+	valueToken := p.peek()
+	if valueToken == nil {
+		return nil, fmt.Errorf("expected value after %q", opToken.value)
+	}
+	p.pos++
+
+	var value any
+	switch valueToken.kind {
+	case tokenString:
+		value = valueToken.value
+	case tokenWord:
+		switch strings.ToLower(valueToken.value) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			f, err := strconv.ParseFloat(valueToken.value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", valueToken.value)
+			}
+			value = f
+		}
+	default:
+		return nil, fmt.Errorf("unexpected token %q", valueToken.value)
+	}
+
+	return compareFilter{path: path, op: op, value: value}, nil
+}
+
+type andFilter struct{ left, right Filter }
+
+func (f andFilter) Matches(r map[string]any) bool { return f.left.Matches(r) && f.right.Matches(r) }
+
+type orFilter struct{ left, right Filter }
+
+func (f orFilter) Matches(r map[string]any) bool { return f.left.Matches(r) || f.right.Matches(r) }
+
+type notFilter struct{ inner Filter }
+
+func (f notFilter) Matches(r map[string]any) bool { return !f.inner.Matches(r) }
+
+type valuePathFilter struct {
+	path   AttrPath
+	filter Filter
+}
+
+func (f valuePathFilter) Matches(r map[string]any) bool {
+	value, ok := lookup(r, f.path)
+	if !ok {
+		return false
+	}
+
+	for _, elem := range asList(value) {
+		if m, ok := elem.(map[string]any); ok && f.filter.Matches(m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type compareFilter struct {
+	path  AttrPath
+	op    string
+	value any
+}
+
+func (f compareFilter) Matches(r map[string]any) bool {
+	value, ok := lookup(r, f.path)
+
+	if f.op == "pr" {
+		return ok && !isEmpty(value)
+	}
+
+	if !ok {
+		return f.op == "ne" && f.value != nil
+	}
+
+	if f.op == "ne" {
+		return !compareFilter{path: f.path, op: "eq", value: f.value}.Matches(r)
+	}
+
+	for _, elem := range asList(value) {
+		// multi-valued complex attributes without a sub-attribute are
+		// compared using their "value" sub-attribute.
+		if m, ok := elem.(map[string]any); ok {
+			elem, _ = getAttr(m, "value")
+		}
+
+		if compareValues(elem, f.op, f.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compareValues(actual any, op string, expected any) bool {
+	switch e := expected.(type) {
+	case nil:
+		return op == "eq" && actual == nil
+
+	case bool:
+		a, ok := actual.(bool)
+		return ok && op == "eq" && a == e
+
+	case float64:
+		var a float64
+		switch v := actual.(type) {
+		case float64:
+			a = v
+		case int:
+			a = float64(v)
+		case int64:
+			a = float64(v)
+		default:
+			return false
+		}
+
+		switch op {
+		case "eq":
+			return a == e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+
+		return false
+
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return false
+		}
+
+		// date-time values are compared chronologically
+		if at, err := time.Parse(time.RFC3339, a); err == nil {
+			if et, err := time.Parse(time.RFC3339, e); err == nil {
+				switch op {
+				case "eq":
+					return at.Equal(et)
+				case "gt":
+					return at.After(et)
+				case "ge":
+					return !at.Before(et)
+				case "lt":
+					return at.Before(et)
+				case "le":
+					return !at.After(et)
+				}
+			}
+		}
+
+		a = strings.ToLower(a)
+		e = strings.ToLower(e)
+
+		switch op {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	}
+
+	return false
+}
+
+// getAttr returns the value of the attribute name from m. Attribute names
+// are case-insensitive.
+func getAttr(m map[string]any, name string) (any, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+
+	for key, v := range m {
+		if strings.EqualFold(key, name) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+// attrKey returns the actual key used for name in m or name if m does not
+// contain the attribute.
+func attrKey(m map[string]any, name string) string {
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+
+	return name
+}
+
+// container returns the object that holds the attributes of the schema
+// referenced by path.
+func container(r map[string]any, path AttrPath) (map[string]any, bool) {
+	if path.Schema == "" {
+		return r, true
+	}
+
+	ext, ok := getAttr(r, path.Schema)
+	if !ok {
+		return nil, false
+	}
+
+	m, ok := ext.(map[string]any)
+
+	return m, ok
+}
+
+func lookup(r map[string]any, path AttrPath) (any, bool) {
+	c, ok := container(r, path)
+	if !ok {
+		return nil, false
+	}
+
+	value, ok := getAttr(c, path.Attr)
+	if !ok || path.Sub == "" {
+		return value, ok
+	}
+
+	// collect the sub-attribute of all elements of a multi-valued
+	// attribute.
+	if list, isList := value.([]any); isList {
+		var result []any
+
+		for _, elem := range list {
+			if m, ok := elem.(map[string]any); ok {
+				if v, ok := getAttr(m, path.Sub); ok {
+					result = append(result, v)
+				}
+			}
+		}
+
+		return result, len(result) > 0
+	}
+
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	return getAttr(m, path.Sub)
+}
+
+func asList(v any) []any {
+	if list, ok := v.([]any); ok {
+		return list
+	}
+
+	return []any{v}
+}
+
+func isEmpty(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case string:
+		return x == ""
+	case []any:
+		return len(x) == 0
+	case map[string]any:
+		return len(x) == 0
+	}
+
+	return false
+}
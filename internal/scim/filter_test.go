@@ -0,0 +1,90 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/scim"
+)
+
+var testSchemas = []string{scim.SchemaUser, scim.SchemaUserExtension}
+
+func testUser(t *testing.T) map[string]any {
+	t.Helper()
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"id": "1",
+		"userName": "Alice",
+		"active": true,
+		"name": {"givenName": "Alice", "familyName": "Doe"},
+		"emails": [
+			{"value": "alice@example.com", "primary": true},
+			{"value": "alice@work.example.com", "type": "work"}
+		],
+		"urn:ietf:params:scim:schemas:extension:cisidm:2.0:User": {
+			"department": "IT",
+			"since": "2020-01-01T00:00:00Z"
+		}
+	}`), &m))
+
+	return m
+}
+
+func Test_ParseFilter(t *testing.T) {
+	user := testUser(t)
+
+	cases := map[string]bool{
+		`userName eq "alice"`:                                 true,
+		`USERNAME eq "ALICE"`:                                 true,
+		`userName ne "alice"`:                                 false,
+		`userName sw "al"`:                                    true,
+		`userName ew "ce"`:                                    true,
+		`userName co "lic"`:                                   true,
+		`name.familyName eq "Doe"`:                            true,
+		`active eq true`:                                      true,
+		`active eq false`:                                     false,
+		`emails pr`:                                           true,
+		`phoneNumbers pr`:                                     false,
+		`emails eq "alice@work.example.com"`:                  true,
+		`emails.value eq "alice@work.example.com"`:            true,
+		`emails[type eq "work" and value co "work"]`:          true,
+		`emails[type eq "home"]`:                              false,
+		`not (userName eq "bob")`:                             true,
+		`userName eq "bob" or active eq true`:                 true,
+		`userName eq "bob" or active eq true and id eq "2"`:   false,
+		`(userName eq "bob" or active eq true) and id eq "1"`: true,
+		`urn:ietf:params:scim:schemas:extension:cisidm:2.0:User:department eq "it"`:                   true,
+		`urn:ietf:params:scim:schemas:extension:cisidm:2.0:User:since gt "2019-12-31T23:00:00+00:00"`: true,
+		`urn:ietf:params:scim:schemas:extension:cisidm:2.0:User:since lt "2020-01-01T01:00:00+02:00"`: false,
+	}
+
+	for expr, expected := range cases {
+		f, err := scim.ParseFilter(expr, testSchemas)
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+
+		assert.Equal(t, expected, f.Matches(user), expr)
+	}
+}
+
+func Test_ParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName foo "alice"`,
+		`userName eq "alice`,
+		`(userName eq "alice"`,
+		`emails[type eq "work"`,
+		`userName eq "alice" and`,
+		`urn:unknown:schema:attr eq "x"`,
+	} {
+		_, err := scim.ParseFilter(expr, testSchemas)
+		assert.Error(t, err, expr)
+	}
+}
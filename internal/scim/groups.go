@@ -0,0 +1,538 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+	"golang.org/x/exp/slices"
+)
+
+// groupSchemas holds all schemas supported for Group resources.
+var groupSchemas = []string{SchemaGroup}
+
+// Group is the SCIM representation of a cisidm role. Group members are the
+// users assigned to the role.
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// groupUpdate describes the changes applied by updateGroup.
+type groupUpdate struct {
+	renamed    bool
+	assigned   []string
+	unassigned []string
+}
+
+func (h *Handler) groupResource(ctx context.Context, tx *repo.Queries, role repo.Role) (*Group, error) {
+	res := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          role.ID,
+		DisplayName: role.Name,
+		Meta: &Meta{
+			ResourceType: resourceTypeGroup,
+			Location:     h.location(endpointGroups, role.ID),
+		},
+	}
+
+	externalID, err := tx.GetSCIMExternalID(ctx, repo.GetSCIMExternalIDParams{
+		ResourceType: resourceTypeGroup,
+		ResourceID:   role.ID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get external id: %w", err)
+	}
+	res.ExternalID = externalID
+
+	members, err := tx.GetUsersByRole(ctx, role.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role members: %w", err)
+	}
+
+	for _, member := range members {
+		display := member.DisplayName
+		if display == "" {
+			display = member.Username
+		}
+
+		res.Members = append(res.Members, MultiValue{
+			Value:   member.ID,
+			Display: display,
+			Type:    resourceTypeUser,
+			Ref:     h.location(endpointUsers, member.ID),
+		})
+	}
+
+	return res, nil
+}
+
+func (h *Handler) getRoleModel(ctx context.Context, tx *repo.Queries, id string) (repo.Role, error) {
+	role, err := tx.GetRoleByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return role, errNotFound(resourceTypeGroup, id)
+		}
+
+		return role, err
+	}
+
+	return role, nil
+}
+
+func (h *Handler) loadGroups(ctx context.Context) ([]map[string]any, error) {
+	roles, err := h.Datastore.GetRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]map[string]any, 0, len(roles))
+	for _, role := range roles {
+		res, err := h.groupResource(ctx, h.Datastore, role)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := toMap(res)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, m)
+	}
+
+	return resources, nil
+}
+
+func (h *Handler) listGroups(ctx context.Context, req *request, _ string) (*response, error) {
+	params, err := listParamsFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := h.loadGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.list(resources, params, groupSchemas)
+}
+
+func (h *Handler) searchGroups(ctx context.Context, req *request, _ string) (*response, error) {
+	params, err := listParamsFromSearch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := h.loadGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.list(resources, params, groupSchemas)
+}
+
+func (h *Handler) getGroup(ctx context.Context, req *request, id string) (*response, error) {
+	role, err := h.getRoleModel(ctx, h.Datastore, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := h.groupResource(ctx, h.Datastore, role)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := toMap(res)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := listParamsFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err = project(m, params.attributes, params.excludedAttributes, groupSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{status: http.StatusOK, body: m}, nil
+}
+
+func (h *Handler) createGroup(ctx context.Context, req *request, _ string) (*response, error) {
+	if !h.Config.DynamicRolesEnabled() {
+		return nil, newError(http.StatusForbidden, "", "dynamic role management is not enabled")
+	}
+
+	var in Group
+	if err := decode(req.body, &in); err != nil {
+		return nil, err
+	}
+
+	if in.DisplayName == "" {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidValue, "displayName is required")
+	}
+
+	var (
+		role   repo.Role
+		update groupUpdate
+	)
+
+	res, err := repo.RunInTransaction(ctx, h.Datastore, func(tx *repo.Queries) (*Group, error) {
+		if err := checkRoleNameAvailable(ctx, tx, in.DisplayName); err != nil {
+			return nil, err
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := tx.CreateRole(ctx, repo.CreateRoleParams{
+			ID:   id.String(),
+			Name: in.DisplayName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create role: %w", err)
+		}
+
+		role, update, err = h.updateGroup(ctx, tx, created, &in)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := h.groupResource(ctx, tx, role)
+		if err != nil {
+			return nil, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetRole, role.ID)
+		audit.RecordChange(ctx, nil, res)
+
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.Changes.Publish(ctx, changes.RoleCreated, "", role.ID, changes.RoleData{Name: role.Name})
+	h.publishGroupUpdate(ctx, role, update)
+
+	return &response{
+		status:   http.StatusCreated,
+		body:     res,
+		id:       res.ID,
+		location: res.Meta.Location,
+	}, nil
+}
+
+func (h *Handler) replaceGroup(ctx context.Context, req *request, id string) (*response, error) {
+	var in Group
+	if err := decode(req.body, &in); err != nil {
+		return nil, err
+	}
+
+	return h.modifyGroup(ctx, id, func(current map[string]any) (*Group, error) {
+		return &in, nil
+	})
+}
+
+func (h *Handler) patchGroup(ctx context.Context, req *request, id string) (*response, error) {
+	var patch PatchRequest
+	if err := decode(req.body, &patch); err != nil {
+		return nil, err
+	}
+
+	if err := validatePatchRequest(patch); err != nil {
+		return nil, err
+	}
+
+	return h.modifyGroup(ctx, id, func(current map[string]any) (*Group, error) {
+		if err := ApplyPatch(current, patch.Operations, groupSchemas); err != nil {
+			return nil, err
+		}
+
+		var in Group
+		if err := fromMap(current, &in); err != nil {
+			return nil, err
+		}
+
+		return &in, nil
+	})
+}
+
+// modifyGroup loads the role with the given id and replaces it with the
+// resource returned by fn. fn receives the current state of the group.
+func (h *Handler) modifyGroup(ctx context.Context, id string, fn func(current map[string]any) (*Group, error)) (*response, error) {
+	audit.SetTarget(ctx, audit.TargetRole, id)
+
+	var (
+		role   repo.Role
+		update groupUpdate
+	)
+
+	res, err := repo.RunInTransaction(ctx, h.Datastore, func(tx *repo.Queries) (*Group, error) {
+		before, err := h.getRoleModel(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := h.groupResource(ctx, tx, before)
+		if err != nil {
+			return nil, err
+		}
+
+		currentMap, err := toMap(current)
+		if err != nil {
+			return nil, err
+		}
+
+		in, err := fn(currentMap)
+		if err != nil {
+			return nil, err
+		}
+
+		role, update, err = h.updateGroup(ctx, tx, before, in)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := h.groupResource(ctx, tx, role)
+		if err != nil {
+			return nil, err
+		}
+
+		audit.RecordChange(ctx, current, res)
+
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.publishGroupUpdate(ctx, role, update)
+
+	return &response{status: http.StatusOK, body: res}, nil
+}
+
+func (h *Handler) deleteGroup(ctx context.Context, req *request, id string) (*response, error) {
+	if !h.Config.DynamicRolesEnabled() {
+		return nil, newError(http.StatusForbidden, "", "dynamic role management is not enabled")
+	}
+
+	audit.SetTarget(ctx, audit.TargetRole, id)
+
+	var role repo.Role
+
+	_, err := repo.RunInTransaction(ctx, h.Datastore, func(tx *repo.Queries) (any, error) {
+		var err error
+
+		role, err = h.getRoleModel(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if role.Origin == "system" {
+			return nil, newError(http.StatusBadRequest, ScimTypeMutability, "system roles cannot be deleted")
+		}
+
+		if role.DeleteProtected {
+			return nil, newError(http.StatusBadRequest, ScimTypeMutability, "role is delete protected")
+		}
+
+		if _, err := tx.DeleteRole(ctx, role.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete role: %w", err)
+		}
+
+		if err := tx.DeleteSCIMExternalID(ctx, repo.DeleteSCIMExternalIDParams{
+			ResourceType: resourceTypeGroup,
+			ResourceID:   role.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to delete external id: %w", err)
+		}
+
+		audit.RecordChange(ctx, role, nil)
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.Changes.Publish(ctx, changes.RoleDeleted, "", role.ID, changes.RoleData{Name: role.Name})
+
+	return &response{status: http.StatusNoContent}, nil
+}
+
+// updateGroup replaces the name, members and external ID of role with the
+// values of in. Renaming a role requires dynamic role management while
+// members may be changed for all roles.
+func (h *Handler) updateGroup(ctx context.Context, tx *repo.Queries, role repo.Role, in *Group) (repo.Role, groupUpdate, error) {
+	var update groupUpdate
+
+	if in.DisplayName == "" {
+		return role, update, newError(http.StatusBadRequest, ScimTypeInvalidValue, "displayName is required")
+	}
+
+	if in.DisplayName != role.Name {
+		if !h.Config.DynamicRolesEnabled() {
+			return role, update, newError(http.StatusBadRequest, ScimTypeMutability, "dynamic role management is not enabled")
+		}
+
+		if role.Origin == "system" {
+			return role, update, newError(http.StatusBadRequest, ScimTypeMutability, "system roles cannot be modified")
+		}
+
+		if err := checkRoleNameAvailable(ctx, tx, in.DisplayName); err != nil {
+			return role, update, err
+		}
+
+		updated, err := tx.UpdateRole(ctx, repo.UpdateRoleParams{
+			ID:              role.ID,
+			Name:            in.DisplayName,
+			Description:     role.Description,
+			DeleteProtected: role.DeleteProtected,
+		})
+		if err != nil {
+			return role, update, fmt.Errorf("failed to update role: %w", err)
+		}
+
+		role = updated
+		update.renamed = true
+	}
+
+	// all assignments are considered so users whose assignment expired or
+	// has not started yet become members again.
+	assignments, err := tx.GetRoleAssignmentsForRole(ctx, role.ID)
+	if err != nil {
+		return role, update, fmt.Errorf("failed to get role assignments: %w", err)
+	}
+
+	now := time.Now()
+	active := make(map[string]bool, len(assignments))
+	for _, a := range assignments {
+		active[a.UserID] = (!a.ValidFrom.Valid || !a.ValidFrom.Time.After(now)) &&
+			(!a.ValidUntil.Valid || a.ValidUntil.Time.After(now))
+	}
+
+	var desired []string
+	for _, member := range in.Members {
+		if member.Value != "" && !slices.Contains(desired, member.Value) {
+			desired = append(desired, member.Value)
+		}
+	}
+
+	// members are synchronized using role assignments which must not
+	// violate any separation-of-duties constraints.
+	if err := h.Constraints.Enforce(ctx, tx, func() error {
+		// scheduled and expired assignments of users that are not listed
+		// are kept since they are not visible as members.
+		for _, a := range assignments {
+			if !active[a.UserID] || slices.Contains(desired, a.UserID) {
+				continue
+			}
+
+			if _, err := tx.UnassignRoleFromUser(ctx, repo.UnassignRoleFromUserParams{UserID: a.UserID, RoleID: role.ID}); err != nil {
+				return fmt.Errorf("failed to unassign user %q: %w", a.UserID, err)
+			}
+
+			update.unassigned = append(update.unassigned, a.UserID)
+		}
+
+		for _, userID := range desired {
+			if active[userID] {
+				continue
+			}
+
+			if _, err := tx.GetUserByID(ctx, userID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return newError(http.StatusBadRequest, ScimTypeInvalidValue, fmt.Sprintf("member %q does not exist", userID))
+				}
+
+				return err
+			}
+
+			// members managed by SCIM are assigned without a validity
+			// period.
+			if err := tx.UpsertRoleAssignment(ctx, repo.UpsertRoleAssignmentParams{UserID: userID, RoleID: role.ID}); err != nil {
+				return fmt.Errorf("failed to assign user %q: %w", userID, err)
+			}
+
+			update.assigned = append(update.assigned, userID)
+		}
+
+		return nil
+	}); err != nil {
+		var cerr *connect.Error
+		if errors.Is(err, constraints.ErrViolation) && errors.As(err, &cerr) {
+			return role, update, newError(http.StatusBadRequest, ScimTypeInvalidValue, cerr.Message())
+		}
+
+		return role, update, err
+	}
+
+	if err := setExternalID(ctx, tx, resourceTypeGroup, role.ID, in.ExternalID); err != nil {
+		return role, update, err
+	}
+
+	return role, update, nil
+}
+
+func (h *Handler) publishGroupUpdate(ctx context.Context, role repo.Role, update groupUpdate) {
+	if update.renamed {
+		h.Changes.Publish(ctx, changes.RoleUpdated, "", role.ID, changes.RoleData{Name: role.Name})
+	}
+
+	if len(update.assigned) > 0 {
+		h.Webhooks.Emit(ctx, webhook.RoleAssigned, webhook.RoleAssignmentData{
+			RoleID:   role.ID,
+			RoleName: role.Name,
+			UserIDs:  update.assigned,
+		})
+
+		for _, userID := range update.assigned {
+			h.Changes.Publish(ctx, changes.RoleAssigned, userID, role.ID, changes.RoleData{Name: role.Name})
+		}
+	}
+
+	if len(update.unassigned) > 0 {
+		h.Webhooks.Emit(ctx, webhook.RoleUnassigned, webhook.RoleAssignmentData{
+			RoleID:   role.ID,
+			RoleName: role.Name,
+			UserIDs:  update.unassigned,
+		})
+
+		for _, userID := range update.unassigned {
+			h.Changes.Publish(ctx, changes.RoleUnassigned, userID, role.ID, changes.RoleData{Name: role.Name})
+		}
+	}
+}
+
+func checkRoleNameAvailable(ctx context.Context, tx *repo.Queries, name string) error {
+	_, err := tx.GetRoleByName(ctx, name)
+	if err == nil {
+		return newError(http.StatusConflict, ScimTypeUniqueness, fmt.Sprintf("displayName %q is already taken", name))
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
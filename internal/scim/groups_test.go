@@ -0,0 +1,73 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_updateGroupMembers(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, id := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: id, Username: id})
+		require.NoError(t, err)
+	}
+
+	role, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: "vets", Name: "vets"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, a := range []repo.UpsertRoleAssignmentParams{
+		{UserID: "alice"},
+		{UserID: "bob", ValidUntil: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+		{UserID: "carol", ValidFrom: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+		{UserID: "dave", ValidUntil: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+	} {
+		a.RoleID = role.ID
+		require.NoError(t, ds.UpsertRoleAssignment(ctx, a))
+	}
+
+	h := NewHandler(&app.Providers{Datastore: ds})
+
+	_, update, err := h.updateGroup(ctx, ds, role, &Group{
+		DisplayName: role.Name,
+		Members:     []MultiValue{{Value: "bob"}, {Value: "carol"}, {Value: "erin"}},
+	})
+	require.NoError(t, err)
+
+	// the expired and scheduled assignments are restored while the expired
+	// assignment of a user that is not listed is kept as it is.
+	assert.Equal(t, []string{"bob", "carol", "erin"}, update.assigned)
+	assert.Equal(t, []string{"alice"}, update.unassigned)
+
+	assignments, err := ds.GetRoleAssignmentsForRole(ctx, role.ID)
+	require.NoError(t, err)
+
+	validity := make(map[string]bool)
+	for _, a := range assignments {
+		validity[a.UserID] = a.ValidFrom.Valid || a.ValidUntil.Valid
+	}
+
+	assert.Equal(t, map[string]bool{"bob": false, "carol": false, "dave": true, "erin": false}, validity)
+
+	members, err := ds.GetUsersByRole(ctx, role.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+}
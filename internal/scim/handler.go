@@ -0,0 +1,282 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/apis/pkg/server"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"golang.org/x/exp/slices"
+)
+
+// Prefix is the path prefix the SCIM handler should be mounted at.
+const Prefix = "/scim/v2"
+
+// maxRequestSize is the maximum size of a non-bulk request body.
+const maxRequestSize = 1 << 20
+
+// Resource endpoints.
+const (
+	endpointUsers  = "Users"
+	endpointGroups = "Groups"
+)
+
+// Handler serves the SCIM 2.0 API. It expects Prefix to be stripped from the
+// request path.
+type Handler struct {
+	*app.Providers
+
+	recorder *audit.Recorder
+}
+
+// NewHandler returns a new SCIM handler. It must only be used if SCIM is
+// enabled in the configuration.
+func NewHandler(p *app.Providers) *Handler {
+	return &Handler{
+		Providers: p,
+		recorder:  audit.NewRecorder(p.Datastore),
+	}
+}
+
+// request is a single SCIM request. It is either decoded from a HTTP request
+// or from an operation of a bulk request.
+type request struct {
+	query     url.Values
+	body      []byte
+	clientIP  string
+	userAgent string
+}
+
+// response is the result of a handled SCIM request.
+type response struct {
+	status int
+	body   any
+
+	// id and location are set for newly created resources.
+	id       string
+	location string
+}
+
+type handlerFunc func(ctx context.Context, req *request, id string) (*response, error)
+
+// route holds the handler for a request. action is the name of the action
+// recorded in the audit log and empty for read-only requests.
+type route struct {
+	fn     handlerFunc
+	id     string
+	action string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := h.checkAuth(ctx); err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	rt, err := h.route(r.Method, r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	limit := int64(maxRequestSize)
+	if rt.action == actionBulk {
+		limit = int64(h.Config.SCIM.MaxBulkPayloadSize)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, "", fmt.Sprintf("failed to read request: %s", err)))
+
+		return
+	}
+
+	if int64(len(body)) > limit {
+		writeError(w, newError(http.StatusRequestEntityTooLarge, "", fmt.Sprintf("the request exceeds the maximum payload size of %d bytes", limit)))
+
+		return
+	}
+
+	req := &request{
+		query:     r.URL.Query(),
+		body:      body,
+		userAgent: r.Header.Get("User-Agent"),
+	}
+
+	if ip := server.RealIPFromContext(ctx); ip != nil {
+		req.clientIP = ip.String()
+	} else {
+		req.clientIP = r.RemoteAddr
+	}
+
+	res, err := h.call(ctx, rt, req)
+	if err != nil {
+		if asError(err).Status >= http.StatusInternalServerError {
+			log.L(ctx).Error("failed to handle SCIM request", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+
+		writeError(w, err)
+
+		return
+	}
+
+	if res.location != "" {
+		w.Header().Set("Location", res.location)
+	}
+
+	writeJSON(w, res.status, res.body)
+}
+
+// call executes rt and records mutating requests in the audit log.
+func (h *Handler) call(ctx context.Context, rt route, req *request) (*response, error) {
+	if rt.action == "" || rt.action == actionBulk {
+		return rt.fn(ctx, req, rt.id)
+	}
+
+	entry := new(audit.Entry)
+	ctx = audit.WithEntry(ctx, entry)
+
+	res, err := rt.fn(ctx, req, rt.id)
+
+	h.recorder.Record(ctx, rt.action, entry, err, req.clientIP, req.userAgent)
+
+	return res, err
+}
+
+const actionBulk = "scim.v2/Bulk"
+
+// route returns the handler for method and path.
+func (h *Handler) route(method, path string) (route, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	notFound := newError(http.StatusNotFound, "", fmt.Sprintf("unknown endpoint %q", path))
+
+	var (
+		routes = make(map[string]route)
+		id     string
+	)
+
+	switch {
+	case len(segments) == 1 && segments[0] == endpointUsers:
+		routes[http.MethodGet] = route{fn: h.listUsers}
+		routes[http.MethodPost] = route{fn: h.createUser, action: "scim.v2.Users/Create"}
+
+	case len(segments) == 2 && segments[0] == endpointUsers && segments[1] == ".search":
+		routes[http.MethodPost] = route{fn: h.searchUsers}
+
+	case len(segments) == 2 && segments[0] == endpointUsers:
+		id = segments[1]
+		routes[http.MethodGet] = route{fn: h.getUser}
+		routes[http.MethodPut] = route{fn: h.replaceUser, action: "scim.v2.Users/Replace"}
+		routes[http.MethodPatch] = route{fn: h.patchUser, action: "scim.v2.Users/Patch"}
+		routes[http.MethodDelete] = route{fn: h.deleteUser, action: "scim.v2.Users/Delete"}
+
+	case len(segments) == 1 && segments[0] == endpointGroups:
+		routes[http.MethodGet] = route{fn: h.listGroups}
+		routes[http.MethodPost] = route{fn: h.createGroup, action: "scim.v2.Groups/Create"}
+
+	case len(segments) == 2 && segments[0] == endpointGroups && segments[1] == ".search":
+		routes[http.MethodPost] = route{fn: h.searchGroups}
+
+	case len(segments) == 2 && segments[0] == endpointGroups:
+		id = segments[1]
+		routes[http.MethodGet] = route{fn: h.getGroup}
+		routes[http.MethodPut] = route{fn: h.replaceGroup, action: "scim.v2.Groups/Replace"}
+		routes[http.MethodPatch] = route{fn: h.patchGroup, action: "scim.v2.Groups/Patch"}
+		routes[http.MethodDelete] = route{fn: h.deleteGroup, action: "scim.v2.Groups/Delete"}
+
+	case len(segments) == 1 && segments[0] == "Bulk":
+		routes[http.MethodPost] = route{fn: h.bulk, action: actionBulk}
+
+	case len(segments) == 1 && segments[0] == "ServiceProviderConfig":
+		routes[http.MethodGet] = route{fn: h.getServiceProviderConfig}
+
+	case len(segments) == 1 && segments[0] == "ResourceTypes":
+		routes[http.MethodGet] = route{fn: h.listResourceTypes}
+
+	case len(segments) == 2 && segments[0] == "ResourceTypes":
+		id = segments[1]
+		routes[http.MethodGet] = route{fn: h.getResourceType}
+
+	case len(segments) == 1 && segments[0] == "Schemas":
+		routes[http.MethodGet] = route{fn: h.listSchemas}
+
+	case len(segments) == 2 && segments[0] == "Schemas":
+		id = segments[1]
+		routes[http.MethodGet] = route{fn: h.getSchema}
+
+	default:
+		return route{}, notFound
+	}
+
+	rt, ok := routes[method]
+	if !ok {
+		return route{}, newError(http.StatusMethodNotAllowed, "", fmt.Sprintf("method %s is not allowed for %q", method, path))
+	}
+
+	rt.id = id
+
+	return rt, nil
+}
+
+// checkAuth ensures the request is authenticated and the caller is assigned
+// to one of the roles allowed to use the SCIM API.
+func (h *Handler) checkAuth(ctx context.Context) error {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return newError(http.StatusUnauthorized, "", "no access token provided")
+	}
+
+	var roles []string
+	if claims.AppMetadata != nil && claims.AppMetadata.Authorization != nil {
+		roles = claims.AppMetadata.Authorization.Roles
+	}
+
+	for _, allowed := range h.Config.SCIM.AllowedRoles {
+		if slices.Contains(roles, allowed) {
+			return nil
+		}
+
+		// allowed roles may also be specified by name
+		if role, err := h.Datastore.GetRoleByName(ctx, allowed); err == nil && slices.Contains(roles, role.ID) {
+			return nil
+		}
+	}
+
+	return newError(http.StatusForbidden, "", "access token does not include one of the required roles")
+}
+
+// baseURL returns the public URL of the SCIM API.
+func (h *Handler) baseURL() string {
+	return strings.TrimSuffix(h.Config.UserInterface.PublicURL, "/") + Prefix
+}
+
+// location returns the URL of the resource with id served at endpoint.
+func (h *Handler) location(endpoint, id string) string {
+	return h.baseURL() + "/" + endpoint + "/" + id
+}
+
+// decode decodes a SCIM request body into v.
+func decode(body []byte, v any) error {
+	if len(body) == 0 {
+		return newError(http.StatusBadRequest, ScimTypeInvalidSyntax, "missing request body")
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return newError(http.StatusBadRequest, ScimTypeInvalidSyntax, fmt.Sprintf("failed to decode request: %s", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listParams holds the query parameters of list and search requests.
+type listParams struct {
+	filter             string
+	startIndex         int
+	count              *int
+	attributes         []string
+	excludedAttributes []string
+}
+
+func listParamsFromQuery(req *request) (listParams, error) {
+	p := listParams{
+		filter:             req.query.Get("filter"),
+		attributes:         splitList(req.query.Get("attributes")),
+		excludedAttributes: splitList(req.query.Get("excludedAttributes")),
+	}
+
+	if v := req.query.Get("startIndex"); v != "" {
+		idx, err := strconv.Atoi(v)
+		if err != nil {
+			return p, newError(http.StatusBadRequest, ScimTypeInvalidValue, "invalid startIndex")
+		}
+
+		p.startIndex = idx
+	}
+
+	if v := req.query.Get("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			return p, newError(http.StatusBadRequest, ScimTypeInvalidValue, "invalid count")
+		}
+
+		p.count = &count
+	}
+
+	return p, nil
+}
+
+func listParamsFromSearch(req *request) (listParams, error) {
+	var search SearchRequest
+	if err := decode(req.body, &search); err != nil {
+		return listParams{}, err
+	}
+
+	if len(search.Schemas) > 0 && !isSchema(MessageSearchRequest, search.Schemas) {
+		return listParams{}, newError(http.StatusBadRequest, ScimTypeInvalidSyntax, fmt.Sprintf("expected schema %q", MessageSearchRequest))
+	}
+
+	return listParams{
+		filter:             search.Filter,
+		startIndex:         search.StartIndex,
+		count:              search.Count,
+		attributes:         search.Attributes,
+		excludedAttributes: search.ExcludedAttributes,
+	}, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	parts := strings.Split(s, ",")
+	for idx := range parts {
+		parts[idx] = strings.TrimSpace(parts[idx])
+	}
+
+	return parts
+}
+
+// list filters, paginates and projects resources. Resources are filtered in
+// memory which is fine for the number of roles cisidm is designed for. Users
+// are filtered and paged by the database where possible, see listUsers.
+func (h *Handler) list(resources []map[string]any, p listParams, schemas []string) (*response, error) {
+	if p.filter != "" {
+		filter, err := ParseFilter(p.filter, schemas)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, ScimTypeInvalidFilter, err.Error())
+		}
+
+		matched := resources[:0]
+		for _, r := range resources {
+			if filter.Matches(r) {
+				matched = append(matched, r)
+			}
+		}
+
+		resources = matched
+	}
+
+	startIndex, count := h.pageBounds(p)
+
+	page := make([]map[string]any, 0, count)
+	for idx := startIndex - 1; idx < len(resources) && len(page) < count; idx++ {
+		page = append(page, resources[idx])
+	}
+
+	return h.listResponse(page, len(resources), startIndex, p, schemas)
+}
+
+// pageBounds returns the 1-based index of the first resource and the
+// maximum number of resources to return for p.
+func (h *Handler) pageBounds(p listParams) (startIndex int, count int) {
+	startIndex = p.startIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count = h.Config.SCIM.MaxResults
+	if p.count != nil && *p.count < count {
+		count = max(*p.count, 0)
+	}
+
+	return startIndex, count
+}
+
+// listResponse projects the resources of page and returns them as a list
+// response. total is the number of resources matching the filter.
+func (h *Handler) listResponse(page []map[string]any, total, startIndex int, p listParams, schemas []string) (*response, error) {
+	resources := make([]map[string]any, 0, len(page))
+	for _, r := range page {
+		projected, err := project(r, p.attributes, p.excludedAttributes, schemas)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, projected)
+	}
+
+	return &response{
+		status: http.StatusOK,
+		body: &ListResponse{
+			Schemas:      []string{MessageListResponse},
+			TotalResults: total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		},
+	}, nil
+}
+
+// project applies the attributes and excludedAttributes parameters to the
+// resource r. The id and schemas attributes are always returned.
+func project(r map[string]any, attributes, excluded []string, schemas []string) (map[string]any, error) {
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return r, nil
+	}
+
+	parse := func(list []string) ([]AttrPath, error) {
+		paths := make([]AttrPath, 0, len(list))
+		for _, attr := range list {
+			if attr == "" {
+				continue
+			}
+
+			p, err := ParseAttrPath(attr, schemas)
+			if err != nil {
+				return nil, newError(http.StatusBadRequest, ScimTypeInvalidPath, err.Error())
+			}
+
+			paths = append(paths, p)
+		}
+
+		return paths, nil
+	}
+
+	if len(attributes) > 0 {
+		paths, err := parse(attributes)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make(map[string]any)
+		for _, key := range []string{"id", "schemas"} {
+			if v, ok := r[key]; ok {
+				result[key] = v
+			}
+		}
+
+		for _, p := range paths {
+			c, ok := container(r, p)
+			if !ok {
+				continue
+			}
+
+			value, ok := getAttr(c, p.Attr)
+			if !ok {
+				continue
+			}
+
+			target := result
+			if p.Schema != "" {
+				ext, _ := result[p.Schema].(map[string]any)
+				if ext == nil {
+					ext = make(map[string]any)
+					result[p.Schema] = ext
+				}
+
+				target = ext
+			}
+
+			key := attrKey(c, p.Attr)
+
+			if p.Sub == "" {
+				target[key] = value
+				continue
+			}
+
+			target[key] = mergeSubAttr(target[key], value, p.Sub)
+		}
+
+		return result, nil
+	}
+
+	paths, err := parse(excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy the resource so the excluded attributes can be removed without
+	// modifying r.
+	result, err := toMap(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range paths {
+		if strings.EqualFold(p.Attr, "id") || strings.EqualFold(p.Attr, "schemas") {
+			continue
+		}
+
+		c, ok := container(result, p)
+		if !ok {
+			continue
+		}
+
+		key := attrKey(c, p.Attr)
+
+		if p.Sub == "" {
+			delete(c, key)
+			continue
+		}
+
+		for _, elem := range asList(c[key]) {
+			if m, ok := elem.(map[string]any); ok {
+				delete(m, attrKey(m, p.Sub))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// mergeSubAttr copies the sub-attribute sub of value into existing. If value
+// is multi-valued the sub-attribute is copied for each element.
+func mergeSubAttr(existing, value any, sub string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m, _ := existing.(map[string]any)
+		if m == nil {
+			m = make(map[string]any)
+		}
+
+		if subValue, ok := getAttr(v, sub); ok {
+			m[attrKey(v, sub)] = subValue
+		}
+
+		return m
+
+	case []any:
+		list, _ := existing.([]any)
+		if len(list) != len(v) {
+			list = make([]any, len(v))
+		}
+
+		for idx, elem := range v {
+			list[idx] = mergeSubAttr(list[idx], elem, sub)
+		}
+
+		return list
+	}
+
+	return existing
+}
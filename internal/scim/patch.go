@@ -0,0 +1,324 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PatchOp is a single operation of a PATCH request as defined in RFC 7644,
+// Section 3.5.2.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// PatchRequest is the body of a PATCH request.
+type PatchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []PatchOp `json:"Operations"`
+}
+
+// patchPath is a parsed PATCH path: attrPath / valuePath [subAttr].
+type patchPath struct {
+	attr   AttrPath
+	filter Filter
+}
+
+func parsePatchPath(s string, schemas []string) (patchPath, error) {
+	var p patchPath
+
+	open := strings.IndexByte(s, '[')
+	if open < 0 {
+		attr, err := ParseAttrPath(s, schemas)
+		if err != nil {
+			return p, err
+		}
+
+		p.attr = attr
+
+		return p, nil
+	}
+
+	closing := strings.LastIndexByte(s, ']')
+	if closing < open {
+		return p, fmt.Errorf("invalid path %q: missing \"]\"", s)
+	}
+
+	attr, err := ParseAttrPath(s[:open], schemas)
+	if err != nil {
+		return p, err
+	}
+
+	if attr.Sub != "" {
+		return p, fmt.Errorf("invalid path %q", s)
+	}
+
+	filter, err := ParseFilter(s[:closing+1], schemas)
+	if err != nil {
+		return p, err
+	}
+
+	vp, ok := filter.(valuePathFilter)
+	if !ok {
+		return p, fmt.Errorf("invalid path %q", s)
+	}
+
+	if rest := s[closing+1:]; rest != "" {
+		if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+			return p, fmt.Errorf("invalid path %q", s)
+		}
+
+		attr.Sub = rest[1:]
+	}
+
+	p.attr = attr
+	p.filter = vp.filter
+
+	return p, nil
+}
+
+// ApplyPatch applies all operations to the resource r. schemas holds the URNs
+// of all schemas known for the resource type with the core schema first.
+func ApplyPatch(r map[string]any, ops []PatchOp, schemas []string) error {
+	for idx, op := range ops {
+		if err := applyOp(r, op, schemas); err != nil {
+			return fmt.Errorf("operation %d: %w", idx, err)
+		}
+	}
+
+	return nil
+}
+
+func applyOp(r map[string]any, op PatchOp, schemas []string) error {
+	kind := strings.ToLower(op.Op)
+
+	switch kind {
+	case "add", "replace", "remove":
+	default:
+		return newError(400, ScimTypeInvalidSyntax, fmt.Sprintf("unsupported operation %q", op.Op))
+	}
+
+	value := normalizeValue(op.Value)
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return newError(400, ScimTypeNoTarget, "remove operations require a path")
+		}
+
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return newError(400, ScimTypeInvalidValue, "value must be an object if no path is specified")
+		}
+
+		for key, v := range obj {
+			sub := op
+			sub.Path = key
+			sub.Value = v
+
+			// the extension object itself is merged attribute by attribute
+			if ext, ok := v.(map[string]any); ok && isSchema(key, schemas) {
+				for extKey, extValue := range ext {
+					sub.Path = key + ":" + extKey
+					sub.Value = extValue
+
+					if err := applyOp(r, sub, schemas); err != nil {
+						return err
+					}
+				}
+
+				continue
+			}
+
+			if err := applyOp(r, sub, schemas); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	path, err := parsePatchPath(op.Path, schemas)
+	if err != nil {
+		return newError(400, ScimTypeInvalidPath, err.Error())
+	}
+
+	c, ok := container(r, path.attr)
+	if !ok {
+		if kind == "remove" {
+			return nil
+		}
+
+		c = make(map[string]any)
+		r[path.attr.Schema] = c
+	}
+
+	key := attrKey(c, path.attr.Attr)
+
+	if path.filter != nil {
+		return applyFiltered(c, key, kind, path, value)
+	}
+
+	if path.attr.Sub != "" {
+		current, _ := getAttr(c, key)
+
+		obj, ok := current.(map[string]any)
+		if !ok {
+			if kind == "remove" {
+				return nil
+			}
+
+			obj = make(map[string]any)
+			c[key] = obj
+		}
+
+		subKey := attrKey(obj, path.attr.Sub)
+
+		if kind == "remove" {
+			delete(obj, subKey)
+		} else {
+			obj[subKey] = value
+		}
+
+		return nil
+	}
+
+	switch kind {
+	case "remove":
+		delete(c, key)
+
+	case "replace":
+		c[key] = value
+
+	case "add":
+		current, exists := getAttr(c, key)
+		if !exists || current == nil {
+			c[key] = value
+			return nil
+		}
+
+		switch cur := current.(type) {
+		case []any:
+			for _, v := range asList(value) {
+				if !containsValue(cur, v) {
+					cur = append(cur, v)
+				}
+			}
+			c[key] = cur
+
+		case map[string]any:
+			if obj, ok := value.(map[string]any); ok {
+				for k, v := range obj {
+					cur[attrKey(cur, k)] = v
+				}
+			} else {
+				c[key] = value
+			}
+
+		default:
+			c[key] = value
+		}
+	}
+
+	return nil
+}
+
+func applyFiltered(c map[string]any, key, kind string, path patchPath, value any) error {
+	current, _ := getAttr(c, key)
+	list, _ := current.([]any)
+
+	var (
+		result  = make([]any, 0, len(list))
+		matched bool
+	)
+
+	for _, elem := range list {
+		m, ok := elem.(map[string]any)
+		if !ok || !path.filter.Matches(m) {
+			result = append(result, elem)
+			continue
+		}
+
+		matched = true
+
+		switch {
+		case kind == "remove" && path.attr.Sub == "":
+			// drop the element
+			continue
+
+		case kind == "remove":
+			delete(m, attrKey(m, path.attr.Sub))
+
+		case path.attr.Sub != "":
+			m[attrKey(m, path.attr.Sub)] = value
+
+		case kind == "replace":
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return newError(400, ScimTypeInvalidValue, "value must be an object")
+			}
+			m = obj
+
+		default: // add
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return newError(400, ScimTypeInvalidValue, "value must be an object")
+			}
+			for k, v := range obj {
+				m[attrKey(m, k)] = v
+			}
+		}
+
+		result = append(result, m)
+	}
+
+	if !matched {
+		if kind == "remove" {
+			return nil
+		}
+
+		return newError(400, ScimTypeNoTarget, fmt.Sprintf("no value matched the filter of path %q", path.attr.Attr))
+	}
+
+	c[key] = result
+
+	return nil
+}
+
+func isSchema(key string, schemas []string) bool {
+	for _, s := range schemas {
+		if strings.EqualFold(s, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsValue(list []any, v any) bool {
+	for _, elem := range list {
+		if reflect.DeepEqual(elem, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeValue converts v to the generic JSON representation
+// (map[string]any, []any, float64, ...) used for resources.
+func normalizeValue(v any) any {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var result any
+	if err := json.Unmarshal(blob, &result); err != nil {
+		return v
+	}
+
+	return result
+}
@@ -0,0 +1,63 @@
+package scim_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/scim"
+)
+
+func Test_ApplyPatch(t *testing.T) {
+	user := testUser(t)
+
+	err := scim.ApplyPatch(user, []scim.PatchOp{
+		{Op: "replace", Path: "userName", Value: "alice2"},
+		{Op: "Replace", Path: "name.givenName", Value: "Alicia"},
+		{Op: "add", Path: "emails", Value: []any{map[string]any{"value": "alice@home.example.com", "type": "home"}}},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "alice@new.example.com"},
+		{Op: "remove", Path: `emails[value eq "alice@example.com"]`},
+		{Op: "add", Value: map[string]any{
+			"displayName": "Alicia Doe",
+			"urn:ietf:params:scim:schemas:extension:cisidm:2.0:User": map[string]any{
+				"team": "ops",
+			},
+		}},
+		{Op: "remove", Path: "urn:ietf:params:scim:schemas:extension:cisidm:2.0:User:since"},
+		{Op: "replace", Path: "active", Value: false},
+	}, testSchemas)
+	require.NoError(t, err)
+
+	assert.Equal(t, "alice2", user["userName"])
+	assert.Equal(t, "Alicia Doe", user["displayName"])
+	assert.Equal(t, false, user["active"])
+	assert.Equal(t, map[string]any{"givenName": "Alicia", "familyName": "Doe"}, user["name"])
+	assert.Equal(t, []any{
+		map[string]any{"value": "alice@new.example.com", "type": "work"},
+		map[string]any{"value": "alice@home.example.com", "type": "home"},
+	}, user["emails"])
+	assert.Equal(t, map[string]any{
+		"department": "IT",
+		"team":       "ops",
+	}, user[scim.SchemaUserExtension])
+}
+
+func Test_ApplyPatchErrors(t *testing.T) {
+	for name, op := range map[string]scim.PatchOp{
+		"invalid op":        {Op: "move", Path: "userName"},
+		"remove no path":    {Op: "remove"},
+		"no path no object": {Op: "add", Value: "x"},
+		"invalid path":      {Op: "replace", Path: "emails[type eq", Value: "x"},
+		"no target":         {Op: "replace", Path: `emails[type eq "home"].value`, Value: "x"},
+	} {
+		err := scim.ApplyPatch(testUser(t), []scim.PatchOp{op}, testSchemas)
+		assert.Error(t, err, name)
+	}
+
+	// removing values that do not exist is not an error
+	err := scim.ApplyPatch(testUser(t), []scim.PatchOp{
+		{Op: "remove", Path: `emails[type eq "home"]`},
+		{Op: "remove", Path: "nickName"},
+	}, testSchemas)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,361 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+)
+
+// SchemaAttribute describes an attribute of a SCIM schema as defined in
+// RFC 7643, Section 7.
+type SchemaAttribute struct {
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	MultiValued     bool              `json:"multiValued"`
+	Description     string            `json:"description,omitempty"`
+	Required        bool              `json:"required"`
+	CaseExact       bool              `json:"caseExact"`
+	Mutability      string            `json:"mutability"`
+	Returned        string            `json:"returned"`
+	Uniqueness      string            `json:"uniqueness"`
+	CanonicalValues []string          `json:"canonicalValues,omitempty"`
+	ReferenceTypes  []string          `json:"referenceTypes,omitempty"`
+	SubAttributes   []SchemaAttribute `json:"subAttributes,omitempty"`
+}
+
+// Schema is a SCIM schema resource.
+type Schema struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Attributes  []SchemaAttribute `json:"attributes"`
+	Meta        *Meta             `json:"meta,omitempty"`
+}
+
+// ResourceType is a SCIM resource type definition.
+type ResourceType struct {
+	Schemas          []string          `json:"schemas"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Endpoint         string            `json:"endpoint"`
+	Description      string            `json:"description,omitempty"`
+	Schema           string            `json:"schema"`
+	SchemaExtensions []SchemaExtension `json:"schemaExtensions,omitempty"`
+	Meta             *Meta             `json:"meta,omitempty"`
+}
+
+// SchemaExtension references a schema extension of a resource type.
+type SchemaExtension struct {
+	Schema   string `json:"schema"`
+	Required bool   `json:"required"`
+}
+
+// attribute returns a single-valued, optional and writeable attribute.
+func attribute(name, typ string, subAttributes ...SchemaAttribute) SchemaAttribute {
+	return SchemaAttribute{
+		Name:          name,
+		Type:          typ,
+		Mutability:    "readWrite",
+		Returned:      "default",
+		Uniqueness:    "none",
+		SubAttributes: subAttributes,
+	}
+}
+
+func multiValued(a SchemaAttribute) SchemaAttribute {
+	a.MultiValued = true
+	return a
+}
+
+func readOnly(a SchemaAttribute) SchemaAttribute {
+	a.Mutability = "readOnly"
+	return a
+}
+
+func (h *Handler) userSchema() Schema {
+	userName := attribute("userName", "string")
+	userName.Required = true
+	userName.Uniqueness = "server"
+
+	password := attribute("password", "string")
+	password.Mutability = "writeOnly"
+	password.Returned = "never"
+
+	return Schema{
+		Schemas:     []string{SchemaSchema},
+		ID:          SchemaUser,
+		Name:        "User",
+		Description: "User Account",
+		Attributes: []SchemaAttribute{
+			userName,
+			attribute("displayName", "string"),
+			attribute("name", "complex",
+				readOnly(attribute("formatted", "string")),
+				attribute("givenName", "string"),
+				attribute("familyName", "string"),
+			),
+			attribute("active", "boolean"),
+			password,
+			multiValued(attribute("emails", "complex",
+				attribute("value", "string"),
+				attribute("primary", "boolean"),
+			)),
+			multiValued(attribute("phoneNumbers", "complex",
+				attribute("value", "string"),
+				attribute("primary", "boolean"),
+			)),
+			multiValued(attribute("addresses", "complex",
+				attribute("streetAddress", "string"),
+				attribute("locality", "string"),
+				attribute("postalCode", "string"),
+			)),
+			readOnly(multiValued(attribute("groups", "complex",
+				readOnly(attribute("value", "string")),
+				readOnly(attribute("display", "string")),
+				readOnly(attribute("$ref", "reference")),
+			))),
+		},
+		Meta: &Meta{
+			ResourceType: "Schema",
+			Location:     h.location("Schemas", SchemaUser),
+		},
+	}
+}
+
+func (h *Handler) groupSchema() Schema {
+	displayName := attribute("displayName", "string")
+	displayName.Required = true
+	displayName.Uniqueness = "server"
+
+	return Schema{
+		Schemas:     []string{SchemaSchema},
+		ID:          SchemaGroup,
+		Name:        "Group",
+		Description: "Group, mapped to a cisidm role",
+		Attributes: []SchemaAttribute{
+			displayName,
+			multiValued(attribute("members", "complex",
+				attribute("value", "string"),
+				readOnly(attribute("display", "string")),
+				readOnly(attribute("type", "string")),
+				readOnly(attribute("$ref", "reference")),
+			)),
+		},
+		Meta: &Meta{
+			ResourceType: "Schema",
+			Location:     h.location("Schemas", SchemaGroup),
+		},
+	}
+}
+
+// userExtensionSchema describes the configured user extra data fields.
+func (h *Handler) userExtensionSchema() Schema {
+	attrs := make([]SchemaAttribute, 0, len(h.Config.ExtraDataConfig))
+	for _, field := range h.Config.ExtraDataConfig {
+		attrs = append(attrs, fieldAttribute(field))
+	}
+
+	return Schema{
+		Schemas:     []string{SchemaSchema},
+		ID:          SchemaUserExtension,
+		Name:        "CisIdmUser",
+		Description: "Additional user attributes configured as user extra data",
+		Attributes:  attrs,
+		Meta: &Meta{
+			ResourceType: "Schema",
+			Location:     h.location("Schemas", SchemaUserExtension),
+		},
+	}
+}
+
+// fieldAttribute converts an extra data field configuration to a schema
+// attribute. Dates, times and fields of type "any" do not have an exact SCIM
+// counterpart and are described as strings.
+func fieldAttribute(field *config.FieldConfig) SchemaAttribute {
+	var attr SchemaAttribute
+
+	switch field.Type {
+	case config.FieldTypeBool:
+		attr = attribute(field.Name, "boolean")
+	case config.FieldTypeNumber:
+		attr = attribute(field.Name, "decimal")
+	case config.FieldTypeObject:
+		attr = attribute(field.Name, "complex")
+		for _, prop := range field.Properties {
+			attr.SubAttributes = append(attr.SubAttributes, fieldAttribute(prop))
+		}
+	case config.FieldTypeList:
+		if field.ElementType != nil {
+			attr = fieldAttribute(field.ElementType)
+			attr.Name = field.Name
+		} else {
+			attr = attribute(field.Name, "string")
+		}
+		attr.MultiValued = true
+	default:
+		attr = attribute(field.Name, "string")
+	}
+
+	attr.Description = field.Description
+	if attr.Description == "" {
+		attr.Description = field.DisplayName
+	}
+
+	for _, v := range field.PossibleValues {
+		attr.CanonicalValues = append(attr.CanonicalValues, v.Value)
+	}
+
+	return attr
+}
+
+func (h *Handler) schemas() []Schema {
+	return []Schema{
+		h.userSchema(),
+		h.userExtensionSchema(),
+		h.groupSchema(),
+	}
+}
+
+func (h *Handler) resourceTypes() []ResourceType {
+	return []ResourceType{
+		{
+			Schemas:     []string{SchemaResourceType},
+			ID:          resourceTypeUser,
+			Name:        resourceTypeUser,
+			Endpoint:    "/" + endpointUsers,
+			Description: "User Account",
+			Schema:      SchemaUser,
+			SchemaExtensions: []SchemaExtension{
+				{Schema: SchemaUserExtension},
+			},
+			Meta: &Meta{
+				ResourceType: "ResourceType",
+				Location:     h.location("ResourceTypes", resourceTypeUser),
+			},
+		},
+		{
+			Schemas:     []string{SchemaResourceType},
+			ID:          resourceTypeGroup,
+			Name:        resourceTypeGroup,
+			Endpoint:    "/" + endpointGroups,
+			Description: "Group, mapped to a cisidm role",
+			Schema:      SchemaGroup,
+			Meta: &Meta{
+				ResourceType: "ResourceType",
+				Location:     h.location("ResourceTypes", resourceTypeGroup),
+			},
+		},
+	}
+}
+
+func (h *Handler) getServiceProviderConfig(ctx context.Context, req *request, _ string) (*response, error) {
+	cfg := h.Config.SCIM
+
+	return &response{
+		status: http.StatusOK,
+		body: map[string]any{
+			"schemas": []string{SchemaServiceProviderConfig},
+			"patch": map[string]any{
+				"supported": true,
+			},
+			"bulk": map[string]any{
+				"supported":      true,
+				"maxOperations":  cfg.MaxBulkOperations,
+				"maxPayloadSize": cfg.MaxBulkPayloadSize,
+			},
+			"filter": map[string]any{
+				"supported":  true,
+				"maxResults": cfg.MaxResults,
+			},
+			"changePassword": map[string]any{
+				"supported": true,
+			},
+			"sort": map[string]any{
+				"supported": false,
+			},
+			"etag": map[string]any{
+				"supported": false,
+			},
+			"authenticationSchemes": []map[string]any{
+				{
+					"type":        "oauthbearertoken",
+					"name":        "Bearer Token",
+					"description": "Authentication using an API token or access token",
+					"primary":     true,
+				},
+			},
+			"meta": &Meta{
+				ResourceType: "ServiceProviderConfig",
+				Location:     h.baseURL() + "/ServiceProviderConfig",
+			},
+		},
+	}, nil
+}
+
+func (h *Handler) listSchemas(ctx context.Context, req *request, _ string) (*response, error) {
+	schemas := h.schemas()
+
+	resources := make([]map[string]any, 0, len(schemas))
+	for _, s := range schemas {
+		m, err := toMap(s)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, m)
+	}
+
+	return listResponse(resources), nil
+}
+
+func (h *Handler) getSchema(ctx context.Context, req *request, id string) (*response, error) {
+	for _, s := range h.schemas() {
+		if s.ID == id {
+			return &response{status: http.StatusOK, body: s}, nil
+		}
+	}
+
+	return nil, errNotFound("Schema", id)
+}
+
+func (h *Handler) listResourceTypes(ctx context.Context, req *request, _ string) (*response, error) {
+	types := h.resourceTypes()
+
+	resources := make([]map[string]any, 0, len(types))
+	for _, t := range types {
+		m, err := toMap(t)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, m)
+	}
+
+	return listResponse(resources), nil
+}
+
+func (h *Handler) getResourceType(ctx context.Context, req *request, id string) (*response, error) {
+	for _, t := range h.resourceTypes() {
+		if t.ID == id {
+			return &response{status: http.StatusOK, body: t}, nil
+		}
+	}
+
+	return nil, errNotFound("ResourceType", id)
+}
+
+// listResponse returns an unpaginated list response.
+func listResponse(resources []map[string]any) *response {
+	return &response{
+		status: http.StatusOK,
+		body: &ListResponse{
+			Schemas:      []string{MessageListResponse},
+			TotalResults: len(resources),
+			StartIndex:   1,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		},
+	}
+}
@@ -0,0 +1,163 @@
+// Package scim implements a SCIM 2.0 (RFC 7643, RFC 7644) service provider
+// for provisioning users and roles from external systems like HR tools.
+//
+// SCIM Users map to cisidm users and SCIM Groups map to roles with group
+// membership being role assignments. Custom user attributes are exposed using
+// a schema extension that is derived from the configured user extra-data
+// fields.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// Schema URNs.
+const (
+	SchemaUser          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaUserExtension = "urn:ietf:params:scim:schemas:extension:cisidm:2.0:User"
+
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	MessageListResponse  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	MessageSearchRequest = "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
+	MessagePatchOp       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	MessageBulkRequest   = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	MessageBulkResponse  = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	MessageError         = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Values for the scimType field of SCIM errors.
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeTooMany       = "tooMany"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeMutability    = "mutability"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeInvalidValue  = "invalidValue"
+)
+
+// ContentType is the media type of SCIM messages.
+const ContentType = "application/scim+json"
+
+// Error is a SCIM error response.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   int      `json:"status,string"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.ScimType, e.Detail)
+	}
+
+	return fmt.Sprintf("%d: %s", e.Status, e.Detail)
+}
+
+func newError(status int, scimType string, detail string) *Error {
+	return &Error{
+		Schemas:  []string{MessageError},
+		Status:   status,
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func errNotFound(resourceType, id string) *Error {
+	return newError(http.StatusNotFound, "", fmt.Sprintf("%s %q not found", resourceType, id))
+}
+
+// asError converts err to a SCIM error. Errors that are not already a SCIM
+// error are reported as internal server errors.
+func asError(err error) *Error {
+	var serr *Error
+	if errors.As(err, &serr) {
+		return serr
+	}
+
+	return newError(http.StatusInternalServerError, "", err.Error())
+}
+
+// ListResponse is the response message for list and search requests.
+type ListResponse struct {
+	Schemas      []string         `json:"schemas"`
+	TotalResults int              `json:"totalResults"`
+	StartIndex   int              `json:"startIndex"`
+	ItemsPerPage int              `json:"itemsPerPage"`
+	Resources    []map[string]any `json:"Resources"`
+}
+
+// SearchRequest is the body of a POST /.search request.
+type SearchRequest struct {
+	Schemas            []string `json:"schemas"`
+	Attributes         []string `json:"attributes,omitempty"`
+	ExcludedAttributes []string `json:"excludedAttributes,omitempty"`
+	Filter             string   `json:"filter,omitempty"`
+	StartIndex         int      `json:"startIndex,omitempty"`
+	Count              *int     `json:"count,omitempty"`
+}
+
+// Meta holds resource metadata.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+
+	if body == nil {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.L(nil).Error("failed to encode SCIM response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	serr := asError(err)
+	writeJSON(w, serr.Status, serr)
+}
+
+// toMap converts v to its generic JSON representation.
+func toMap(v any) (map[string]any, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(blob, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// fromMap decodes the generic resource representation m into v. JSON keys
+// are matched case-insensitively as required for SCIM attribute names.
+func fromMap(m map[string]any, v any) error {
+	blob, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(blob, v); err != nil {
+		return newError(http.StatusBadRequest, ScimTypeInvalidValue, err.Error())
+	}
+
+	return nil
+}
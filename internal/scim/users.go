@@ -0,0 +1,1023 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Resource types used for meta.resourceType and the external ID mapping.
+const (
+	resourceTypeUser  = "User"
+	resourceTypeGroup = "Group"
+)
+
+// userSchemas holds all schemas supported for User resources with the core
+// schema first.
+var userSchemas = []string{SchemaUser, SchemaUserExtension}
+
+// User is the SCIM representation of a cisidm user.
+//
+// Extra data is exposed using the cisidm user extension. The groups
+// attribute is read-only, group membership must be managed using the Groups
+// endpoint.
+type User struct {
+	Schemas      []string       `json:"schemas"`
+	ID           string         `json:"id,omitempty"`
+	ExternalID   string         `json:"externalId,omitempty"`
+	UserName     string         `json:"userName"`
+	DisplayName  string         `json:"displayName,omitempty"`
+	Name         *Name          `json:"name,omitempty"`
+	Active       *bool          `json:"active,omitempty"`
+	Password     string         `json:"password,omitempty"`
+	Emails       []MultiValue   `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue   `json:"phoneNumbers,omitempty"`
+	Addresses    []Address      `json:"addresses,omitempty"`
+	Groups       []MultiValue   `json:"groups,omitempty"`
+	Extension    map[string]any `json:"urn:ietf:params:scim:schemas:extension:cisidm:2.0:User,omitempty"`
+	Meta         *Meta          `json:"meta,omitempty"`
+}
+
+// Name holds the name components of a user.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is an element of a multi-valued attribute like emails or
+// members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Address is a physical mailing address of a user.
+type Address struct {
+	Type          string `json:"type,omitempty"`
+	StreetAddress string `json:"streetAddress,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	PostalCode    string `json:"postalCode,omitempty"`
+	Primary       bool   `json:"primary,omitempty"`
+}
+
+// userUpdate describes the changes applied by updateUser.
+type userUpdate struct {
+	deactivated     bool
+	passwordChanged bool
+}
+
+func (h *Handler) userResource(ctx context.Context, tx *repo.Queries, usr repo.User) (*User, error) {
+	active := !usr.Deleted
+
+	res := &User{
+		Schemas:     []string{SchemaUser},
+		ID:          usr.ID,
+		UserName:    usr.Username,
+		DisplayName: usr.DisplayName,
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: resourceTypeUser,
+			Location:     h.location(endpointUsers, usr.ID),
+		},
+	}
+
+	if usr.FirstName != "" || usr.LastName != "" {
+		res.Name = &Name{
+			Formatted:  strings.TrimSpace(usr.FirstName + " " + usr.LastName),
+			GivenName:  usr.FirstName,
+			FamilyName: usr.LastName,
+		}
+	}
+
+	externalID, err := tx.GetSCIMExternalID(ctx, repo.GetSCIMExternalIDParams{
+		ResourceType: resourceTypeUser,
+		ResourceID:   usr.ID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get external id: %w", err)
+	}
+	res.ExternalID = externalID
+
+	emails, err := tx.GetEmailsForUserByID(ctx, usr.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user emails: %w", err)
+	}
+	for _, mail := range emails {
+		res.Emails = append(res.Emails, MultiValue{
+			Value:   mail.Address,
+			Primary: mail.IsPrimary,
+		})
+	}
+
+	phones, err := tx.GetPhoneNumbersByUserID(ctx, usr.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user phone numbers: %w", err)
+	}
+	for _, phone := range phones {
+		res.PhoneNumbers = append(res.PhoneNumbers, MultiValue{
+			Value:   phone.PhoneNumber,
+			Primary: phone.IsPrimary,
+		})
+	}
+
+	addresses, err := tx.GetUserAddresses(ctx, usr.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user addresses: %w", err)
+	}
+	for _, addr := range addresses {
+		res.Addresses = append(res.Addresses, Address{
+			StreetAddress: addr.Street,
+			Locality:      addr.CityName,
+			PostalCode:    addr.CityCode,
+		})
+	}
+
+	roles, err := tx.GetRolesForUser(ctx, usr.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	for _, role := range roles {
+		res.Groups = append(res.Groups, MultiValue{
+			Value:   role.ID,
+			Display: role.Name,
+			Ref:     h.location(endpointGroups, role.ID),
+		})
+	}
+
+	if usr.Extra != "" {
+		if err := json.Unmarshal([]byte(usr.Extra), &res.Extension); err != nil {
+			return nil, fmt.Errorf("failed to decode user extra data: %w", err)
+		}
+	}
+
+	if len(res.Extension) > 0 {
+		res.Schemas = append(res.Schemas, SchemaUserExtension)
+	}
+
+	return res, nil
+}
+
+func (h *Handler) getUserModel(ctx context.Context, tx *repo.Queries, id string) (repo.User, error) {
+	usr, err := tx.GetUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return usr, errNotFound(resourceTypeUser, id)
+		}
+
+		return usr, err
+	}
+
+	return usr, nil
+}
+
+// userResources returns the SCIM representation of users.
+func (h *Handler) userResources(ctx context.Context, users []repo.User) ([]map[string]any, error) {
+	resources := make([]map[string]any, 0, len(users))
+	for _, usr := range users {
+		res, err := h.userResource(ctx, h.Datastore, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := toMap(res)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, m)
+	}
+
+	return resources, nil
+}
+
+// queryUsers lists users matching p. If the filter of p can be expressed
+// using ListUsersPage, filtering and paging is done by the database.
+// Otherwise the database only narrows down the candidates, which are then
+// filtered and paged in memory.
+func (h *Handler) queryUsers(ctx context.Context, p listParams) (*response, error) {
+	var filter Filter
+	if p.filter != "" {
+		var err error
+
+		filter, err = ParseFilter(p.filter, userSchemas)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, ScimTypeInvalidFilter, err.Error())
+		}
+	}
+
+	query, exact := userQuery(filter)
+
+	if !exact {
+		users, err := h.Datastore.ListUsersPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		resources, err := h.userResources(ctx, users)
+		if err != nil {
+			return nil, err
+		}
+
+		return h.list(resources, p, userSchemas)
+	}
+
+	total, err := h.Datastore.CountUsersMatching(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, count := h.pageBounds(p)
+
+	// a zero limit would return all users, there's nothing to query if only
+	// the total number of results has been requested.
+	var users []repo.User
+	if count > 0 {
+		query.Limit = int64(count)
+		query.Offset = int64(startIndex - 1)
+
+		users, err = h.Datastore.ListUsersPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resources, err := h.userResources(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.listResponse(resources, int(total), startIndex, p, userSchemas)
+}
+
+// userQuery translates filter into the filters of ListUsersPage. The
+// returned parameters match all users matched by filter but may match more.
+// exact reports whether they match exactly the same users.
+func userQuery(filter Filter) (query repo.ListUsersPageParams, exact bool) {
+	if filter == nil {
+		return query, true
+	}
+
+	return query, addUserFilter(&query, filter)
+}
+
+// addUserFilter adds f to query and reports whether f could be expressed
+// exactly. Filters that cannot be expressed are left out, only conjunctions
+// are split.
+func addUserFilter(query *repo.ListUsersPageParams, f Filter) bool {
+	switch f := f.(type) {
+	case andFilter:
+		left := addUserFilter(query, f.left)
+		right := addUserFilter(query, f.right)
+
+		return left && right
+
+	case valuePathFilter:
+		inner, ok := f.filter.(compareFilter)
+		if !ok || f.path.Schema != "" || !strings.EqualFold(f.path.Attr, "emails") || !strings.EqualFold(inner.path.Attr, "value") {
+			return false
+		}
+
+		return addUserCompare(query, compareFilter{
+			path:  AttrPath{Attr: "emails"},
+			op:    inner.op,
+			value: inner.value,
+		})
+
+	case compareFilter:
+		return addUserCompare(query, f)
+	}
+
+	return false
+}
+
+var matchModes = map[string]repo.MatchMode{
+	"eq": repo.MatchEquals,
+	"co": repo.MatchContains,
+	"sw": repo.MatchPrefix,
+	"ew": repo.MatchSuffix,
+}
+
+func addUserCompare(query *repo.ListUsersPageParams, f compareFilter) bool {
+	if f.path.Schema != "" {
+		return false
+	}
+
+	// active is the only boolean attribute that is stored in a column.
+	if strings.EqualFold(f.path.Attr, "active") && f.path.Sub == "" {
+		active, ok := f.value.(bool)
+		if !ok || f.op != "eq" || query.Deleted.Valid {
+			return false
+		}
+
+		query.Deleted = sql.NullBool{Bool: !active, Valid: true}
+
+		return true
+	}
+
+	value, ok := f.value.(string)
+	if !ok || value == "" {
+		return false
+	}
+
+	mode, ok := matchModes[f.op]
+	if !ok {
+		return false
+	}
+
+	switch {
+	case strings.EqualFold(f.path.Attr, "userName") && f.path.Sub == "" && query.Username == "":
+		query.Username, query.UsernameMatch = value, mode
+
+	case strings.EqualFold(f.path.Attr, "displayName") && f.path.Sub == "" && query.DisplayName == "":
+		query.DisplayName, query.DisplayNameMatch = value, mode
+
+	case strings.EqualFold(f.path.Attr, "emails") && (f.path.Sub == "" || strings.EqualFold(f.path.Sub, "value")) && query.Email == "":
+		query.Email, query.EmailMatch = value, mode
+
+	case strings.EqualFold(f.path.Attr, "externalId") && f.path.Sub == "" && f.op == "eq" && query.ExternalID == "":
+		query.ExternalID = value
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) listUsers(ctx context.Context, req *request, _ string) (*response, error) {
+	params, err := listParamsFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.queryUsers(ctx, params)
+}
+
+func (h *Handler) searchUsers(ctx context.Context, req *request, _ string) (*response, error) {
+	params, err := listParamsFromSearch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.queryUsers(ctx, params)
+}
+
+func (h *Handler) getUser(ctx context.Context, req *request, id string) (*response, error) {
+	usr, err := h.getUserModel(ctx, h.Datastore, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := h.userResource(ctx, h.Datastore, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := toMap(res)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := listParamsFromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err = project(m, params.attributes, params.excludedAttributes, userSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{status: http.StatusOK, body: m}, nil
+}
+
+func (h *Handler) createUser(ctx context.Context, req *request, _ string) (*response, error) {
+	var in User
+	if err := decode(req.body, &in); err != nil {
+		return nil, err
+	}
+
+	if in.UserName == "" {
+		return nil, newError(http.StatusBadRequest, ScimTypeInvalidValue, "userName is required")
+	}
+
+	var usr repo.User
+
+	res, err := repo.RunInTransaction(ctx, h.Datastore, func(tx *repo.Queries) (*User, error) {
+		if err := checkUsernameAvailable(ctx, tx, in.UserName); err != nil {
+			return nil, err
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := tx.CreateUser(ctx, repo.CreateUserParams{
+			ID:       id.String(),
+			Username: in.UserName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+
+		usr, _, err = h.updateUser(ctx, tx, created, &in)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := h.userResource(ctx, tx, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetUser, usr.ID)
+		audit.RecordChange(ctx, nil, res)
+
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.EmitUserEvent(ctx, webhook.UserCreated, usr)
+	h.PublishUserCreated(ctx, usr)
+
+	if usr.Deleted {
+		h.EmitUserEvent(ctx, webhook.UserDeleted, usr)
+		h.Changes.Publish(ctx, changes.UserDeleted, usr.ID, "", changes.UserData{Username: usr.Username})
+	}
+
+	return &response{
+		status:   http.StatusCreated,
+		body:     res,
+		id:       res.ID,
+		location: res.Meta.Location,
+	}, nil
+}
+
+func (h *Handler) replaceUser(ctx context.Context, req *request, id string) (*response, error) {
+	var in User
+	if err := decode(req.body, &in); err != nil {
+		return nil, err
+	}
+
+	return h.modifyUser(ctx, id, func(current map[string]any) (*User, error) {
+		return &in, nil
+	})
+}
+
+func (h *Handler) patchUser(ctx context.Context, req *request, id string) (*response, error) {
+	var patch PatchRequest
+	if err := decode(req.body, &patch); err != nil {
+		return nil, err
+	}
+
+	if err := validatePatchRequest(patch); err != nil {
+		return nil, err
+	}
+
+	return h.modifyUser(ctx, id, func(current map[string]any) (*User, error) {
+		if err := ApplyPatch(current, patch.Operations, userSchemas); err != nil {
+			return nil, err
+		}
+
+		// some identity providers send boolean values as strings
+		if active, ok := getAttr(current, "active"); ok {
+			if s, ok := active.(string); ok {
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, newError(http.StatusBadRequest, ScimTypeInvalidValue, "active must be a boolean")
+				}
+
+				current[attrKey(current, "active")] = b
+			}
+		}
+
+		var in User
+		if err := fromMap(current, &in); err != nil {
+			return nil, err
+		}
+
+		return &in, nil
+	})
+}
+
+// modifyUser loads the user with the given id and replaces it with the
+// resource returned by fn. fn receives the current state of the user.
+func (h *Handler) modifyUser(ctx context.Context, id string, fn func(current map[string]any) (*User, error)) (*response, error) {
+	audit.SetTarget(ctx, audit.TargetUser, id)
+
+	var (
+		usr    repo.User
+		before repo.User
+		update userUpdate
+	)
+
+	res, err := repo.RunInTransaction(ctx, h.Datastore, func(tx *repo.Queries) (*User, error) {
+		var err error
+
+		before, err = h.getUserModel(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := h.userResource(ctx, tx, before)
+		if err != nil {
+			return nil, err
+		}
+
+		currentMap, err := toMap(current)
+		if err != nil {
+			return nil, err
+		}
+
+		in, err := fn(currentMap)
+		if err != nil {
+			return nil, err
+		}
+
+		if in.Active != nil && !*in.Active && !before.Deleted {
+			if err := checkNotSelf(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+
+		usr, update, err = h.updateUser(ctx, tx, before, in)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := h.userResource(ctx, tx, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		audit.RecordChange(ctx, current, res)
+
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if update.deactivated {
+		h.EmitUserEvent(ctx, webhook.UserDeleted, usr)
+		h.Changes.Publish(ctx, changes.UserDeleted, usr.ID, "", changes.UserData{Username: usr.Username})
+	} else {
+		h.EmitUserEvent(ctx, webhook.UserUpdated, usr)
+		h.Changes.Publish(ctx, changes.UserUpdated, usr.ID, "", changes.UserData{Username: usr.Username})
+	}
+
+	if update.passwordChanged {
+		h.emitPasswordChanged(ctx, usr.ID)
+	}
+
+	return &response{status: http.StatusOK, body: res}, nil
+}
+
+func (h *Handler) deleteUser(ctx context.Context, req *request, id string) (*response, error) {
+	audit.SetTarget(ctx, audit.TargetUser, id)
+
+	if err := checkNotSelf(ctx, id); err != nil {
+		return nil, err
+	}
+
+	usr, err := h.getUserModel(ctx, h.Datastore, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// deleting an already deactivated user is a no-op
+	if usr.Deleted {
+		return &response{status: http.StatusNoContent}, nil
+	}
+
+	// users are only soft-deleted, the same as when using the UserService
+	if _, err := h.Datastore.DeleteUser(ctx, usr.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	audit.RecordChange(ctx, usr, nil)
+
+	h.EmitUserEvent(ctx, webhook.UserDeleted, usr)
+	h.Changes.Publish(ctx, changes.UserDeleted, usr.ID, "", changes.UserData{Username: usr.Username})
+
+	return &response{status: http.StatusNoContent}, nil
+}
+
+// updateUser replaces all supported attributes of usr with the values of in.
+// Read-only attributes like groups are ignored. If the user extension is not
+// part of in the user extra data is kept unchanged.
+func (h *Handler) updateUser(ctx context.Context, tx *repo.Queries, usr repo.User, in *User) (repo.User, userUpdate, error) {
+	var update userUpdate
+
+	if in.UserName == "" {
+		return usr, update, newError(http.StatusBadRequest, ScimTypeInvalidValue, "userName is required")
+	}
+
+	if in.UserName != usr.Username {
+		if !h.Config.AllowUsernameChange {
+			return usr, update, newError(http.StatusBadRequest, ScimTypeMutability, "username changes are not allowed")
+		}
+
+		if err := checkUsernameAvailable(ctx, tx, in.UserName); err != nil {
+			return usr, update, err
+		}
+	}
+
+	params := repo.UpdateUserParams{
+		ID:          usr.ID,
+		Username:    in.UserName,
+		DisplayName: in.DisplayName,
+		Extra:       usr.Extra,
+		Avatar:      usr.Avatar,
+		Birthday:    usr.Birthday,
+	}
+
+	if in.Name != nil {
+		params.FirstName = in.Name.GivenName
+		params.LastName = in.Name.FamilyName
+	}
+
+	if in.Extension != nil {
+		extra, err := h.extraFromExtension(in.Extension)
+		if err != nil {
+			return usr, update, err
+		}
+
+		params.Extra = extra
+	}
+
+	updated, err := tx.UpdateUser(ctx, params)
+	if err != nil {
+		return usr, update, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := syncEmails(ctx, tx, usr.ID, in.Emails); err != nil {
+		return usr, update, err
+	}
+
+	if err := syncPhoneNumbers(ctx, tx, usr.ID, in.PhoneNumbers); err != nil {
+		return usr, update, err
+	}
+
+	if err := syncAddresses(ctx, tx, usr.ID, in.Addresses); err != nil {
+		return usr, update, err
+	}
+
+	if err := setExternalID(ctx, tx, resourceTypeUser, usr.ID, in.ExternalID); err != nil {
+		return usr, update, err
+	}
+
+	if in.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return usr, update, fmt.Errorf("failed to generate password hash: %w", err)
+		}
+
+		if _, err := tx.SetUserPassword(ctx, repo.SetUserPasswordParams{ID: usr.ID, Password: string(hash)}); err != nil {
+			return usr, update, fmt.Errorf("failed to save user password: %w", err)
+		}
+
+		update.passwordChanged = true
+	}
+
+	if in.Active != nil {
+		switch {
+		case !*in.Active && !usr.Deleted:
+			if _, err := tx.DeleteUser(ctx, usr.ID); err != nil {
+				return usr, update, fmt.Errorf("failed to deactivate user: %w", err)
+			}
+
+			updated.Deleted = true
+			update.deactivated = true
+
+		case *in.Active && usr.Deleted:
+			if _, err := tx.RestoreUser(ctx, usr.ID); err != nil {
+				return usr, update, fmt.Errorf("failed to activate user: %w", err)
+			}
+
+			updated.Deleted = false
+		}
+	}
+
+	return updated, update, nil
+}
+
+// extraFromExtension validates the user extension attributes against the
+// configured extra data fields and returns the JSON encoded extra data.
+func (h *Handler) extraFromExtension(ext map[string]any) (string, error) {
+	if len(ext) == 0 {
+		return "", nil
+	}
+
+	pb, err := structpb.NewStruct(ext)
+	if err != nil {
+		return "", newError(http.StatusBadRequest, ScimTypeInvalidValue, err.Error())
+	}
+
+	if err := h.ValidateUserExtraData(pb); err != nil {
+		return "", newError(http.StatusBadRequest, ScimTypeInvalidValue, err.Error())
+	}
+
+	blob, err := json.Marshal(ext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(blob), nil
+}
+
+func (h *Handler) emitPasswordChanged(ctx context.Context, userID string) {
+	var changedBy string
+	if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+		changedBy = claims.Subject
+	}
+
+	h.Webhooks.Emit(ctx, webhook.PasswordChanged, webhook.PasswordChangedData{
+		UserID:    userID,
+		ChangedBy: changedBy,
+	})
+}
+
+func checkUsernameAvailable(ctx context.Context, tx *repo.Queries, username string) error {
+	_, err := tx.GetUserByName(ctx, username)
+	if err == nil {
+		return newError(http.StatusConflict, ScimTypeUniqueness, fmt.Sprintf("userName %q is already taken", username))
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// checkNotSelf makes sure callers do not deactivate their own account.
+func checkNotSelf(ctx context.Context, id string) error {
+	if claims := middleware.ClaimsFromContext(ctx); claims != nil && claims.Subject == id {
+		return newError(http.StatusBadRequest, ScimTypeMutability, "deactivating your own account is not allowed")
+	}
+
+	return nil
+}
+
+func validatePatchRequest(patch PatchRequest) error {
+	if len(patch.Schemas) > 0 && !isSchema(MessagePatchOp, patch.Schemas) {
+		return newError(http.StatusBadRequest, ScimTypeInvalidSyntax, fmt.Sprintf("expected schema %q", MessagePatchOp))
+	}
+
+	if len(patch.Operations) == 0 {
+		return newError(http.StatusBadRequest, ScimTypeInvalidSyntax, "no operations specified")
+	}
+
+	return nil
+}
+
+// primaryIndex returns the index of the primary value or 0 if no value is
+// marked as primary.
+func primaryIndex(values []MultiValue) int {
+	for idx, v := range values {
+		if v.Primary {
+			return idx
+		}
+	}
+
+	return 0
+}
+
+// uniqueValues returns all non-empty values with duplicates removed. Values
+// are compared case-insensitively.
+func uniqueValues(values []MultiValue) []MultiValue {
+	var result []MultiValue
+
+L:
+	for _, v := range values {
+		if v.Value == "" {
+			continue
+		}
+
+		for _, existing := range result {
+			if strings.EqualFold(existing.Value, v.Value) {
+				continue L
+			}
+		}
+
+		result = append(result, v)
+	}
+
+	return result
+}
+
+func syncEmails(ctx context.Context, tx *repo.Queries, userID string, values []MultiValue) error {
+	values = uniqueValues(values)
+
+	existing, err := tx.GetEmailsForUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user emails: %w", err)
+	}
+
+	ids := make([]string, len(values))
+
+L:
+	for _, mail := range existing {
+		for idx, v := range values {
+			if strings.EqualFold(v.Value, mail.Address) {
+				ids[idx] = mail.ID
+				continue L
+			}
+		}
+
+		if _, err := tx.DeleteEMailFromUser(ctx, repo.DeleteEMailFromUserParams{ID: mail.ID, UserID: userID}); err != nil {
+			return fmt.Errorf("failed to delete email %q: %w", mail.Address, err)
+		}
+	}
+
+	for idx, v := range values {
+		if ids[idx] != "" {
+			continue
+		}
+
+		if owner, err := tx.GetUserByEMail(ctx, v.Value); err == nil {
+			if owner.User.ID != userID {
+				return newError(http.StatusConflict, ScimTypeUniqueness, fmt.Sprintf("email %q is already in use", v.Value))
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+
+		// addresses provisioned by an external system are considered
+		// verified, the same as when created by an administrator.
+		if _, err := tx.CreateEMail(ctx, repo.CreateEMailParams{
+			ID:       id.String(),
+			UserID:   userID,
+			Address:  v.Value,
+			Verified: true,
+		}); err != nil {
+			return fmt.Errorf("failed to create email %q: %w", v.Value, err)
+		}
+
+		ids[idx] = id.String()
+	}
+
+	if len(values) > 0 {
+		if _, err := tx.MarkEmailAsPrimary(ctx, repo.MarkEmailAsPrimaryParams{ID: ids[primaryIndex(values)], UserID: userID}); err != nil {
+			return fmt.Errorf("failed to mark primary email: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func syncPhoneNumbers(ctx context.Context, tx *repo.Queries, userID string, values []MultiValue) error {
+	values = uniqueValues(values)
+
+	existing, err := tx.GetPhoneNumbersByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user phone numbers: %w", err)
+	}
+
+	ids := make([]string, len(values))
+
+L:
+	for _, phone := range existing {
+		for idx, v := range values {
+			if v.Value == phone.PhoneNumber {
+				ids[idx] = phone.ID
+				continue L
+			}
+		}
+
+		if _, err := tx.DeleteUserPhoneNumber(ctx, repo.DeleteUserPhoneNumberParams{ID: phone.ID, UserID: userID}); err != nil {
+			return fmt.Errorf("failed to delete phone number %q: %w", phone.PhoneNumber, err)
+		}
+	}
+
+	for idx, v := range values {
+		if ids[idx] != "" {
+			continue
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateUserPhoneNumber(ctx, repo.CreateUserPhoneNumberParams{
+			ID:          id.String(),
+			UserID:      userID,
+			PhoneNumber: v.Value,
+			Verified:    true,
+		}); err != nil {
+			return fmt.Errorf("failed to create phone number %q: %w", v.Value, err)
+		}
+
+		ids[idx] = id.String()
+	}
+
+	if len(values) > 0 {
+		if _, err := tx.MarkPhoneNumberAsPrimary(ctx, repo.MarkPhoneNumberAsPrimaryParams{ID: ids[primaryIndex(values)], UserID: userID}); err != nil {
+			return fmt.Errorf("failed to mark primary phone number: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func syncAddresses(ctx context.Context, tx *repo.Queries, userID string, values []Address) error {
+	existing, err := tx.GetUserAddresses(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user addresses: %w", err)
+	}
+
+	keep := make([]bool, len(values))
+
+L:
+	for _, addr := range existing {
+		for idx, v := range values {
+			if !keep[idx] && v.StreetAddress == addr.Street && v.Locality == addr.CityName && v.PostalCode == addr.CityCode {
+				keep[idx] = true
+				continue L
+			}
+		}
+
+		if _, err := tx.DeleteUserAddress(ctx, repo.DeleteUserAddressParams{ID: addr.ID, UserID: userID}); err != nil {
+			return fmt.Errorf("failed to delete address: %w", err)
+		}
+	}
+
+	for idx, v := range values {
+		if keep[idx] {
+			continue
+		}
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateUserAddress(ctx, repo.CreateUserAddressParams{
+			ID:       id.String(),
+			UserID:   userID,
+			Street:   v.StreetAddress,
+			CityName: v.Locality,
+			CityCode: v.PostalCode,
+		}); err != nil {
+			return fmt.Errorf("failed to create address: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setExternalID stores the external ID of a resource. An empty externalID
+// removes the mapping.
+func setExternalID(ctx context.Context, tx *repo.Queries, resourceType, resourceID, externalID string) error {
+	if externalID == "" {
+		return tx.DeleteSCIMExternalID(ctx, repo.DeleteSCIMExternalIDParams{
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+		})
+	}
+
+	mappings, err := tx.GetSCIMExternalIDs(ctx, resourceType)
+	if err != nil {
+		return fmt.Errorf("failed to get external ids: %w", err)
+	}
+
+	for _, m := range mappings {
+		if m.ExternalID == externalID && m.ResourceID != resourceID {
+			return newError(http.StatusConflict, ScimTypeUniqueness, fmt.Sprintf("externalId %q is already in use", externalID))
+		}
+	}
+
+	return tx.SetSCIMExternalID(ctx, repo.SetSCIMExternalIDParams{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ExternalID:   externalID,
+	})
+}
@@ -0,0 +1,70 @@
+package scim
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func Test_userQuery(t *testing.T) {
+	cases := []struct {
+		filter string
+		query  repo.ListUsersPageParams
+		exact  bool
+	}{
+		{
+			filter: `userName eq "Alice"`,
+			query:  repo.ListUsersPageParams{Username: "Alice", UsernameMatch: repo.MatchEquals},
+			exact:  true,
+		},
+		{
+			filter: `displayName co "smith" and active eq true`,
+			query:  repo.ListUsersPageParams{DisplayName: "smith", DisplayNameMatch: repo.MatchContains, Deleted: sql.NullBool{Valid: true}},
+			exact:  true,
+		},
+		{
+			filter: `emails[value sw "alice@"] and externalId eq "ext-1"`,
+			query:  repo.ListUsersPageParams{Email: "alice@", EmailMatch: repo.MatchPrefix, ExternalID: "ext-1"},
+			exact:  true,
+		},
+		{
+			filter: `emails.value ew "@example.com"`,
+			query:  repo.ListUsersPageParams{Email: "@example.com", EmailMatch: repo.MatchSuffix},
+			exact:  true,
+		},
+		{
+			// the name is not stored in a single column so only the
+			// userName narrows down the candidates.
+			filter: `userName sw "a" and name.givenName eq "Alice"`,
+			query:  repo.ListUsersPageParams{Username: "a", UsernameMatch: repo.MatchPrefix},
+			exact:  false,
+		},
+		{
+			filter: `userName eq "alice" or userName eq "bob"`,
+			exact:  false,
+		},
+		{
+			filter: `not (active eq false)`,
+			exact:  false,
+		},
+		{
+			filter: `userName co "a" and userName co "b"`,
+			query:  repo.ListUsersPageParams{Username: "a", UsernameMatch: repo.MatchContains},
+			exact:  false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.filter, func(t *testing.T) {
+			filter, err := ParseFilter(c.filter, userSchemas)
+			require.NoError(t, err)
+
+			query, exact := userQuery(filter)
+			assert.Equal(t, c.query, query)
+			assert.Equal(t, c.exact, exact)
+		})
+	}
+}
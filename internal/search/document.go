@@ -0,0 +1,150 @@
+package search
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// maxTerms limits the number of terms of a search query.
+const maxTerms = 8
+
+// Terms splits query into lower-case search terms consisting only of
+// letters and digits.
+func Terms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), isSeparator)
+	if len(terms) > maxTerms {
+		terms = terms[:maxTerms]
+	}
+
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// splitWords replaces all separators in s with spaces.
+func splitWords(s string) string {
+	return strings.Join(strings.FieldsFunc(s, isSeparator), " ")
+}
+
+// Document returns the search document for usr. Extra data fields are only
+// included if they are marked as searchable in fields and are sorted by their
+// visibility. Fields that only the user itself and user managers may read,
+// like the first and last name and e-mail addresses and phone numbers other
+// than the primary ones, are kept separate as well.
+func Document(usr repo.User, emails []repo.UserEmail, phones []repo.UserPhoneNumber, fields []*config.FieldConfig) repo.UpsertUserSearchDocumentParams {
+	doc := repo.UpsertUserSearchDocumentParams{
+		UserID:   usr.ID,
+		Username: usr.Username,
+		Names:    usr.DisplayName,
+	}
+
+	restricted := []string{usr.FirstName, usr.LastName}
+
+	// e-mail addresses and phone numbers are also indexed with separators
+	// removed so parts of them can be found regardless of how the database
+	// tokenizes them.
+	var values []string
+	for _, mail := range emails {
+		text := []string{mail.Address, splitWords(mail.Address)}
+
+		if mail.IsPrimary {
+			values = append(values, text...)
+		} else {
+			restricted = append(restricted, text...)
+		}
+	}
+	doc.Emails = join(values...)
+
+	values = nil
+	for _, phone := range phones {
+		text := []string{phone.PhoneNumber, strings.Join(strings.FieldsFunc(phone.PhoneNumber, func(r rune) bool {
+			return !unicode.IsDigit(r)
+		}), "")}
+
+		if phone.IsPrimary {
+			values = append(values, text...)
+		} else {
+			restricted = append(restricted, text...)
+		}
+	}
+	doc.Phones = join(values...)
+	doc.Restricted = join(restricted...)
+
+	if usr.Extra != "" {
+		var extra map[string]any
+		if err := json.Unmarshal([]byte(usr.Extra), &extra); err == nil {
+			buckets := make(map[string][]string)
+			collectExtra(fields, extra, buckets)
+
+			doc.ExtraPublic = join(buckets[config.FieldVisibilityPublic]...)
+			doc.ExtraAuthenticated = join(buckets[config.FieldVisibilityAuthenticated]...)
+			doc.ExtraPrivate = join(append(buckets[config.FieldVisibilitySelf], buckets[config.FieldVisibilityPrivate]...)...)
+		}
+	}
+
+	doc.Username = strings.ToLower(doc.Username)
+	doc.Names = strings.ToLower(doc.Names)
+	doc.Emails = strings.ToLower(doc.Emails)
+	doc.Restricted = strings.ToLower(doc.Restricted)
+	doc.ExtraPublic = strings.ToLower(doc.ExtraPublic)
+	doc.ExtraAuthenticated = strings.ToLower(doc.ExtraAuthenticated)
+	doc.ExtraPrivate = strings.ToLower(doc.ExtraPrivate)
+
+	return doc
+}
+
+// collectExtra adds the text of all searchable fields in values to buckets
+// indexed by the field visibility.
+func collectExtra(fields []*config.FieldConfig, values map[string]any, buckets map[string][]string) {
+	for _, fc := range fields {
+		value, ok := values[fc.Name]
+		if !ok {
+			continue
+		}
+
+		if fc.Type == config.FieldTypeObject {
+			if obj, ok := value.(map[string]any); ok {
+				collectExtra(fc.Properties, obj, buckets)
+			}
+
+			continue
+		}
+
+		if fc.Searchable {
+			buckets[fc.Visibility] = appendText(buckets[fc.Visibility], value)
+		}
+	}
+}
+
+func appendText(text []string, value any) []string {
+	switch v := value.(type) {
+	case string:
+		return append(text, v)
+	case float64:
+		return append(text, strconv.FormatFloat(v, 'f', -1, 64))
+	case []any:
+		for _, elem := range v {
+			text = appendText(text, elem)
+		}
+	}
+
+	return text
+}
+
+func join(values ...string) string {
+	var nonEmpty []string
+	for _, v := range values {
+		if v != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+
+	return strings.Join(nonEmpty, " ")
+}
@@ -0,0 +1,279 @@
+// Package search implements the full-text user directory search.
+//
+// Each active user is represented by a search document that holds the
+// username, names, e-mail addresses, phone numbers and all extra data
+// fields marked as searchable. Documents are rebuilt on startup and kept
+// up to date by following the change feed so mutations made by other
+// replicas are picked up as well.
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// pollInterval defines how often the change feed is checked for events
+	// published by other replicas.
+	pollInterval = 30 * time.Second
+	batchSize    = 500
+)
+
+// Indexer maintains the search documents of all users and searches them.
+type Indexer struct {
+	datastore *repo.Queries
+	feed      *changes.Feed
+	fields    []*config.FieldConfig
+	index     *repo.SearchIndex
+}
+
+// New returns a new indexer for the users stored in db.
+func New(ctx context.Context, db *sql.DB, ds *repo.Queries, feed *changes.Feed, cfg config.Config) (*Indexer, error) {
+	index, err := repo.OpenSearchIndex(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if !index.FullText() {
+		log.L(ctx).Warn("SQLite has been built without FTS5 support, user search falls back to pattern matching")
+	}
+
+	return &Indexer{
+		datastore: ds,
+		feed:      feed,
+		fields:    cfg.ExtraDataConfig,
+		index:     index,
+	}, nil
+}
+
+// Run rebuilds all search documents and keeps them up to date until ctx is
+// cancelled.
+func (idx *Indexer) Run(ctx context.Context) {
+	if idx == nil {
+		return
+	}
+
+	notify, unsubscribe := idx.feed.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	cursor, err := idx.Rebuild(ctx)
+	if err != nil {
+		log.L(ctx).Error("failed to build user search index", "error", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notify:
+		}
+
+		cursor, err = idx.sync(ctx, cursor)
+		if err != nil {
+			log.L(ctx).Error("failed to update user search index", "error", err)
+		}
+	}
+}
+
+// Rebuild updates the search documents of all users and removes documents of
+// users that have been deleted. It returns the change feed cursor that
+// incremental updates should continue at.
+func (idx *Indexer) Rebuild(ctx context.Context) (int64, error) {
+	// changes that happen while the index is rebuilt are replayed by the
+	// next incremental update.
+	seqRange, err := idx.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query change feed: %w", err)
+	}
+
+	users, err := idx.datastore.GetAllUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	for len(users) > 0 {
+		n := min(batchSize, len(users))
+
+		if err := idx.write(ctx, users[:n]); err != nil {
+			return 0, err
+		}
+
+		users = users[n:]
+	}
+
+	if _, err := idx.datastore.DeleteStaleUserSearchDocuments(ctx); err != nil {
+		return 0, fmt.Errorf("failed to delete stale search documents: %w", err)
+	}
+
+	return seqRange.MaxSeq, nil
+}
+
+// Reindex updates the search documents of the users with the given IDs.
+func (idx *Indexer) Reindex(ctx context.Context, userIDs ...string) error {
+	if idx == nil || len(userIDs) == 0 {
+		return nil
+	}
+
+	users, err := idx.datastore.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get users: %w", err)
+	}
+
+	found := make(map[string]struct{}, len(users))
+	for _, usr := range users {
+		found[usr.ID] = struct{}{}
+	}
+
+	for _, id := range userIDs {
+		if _, ok := found[id]; ok {
+			continue
+		}
+
+		if err := idx.datastore.DeleteUserSearchDocument(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete search document: %w", err)
+		}
+	}
+
+	return idx.write(ctx, users)
+}
+
+// Search returns the IDs of at most limit active users matching query, best
+// matches first. If includeRestricted is set, fields of the profile that are
+// only visible to the user itself and user managers are searched as well. If
+// includePrivate is set, this also applies to extra data fields that are only
+// visible to the user itself or administrators.
+func (idx *Indexer) Search(ctx context.Context, query string, includeRestricted, includePrivate bool, limit int) ([]string, error) {
+	if idx == nil {
+		return nil, fmt.Errorf("user search is not available")
+	}
+
+	return idx.index.SearchUsers(ctx, repo.SearchUsersParams{
+		Terms:             Terms(query),
+		IncludeRestricted: includeRestricted,
+		IncludePrivate:    includePrivate,
+		Limit:             int64(limit),
+	})
+}
+
+// write stores the search documents of users in a single transaction.
+// Deleted users are removed from the index.
+func (idx *Indexer) write(ctx context.Context, users []repo.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(users))
+	for i, usr := range users {
+		ids[i] = usr.ID
+	}
+
+	emails, err := idx.datastore.GetEmailsForUsers(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get e-mail addresses: %w", err)
+	}
+
+	phones, err := idx.datastore.GetPhoneNumbersForUsers(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get phone numbers: %w", err)
+	}
+
+	emailsByUser := make(map[string][]repo.UserEmail)
+	for _, mail := range emails {
+		emailsByUser[mail.UserID] = append(emailsByUser[mail.UserID], mail)
+	}
+
+	phonesByUser := make(map[string][]repo.UserPhoneNumber)
+	for _, phone := range phones {
+		phonesByUser[phone.UserID] = append(phonesByUser[phone.UserID], phone)
+	}
+
+	_, err = repo.RunInTransaction(ctx, idx.datastore, func(tx *repo.Queries) (any, error) {
+		for _, usr := range users {
+			if usr.Deleted {
+				if err := tx.DeleteUserSearchDocument(ctx, usr.ID); err != nil {
+					return nil, fmt.Errorf("failed to delete search document: %w", err)
+				}
+
+				continue
+			}
+
+			if err := tx.UpsertUserSearchDocument(ctx, Document(usr, emailsByUser[usr.ID], phonesByUser[usr.ID], idx.fields)); err != nil {
+				return nil, fmt.Errorf("failed to update search document: %w", err)
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// sync updates the documents of all users affected by changes after cursor.
+// If the cursor has expired, the whole index is rebuilt.
+func (idx *Indexer) sync(ctx context.Context, cursor int64) (int64, error) {
+	seqRange, err := idx.datastore.GetChangeEventSeqRange(ctx)
+	if err != nil {
+		return cursor, fmt.Errorf("failed to query change feed: %w", err)
+	}
+
+	if seqRange.MinSeq > 0 && cursor < seqRange.MinSeq-1 {
+		log.L(ctx).Warn("change feed cursor expired, rebuilding user search index")
+
+		return idx.Rebuild(ctx)
+	}
+
+	for {
+		events, err := idx.datastore.ListChangeEventsAfter(ctx, repo.ListChangeEventsAfterParams{
+			Seq:   cursor,
+			Limit: batchSize,
+		})
+		if err != nil {
+			return cursor, fmt.Errorf("failed to query change feed: %w", err)
+		}
+
+		var (
+			userIDs []string
+			seen    = make(map[string]struct{})
+		)
+
+		for _, e := range events {
+			if e.UserID == "" {
+				continue
+			}
+
+			switch changes.Type(e.Type) {
+			case changes.UserCreated, changes.UserUpdated, changes.UserDeleted, changes.ProfileChanged:
+			default:
+				continue
+			}
+
+			if _, ok := seen[e.UserID]; !ok {
+				seen[e.UserID] = struct{}{}
+				userIDs = append(userIDs, e.UserID)
+			}
+		}
+
+		if err := idx.Reindex(ctx, userIDs...); err != nil {
+			return cursor, err
+		}
+
+		if len(events) > 0 {
+			cursor = events[len(events)-1].Seq
+		}
+
+		if len(events) < batchSize {
+			return cursor, nil
+		}
+	}
+}
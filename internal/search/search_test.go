@@ -0,0 +1,129 @@
+package search_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/search"
+)
+
+var fields = []*config.FieldConfig{
+	{Name: "extension", Type: config.FieldTypeString, Visibility: config.FieldVisibilityAuthenticated, Searchable: true},
+	{Name: "note", Type: config.FieldTypeString, Visibility: config.FieldVisibilityPrivate, Searchable: true},
+	{Name: "secret", Type: config.FieldTypeString, Visibility: config.FieldVisibilityPublic},
+	{Name: "office", Type: config.FieldTypeObject, Visibility: config.FieldVisibilityPublic, Properties: []*config.FieldConfig{
+		{Name: "rooms", Type: config.FieldTypeList, Visibility: config.FieldVisibilityPublic, Searchable: true},
+	}},
+}
+
+func Test_Terms(t *testing.T) {
+	assert.Equal(t, []string{"alice", "example", "com", "42"}, search.Terms(`  Alice@Example.com "42"`))
+	assert.Empty(t, search.Terms("*-*"))
+	assert.Len(t, search.Terms("a b c d e f g h i j"), 8)
+}
+
+func Test_Document(t *testing.T) {
+	doc := search.Document(
+		repo.User{
+			ID:          "1",
+			Username:    "Alice",
+			DisplayName: "Alice Smith",
+			FirstName:   "Alice",
+			LastName:    "Smith-Jones",
+			Extra:       `{"extension":"4711","note":"On Leave","secret":"hidden","office":{"rooms":["A1",2]}}`,
+		},
+		[]repo.UserEmail{{Address: "alice.smith@example.com", IsPrimary: true}, {Address: "alice@home.org"}},
+		[]repo.UserPhoneNumber{{PhoneNumber: "+43 (1) 234", IsPrimary: true}, {PhoneNumber: "0664 99"}},
+		fields,
+	)
+
+	assert.Equal(t, repo.UpsertUserSearchDocumentParams{
+		UserID:             "1",
+		Username:           "alice",
+		Names:              "alice smith",
+		Emails:             "alice.smith@example.com alice smith example com",
+		Phones:             "+43 (1) 234 431234",
+		Restricted:         "alice smith-jones alice@home.org alice home org 0664 99 066499",
+		ExtraPublic:        "a1 2",
+		ExtraAuthenticated: "4711",
+		ExtraPrivate:       "on leave",
+	}, doc)
+}
+
+func Test_Indexer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+	feed := changes.NewFeed(ds, time.Hour)
+
+	for _, u := range []repo.CreateUserParams{
+		{ID: "1", Username: "alice", DisplayName: "Alice Smith", LastName: "Jones", Extra: `{"extension":"4711","note":"vacation"}`},
+		{ID: "2", Username: "bob", DisplayName: "Bob Smithers"},
+		{ID: "3", Username: "smith", DisplayName: "Carol"},
+		{ID: "4", Username: "dave", DisplayName: "Dave Smith"},
+	} {
+		_, err := ds.CreateUser(ctx, u)
+		require.NoError(t, err)
+	}
+
+	_, err = ds.DeleteUser(ctx, "4")
+	require.NoError(t, err)
+
+	idx, err := search.New(ctx, db, ds, feed, config.Config{ExtraDataConfig: fields})
+	require.NoError(t, err)
+
+	go idx.Run(ctx)
+
+	find := func(query string, includeRestricted, includePrivate bool) []string {
+		ids, err := idx.Search(ctx, query, includeRestricted, includePrivate, 10)
+		require.NoError(t, err)
+
+		return ids
+	}
+
+	require.Eventually(t, func() bool {
+		return len(find("smith", false, false)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// usernames are ranked before names
+	assert.Equal(t, "3", find("smith", false, false)[0])
+	assert.Equal(t, []string{"1"}, find("ali smi", false, false))
+	assert.Equal(t, []string{"1"}, find("4711", false, false))
+	assert.Empty(t, find("vacation", false, false))
+	assert.Equal(t, []string{"1"}, find("vacation", true, true))
+	assert.Empty(t, find("dave", true, true))
+
+	// the last name is only visible to user managers
+	assert.Empty(t, find("jones", false, false))
+	assert.Equal(t, []string{"1"}, find("jones", true, false))
+
+	// changes published to the feed are picked up
+	_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "m1", UserID: "2", Address: "bob@vet-clinic.at", IsPrimary: true})
+	require.NoError(t, err)
+	feed.Publish(ctx, changes.ProfileChanged, "2", "", nil)
+
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"2"}, find("clinic", false, false))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = ds.DeleteUser(ctx, "1")
+	require.NoError(t, err)
+	require.NoError(t, idx.Reindex(ctx, "1"))
+
+	assert.Empty(t, find("alice", true, true))
+}
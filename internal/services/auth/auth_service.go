@@ -19,6 +19,7 @@ import (
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
@@ -27,6 +28,7 @@ import (
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/tmpl"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/exp/slices"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -100,6 +102,10 @@ func (svc *AuthService) Login(ctx context.Context, req *connect.Request[idmv1.Lo
 			}
 		}
 
+		// record failed attempts as well so they are part of the users
+		// login history.
+		audit.SetTarget(ctx, audit.TargetUser, user.ID)
+
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(passwordAuth.GetPassword())); err != nil {
 			if err != nil {
 				return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("incorrect password"))
@@ -175,11 +181,13 @@ func (svc *AuthService) Login(ctx context.Context, req *connect.Request[idmv1.Lo
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unsupported authentication method"))
 	}
 
+	audit.SetTarget(ctx, audit.TargetUser, user.ID)
+
 	if user.Deleted {
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user deleted"))
 	}
 
-	roles, err := svc.Datastore.GetRolesForUser(ctx, user.ID)
+	roles, err := svc.Datastore.GetEffectiveRolesForUser(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -218,7 +226,7 @@ func (svc *AuthService) Login(ctx context.Context, req *connect.Request[idmv1.Lo
 		}
 	}
 
-	if token, _, err := svc.AddAccessToken(user, roles, req.Msg.Ttl.AsDuration(), refreshTokenID, kind, resp.Header()); err != nil {
+	if token, _, err := svc.AddAccessToken(ctx, user, roles, req.Msg.Ttl.AsDuration(), refreshTokenID, kind, resp.Header()); err != nil {
 		return nil, err
 	} else {
 		response.Token = token
@@ -292,7 +300,7 @@ func (svc *AuthService) RefreshToken(ctx context.Context, req *connect.Request[i
 		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("your user profile has been deleted"))
 	}
 
-	roles, err := svc.Datastore.GetRolesForUser(ctx, claims.Subject)
+	roles, err := svc.Datastore.GetEffectiveRolesForUser(ctx, claims.Subject)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get role assignments: %w", err)
 	}
@@ -316,7 +324,7 @@ func (svc *AuthService) RefreshToken(ctx context.Context, req *connect.Request[i
 		kind = claims.AppMetadata.LoginKind
 	}
 
-	token, _, err := svc.AddAccessToken(user, roles, req.Msg.Ttl.AsDuration(), claims.ID, kind, resp.Header())
+	token, _, err := svc.AddAccessToken(ctx, user, roles, req.Msg.Ttl.AsDuration(), claims.ID, kind, resp.Header())
 	if err != nil {
 		return nil, err
 	}
@@ -489,7 +497,10 @@ func (svc *AuthService) RegisterUser(ctx context.Context, req *connect.Request[i
 		return nil, err
 	}
 
-	roles, err := svc.Datastore.GetRolesForUser(ctx, userModel.ID)
+	svc.EmitUserEvent(ctx, webhook.UserCreated, *userModel)
+	svc.PublishUserCreated(ctx, *userModel)
+
+	roles, err := svc.Datastore.GetEffectiveRolesForUser(ctx, userModel.ID)
 	if err != nil {
 		log.L(ctx).With("error", err).Error("failed to get user role assignments")
 	}
@@ -507,7 +518,7 @@ func (svc *AuthService) RegisterUser(ctx context.Context, req *connect.Request[i
 		return nil, err
 	}
 
-	token, _, err := svc.AddAccessToken(*userModel, roles, 0, refreshTokenID, "password", resp.Header())
+	token, _, err := svc.AddAccessToken(ctx, *userModel, roles, 0, refreshTokenID, "password", resp.Header())
 	if err != nil {
 		return nil, err
 	}
@@ -589,17 +600,21 @@ func (svc *AuthService) CreateUser(ctx context.Context, tx *sql.Tx, params repo.
 	// remove any duplicates
 	initialRoles = slices.Compact(initialRoles)
 
-	merr := new(multierror.Error)
-	for _, role := range initialRoles {
-		if err := db.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{
-			UserID: userModel.ID,
-			RoleID: role,
-		}); err != nil {
-			merr.Errors = append(merr.Errors, fmt.Errorf("failed to assign role %s: %w", role, err))
+	// initial roles of registration tokens must not violate any
+	// separation-of-duties constraints.
+	if err := svc.Constraints.Enforce(ctx, db, func() error {
+		merr := new(multierror.Error)
+		for _, role := range initialRoles {
+			if err := db.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{
+				UserID: userModel.ID,
+				RoleID: role,
+			}); err != nil {
+				merr.Errors = append(merr.Errors, fmt.Errorf("failed to assign role %s: %w", role, err))
+			}
 		}
-	}
 
-	if err := merr.ErrorOrNil(); err != nil {
+		return merr.ErrorOrNil()
+	}); err != nil {
 		return &userModel, err
 	}
 
@@ -685,6 +700,12 @@ func (svc *AuthService) RequestPasswordReset(ctx context.Context, req *connect.R
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
 		}
 
+		audit.SetTarget(ctx, audit.TargetUser, user.ID)
+
+		svc.Webhooks.Emit(ctx, webhook.PasswordChanged, webhook.PasswordChangedData{
+			UserID: user.ID,
+		})
+
 	default:
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request"))
 	}
@@ -710,6 +731,8 @@ func (svc *AuthService) invalidateTokens(ctx context.Context, claims *jwt.Claims
 		return fmt.Errorf("failed to mark token as rejected: %w", err)
 	}
 
+	svc.AuthCache.RejectToken(claims.ID)
+
 	// also mark the parent (refresh) token as rejected
 	if claims.AppMetadata != nil && claims.AppMetadata.ParentTokenID != "" {
 		if err := common.Timing(ctx, "reject-refresh-token", func() error {
@@ -725,6 +748,8 @@ func (svc *AuthService) invalidateTokens(ctx context.Context, claims *jwt.Claims
 		}); err != nil {
 			return fmt.Errorf("failed to mark token as rejected: %w", err)
 		}
+
+		svc.AuthCache.RejectToken(claims.AppMetadata.ParentTokenID)
 	}
 
 	return nil
@@ -14,7 +14,6 @@ import (
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
-	"github.com/tierklinik-dobersberg/cis-idm/internal/policy"
 )
 
 func NewForwardAuthHandler(providers *app.Providers) http.Handler {
@@ -79,7 +78,7 @@ func NewForwardAuthHandler(providers *app.Providers) http.Handler {
 		reqCopy.Host = u.Host
 
 		// try to authenticate the request.
-		claims, authErr := middleware.AuthenticateRequest(providers.Config, providers.Datastore, reqCopy)
+		claims, authErr := middleware.AuthenticateRequest(providers.Config, providers.Datastore, providers.AuthCache, reqCopy)
 
 		// prepare the input for the rego policy query
 		input := ForwardAuthInput{
@@ -98,7 +97,7 @@ func NewForwardAuthHandler(providers *app.Providers) http.Handler {
 				kind = claims.AppMetadata.LoginKind
 			}
 
-			input.Subject, err = policy.NewSubjectInput(ctx, providers.Datastore, providers.Config.PermissionTree(), claims.Subject, kind, claims.ID)
+			input.Subject, err = providers.AuthCache.Subject(ctx, claims.Subject, kind, claims.ID)
 			if err != nil {
 				l.Error("failed to resolve subject input", "error", err)
 
@@ -188,7 +187,7 @@ func NewForwardAuthHandler(providers *app.Providers) http.Handler {
 
 		if result.AssignSubject != "" {
 			l.Info("loading subject overwrite")
-			input.Subject, err = policy.NewSubjectInput(ctx, providers.Datastore, providers.Config.PermissionTree(), result.AssignSubject, "", "")
+			input.Subject, err = providers.AuthCache.Subject(ctx, result.AssignSubject, "", "")
 			if err != nil {
 				l.Error("failed to overwrite request subject", "error", err)
 				handleRedirect(w, r, "", "")
@@ -230,6 +229,12 @@ func NewForwardAuthHandler(providers *app.Providers) http.Handler {
 				}
 			}
 
+			if h := fwCfg.GroupHeader; *h != "" {
+				for _, g := range sub.Groups {
+					w.Header().Add(*h, g.ID)
+				}
+			}
+
 			if h := fwCfg.ResolvedPermissionHeader; *h != "" {
 				// all all permissions from all roles to the headers.
 				for _, p := range sub.Permissions {
@@ -0,0 +1,365 @@
+package groups
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/hashicorp/go-multierror"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/roles"
+)
+
+// AddGroupMembersRequest is the request message for the AddGroupMembers
+// endpoint.
+type AddGroupMembersRequest struct {
+	GroupID string   `json:"groupId"`
+	UserIDs []string `json:"userIds"`
+
+	// Owner marks the users as owners of the group. Adding an existing
+	// member updates its owner flag.
+	Owner bool `json:"owner,omitempty"`
+}
+
+// AddGroupMembersResponse is the response message for the AddGroupMembers
+// endpoint.
+type AddGroupMembersResponse struct{}
+
+// RemoveGroupMembersRequest is the request message for the
+// RemoveGroupMembers endpoint.
+type RemoveGroupMembersRequest struct {
+	GroupID string   `json:"groupId"`
+	UserIDs []string `json:"userIds"`
+}
+
+// RemoveGroupMembersResponse is the response message for the
+// RemoveGroupMembers endpoint.
+type RemoveGroupMembersResponse struct{}
+
+// GroupRoleRequest is the request message for the AssignRoleToGroup and
+// UnassignRoleFromGroup endpoints.
+type GroupRoleRequest struct {
+	GroupID string `json:"groupId"`
+	RoleID  string `json:"roleId"`
+}
+
+// GroupRoleResponse is the response message for the AssignRoleToGroup and
+// UnassignRoleFromGroup endpoints.
+type GroupRoleResponse struct{}
+
+// SubgroupRequest is the request message for the AddSubgroup and
+// RemoveSubgroup endpoints.
+type SubgroupRequest struct {
+	GroupID    string `json:"groupId"`
+	SubgroupID string `json:"subgroupId"`
+}
+
+// SubgroupResponse is the response message for the AddSubgroup and
+// RemoveSubgroup endpoints.
+type SubgroupResponse struct{}
+
+// checkCanManageMembers ensures the caller is either an idm_superuser or an
+// owner of group.
+func checkCanManageMembers(ctx context.Context, tx *repo.Queries, group repo.UserGroup) error {
+	if isSuperuser(ctx) {
+		return nil
+	}
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	member, err := tx.GetGroupMember(ctx, repo.GetGroupMemberParams{
+		GroupID: group.ID,
+		UserID:  claims.Subject,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get group member: %w", err)
+	}
+
+	if err != nil || !member.Owner {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only owners may manage the members of group %q", group.Name))
+	}
+
+	return nil
+}
+
+// checkCanGrantGroupRoles ensures the caller may grant the roles that members
+// of group receive through the group or any of its parent groups. Besides
+// administrators, this requires the permission to approve requests for each
+// of those roles so owners can not bypass the role request workflow.
+func (svc *Service) checkCanGrantGroupRoles(ctx context.Context, tx *repo.Queries, group repo.UserGroup) error {
+	if isSuperuser(ctx) {
+		return nil
+	}
+
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	granted, err := tx.GetEffectiveGroupRoles(ctx, group.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get group roles: %w", err)
+	}
+
+	approver := roles.NewService(svc.Providers)
+	for _, role := range granted {
+		ok, err := approver.CanApprove(ctx, tx, claims.Subject, role.ID)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("members of group %q receive the role %q which you may not grant", group.Name, role.Name))
+		}
+	}
+
+	return nil
+}
+
+// AddGroupMembers adds users to a group. It may be called by administrators
+// and owners of the group. If the group grants roles, owners also need to be
+// allowed to approve requests for them.
+func (svc *Service) AddGroupMembers(ctx context.Context, req *AddGroupMembersRequest) (*AddGroupMembersResponse, error) {
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		group, err := svc.getGroup(ctx, tx, req.GroupID)
+		if err != nil {
+			return group, err
+		}
+
+		if err := checkCanManageMembers(ctx, tx, group); err != nil {
+			return group, err
+		}
+
+		if err := svc.checkCanGrantGroupRoles(ctx, tx, group); err != nil {
+			return group, err
+		}
+
+		if err := svc.Constraints.Enforce(ctx, tx, func() error {
+			merr := new(multierror.Error)
+			for _, userID := range req.UserIDs {
+				user, err := tx.GetUserByID(ctx, userID)
+				if err != nil {
+					merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
+					continue
+				}
+
+				if err := tx.AddGroupMember(ctx, repo.AddGroupMemberParams{
+					GroupID: group.ID,
+					UserID:  user.ID,
+					Owner:   req.Owner,
+				}); err != nil {
+					merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
+					continue
+				}
+			}
+
+			return merr.ErrorOrNil()
+		}); err != nil {
+			return group, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+		audit.RecordChange(ctx, nil, map[string]any{"added_members": req.UserIDs, "owner": req.Owner})
+
+		return group, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range req.UserIDs {
+		svc.Changes.Publish(ctx, changes.GroupMemberAdded, userID, "", changes.GroupData{ID: group.ID, Name: group.Name})
+	}
+
+	return &AddGroupMembersResponse{}, nil
+}
+
+// RemoveGroupMembers removes users from a group. It may be called by
+// administrators and owners of the group.
+func (svc *Service) RemoveGroupMembers(ctx context.Context, req *RemoveGroupMembersRequest) (*RemoveGroupMembersResponse, error) {
+	var removed []string
+
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		group, err := svc.getGroup(ctx, tx, req.GroupID)
+		if err != nil {
+			return group, err
+		}
+
+		if err := checkCanManageMembers(ctx, tx, group); err != nil {
+			return group, err
+		}
+
+		for _, userID := range req.UserIDs {
+			count, err := tx.RemoveGroupMember(ctx, repo.RemoveGroupMemberParams{
+				GroupID: group.ID,
+				UserID:  userID,
+			})
+			if err != nil {
+				return group, fmt.Errorf("user %s: %w", userID, err)
+			}
+
+			if count > 0 {
+				removed = append(removed, userID)
+			}
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+		audit.RecordChange(ctx, map[string]any{"removed_members": removed}, nil)
+
+		return group, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range removed {
+		svc.Changes.Publish(ctx, changes.GroupMemberRemoved, userID, "", changes.GroupData{ID: group.ID, Name: group.Name})
+	}
+
+	return &RemoveGroupMembersResponse{}, nil
+}
+
+// updateGroup loads the group with groupID and calls fn within a
+// transaction. A group.updated event is published once the transaction
+// has been committed.
+func (svc *Service) updateGroup(ctx context.Context, groupID string, fn func(tx *repo.Queries, group repo.UserGroup) error) error {
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		group, err := svc.getGroup(ctx, tx, groupID)
+		if err != nil {
+			return group, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+
+		return group, fn(tx, group)
+	})
+	if err != nil {
+		return err
+	}
+
+	svc.Changes.Publish(ctx, changes.GroupUpdated, "", "", changes.GroupData{ID: group.ID, Name: group.Name})
+
+	return nil
+}
+
+// AssignRoleToGroup grants a role to all members of a group.
+func (svc *Service) AssignRoleToGroup(ctx context.Context, req *GroupRoleRequest) (*GroupRoleResponse, error) {
+	err := svc.updateGroup(ctx, req.GroupID, func(tx *repo.Queries, group repo.UserGroup) error {
+		role, err := tx.GetRoleByID(ctx, req.RoleID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return connect.NewError(connect.CodeNotFound, fmt.Errorf("role %q not found", req.RoleID))
+			}
+
+			return err
+		}
+
+		if err := svc.Constraints.Enforce(ctx, tx, func() error {
+			return tx.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{
+				GroupID: group.ID,
+				RoleID:  role.ID,
+			})
+		}); err != nil {
+			return err
+		}
+
+		audit.RecordChange(ctx, nil, map[string]any{"assigned_role": role.ID})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupRoleResponse{}, nil
+}
+
+// UnassignRoleFromGroup removes a role from a group.
+func (svc *Service) UnassignRoleFromGroup(ctx context.Context, req *GroupRoleRequest) (*GroupRoleResponse, error) {
+	err := svc.updateGroup(ctx, req.GroupID, func(tx *repo.Queries, group repo.UserGroup) error {
+		count, err := tx.UnassignRoleFromGroup(ctx, repo.UnassignRoleFromGroupParams{
+			GroupID: group.ID,
+			RoleID:  req.RoleID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("role %q is not assigned to group %q", req.RoleID, group.Name))
+		}
+
+		audit.RecordChange(ctx, map[string]any{"assigned_role": req.RoleID}, nil)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupRoleResponse{}, nil
+}
+
+// AddSubgroup nests a group within another one. Members of the subgroup
+// become members of the parent group as well.
+func (svc *Service) AddSubgroup(ctx context.Context, req *SubgroupRequest) (*SubgroupResponse, error) {
+	err := svc.updateGroup(ctx, req.GroupID, func(tx *repo.Queries, group repo.UserGroup) error {
+		subgroup, err := svc.getGroup(ctx, tx, req.SubgroupID)
+		if err != nil {
+			return err
+		}
+
+		if err := svc.Constraints.Enforce(ctx, tx, func() error {
+			return tx.NestGroup(ctx, group.ID, subgroup.ID)
+		}); err != nil {
+			if errors.Is(err, repo.ErrGroupNestingCycle) {
+				return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("group %q already contains group %q", subgroup.Name, group.Name))
+			}
+
+			return err
+		}
+
+		audit.RecordChange(ctx, nil, map[string]any{"subgroup": subgroup.ID})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubgroupResponse{}, nil
+}
+
+// RemoveSubgroup removes a group from the subgroups of another one.
+func (svc *Service) RemoveSubgroup(ctx context.Context, req *SubgroupRequest) (*SubgroupResponse, error) {
+	err := svc.updateGroup(ctx, req.GroupID, func(tx *repo.Queries, group repo.UserGroup) error {
+		count, err := tx.RemoveSubgroup(ctx, repo.RemoveSubgroupParams{
+			GroupID:    group.ID,
+			SubgroupID: req.SubgroupID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("group %q is not a subgroup of %q", req.SubgroupID, group.Name))
+		}
+
+		audit.RecordChange(ctx, map[string]any{"subgroup": req.SubgroupID}, nil)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubgroupResponse{}, nil
+}
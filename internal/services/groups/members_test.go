@@ -0,0 +1,97 @@
+package groups_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/groups"
+)
+
+func asUser(id string, roles ...string) context.Context {
+	return middleware.ContextWithClaims(context.Background(), &jwt.Claims{
+		Subject: id,
+		AppMetadata: &jwt.AppMetadata{
+			Authorization: &jwt.Authorization{Roles: roles},
+		},
+	})
+}
+
+func Test_AddGroupMembers_GrantedRoles(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	for _, id := range []string{"alice", "bob", "carol"} {
+		_, err := ds.CreateUser(ctx, repo.CreateUserParams{ID: id, Username: id})
+		require.NoError(t, err)
+	}
+
+	for _, id := range []string{"idm_superuser", "vet", "vet-lead"} {
+		_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: id, Name: id})
+		require.NoError(t, err)
+	}
+
+	for _, id := range []string{"admins", "night-shift", "vets"} {
+		_, err := ds.CreateGroup(ctx, repo.CreateGroupParams{ID: id, Name: id, Metadata: "{}"})
+		require.NoError(t, err)
+
+		// alice owns all groups
+		require.NoError(t, ds.AddGroupMember(ctx, repo.AddGroupMemberParams{GroupID: id, UserID: "alice", Owner: true}))
+	}
+
+	// members of night-shift are members of admins as well
+	require.NoError(t, ds.NestGroup(ctx, "admins", "night-shift"))
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "admins", RoleID: "idm_superuser"}))
+	require.NoError(t, ds.AssignRoleToGroup(ctx, repo.AssignRoleToGroupParams{GroupID: "vets", RoleID: "vet"}))
+
+	// alice may approve requests for the vet role
+	require.NoError(t, ds.AssignPermissionToRole(ctx, repo.AssignPermissionToRoleParams{RoleID: "vet-lead", Permission: "idm:roles:approve:vet"}))
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "vet-lead"}))
+
+	svc := groups.NewService(&app.Providers{Datastore: ds})
+
+	add := func(ctx context.Context, groupID string, owner bool) error {
+		_, err := svc.AddGroupMembers(ctx, &groups.AddGroupMembersRequest{GroupID: groupID, UserIDs: []string{"bob"}, Owner: owner})
+
+		return err
+	}
+
+	isMember := func(groupID string) bool {
+		_, err := ds.GetGroupMember(ctx, repo.GetGroupMemberParams{GroupID: groupID, UserID: "bob"})
+
+		return err == nil
+	}
+
+	// owners can not grant idm_superuser, neither directly nor through a
+	// subgroup
+	err = add(asUser("alice"), "admins", false)
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+	assert.False(t, isMember("admins"))
+
+	err = add(asUser("alice"), "night-shift", true)
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+	assert.False(t, isMember("night-shift"))
+
+	// but roles they may approve
+	require.NoError(t, add(asUser("alice"), "vets", false))
+	assert.True(t, isMember("vets"))
+
+	// superusers may grant everything
+	require.NoError(t, add(asUser("carol", "idm_superuser"), "admins", false))
+	assert.True(t, isMember("admins"))
+}
@@ -0,0 +1,485 @@
+// Package groups implements the GroupService which manages groups of users.
+//
+// Groups have members, some of which may be owners, arbitrary metadata and
+// may be nested: members of a subgroup are members of all parent groups as
+// well. Roles assigned to a group are granted to all of its members.
+package groups
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// ServiceName is the name of the group service.
+	ServiceName = "cisidm.v1.GroupService"
+
+	ListGroupsProcedure            = "/" + ServiceName + "/ListGroups"
+	GetGroupProcedure              = "/" + ServiceName + "/GetGroup"
+	CreateGroupProcedure           = "/" + ServiceName + "/CreateGroup"
+	UpdateGroupProcedure           = "/" + ServiceName + "/UpdateGroup"
+	DeleteGroupProcedure           = "/" + ServiceName + "/DeleteGroup"
+	ListUserGroupsProcedure        = "/" + ServiceName + "/ListUserGroups"
+	AddGroupMembersProcedure       = "/" + ServiceName + "/AddGroupMembers"
+	RemoveGroupMembersProcedure    = "/" + ServiceName + "/RemoveGroupMembers"
+	AssignRoleToGroupProcedure     = "/" + ServiceName + "/AssignRoleToGroup"
+	UnassignRoleFromGroupProcedure = "/" + ServiceName + "/UnassignRoleFromGroup"
+	AddSubgroupProcedure           = "/" + ServiceName + "/AddSubgroup"
+	RemoveSubgroupProcedure        = "/" + ServiceName + "/RemoveSubgroup"
+)
+
+// Group is the JSON representation of a group.
+type Group struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+}
+
+// GroupFromModel converts a group model to its JSON representation.
+func GroupFromModel(g repo.UserGroup) Group {
+	group := Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+	}
+
+	if g.Metadata != "" && g.Metadata != "{}" {
+		group.Metadata = json.RawMessage(g.Metadata)
+	}
+
+	return group
+}
+
+func groupsFromModels(list []repo.UserGroup) []Group {
+	groups := make([]Group, len(list))
+	for idx, g := range list {
+		groups[idx] = GroupFromModel(g)
+	}
+
+	return groups
+}
+
+// ListGroupsRequest is the request message for the ListGroups endpoint.
+type ListGroupsRequest struct{}
+
+// ListGroupsResponse is the response message for the ListGroups endpoint.
+type ListGroupsResponse struct {
+	Groups []Group `json:"groups"`
+}
+
+// GetGroupRequest is the request message for the GetGroup endpoint. Either
+// ID or Name must be set.
+type GetGroupRequest struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Member is a member of a group.
+type Member struct {
+	UserID      string `json:"userId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName,omitempty"`
+	Owner       bool   `json:"owner,omitempty"`
+}
+
+// RoleRef references a role.
+type RoleRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetGroupResponse is the response message for the GetGroup endpoint.
+type GetGroupResponse struct {
+	Group Group `json:"group"`
+
+	// Members holds the direct members of the group. Members of subgroups
+	// are not included.
+	Members []Member `json:"members"`
+
+	// Roles holds the roles assigned to the group.
+	Roles []RoleRef `json:"roles"`
+
+	// Subgroups holds the direct subgroups of the group.
+	Subgroups []Group `json:"subgroups"`
+}
+
+// CreateGroupRequest is the request message for the CreateGroup endpoint.
+type CreateGroupRequest struct {
+	// ID is optional and generated if empty.
+	ID          string          `json:"id,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+}
+
+// CreateGroupResponse is the response message for the CreateGroup endpoint.
+type CreateGroupResponse struct {
+	Group Group `json:"group"`
+}
+
+// UpdateGroupRequest is the request message for the UpdateGroup endpoint.
+type UpdateGroupRequest struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+
+	// FieldMask lists the fields to update and defaults to all of name,
+	// description and metadata.
+	FieldMask []string `json:"fieldMask,omitempty"`
+}
+
+// UpdateGroupResponse is the response message for the UpdateGroup endpoint.
+type UpdateGroupResponse struct {
+	Group Group `json:"group"`
+}
+
+// DeleteGroupRequest is the request message for the DeleteGroup endpoint.
+type DeleteGroupRequest struct {
+	ID string `json:"id"`
+}
+
+// DeleteGroupResponse is the response message for the DeleteGroup endpoint.
+type DeleteGroupResponse struct{}
+
+// ListUserGroupsRequest is the request message for the ListUserGroups
+// endpoint.
+type ListUserGroupsRequest struct {
+	UserID string `json:"userId"`
+}
+
+// ListUserGroupsResponse is the response message for the ListUserGroups
+// endpoint.
+type ListUserGroupsResponse struct {
+	// Groups holds all groups the user is a member of, either directly or
+	// through a subgroup.
+	Groups []Group `json:"groups"`
+}
+
+type Service struct {
+	*app.Providers
+}
+
+func NewService(p *app.Providers) *Service {
+	return &Service{
+		Providers: p,
+	}
+}
+
+// isSuperuser reports whether the caller has the idm_superuser role.
+func isSuperuser(ctx context.Context) bool {
+	claims := middleware.ClaimsFromContext(ctx)
+
+	return claims != nil &&
+		claims.AppMetadata != nil &&
+		claims.AppMetadata.Authorization != nil &&
+		slices.Contains(claims.AppMetadata.Authorization.Roles, "idm_superuser")
+}
+
+// validateMetadata ensures metadata is a JSON object and returns it as a
+// string suitable for storing.
+func validateMetadata(metadata json.RawMessage) (string, error) {
+	if len(metadata) == 0 || string(metadata) == "null" {
+		return "{}", nil
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(metadata, &obj); err != nil {
+		return "", connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("metadata must be a JSON object"))
+	}
+
+	blob, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	return string(blob), nil
+}
+
+func (svc *Service) getGroup(ctx context.Context, tx *repo.Queries, id string) (repo.UserGroup, error) {
+	group, err := tx.GetGroupByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return group, connect.NewError(connect.CodeNotFound, fmt.Errorf("group %q not found", id))
+		}
+
+		return group, err
+	}
+
+	return group, nil
+}
+
+func (svc *Service) ListGroups(ctx context.Context, req *ListGroupsRequest) (*ListGroupsResponse, error) {
+	groups, err := svc.Datastore.GetGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	return &ListGroupsResponse{
+		Groups: groupsFromModels(groups),
+	}, nil
+}
+
+func (svc *Service) GetGroup(ctx context.Context, req *GetGroupRequest) (*GetGroupResponse, error) {
+	var (
+		group repo.UserGroup
+		err   error
+	)
+
+	switch {
+	case req.ID != "":
+		group, err = svc.getGroup(ctx, svc.Datastore, req.ID)
+	case req.Name != "":
+		group, err = svc.Datastore.GetGroupByName(ctx, req.Name)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = connect.NewError(connect.CodeNotFound, fmt.Errorf("group with name %q not found", req.Name))
+		}
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("either id or name must be set"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := svc.Datastore.GetGroupMembers(ctx, group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group members: %w", err)
+	}
+
+	ids := make([]string, len(members))
+	for idx, m := range members {
+		ids[idx] = m.UserID
+	}
+
+	users, err := svc.Datastore.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	byID := make(map[string]repo.User, len(users))
+	for _, usr := range users {
+		byID[usr.ID] = usr
+	}
+
+	roles, err := svc.Datastore.GetGroupRoles(ctx, group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group roles: %w", err)
+	}
+
+	subgroups, err := svc.Datastore.GetSubgroups(ctx, group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subgroups: %w", err)
+	}
+
+	res := &GetGroupResponse{
+		Group:     GroupFromModel(group),
+		Members:   make([]Member, 0, len(members)),
+		Roles:     make([]RoleRef, len(roles)),
+		Subgroups: groupsFromModels(subgroups),
+	}
+
+	for _, m := range members {
+		usr, ok := byID[m.UserID]
+		if !ok || usr.Deleted {
+			continue
+		}
+
+		res.Members = append(res.Members, Member{
+			UserID:      usr.ID,
+			Username:    usr.Username,
+			DisplayName: usr.DisplayName,
+			Owner:       m.Owner,
+		})
+	}
+
+	for idx, r := range roles {
+		res.Roles[idx] = RoleRef{ID: r.ID, Name: r.Name}
+	}
+
+	return res, nil
+}
+
+func (svc *Service) CreateGroup(ctx context.Context, req *CreateGroupRequest) (*CreateGroupResponse, error) {
+	if req.Name == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing group name"))
+	}
+
+	metadata, err := validateMetadata(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	params := repo.CreateGroupParams{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Metadata:    metadata,
+	}
+
+	if params.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+
+		params.ID = id.String()
+	}
+
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		if _, err := tx.GetGroupByID(ctx, params.ID); err == nil {
+			return repo.UserGroup{}, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("group with id %q already exists", params.ID))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return repo.UserGroup{}, fmt.Errorf("failed to query for conflicting groups: %w", err)
+		}
+
+		if _, err := tx.GetGroupByName(ctx, params.Name); err == nil {
+			return repo.UserGroup{}, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("group with name %q already exists", params.Name))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return repo.UserGroup{}, fmt.Errorf("failed to query for conflicting groups: %w", err)
+		}
+
+		group, err := tx.CreateGroup(ctx, params)
+		if err != nil {
+			return group, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+		audit.RecordChange(ctx, nil, group)
+
+		return group, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Changes.Publish(ctx, changes.GroupCreated, "", "", changes.GroupData{ID: group.ID, Name: group.Name})
+
+	return &CreateGroupResponse{
+		Group: GroupFromModel(group),
+	}, nil
+}
+
+func (svc *Service) UpdateGroup(ctx context.Context, req *UpdateGroupRequest) (*UpdateGroupResponse, error) {
+	paths := req.FieldMask
+	if len(paths) == 0 {
+		paths = []string{"name", "description", "metadata"}
+	}
+
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		group, err := svc.getGroup(ctx, tx, req.ID)
+		if err != nil {
+			return group, err
+		}
+
+		update := repo.UpdateGroupParams{
+			ID:          group.ID,
+			Name:        group.Name,
+			Description: group.Description,
+			Metadata:    group.Metadata,
+		}
+
+		for _, p := range paths {
+			switch p {
+			case "name":
+				if req.Name == "" {
+					return group, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing group name"))
+				}
+
+				if req.Name != group.Name {
+					if _, err := tx.GetGroupByName(ctx, req.Name); err == nil {
+						return group, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("group with name %q already exists", req.Name))
+					} else if !errors.Is(err, sql.ErrNoRows) {
+						return group, fmt.Errorf("failed to query for conflicting groups: %w", err)
+					}
+				}
+
+				update.Name = req.Name
+			case "description":
+				update.Description = req.Description
+			case "metadata":
+				update.Metadata, err = validateMetadata(req.Metadata)
+				if err != nil {
+					return group, err
+				}
+			default:
+				return group, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown field_mask.path %q", p))
+			}
+		}
+
+		updated, err := tx.UpdateGroup(ctx, update)
+		if err != nil {
+			return group, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+		audit.RecordChange(ctx, group, updated)
+
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Changes.Publish(ctx, changes.GroupUpdated, "", "", changes.GroupData{ID: group.ID, Name: group.Name})
+
+	return &UpdateGroupResponse{
+		Group: GroupFromModel(group),
+	}, nil
+}
+
+func (svc *Service) DeleteGroup(ctx context.Context, req *DeleteGroupRequest) (*DeleteGroupResponse, error) {
+	group, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.UserGroup, error) {
+		group, err := svc.getGroup(ctx, tx, req.ID)
+		if err != nil {
+			return group, err
+		}
+
+		if _, err := tx.DeleteGroup(ctx, group.ID); err != nil {
+			return group, err
+		}
+
+		audit.SetTarget(ctx, audit.TargetGroup, group.ID)
+		audit.RecordChange(ctx, group, nil)
+
+		return group, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Changes.Publish(ctx, changes.GroupDeleted, "", "", changes.GroupData{ID: group.ID, Name: group.Name})
+
+	return &DeleteGroupResponse{}, nil
+}
+
+func (svc *Service) ListUserGroups(ctx context.Context, req *ListUserGroupsRequest) (*ListUserGroupsResponse, error) {
+	userID := req.UserID
+	if userID == "" {
+		if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+			userID = claims.Subject
+		}
+	}
+
+	groups, err := svc.Datastore.GetEffectiveGroupsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user groups: %w", err)
+	}
+
+	return &ListUserGroupsResponse{
+		Groups: groupsFromModels(groups),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package roles
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// AssignRoleToUserWithValidityProcedure is the HTTP path of the
+	// AssignRoleToUserWithValidity endpoint.
+	AssignRoleToUserWithValidityProcedure = "/" + ServiceName + "/AssignRoleToUserWithValidity"
+
+	// ListRoleAssignmentsProcedure is the HTTP path of the
+	// ListRoleAssignments endpoint.
+	ListRoleAssignmentsProcedure = "/" + ServiceName + "/ListRoleAssignments"
+)
+
+// AssignRoleToUserWithValidityRequest is the request message for the
+// AssignRoleToUserWithValidity endpoint.
+type AssignRoleToUserWithValidityRequest struct {
+	RoleID  string   `json:"roleId"`
+	UserIDs []string `json:"userIds"`
+
+	// ValidFrom is the time at which the assignment becomes active. If
+	// unset, the assignment is active immediately.
+	ValidFrom *time.Time `json:"validFrom,omitempty"`
+
+	// ValidUntil is the time at which the assignment expires. If unset, the
+	// assignment never expires.
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// AssignRoleToUserWithValidityResponse is the response message for the
+// AssignRoleToUserWithValidity endpoint.
+type AssignRoleToUserWithValidityResponse struct{}
+
+// ListRoleAssignmentsRequest is the request message for the
+// ListRoleAssignments endpoint. Either RoleID or UserID must be set.
+type ListRoleAssignmentsRequest struct {
+	RoleID string `json:"roleId,omitempty"`
+	UserID string `json:"userId,omitempty"`
+}
+
+// RoleAssignment describes the assignment of a role to a user.
+type RoleAssignment struct {
+	UserID     string     `json:"userId"`
+	RoleID     string     `json:"roleId"`
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+
+	// Active is true if the assignment is currently within its validity
+	// period.
+	Active bool `json:"active"`
+}
+
+// ListRoleAssignmentsResponse is the response message for the
+// ListRoleAssignments endpoint.
+type ListRoleAssignmentsResponse struct {
+	Assignments []RoleAssignment `json:"assignments"`
+}
+
+// AssignRoleToUserWithValidity assigns a role to users for a limited period
+// of time. Assignments outside of their validity period are ignored when
+// resolving roles and are removed by the role-assignments maintenance job
+// once they expired.
+func (svc *Service) AssignRoleToUserWithValidity(ctx context.Context, req *AssignRoleToUserWithValidityRequest) (*AssignRoleToUserWithValidityResponse, error) {
+	validFrom := toNullTime(req.ValidFrom)
+	validUntil := toNullTime(req.ValidUntil)
+
+	if err := validateValidity(validFrom, validUntil); err != nil {
+		return nil, err
+	}
+
+	if err := svc.assignRole(ctx, req.RoleID, req.UserIDs, validFrom, validUntil); err != nil {
+		return nil, err
+	}
+
+	return &AssignRoleToUserWithValidityResponse{}, nil
+}
+
+// ListRoleAssignments returns the direct assignments of a role or a user
+// including their validity period. Users may list their own assignments,
+// everything else requires the idm_superuser role.
+func (svc *Service) ListRoleAssignments(ctx context.Context, req *ListRoleAssignmentsRequest) (*ListRoleAssignmentsResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	superuser := isSuperuser(ctx)
+
+	var (
+		assignments []repo.RoleAssignment
+		err         error
+	)
+
+	switch {
+	case req.UserID != "" && req.RoleID != "":
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("only one of roleId and userId may be set"))
+
+	case req.UserID != "":
+		if req.UserID != claims.Subject && !superuser {
+			return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you may only list your own role assignments"))
+		}
+
+		assignments, err = svc.Datastore.GetRoleAssignmentsForUser(ctx, req.UserID)
+
+	case req.RoleID != "":
+		if !superuser {
+			return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only idm_superuser may list the assignments of a role"))
+		}
+
+		assignments, err = svc.Datastore.GetRoleAssignmentsForRole(ctx, req.RoleID)
+
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("either roleId or userId must be set"))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role assignments: %w", err)
+	}
+
+	now := time.Now()
+	res := &ListRoleAssignmentsResponse{
+		Assignments: make([]RoleAssignment, 0, len(assignments)),
+	}
+
+	for _, a := range assignments {
+		res.Assignments = append(res.Assignments, RoleAssignment{
+			UserID:     a.UserID,
+			RoleID:     a.RoleID,
+			ValidFrom:  fromNullTime(a.ValidFrom),
+			ValidUntil: fromNullTime(a.ValidUntil),
+			Active: (!a.ValidFrom.Valid || !a.ValidFrom.Time.After(now)) &&
+				(!a.ValidUntil.Valid || a.ValidUntil.Time.After(now)),
+		})
+	}
+
+	return res, nil
+}
+
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil || t.IsZero() {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func fromNullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
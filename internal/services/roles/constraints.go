@@ -0,0 +1,62 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
+)
+
+// ListConstraintViolationsProcedure is the HTTP path of the
+// ListConstraintViolations endpoint.
+const ListConstraintViolationsProcedure = "/" + ServiceName + "/ListConstraintViolations"
+
+// ListConstraintViolationsRequest is the request message for the
+// ListConstraintViolations endpoint.
+type ListConstraintViolationsRequest struct{}
+
+// ListConstraintViolationsResponse is the response message for the
+// ListConstraintViolations endpoint.
+type ListConstraintViolationsResponse struct {
+	// Exclusive holds the configured sets of mutually exclusive roles.
+	Exclusive []*config.ExclusiveRoles `json:"exclusive"`
+
+	// MaxHolders holds the configured holder limits by role.
+	MaxHolders map[string]int `json:"maxHolders"`
+
+	Violations []constraints.Violation `json:"violations"`
+}
+
+// ListConstraintViolations returns the configured separation-of-duties
+// constraints and all existing violations. Violations may exist if roles,
+// inclusions or assignments were created before the constraints were
+// configured or if time-bound assignments became active.
+func (svc *Service) ListConstraintViolations(ctx context.Context, req *ListConstraintViolationsRequest) (*ListConstraintViolationsResponse, error) {
+	violations, err := svc.Constraints.Violations(ctx, svc.Datastore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate constraints: %w", err)
+	}
+
+	cfg := svc.Constraints.Config()
+
+	res := &ListConstraintViolationsResponse{
+		Exclusive:  cfg.Exclusive,
+		MaxHolders: cfg.MaxHolders,
+		Violations: violations,
+	}
+
+	if res.Exclusive == nil {
+		res.Exclusive = []*config.ExclusiveRoles{}
+	}
+
+	if res.MaxHolders == nil {
+		res.MaxHolders = map[string]int{}
+	}
+
+	if res.Violations == nil {
+		res.Violations = []constraints.Violation{}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,599 @@
+package roles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gofrs/uuid"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// RequestRoleProcedure is the HTTP path of the RequestRole endpoint.
+	RequestRoleProcedure = "/" + ServiceName + "/RequestRole"
+
+	// ListRoleRequestsProcedure is the HTTP path of the ListRoleRequests
+	// endpoint.
+	ListRoleRequestsProcedure = "/" + ServiceName + "/ListRoleRequests"
+
+	// ApproveRoleRequestProcedure is the HTTP path of the
+	// ApproveRoleRequest endpoint.
+	ApproveRoleRequestProcedure = "/" + ServiceName + "/ApproveRoleRequest"
+
+	// DenyRoleRequestProcedure is the HTTP path of the DenyRoleRequest
+	// endpoint.
+	DenyRoleRequestProcedure = "/" + ServiceName + "/DenyRoleRequest"
+
+	// CancelRoleRequestProcedure is the HTTP path of the CancelRoleRequest
+	// endpoint.
+	CancelRoleRequestProcedure = "/" + ServiceName + "/CancelRoleRequest"
+)
+
+// PermissionApproveRoles allows users to decide requests for any role.
+// Appending ":<role-id>" restricts the permission to a single role.
+const PermissionApproveRoles = "idm:roles:approve"
+
+// Status values of role requests.
+const (
+	RoleRequestPending   = "pending"
+	RoleRequestApproved  = "approved"
+	RoleRequestDenied    = "denied"
+	RoleRequestCancelled = "cancelled"
+)
+
+// Notifier sends notifications to users. It is implemented by the notify
+// service.
+type Notifier interface {
+	SendNotification(context.Context, *connect.Request[idmv1.SendNotificationRequest]) (*connect.Response[idmv1.SendNotificationResponse], error)
+}
+
+// RoleRequest is a request of a user for a role.
+type RoleRequest struct {
+	ID                  string     `json:"id"`
+	UserID              string     `json:"userId"`
+	RoleID              string     `json:"roleId"`
+	Justification       string     `json:"justification,omitempty"`
+	RequestedValidUntil *time.Time `json:"requestedValidUntil,omitempty"`
+	Status              string     `json:"status"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	DecidedBy           string     `json:"decidedBy,omitempty"`
+	DecidedAt           *time.Time `json:"decidedAt,omitempty"`
+	DecisionComment     string     `json:"decisionComment,omitempty"`
+
+	// ValidFrom and ValidUntil hold the validity period of the role
+	// assignment created for an approved request.
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// RequestRoleRequest is the request message for the RequestRole endpoint.
+type RequestRoleRequest struct {
+	RoleID        string `json:"roleId"`
+	Justification string `json:"justification"`
+
+	// ValidUntil may be set to request the role only for a limited time.
+	// Approvers may change the period when approving the request.
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// RequestRoleResponse is the response message for the RequestRole endpoint.
+type RequestRoleResponse struct {
+	Request RoleRequest `json:"request"`
+}
+
+// ListRoleRequestsRequest is the request message for the ListRoleRequests
+// endpoint. All filters are optional.
+type ListRoleRequestsRequest struct {
+	Status string `json:"status,omitempty"`
+	UserID string `json:"userId,omitempty"`
+	RoleID string `json:"roleId,omitempty"`
+}
+
+// ListRoleRequestsResponse is the response message for the ListRoleRequests
+// endpoint.
+type ListRoleRequestsResponse struct {
+	Requests []RoleRequest `json:"requests"`
+}
+
+// DecideRoleRequestRequest is the request message for the
+// ApproveRoleRequest, DenyRoleRequest and CancelRoleRequest endpoints.
+type DecideRoleRequestRequest struct {
+	ID      string `json:"id"`
+	Comment string `json:"comment,omitempty"`
+
+	// ValidFrom and ValidUntil overwrite the validity period of the role
+	// assignment created for an approved request. ValidUntil defaults to
+	// the period requested by the user. They are ignored when denying or
+	// cancelling a request.
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// DecideRoleRequestResponse is the response message for the
+// ApproveRoleRequest, DenyRoleRequest and CancelRoleRequest endpoints.
+type DecideRoleRequestResponse struct {
+	Request RoleRequest `json:"request"`
+}
+
+func roleRequestFromModel(r repo.RoleRequest) RoleRequest {
+	return RoleRequest{
+		ID:                  r.ID,
+		UserID:              r.UserID,
+		RoleID:              r.RoleID,
+		Justification:       r.Justification,
+		RequestedValidUntil: fromNullTime(r.RequestedValidUntil),
+		Status:              r.Status,
+		CreatedAt:           r.CreatedAt,
+		DecidedBy:           r.DecidedBy.String,
+		DecidedAt:           fromNullTime(r.DecidedAt),
+		DecisionComment:     r.DecisionComment,
+		ValidFrom:           fromNullTime(r.ValidFrom),
+		ValidUntil:          fromNullTime(r.ValidUntil),
+	}
+}
+
+func isSuperuser(ctx context.Context) bool {
+	claims := middleware.ClaimsFromContext(ctx)
+
+	return claims != nil &&
+		claims.AppMetadata != nil &&
+		claims.AppMetadata.Authorization != nil &&
+		slices.Contains(claims.AppMetadata.Authorization.Roles, "idm_superuser")
+}
+
+// validateValidity ensures validUntil is after validFrom and in the future.
+func validateValidity(validFrom, validUntil sql.NullTime) error {
+	if !validUntil.Valid {
+		return nil
+	}
+
+	if validFrom.Valid && !validUntil.Time.After(validFrom.Time) {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("validUntil must be after validFrom"))
+	}
+
+	if !validUntil.Time.After(time.Now()) {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("validUntil must be in the future"))
+	}
+
+	return nil
+}
+
+// resolvePermissions returns the resolved permissions granted by roles.
+func (svc *Service) resolvePermissions(ctx context.Context, tx *repo.Queries, roles []repo.Role) ([]string, error) {
+	var permissions []string
+	for _, r := range roles {
+		rolePerms, err := tx.GetRolePermissions(ctx, r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role permissions: %w", err)
+		}
+
+		permissions = append(permissions, rolePerms...)
+	}
+
+	resolved, err := svc.Config.PermissionTree().Resolve(permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve role permissions: %w", err)
+	}
+
+	return resolved, nil
+}
+
+// CanApprove reports whether userID may decide requests for roleID. This is
+// the case for users holding the idm:roles:approve permission, either for
+// all roles or for roleID, unless it has been denied.
+func (svc *Service) CanApprove(ctx context.Context, tx *repo.Queries, userID, roleID string) (bool, error) {
+	roles, err := tx.GetEffectiveRolesForUser(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	resolved, err := svc.resolvePermissions(ctx, tx, roles)
+	if err != nil {
+		return false, err
+	}
+
+	return permission.Matches(resolved, PermissionApproveRoles+permission.Separator+roleID), nil
+}
+
+// approversFor returns the IDs of all users that may approve requests for
+// roleID as decided by CanApprove. If there are none, the idm_superusers are
+// returned instead.
+func (svc *Service) approversFor(ctx context.Context, roleID string) ([]string, error) {
+	roles, err := svc.Datastore.GetRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	// users are only candidates if at least one of their roles grants the
+	// permission. Denies of their other roles are checked by CanApprove.
+	var candidates []string
+	for _, r := range roles {
+		resolved, err := svc.resolvePermissions(ctx, svc.Datastore, []repo.Role{r})
+		if err != nil {
+			return nil, err
+		}
+
+		if !permission.Matches(resolved, PermissionApproveRoles+permission.Separator+roleID) {
+			continue
+		}
+
+		users, err := svc.Datastore.GetUsersWithEffectiveRole(ctx, r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users of role %q: %w", r.ID, err)
+		}
+
+		candidates = append(candidates, users...)
+	}
+
+	slices.Sort(candidates)
+
+	var approvers []string
+	for _, userID := range slices.Compact(candidates) {
+		ok, err := svc.CanApprove(ctx, svc.Datastore, userID, roleID)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			approvers = append(approvers, userID)
+		}
+	}
+
+	if len(approvers) == 0 {
+		superusers, err := svc.Datastore.GetUsersWithEffectiveRole(ctx, "idm_superuser")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get superusers: %w", err)
+		}
+
+		slices.Sort(superusers)
+		approvers = slices.Compact(superusers)
+	}
+
+	return approvers, nil
+}
+
+// RequestRole creates a request of the calling user for a role. Approvers
+// of the role are notified about the new request.
+func (svc *Service) RequestRole(ctx context.Context, req *RequestRoleRequest) (*RequestRoleResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	validUntil := toNullTime(req.ValidUntil)
+	if err := validateValidity(sql.NullTime{}, validUntil); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	var role repo.Role
+	request, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.RoleRequest, error) {
+		role, err = tx.GetRoleByID(ctx, req.RoleID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return repo.RoleRequest{}, connect.NewError(connect.CodeNotFound, fmt.Errorf("role %q not found", req.RoleID))
+			}
+
+			return repo.RoleRequest{}, err
+		}
+
+		current, err := tx.GetEffectiveRolesForUser(ctx, claims.Subject)
+		if err != nil {
+			return repo.RoleRequest{}, fmt.Errorf("failed to get user roles: %w", err)
+		}
+
+		if slices.ContainsFunc(current, func(r repo.Role) bool { return r.ID == role.ID }) {
+			return repo.RoleRequest{}, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("you already have the role %q", role.Name))
+		}
+
+		pending, err := tx.ListRoleRequests(ctx, repo.ListRoleRequestsParams{
+			Status: RoleRequestPending,
+			UserID: claims.Subject,
+			RoleID: role.ID,
+		})
+		if err != nil {
+			return repo.RoleRequest{}, fmt.Errorf("failed to get pending requests: %w", err)
+		}
+
+		if len(pending) > 0 {
+			return repo.RoleRequest{}, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("you already requested the role %q", role.Name))
+		}
+
+		request, err := tx.CreateRoleRequest(ctx, repo.CreateRoleRequestParams{
+			ID:                  id.String(),
+			UserID:              claims.Subject,
+			RoleID:              role.ID,
+			Justification:       req.Justification,
+			RequestedValidUntil: validUntil,
+			CreatedAt:           time.Now().UTC(),
+		})
+		if err != nil {
+			return request, fmt.Errorf("failed to create role request: %w", err)
+		}
+
+		audit.SetTarget(ctx, audit.TargetRoleRequest, request.ID)
+		audit.RecordChange(ctx, nil, roleRequestFromModel(request))
+
+		return request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	approvers, err := svc.approversFor(ctx, role.ID)
+	if err != nil {
+		log.L(ctx).Error("failed to determine role request approvers", "requestId", request.ID, "error", err)
+	}
+
+	approvers = slices.DeleteFunc(approvers, func(id string) bool { return id == request.UserID })
+
+	svc.notifyRoleRequest(ctx, approvers, request.UserID, fmt.Sprintf("Rollenanfrage: %s", role.Name), requestCreatedBody, map[string]any{
+		"RequestID":     request.ID,
+		"Role":          role.Name,
+		"Justification": request.Justification,
+	})
+
+	return &RequestRoleResponse{
+		Request: roleRequestFromModel(request),
+	}, nil
+}
+
+// ListRoleRequests returns role requests matching the given filters.
+// Superusers see all requests, other users only see their own requests and
+// those they may approve.
+func (svc *Service) ListRoleRequests(ctx context.Context, req *ListRoleRequestsRequest) (*ListRoleRequestsResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*ListRoleRequestsResponse, error) {
+		requests, err := tx.ListRoleRequests(ctx, repo.ListRoleRequestsParams{
+			Status: req.Status,
+			UserID: req.UserID,
+			RoleID: req.RoleID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list role requests: %w", err)
+		}
+
+		superuser := isSuperuser(ctx)
+		approvable := make(map[string]bool)
+
+		res := &ListRoleRequestsResponse{
+			Requests: make([]RoleRequest, 0, len(requests)),
+		}
+
+		for _, r := range requests {
+			if !superuser && r.UserID != claims.Subject {
+				ok, found := approvable[r.RoleID]
+				if !found {
+					ok, err = svc.CanApprove(ctx, tx, claims.Subject, r.RoleID)
+					if err != nil {
+						return nil, err
+					}
+
+					approvable[r.RoleID] = ok
+				}
+
+				if !ok {
+					continue
+				}
+			}
+
+			res.Requests = append(res.Requests, roleRequestFromModel(r))
+		}
+
+		return res, nil
+	}, repo.ReadOnly())
+}
+
+// ApproveRoleRequest approves a pending role request and assigns the role to
+// the requesting user.
+func (svc *Service) ApproveRoleRequest(ctx context.Context, req *DecideRoleRequestRequest) (*DecideRoleRequestResponse, error) {
+	return svc.decideRoleRequest(ctx, req, RoleRequestApproved)
+}
+
+// DenyRoleRequest denies a pending role request.
+func (svc *Service) DenyRoleRequest(ctx context.Context, req *DecideRoleRequestRequest) (*DecideRoleRequestResponse, error) {
+	return svc.decideRoleRequest(ctx, req, RoleRequestDenied)
+}
+
+// CancelRoleRequest cancels a pending role request. Only the requesting
+// user may cancel a request.
+func (svc *Service) CancelRoleRequest(ctx context.Context, req *DecideRoleRequestRequest) (*DecideRoleRequestResponse, error) {
+	return svc.decideRoleRequest(ctx, req, RoleRequestCancelled)
+}
+
+func (svc *Service) decideRoleRequest(ctx context.Context, req *DecideRoleRequestRequest, status string) (*DecideRoleRequestResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	var (
+		role    repo.Role
+		decided repo.RoleRequest
+	)
+
+	_, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (any, error) {
+		request, err := tx.GetRoleRequest(ctx, req.ID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("role request %q not found", req.ID))
+			}
+
+			return nil, err
+		}
+
+		if request.Status != RoleRequestPending {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("role request has already been %s", request.Status))
+		}
+
+		role, err = tx.GetRoleByID(ctx, request.RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role: %w", err)
+		}
+
+		if status == RoleRequestCancelled {
+			if request.UserID != claims.Subject {
+				return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("only the requesting user may cancel a role request"))
+			}
+		} else {
+			// nobody decides on their own requests, not even superusers.
+			if request.UserID == claims.Subject {
+				return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you cannot decide your own role request"))
+			}
+
+			if !isSuperuser(ctx) {
+				ok, err := svc.CanApprove(ctx, tx, claims.Subject, request.RoleID)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you are not allowed to decide requests for role %q", role.Name))
+				}
+			}
+		}
+
+		var validFrom, validUntil sql.NullTime
+		if status == RoleRequestApproved {
+			validFrom = toNullTime(req.ValidFrom)
+			validUntil = toNullTime(req.ValidUntil)
+
+			if !validUntil.Valid {
+				validUntil = request.RequestedValidUntil
+			}
+
+			if err := validateValidity(validFrom, validUntil); err != nil {
+				return nil, err
+			}
+
+			if err := svc.Constraints.Enforce(ctx, tx, func() error {
+				return assignRoleTx(ctx, tx, role, []string{request.UserID}, validFrom, validUntil)
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		decided, err = tx.DecideRoleRequest(ctx, repo.DecideRoleRequestParams{
+			Status:          status,
+			DecidedBy:       sql.NullString{String: claims.Subject, Valid: true},
+			DecidedAt:       sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			DecisionComment: req.Comment,
+			ValidFrom:       validFrom,
+			ValidUntil:      validUntil,
+			ID:              request.ID,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("role request has already been decided"))
+			}
+
+			return nil, fmt.Errorf("failed to update role request: %w", err)
+		}
+
+		audit.SetTarget(ctx, audit.TargetRoleRequest, decided.ID)
+		audit.RecordChange(ctx, roleRequestFromModel(request), roleRequestFromModel(decided))
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case RoleRequestApproved:
+		svc.publishRoleAssigned(ctx, role, []string{decided.UserID})
+
+		svc.notifyRoleRequest(ctx, []string{decided.UserID}, claims.Subject, fmt.Sprintf("Rollenanfrage genehmigt: %s", role.Name), requestApprovedBody, map[string]any{
+			"Role":    role.Name,
+			"Comment": decided.DecisionComment,
+		})
+
+	case RoleRequestDenied:
+		svc.notifyRoleRequest(ctx, []string{decided.UserID}, claims.Subject, fmt.Sprintf("Rollenanfrage abgelehnt: %s", role.Name), requestDeniedBody, map[string]any{
+			"Role":    role.Name,
+			"Comment": decided.DecisionComment,
+		})
+	}
+
+	return &DecideRoleRequestResponse{
+		Request: roleRequestFromModel(decided),
+	}, nil
+}
+
+// Mail bodies of role request notifications. User provided values are
+// passed in the template context so they are escaped properly.
+const (
+	requestCreatedBody = `<p>Hallo {{ or .User.User.DisplayName .User.User.Username }},</p>
+<p>{{ or .Sender.User.DisplayName .Sender.User.Username }} hat die Rolle <strong>{{ .Role }}</strong> beantragt.</p>
+{{ if .Justification }}<p>Begründung: {{ .Justification }}</p>{{ end }}
+<p>Die Anfrage kann mit <code>idmctl roles approve {{ .RequestID }}</code> genehmigt oder mit <code>idmctl roles deny {{ .RequestID }}</code> abgelehnt werden.</p>`
+
+	requestApprovedBody = `<p>Hallo {{ or .User.User.DisplayName .User.User.Username }},</p>
+<p>deine Anfrage für die Rolle <strong>{{ .Role }}</strong> wurde von {{ or .Sender.User.DisplayName .Sender.User.Username }} genehmigt.</p>
+{{ if .Comment }}<p>Kommentar: {{ .Comment }}</p>{{ end }}`
+
+	requestDeniedBody = `<p>Hallo {{ or .User.User.DisplayName .User.User.Username }},</p>
+<p>deine Anfrage für die Rolle <strong>{{ .Role }}</strong> wurde von {{ or .Sender.User.DisplayName .Sender.User.Username }} abgelehnt.</p>
+{{ if .Comment }}<p>Kommentar: {{ .Comment }}</p>{{ end }}`
+)
+
+// notifyRoleRequest sends a mail notification to all users in targets
+// using the notify service. Failures are logged but do not fail the
+// request.
+func (svc *Service) notifyRoleRequest(ctx context.Context, targets []string, senderID string, subject string, body string, values map[string]any) {
+	if svc.Notifier == nil || svc.Config.MailConfig == nil || svc.Config.MailConfig.Host == "" || len(targets) == 0 {
+		return
+	}
+
+	tmplCtx, err := structpb.NewStruct(values)
+	if err != nil {
+		log.L(ctx).Error("failed to prepare role request notification", "error", err)
+		return
+	}
+
+	perUser := make(map[string]*structpb.Struct, len(targets))
+	for _, id := range targets {
+		perUser[id] = tmplCtx
+	}
+
+	res, err := svc.Notifier.SendNotification(ctx, connect.NewRequest(&idmv1.SendNotificationRequest{
+		Message: &idmv1.SendNotificationRequest_Email{
+			Email: &idmv1.EMailMessage{
+				Subject: subject,
+				Body:    body,
+			},
+		},
+		TargetUsers:            targets,
+		PerUserTemplateContext: perUser,
+		SenderUserId:           senderID,
+	}))
+	if err != nil {
+		log.L(ctx).Error("failed to send role request notification", "targets", targets, "error", err)
+		return
+	}
+
+	for _, d := range res.Msg.Deliveries {
+		if d.Error != "" {
+			log.L(ctx).Error("failed to deliver role request notification", "userId", d.TargetUser, "error", d.Error)
+		}
+	}
+}
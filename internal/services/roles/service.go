@@ -12,13 +12,20 @@ import (
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 )
 
 type Service struct {
 	*app.Providers
 
+	// Notifier is used to notify users about role requests. If nil, no
+	// notifications are sent.
+	Notifier Notifier
+
 	idmv1connect.UnimplementedRoleServiceHandler
 }
 
@@ -67,6 +74,11 @@ func (svc *Service) CreateRole(ctx context.Context, req *connect.Request[idmv1.C
 		return nil, err
 	}
 
+	audit.SetTarget(ctx, audit.TargetRole, roleModel.ID)
+	audit.RecordChange(ctx, nil, roleModel)
+
+	svc.Changes.Publish(ctx, changes.RoleCreated, "", roleModel.ID, changes.RoleData{Name: roleModel.Name})
+
 	return connect.NewResponse(&idmv1.CreateRoleResponse{
 		Role: conv.RoleProtoFromRole(roleModel),
 	}), nil
@@ -77,8 +89,12 @@ func (svc *Service) UpdateRole(ctx context.Context, req *connect.Request[idmv1.U
 		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("dynamic role configuration is not enabled"))
 	}
 
-	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.UpdateRoleResponse], error) {
-		role, err := tx.GetRoleByID(ctx, req.Msg.RoleId)
+	var role repo.Role
+
+	res, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.UpdateRoleResponse], error) {
+		var err error
+
+		role, err = tx.GetRoleByID(ctx, req.Msg.RoleId)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, connect.NewError(connect.CodeNotFound, nil)
@@ -116,11 +132,14 @@ func (svc *Service) UpdateRole(ctx context.Context, req *connect.Request[idmv1.U
 			}
 		}
 
-		role, err = tx.UpdateRole(ctx, update)
+		updated, err := tx.UpdateRole(ctx, update)
 		if err != nil {
 			return nil, err
 		}
 
+		audit.RecordChange(ctx, role, updated)
+		role = updated
+
 		return connect.NewResponse(&idmv1.UpdateRoleResponse{
 			Role: &idmv1.Role{
 				Id:              role.ID,
@@ -130,6 +149,13 @@ func (svc *Service) UpdateRole(ctx context.Context, req *connect.Request[idmv1.U
 			},
 		}), nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Changes.Publish(ctx, changes.RoleUpdated, "", role.ID, changes.RoleData{Name: role.Name})
+
+	return res, nil
 }
 
 func (svc *Service) DeleteRole(ctx context.Context, req *connect.Request[idmv1.DeleteRoleRequest]) (*connect.Response[idmv1.DeleteRoleResponse], error) {
@@ -137,8 +163,12 @@ func (svc *Service) DeleteRole(ctx context.Context, req *connect.Request[idmv1.D
 		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("dynamic role management is not enabled"))
 	}
 
-	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.DeleteRoleResponse], error) {
-		role, err := tx.GetRoleByID(ctx, req.Msg.RoleId)
+	var role repo.Role
+
+	res, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.DeleteRoleResponse], error) {
+		var err error
+
+		role, err = tx.GetRoleByID(ctx, req.Msg.RoleId)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, connect.NewError(connect.CodeNotFound, err)
@@ -164,8 +194,17 @@ func (svc *Service) DeleteRole(ctx context.Context, req *connect.Request[idmv1.D
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("role not found"))
 		}
 
+		audit.RecordChange(ctx, role, nil)
+
 		return connect.NewResponse(&idmv1.DeleteRoleResponse{}), nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Changes.Publish(ctx, changes.RoleDeleted, "", role.ID, changes.RoleData{Name: role.Name})
+
+	return res, nil
 }
 
 func (svc *Service) ListRoles(ctx context.Context, req *connect.Request[idmv1.ListRolesRequest]) (*connect.Response[idmv1.ListRolesResponse], error) {
@@ -214,43 +253,100 @@ func (svc *Service) GetRole(ctx context.Context, req *connect.Request[idmv1.GetR
 }
 
 func (svc *Service) AssignRoleToUser(ctx context.Context, req *connect.Request[idmv1.AssignRoleToUserRequest]) (*connect.Response[idmv1.AssignRoleToUserResponse], error) {
-	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.AssignRoleToUserResponse], error) {
-		role, err := tx.GetRoleByID(ctx, req.Msg.RoleId)
+	if err := svc.assignRole(ctx, req.Msg.RoleId, req.Msg.UserId, sql.NullTime{}, sql.NullTime{}); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&idmv1.AssignRoleToUserResponse{}), nil
+}
+
+// assignRole assigns a role to all users in userIDs. Existing assignments
+// are updated to the given validity period, an unset validFrom or validUntil
+// does not limit the assignment.
+func (svc *Service) assignRole(ctx context.Context, roleID string, userIDs []string, validFrom, validUntil sql.NullTime) error {
+	role, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (repo.Role, error) {
+		role, err := tx.GetRoleByID(ctx, roleID)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
-				return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("role not found"))
+				return role, connect.NewError(connect.CodeNotFound, fmt.Errorf("role not found"))
 			}
-			return nil, err
+			return role, err
 		}
 
-		merr := new(multierror.Error)
-		for _, userID := range req.Msg.UserId {
-			user, err := tx.GetUserByID(ctx, userID)
-			if err != nil {
-				merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
-				continue
-			}
+		return role, svc.Constraints.Enforce(ctx, tx, func() error {
+			return assignRoleTx(ctx, tx, role, userIDs, validFrom, validUntil)
+		})
+	})
+	if err != nil {
+		return err
+	}
 
-			if err := tx.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{
-				UserID: user.ID,
-				RoleID: role.ID,
-			}); err != nil {
-				merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
-				continue
-			}
+	svc.publishRoleAssigned(ctx, role, userIDs)
+
+	return nil
+}
+
+// assignRoleTx assigns role to all users in userIDs within the transaction
+// tx and records the change in the audit log.
+func assignRoleTx(ctx context.Context, tx *repo.Queries, role repo.Role, userIDs []string, validFrom, validUntil sql.NullTime) error {
+	merr := new(multierror.Error)
+	for _, userID := range userIDs {
+		user, err := tx.GetUserByID(ctx, userID)
+		if err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
+			continue
 		}
 
-		if err := merr.ErrorOrNil(); err != nil {
-			return nil, err
+		if err := tx.UpsertRoleAssignment(ctx, repo.UpsertRoleAssignmentParams{
+			UserID:     user.ID,
+			RoleID:     role.ID,
+			ValidFrom:  validFrom,
+			ValidUntil: validUntil,
+		}); err != nil {
+			merr.Errors = append(merr.Errors, fmt.Errorf("user %s: %w", userID, err))
+			continue
 		}
+	}
+
+	if err := merr.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	change := map[string]any{"assigned_users": userIDs}
+	if validFrom.Valid {
+		change["valid_from"] = validFrom.Time
+	}
+	if validUntil.Valid {
+		change["valid_until"] = validUntil.Time
+	}
+
+	audit.SetTarget(ctx, audit.TargetRole, role.ID)
+	audit.RecordChange(ctx, nil, change)
+
+	return nil
+}
 
-		return connect.NewResponse(&idmv1.AssignRoleToUserResponse{}), nil
+// publishRoleAssigned emits the webhook and change events for a role that
+// has been assigned to userIDs.
+func (svc *Service) publishRoleAssigned(ctx context.Context, role repo.Role, userIDs []string) {
+	svc.Webhooks.Emit(ctx, webhook.RoleAssigned, webhook.RoleAssignmentData{
+		RoleID:   role.ID,
+		RoleName: role.Name,
+		UserIDs:  userIDs,
 	})
+
+	for _, userID := range userIDs {
+		svc.Changes.Publish(ctx, changes.RoleAssigned, userID, role.ID, changes.RoleData{Name: role.Name})
+	}
 }
 
 func (svc *Service) UnassignRoleFromUser(ctx context.Context, req *connect.Request[idmv1.UnassignRoleFromUserRequest]) (*connect.Response[idmv1.UnassignRoleFromUserResponse], error) {
-	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.UnassignRoleFromUserResponse], error) {
-		role, err := tx.GetRoleByID(ctx, req.Msg.RoleId)
+	var role repo.Role
+
+	res, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.UnassignRoleFromUserResponse], error) {
+		var err error
+
+		role, err = tx.GetRoleByID(ctx, req.Msg.RoleId)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("role not found"))
@@ -284,8 +380,26 @@ func (svc *Service) UnassignRoleFromUser(ctx context.Context, req *connect.Reque
 			return nil, err
 		}
 
+		audit.SetTarget(ctx, audit.TargetRole, role.ID)
+		audit.RecordChange(ctx, map[string]any{"assigned_users": req.Msg.UserId}, nil)
+
 		return connect.NewResponse(&idmv1.UnassignRoleFromUserResponse{}), nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Webhooks.Emit(ctx, webhook.RoleUnassigned, webhook.RoleAssignmentData{
+		RoleID:   role.ID,
+		RoleName: role.Name,
+		UserIDs:  req.Msg.UserId,
+	})
+
+	for _, userID := range req.Msg.UserId {
+		svc.Changes.Publish(ctx, changes.RoleUnassigned, userID, role.ID, changes.RoleData{Name: role.Name})
+	}
+
+	return res, nil
 }
 
 func (svc *Service) ResolveRolePermissions(ctx context.Context, req *connect.Request[idmv1.ResolveRolePermissionsRequest]) (*connect.Response[idmv1.ResolveRolePermissionsResponse], error) {
@@ -299,9 +413,20 @@ func (svc *Service) ResolveRolePermissions(ctx context.Context, req *connect.Req
 			return nil, err
 		}
 
-		permissions, err := tx.GetRolePermissions(ctx, role.ID)
+		// permissions of included roles are inherited.
+		roles, err := tx.GetEffectiveRolesForRole(ctx, role.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get role permissions: %w", err)
+			return nil, fmt.Errorf("failed to get included roles: %w", err)
+		}
+
+		var permissions []string
+		for _, r := range roles {
+			rolePerms, err := tx.GetRolePermissions(ctx, r.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get role permissions: %w", err)
+			}
+
+			permissions = append(permissions, rolePerms...)
 		}
 
 		resolved, err := svc.Config.PermissionTree().Resolve(permissions)
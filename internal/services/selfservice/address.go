@@ -6,6 +6,7 @@ import (
 
 	"github.com/bufbuild/connect-go"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
@@ -28,6 +29,8 @@ func (svc *Service) AddAddress(ctx context.Context, req *connect.Request[idmv1.A
 		return nil, fmt.Errorf("failed to save new user address: %w", err)
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionAddresses)
+
 	return connect.NewResponse(&idmv1.AddAddressResponse{
 		Addresses: conv.AddressProtosFromAddresses(addresses...),
 	}), nil
@@ -44,6 +47,8 @@ func (svc *Service) DeleteAddress(ctx context.Context, req *connect.Request[idmv
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionAddresses)
+
 	return connect.NewResponse(&idmv1.DeleteAddressResponse{
 		Addresses: conv.AddressProtosFromAddresses(addresses...),
 	}), nil
@@ -67,6 +72,8 @@ func (svc *Service) UpdateAddress(ctx context.Context, req *connect.Request[idmv
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionAddresses)
+
 	return connect.NewResponse(&idmv1.UpdateAddressResponse{
 		Addresses: conv.AddressProtosFromAddresses(addrs...),
 	}), nil
@@ -28,7 +28,7 @@ func (svc *Service) GenerateAPIToken(ctx context.Context, req *connect.Request[i
 	}
 
 	return repo.RunInTransaction[*connect.Response[idmv1.GenerateAPITokenResponse]](ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.GenerateAPITokenResponse], error) {
-		userRoles, err := tx.GetRolesForUser(ctx, claims.Subject)
+		userRoles, err := tx.GetEffectiveRolesForUser(ctx, claims.Subject)
 		if err != nil {
 			return nil, err
 		}
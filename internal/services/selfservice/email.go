@@ -6,9 +6,11 @@ import (
 
 	"github.com/bufbuild/connect-go"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 )
 
 func (svc *Service) AddEmailAddress(ctx context.Context, req *connect.Request[idmv1.AddEmailAddressRequest]) (*connect.Response[idmv1.AddEmailAddressResponse], error) {
@@ -34,6 +36,8 @@ func (svc *Service) AddEmailAddress(ctx context.Context, req *connect.Request[id
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionEmails)
+
 	res := connect.NewResponse(&idmv1.AddEmailAddressResponse{
 		Emails: conv.EmailProtosFromEmails(mails...),
 	})
@@ -52,6 +56,8 @@ func (svc *Service) DeleteEmailAddress(ctx context.Context, req *connect.Request
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionEmails)
+
 	res := connect.NewResponse(&idmv1.DeleteEmailAddressResponse{
 		Emails: conv.EmailProtosFromEmails(mails...),
 	})
@@ -69,6 +75,8 @@ func (svc *Service) MarkEmailAsPrimary(ctx context.Context, req *connect.Request
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionEmails)
+
 	return connect.NewResponse(&idmv1.MarkEmailAsPrimaryResponse{}), nil
 }
 
@@ -125,6 +133,14 @@ func (svc *Service) ValidateEmail(ctx context.Context, req *connect.Request[idmv
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user mail not found"))
 		}
 
+		svc.Webhooks.Emit(ctx, webhook.EmailVerified, webhook.EmailVerifiedData{
+			UserID:  claims.Subject,
+			EmailID: email.ID,
+			Address: email.Address,
+		})
+
+		svc.publishProfileChange(ctx, claims.Subject, changes.SectionEmails)
+
 	default:
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request"))
 	}
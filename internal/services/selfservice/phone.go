@@ -12,6 +12,7 @@ import (
 	"github.com/gofrs/uuid"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/cache"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
@@ -47,6 +48,8 @@ func (svc *Service) AddPhoneNumber(ctx context.Context, req *connect.Request[idm
 		return nil, err
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionPhoneNumbers)
+
 	return connect.NewResponse(&idmv1.AddPhoneNumberResponse{
 		PhoneNumber: conv.PhoneNumberProtoFromPhoneNumber(phone),
 	}), nil
@@ -71,6 +74,8 @@ func (svc *Service) DeletePhoneNumber(ctx context.Context, req *connect.Request[
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("phone number not found"))
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionPhoneNumbers)
+
 	return connect.NewResponse(&idmv1.DeletePhoneNumberResponse{}), nil
 }
 
@@ -93,6 +98,8 @@ func (svc *Service) MarkPhoneNumberAsPrimary(ctx context.Context, req *connect.R
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("phone-number not found"))
 	}
 
+	svc.publishProfileChange(ctx, claims.Subject, changes.SectionPhoneNumbers)
+
 	return connect.NewResponse(&idmv1.MarkPhoneNumberAsPrimaryResponse{}), nil
 }
 
@@ -165,6 +172,8 @@ func (svc *Service) ValidatePhoneNumber(ctx context.Context, req *connect.Reques
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("the verified number has been deleted from the profile"))
 		}
 
+		svc.publishProfileChange(ctx, claims.Subject, changes.SectionPhoneNumbers)
+
 		return connect.NewResponse(&idmv1.ValidatePhoneNumberResponse{}), nil
 
 	default:
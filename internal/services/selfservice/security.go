@@ -17,6 +17,7 @@ import (
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -53,6 +54,11 @@ func (svc *Service) ChangePassword(ctx context.Context, req *connect.Request[idm
 		return nil, fmt.Errorf("user not found")
 	}
 
+	svc.Webhooks.Emit(ctx, webhook.PasswordChanged, webhook.PasswordChangedData{
+		UserID:    user.ID,
+		ChangedBy: user.ID,
+	})
+
 	return connect.NewResponse(&idmv1.ChangePasswordResponse{}), nil
 }
 
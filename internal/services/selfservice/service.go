@@ -9,9 +9,12 @@ import (
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/conv"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 )
 
 type Service struct {
@@ -26,6 +29,14 @@ func NewService(provider *app.Providers) *Service {
 	}
 }
 
+// publishProfileChange publishes a profile.changed event for the given
+// sections of the user profile.
+func (svc *Service) publishProfileChange(ctx context.Context, userID string, sections ...string) {
+	svc.Changes.Publish(ctx, changes.ProfileChanged, userID, "", changes.ProfileData{
+		Sections: sections,
+	})
+}
+
 func (svc *Service) UpdateProfile(ctx context.Context, req *connect.Request[idmv1.UpdateProfileRequest]) (*connect.Response[idmv1.UpdateProfileResponse], error) {
 	claims := middleware.ClaimsFromContext(ctx)
 	if claims == nil {
@@ -37,6 +48,8 @@ func (svc *Service) UpdateProfile(ctx context.Context, req *connect.Request[idmv
 		return nil, fmt.Errorf("failed to get user object: %w", err)
 	}
 
+	before := user
+
 	paths := req.Msg.GetFieldMask().GetPaths()
 	if len(paths) == 0 {
 		paths = []string{"username", "display_name", "first_name", "last_name", "avatar", "birthday"}
@@ -91,6 +104,11 @@ func (svc *Service) UpdateProfile(ctx context.Context, req *connect.Request[idmv
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to update user: %w", err))
 	}
 
+	audit.RecordChange(ctx, before, user)
+
+	svc.EmitUserEvent(ctx, webhook.UserUpdated, user)
+	svc.publishProfileChange(ctx, user.ID, changes.SectionProfile)
+
 	return connect.NewResponse(&idmv1.UpdateProfileResponse{
 		User: conv.UserProtoFromUser(ctx, user),
 	}), nil
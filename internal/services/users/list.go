@@ -0,0 +1,288 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/mennanov/fmutils"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/privacy"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// ServiceName is the name of the user listing service.
+	ServiceName = "cisidm.v1.UserService"
+
+	// ListUsersProcedure is the HTTP path of the paginated ListUsers
+	// endpoint.
+	ListUsersProcedure = "/" + ServiceName + "/ListUsers"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Values for ListUsersRequest.Deleted.
+const (
+	DeletedInclude = "include"
+	DeletedExclude = "exclude"
+	DeletedOnly    = "only"
+)
+
+// extraPathPattern matches dot-separated paths of extra data fields.
+var extraPathPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// ListUsersRequest is the request message for the paginated ListUsers
+// endpoint. All filters are optional and combined using AND.
+type ListUsersRequest struct {
+	// Username, DisplayName and Email match users where the respective
+	// field contains the value, ignoring case. Unless the caller has the
+	// idm_superuser or idm_user_manager role, Email only matches primary
+	// e-mail addresses.
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Email       string `json:"email,omitempty"`
+
+	// Roles matches users that have at least one of the roles, specified
+	// by ID or name, assigned.
+	Roles []string `json:"roles,omitempty"`
+
+	// Deleted is one of "include" (default), "exclude" or "only".
+	Deleted string `json:"deleted,omitempty"`
+
+	// Extra matches users by their extra data. Keys are dot-separated field
+	// paths, values are compared as text.
+	Extra map[string]string `json:"extra,omitempty"`
+
+	// SortBy is one of "username" (default), "display_name", "first_name"
+	// or "last_name". Sorting by the first or last name requires the
+	// idm_superuser or idm_user_manager role.
+	SortBy     string `json:"sortBy,omitempty"`
+	Descending bool   `json:"descending,omitempty"`
+
+	// FieldMask and ExcludeFields work like in tkd.idm.v1.ListUsersRequest
+	// but apply to each profile.
+	FieldMask     []string `json:"fieldMask,omitempty"`
+	ExcludeFields bool     `json:"excludeFields,omitempty"`
+
+	PageSize  int    `json:"pageSize,omitempty"`
+	PageToken string `json:"pageToken,omitempty"`
+}
+
+// ListUsersResponse is the response message for the paginated ListUsers
+// endpoint. Users are encoded like tkd.idm.v1.Profile. If NextPageToken is
+// set, more users are available.
+type ListUsersResponse struct {
+	Users         []json.RawMessage `json:"users"`
+	NextPageToken string            `json:"nextPageToken,omitempty"`
+}
+
+// pageToken is the decoded form of a page token. It records the sort order
+// so a token can not be used with a different one.
+type pageToken struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Value      string `json:"v"`
+	ID         string `json:"i"`
+}
+
+func (t pageToken) encode() string {
+	blob, _ := json.Marshal(t)
+
+	return base64.RawURLEncoding.EncodeToString(blob)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+
+	blob, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, err
+	}
+
+	if err := json.Unmarshal(blob, &t); err != nil {
+		return t, err
+	}
+
+	if t.ID == "" {
+		return t, fmt.Errorf("missing user id")
+	}
+
+	return t, nil
+}
+
+// ListUsersPage returns a page of users matching the filters in req. In
+// contrast to the tkd.idm.v1.UserService/ListUsers endpoint, all filters are
+// applied by the database. Like there, callers without the idm_superuser or
+// idm_user_manager role only see the public fields of other users and can
+// therefore only filter and sort by them.
+func (svc *Service) ListUsersPage(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	sortBy := req.SortBy
+	if sortBy == "" {
+		sortBy = repo.UserSortUsername
+	}
+
+	if !repo.IsUserSortField(sortBy) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unsupported sort field %q", req.SortBy))
+	}
+
+	readAll := app.CanReadProfiles(ctx)
+
+	if !readAll && (sortBy == repo.UserSortFirstName || sortBy == repo.UserSortLastName) {
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("not allowed to sort by %s", sortBy))
+	}
+
+	params := repo.ListUsersPageParams{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Extra:       req.Extra,
+		SortBy:      sortBy,
+		Descending:  req.Descending,
+		// only the primary e-mail address of other users is public.
+		EmailPrimaryOnly: !readAll,
+		// fetch one additional record to figure out if there's a next page.
+		Limit: int64(pageSize) + 1,
+	}
+
+	switch req.Deleted {
+	case "", DeletedInclude:
+	case DeletedExclude:
+		params.Deleted = sql.NullBool{Bool: false, Valid: true}
+	case DeletedOnly:
+		params.Deleted = sql.NullBool{Bool: true, Valid: true}
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid value for deleted: %q", req.Deleted))
+	}
+
+	for path := range req.Extra {
+		if !extraPathPattern.MatchString(path) || !svc.CanFilterByExtraField(ctx, path) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot filter by extra data field %q", path))
+		}
+	}
+
+	for _, idOrName := range req.Roles {
+		role, err := svc.Datastore.GetRoleByID(ctx, idOrName)
+		if errors.Is(err, sql.ErrNoRows) {
+			role, err = svc.Datastore.GetRoleByName(ctx, idOrName)
+		}
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("role %q does not exist", idOrName))
+			}
+
+			return nil, err
+		}
+
+		params.RoleIDs = append(params.RoleIDs, role.ID)
+	}
+
+	if req.PageToken != "" {
+		token, err := decodePageToken(req.PageToken)
+		if err != nil || token.SortBy != sortBy || token.Descending != req.Descending {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token"))
+		}
+
+		params.AfterValue = token.Value
+		params.AfterID = token.ID
+	}
+
+	users, err := svc.Datastore.ListUsersPage(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+
+	res := &ListUsersResponse{
+		Users: make([]json.RawMessage, 0, len(users)),
+	}
+
+	if len(users) > pageSize {
+		users = users[:pageSize]
+
+		last := users[len(users)-1]
+		res.NextPageToken = pageToken{
+			SortBy:     sortBy,
+			Descending: req.Descending,
+			Value:      last.SortValue(sortBy),
+			ID:         last.ID,
+		}.encode()
+	}
+
+	profiles, err := svc.GetUserProfileProtos(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Users, err = encodeProfiles(ctx, profiles, req.FieldMask, req.ExcludeFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// callerSubject returns the ID and the roles of the caller.
+func callerSubject(ctx context.Context) (string, []string) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return "", nil
+	}
+
+	if claims.AppMetadata == nil || claims.AppMetadata.Authorization == nil {
+		return claims.Subject, nil
+	}
+
+	return claims.Subject, claims.AppMetadata.Authorization.Roles
+}
+
+// encodeProfiles encodes profiles like tkd.idm.v1.Profile. Fields the
+// caller may not read are removed like the privacy interceptor does for the
+// Connect endpoints, the field mask selects the remaining fields.
+func encodeProfiles(ctx context.Context, profiles []*idmv1.Profile, fieldMask []string, excludeFields bool) ([]json.RawMessage, error) {
+	subject, roles := callerSubject(ctx)
+
+	result := make([]json.RawMessage, 0, len(profiles))
+	for _, profile := range profiles {
+		if err := privacy.FilterAllowedFields(profile, subject, roles); err != nil {
+			return nil, fmt.Errorf("failed to filter profile: %w", err)
+		}
+
+		// make sure we only include fields that are requested
+		if len(fieldMask) > 0 {
+			if excludeFields {
+				fmutils.Prune(profile, fieldMask)
+			} else {
+				fmutils.Filter(profile, fieldMask)
+			}
+		}
+
+		blob, err := protojson.Marshal(profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode profile: %w", err)
+		}
+
+		result = append(result, blob)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,134 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/users"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func setup(t *testing.T) (*sql.DB, *app.Providers) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), "idm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(ctx, db)
+	require.NoError(t, err)
+
+	ds := repo.New(db)
+
+	phones := map[string]string{
+		"alice": "+43 664 1000",
+		"bob":   "+43 664 2000",
+	}
+
+	for _, u := range []repo.CreateUserParams{
+		{ID: "alice", Username: "alice", DisplayName: "Alice", FirstName: "Alice", LastName: "Smith"},
+		{ID: "bob", Username: "bob", DisplayName: "Bob", FirstName: "Robert", LastName: "Miller"},
+	} {
+		_, err := ds.CreateUser(ctx, u)
+		require.NoError(t, err)
+
+		_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: u.ID + "-work", UserID: u.ID, Address: u.ID + "@example.com", IsPrimary: true})
+		require.NoError(t, err)
+
+		_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: u.ID + "-home", UserID: u.ID, Address: u.ID + "@private.org"})
+		require.NoError(t, err)
+
+		_, err = ds.CreateUserPhoneNumber(ctx, repo.CreateUserPhoneNumberParams{ID: u.ID + "-phone", UserID: u.ID, PhoneNumber: phones[u.ID]})
+		require.NoError(t, err)
+
+		_, err = ds.CreateUserAddress(ctx, repo.CreateUserAddressParams{ID: u.ID + "-address", UserID: u.ID, CityCode: "3100", CityName: "St. Pölten", Street: u.ID + " street 1"})
+		require.NoError(t, err)
+	}
+
+	return db, &app.Providers{Datastore: ds}
+}
+
+func asUser(id string, roles ...string) context.Context {
+	return middleware.ContextWithClaims(context.Background(), &jwt.Claims{
+		Subject: id,
+		AppMetadata: &jwt.AppMetadata{
+			Authorization: &jwt.Authorization{Roles: roles},
+		},
+	})
+}
+
+func decodeProfiles(t *testing.T, blobs []json.RawMessage) map[string]*idmv1.Profile {
+	t.Helper()
+
+	profiles := make(map[string]*idmv1.Profile)
+	for _, blob := range blobs {
+		profile := new(idmv1.Profile)
+		require.NoError(t, protojson.Unmarshal(blob, profile))
+
+		profiles[profile.User.Id] = profile
+	}
+
+	return profiles
+}
+
+func Test_ListUsersPage_Privacy(t *testing.T) {
+	_, providers := setup(t)
+
+	svc, err := users.NewService(providers)
+	require.NoError(t, err)
+
+	list := func(ctx context.Context, req *users.ListUsersRequest) map[string]*idmv1.Profile {
+		res, err := svc.ListUsersPage(ctx, req)
+		require.NoError(t, err)
+
+		return decodeProfiles(t, res.Users)
+	}
+
+	// a plain user only sees the public fields of other users
+	profiles := list(asUser("alice"), &users.ListUsersRequest{})
+	require.Len(t, profiles, 2)
+
+	bob := profiles["bob"]
+	assert.Empty(t, bob.PhoneNumbers)
+	assert.Empty(t, bob.Addresses)
+	assert.Empty(t, bob.EmailAddresses)
+	assert.Empty(t, bob.User.FirstName)
+	assert.Equal(t, "bob", bob.User.Username)
+
+	alice := profiles["alice"]
+	assert.Len(t, alice.PhoneNumbers, 1)
+	assert.Len(t, alice.Addresses, 1)
+	assert.Len(t, alice.EmailAddresses, 2)
+
+	// and cannot probe private e-mail addresses or sort by hidden fields
+	profiles = list(asUser("alice"), &users.ListUsersRequest{Email: "bob@private.org"})
+	assert.Empty(t, profiles)
+
+	profiles = list(asUser("alice"), &users.ListUsersRequest{Email: "bob@example.com"})
+	assert.Len(t, profiles, 1)
+
+	_, err = svc.ListUsersPage(asUser("alice"), &users.ListUsersRequest{SortBy: "first_name"})
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+	// user managers see everything
+	profiles = list(asUser("carol", "idm_user_manager"), &users.ListUsersRequest{Email: "bob@private.org", SortBy: "first_name"})
+	require.Len(t, profiles, 1)
+
+	bob = profiles["bob"]
+	assert.Len(t, bob.PhoneNumbers, 1)
+	assert.Len(t, bob.Addresses, 1)
+	assert.Equal(t, "Robert", bob.User.FirstName)
+}
@@ -0,0 +1,491 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/jwt"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/permission"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// CheckPermissionProcedure is the HTTP path of the CheckPermission
+	// endpoint.
+	CheckPermissionProcedure = "/" + ServiceName + "/CheckPermission"
+
+	// BatchCheckPermissionsProcedure is the HTTP path of the
+	// BatchCheckPermissions endpoint.
+	BatchCheckPermissionsProcedure = "/" + ServiceName + "/BatchCheckPermissions"
+)
+
+// PermissionCheckPermissions allows checking the permissions of other users
+// and their API tokens, for example by services that authorize requests of
+// their own users.
+const PermissionCheckPermissions = "idm:permissions:check"
+
+// Kinds of role sources.
+const (
+	RoleSourceUser  = "user"
+	RoleSourceGroup = "group"
+	RoleSourceToken = "token"
+)
+
+// Effects of a permission match.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// CheckPermissionRequest is the request message for the CheckPermission
+// endpoint. At most one of UserID and TokenID may be set, if both are empty
+// the permission of the calling user is checked.
+type CheckPermissionRequest struct {
+	UserID     string `json:"userId,omitempty"`
+	TokenID    string `json:"tokenId,omitempty"`
+	Permission string `json:"permission"`
+}
+
+// BatchCheckPermissionsRequest is the request message for the
+// BatchCheckPermissions endpoint.
+type BatchCheckPermissionsRequest struct {
+	UserID      string   `json:"userId,omitempty"`
+	TokenID     string   `json:"tokenId,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleSource describes why a subject has a role.
+type RoleSource struct {
+	// Kind is one of "user", "group" or "token".
+	Kind string `json:"kind"`
+
+	// GroupID and GroupName are set if the role is assigned to a group of
+	// the user.
+	GroupID   string `json:"groupId,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
+
+	// TokenID is set if the role is assigned to the API token.
+	TokenID string `json:"tokenId,omitempty"`
+
+	// ViaRoleID and ViaRoleName are set if the role is included by the
+	// assigned role.
+	ViaRoleID   string `json:"viaRoleId,omitempty"`
+	ViaRoleName string `json:"viaRoleName,omitempty"`
+
+	// ValidUntil is set if the assignment is time-bound.
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// PermissionMatch is a role permission that matches the checked permission.
+type PermissionMatch struct {
+	// Effect is either "allow" or "deny".
+	Effect string `json:"effect"`
+
+	// Permission is the permission as assigned to the role.
+	Permission string       `json:"permission"`
+	RoleID     string       `json:"roleId"`
+	RoleName   string       `json:"roleName"`
+	Sources    []RoleSource `json:"sources"`
+}
+
+// CheckPermissionResponse is the response message for the CheckPermission
+// endpoint.
+type CheckPermissionResponse struct {
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+
+	// Reason is a human readable summary of the decision.
+	Reason string `json:"reason"`
+
+	// Matches holds all role permissions that allow or deny Permission.
+	Matches []PermissionMatch `json:"matches"`
+}
+
+// BatchCheckPermissionsResponse is the response message for the
+// BatchCheckPermissions endpoint. Results are in the order of the
+// requested permissions.
+type BatchCheckPermissionsResponse struct {
+	Results []CheckPermissionResponse `json:"results"`
+}
+
+// subjectRole is an effective role of a subject together with all sources
+// the role originates from.
+type subjectRole struct {
+	role        repo.Role
+	permissions []string
+	sources     []RoleSource
+}
+
+// permissionSubject holds the effective roles of a user or API token.
+type permissionSubject struct {
+	roles []*subjectRole
+
+	// reason is set if the subject cannot have any permissions, for
+	// example because the API token expired.
+	reason string
+}
+
+// CheckPermission checks whether a user or API token has a permission and
+// explains which roles allowed or denied it.
+func (svc *Service) CheckPermission(ctx context.Context, req *CheckPermissionRequest) (*CheckPermissionResponse, error) {
+	res, err := svc.BatchCheckPermissions(ctx, &BatchCheckPermissionsRequest{
+		UserID:      req.UserID,
+		TokenID:     req.TokenID,
+		Permissions: []string{req.Permission},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Results[0], nil
+}
+
+// BatchCheckPermissions checks multiple permissions of a user or API token
+// at once. Users may check their own permissions and those of their API
+// tokens, everything else requires the idm:permissions:check permission or
+// the idm_superuser role.
+func (svc *Service) BatchCheckPermissions(ctx context.Context, req *BatchCheckPermissionsRequest) (*BatchCheckPermissionsResponse, error) {
+	claims := middleware.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("no access token provided"))
+	}
+
+	if req.UserID != "" && req.TokenID != "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("only one of userId and tokenId may be set"))
+	}
+
+	if len(req.Permissions) == 0 || slices.Contains(req.Permissions, "") {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("no permission specified"))
+	}
+
+	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*BatchCheckPermissionsResponse, error) {
+		var (
+			subject *permissionSubject
+			err     error
+		)
+
+		// mayCheckOthers reports whether the caller may check the
+		// permissions of other users and their API tokens.
+		mayCheckOthers := func() (bool, error) {
+			return svc.callerHasPermission(ctx, tx, claims, PermissionCheckPermissions)
+		}
+
+		if req.TokenID != "" {
+			token, err := tx.GetAPITokenByID(ctx, req.TokenID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("api token not found"))
+				}
+
+				return nil, err
+			}
+
+			if token.UserID != claims.Subject {
+				ok, err := mayCheckOthers()
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you may only check the permissions of your own api tokens"))
+				}
+			}
+
+			subject, err = loadTokenSubject(ctx, tx, token)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			userID := req.UserID
+			if userID == "" {
+				userID = claims.Subject
+			}
+
+			if userID != claims.Subject {
+				ok, err := mayCheckOthers()
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you may only check your own permissions"))
+				}
+			}
+
+			if _, err := tx.GetUserByID(ctx, userID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
+				}
+
+				return nil, err
+			}
+
+			subject, err = loadUserSubject(ctx, tx, userID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resolver := svc.Config.PermissionTree()
+
+		var all []string
+		for _, r := range subject.roles {
+			all = append(all, r.permissions...)
+		}
+
+		resolved, err := resolver.Resolve(all)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+		}
+
+		res := &BatchCheckPermissionsResponse{
+			Results: make([]CheckPermissionResponse, 0, len(req.Permissions)),
+		}
+
+		for _, perm := range req.Permissions {
+			result, err := subject.check(resolver, resolved, perm)
+			if err != nil {
+				return nil, err
+			}
+
+			res.Results = append(res.Results, result)
+		}
+
+		return res, nil
+	}, repo.ReadOnly())
+}
+
+// callerHasPermission reports whether the roles of the calling user or API
+// token grant perm. Superusers are always permitted.
+func (svc *Service) callerHasPermission(ctx context.Context, tx *repo.Queries, claims *jwt.Claims, perm string) (bool, error) {
+	if claims.AppMetadata == nil || claims.AppMetadata.Authorization == nil {
+		return false, nil
+	}
+
+	roles := claims.AppMetadata.Authorization.Roles
+	if slices.Contains(roles, "idm_superuser") {
+		return true, nil
+	}
+
+	var permissions []string
+	for _, roleID := range roles {
+		rolePerms, err := tx.GetRolePermissions(ctx, roleID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get role permissions: %w", err)
+		}
+
+		permissions = append(permissions, rolePerms...)
+	}
+
+	resolved, err := svc.Config.PermissionTree().Resolve(permissions)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve role permissions: %w", err)
+	}
+
+	return permission.Matches(resolved, perm), nil
+}
+
+func (s *permissionSubject) check(resolver permission.Resolver, resolved []string, perm string) (CheckPermissionResponse, error) {
+	result := CheckPermissionResponse{
+		Permission: perm,
+		Allowed:    permission.Matches(resolved, perm),
+		Matches:    []PermissionMatch{},
+	}
+
+	var allowedBy, deniedBy []string
+
+	for _, r := range s.roles {
+		for _, p := range r.permissions {
+			match := PermissionMatch{
+				Permission: p,
+				RoleID:     r.role.ID,
+				RoleName:   r.role.Name,
+				Sources:    r.sources,
+			}
+
+			if permission.IsDeny(p) {
+				if !permission.Matches([]string{p[len(permission.DenyPrefix):]}, perm) {
+					continue
+				}
+
+				match.Effect = EffectDeny
+				deniedBy = append(deniedBy, fmt.Sprintf("%q of role %q", p, r.role.Name))
+			} else {
+				set, err := resolver.Resolve([]string{p})
+				if err != nil {
+					return result, fmt.Errorf("failed to resolve permission %q: %w", p, err)
+				}
+
+				if !permission.Matches(set, perm) {
+					continue
+				}
+
+				match.Effect = EffectAllow
+				allowedBy = append(allowedBy, fmt.Sprintf("%q of role %q", p, r.role.Name))
+			}
+
+			result.Matches = append(result.Matches, match)
+		}
+	}
+
+	switch {
+	case s.reason != "":
+		result.Reason = s.reason
+	case result.Allowed:
+		result.Reason = "allowed by " + strings.Join(allowedBy, ", ")
+	case len(deniedBy) > 0:
+		result.Reason = "denied by " + strings.Join(deniedBy, ", ")
+	default:
+		result.Reason = "no role grants the permission"
+	}
+
+	return result, nil
+}
+
+// add records the base role and all roles included by it as effective
+// roles originating from src.
+func (s *permissionSubject) add(ctx context.Context, tx *repo.Queries, base repo.Role, src RoleSource) error {
+	effective, err := tx.GetEffectiveRolesForRole(ctx, base.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get roles included by %q: %w", base.ID, err)
+	}
+
+	for _, r := range effective {
+		source := src
+		if r.ID != base.ID {
+			source.ViaRoleID = base.ID
+			source.ViaRoleName = base.Name
+		}
+
+		idx := slices.IndexFunc(s.roles, func(sr *subjectRole) bool { return sr.role.ID == r.ID })
+		if idx < 0 {
+			s.roles = append(s.roles, &subjectRole{role: r})
+			idx = len(s.roles) - 1
+		}
+
+		s.roles[idx].sources = append(s.roles[idx].sources, source)
+	}
+
+	return nil
+}
+
+// finish drops all roles that are not part of effective and loads the
+// permissions of the remaining roles.
+func (s *permissionSubject) finish(ctx context.Context, tx *repo.Queries, effective []repo.Role) error {
+	s.roles = slices.DeleteFunc(s.roles, func(sr *subjectRole) bool {
+		return !slices.ContainsFunc(effective, func(r repo.Role) bool { return r.ID == sr.role.ID })
+	})
+
+	sort.Slice(s.roles, func(i, j int) bool { return s.roles[i].role.Name < s.roles[j].role.Name })
+
+	for _, r := range s.roles {
+		perms, err := tx.GetRolePermissions(ctx, r.role.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get role permissions: %w", err)
+		}
+
+		r.permissions = perms
+	}
+
+	return nil
+}
+
+func loadUserSubject(ctx context.Context, tx *repo.Queries, userID string) (*permissionSubject, error) {
+	subject := new(permissionSubject)
+
+	assignments, err := tx.GetRoleAssignmentsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role assignments: %w", err)
+	}
+
+	now := time.Now()
+	for _, a := range assignments {
+		if (a.ValidFrom.Valid && a.ValidFrom.Time.After(now)) || (a.ValidUntil.Valid && !a.ValidUntil.Time.After(now)) {
+			continue
+		}
+
+		role, err := tx.GetRoleByID(ctx, a.RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role %q: %w", a.RoleID, err)
+		}
+
+		src := RoleSource{Kind: RoleSourceUser}
+		if a.ValidUntil.Valid {
+			src.ValidUntil = &a.ValidUntil.Time
+		}
+
+		if err := subject.add(ctx, tx, role, src); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := tx.GetEffectiveGroupsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	for _, g := range groups {
+		roles, err := tx.GetGroupRoles(ctx, g.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get roles of group %q: %w", g.ID, err)
+		}
+
+		for _, r := range roles {
+			if err := subject.add(ctx, tx, r, RoleSource{Kind: RoleSourceGroup, GroupID: g.ID, GroupName: g.Name}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	effective, err := tx.GetEffectiveRolesForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	if err := subject.finish(ctx, tx, effective); err != nil {
+		return nil, err
+	}
+
+	return subject, nil
+}
+
+func loadTokenSubject(ctx context.Context, tx *repo.Queries, token repo.UserApiToken) (*permissionSubject, error) {
+	subject := new(permissionSubject)
+
+	if token.ExpiresAt.Valid && !token.ExpiresAt.Time.After(time.Now()) {
+		subject.reason = "the api token has expired"
+
+		return subject, nil
+	}
+
+	roles, err := tx.GetRolesForToken(ctx, token.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token roles: %w", err)
+	}
+
+	for _, r := range roles {
+		if err := subject.add(ctx, tx, r, RoleSource{Kind: RoleSourceToken, TokenID: token.ID}); err != nil {
+			return nil, err
+		}
+	}
+
+	// token roles are limited to the roles the owner still holds.
+	effective, err := tx.GetEffectiveRolesForToken(ctx, token.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token roles: %w", err)
+	}
+
+	if err := subject.finish(ctx, tx, effective); err != nil {
+		return nil, err
+	}
+
+	return subject, nil
+}
@@ -0,0 +1,102 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// SearchUsersProcedure is the HTTP path of the SearchUsers endpoint.
+const SearchUsersProcedure = "/" + ServiceName + "/SearchUsers"
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchUsersRequest is the request message for the SearchUsers endpoint.
+type SearchUsersRequest struct {
+	// Query is split into words which must all match the start of a word in
+	// the username, the names, e-mail addresses, phone numbers or searchable
+	// extra data fields of a user. Unless the caller has the idm_superuser or
+	// idm_user_manager role, only the display name, the primary e-mail
+	// address and the primary phone number are searched.
+	Query string `json:"query"`
+
+	// PageSize limits the number of users returned and defaults to 20.
+	PageSize int `json:"pageSize,omitempty"`
+
+	// FieldMask and ExcludeFields work like in tkd.idm.v1.ListUsersRequest
+	// but apply to each profile.
+	FieldMask     []string `json:"fieldMask,omitempty"`
+	ExcludeFields bool     `json:"excludeFields,omitempty"`
+}
+
+// SearchUsersResponse is the response message for the SearchUsers endpoint.
+// Users are encoded like tkd.idm.v1.Profile, best matches first.
+type SearchUsersResponse struct {
+	Users []json.RawMessage `json:"users"`
+}
+
+// SearchUsers searches active users using the full-text index. Only fields
+// that are visible to the caller are searched and returned.
+func (svc *Service) SearchUsers(ctx context.Context, req *SearchUsersRequest) (*SearchUsersResponse, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing query"))
+	}
+
+	limit := req.PageSize
+	switch {
+	case limit <= 0:
+		limit = defaultSearchLimit
+	case limit > maxSearchLimit:
+		limit = maxSearchLimit
+	}
+
+	ids, err := svc.Providers.SearchUsers(ctx, req.Query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	res := &SearchUsersResponse{
+		Users: make([]json.RawMessage, 0, len(ids)),
+	}
+
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	users, err := svc.Datastore.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	// restore the order of the search results.
+	byID := make(map[string]repo.User, len(users))
+	for _, usr := range users {
+		byID[usr.ID] = usr
+	}
+
+	users = users[:0]
+	for _, id := range ids {
+		if usr, ok := byID[id]; ok {
+			users = append(users, usr)
+		}
+	}
+
+	profiles, err := svc.GetUserProfileProtos(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Users, err = encodeProfiles(ctx, profiles, req.FieldMask, req.ExcludeFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
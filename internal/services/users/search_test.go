@@ -0,0 +1,62 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/search"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/users"
+)
+
+func Test_SearchUsers_Privacy(t *testing.T) {
+	ctx := context.Background()
+
+	db, providers := setup(t)
+
+	idx, err := search.New(ctx, db, providers.Datastore, changes.NewFeed(providers.Datastore, time.Hour), providers.Config)
+	require.NoError(t, err)
+
+	_, err = idx.Rebuild(ctx)
+	require.NoError(t, err)
+
+	providers.Search = idx
+
+	svc, err := users.NewService(providers)
+	require.NoError(t, err)
+
+	find := func(ctx context.Context, query string) []string {
+		res, err := svc.SearchUsers(ctx, &users.SearchUsersRequest{Query: query})
+		require.NoError(t, err)
+
+		var ids []string
+		for id := range decodeProfiles(t, res.Users) {
+			ids = append(ids, id)
+		}
+
+		return ids
+	}
+
+	// a plain user can not find others by private fields
+	assert.Empty(t, find(asUser("alice"), "bob@private.org"))
+	assert.Empty(t, find(asUser("alice"), "Robert"))
+	assert.Empty(t, find(asUser("alice"), "2000"))
+	assert.Equal(t, []string{"bob"}, find(asUser("alice"), "bob@example.com"))
+
+	res, err := svc.SearchUsers(asUser("alice"), &users.SearchUsersRequest{Query: "bob"})
+	require.NoError(t, err)
+
+	bob := decodeProfiles(t, res.Users)["bob"]
+	require.NotNil(t, bob)
+	assert.Empty(t, bob.PhoneNumbers)
+	assert.Empty(t, bob.Addresses)
+	assert.Empty(t, bob.EmailAddresses)
+
+	// user managers can
+	assert.Equal(t, []string{"bob"}, find(asUser("carol", "idm_user_manager"), "bob@private.org"))
+	assert.Equal(t, []string{"bob"}, find(asUser("carol", "idm_user_manager"), "Robert"))
+	assert.Equal(t, []string{"bob"}, find(asUser("carol", "idm_user_manager"), "2000"))
+}
@@ -18,14 +18,16 @@ import (
 	"github.com/mennanov/fmutils"
 	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1/idmv1connect"
-	"github.com/tierklinik-dobersberg/apis/pkg/data"
 	"github.com/tierklinik-dobersberg/apis/pkg/log"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/app"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/audit"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/common"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/mailer"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/tmpl"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -51,7 +53,7 @@ func (svc *Service) Impersonate(ctx context.Context, req *connect.Request[idmv1.
 		}
 	}
 
-	roles, err := svc.Datastore.GetRolesForUser(ctx, user.ID)
+	roles, err := svc.Datastore.GetEffectiveRolesForUser(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +61,7 @@ func (svc *Service) Impersonate(ctx context.Context, req *connect.Request[idmv1.
 	tokenMessage := &idmv1.ImpersonateResponse{}
 	res := connect.NewResponse(tokenMessage)
 
-	token, _, err := svc.AddAccessToken(user, roles, svc.Config.AccessTTL(), "", "impersonate", res.Header())
+	token, _, err := svc.AddAccessToken(ctx, user, roles, svc.Config.AccessTTL(), "", "impersonate", res.Header())
 	if err != nil {
 		return nil, err
 	}
@@ -74,32 +76,27 @@ func (svc *Service) Impersonate(ctx context.Context, req *connect.Request[idmv1.
 }
 
 func (svc *Service) ListUsers(ctx context.Context, req *connect.Request[idmv1.ListUsersRequest]) (*connect.Response[idmv1.ListUsersResponse], error) {
-	users, err := svc.Datastore.GetAllUsers(ctx)
-	if err != nil {
-		return nil, err
+	params := repo.ListUsersPageParams{
+		RoleIDs: req.Msg.FilterByRoles,
 	}
 
-	res := &idmv1.ListUsersResponse{}
-	for _, usr := range users {
-		// skip deleted users if not explicitly requested.
-		if req.Msg.ExcludeDeleted && usr.Deleted {
-			continue
-		}
+	// skip deleted users if not explicitly requested.
+	if req.Msg.ExcludeDeleted {
+		params.Deleted = sql.NullBool{Bool: false, Valid: true}
+	}
 
-		profileProto, err := svc.GetUserProfileProto(ctx, usr)
-		if err != nil {
-			log.L(ctx).Error("failed to get user profile", "userId", usr.ID, "error", err)
-		}
+	users, err := svc.Datastore.ListUsersPage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
 
-		if len(req.Msg.FilterByRoles) > 0 {
-			if !data.ElemInBothSlicesFunc(req.Msg.FilterByRoles, profileProto.Roles, func(role *idmv1.Role) string {
-				return role.Id
-			}) {
-				continue
-			}
-		}
+	profiles, err := svc.GetUserProfileProtos(ctx, users)
+	if err != nil {
+		return nil, err
+	}
 
-		res.Users = append(res.Users, profileProto)
+	res := &idmv1.ListUsersResponse{
+		Users: profiles,
 	}
 
 	// make sure we only include fields that are requested
@@ -126,7 +123,7 @@ func (svc *Service) ListUsers(ctx context.Context, req *connect.Request[idmv1.Li
 }
 
 func (svc *Service) SetUserPassword(ctx context.Context, req *connect.Request[idmv1.SetUserPasswordRequest]) (*connect.Response[idmv1.SetUserPasswordResponse], error) {
-	_, err := svc.Datastore.GetUserByID(ctx, req.Msg.UserId)
+	user, err := svc.Datastore.GetUserByID(ctx, req.Msg.UserId)
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +142,16 @@ func (svc *Service) SetUserPassword(ctx context.Context, req *connect.Request[id
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
 	}
 
+	var changedBy string
+	if claims := middleware.ClaimsFromContext(ctx); claims != nil {
+		changedBy = claims.Subject
+	}
+
+	svc.Webhooks.Emit(ctx, webhook.PasswordChanged, webhook.PasswordChangedData{
+		UserID:    user.ID,
+		ChangedBy: changedBy,
+	})
+
 	return connect.NewResponse(new(idmv1.SetUserPasswordResponse)), nil
 }
 
@@ -199,12 +206,23 @@ func (svc *Service) DeleteUser(ctx context.Context, req *connect.Request[idmv1.D
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("no jwt claims associated with request context"))
 	}
 
-	// make sure users just cannot directly delete their own profile.
-	// TODO(ppacher): add support to "request profile deletion"
+	// make sure users just cannot directly delete their own profile. They
+	// need to request the erasure of their account instead.
 	if claims.Subject == req.Msg.Id {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("deleting your own account is not allowed"))
 	}
 
+	audit.SetTarget(ctx, audit.TargetUser, req.Msg.Id)
+
+	before, err := svc.Datastore.GetUserByID(ctx, req.Msg.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user %q not found", req.Msg.Id))
+		}
+
+		return nil, err
+	}
+
 	// actually delete the user from the repository
 	rows, err := svc.Datastore.DeleteUser(ctx, req.Msg.Id)
 	if err != nil {
@@ -215,6 +233,11 @@ func (svc *Service) DeleteUser(ctx context.Context, req *connect.Request[idmv1.D
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
 	}
 
+	audit.RecordChange(ctx, before, nil)
+
+	svc.EmitUserEvent(ctx, webhook.UserDeleted, before)
+	svc.Changes.Publish(ctx, changes.UserDeleted, before.ID, "", changes.UserData{Username: before.Username})
+
 	// TODO(ppacher): invalidate all current access and refresh tokens
 
 	return connect.NewResponse(&idmv1.DeleteUserResponse{}), nil
@@ -278,7 +301,7 @@ func (svc *Service) CreateUser(ctx context.Context, req *connect.Request[idmv1.C
 		}
 	}
 
-	return repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.CreateUserResponse], error) {
+	res, err := repo.RunInTransaction(ctx, svc.Datastore, func(tx *repo.Queries) (*connect.Response[idmv1.CreateUserResponse], error) {
 
 		// actually create the user.
 		userModel, err := tx.CreateUser(ctx, repo.CreateUserParams{
@@ -365,27 +388,33 @@ func (svc *Service) CreateUser(ctx context.Context, req *connect.Request[idmv1.C
 		}
 
 		// assign the user to all roles specified in the request.
-		for _, role := range req.Msg.GetProfile().GetRoles() {
-			err = errors.New("")
+		if err := svc.Constraints.Enforce(ctx, tx, func() error {
+			for _, role := range req.Msg.GetProfile().GetRoles() {
+				err = errors.New("")
 
-			if role.Id != "" {
-				_, err = tx.GetRoleByID(ctx, role.Id)
-			}
+				if role.Id != "" {
+					_, err = tx.GetRoleByID(ctx, role.Id)
+				}
 
-			if err != nil || role.Id == "" {
-				roleModel, err := tx.GetRoleByName(ctx, role.Name)
-				if err != nil {
-					merr.Errors = append(merr.Errors, fmt.Errorf("role %q", role.Id))
+				if err != nil || role.Id == "" {
+					roleModel, err := tx.GetRoleByName(ctx, role.Name)
+					if err != nil {
+						merr.Errors = append(merr.Errors, fmt.Errorf("role %q", role.Id))
 
-					continue
+						continue
+					}
+
+					role.Id = roleModel.ID
 				}
 
-				role.Id = roleModel.ID
+				if err := tx.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: userModel.ID, RoleID: role.Id}); err != nil {
+					merr.Errors = append(merr.Errors, fmt.Errorf("failed to assigne user %q to role %q", userModel.ID, role.Id))
+				}
 			}
 
-			if err := tx.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: userModel.ID, RoleID: role.Id}); err != nil {
-				merr.Errors = append(merr.Errors, fmt.Errorf("failed to assigne user %q to role %q", userModel.ID, role.Id))
-			}
+			return nil
+		}); err != nil {
+			return nil, err
 		}
 
 		if err := merr.ErrorOrNil(); err != nil {
@@ -397,10 +426,24 @@ func (svc *Service) CreateUser(ctx context.Context, req *connect.Request[idmv1.C
 			return nil, err
 		}
 
+		audit.SetTarget(ctx, audit.TargetUser, userModel.ID)
+		audit.RecordChange(ctx, nil, profile)
+
 		return connect.NewResponse(&idmv1.CreateUserResponse{
 			Profile: profile,
 		}), nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	svc.Webhooks.Emit(ctx, webhook.UserCreated, webhook.NewUserData(res.Msg.Profile.GetUser().GetId(), res.Msg.Profile))
+	svc.PublishUserCreated(ctx, repo.User{
+		ID:       res.Msg.Profile.GetUser().GetId(),
+		Username: res.Msg.Profile.GetUser().GetUsername(),
+	})
+
+	return res, nil
 }
 
 func (svc *Service) UpdateUser(ctx context.Context, req *connect.Request[idmv1.UpdateUserRequest]) (*connect.Response[idmv1.UpdateUserResponse], error) {
@@ -409,6 +452,8 @@ func (svc *Service) UpdateUser(ctx context.Context, req *connect.Request[idmv1.U
 		return nil, fmt.Errorf("failed to get user object: %w", err)
 	}
 
+	before := user
+
 	paths := req.Msg.GetFieldMask().GetPaths()
 	if len(paths) == 0 {
 		paths = []string{"username", "display_name", "first_name", "last_name", "avatar", "birthday"}
@@ -500,11 +545,16 @@ func (svc *Service) UpdateUser(ctx context.Context, req *connect.Request[idmv1.U
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to update user: %w", err))
 	}
 
+	audit.RecordChange(ctx, before, user)
+
 	profileProto, err := svc.GetUserProfileProto(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
+	svc.Webhooks.Emit(ctx, webhook.UserUpdated, webhook.NewUserData(user.ID, profileProto))
+	svc.Changes.Publish(ctx, changes.UserUpdated, user.ID, "", changes.UserData{Username: user.Username})
+
 	return connect.NewResponse(&idmv1.UpdateUserResponse{
 		Profile: profileProto,
 	}), nil
@@ -619,6 +669,9 @@ func (svc *Service) SetUserExtraKey(ctx context.Context, req *connect.Request[id
 		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
 	}
 
+	svc.EmitUserEvent(ctx, webhook.UserUpdated, usr)
+	svc.Changes.Publish(ctx, changes.UserUpdated, usr.ID, "", changes.UserData{Username: usr.Username})
+
 	return connect.NewResponse(&idmv1.SetUserExtraKeyResponse{}), nil
 }
 
@@ -635,7 +688,7 @@ func (svc *Service) DeleteUserExtraKey(ctx context.Context, req *connect.Request
 		}
 
 		rows, err := svc.Datastore.SetUserExtraData(ctx, repo.SetUserExtraDataParams{
-			Extra: "",
+			Extra: usr.Extra,
 			ID:    usr.ID,
 		})
 		if err != nil {
@@ -645,6 +698,9 @@ func (svc *Service) DeleteUserExtraKey(ctx context.Context, req *connect.Request
 		if rows == 0 {
 			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("user not found"))
 		}
+
+		svc.EmitUserEvent(ctx, webhook.UserUpdated, usr)
+		svc.Changes.Publish(ctx, changes.UserUpdated, usr.ID, "", changes.UserData{Username: usr.Username})
 	}
 
 	return connect.NewResponse(&idmv1.DeleteUserExtraKeyResponse{}), nil
@@ -724,7 +780,7 @@ func (svc *Service) ResolveUserPermissions(ctx context.Context, req *connect.Req
 			return nil, err
 		}
 
-		roles, err := tx.GetRolesForUser(ctx, user.ID)
+		roles, err := tx.GetEffectiveRolesForUser(ctx, user.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get user roles: %w", err)
 		}
@@ -0,0 +1,70 @@
+package users_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/services/users"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+func Test_DeleteUser(t *testing.T) {
+	_, providers := setup(t)
+
+	svc, err := users.NewService(providers)
+	require.NoError(t, err)
+
+	ctx := asUser("carol", "idm_user_manager")
+
+	_, err = svc.DeleteUser(ctx, connect.NewRequest(&idmv1.DeleteUserRequest{Id: "unknown"}))
+	assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+	_, err = svc.DeleteUser(ctx, connect.NewRequest(&idmv1.DeleteUserRequest{Id: "bob"}))
+	require.NoError(t, err)
+
+	usr, err := providers.Datastore.GetUserByID(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, usr.Deleted)
+}
+
+func Test_DeleteUserExtraKey(t *testing.T) {
+	_, providers := setup(t)
+
+	ctx := asUser("carol", "idm_user_manager")
+
+	_, err := providers.Datastore.SetUserExtraData(ctx, repo.SetUserExtraDataParams{ID: "bob", Extra: `{"team":"vets","room":"2"}`})
+	require.NoError(t, err)
+
+	providers.Webhooks = webhook.NewDispatcher(providers.Datastore, []*config.Webhook{{Name: "hook", URL: "http://localhost"}})
+
+	svc, err := users.NewService(providers)
+	require.NoError(t, err)
+
+	_, err = svc.DeleteUserExtraKey(ctx, connect.NewRequest(&idmv1.DeleteUserExtraKeyRequest{UserId: "bob", Path: "room"}))
+	require.NoError(t, err)
+
+	// only the given key is removed
+	usr, err := providers.Datastore.GetUserByID(ctx, "bob")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"team":"vets"}`, usr.Extra)
+
+	// and webhooks are notified about the update
+	deliveries, err := providers.Datastore.ListWebhookDeliveries(ctx, repo.ListWebhookDeliveriesParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, string(webhook.UserUpdated), deliveries[0].EventType)
+
+	var event webhook.Event
+	require.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &event))
+
+	var data webhook.UserData
+	require.NoError(t, json.Unmarshal(event.Data, &data))
+	assert.Equal(t, "bob", data.UserID)
+	assert.NotEmpty(t, data.Profile)
+}
@@ -2,6 +2,7 @@ package tmpl
 
 import (
 	"embed"
+	"time"
 
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
 )
@@ -60,6 +61,13 @@ type (
 		Name        string
 		Inviter     repo.User
 	}
+
+	RoleExpiryNoticeCtx struct {
+		BaseContext
+		User       repo.User
+		Role       repo.Role
+		ValidUntil time.Time
+	}
 )
 
 var (
@@ -92,4 +100,9 @@ var (
 		Name: "user_invitation",
 		Kind: KindMail,
 	}
+
+	RoleExpiryNotice = Known[*RoleExpiryNoticeCtx]{
+		Name: "role_expiry_notice",
+		Kind: KindMail,
+	}
 )
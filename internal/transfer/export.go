@@ -0,0 +1,255 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// ExportOptions configures which secrets are part of an export.
+type ExportOptions struct {
+	ExcludePasswords bool
+
+	// ExcludeTOTP also excludes MFA recovery codes.
+	ExcludeTOTP      bool
+	ExcludeWebAuthn  bool
+	ExcludeAPITokens bool
+}
+
+func (opts ExportOptions) excluded() []string {
+	var result []string
+
+	if opts.ExcludePasswords {
+		result = append(result, ExcludePasswords)
+	}
+	if opts.ExcludeTOTP {
+		result = append(result, ExcludeTOTP)
+	}
+	if opts.ExcludeWebAuthn {
+		result = append(result, ExcludeWebAuthn)
+	}
+	if opts.ExcludeAPITokens {
+		result = append(result, ExcludeAPITokens)
+	}
+
+	return result
+}
+
+// Export writes all roles and users stored in ds to w. The export is read
+// from a single read-only transaction so it is consistent even if userd is
+// serving requests.
+func Export(ctx context.Context, ds *repo.Queries, w io.Writer, opts ExportOptions) error {
+	_, err := repo.RunInTransaction(ctx, ds, func(tx *repo.Queries) (any, error) {
+		enc := json.NewEncoder(w)
+
+		header := &Header{
+			Version:   FormatVersion,
+			CreatedAt: time.Now().UTC(),
+			Excluded:  opts.excluded(),
+		}
+
+		if err := enc.Encode(Record{Type: RecordHeader, Header: header}); err != nil {
+			return nil, err
+		}
+
+		roles, err := tx.GetRoles(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load roles: %w", err)
+		}
+
+		for _, r := range roles {
+			role, err := exportRole(ctx, tx, r)
+			if err != nil {
+				return nil, fmt.Errorf("role %q: %w", r.Name, err)
+			}
+
+			if err := enc.Encode(Record{Type: RecordRole, Role: role}); err != nil {
+				return nil, err
+			}
+		}
+
+		users, err := tx.GetAllUsers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load users: %w", err)
+		}
+
+		for _, u := range users {
+			user, err := exportUser(ctx, tx, u, header)
+			if err != nil {
+				return nil, fmt.Errorf("user %q: %w", u.Username, err)
+			}
+
+			if err := enc.Encode(Record{Type: RecordUser, User: user}); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}, repo.ReadOnly())
+
+	return err
+}
+
+func exportRole(ctx context.Context, tx *repo.Queries, r repo.Role) (*Role, error) {
+	permissions, err := tx.GetRolePermissions(ctx, r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	included, err := tx.GetIncludedRoles(ctx, r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load included roles: %w", err)
+	}
+
+	var includes []string
+	for _, inc := range included {
+		includes = append(includes, inc.ID)
+	}
+
+	return &Role{
+		ID:              r.ID,
+		Name:            r.Name,
+		Description:     r.Description,
+		DeleteProtected: r.DeleteProtected,
+		Origin:          r.Origin,
+		Permissions:     permissions,
+		Includes:        includes,
+	}, nil
+}
+
+func exportUser(ctx context.Context, tx *repo.Queries, u repo.User, header *Header) (*User, error) {
+	user := &User{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Extra:       u.Extra,
+		Avatar:      u.Avatar,
+		Birthday:    u.Birthday,
+		Deleted:     u.Deleted,
+	}
+
+	if !header.Excludes(ExcludePasswords) {
+		user.PasswordHash = u.Password
+	}
+
+	if !header.Excludes(ExcludeTOTP) {
+		user.TOTPSecret = u.TotpSecret.String
+
+		codes, err := tx.LoadUserRecoveryCodes(ctx, u.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recovery codes: %w", err)
+		}
+
+		for _, c := range codes {
+			user.RecoveryCodes = append(user.RecoveryCodes, c.Code)
+		}
+	}
+
+	emails, err := tx.GetEmailsForUserByID(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails: %w", err)
+	}
+
+	for _, e := range emails {
+		user.Emails = append(user.Emails, Email{
+			ID:       e.ID,
+			Address:  e.Address,
+			Verified: e.Verified,
+			Primary:  e.IsPrimary,
+		})
+	}
+
+	phones, err := tx.GetPhoneNumbersByUserID(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load phone numbers: %w", err)
+	}
+
+	for _, p := range phones {
+		user.PhoneNumbers = append(user.PhoneNumbers, PhoneNumber{
+			ID:       p.ID,
+			Number:   p.PhoneNumber,
+			Verified: p.Verified,
+			Primary:  p.IsPrimary,
+		})
+	}
+
+	addresses, err := tx.GetUserAddresses(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load addresses: %w", err)
+	}
+
+	for _, a := range addresses {
+		user.Addresses = append(user.Addresses, Address{
+			ID:       a.ID,
+			CityCode: a.CityCode,
+			CityName: a.CityName,
+			Street:   a.Street,
+			Extra:    a.Extra,
+		})
+	}
+
+	roles, err := tx.GetRolesForUser(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	for _, r := range roles {
+		user.Roles = append(user.Roles, r.ID)
+	}
+
+	if !header.Excludes(ExcludeWebAuthn) {
+		creds, err := tx.GetWebauthnCreds(ctx, u.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load webauthn credentials: %w", err)
+		}
+
+		for _, c := range creds {
+			user.WebAuthnCredentials = append(user.WebAuthnCredentials, WebAuthnCredential{
+				ID:           c.ID,
+				Credential:   c.Cred,
+				Type:         c.CredType,
+				ClientName:   c.ClientName,
+				ClientOS:     c.ClientOs,
+				ClientDevice: c.ClientDevice,
+			})
+		}
+	}
+
+	if !header.Excludes(ExcludeAPITokens) {
+		tokens, err := tx.GetAPITokensForUser(ctx, u.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load api tokens: %w", err)
+		}
+
+		for _, t := range tokens {
+			token := APIToken{
+				ID:    t.ID,
+				Token: t.Token,
+				Name:  t.Name,
+			}
+
+			if t.ExpiresAt.Valid {
+				token.ExpiresAt = &t.ExpiresAt.Time
+			}
+
+			tokenRoles, err := tx.GetRolesForToken(ctx, t.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load roles for api token %q: %w", t.Name, err)
+			}
+
+			for _, r := range tokenRoles {
+				token.Roles = append(token.Roles, r.ID)
+			}
+
+			user.APITokens = append(user.APITokens, token)
+		}
+	}
+
+	return user, nil
+}
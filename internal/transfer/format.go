@@ -0,0 +1,152 @@
+// Package transfer exports users and roles of an instance to a portable,
+// versioned NDJSON format and imports them into another instance.
+//
+// An export starts with a header record followed by all roles and then all
+// users. Each line holds exactly one record. Users reference roles by ID,
+// roles that do not exist by ID in the target instance are matched by
+// name.
+package transfer
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// FormatVersion is the version of the export format written by Export.
+const FormatVersion = 1
+
+// Record types.
+const (
+	RecordHeader = "header"
+	RecordRole   = "role"
+	RecordUser   = "user"
+)
+
+// Secret categories that can be excluded from an export.
+const (
+	ExcludePasswords = "passwords"
+	ExcludeTOTP      = "totp"
+	ExcludeWebAuthn  = "webauthn"
+	ExcludeAPITokens = "api_tokens"
+)
+
+// SecretCategories lists all categories that can be excluded.
+var SecretCategories = []string{
+	ExcludePasswords,
+	ExcludeTOTP,
+	ExcludeWebAuthn,
+	ExcludeAPITokens,
+}
+
+// Record is a single line of an export.
+type Record struct {
+	Type   string  `json:"type"`
+	Header *Header `json:"header,omitempty"`
+	Role   *Role   `json:"role,omitempty"`
+	User   *User   `json:"user,omitempty"`
+}
+
+// Header describes an export.
+type Header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Excluded lists the secret categories that are not part of the
+	// export. They are left untouched when importing.
+	Excluded []string `json:"excluded,omitempty"`
+}
+
+// Excludes returns true if category is not part of the export.
+func (h *Header) Excludes(category string) bool {
+	return slices.Contains(h.Excluded, category)
+}
+
+func (h *Header) validate() error {
+	if h.Version != FormatVersion {
+		return fmt.Errorf("unsupported export version %d, expected %d", h.Version, FormatVersion)
+	}
+
+	for _, c := range h.Excluded {
+		if !slices.Contains(SecretCategories, c) {
+			return fmt.Errorf("unsupported secret category %q", c)
+		}
+	}
+
+	return nil
+}
+
+type Role struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description,omitempty"`
+	DeleteProtected bool     `json:"deleteProtected,omitempty"`
+	Origin          string   `json:"origin,omitempty"`
+	Permissions     []string `json:"permissions,omitempty"`
+
+	// Includes holds the exported IDs of all roles directly included by
+	// the role.
+	Includes []string `json:"includes,omitempty"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName,omitempty"`
+	FirstName   string `json:"firstName,omitempty"`
+	LastName    string `json:"lastName,omitempty"`
+	Extra       string `json:"extra,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+	Birthday    string `json:"birthday,omitempty"`
+	Deleted     bool   `json:"deleted,omitempty"`
+
+	PasswordHash  string   `json:"passwordHash,omitempty"`
+	TOTPSecret    string   `json:"totpSecret,omitempty"`
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+
+	Emails              []Email              `json:"emails,omitempty"`
+	PhoneNumbers        []PhoneNumber        `json:"phoneNumbers,omitempty"`
+	Addresses           []Address            `json:"addresses,omitempty"`
+	Roles               []string             `json:"roles,omitempty"`
+	WebAuthnCredentials []WebAuthnCredential `json:"webauthnCredentials,omitempty"`
+	APITokens           []APIToken           `json:"apiTokens,omitempty"`
+}
+
+type Email struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Verified bool   `json:"verified,omitempty"`
+	Primary  bool   `json:"primary,omitempty"`
+}
+
+type PhoneNumber struct {
+	ID       string `json:"id"`
+	Number   string `json:"number"`
+	Verified bool   `json:"verified,omitempty"`
+	Primary  bool   `json:"primary,omitempty"`
+}
+
+type Address struct {
+	ID       string `json:"id"`
+	CityCode string `json:"cityCode,omitempty"`
+	CityName string `json:"cityName,omitempty"`
+	Street   string `json:"street,omitempty"`
+	Extra    string `json:"extra,omitempty"`
+}
+
+type WebAuthnCredential struct {
+	ID           string `json:"id"`
+	Credential   string `json:"credential"`
+	Type         string `json:"type"`
+	ClientName   string `json:"clientName,omitempty"`
+	ClientOS     string `json:"clientOs,omitempty"`
+	ClientDevice string `json:"clientDevice,omitempty"`
+}
+
+type APIToken struct {
+	ID        string     `json:"id"`
+	Token     string     `json:"token"`
+	Name      string     `json:"name,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Roles     []string   `json:"roles,omitempty"`
+}
@@ -0,0 +1,616 @@
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/constraints"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+// Strategy defines how users and roles that already exist in the target
+// instance are handled.
+type Strategy string
+
+const (
+	// StrategySkip leaves existing users and roles untouched.
+	StrategySkip Strategy = "skip"
+
+	// StrategyOverwrite replaces existing users and roles with the imported
+	// ones, including their e-mails, phone numbers, addresses, role
+	// assignments and secrets.
+	StrategyOverwrite Strategy = "overwrite"
+
+	// StrategyMerge only fills empty fields and adds missing e-mails, phone
+	// numbers, addresses, role assignments and secrets.
+	StrategyMerge Strategy = "merge"
+)
+
+// ParseStrategy parses a conflict strategy.
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(strings.ToLower(s)); st {
+	case StrategySkip, StrategyOverwrite, StrategyMerge:
+		return st, nil
+	}
+
+	return "", fmt.Errorf("unsupported conflict strategy %q, expected one of skip, overwrite or merge", s)
+}
+
+// Result describes what happened to an imported user or role.
+type Result string
+
+const (
+	ResultCreated   Result = "created"
+	ResultUpdated   Result = "updated"
+	ResultUnchanged Result = "unchanged"
+	ResultSkipped   Result = "skipped"
+)
+
+// Action is a single entry of an import report.
+type Action struct {
+	// Kind is either RecordRole or RecordUser.
+	Kind string `json:"kind"`
+
+	// ID is the ID of the user or role in the target instance which might
+	// differ from the exported one if it has been matched by name.
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Result  Result   `json:"result"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Report describes the changes performed, or planned in case of a dry-run,
+// by an import.
+type Report struct {
+	DryRun   bool     `json:"dryRun"`
+	Actions  []Action `json:"actions"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Count returns the number of actions of kind with the given result.
+func (r *Report) Count(kind string, result Result) int {
+	var count int
+	for _, a := range r.Actions {
+		if a.Kind == kind && a.Result == result {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (r *Report) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	Strategy Strategy
+
+	// DryRun performs the import but rolls back the transaction so the
+	// report shows what would be changed.
+	DryRun bool
+
+	// Feed, if set, receives change events for all imported users and
+	// roles once the import has been committed.
+	Feed *changes.Feed
+
+	// Constraints, if set, rejects imports that violate separation-of-duties
+	// constraints.
+	Constraints *constraints.Checker
+}
+
+// Import reads an export from r and imports it into ds. Users and roles
+// are matched by ID first and by name second. The whole import runs in a
+// single transaction so either all or none of the records are imported.
+func Import(ctx context.Context, ds *repo.Queries, r io.Reader, opts ImportOptions) (*Report, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategySkip
+	}
+
+	if _, err := ParseStrategy(string(opts.Strategy)); err != nil {
+		return nil, err
+	}
+
+	header, roles, users, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ds.Tx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.L(ctx).Error("failed to rollback transaction", "error", err)
+		}
+	}()
+
+	imp := &importer{
+		q:       ds.WithTx(tx),
+		header:  header,
+		opts:    opts,
+		report:  &Report{DryRun: opts.DryRun},
+		roleIDs: make(map[string]string),
+	}
+
+	if err := opts.Constraints.Enforce(ctx, imp.q, func() error {
+		for _, role := range roles {
+			if err := imp.importRole(ctx, role); err != nil {
+				return fmt.Errorf("role %q: %w", role.Name, err)
+			}
+		}
+
+		// inclusions are imported once all roles exist.
+		for _, role := range roles {
+			if err := imp.importInclusions(ctx, role); err != nil {
+				return fmt.Errorf("role %q: %w", role.Name, err)
+			}
+		}
+
+		for _, user := range users {
+			if err := imp.importUser(ctx, user); err != nil {
+				return fmt.Errorf("user %q: %w", user.Username, err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return imp.report, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	imp.publish(ctx)
+
+	return imp.report, nil
+}
+
+func decode(r io.Reader) (*Header, []*Role, []*User, error) {
+	var (
+		header *Header
+		roles  []*Role
+		users  []*User
+	)
+
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record Record
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, nil, nil, fmt.Errorf("record %d: %w", line, err)
+		}
+
+		if header == nil && record.Type != RecordHeader {
+			return nil, nil, nil, fmt.Errorf("record %d: expected a header record", line)
+		}
+
+		switch {
+		case record.Type == RecordHeader && record.Header != nil && header == nil:
+			if err := record.Header.validate(); err != nil {
+				return nil, nil, nil, err
+			}
+
+			header = record.Header
+		case record.Type == RecordRole && record.Role != nil:
+			roles = append(roles, record.Role)
+		case record.Type == RecordUser && record.User != nil:
+			users = append(users, record.User)
+		default:
+			return nil, nil, nil, fmt.Errorf("record %d: unexpected record of type %q", line, record.Type)
+		}
+	}
+
+	if header == nil {
+		return nil, nil, nil, fmt.Errorf("empty export")
+	}
+
+	return header, roles, users, nil
+}
+
+type change struct {
+	eventType changes.Type
+	userID    string
+	roleID    string
+	data      any
+}
+
+type importer struct {
+	q       *repo.Queries
+	header  *Header
+	opts    ImportOptions
+	report  *Report
+	changes []change
+
+	// roleIDs maps exported role IDs to the IDs in the target instance.
+	roleIDs map[string]string
+}
+
+func (imp *importer) publish(ctx context.Context) {
+	for _, c := range imp.changes {
+		imp.opts.Feed.Publish(ctx, c.eventType, c.userID, c.roleID, c.data)
+	}
+}
+
+func (imp *importer) record(action Action, eventType changes.Type, data any) {
+	imp.report.Actions = append(imp.report.Actions, action)
+
+	if eventType == "" {
+		return
+	}
+
+	c := change{
+		eventType: eventType,
+		data:      data,
+	}
+
+	if action.Kind == RecordUser {
+		c.userID = action.ID
+	} else {
+		c.roleID = action.ID
+	}
+
+	imp.changes = append(imp.changes, c)
+}
+
+func (imp *importer) importRole(ctx context.Context, r *Role) error {
+	existing, err := imp.q.GetRoleByID(ctx, r.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err = imp.q.GetRoleByName(ctx, r.Name)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return imp.createRole(ctx, r)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to load role: %w", err)
+	}
+
+	imp.roleIDs[r.ID] = existing.ID
+
+	action := Action{
+		Kind: RecordRole,
+		ID:   existing.ID,
+		Name: existing.Name,
+	}
+
+	switch {
+	case existing.Origin == "system":
+		action.Result = ResultSkipped
+		action.Details = []string{"system roles are managed by the configuration"}
+	case imp.opts.Strategy == StrategySkip:
+		action.Result = ResultSkipped
+		action.Details = []string{"role already exists"}
+	default:
+		details, err := imp.updateRole(ctx, existing, r)
+		if err != nil {
+			return err
+		}
+
+		action.Details = details
+		action.Result = ResultUnchanged
+		if len(details) > 0 {
+			action.Result = ResultUpdated
+		}
+	}
+
+	eventType := changes.Type("")
+	if action.Result == ResultUpdated {
+		eventType = changes.RoleUpdated
+	}
+
+	imp.record(action, eventType, changes.RoleData{Name: action.Name})
+
+	return nil
+}
+
+func (imp *importer) createRole(ctx context.Context, r *Role) error {
+	role, err := imp.q.CreateRole(ctx, repo.CreateRoleParams{
+		ID:              r.ID,
+		Name:            r.Name,
+		Description:     r.Description,
+		DeleteProtected: r.DeleteProtected,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	imp.roleIDs[r.ID] = role.ID
+
+	for _, p := range r.Permissions {
+		if err := imp.q.AssignPermissionToRole(ctx, repo.AssignPermissionToRoleParams{
+			Permission: p,
+			RoleID:     role.ID,
+		}); err != nil {
+			return fmt.Errorf("failed to assign permission %q: %w", p, err)
+		}
+	}
+
+	action := Action{
+		Kind:   RecordRole,
+		ID:     role.ID,
+		Name:   role.Name,
+		Result: ResultCreated,
+	}
+
+	if len(r.Permissions) > 0 {
+		action.Details = []string{fmt.Sprintf("permissions: +%d", len(r.Permissions))}
+	}
+
+	imp.record(action, changes.RoleCreated, changes.RoleData{Name: role.Name})
+
+	return nil
+}
+
+func (imp *importer) updateRole(ctx context.Context, existing repo.Role, r *Role) ([]string, error) {
+	replace := imp.opts.Strategy == StrategyOverwrite
+
+	var details []string
+
+	params := repo.UpdateRoleParams{
+		ID:              existing.ID,
+		Name:            existing.Name,
+		Description:     existing.Description,
+		DeleteProtected: existing.DeleteProtected,
+	}
+
+	if replace && r.Name != existing.Name {
+		if _, err := imp.q.GetRoleByName(ctx, r.Name); err == nil {
+			imp.report.warn("role %q: cannot rename to %q as the name is already in use", existing.Name, r.Name)
+		} else if errors.Is(err, sql.ErrNoRows) {
+			params.Name = r.Name
+			details = append(details, "name")
+		} else {
+			return nil, fmt.Errorf("failed to check role name: %w", err)
+		}
+	}
+
+	if setField(&params.Description, r.Description, replace) {
+		details = append(details, "description")
+	}
+
+	if replace && params.DeleteProtected != r.DeleteProtected {
+		params.DeleteProtected = r.DeleteProtected
+		details = append(details, "deleteProtected")
+	}
+
+	if len(details) > 0 {
+		if _, err := imp.q.UpdateRole(ctx, params); err != nil {
+			return nil, fmt.Errorf("failed to update role: %w", err)
+		}
+	}
+
+	permissions, err := imp.q.GetRolePermissions(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	added, removed := diff(permissions, identity, r.Permissions, identity)
+	if !replace {
+		removed = nil
+	}
+
+	for _, p := range removed {
+		if _, err := imp.q.UnassignPermissionFromRole(ctx, repo.UnassignPermissionFromRoleParams{
+			RoleID:     existing.ID,
+			Permission: p,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to remove permission %q: %w", p, err)
+		}
+	}
+
+	for _, p := range added {
+		if err := imp.q.AssignPermissionToRole(ctx, repo.AssignPermissionToRoleParams{
+			Permission: p,
+			RoleID:     existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to assign permission %q: %w", p, err)
+		}
+	}
+
+	return appendCounts(details, "permissions", len(added), len(removed)), nil
+}
+
+// importInclusions updates the roles included by r. Roles that have been
+// skipped are left untouched.
+func (imp *importer) importInclusions(ctx context.Context, r *Role) error {
+	roleID, ok := imp.roleIDs[r.ID]
+	if !ok {
+		return nil
+	}
+
+	idx := slices.IndexFunc(imp.report.Actions, func(a Action) bool {
+		return a.Kind == RecordRole && a.ID == roleID
+	})
+	if idx < 0 || imp.report.Actions[idx].Result == ResultSkipped {
+		return nil
+	}
+
+	action := &imp.report.Actions[idx]
+
+	var want []string
+	for _, inc := range r.Includes {
+		id, ok := imp.roleIDs[inc]
+		if !ok {
+			imp.report.warn("role %q: included role %q is not part of the export", action.Name, inc)
+
+			continue
+		}
+
+		want = append(want, id)
+	}
+
+	included, err := imp.q.GetIncludedRoles(ctx, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to load included roles: %w", err)
+	}
+
+	added, removed := diff(included, func(r repo.Role) string { return r.ID }, want, identity)
+	if imp.opts.Strategy != StrategyOverwrite {
+		removed = nil
+	}
+
+	for _, inc := range removed {
+		if _, err := imp.q.RemoveRoleInclusion(ctx, repo.RemoveRoleInclusionParams{
+			RoleID:         roleID,
+			IncludedRoleID: inc.ID,
+		}); err != nil {
+			return fmt.Errorf("failed to remove included role %q: %w", inc.Name, err)
+		}
+	}
+
+	var addedCount int
+	for _, id := range added {
+		if err := imp.q.IncludeRole(ctx, roleID, id); err != nil {
+			if errors.Is(err, repo.ErrRoleInclusionCycle) {
+				imp.report.warn("role %q: cannot include role %q as it would create a cycle", action.Name, id)
+
+				continue
+			}
+
+			return fmt.Errorf("failed to include role %q: %w", id, err)
+		}
+
+		addedCount++
+	}
+
+	if addedCount == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	action.Details = appendCounts(action.Details, "includes", addedCount, len(removed))
+
+	if action.Result == ResultUnchanged {
+		action.Result = ResultUpdated
+
+		imp.changes = append(imp.changes, change{
+			eventType: changes.RoleUpdated,
+			roleID:    roleID,
+			data:      changes.RoleData{Name: action.Name},
+		})
+	}
+
+	return nil
+}
+
+// setField updates dst to value and reports whether it has been changed. If
+// replace is false, only empty fields are updated.
+func setField(dst *string, value string, replace bool) bool {
+	if *dst == value || (!replace && (*dst != "" || value == "")) {
+		return false
+	}
+
+	*dst = value
+
+	return true
+}
+
+// diff returns the entries of want whose key is not part of have and the
+// entries of have whose key is not part of want.
+func diff[H, W any](have []H, haveKey func(H) string, want []W, wantKey func(W) string) (added []W, removed []H) {
+	haveKeys := make(map[string]struct{}, len(have))
+	for _, h := range have {
+		haveKeys[haveKey(h)] = struct{}{}
+	}
+
+	wantKeys := make(map[string]struct{}, len(want))
+	for _, w := range want {
+		key := wantKey(w)
+		if _, ok := wantKeys[key]; ok {
+			continue
+		}
+
+		wantKeys[key] = struct{}{}
+
+		if _, ok := haveKeys[key]; !ok {
+			added = append(added, w)
+		}
+	}
+
+	for _, h := range have {
+		if _, ok := wantKeys[haveKey(h)]; !ok {
+			removed = append(removed, h)
+		}
+	}
+
+	return added, removed
+}
+
+func identity(s string) string { return s }
+
+func joinKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+func ids[T any](list []T, fn func(T) string) map[string]struct{} {
+	result := make(map[string]struct{}, len(list))
+	for _, e := range list {
+		result[fn(e)] = struct{}{}
+	}
+
+	return result
+}
+
+// childID returns the ID for an imported e-mail, phone number, address,
+// credential or token. Exported IDs are only kept if the user keeps its ID
+// and the ID is not yet used by another entry of the same user.
+func childID(id string, sameUser bool, taken map[string]struct{}) (string, error) {
+	if _, ok := taken[id]; sameUser && id != "" && !ok {
+		taken[id] = struct{}{}
+
+		return id, nil
+	}
+
+	newID, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	return newID.String(), nil
+}
+
+// appendCounts appends a summary like "emails: +1 -2 ~1" to details if any
+// entries have been added, removed or updated.
+func appendCounts(details []string, name string, added, removed int, updated ...int) []string {
+	var parts []string
+
+	if added > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", added))
+	}
+
+	if removed > 0 {
+		parts = append(parts, fmt.Sprintf("-%d", removed))
+	}
+
+	for _, u := range updated {
+		if u > 0 {
+			parts = append(parts, fmt.Sprintf("~%d", u))
+		}
+	}
+
+	if len(parts) == 0 {
+		return details
+	}
+
+	return append(details, name+": "+strings.Join(parts, " "))
+}
@@ -0,0 +1,700 @@
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tierklinik-dobersberg/cis-idm/internal/changes"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+func (imp *importer) importUser(ctx context.Context, u *User) error {
+	existing, err := imp.q.GetUserByID(ctx, u.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err = imp.q.GetUserByName(ctx, u.Username)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return imp.createUser(ctx, u)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	action := Action{
+		Kind: RecordUser,
+		ID:   existing.ID,
+		Name: existing.Username,
+	}
+
+	if imp.opts.Strategy == StrategySkip {
+		action.Result = ResultSkipped
+		action.Details = []string{"user already exists"}
+
+		imp.record(action, "", nil)
+
+		return nil
+	}
+
+	details, err := imp.updateUser(ctx, existing, u, imp.opts.Strategy == StrategyOverwrite)
+	if err != nil {
+		return err
+	}
+
+	action.Details = details
+	action.Result = ResultUnchanged
+
+	eventType := changes.Type("")
+	if len(details) > 0 {
+		action.Result = ResultUpdated
+		eventType = changes.UserUpdated
+	}
+
+	imp.record(action, eventType, changes.UserData{Username: action.Name})
+
+	return nil
+}
+
+func (imp *importer) createUser(ctx context.Context, u *User) error {
+	params := repo.CreateUserParams{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Extra:       u.Extra,
+		Avatar:      u.Avatar,
+		Birthday:    u.Birthday,
+	}
+
+	if !imp.header.Excludes(ExcludePasswords) {
+		params.Password = u.PasswordHash
+	}
+
+	user, err := imp.q.CreateUser(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	// all remaining fields are applied as if the new user was overwritten.
+	details, err := imp.updateUser(ctx, user, u, true)
+	if err != nil {
+		return err
+	}
+
+	imp.record(Action{
+		Kind:    RecordUser,
+		ID:      user.ID,
+		Name:    user.Username,
+		Result:  ResultCreated,
+		Details: details,
+	}, changes.UserCreated, changes.UserData{Username: user.Username})
+
+	return nil
+}
+
+// updateUser applies u to the existing user. If replace is false, only
+// empty fields are set and missing entries are added.
+func (imp *importer) updateUser(ctx context.Context, existing repo.User, u *User, replace bool) ([]string, error) {
+	var details []string
+
+	params := repo.UpdateUserParams{
+		ID:          existing.ID,
+		Username:    existing.Username,
+		DisplayName: existing.DisplayName,
+		FirstName:   existing.FirstName,
+		LastName:    existing.LastName,
+		Extra:       existing.Extra,
+		Avatar:      existing.Avatar,
+		Birthday:    existing.Birthday,
+	}
+
+	if replace && u.Username != existing.Username {
+		if _, err := imp.q.GetUserByName(ctx, u.Username); err == nil {
+			imp.report.warn("user %q: cannot rename to %q as the username is already in use", existing.Username, u.Username)
+		} else if errors.Is(err, sql.ErrNoRows) {
+			params.Username = u.Username
+			details = append(details, "username")
+		} else {
+			return nil, fmt.Errorf("failed to check username: %w", err)
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		dst   *string
+		value string
+	}{
+		{"displayName", &params.DisplayName, u.DisplayName},
+		{"firstName", &params.FirstName, u.FirstName},
+		{"lastName", &params.LastName, u.LastName},
+		{"extra", &params.Extra, u.Extra},
+		{"avatar", &params.Avatar, u.Avatar},
+		{"birthday", &params.Birthday, u.Birthday},
+	} {
+		if setField(f.dst, f.value, replace) {
+			details = append(details, f.name)
+		}
+	}
+
+	if len(details) > 0 {
+		if _, err := imp.q.UpdateUser(ctx, params); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	if replace && existing.Deleted != u.Deleted {
+		var err error
+		if u.Deleted {
+			_, err = imp.q.DeleteUser(ctx, existing.ID)
+		} else {
+			_, err = imp.q.RestoreUser(ctx, existing.ID)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to update deleted flag: %w", err)
+		}
+
+		details = append(details, "deleted")
+	}
+
+	// child rows keep their IDs if the user keeps its ID as well.
+	sameUser := existing.ID == u.ID
+
+	for _, fn := range []func(context.Context, repo.User, *User, bool, bool) ([]string, error){
+		imp.updateSecrets,
+		imp.updateEmails,
+		imp.updatePhoneNumbers,
+		imp.updateAddresses,
+		imp.updateRoles,
+		imp.updateWebAuthn,
+		imp.updateAPITokens,
+	} {
+		d, err := fn(ctx, existing, u, replace, sameUser)
+		if err != nil {
+			return nil, err
+		}
+
+		details = append(details, d...)
+	}
+
+	return details, nil
+}
+
+func (imp *importer) updateSecrets(ctx context.Context, existing repo.User, u *User, replace, _ bool) ([]string, error) {
+	var details []string
+
+	if !imp.header.Excludes(ExcludePasswords) {
+		password := existing.Password
+		if setField(&password, u.PasswordHash, replace) {
+			if _, err := imp.q.SetUserPassword(ctx, repo.SetUserPasswordParams{
+				ID:       existing.ID,
+				Password: password,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to set password: %w", err)
+			}
+
+			details = append(details, "password")
+		}
+	}
+
+	if imp.header.Excludes(ExcludeTOTP) {
+		return details, nil
+	}
+
+	secret := existing.TotpSecret.String
+	if setField(&secret, u.TOTPSecret, replace) {
+		var err error
+		if secret == "" {
+			_, err = imp.q.RemoveUserTOTPSecret(ctx, existing.ID)
+		} else {
+			err = imp.q.EnrollUserTOTPSecret(ctx, repo.EnrollUserTOTPSecretParams{
+				ID:         existing.ID,
+				TotpSecret: sql.NullString{String: secret, Valid: true},
+			})
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to set totp secret: %w", err)
+		}
+
+		details = append(details, "totp")
+	}
+
+	codes, err := imp.q.LoadUserRecoveryCodes(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recovery codes: %w", err)
+	}
+
+	// recovery codes are only useful as a whole set so they are never
+	// merged with existing ones.
+	if len(codes) > 0 && !replace {
+		return details, nil
+	}
+
+	added, removed := diff(codes, func(c repo.MfaBackupCode) string { return c.Code }, u.RecoveryCodes, identity)
+	if len(added) == 0 && len(removed) == 0 {
+		return details, nil
+	}
+
+	if err := imp.q.RemoveAllRecoveryCodes(ctx, existing.ID); err != nil {
+		return nil, fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+
+	for _, code := range u.RecoveryCodes {
+		if err := imp.q.InsertRecoveryCodes(ctx, repo.InsertRecoveryCodesParams{
+			Code:   code,
+			UserID: existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+		}
+	}
+
+	return append(details, "recoveryCodes"), nil
+}
+
+func (imp *importer) updateEmails(ctx context.Context, existing repo.User, u *User, replace, sameUser bool) ([]string, error) {
+	emails, err := imp.q.GetEmailsForUserByID(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails: %w", err)
+	}
+
+	added, removed := diff(
+		emails, func(e repo.UserEmail) string { return e.Address },
+		u.Emails, func(e Email) string { return e.Address },
+	)
+
+	if !replace {
+		removed = nil
+	}
+
+	for _, e := range removed {
+		if _, err := imp.q.DeleteEMailFromUser(ctx, repo.DeleteEMailFromUserParams{
+			ID:     e.ID,
+			UserID: existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to remove email %q: %w", e.Address, err)
+		}
+	}
+
+	hasPrimary := slices.ContainsFunc(emails, func(e repo.UserEmail) bool {
+		return e.IsPrimary && !slices.Contains(removed, e)
+	})
+
+	taken := ids(emails, func(e repo.UserEmail) string { return e.ID })
+
+	var count int
+	for _, e := range added {
+		owner, err := imp.q.GetUserByEMail(ctx, e.Address)
+		if err == nil {
+			imp.report.warn("user %q: email %q is already used by user %q", existing.Username, e.Address, owner.User.Username)
+
+			continue
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to check email %q: %w", e.Address, err)
+		}
+
+		id, err := childID(e.ID, sameUser, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		primary := e.Primary && (replace || !hasPrimary)
+
+		if _, err := imp.q.CreateEMail(ctx, repo.CreateEMailParams{
+			ID:       id,
+			UserID:   existing.ID,
+			Address:  e.Address,
+			Verified: e.Verified,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create email %q: %w", e.Address, err)
+		}
+
+		if primary {
+			if _, err := imp.q.MarkEmailAsPrimary(ctx, repo.MarkEmailAsPrimaryParams{
+				ID:     id,
+				UserID: existing.ID,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to mark email %q as primary: %w", e.Address, err)
+			}
+
+			hasPrimary = true
+		}
+
+		count++
+	}
+
+	var updated int
+	if replace {
+		for _, e := range emails {
+			idx := slices.IndexFunc(u.Emails, func(ie Email) bool { return ie.Address == e.Address })
+			if idx < 0 {
+				continue
+			}
+
+			want := u.Emails[idx]
+			if want.Verified == e.Verified && want.Primary == e.IsPrimary {
+				continue
+			}
+
+			if want.Verified != e.Verified {
+				if _, err := imp.q.MarkEmailVerified(ctx, repo.MarkEmailVerifiedParams{
+					Verified: want.Verified,
+					ID:       e.ID,
+					UserID:   existing.ID,
+				}); err != nil {
+					return nil, fmt.Errorf("failed to update email %q: %w", e.Address, err)
+				}
+			}
+
+			if want.Primary && !e.IsPrimary {
+				if _, err := imp.q.MarkEmailAsPrimary(ctx, repo.MarkEmailAsPrimaryParams{
+					ID:     e.ID,
+					UserID: existing.ID,
+				}); err != nil {
+					return nil, fmt.Errorf("failed to mark email %q as primary: %w", e.Address, err)
+				}
+			}
+
+			updated++
+		}
+	}
+
+	return appendCounts(nil, "emails", count, len(removed), updated), nil
+}
+
+func (imp *importer) updatePhoneNumbers(ctx context.Context, existing repo.User, u *User, replace, sameUser bool) ([]string, error) {
+	phones, err := imp.q.GetPhoneNumbersByUserID(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load phone numbers: %w", err)
+	}
+
+	added, removed := diff(
+		phones, func(p repo.UserPhoneNumber) string { return p.PhoneNumber },
+		u.PhoneNumbers, func(p PhoneNumber) string { return p.Number },
+	)
+
+	if !replace {
+		removed = nil
+	}
+
+	for _, p := range removed {
+		if _, err := imp.q.DeleteUserPhoneNumber(ctx, repo.DeleteUserPhoneNumberParams{
+			ID:     p.ID,
+			UserID: existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to remove phone number %q: %w", p.PhoneNumber, err)
+		}
+	}
+
+	hasPrimary := slices.ContainsFunc(phones, func(p repo.UserPhoneNumber) bool {
+		return p.IsPrimary && !slices.Contains(removed, p)
+	})
+
+	taken := ids(phones, func(p repo.UserPhoneNumber) string { return p.ID })
+
+	for _, p := range added {
+		id, err := childID(p.ID, sameUser, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		primary := p.Primary && (replace || !hasPrimary)
+
+		if _, err := imp.q.CreateUserPhoneNumber(ctx, repo.CreateUserPhoneNumberParams{
+			ID:          id,
+			UserID:      existing.ID,
+			PhoneNumber: p.Number,
+			Verified:    p.Verified,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create phone number %q: %w", p.Number, err)
+		}
+
+		if primary {
+			if _, err := imp.q.MarkPhoneNumberAsPrimary(ctx, repo.MarkPhoneNumberAsPrimaryParams{
+				ID:     id,
+				UserID: existing.ID,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to mark phone number %q as primary: %w", p.Number, err)
+			}
+
+			hasPrimary = true
+		}
+	}
+
+	var updated int
+	if replace {
+		for _, p := range phones {
+			idx := slices.IndexFunc(u.PhoneNumbers, func(ip PhoneNumber) bool { return ip.Number == p.PhoneNumber })
+			if idx < 0 {
+				continue
+			}
+
+			want := u.PhoneNumbers[idx]
+			if want.Verified == p.Verified && want.Primary == p.IsPrimary {
+				continue
+			}
+
+			if want.Verified != p.Verified {
+				if _, err := imp.q.MarkPhoneNumberVerified(ctx, repo.MarkPhoneNumberVerifiedParams{
+					Verified: want.Verified,
+					ID:       p.ID,
+					UserID:   existing.ID,
+				}); err != nil {
+					return nil, fmt.Errorf("failed to update phone number %q: %w", p.PhoneNumber, err)
+				}
+			}
+
+			if want.Primary && !p.IsPrimary {
+				if _, err := imp.q.MarkPhoneNumberAsPrimary(ctx, repo.MarkPhoneNumberAsPrimaryParams{
+					ID:     p.ID,
+					UserID: existing.ID,
+				}); err != nil {
+					return nil, fmt.Errorf("failed to mark phone number %q as primary: %w", p.PhoneNumber, err)
+				}
+			}
+
+			updated++
+		}
+	}
+
+	return appendCounts(nil, "phoneNumbers", len(added), len(removed), updated), nil
+}
+
+func (imp *importer) updateAddresses(ctx context.Context, existing repo.User, u *User, replace, sameUser bool) ([]string, error) {
+	addresses, err := imp.q.GetUserAddresses(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load addresses: %w", err)
+	}
+
+	added, removed := diff(
+		addresses, func(a repo.UserAddress) string { return joinKey(a.CityCode, a.CityName, a.Street, a.Extra) },
+		u.Addresses, func(a Address) string { return joinKey(a.CityCode, a.CityName, a.Street, a.Extra) },
+	)
+
+	if !replace {
+		removed = nil
+	}
+
+	for _, a := range removed {
+		if _, err := imp.q.DeleteUserAddress(ctx, repo.DeleteUserAddressParams{
+			ID:     a.ID,
+			UserID: existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to remove address: %w", err)
+		}
+	}
+
+	taken := ids(addresses, func(a repo.UserAddress) string { return a.ID })
+
+	for _, a := range added {
+		id, err := childID(a.ID, sameUser, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := imp.q.CreateUserAddress(ctx, repo.CreateUserAddressParams{
+			ID:       id,
+			UserID:   existing.ID,
+			CityCode: a.CityCode,
+			CityName: a.CityName,
+			Street:   a.Street,
+			Extra:    a.Extra,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create address: %w", err)
+		}
+	}
+
+	return appendCounts(nil, "addresses", len(added), len(removed)), nil
+}
+
+func (imp *importer) updateRoles(ctx context.Context, existing repo.User, u *User, replace, _ bool) ([]string, error) {
+	roles, err := imp.q.GetRolesForUser(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	want, err := imp.mapRoles(ctx, existing.Username, u.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	added, removed := diff(roles, func(r repo.Role) string { return r.ID }, want, identity)
+	if !replace {
+		removed = nil
+	}
+
+	for _, r := range removed {
+		if _, err := imp.q.UnassignRoleFromUser(ctx, repo.UnassignRoleFromUserParams{
+			UserID: existing.ID,
+			RoleID: r.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to unassign role %q: %w", r.Name, err)
+		}
+	}
+
+	for _, id := range added {
+		if err := imp.q.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{
+			UserID: existing.ID,
+			RoleID: id,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to assign role %q: %w", id, err)
+		}
+	}
+
+	return appendCounts(nil, "roles", len(added), len(removed)), nil
+}
+
+// mapRoles translates exported role IDs to the IDs used by the target
+// instance. Unknown roles are dropped with a warning.
+func (imp *importer) mapRoles(ctx context.Context, username string, roleIDs []string) ([]string, error) {
+	var result []string
+
+	for _, id := range roleIDs {
+		if target, ok := imp.roleIDs[id]; ok {
+			result = append(result, target)
+
+			continue
+		}
+
+		_, err := imp.q.GetRoleByID(ctx, id)
+		switch {
+		case err == nil:
+			imp.roleIDs[id] = id
+			result = append(result, id)
+		case errors.Is(err, sql.ErrNoRows):
+			imp.report.warn("user %q: role %q does not exist", username, id)
+		default:
+			return nil, fmt.Errorf("failed to load role %q: %w", id, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (imp *importer) updateWebAuthn(ctx context.Context, existing repo.User, u *User, replace, sameUser bool) ([]string, error) {
+	if imp.header.Excludes(ExcludeWebAuthn) {
+		return nil, nil
+	}
+
+	creds, err := imp.q.GetWebauthnCreds(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webauthn credentials: %w", err)
+	}
+
+	added, removed := diff(
+		creds, func(c repo.WebauthnCred) string { return c.Cred },
+		u.WebAuthnCredentials, func(c WebAuthnCredential) string { return c.Credential },
+	)
+
+	if !replace {
+		removed = nil
+	}
+
+	for _, c := range removed {
+		if _, err := imp.q.RemoveWebauthnCred(ctx, repo.RemoveWebauthnCredParams{
+			UserID: existing.ID,
+			ID:     c.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to remove webauthn credential: %w", err)
+		}
+	}
+
+	taken := ids(creds, func(c repo.WebauthnCred) string { return c.ID })
+
+	for _, c := range added {
+		id, err := childID(c.ID, sameUser, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := imp.q.AddWebauthnCred(ctx, repo.AddWebauthnCredParams{
+			ID:           id,
+			UserID:       existing.ID,
+			Cred:         c.Credential,
+			CredType:     c.Type,
+			ClientName:   c.ClientName,
+			ClientOs:     c.ClientOS,
+			ClientDevice: c.ClientDevice,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create webauthn credential: %w", err)
+		}
+	}
+
+	return appendCounts(nil, "webauthnCredentials", len(added), len(removed)), nil
+}
+
+func (imp *importer) updateAPITokens(ctx context.Context, existing repo.User, u *User, replace, sameUser bool) ([]string, error) {
+	if imp.header.Excludes(ExcludeAPITokens) {
+		return nil, nil
+	}
+
+	tokens, err := imp.q.GetAPITokensForUser(ctx, existing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load api tokens: %w", err)
+	}
+
+	added, removed := diff(
+		tokens, func(t repo.UserApiToken) string { return t.Token },
+		u.APITokens, func(t APIToken) string { return t.Token },
+	)
+
+	if !replace {
+		removed = nil
+	}
+
+	for _, t := range removed {
+		if _, err := imp.q.RevokeUserAPIToken(ctx, repo.RevokeUserAPITokenParams{
+			ID:     t.ID,
+			UserID: existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to revoke api token %q: %w", t.Name, err)
+		}
+	}
+
+	taken := ids(tokens, func(t repo.UserApiToken) string { return t.ID })
+
+	for _, t := range added {
+		id, err := childID(t.ID, sameUser, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		var expiresAt sql.NullTime
+		if t.ExpiresAt != nil {
+			expiresAt = sql.NullTime{Time: *t.ExpiresAt, Valid: true}
+		}
+
+		if err := imp.q.CreateAPIToken(ctx, repo.CreateAPITokenParams{
+			ID:        id,
+			Token:     t.Token,
+			Name:      t.Name,
+			UserID:    existing.ID,
+			ExpiresAt: expiresAt,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create api token %q: %w", t.Name, err)
+		}
+
+		roles, err := imp.mapRoles(ctx, existing.Username, t.Roles)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, roleID := range roles {
+			if err := imp.q.AddRoleToToken(ctx, repo.AddRoleToTokenParams{
+				TokenID: id,
+				RoleID:  roleID,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to assign role %q to api token %q: %w", roleID, t.Name, err)
+			}
+		}
+	}
+
+	return appendCounts(nil, "apiTokens", len(added), len(removed)), nil
+}
@@ -0,0 +1,240 @@
+package transfer_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/transfer"
+)
+
+func openDB(t *testing.T, name string) *repo.Queries {
+	t.Helper()
+
+	db, err := repo.Open("file:" + filepath.Join(t.TempDir(), name) + "?_foreign_keys=on")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = repo.Migrate(context.Background(), db)
+	require.NoError(t, err)
+
+	return repo.New(db)
+}
+
+func seed(t *testing.T, ds *repo.Queries) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	_, err := ds.CreateRole(ctx, repo.CreateRoleParams{ID: "role-admin", Name: "admin"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AssignPermissionToRole(ctx, repo.AssignPermissionToRoleParams{Permission: "idm:users:write", RoleID: "role-admin"}))
+
+	_, err = ds.CreateRole(ctx, repo.CreateRoleParams{ID: "role-employee", Name: "employee"})
+	require.NoError(t, err)
+	require.NoError(t, ds.IncludeRole(ctx, "role-admin", "role-employee"))
+
+	_, err = ds.CreateUser(ctx, repo.CreateUserParams{
+		ID:          "alice",
+		Username:    "alice",
+		DisplayName: "Alice",
+		Password:    "hash",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, ds.EnrollUserTOTPSecret(ctx, repo.EnrollUserTOTPSecretParams{
+		ID:         "alice",
+		TotpSecret: sql.NullString{String: "totp", Valid: true},
+	}))
+	require.NoError(t, ds.InsertRecoveryCodes(ctx, repo.InsertRecoveryCodesParams{Code: "code", UserID: "alice"}))
+
+	_, err = ds.CreateEMail(ctx, repo.CreateEMailParams{ID: "mail-1", UserID: "alice", Address: "alice@example.com", Verified: true, IsPrimary: true})
+	require.NoError(t, err)
+
+	_, err = ds.CreateUserPhoneNumber(ctx, repo.CreateUserPhoneNumberParams{ID: "phone-1", UserID: "alice", PhoneNumber: "+431234"})
+	require.NoError(t, err)
+
+	require.NoError(t, ds.AssignRoleToUser(ctx, repo.AssignRoleToUserParams{UserID: "alice", RoleID: "role-admin"}))
+
+	require.NoError(t, ds.CreateAPIToken(ctx, repo.CreateAPITokenParams{ID: "token-1", Token: "secret", Name: "ci", UserID: "alice"}))
+	require.NoError(t, ds.AddRoleToToken(ctx, repo.AddRoleToTokenParams{TokenID: "token-1", RoleID: "role-admin"}))
+}
+
+func export(t *testing.T, ds *repo.Queries, opts transfer.ExportOptions) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, transfer.Export(context.Background(), ds, &buf, opts))
+
+	return buf.Bytes()
+}
+
+func Test_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	src := openDB(t, "src.db")
+	seed(t, src)
+
+	data := export(t, src, transfer.ExportOptions{})
+
+	dst := openDB(t, "dst.db")
+
+	report, err := transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultCreated))
+	assert.Equal(t, 2, report.Count(transfer.RecordRole, transfer.ResultCreated))
+
+	_, err = dst.GetUserByID(ctx, "alice")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "dry-run must not change the database")
+
+	report, err = transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultCreated))
+	assert.Empty(t, report.Warnings)
+
+	user, err := dst.GetUserByID(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Equal(t, "hash", user.Password)
+	assert.Equal(t, "totp", user.TotpSecret.String)
+
+	emails, err := dst.GetEmailsForUserByID(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+	assert.Equal(t, "mail-1", emails[0].ID)
+	assert.True(t, emails[0].IsPrimary)
+	assert.True(t, emails[0].Verified)
+
+	tokenRoles, err := dst.GetRolesForToken(ctx, "token-1")
+	require.NoError(t, err)
+	require.Len(t, tokenRoles, 1)
+	assert.Equal(t, "admin", tokenRoles[0].Name)
+
+	included, err := dst.GetIncludedRoles(ctx, "role-admin")
+	require.NoError(t, err)
+	require.Len(t, included, 1)
+	assert.Equal(t, "role-employee", included[0].ID)
+
+	// the target instance should now export the same data.
+	assert.Equal(t, stripHeader(t, data), stripHeader(t, export(t, dst, transfer.ExportOptions{})))
+
+	// importing again does not change anything.
+	report, err = transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{Strategy: transfer.StrategyOverwrite})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultUnchanged))
+	assert.Equal(t, 2, report.Count(transfer.RecordRole, transfer.ResultUnchanged))
+}
+
+func Test_Strategies(t *testing.T) {
+	ctx := context.Background()
+
+	src := openDB(t, "src.db")
+	seed(t, src)
+
+	data := export(t, src, transfer.ExportOptions{ExcludePasswords: true})
+
+	setup := func(t *testing.T) *repo.Queries {
+		dst := openDB(t, "dst.db")
+
+		// same username but a different ID, display name and password.
+		_, err := dst.CreateUser(ctx, repo.CreateUserParams{ID: "other-id", Username: "alice", Password: "local"})
+		require.NoError(t, err)
+
+		_, err = dst.CreateEMail(ctx, repo.CreateEMailParams{ID: "mail-2", UserID: "other-id", Address: "old@example.com", IsPrimary: true})
+		require.NoError(t, err)
+
+		return dst
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		dst := setup(t)
+
+		report, err := transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{Strategy: transfer.StrategySkip})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultSkipped))
+
+		user, err := dst.GetUserByID(ctx, "other-id")
+		require.NoError(t, err)
+		assert.Empty(t, user.DisplayName)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		dst := setup(t)
+
+		report, err := transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{Strategy: transfer.StrategyMerge})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultUpdated))
+
+		user, err := dst.GetUserByID(ctx, "other-id")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", user.DisplayName)
+		assert.Equal(t, "local", user.Password, "excluded passwords must not be touched")
+
+		emails, err := dst.GetEmailsForUserByID(ctx, "other-id")
+		require.NoError(t, err)
+		require.Len(t, emails, 2)
+
+		for _, e := range emails {
+			assert.Equal(t, e.Address == "old@example.com", e.IsPrimary)
+			assert.NotEqual(t, "mail-1", e.ID, "child IDs must not be kept for a different user ID")
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		dst := setup(t)
+
+		report, err := transfer.Import(ctx, dst, bytes.NewReader(data), transfer.ImportOptions{Strategy: transfer.StrategyOverwrite})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Count(transfer.RecordUser, transfer.ResultUpdated))
+
+		user, err := dst.GetUserByID(ctx, "other-id")
+		require.NoError(t, err)
+		assert.Equal(t, "local", user.Password, "excluded passwords must not be touched")
+
+		emails, err := dst.GetEmailsForUserByID(ctx, "other-id")
+		require.NoError(t, err)
+		require.Len(t, emails, 1)
+		assert.Equal(t, "alice@example.com", emails[0].Address)
+		assert.True(t, emails[0].IsPrimary)
+
+		roles, err := dst.GetRolesForUser(ctx, "other-id")
+		require.NoError(t, err)
+		require.Len(t, roles, 1)
+		assert.Equal(t, "role-admin", roles[0].ID)
+	})
+}
+
+func Test_ImportRejectsInvalidExports(t *testing.T) {
+	ctx := context.Background()
+	dst := openDB(t, "dst.db")
+
+	for _, data := range []string{
+		``,
+		`{"type":"user","user":{"id":"alice","username":"alice"}}`,
+		`{"type":"header","header":{"version":99}}`,
+		`{"type":"header","header":{"version":1,"excluded":["unknown"]}}`,
+	} {
+		_, err := transfer.Import(ctx, dst, bytes.NewReader([]byte(data)), transfer.ImportOptions{})
+		assert.Error(t, err, data)
+	}
+
+	_, err := transfer.Import(ctx, dst, bytes.NewReader(nil), transfer.ImportOptions{Strategy: "replace"})
+	assert.Error(t, err)
+}
+
+// stripHeader removes the first line of an export as it contains the
+// creation time.
+func stripHeader(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	_, rest, ok := bytes.Cut(data, []byte("\n"))
+	require.True(t, ok)
+
+	return rest
+}
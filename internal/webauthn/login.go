@@ -170,7 +170,7 @@ func (svc *Service) FinishLoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	roles, err := svc.Datastore.GetRolesForUser(ctx, user.ID)
+	roles, err := svc.Datastore.GetEffectiveRolesForUser(ctx, user.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 
@@ -186,7 +186,7 @@ func (svc *Service) FinishLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, _, err := svc.AddAccessToken(user, roles, 0, refreshTokenID, jwt.LoginKindWebauthn, w.Header()); err != nil {
+	if _, _, err := svc.AddAccessToken(ctx, user, roles, 0, refreshTokenID, jwt.LoginKindWebauthn, w.Header()); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 
 		return
@@ -14,6 +14,7 @@ import (
 	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/middleware"
 	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
 )
 
 func (svc *Service) BeginRegistrationHandler(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +101,9 @@ func (svc *Service) BeginRegistrationHandler(w http.ResponseWriter, r *http.Requ
 
 		user = *userModel
 
+		svc.EmitUserEvent(ctx, webhook.UserCreated, user)
+		svc.PublishUserCreated(ctx, user)
+
 	} else {
 		// an existing user is adding a new device
 		var err error
@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/config"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Delivery states.
+const (
+	StatusPending    = "pending"
+	StatusDelivering = "delivering"
+	StatusDelivered  = "delivered"
+	StatusFailed     = "failed"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	batchSize    = 50
+
+	// leaseMargin is added to the request timeout of a webhook when claiming
+	// a delivery. If a replica stops while sending, the delivery is picked
+	// up again once the lease expired.
+	leaseMargin = time.Minute
+
+	minBackoff = 30 * time.Second
+	maxBackoff = 6 * time.Hour
+)
+
+// Backoff returns the delay before the next delivery attempt after attempt
+// failed attempts.
+func Backoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+
+	d := minBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return d
+}
+
+// Dispatcher writes lifecycle events to the outbox and delivers them to all
+// configured webhooks.
+type Dispatcher struct {
+	datastore *repo.Queries
+	webhooks  []*config.Webhook
+	client    *http.Client
+
+	wakeup chan struct{}
+}
+
+// NewDispatcher returns a new dispatcher for webhooks.
+func NewDispatcher(ds *repo.Queries, webhooks []*config.Webhook) *Dispatcher {
+	return &Dispatcher{
+		datastore: ds,
+		webhooks:  webhooks,
+		client:    &http.Client{},
+		wakeup:    make(chan struct{}, 1),
+	}
+}
+
+// NewUserData returns the event data for user events.
+func NewUserData(userID string, profile *idmv1.Profile) UserData {
+	data := UserData{
+		UserID: userID,
+	}
+
+	if profile != nil {
+		blob, err := protojson.Marshal(profile)
+		if err == nil {
+			data.Profile = blob
+		}
+	}
+
+	return data
+}
+
+func (d *Dispatcher) subscribers(eventType EventType) []*config.Webhook {
+	var result []*config.Webhook
+
+	for _, wh := range d.webhooks {
+		if len(wh.Events) == 0 || slices.Contains(wh.Events, string(eventType)) {
+			result = append(result, wh)
+		}
+	}
+
+	return result
+}
+
+// HasSubscribers returns true if at least one webhook subscribed to
+// eventType.
+func (d *Dispatcher) HasSubscribers(eventType EventType) bool {
+	if d == nil {
+		return false
+	}
+
+	return len(d.subscribers(eventType)) > 0
+}
+
+// Emit writes a new event to the outbox of each webhook that subscribed to
+// eventType. Errors are logged but not returned as a failure to notify
+// external systems should not change the outcome of the operation that
+// caused the event.
+func (d *Dispatcher) Emit(ctx context.Context, eventType EventType, data any) {
+	if d == nil {
+		return
+	}
+
+	hooks := d.subscribers(eventType)
+	if len(hooks) == 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	l := log.L(ctx).With("event", eventType)
+
+	eventID, err := uuid.NewV4()
+	if err != nil {
+		l.Error("failed to generate event id", "error", err)
+		return
+	}
+
+	dataBlob, err := json.Marshal(data)
+	if err != nil {
+		l.Error("failed to marshal event data", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	payload, err := json.Marshal(Event{
+		ID:   eventID.String(),
+		Type: eventType,
+		Time: now,
+		Data: dataBlob,
+	})
+	if err != nil {
+		l.Error("failed to marshal event", "error", err)
+		return
+	}
+
+	for _, wh := range hooks {
+		id, err := uuid.NewV4()
+		if err != nil {
+			l.Error("failed to generate delivery id", "error", err)
+			continue
+		}
+
+		if err := d.datastore.CreateWebhookDelivery(ctx, repo.CreateWebhookDeliveryParams{
+			ID:            id.String(),
+			Webhook:       wh.Name,
+			EventID:       eventID.String(),
+			EventType:     string(eventType),
+			Payload:       string(payload),
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		}); err != nil {
+			l.Error("failed to store webhook delivery", "webhook", wh.Name, "error", err)
+		}
+	}
+
+	// notify the worker loop that there are new deliveries
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers pending events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if len(d.webhooks) == 0 {
+		log.L(ctx).Debug("no webhooks configured, not starting webhook dispatcher")
+		return
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wakeup:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	deliveries, err := d.datastore.GetDueWebhookDeliveries(ctx, repo.GetDueWebhookDeliveriesParams{
+		NextAttemptAt: time.Now().UTC(),
+		Limit:         batchSize,
+	})
+	if err != nil {
+		log.L(ctx).Error("failed to load due webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := d.claim(ctx, delivery)
+		if err != nil {
+			log.L(ctx).Error("failed to claim webhook delivery", "delivery", delivery.ID, "error", err)
+			continue
+		}
+
+		// another replica is already sending this delivery.
+		if !claimed {
+			continue
+		}
+
+		d.deliver(ctx, delivery)
+	}
+}
+
+// claim marks delivery as being sent by this replica. It returns false if
+// the delivery has already been claimed by someone else.
+func (d *Dispatcher) claim(ctx context.Context, delivery repo.WebhookDelivery) (bool, error) {
+	lease := leaseMargin
+	if wh := d.findWebhook(delivery.Webhook); wh != nil {
+		lease += wh.RequestTimeout()
+	}
+
+	now := time.Now().UTC()
+	rows, err := d.datastore.ClaimWebhookDelivery(ctx, repo.ClaimWebhookDeliveryParams{
+		LeaseUntil: sql.NullTime{Time: now.Add(lease), Valid: true},
+		ID:         delivery.ID,
+		Now:        now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (d *Dispatcher) findWebhook(name string) *config.Webhook {
+	for _, wh := range d.webhooks {
+		if wh.Name == name {
+			return wh
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery repo.WebhookDelivery) {
+	l := log.L(ctx).With("delivery", delivery.ID, "webhook", delivery.Webhook, "event", delivery.EventType)
+
+	now := time.Now().UTC()
+	update := repo.UpdateWebhookDeliveryAttemptParams{
+		ID:            delivery.ID,
+		Status:        StatusDelivered,
+		NextAttemptAt: delivery.NextAttemptAt,
+		LastAttemptAt: sql.NullTime{Time: now, Valid: true},
+	}
+
+	wh := d.findWebhook(delivery.Webhook)
+	if wh == nil {
+		update.Status = StatusFailed
+		update.LastError = "webhook is not configured anymore"
+	} else {
+		statusCode, err := d.send(ctx, wh, delivery, now)
+
+		update.LastStatusCode = int64(statusCode)
+
+		if err != nil {
+			update.LastError = err.Error()
+
+			attempts := int(delivery.Attempts) + 1
+			if attempts >= wh.MaxAttempts {
+				update.Status = StatusFailed
+			} else {
+				update.Status = StatusPending
+				update.NextAttemptAt = now.Add(Backoff(attempts))
+			}
+		}
+	}
+
+	if update.Status != StatusDelivered {
+		l.Warn("webhook delivery failed", "status", update.Status, "attempt", delivery.Attempts+1, "error", update.LastError)
+	}
+
+	if err := d.datastore.UpdateWebhookDeliveryAttempt(ctx, update); err != nil {
+		l.Error("failed to update webhook delivery", "error", err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, wh *config.Webhook, delivery repo.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, wh.RequestTimeout())
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := now.Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cisidm-webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(wh.Secret, ts, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be re-used.
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
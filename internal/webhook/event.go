@@ -0,0 +1,78 @@
+// Package webhook delivers identity lifecycle events to external HTTP
+// endpoints.
+//
+// Events are written to an outbox table (webhook_deliveries) by the
+// Dispatcher and are delivered asynchronously by the Dispatcher's worker loop.
+// Failed deliveries are retried with exponential back-off until the maximum
+// number of attempts configured for the webhook is reached.
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType is the type of a lifecycle event.
+type EventType string
+
+// All lifecycle events supported by cisidm.
+const (
+	UserCreated     EventType = "user.created"
+	UserUpdated     EventType = "user.updated"
+	UserDeleted     EventType = "user.deleted"
+	RoleAssigned    EventType = "role.assigned"
+	RoleUnassigned  EventType = "role.unassigned"
+	EmailVerified   EventType = "email.verified"
+	PasswordChanged EventType = "password.changed"
+)
+
+// EventTypes holds all supported event types.
+var EventTypes = []EventType{
+	UserCreated,
+	UserUpdated,
+	UserDeleted,
+	RoleAssigned,
+	RoleUnassigned,
+	EmailVerified,
+	PasswordChanged,
+}
+
+// Event is the JSON payload delivered to webhook endpoints.
+type Event struct {
+	ID   string          `json:"id"`
+	Type EventType       `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// UserData is the event data for user.created, user.updated and
+// user.deleted events. Profile is not set for user.deleted.
+type UserData struct {
+	UserID  string          `json:"userId"`
+	Profile json.RawMessage `json:"profile,omitempty"`
+}
+
+// RoleAssignmentData is the event data for role.assigned and role.unassigned
+// events.
+type RoleAssignmentData struct {
+	RoleID   string   `json:"roleId"`
+	RoleName string   `json:"roleName"`
+	UserIDs  []string `json:"userIds"`
+}
+
+// EmailVerifiedData is the event data for email.verified events.
+type EmailVerifiedData struct {
+	UserID  string `json:"userId"`
+	EmailID string `json:"emailId"`
+	Address string `json:"address"`
+}
+
+// PasswordChangedData is the event data for password.changed events.
+type PasswordChangedData struct {
+	UserID string `json:"userId"`
+
+	// ChangedBy holds the ID of the user that changed the password. This is
+	// only different from UserID if the password has been set by an
+	// administrator.
+	ChangedBy string `json:"changedBy,omitempty"`
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/repo"
+)
+
+const (
+	// ServiceName is the name of the webhook delivery service.
+	ServiceName = "cisidm.v1.WebhookService"
+
+	// ListDeliveriesProcedure is the HTTP path of the ListDeliveries endpoint.
+	ListDeliveriesProcedure = "/" + ServiceName + "/ListDeliveries"
+
+	// GetDeliveryProcedure is the HTTP path of the GetDelivery endpoint.
+	GetDeliveryProcedure = "/" + ServiceName + "/GetDelivery"
+
+	// RetryDeliveryProcedure is the HTTP path of the RetryDelivery endpoint.
+	RetryDeliveryProcedure = "/" + ServiceName + "/RetryDelivery"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Delivery is the API representation of a webhook delivery.
+type Delivery struct {
+	ID             string          `json:"id"`
+	Webhook        string          `json:"webhook"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Status         string          `json:"status"`
+	Attempts       int64           `json:"attempts"`
+	CreateTime     time.Time       `json:"createTime"`
+	NextAttempt    *time.Time      `json:"nextAttemptTime,omitempty"`
+	LastAttempt    *time.Time      `json:"lastAttemptTime,omitempty"`
+	LastStatusCode int64           `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+}
+
+type ListDeliveriesRequest struct {
+	Webhook   string `json:"webhook,omitempty"`
+	Status    string `json:"status,omitempty"`
+	EventType string `json:"eventType,omitempty"`
+	PageSize  int    `json:"pageSize,omitempty"`
+	PageToken string `json:"pageToken,omitempty"`
+}
+
+type ListDeliveriesResponse struct {
+	Deliveries    []Delivery `json:"deliveries"`
+	NextPageToken string     `json:"nextPageToken,omitempty"`
+}
+
+type GetDeliveryRequest struct {
+	ID string `json:"id"`
+}
+
+type GetDeliveryResponse struct {
+	Delivery Delivery `json:"delivery"`
+}
+
+type RetryDeliveryRequest struct {
+	ID string `json:"id"`
+}
+
+type RetryDeliveryResponse struct{}
+
+// Service provides access to the webhook delivery status.
+type Service struct {
+	dispatcher *Dispatcher
+}
+
+// NewService returns a new webhook delivery service.
+func NewService(d *Dispatcher) *Service {
+	return &Service{
+		dispatcher: d,
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// ListDeliveries returns webhook deliveries, newest first.
+func (svc *Service) ListDeliveries(ctx context.Context, req *ListDeliveriesRequest) (*ListDeliveriesResponse, error) {
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	params := repo.ListWebhookDeliveriesParams{
+		Webhook:   nullString(req.Webhook),
+		Status:    nullString(req.Status),
+		EventType: nullString(req.EventType),
+		Limit:     int64(pageSize) + 1,
+	}
+
+	if req.PageToken != "" {
+		seq, err := strconv.ParseInt(req.PageToken, 10, 64)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token"))
+		}
+
+		params.BeforeSeq = sql.NullInt64{Int64: seq, Valid: true}
+	}
+
+	records, err := svc.dispatcher.datastore.ListWebhookDeliveries(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+
+	res := &ListDeliveriesResponse{
+		Deliveries: make([]Delivery, 0, len(records)),
+	}
+
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		res.NextPageToken = strconv.FormatInt(records[len(records)-1].Seq, 10)
+	}
+
+	for _, r := range records {
+		res.Deliveries = append(res.Deliveries, deliveryFromModel(r, false))
+	}
+
+	return res, nil
+}
+
+// GetDelivery returns a single webhook delivery including the event payload.
+func (svc *Service) GetDelivery(ctx context.Context, req *GetDeliveryRequest) (*GetDeliveryResponse, error) {
+	r, err := svc.dispatcher.datastore.GetWebhookDelivery(ctx, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("delivery not found"))
+		}
+
+		return nil, err
+	}
+
+	return &GetDeliveryResponse{
+		Delivery: deliveryFromModel(r, true),
+	}, nil
+}
+
+// RetryDelivery schedules a failed or delivered event for immediate
+// re-delivery.
+func (svc *Service) RetryDelivery(ctx context.Context, req *RetryDeliveryRequest) (*RetryDeliveryResponse, error) {
+	rows, err := svc.dispatcher.datastore.RetryWebhookDelivery(ctx, repo.RetryWebhookDeliveryParams{
+		NextAttemptAt: time.Now().UTC(),
+		ID:            req.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("delivery not found or already pending"))
+	}
+
+	select {
+	case svc.dispatcher.wakeup <- struct{}{}:
+	default:
+	}
+
+	return &RetryDeliveryResponse{}, nil
+}
+
+func deliveryFromModel(r repo.WebhookDelivery, includePayload bool) Delivery {
+	d := Delivery{
+		ID:             r.ID,
+		Webhook:        r.Webhook,
+		EventID:        r.EventID,
+		EventType:      r.EventType,
+		Status:         r.Status,
+		Attempts:       r.Attempts,
+		CreateTime:     r.CreatedAt,
+		LastStatusCode: r.LastStatusCode,
+		LastError:      r.LastError,
+	}
+
+	if r.Status == StatusPending {
+		next := r.NextAttemptAt
+		d.NextAttempt = &next
+	}
+
+	if r.LastAttemptAt.Valid {
+		last := r.LastAttemptAt.Time
+		d.LastAttempt = &last
+	}
+
+	if includePayload {
+		d.Payload = json.RawMessage(r.Payload)
+	}
+
+	return d
+}
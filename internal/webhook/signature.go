@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Headers set on each webhook delivery.
+const (
+	HeaderEvent     = "X-Cisidm-Event"
+	HeaderDelivery  = "X-Cisidm-Delivery"
+	HeaderTimestamp = "X-Cisidm-Timestamp"
+	HeaderSignature = "X-Cisidm-Signature"
+)
+
+const signaturePrefix = "sha256="
+
+// Sign returns the signature for body sent at the given unix timestamp.
+// The signature is the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+// prefixed with "sha256=".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks if signature is valid for body and timestamp.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	expected := Sign(secret, timestamp, body)
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
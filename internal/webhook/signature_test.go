@@ -0,0 +1,29 @@
+package webhook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tierklinik-dobersberg/cis-idm/internal/webhook"
+)
+
+func Test_SignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"1","type":"user.created"}`)
+
+	sig := webhook.Sign("secret", 1700000000, body)
+
+	assert.True(t, webhook.Verify("secret", 1700000000, body, sig))
+	assert.False(t, webhook.Verify("other", 1700000000, body, sig))
+	assert.False(t, webhook.Verify("secret", 1700000001, body, sig))
+	assert.False(t, webhook.Verify("secret", 1700000000, []byte(`{}`), sig))
+	assert.False(t, webhook.Verify("secret", 1700000000, body, sig[len("sha256="):]))
+}
+
+func Test_Backoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), webhook.Backoff(0))
+	assert.Equal(t, 30*time.Second, webhook.Backoff(1))
+	assert.Equal(t, time.Minute, webhook.Backoff(2))
+	assert.Equal(t, 4*time.Minute, webhook.Backoff(4))
+	assert.Equal(t, 6*time.Hour, webhook.Backoff(100))
+}